@@ -1,7 +1,14 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/joeblew999/automerge-wazero-example/pkg/config"
 	"github.com/joeblew999/automerge-wazero-example/pkg/httpserver"
@@ -17,6 +24,23 @@ func main() {
 		log.Fatalf("Failed to create server: %v", err)
 	}
 
+	// Flush queued changes to disk on Ctrl-C / SIGTERM
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-stop
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("Shutdown: %v", err)
+		}
+	}()
+
 	// Start server (blocking)
-	log.Fatal(srv.ListenAndServe())
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	<-done // ListenAndServe returns as soon as Shutdown starts
 }
@@ -0,0 +1,230 @@
+// ==============================================================================
+// Layer 6: HTTP API - Text Attribution (Blame)
+// ==============================================================================
+// ARCHITECTURE: This is the HTTP protocol layer (Layer 6/7).
+//
+// RESPONSIBILITIES:
+// - HTTP request parsing (JSON body, query params, headers)
+// - HTTP response formatting (JSON, status codes, headers)
+// - Input validation (HTTP-level)
+// - Protocol translation (HTTP ↔ Go function calls)
+//
+// DEPENDENCIES:
+// - Layer 5: pkg/server (business logic, state management)
+//
+// DEPENDENTS:
+// - None (top of backend stack)
+//
+// RELATED FILES (1:1 mapping):
+// - Layer 2: rust/automerge_wasi/src/blame.rs (WASI exports)
+// - Layer 3: pkg/wazero/crdt_blame.go (FFI wrappers)
+// - Layer 4: pkg/automerge/crdt_blame.go (pure CRDT API)
+// - Layer 5: pkg/server/crdt_blame.go (stateful server operations)
+//
+// NOTES:
+// - Requests carrying X-User-ID make their edits as that user (WithUser)
+// - This layer is stateless (doesn't own any application state)
+// - All state management is delegated to Layer 5 (pkg/server)
+// - Handles HTTP protocol concerns (status codes, content-type, etc.)
+// ==============================================================================
+
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+	"github.com/joeblew999/automerge-wazero-example/pkg/server"
+)
+
+// BlameSpanJSON is the JSON representation of an attributed span
+type BlameSpanJSON struct {
+	Kind   string `json:"kind,omitempty"` // "insert" or "delete" (diff only)
+	Start  uint   `json:"start"`
+	End    uint   `json:"end"`
+	Text   string `json:"text"`
+	Actor  string `json:"actor"`
+	UserID string `json:"user_id"` // "" if the actor is not registered
+	Change string `json:"change"`
+	Time   int64  `json:"time"` // Unix seconds (0 if unknown)
+}
+
+// TextBlameResponse represents the response for GET /api/text/blame
+type TextBlameResponse struct {
+	Spans []BlameSpanJSON `json:"spans"`
+}
+
+// TextBlameDiffResponse represents the response for GET /api/text/blame?before=...
+type TextBlameDiffResponse struct {
+	Edits []BlameSpanJSON `json:"edits"`
+}
+
+func blameSpanJSON(kind automerge.EditKind, span automerge.AttributionSpan, userID string) BlameSpanJSON {
+	out := BlameSpanJSON{
+		Kind:   string(kind),
+		Start:  span.Start,
+		End:    span.End,
+		Text:   span.Text,
+		Actor:  span.Actor,
+		UserID: userID,
+		Change: span.Change.String(),
+	}
+	if !span.Time.IsZero() {
+		out.Time = span.Time.Unix()
+	}
+	return out
+}
+
+// TextBlameHandler handles GET /api/text/blame - Who wrote each span of a text
+// Query params:
+//   - path: text object path (default ROOT.content)
+//   - before, after: comma-separated heads; with before, returns the spans
+//     inserted and deleted since then (after defaults to the current heads)
+func TextBlameHandler(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ctx := r.Context()
+		query := r.URL.Query()
+
+		pathStr := query.Get("path")
+		if pathStr == "" {
+			pathStr = "ROOT.content"
+		}
+		path, err := automerge.ParseObjPath(pathStr)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid path: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		before, err := parseHeads(query.Get("before"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid before heads: %v", err), http.StatusBadRequest)
+			return
+		}
+		after, err := parseHeads(query.Get("after"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid after heads: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		if before == nil && after == nil {
+			spans, err := srv.TextBlame(ctx, path)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to get blame: %v", err), errorStatus(err))
+				return
+			}
+			resp := TextBlameResponse{Spans: make([]BlameSpanJSON, len(spans))}
+			for i, span := range spans {
+				resp.Spans[i] = blameSpanJSON("", span.AttributionSpan, span.UserID)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(resp)
+			return
+		}
+
+		if after == nil {
+			heads, err := srv.GetHeads(ctx)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to get heads: %v", err), errorStatus(err))
+				return
+			}
+			after, _ = parseHeads(strings.Join(heads, ","))
+		}
+		edits, err := srv.TextBlameDiff(ctx, path, before, after)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get blame diff: %v", err), errorStatus(err))
+			return
+		}
+		resp := TextBlameDiffResponse{Edits: make([]BlameSpanJSON, len(edits))}
+		for i, edit := range edits {
+			resp.Edits[i] = blameSpanJSON(edit.Kind, edit.AttributionSpan, edit.UserID)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// UserHeader names the user a request's edits are made for
+const UserHeader = "X-User-ID"
+
+// WithUser makes the edits of requests carrying UserHeader with an actor
+// registered to that user (see server.WithUser), so blame names them
+// rather than the server's user
+func WithUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if userID := r.Header.Get(UserHeader); userID != "" {
+			r = r.WithContext(server.WithUser(r.Context(), userID))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ActorJSON is an entry of the actor registry (POST /api/actors body,
+// GET /api/actors response)
+type ActorJSON struct {
+	Actor  string `json:"actor"`
+	UserID string `json:"user_id"` // "" if the actor is not registered
+}
+
+// ActorsHandler handles /api/actors - The actor → user registry blame reads
+//   - GET ?actor=: the user registered for actor
+//   - POST {actor, user_id}: registers a peer's actor (hex) as user_id's,
+//     so blame names the changes it syncs; 409 if another user has it or
+//     the server makes changes with it
+//
+// Registrations are trusted (see server.RegisterActor): serve this route to
+// authenticated peers only.
+func ActorsHandler(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			actor := r.URL.Query().Get("actor")
+			if actor == "" {
+				http.Error(w, "Missing actor", http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(ActorJSON{Actor: actor, UserID: srv.UserForActor(actor)})
+
+		case http.MethodPost:
+			var payload ActorJSON
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+				return
+			}
+			if payload.Actor == "" || payload.UserID == "" {
+				http.Error(w, "Missing actor or user_id", http.StatusBadRequest)
+				return
+			}
+			if _, err := hex.DecodeString(payload.Actor); err != nil {
+				http.Error(w, "Invalid actor: must be hex", http.StatusBadRequest)
+				return
+			}
+
+			if err := srv.RegisterActor(r.Context(), payload.Actor, payload.UserID); err != nil {
+				status := errorStatus(err)
+				if errors.Is(err, server.ErrActorRegistered) {
+					status = http.StatusConflict
+				}
+				http.Error(w, fmt.Sprintf("Failed to register actor: %v", err), status)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			log.Printf("Actor REGISTER: actor=%s, user=%s", payload.Actor, payload.UserID)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
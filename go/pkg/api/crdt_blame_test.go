@@ -0,0 +1,146 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/api"
+)
+
+// TestTextBlame tests text attribution via HTTP
+func TestTextBlame(t *testing.T) {
+	srv := newTestServer(t)
+
+	headsRR := doRequest(t, api.HeadsHandler(srv), "GET", "/api/heads", nil)
+	var before api.HistoryResponse
+	if err := json.Unmarshal(headsRR.Body.Bytes(), &before); err != nil {
+		t.Fatalf("Failed to unmarshal heads: %v", err)
+	}
+
+	doRequest(t, api.TextHandler(srv), "POST", "/api/text", map[string]interface{}{"text": "Hello"})
+
+	t.Run("Current text", func(t *testing.T) {
+		rr := doRequest(t, api.TextBlameHandler(srv), "GET", "/api/text/blame", nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("blame returned %d: %s", rr.Code, rr.Body.String())
+		}
+
+		var resp api.TextBlameResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if len(resp.Spans) != 1 {
+			t.Fatalf("spans = %+v, want 1", resp.Spans)
+		}
+		span := resp.Spans[0]
+		if span.Text != "Hello" || span.Start != 0 || span.End != 5 {
+			t.Errorf("span = %+v", span)
+		}
+		if span.UserID != "test-user" {
+			t.Errorf("user_id = %q, want %q", span.UserID, "test-user")
+		}
+		if span.Time == 0 {
+			t.Error("expected the change to carry a time")
+		}
+	})
+
+	t.Run("Since heads", func(t *testing.T) {
+		if len(before.Heads) == 0 {
+			t.Fatal("expected the initial document to have heads")
+		}
+		url := "/api/text/blame?before=" + strings.Join(before.Heads, ",")
+		rr := doRequest(t, api.TextBlameHandler(srv), "GET", url, nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("blame diff returned %d: %s", rr.Code, rr.Body.String())
+		}
+
+		var resp api.TextBlameDiffResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if len(resp.Edits) != 1 || resp.Edits[0].Kind != "insert" || resp.Edits[0].Text != "Hello" {
+			t.Errorf("edits = %+v, want one insert of %q", resp.Edits, "Hello")
+		}
+	})
+
+	t.Run("Invalid heads", func(t *testing.T) {
+		rr := doRequest(t, api.TextBlameHandler(srv), "GET", "/api/text/blame?before=nothex", nil)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("got %d, want %d", rr.Code, http.StatusBadRequest)
+		}
+	})
+}
+
+// TestTextBlame_Users tests blame naming the users behind HTTP edits and
+// registered peer actors
+func TestTextBlame_Users(t *testing.T) {
+	srv := newTestServer(t)
+	handler := api.WithUser(api.TextHandler(srv))
+
+	body, _ := json.Marshal(map[string]string{"text": "Hello"})
+	req := httptest.NewRequest("POST", "/api/text", bytes.NewReader(body))
+	req.Header.Set(api.UserHeader, "alice")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("POST /api/text returned %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = doRequest(t, api.TextBlameHandler(srv), "GET", "/api/text/blame", nil)
+	var resp api.TextBlameResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(resp.Spans) != 1 || resp.Spans[0].UserID != "alice" {
+		t.Fatalf("spans = %+v, want one span by alice", resp.Spans)
+	}
+	alice := resp.Spans[0].Actor
+
+	// Edits without the header are still the server's
+	srv.SetText(context.Background(), "Hello!")
+	rr = doRequest(t, api.TextBlameHandler(srv), "GET", "/api/text/blame", nil)
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if len(resp.Spans) != 1 || resp.Spans[0].UserID != "test-user" || resp.Spans[0].Actor == alice {
+		t.Errorf("spans = %+v, want one span by test-user", resp.Spans)
+	}
+
+	t.Run("Register actor", func(t *testing.T) {
+		peer := "0123456789abcdef"
+		rr := doRequest(t, api.ActorsHandler(srv), "POST", "/api/actors",
+			map[string]string{"actor": peer, "user_id": "bob"})
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("POST /api/actors returned %d: %s", rr.Code, rr.Body.String())
+		}
+
+		rr = doRequest(t, api.ActorsHandler(srv), "GET", "/api/actors?actor="+peer, nil)
+		var got api.ActorJSON
+		json.Unmarshal(rr.Body.Bytes(), &got)
+		if got.UserID != "bob" {
+			t.Errorf("GET /api/actors = %+v, want bob", got)
+		}
+	})
+
+	t.Run("Invalid registrations", func(t *testing.T) {
+		tests := []struct {
+			name string
+			body map[string]string
+			want int
+		}{
+			{"missing user", map[string]string{"actor": "abcd"}, http.StatusBadRequest},
+			{"not hex", map[string]string{"actor": "xyz", "user_id": "bob"}, http.StatusBadRequest},
+			{"another user's actor", map[string]string{"actor": alice, "user_id": "mallory"}, http.StatusConflict},
+			{"an actor the server edits with", map[string]string{"actor": alice, "user_id": "alice"}, http.StatusConflict},
+		}
+		for _, tt := range tests {
+			rr := doRequest(t, api.ActorsHandler(srv), "POST", "/api/actors", tt.body)
+			if rr.Code != tt.want {
+				t.Errorf("%s: got %d, want %d", tt.name, rr.Code, tt.want)
+			}
+		}
+	})
+}
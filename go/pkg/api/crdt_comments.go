@@ -0,0 +1,229 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+	"github.com/joeblew999/automerge-wazero-example/pkg/server"
+)
+
+// CommentPayload represents a request to comment on a range of text
+type CommentPayload struct {
+	Path   string `json:"path"`   // Text object path (default "ROOT.content")
+	Start  uint   `json:"start"`  // First commented character
+	End    uint   `json:"end"`    // End of the range (exclusive)
+	Author string `json:"author"` // Defaults to the server's user ID
+	Body   string `json:"body"`
+}
+
+// CommentReplyPayload represents a reply to a comment thread
+type CommentReplyPayload struct {
+	ID     string `json:"id"`     // Comment ID
+	Author string `json:"author"` // Defaults to the server's user ID
+	Body   string `json:"body"`
+}
+
+// CommentResolvePayload represents resolving (or reopening) a comment thread
+type CommentResolvePayload struct {
+	ID       string `json:"id"`
+	Resolved bool   `json:"resolved"`
+}
+
+// CommentReplyResponse is one reply in a comment thread
+type CommentReplyResponse struct {
+	ID      string `json:"id"`
+	Author  string `json:"author"`
+	Body    string `json:"body"`
+	Created string `json:"created"` // RFC 3339
+}
+
+// CommentResponse is a comment thread with its current range
+type CommentResponse struct {
+	ID       string                 `json:"id"`
+	Path     string                 `json:"path"`
+	Start    uint                   `json:"start"`
+	End      uint                   `json:"end"`
+	Orphaned bool                   `json:"orphaned"` // The commented text was deleted
+	Quote    string                 `json:"quote"`    // The text when the comment was made
+	Author   string                 `json:"author"`
+	Body     string                 `json:"body"`
+	Created  string                 `json:"created"` // RFC 3339
+	Resolved bool                   `json:"resolved"`
+	Replies  []CommentReplyResponse `json:"replies"`
+}
+
+// CommentsResponse represents the response for GET /api/comments
+type CommentsResponse struct {
+	Comments []CommentResponse `json:"comments"`
+}
+
+func commentReplyResponse(r automerge.CommentReply) CommentReplyResponse {
+	return CommentReplyResponse{ID: r.ID, Author: r.Author, Body: r.Body, Created: r.Created.Format(time.RFC3339)}
+}
+
+func commentResponse(c automerge.CommentRange) CommentResponse {
+	resp := CommentResponse{
+		ID:       c.ID,
+		Path:     commentPath(c.Path),
+		Start:    c.Start,
+		End:      c.End,
+		Orphaned: c.Orphaned,
+		Quote:    c.Quote,
+		Author:   c.Author,
+		Body:     c.Body,
+		Created:  c.Created.Format(time.RFC3339),
+		Resolved: c.Resolved,
+		Replies:  make([]CommentReplyResponse, 0, len(c.Replies)),
+	}
+	for _, r := range c.Replies {
+		resp.Replies = append(resp.Replies, commentReplyResponse(r))
+	}
+	return resp
+}
+
+// commentPath renders a path in the dotted form clients send
+func commentPath(p automerge.Path) string {
+	s, err := p.ObjPath()
+	if err != nil {
+		return p.String()
+	}
+	return s
+}
+
+// commentError writes err with the status matching its cause
+func commentError(w http.ResponseWriter, action string, err error) {
+	switch {
+	case errors.Is(err, automerge.ErrKeyNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, automerge.ErrIndexOutOfBounds), errors.Is(err, automerge.ErrTypeMismatch):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, fmt.Sprintf("Failed to %s: %v", action, err), errorStatus(err))
+	}
+}
+
+// CommentsHandler handles comment threads
+// GET /api/comments - List comments with their current ranges
+// POST /api/comments {path, start, end, author, body} - Comment on a range
+func CommentsHandler(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		switch r.Method {
+		case http.MethodGet:
+			comments, err := srv.Comments(ctx)
+			if err != nil {
+				commentError(w, "get comments", err)
+				return
+			}
+
+			resp := CommentsResponse{Comments: make([]CommentResponse, 0, len(comments))}
+			for _, c := range comments {
+				resp.Comments = append(resp.Comments, commentResponse(c))
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(resp)
+
+		case http.MethodPost:
+			var payload CommentPayload
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+				return
+			}
+			if payload.Body == "" {
+				http.Error(w, "Missing body", http.StatusBadRequest)
+				return
+			}
+			if payload.Path == "" {
+				payload.Path = "ROOT.content"
+			}
+			path, err := automerge.ParseObjPath(payload.Path)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid path: %v", err), http.StatusBadRequest)
+				return
+			}
+
+			comment, err := srv.AddComment(ctx, path, payload.Start, payload.End, payload.Author, payload.Body)
+			if err != nil {
+				commentError(w, "add comment", err)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(commentResponse(automerge.CommentRange{
+				Comment: *comment,
+				Start:   payload.Start,
+				End:     payload.End,
+			}))
+			log.Printf("Comment ADD: id=%s, path=%s, range=%d-%d", comment.ID, payload.Path, payload.Start, payload.End)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// CommentReplyHandler handles POST /api/comments/reply {id, author, body}
+func CommentReplyHandler(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var payload CommentReplyPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+			return
+		}
+		if payload.ID == "" || payload.Body == "" {
+			http.Error(w, "Missing id or body", http.StatusBadRequest)
+			return
+		}
+
+		reply, err := srv.ReplyToComment(r.Context(), payload.ID, payload.Author, payload.Body)
+		if err != nil {
+			commentError(w, "reply", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(commentReplyResponse(*reply))
+		log.Printf("Comment REPLY: id=%s, reply=%s", payload.ID, reply.ID)
+	}
+}
+
+// CommentResolveHandler handles POST /api/comments/resolve {id, resolved}
+func CommentResolveHandler(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var payload CommentResolvePayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+			return
+		}
+		if payload.ID == "" {
+			http.Error(w, "Missing id", http.StatusBadRequest)
+			return
+		}
+
+		if err := srv.ResolveComment(r.Context(), payload.ID, payload.Resolved); err != nil {
+			commentError(w, "resolve comment", err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		log.Printf("Comment RESOLVE: id=%s, resolved=%v", payload.ID, payload.Resolved)
+	}
+}
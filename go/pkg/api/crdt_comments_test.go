@@ -0,0 +1,92 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/api"
+)
+
+// TestComments tests commenting, replying and resolving via HTTP
+func TestComments(t *testing.T) {
+	srv := newTestServer(t)
+	doRequest(t, api.TextHandler(srv), "POST", "/api/text", map[string]interface{}{"text": "Hello World"})
+
+	commentsHandler := api.CommentsHandler(srv)
+
+	rr := doRequest(t, commentsHandler, "POST", "/api/comments", map[string]interface{}{
+		"path": "ROOT.content", "start": 6, "end": 11, "body": "Which one?",
+	})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("POST /api/comments status = %d, body: %s", rr.Code, rr.Body.String())
+	}
+	var created api.CommentResponse
+	if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if created.ID == "" || created.Quote != "World" || created.Author != "test-user" {
+		t.Errorf("created = %+v", created)
+	}
+
+	t.Run("Invalid range", func(t *testing.T) {
+		rr := doRequest(t, commentsHandler, "POST", "/api/comments", map[string]interface{}{
+			"start": 6, "end": 99, "body": "too long",
+		})
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", rr.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("Reply and resolve", func(t *testing.T) {
+		rr := doRequest(t, api.CommentReplyHandler(srv), "POST", "/api/comments/reply", map[string]interface{}{
+			"id": created.ID, "author": "bob", "body": "The big one",
+		})
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("reply status = %d, body: %s", rr.Code, rr.Body.String())
+		}
+
+		rr = doRequest(t, api.CommentResolveHandler(srv), "POST", "/api/comments/resolve", map[string]interface{}{
+			"id": created.ID, "resolved": true,
+		})
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("resolve status = %d, body: %s", rr.Code, rr.Body.String())
+		}
+
+		rr = doRequest(t, api.CommentResolveHandler(srv), "POST", "/api/comments/resolve", map[string]interface{}{
+			"id": "missing", "resolved": true,
+		})
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("resolve missing status = %d, want %d", rr.Code, http.StatusNotFound)
+		}
+	})
+
+	t.Run("List follows edits", func(t *testing.T) {
+		// Edit through a delta: /api/text replaces the whole text
+		rr := doRequest(t, api.RichTextDeltaHandler(srv), "POST", "/api/richtext/delta", map[string]interface{}{
+			"delta": map[string]interface{}{"ops": []interface{}{
+				map[string]interface{}{"retain": 6},
+				map[string]interface{}{"insert": "big "},
+			}},
+		})
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("delta status = %d, body: %s", rr.Code, rr.Body.String())
+		}
+
+		rr = doRequest(t, commentsHandler, "GET", "/api/comments", nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("GET status = %d, body: %s", rr.Code, rr.Body.String())
+		}
+		var resp api.CommentsResponse
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if len(resp.Comments) != 1 {
+			t.Fatalf("comments = %+v", resp.Comments)
+		}
+		c := resp.Comments[0]
+		if c.Start != 10 || c.End != 15 || c.Orphaned || !c.Resolved || len(c.Replies) != 1 || c.Path != "ROOT.content" {
+			t.Errorf("comment = %+v", c)
+		}
+	})
+}
@@ -51,7 +51,7 @@ func CounterIncrementHandler(srv *server.Server) http.HandlerFunc {
 		}
 
 		if err := srv.IncrementCounter(ctx, parsePathString(payload.Path), payload.Key, payload.Delta); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to increment: %v", err), http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("Failed to increment: %v", err), errorStatus(err))
 			return
 		}
 
@@ -87,7 +87,7 @@ func CounterGetHandler(srv *server.Server) http.HandlerFunc {
 				log.Printf("Counter not found (returning 0): path=%s, key=%s", path, key)
 				value = 0
 			} else {
-				http.Error(w, fmt.Sprintf("Failed to get counter: %v", err), http.StatusInternalServerError)
+				http.Error(w, fmt.Sprintf("Failed to get counter: %v", err), errorStatus(err))
 				return
 			}
 		}
@@ -142,14 +142,14 @@ func CounterHandler(srv *server.Server) http.HandlerFunc {
 			}
 
 			if err := srv.IncrementCounter(ctx, parsePathString(payload.Path), payload.Key, delta); err != nil {
-				http.Error(w, fmt.Sprintf("Failed to increment: %v", err), http.StatusInternalServerError)
+				http.Error(w, fmt.Sprintf("Failed to increment: %v", err), errorStatus(err))
 				return
 			}
 
 			// Return current value after increment
 			value, err := srv.GetCounter(ctx, parsePathString(payload.Path), payload.Key)
 			if err != nil {
-				http.Error(w, fmt.Sprintf("Failed to get updated counter: %v", err), http.StatusInternalServerError)
+				http.Error(w, fmt.Sprintf("Failed to get updated counter: %v", err), errorStatus(err))
 				return
 			}
 
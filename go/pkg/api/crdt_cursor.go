@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -11,21 +12,24 @@ import (
 
 // CursorGetRequest represents a request to get a cursor at a position
 type CursorGetRequest struct {
-	Path  string `json:"path"`  // Object path (e.g., "ROOT.content")
-	Index int    `json:"index"` // Position in the object
+	Path  string `json:"path"`  // Object path (e.g., "ROOT.content" or "ROOT.items")
+	Index int    `json:"index"` // Position in the object (0..=length)
+	Bias  string `json:"bias"`  // "after" (default) or "before"
 }
 
 // CursorGetResponse represents the response with cursor information
 type CursorGetResponse struct {
 	Path   string `json:"path"`   // Object path
 	Index  int    `json:"index"`  // Original position
-	Cursor string `json:"cursor"` // Cursor value (opaque string)
+	Bias   string `json:"bias"`   // Neighbour the cursor sticks to
+	Cursor string `json:"cursor"` // Cursor (stable string form, includes path and bias)
 }
 
-// CursorLookupRequest represents a request to lookup a cursor's position
+// CursorLookupRequest represents a request to lookup cursor positions:
+// either one cursor, or a batch
 type CursorLookupRequest struct {
-	Path   string `json:"path"`   // Object path
-	Cursor string `json:"cursor"` // Cursor value to lookup
+	Cursor  string   `json:"cursor,omitempty"`  // Cursor to lookup
+	Cursors []string `json:"cursors,omitempty"` // Cursors to lookup in one go
 }
 
 // CursorLookupResponse represents the response with cursor position
@@ -35,21 +39,36 @@ type CursorLookupResponse struct {
 	Index  int    `json:"index"`  // Current position
 }
 
+// CursorLookupBatchResponse represents the positions of a batch of cursors
+type CursorLookupBatchResponse struct {
+	Indexes []int `json:"indexes"` // Current positions (-1 = can't be resolved)
+}
+
+// cursorError writes err with the status matching its cause
+func cursorError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, automerge.ErrObjectNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, automerge.ErrIndexOutOfBounds), errors.Is(err, automerge.ErrTypeMismatch):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), errorStatus(err))
+	}
+}
+
 // CursorGetHandler returns a handler for GET /api/cursor and POST /api/cursor
-// GET with query params: ?path=ROOT.content&index=5
-// POST with JSON body: {"path": "ROOT.content", "index": 5}
+// GET with query params: ?path=ROOT.content&index=5&bias=before
+// POST with JSON body: {"path": "ROOT.content", "index": 5, "bias": "before"}
 func CursorGetHandler(srv *server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
-		var path string
-		var index int
-		var err error
+		var req CursorGetRequest
 
 		if r.Method == http.MethodGet {
 			// Parse query parameters
-			path = r.URL.Query().Get("path")
-			if path == "" {
+			req.Path = r.URL.Query().Get("path")
+			if req.Path == "" {
 				http.Error(w, "missing path parameter", http.StatusBadRequest)
 				return
 			}
@@ -60,38 +79,48 @@ func CursorGetHandler(srv *server.Server) http.HandlerFunc {
 				return
 			}
 
-			index, err = strconv.Atoi(indexStr)
+			var err error
+			req.Index, err = strconv.Atoi(indexStr)
 			if err != nil {
 				http.Error(w, "invalid index parameter", http.StatusBadRequest)
 				return
 			}
+			req.Bias = r.URL.Query().Get("bias")
 		} else if r.Method == http.MethodPost {
 			// Parse JSON body
-			var req CursorGetRequest
 			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 				http.Error(w, "invalid JSON", http.StatusBadRequest)
 				return
 			}
-
-			path = req.Path
-			index = req.Index
 		} else {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
+		path, err := automerge.ParseObjPath(req.Path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		bias, err := automerge.ParseCursorBias(req.Bias)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		// Get cursor from server
-		cursor, err := srv.GetCursor(ctx, path, index)
+		cursor, err := srv.GetCursor(ctx, path, req.Index, bias)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			cursorError(w, err)
 			return
 		}
 
 		// Return response
 		resp := CursorGetResponse{
-			Path:   cursor.Path,
-			Index:  index,
-			Cursor: cursor.Value,
+			Path:   req.Path,
+			Index:  req.Index,
+			Bias:   bias.String(),
+			Cursor: cursor.String(),
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -100,7 +129,7 @@ func CursorGetHandler(srv *server.Server) http.HandlerFunc {
 }
 
 // CursorLookupHandler returns a handler for POST /api/cursor/lookup
-// POST with JSON body: {"path": "ROOT.content", "cursor": "..."}
+// POST with JSON body: {"cursor": "..."} or {"cursors": ["...", "..."]}
 func CursorLookupHandler(srv *server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
@@ -117,8 +146,25 @@ func CursorLookupHandler(srv *server.Server) http.HandlerFunc {
 			return
 		}
 
-		if req.Path == "" {
-			http.Error(w, "missing path", http.StatusBadRequest)
+		if req.Cursors != nil {
+			cursors := make([]automerge.Cursor, len(req.Cursors))
+			for i, s := range req.Cursors {
+				c, err := automerge.ParseCursor(s)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				cursors[i] = c
+			}
+
+			indexes, err := srv.LookupCursors(ctx, cursors)
+			if err != nil {
+				cursorError(w, err)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(CursorLookupBatchResponse{Indexes: indexes})
 			return
 		}
 
@@ -127,22 +173,23 @@ func CursorLookupHandler(srv *server.Server) http.HandlerFunc {
 			return
 		}
 
-		// Create cursor object
-		cursor := &automerge.Cursor{
-			Path:  req.Path,
-			Value: req.Cursor,
+		cursor, err := automerge.ParseCursor(req.Cursor)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 
 		// Lookup cursor position
-		index, err := srv.LookupCursor(ctx, cursor)
+		index, err := srv.LookupCursor(ctx, &cursor)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			cursorError(w, err)
 			return
 		}
 
 		// Return response
+		path, _ := cursor.Path.ObjPath()
 		resp := CursorLookupResponse{
-			Path:   req.Path,
+			Path:   path,
 			Cursor: req.Cursor,
 			Index:  index,
 		}
@@ -0,0 +1,75 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/api"
+)
+
+// TestCursorOperations tests creating and looking up cursors via HTTP
+func TestCursorOperations(t *testing.T) {
+	srv := newTestServer(t)
+	doRequest(t, api.TextHandler(srv), "POST", "/api/text", map[string]interface{}{"text": "Hello World"})
+
+	getCursor := func(t *testing.T, index int, bias string) string {
+		t.Helper()
+		rr := doRequest(t, api.CursorGetHandler(srv), "POST", "/api/cursor", map[string]interface{}{
+			"path": "ROOT.content", "index": index, "bias": bias,
+		})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("POST /api/cursor status = %d, body: %s", rr.Code, rr.Body.String())
+		}
+		var resp api.CursorGetResponse
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return resp.Cursor
+	}
+
+	after := getCursor(t, 5, "")
+	before := getCursor(t, 5, "before")
+
+	t.Run("Invalid requests", func(t *testing.T) {
+		rr := doRequest(t, api.CursorGetHandler(srv), "GET", "/api/cursor?path=ROOT.content&index=99", nil)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("out of range status = %d, want %d", rr.Code, http.StatusBadRequest)
+		}
+		rr = doRequest(t, api.CursorGetHandler(srv), "GET", "/api/cursor?path=ROOT.content&index=0&bias=left", nil)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("bad bias status = %d, want %d", rr.Code, http.StatusBadRequest)
+		}
+		rr = doRequest(t, api.CursorLookupHandler(srv), "POST", "/api/cursor/lookup", map[string]interface{}{"cursor": "nonsense"})
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("bad cursor status = %d, want %d", rr.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("Batch lookup after edit", func(t *testing.T) {
+		// Insert "," at 5 through a delta: /api/text replaces the whole text
+		rr := doRequest(t, api.RichTextDeltaHandler(srv), "POST", "/api/richtext/delta", map[string]interface{}{
+			"delta": map[string]interface{}{"ops": []interface{}{
+				map[string]interface{}{"retain": 5},
+				map[string]interface{}{"insert": ","},
+			}},
+		})
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("delta status = %d, body: %s", rr.Code, rr.Body.String())
+		}
+
+		rr = doRequest(t, api.CursorLookupHandler(srv), "POST", "/api/cursor/lookup", map[string]interface{}{
+			"cursors": []string{after, before},
+		})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("lookup status = %d, body: %s", rr.Code, rr.Body.String())
+		}
+		var resp api.CursorLookupBatchResponse
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if len(resp.Indexes) != 2 || resp.Indexes[0] != 6 || resp.Indexes[1] != 5 {
+			t.Errorf("indexes = %v, want [6 5]", resp.Indexes)
+		}
+	})
+}
@@ -31,7 +31,7 @@ func HeadsHandler(srv *server.Server) http.HandlerFunc {
 		ctx := r.Context()
 		heads, err := srv.GetHeads(ctx)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to get heads: %v", err), http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("Failed to get heads: %v", err), errorStatus(err))
 			return
 		}
 
@@ -55,7 +55,7 @@ func ChangesHandler(srv *server.Server) http.HandlerFunc {
 		// TODO: Parse 'since' parameter to filter changes
 		changes, err := srv.GetChanges(ctx, nil)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to get changes: %v", err), http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("Failed to get changes: %v", err), errorStatus(err))
 			return
 		}
 
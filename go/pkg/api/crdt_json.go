@@ -0,0 +1,44 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+	"github.com/joeblew999/automerge-wazero-example/pkg/server"
+)
+
+// JSONHandler handles GET /api/json - Export a subtree as JSON
+// Query params: ?path=ROOT.items (default ROOT)
+//
+// Served by a read replica when the server has any; the X-Automerge-Heads
+// header says which state of the document the export reflects.
+func JSONHandler(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		pathStr := r.URL.Query().Get("path")
+		if pathStr == "" {
+			pathStr = "ROOT"
+		}
+		path, err := automerge.ParseObjPath(pathStr)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid path: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		value, info, err := srv.ReadJSON(r.Context(), path)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to export JSON: %v", err), errorStatus(err))
+			return
+		}
+
+		setReadHeaders(w, info)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(value)
+	}
+}
@@ -0,0 +1,55 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/api"
+)
+
+func TestJSONHandler(t *testing.T) {
+	srv := newTestServer(t)
+	rr := doRequest(t, api.TextHandler(srv), "POST", "/api/text", map[string]string{"text": "exported"})
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("POST text returned %d", rr.Code)
+	}
+
+	rr = doRequest(t, api.JSONHandler(srv), "GET", "/api/json", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("GET json returned %d: %s", rr.Code, rr.Body.String())
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if doc["content"] != "exported" {
+		t.Errorf("content = %v, want %q", doc["content"], "exported")
+	}
+
+	// The export reports the heads it reflects
+	heads := doRequest(t, api.HeadsHandler(srv), "GET", "/api/heads", nil)
+	var resp api.HistoryResponse
+	json.Unmarshal(heads.Body.Bytes(), &resp)
+	if got, want := rr.Header().Get("X-Automerge-Heads"), strings.Join(resp.Heads, ","); got != want {
+		t.Errorf("X-Automerge-Heads = %q, want %q", got, want)
+	}
+	if got := rr.Header().Get("X-Automerge-Source"); got != "primary" {
+		t.Errorf("X-Automerge-Source = %q, want %q", got, "primary")
+	}
+
+	t.Run("invalid path", func(t *testing.T) {
+		rr := doRequest(t, api.JSONHandler(srv), "GET", "/api/json?path=content", nil)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want 400", rr.Code)
+		}
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		rr := doRequest(t, api.JSONHandler(srv), "POST", "/api/json", nil)
+		if rr.Code != http.StatusMethodNotAllowed {
+			t.Errorf("status = %d, want 405", rr.Code)
+		}
+	})
+}
@@ -51,7 +51,7 @@ func ListPushHandler(srv *server.Server) http.HandlerFunc {
 		}
 
 		if err := srv.ListPush(ctx, parsePathString(payload.Path), payload.Value); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to push: %v", err), http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("Failed to push: %v", err), errorStatus(err))
 			return
 		}
 
@@ -87,7 +87,7 @@ func ListInsertHandler(srv *server.Server) http.HandlerFunc {
 		}
 
 		if err := srv.ListInsert(ctx, parsePathString(payload.Path), *payload.Index, payload.Value); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to insert: %v", err), http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("Failed to insert: %v", err), errorStatus(err))
 			return
 		}
 
@@ -121,7 +121,7 @@ func ListGetHandler(srv *server.Server) http.HandlerFunc {
 
 		value, err := srv.ListGet(ctx, parsePathString(path), uint(index))
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to get: %v", err), http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("Failed to get: %v", err), errorStatus(err))
 			return
 		}
 
@@ -154,7 +154,7 @@ func ListDeleteHandler(srv *server.Server) http.HandlerFunc {
 		}
 
 		if err := srv.ListDelete(ctx, parsePathString(path), uint(index)); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to delete: %v", err), http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("Failed to delete: %v", err), errorStatus(err))
 			return
 		}
 
@@ -181,7 +181,7 @@ func ListLenHandler(srv *server.Server) http.HandlerFunc {
 
 		length, err := srv.ListLen(ctx, parsePathString(path))
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to get length: %v", err), http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("Failed to get length: %v", err), errorStatus(err))
 			return
 		}
 
@@ -43,7 +43,7 @@ func MapHandler(srv *server.Server) http.HandlerFunc {
 
 			value, err := srv.GetMapValue(ctx, parsePathString(path), key)
 			if err != nil {
-				http.Error(w, fmt.Sprintf("Failed to get value: %v", err), http.StatusInternalServerError)
+				http.Error(w, fmt.Sprintf("Failed to get value: %v", err), errorStatus(err))
 				return
 			}
 
@@ -70,7 +70,7 @@ func MapHandler(srv *server.Server) http.HandlerFunc {
 			}
 
 			if err := srv.PutMapValue(ctx, parsePathString(payload.Path), payload.Key, payload.Value); err != nil {
-				http.Error(w, fmt.Sprintf("Failed to put value: %v", err), http.StatusInternalServerError)
+				http.Error(w, fmt.Sprintf("Failed to put value: %v", err), errorStatus(err))
 				return
 			}
 
@@ -88,7 +88,7 @@ func MapHandler(srv *server.Server) http.HandlerFunc {
 			}
 
 			if err := srv.DeleteMapKey(ctx, parsePathString(path), key); err != nil {
-				http.Error(w, fmt.Sprintf("Failed to delete key: %v", err), http.StatusInternalServerError)
+				http.Error(w, fmt.Sprintf("Failed to delete key: %v", err), errorStatus(err))
 				return
 			}
 
@@ -118,7 +118,7 @@ func MapKeysHandler(srv *server.Server) http.HandlerFunc {
 
 		keys, err := srv.GetMapKeys(ctx, parsePathString(path))
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to get keys: %v", err), http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("Failed to get keys: %v", err), errorStatus(err))
 			return
 		}
 
@@ -20,6 +20,7 @@
 // - Layer 3: pkg/wazero/crdt_richtext.go (FFI wrappers)
 // - Layer 4: pkg/automerge/crdt_richtext.go (pure CRDT API)
 // - Layer 5: pkg/server/crdt_richtext.go (stateful server operations)
+// - pkg/automerge/richtext (HTML/Markdown export and import, Quill deltas)
 // - Layer 7: web/js/crdt_richtext.js + web/components/crdt_richtext.html
 //
 // NOTES:
@@ -31,24 +32,27 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 
 	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge/richtext"
 	"github.com/joeblew999/automerge-wazero-example/pkg/server"
 )
 
 // RichTextMarkPayload represents the JSON payload for mark operations
 type RichTextMarkPayload struct {
-	Path   string `json:"path"`   // Path to text object
-	Name   string `json:"name"`   // Mark name (e.g., "bold", "italic", "link")
-	Value  string `json:"value"`  // Mark value (e.g., "true", URL for links)
-	Start  uint   `json:"start"`  // Start position (inclusive)
-	End    uint   `json:"end"`    // End position (exclusive)
-	Expand string `json:"expand"` // "before", "after", "both", "none"
+	Path   string      `json:"path"`   // Path to text object
+	Name   string      `json:"name"`   // Mark name (e.g., "bold", "italic", "link")
+	Value  interface{} `json:"value"`  // Mark value: string, bool or number (e.g., true, URL for links)
+	Start  uint        `json:"start"`  // Start position (inclusive)
+	End    uint        `json:"end"`    // End position (exclusive)
+	Expand string      `json:"expand"` // "before", "after", "both", "none"
 }
 
 // RichTextUnmarkPayload represents the JSON payload for unmark operations
@@ -67,10 +71,11 @@ type RichTextMarksResponse struct {
 
 // MarkJSON is the JSON representation of a Mark
 type MarkJSON struct {
-	Name  string      `json:"name"`
-	Value interface{} `json:"value"` // Can be string, bool, int, float
-	Start uint        `json:"start"`
-	End   uint        `json:"end"`
+	Name   string      `json:"name"`
+	Value  interface{} `json:"value"` // Can be string, bool, int, float
+	Start  uint        `json:"start"`
+	End    uint        `json:"end"`
+	Expand string      `json:"expand"` // "before", "after", "both", "none"
 }
 
 // parseExpandMark converts string to ExpandMark enum
@@ -89,6 +94,41 @@ func parseExpandMark(expand string) automerge.ExpandMark {
 	}
 }
 
+// expandMarkName converts an ExpandMark to its string form
+func expandMarkName(expand automerge.ExpandMark) string {
+	switch expand {
+	case automerge.ExpandBefore:
+		return "before"
+	case automerge.ExpandAfter:
+		return "after"
+	case automerge.ExpandBoth:
+		return "both"
+	default:
+		return "none"
+	}
+}
+
+// markValue converts a JSON mark value (decoded with UseNumber) to a scalar
+func markValue(v interface{}) (automerge.Value, error) {
+	switch v := v.(type) {
+	case string:
+		return automerge.NewString(v), nil
+	case bool:
+		return automerge.NewBool(v), nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return automerge.NewInt(i), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return automerge.Value{}, fmt.Errorf("invalid number %q", v)
+		}
+		return automerge.NewFloat(f), nil
+	default:
+		return automerge.Value{}, fmt.Errorf("mark value must be a string, bool or number")
+	}
+}
+
 // RichTextMarkHandler handles POST /api/richtext/mark - Apply formatting mark
 // M2 Milestone: Rich text marks
 func RichTextMarkHandler(srv *server.Server) http.HandlerFunc {
@@ -106,7 +146,9 @@ func RichTextMarkHandler(srv *server.Server) http.HandlerFunc {
 		}
 
 		var payload RichTextMarkPayload
-		if err := json.Unmarshal(body, &payload); err != nil {
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if err := dec.Decode(&payload); err != nil {
 			http.Error(w, "Invalid JSON", http.StatusBadRequest)
 			return
 		}
@@ -116,10 +158,16 @@ func RichTextMarkHandler(srv *server.Server) http.HandlerFunc {
 			return
 		}
 
+		value, err := markValue(payload.Value)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid mark value: %v", err), http.StatusBadRequest)
+			return
+		}
+
 		// Create Mark struct
 		mark := automerge.Mark{
 			Name:  payload.Name,
-			Value: automerge.NewString(payload.Value),
+			Value: value,
 			Start: payload.Start,
 			End:   payload.End,
 		}
@@ -127,12 +175,12 @@ func RichTextMarkHandler(srv *server.Server) http.HandlerFunc {
 		expand := parseExpandMark(payload.Expand)
 
 		if err := srv.RichTextMark(ctx, parsePathString(payload.Path), mark, expand); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to apply mark: %v", err), http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("Failed to apply mark: %v", err), errorStatus(err))
 			return
 		}
 
 		w.WriteHeader(http.StatusNoContent)
-		log.Printf("RichText MARK: path=%s, name=%s, range=[%d,%d), expand=%s", payload.Path, payload.Name, payload.Start, payload.End, payload.Expand)
+		log.Printf("RichText MARK: path=%s, name=%s, value=%v, range=[%d,%d), expand=%s", payload.Path, payload.Name, payload.Value, payload.Start, payload.End, payload.Expand)
 	}
 }
 
@@ -166,7 +214,7 @@ func RichTextUnmarkHandler(srv *server.Server) http.HandlerFunc {
 		expand := parseExpandMark(payload.Expand)
 
 		if err := srv.RichTextUnmark(ctx, parsePathString(payload.Path), payload.Name, payload.Start, payload.End, expand); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to remove mark: %v", err), http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("Failed to remove mark: %v", err), errorStatus(err))
 			return
 		}
 
@@ -175,7 +223,65 @@ func RichTextUnmarkHandler(srv *server.Server) http.HandlerFunc {
 	}
 }
 
+// SpanJSON is the JSON representation of a Span
+type SpanJSON struct {
+	Text  string                 `json:"text,omitempty"`
+	Marks map[string]interface{} `json:"marks,omitempty"`
+	Block *BlockJSON             `json:"block,omitempty"` // Set for block markers
+}
+
+// BlockJSON is the JSON representation of a block marker
+type BlockJSON struct {
+	Type    string                 `json:"type"`
+	Parents []string               `json:"parents"`
+	Attrs   map[string]interface{} `json:"attrs"`
+}
+
+// RichTextSpansResponse represents the response for GetMarks with format=spans
+type RichTextSpansResponse struct {
+	Spans []SpanJSON `json:"spans"`
+}
+
+// markValueJSON converts a mark value to a plain JSON value
+func markValueJSON(v automerge.Value) interface{} {
+	if s, ok := v.AsString(); ok {
+		return s
+	} else if b, ok := v.AsBool(); ok {
+		return b
+	} else if n, ok := v.AsInt(); ok {
+		return n
+	} else if f, ok := v.AsFloat(); ok {
+		return f
+	}
+	return nil
+}
+
+// spansJSON converts spans to their JSON representation
+func spansJSON(spans []automerge.Span) []SpanJSON {
+	out := make([]SpanJSON, len(spans))
+	for i, span := range spans {
+		if span.Block != nil {
+			parents := span.Block.Parents
+			if parents == nil {
+				parents = []string{}
+			}
+			out[i].Block = &BlockJSON{Type: span.Block.Type, Parents: parents, Attrs: span.Block.Attrs}
+			continue
+		}
+		out[i].Text = span.Text
+		if len(span.Marks) > 0 {
+			out[i].Marks = make(map[string]interface{}, len(span.Marks))
+			for name, value := range span.Marks {
+				out[i].Marks[name] = markValueJSON(value)
+			}
+		}
+	}
+	return out
+}
+
 // RichTextMarksHandler handles GET /api/richtext/marks?path=ROOT.content&pos=5 - Get marks at position
+// With ?format=spans (pos not needed) it returns the whole text as spans of
+// text with their active marks, and block markers.
 // M2 Milestone: Rich text marks
 func RichTextMarksHandler(srv *server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -188,6 +294,27 @@ func RichTextMarksHandler(srv *server.Server) http.HandlerFunc {
 		path := r.URL.Query().Get("path")
 		posStr := r.URL.Query().Get("pos")
 
+		if r.URL.Query().Get("format") == "spans" {
+			if path == "" {
+				path = "ROOT.content"
+			}
+			objPath, err := automerge.ParseObjPath(path)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid path: %v", err), http.StatusBadRequest)
+				return
+			}
+
+			spans, err := srv.GetRichTextSpans(ctx, objPath)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to get spans: %v", err), errorStatus(err))
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(RichTextSpansResponse{Spans: spansJSON(spans)})
+			return
+		}
+
 		if path == "" || posStr == "" {
 			http.Error(w, "Missing path or pos parameter", http.StatusBadRequest)
 			return
@@ -202,7 +329,7 @@ func RichTextMarksHandler(srv *server.Server) http.HandlerFunc {
 		marks, err := srv.GetRichTextMarks(ctx, parsePathString(path), pos)
 		if err != nil {
 			log.Printf("ERROR: Failed to get marks at pos %d: %v", pos, err)
-			http.Error(w, fmt.Sprintf("Failed to get marks: %v", err), http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("Failed to get marks: %v", err), errorStatus(err))
 			return
 		}
 
@@ -211,24 +338,12 @@ func RichTextMarksHandler(srv *server.Server) http.HandlerFunc {
 		// Convert automerge.Mark to MarkJSON
 		jsonMarks := make([]MarkJSON, len(marks))
 		for i, mark := range marks {
-			var value interface{}
-			if s, ok := mark.Value.AsString(); ok {
-				value = s
-			} else if b, ok := mark.Value.AsBool(); ok {
-				value = b
-			} else if n, ok := mark.Value.AsInt(); ok {
-				value = n
-			} else if f, ok := mark.Value.AsFloat(); ok {
-				value = f
-			} else {
-				value = nil
-			}
-
 			jsonMarks[i] = MarkJSON{
-				Name:  mark.Name,
-				Value: value,
-				Start: mark.Start,
-				End:   mark.End,
+				Name:   mark.Name,
+				Value:  markValueJSON(mark.Value),
+				Expand: expandMarkName(mark.Expand),
+				Start:  mark.Start,
+				End:    mark.End,
 			}
 		}
 
@@ -236,3 +351,319 @@ func RichTextMarksHandler(srv *server.Server) http.HandlerFunc {
 		json.NewEncoder(w).Encode(RichTextMarksResponse{Marks: jsonMarks})
 	}
 }
+
+// RichTextBlockPayload represents the JSON payload for block operations
+type RichTextBlockPayload struct {
+	Path    string                 `json:"path"`    // Path to text object (default ROOT.content)
+	Index   *uint                  `json:"index"`   // Position of the block marker
+	Type    string                 `json:"type"`    // Block type (split/update), e.g. "paragraph", "heading"
+	Parents []string               `json:"parents"` // Enclosing block types (split/update)
+	Attrs   map[string]interface{} `json:"attrs"`   // Block attributes (split/update)
+}
+
+// decodeBlockPayload parses and validates a block payload
+func decodeBlockPayload(r *http.Request, needType bool) (RichTextBlockPayload, automerge.Path, error) {
+	var payload RichTextBlockPayload
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return payload, automerge.Path{}, fmt.Errorf("failed to read body")
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return payload, automerge.Path{}, fmt.Errorf("invalid JSON")
+	}
+	if payload.Index == nil {
+		return payload, automerge.Path{}, fmt.Errorf("missing index")
+	}
+	if needType && payload.Type == "" {
+		return payload, automerge.Path{}, fmt.Errorf("missing block type")
+	}
+	if payload.Path == "" {
+		payload.Path = "ROOT.content"
+	}
+	path, err := automerge.ParseObjPath(payload.Path)
+	if err != nil {
+		return payload, automerge.Path{}, fmt.Errorf("invalid path: %w", err)
+	}
+	return payload, path, nil
+}
+
+func (p RichTextBlockPayload) block() automerge.Block {
+	return automerge.Block{Type: p.Type, Parents: p.Parents, Attrs: p.Attrs}
+}
+
+// RichTextSplitBlockHandler handles POST /api/richtext/block/split - Insert a block marker
+func RichTextSplitBlockHandler(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		payload, path, err := decodeBlockPayload(r, true)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := srv.SplitBlock(r.Context(), path, *payload.Index, payload.block()); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to split block: %v", err), errorStatus(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		log.Printf("RichText SPLIT BLOCK: path=%s, index=%d, type=%s", payload.Path, *payload.Index, payload.Type)
+	}
+}
+
+// RichTextUpdateBlockHandler handles POST /api/richtext/block/update - Change a block's type/attributes
+func RichTextUpdateBlockHandler(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		payload, path, err := decodeBlockPayload(r, true)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := srv.UpdateBlock(r.Context(), path, *payload.Index, payload.block()); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to update block: %v", err), errorStatus(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		log.Printf("RichText UPDATE BLOCK: path=%s, index=%d, type=%s", payload.Path, *payload.Index, payload.Type)
+	}
+}
+
+// RichTextJoinBlockHandler handles POST /api/richtext/block/join - Remove a block marker
+func RichTextJoinBlockHandler(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		payload, path, err := decodeBlockPayload(r, false)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := srv.JoinBlock(r.Context(), path, *payload.Index); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to join block: %v", err), errorStatus(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		log.Printf("RichText JOIN BLOCK: path=%s, index=%d", payload.Path, *payload.Index)
+	}
+}
+
+// RichTextExportHandler handles GET /api/richtext/export?format=html|markdown - Render rich text
+// Query params:
+//   - path: text object path (default ROOT.content)
+//   - format: "html" (default) or "markdown"
+func RichTextExportHandler(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		pathStr := query.Get("path")
+		if pathStr == "" {
+			pathStr = "ROOT.content"
+		}
+		path, err := automerge.ParseObjPath(pathStr)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid path: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		format := query.Get("format")
+		if format == "" {
+			format = "html"
+		}
+		if format != "html" && format != "markdown" {
+			http.Error(w, "Invalid format (expected html or markdown)", http.StatusBadRequest)
+			return
+		}
+
+		spans, info, err := srv.ReadRichTextSpans(r.Context(), path)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get spans: %v", err), errorStatus(err))
+			return
+		}
+
+		setReadHeaders(w, info)
+		if format == "markdown" {
+			w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+			io.WriteString(w, richtext.Markdown(spans, richtext.MarkdownOptions{}))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, richtext.HTML(spans, richtext.HTMLOptions{}))
+	}
+}
+
+// RichTextImportPayload represents the JSON payload for POST /api/richtext/import
+type RichTextImportPayload struct {
+	Path    string `json:"path"`    // Text object path (default ROOT.content)
+	Format  string `json:"format"`  // "markdown" or "html"
+	Content string `json:"content"` // Source to import
+	Pos     *uint  `json:"pos"`     // Insert here instead of replacing the whole text
+	Delete  uint   `json:"delete"`  // Positions to replace at pos
+}
+
+// RichTextImportHandler handles POST /api/richtext/import - Import Markdown or HTML
+// Without pos the whole text is replaced; with pos the content is pasted there.
+// Either way the import is a single change.
+func RichTextImportHandler(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var payload RichTextImportPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if payload.Path == "" {
+			payload.Path = "ROOT.content"
+		}
+		path, err := automerge.ParseObjPath(payload.Path)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid path: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		var spans []automerge.Span
+		switch payload.Format {
+		case "markdown":
+			spans = richtext.ParseMarkdown(payload.Content, richtext.MarkdownOptions{})
+		case "html":
+			if spans, err = richtext.ParseHTML(payload.Content, richtext.HTMLOptions{}); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "Invalid format (expected markdown or html)", http.StatusBadRequest)
+			return
+		}
+
+		if payload.Pos == nil {
+			err = srv.ImportRichText(r.Context(), path, spans)
+		} else {
+			err = srv.PasteRichText(r.Context(), path, *payload.Pos, payload.Delete, spans)
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to import: %v", err), errorStatus(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		log.Printf("RichText IMPORT: path=%s, format=%s, spans=%d", payload.Path, payload.Format, len(spans))
+	}
+}
+
+// RichTextDeltaPayload represents the JSON payload for POST /api/richtext/delta
+type RichTextDeltaPayload struct {
+	Path  string         `json:"path"`  // Text object path (default ROOT.content)
+	Delta richtext.Delta `json:"delta"` // Quill delta: {"ops": [...]}
+}
+
+// RichTextDeltaResponse is the text (or the edits since some heads) as a delta
+type RichTextDeltaResponse struct {
+	Delta richtext.Delta `json:"delta"`
+	Heads []string       `json:"heads"` // Heads the delta brings the editor to
+}
+
+// headStrings converts change hashes to their hex form
+func headStrings(heads []automerge.ChangeHash) []string {
+	out := make([]string, len(heads))
+	for i, h := range heads {
+		out[i] = h.String()
+	}
+	return out
+}
+
+// RichTextDeltaHandler handles /api/richtext/delta - Quill Delta adapter
+//   - GET ?path=...: the whole text as a delta of inserts, with its heads
+//   - GET ?path=...&since=h1,h2: the edits made since those heads
+//   - POST {"path": ..., "delta": {"ops": [...]}}: apply an editor delta as one change
+func RichTextDeltaHandler(srv *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		switch r.Method {
+		case http.MethodGet:
+			query := r.URL.Query()
+			pathStr := query.Get("path")
+			if pathStr == "" {
+				pathStr = "ROOT.content"
+			}
+			path, err := automerge.ParseObjPath(pathStr)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid path: %v", err), http.StatusBadRequest)
+				return
+			}
+
+			var delta richtext.Delta
+			var heads []automerge.ChangeHash
+			if query.Has("since") {
+				since, err := parseHeads(query.Get("since"))
+				if err != nil {
+					http.Error(w, fmt.Sprintf("Invalid since heads: %v", err), http.StatusBadRequest)
+					return
+				}
+				delta, heads, err = srv.RichTextDeltaSince(ctx, path, since)
+			} else {
+				delta, heads, err = srv.RichTextDelta(ctx, path)
+			}
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to get delta: %v", err), errorStatus(err))
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(RichTextDeltaResponse{Delta: delta, Heads: headStrings(heads)})
+
+		case http.MethodPost:
+			var payload RichTextDeltaPayload
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+				return
+			}
+			if payload.Path == "" {
+				payload.Path = "ROOT.content"
+			}
+			path, err := automerge.ParseObjPath(payload.Path)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid path: %v", err), http.StatusBadRequest)
+				return
+			}
+
+			if err := srv.ApplyRichTextDelta(ctx, path, payload.Delta); err != nil {
+				if errors.Is(err, richtext.ErrInvalidDelta) {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				http.Error(w, fmt.Sprintf("Failed to apply delta: %v", err), errorStatus(err))
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+			log.Printf("RichText DELTA: path=%s, ops=%d", payload.Path, len(payload.Delta.Ops))
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package api_test
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/joeblew999/automerge-wazero-example/pkg/api"
@@ -132,3 +133,272 @@ func TestRichTextOperations(t *testing.T) {
 		}
 	})
 }
+
+// TestRichTextTypedMarks tests that mark values keep their JSON type and
+// marks report their expand setting
+func TestRichTextTypedMarks(t *testing.T) {
+	srv := newTestServer(t)
+
+	doRequest(t, api.TextHandler(srv), "POST", "/api/text", map[string]interface{}{"text": "Hello World"})
+	rr := doRequest(t, api.RichTextMarkHandler(srv), "POST", "/api/richtext/mark", map[string]interface{}{
+		"path":   "ROOT.content",
+		"name":   "bold",
+		"value":  true,
+		"start":  0,
+		"end":    5,
+		"expand": "after",
+	})
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("mark returned %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = doRequest(t, api.RichTextMarkHandler(srv), "POST", "/api/richtext/mark", map[string]interface{}{
+		"path":  "ROOT.content",
+		"name":  "size",
+		"value": 12,
+		"start": 6,
+		"end":   11,
+	})
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("mark returned %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = doRequest(t, api.RichTextMarkHandler(srv), "POST", "/api/richtext/mark", map[string]interface{}{
+		"path":  "ROOT.content",
+		"name":  "bad",
+		"value": map[string]interface{}{"nested": true},
+		"start": 0,
+		"end":   1,
+	})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("object value returned %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+
+	rr = doRequest(t, api.RichTextMarksHandler(srv), "GET", "/api/richtext/marks?path=ROOT.content&pos=2", nil)
+	var resp api.RichTextMarksResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(resp.Marks) != 1 || resp.Marks[0].Value != true || resp.Marks[0].Expand != "after" {
+		t.Errorf("marks at 2 = %+v, want bold=true expanding after", resp.Marks)
+	}
+
+	rr = doRequest(t, api.RichTextMarksHandler(srv), "GET", "/api/richtext/marks?path=ROOT.content&pos=7", nil)
+	resp = api.RichTextMarksResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(resp.Marks) != 1 || resp.Marks[0].Value != float64(12) || resp.Marks[0].Expand != "none" {
+		t.Errorf("marks at 7 = %+v, want size=12 not expanding", resp.Marks)
+	}
+}
+
+// TestRichTextSpans tests the ?format=spans mode of the marks endpoint
+func TestRichTextSpans(t *testing.T) {
+	srv := newTestServer(t)
+
+	doRequest(t, api.TextHandler(srv), "POST", "/api/text", map[string]interface{}{"text": "Hello World"})
+	doRequest(t, api.RichTextMarkHandler(srv), "POST", "/api/richtext/mark", map[string]interface{}{
+		"path":   "ROOT.content",
+		"name":   "bold",
+		"value":  "true",
+		"start":  0,
+		"end":    5,
+		"expand": "none",
+	})
+
+	rr := doRequest(t, api.RichTextMarksHandler(srv), "GET", "/api/richtext/marks?path=ROOT.content&format=spans", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("spans returned %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var resp api.RichTextSpansResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(resp.Spans) != 2 {
+		t.Fatalf("spans = %+v, want 2", resp.Spans)
+	}
+	if resp.Spans[0].Text != "Hello" || resp.Spans[0].Marks["bold"] == nil {
+		t.Errorf("first span = %+v, want bold \"Hello\"", resp.Spans[0])
+	}
+	if resp.Spans[1].Text != " World" || len(resp.Spans[1].Marks) != 0 {
+		t.Errorf("second span = %+v, want plain \" World\"", resp.Spans[1])
+	}
+}
+
+// TestRichTextBlocks tests block marker endpoints
+func TestRichTextBlocks(t *testing.T) {
+	srv := newTestServer(t)
+
+	doRequest(t, api.TextHandler(srv), "POST", "/api/text", map[string]interface{}{"text": "TitleBody"})
+
+	rr := doRequest(t, api.RichTextSplitBlockHandler(srv), "POST", "/api/richtext/block/split", map[string]interface{}{
+		"path":  "ROOT.content",
+		"index": 5,
+		"type":  "paragraph",
+	})
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("split returned %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = doRequest(t, api.RichTextUpdateBlockHandler(srv), "POST", "/api/richtext/block/update", map[string]interface{}{
+		"index": 5,
+		"type":  "heading",
+		"attrs": map[string]interface{}{"level": 2},
+	})
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("update returned %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = doRequest(t, api.RichTextMarksHandler(srv), "GET", "/api/richtext/marks?format=spans", nil)
+	var resp api.RichTextSpansResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(resp.Spans) != 3 || resp.Spans[1].Block == nil || resp.Spans[1].Block.Type != "heading" {
+		t.Fatalf("spans = %+v, want text, heading block, text", resp.Spans)
+	}
+
+	rr = doRequest(t, api.RichTextJoinBlockHandler(srv), "POST", "/api/richtext/block/join", map[string]interface{}{"index": 5})
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("join returned %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = doRequest(t, api.RichTextSplitBlockHandler(srv), "POST", "/api/richtext/block/split", map[string]interface{}{"type": "paragraph"})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("split without index returned %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+// TestRichTextExport tests exporting rich text as HTML and Markdown
+func TestRichTextExport(t *testing.T) {
+	srv := newTestServer(t)
+
+	doRequest(t, api.TextHandler(srv), "POST", "/api/text", map[string]interface{}{"text": "Hello <World>"})
+	doRequest(t, api.RichTextMarkHandler(srv), "POST", "/api/richtext/mark", map[string]interface{}{
+		"path":  "ROOT.content",
+		"name":  "bold",
+		"value": true,
+		"start": 0,
+		"end":   5,
+	})
+
+	rr := doRequest(t, api.RichTextExportHandler(srv), "GET", "/api/richtext/export", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("export returned %d: %s", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if got, want := rr.Body.String(), "<p><strong>Hello</strong> &lt;World&gt;</p>"; got != want {
+		t.Errorf("html = %q, want %q", got, want)
+	}
+
+	rr = doRequest(t, api.RichTextExportHandler(srv), "GET", "/api/richtext/export?format=markdown", nil)
+	if got, want := rr.Body.String(), "**Hello** \\<World\\>\n"; got != want {
+		t.Errorf("markdown = %q, want %q", got, want)
+	}
+
+	rr = doRequest(t, api.RichTextExportHandler(srv), "GET", "/api/richtext/export?format=pdf", nil)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("format=pdf returned %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+// TestRichTextImport tests importing Markdown and HTML
+func TestRichTextImport(t *testing.T) {
+	srv := newTestServer(t)
+
+	rr := doRequest(t, api.RichTextImportHandler(srv), "POST", "/api/richtext/import", map[string]interface{}{
+		"format":  "markdown",
+		"content": "## Title\n\nSome **bold** text",
+	})
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("import returned %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = doRequest(t, api.RichTextExportHandler(srv), "GET", "/api/richtext/export?format=markdown", nil)
+	if got, want := rr.Body.String(), "## Title\n\nSome **bold** text\n"; got != want {
+		t.Errorf("markdown = %q, want %q", got, want)
+	}
+
+	// Paste HTML at the end of "Title" (marker at 0, so "Title" ends at 6)
+	rr = doRequest(t, api.RichTextImportHandler(srv), "POST", "/api/richtext/import", map[string]interface{}{
+		"format":  "html",
+		"content": "<i>!</i><script>x</script>",
+		"pos":     6,
+	})
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("paste returned %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = doRequest(t, api.RichTextExportHandler(srv), "GET", "/api/richtext/export", nil)
+	if got, want := rr.Body.String(), "<h2>Title<em>!</em></h2><p>Some <strong>bold</strong> text</p>"; got != want {
+		t.Errorf("html = %q, want %q", got, want)
+	}
+
+	rr = doRequest(t, api.RichTextImportHandler(srv), "POST", "/api/richtext/import", map[string]interface{}{
+		"format":  "rtf",
+		"content": "x",
+	})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("format=rtf returned %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestRichTextDelta(t *testing.T) {
+	srv := newTestServer(t)
+
+	rr := doRequest(t, api.RichTextDeltaHandler(srv), "POST", "/api/richtext/delta", map[string]interface{}{
+		"delta": map[string]interface{}{"ops": []map[string]interface{}{
+			{"insert": "Hello"},
+			{"insert": " World", "attributes": map[string]interface{}{"bold": true}},
+		}},
+	})
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("apply returned %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = doRequest(t, api.RichTextDeltaHandler(srv), "GET", "/api/richtext/delta", nil)
+	var snapshot api.RichTextDeltaResponse
+	if err := json.NewDecoder(rr.Body).Decode(&snapshot); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	data, _ := json.Marshal(snapshot.Delta)
+	if want := `{"ops":[{"insert":"Hello"},{"insert":" World","attributes":{"bold":true}}]}`; string(data) != want {
+		t.Errorf("delta = %s, want %s", data, want)
+	}
+	if len(snapshot.Heads) == 0 {
+		t.Fatal("expected heads in the response")
+	}
+
+	// Edits since the snapshot come back as a delta
+	rr = doRequest(t, api.RichTextDeltaHandler(srv), "POST", "/api/richtext/delta", map[string]interface{}{
+		"delta": map[string]interface{}{"ops": []map[string]interface{}{
+			{"retain": 5},
+			{"insert": "!"},
+		}},
+	})
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("apply returned %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = doRequest(t, api.RichTextDeltaHandler(srv), "GET", "/api/richtext/delta?since="+strings.Join(snapshot.Heads, ","), nil)
+	var since api.RichTextDeltaResponse
+	if err := json.NewDecoder(rr.Body).Decode(&since); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	data, _ = json.Marshal(since.Delta)
+	if want := `{"ops":[{"retain":5},{"insert":"!"}]}`; string(data) != want {
+		t.Errorf("delta since = %s, want %s", data, want)
+	}
+
+	// Embeds other than blocks are rejected
+	rr = doRequest(t, api.RichTextDeltaHandler(srv), "POST", "/api/richtext/delta", map[string]interface{}{
+		"delta": map[string]interface{}{"ops": []map[string]interface{}{
+			{"insert": map[string]string{"image": "a.png"}},
+		}},
+	})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("image embed returned %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
@@ -33,12 +33,12 @@ package api
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 
-	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
 	"github.com/joeblew999/automerge-wazero-example/pkg/server"
 )
 
@@ -57,10 +57,6 @@ type SyncResponse struct {
 // SyncHandler handles POST /api/sync - Process sync message and generate response
 // M1 Milestone: Automerge sync protocol
 func SyncHandler(srv *server.Server) http.HandlerFunc {
-	// In-memory sync states per peer
-	// TODO: Move this to server package for persistence
-	peerStates := make(map[string]*automerge.SyncState)
-
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -85,17 +81,15 @@ func SyncHandler(srv *server.Server) http.HandlerFunc {
 			return
 		}
 
-		// Get or create sync state for this peer
-		state, exists := peerStates[payload.PeerID]
-		if !exists {
-			// Initialize sync state with the server's document
-			newState, err := srv.InitSyncState(ctx)
-			if err != nil {
-				http.Error(w, fmt.Sprintf("Failed to init sync state: %v", err), http.StatusInternalServerError)
-				return
-			}
-			state = newState
-			peerStates[payload.PeerID] = state
+		// Get this peer's sync state (restored from storage or created)
+		state, err := srv.SyncPeer(ctx, payload.PeerID)
+		if errors.Is(err, server.ErrInvalidPeerID) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get sync state: %v", err), errorStatus(err))
+			return
 		}
 
 		// If peer sent a sync message, receive it first
@@ -107,7 +101,7 @@ func SyncHandler(srv *server.Server) http.HandlerFunc {
 			}
 
 			if err := srv.ReceiveSyncMessage(ctx, state, messageBytes); err != nil {
-				http.Error(w, fmt.Sprintf("Failed to receive sync message: %v", err), http.StatusInternalServerError)
+				http.Error(w, fmt.Sprintf("Failed to receive sync message: %v", err), errorStatus(err))
 				return
 			}
 
@@ -117,7 +111,7 @@ func SyncHandler(srv *server.Server) http.HandlerFunc {
 		// Generate sync message for this peer
 		responseMessage, err := srv.GenerateSyncMessage(ctx, state)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to generate sync message: %v", err), http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("Failed to generate sync message: %v", err), errorStatus(err))
 			return
 		}
 
@@ -99,6 +99,17 @@ func TestSyncOperations(t *testing.T) {
 		t.Logf("Sync exchange completed, has_more=%v", resp2["has_more"])
 	})
 
+	t.Run("Invalid peer_id", func(t *testing.T) {
+		// Peer states are stored under sync.<peer_id>
+		handler := api.SyncHandler(srv1)
+		rr := doRequest(t, handler, "POST", "/api/sync", map[string]interface{}{
+			"peer_id": "../peer",
+		})
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Sync with peer_id ../peer returned %d, want %d", rr.Code, http.StatusBadRequest)
+		}
+	})
+
 	// TODO: Test actual two-way sync between srv1 and srv2
 	// This requires implementing full sync protocol flow
 	t.Run("Two-way sync (placeholder)", func(t *testing.T) {
@@ -0,0 +1,310 @@
+// ==============================================================================
+// Layer 6: HTTP API - Documents
+// ==============================================================================
+// ARCHITECTURE: This is the HTTP protocol layer (Layer 6/7).
+//
+// RESPONSIBILITIES:
+// - GET/POST /api/docs: list and create documents
+// - GET/PUT/DELETE /api/docs/{id}: look up, create and delete a document
+// - GET /api/docs/_stats: loaded documents, their memory, load/evict counts
+// - /api/docs/{id}/…: the single-document API (/api/text, /api/map, …)
+//   for document {id}
+//
+// DEPENDENCIES:
+// - Layer 5: pkg/server/registry.go (documents by ID)
+// - Layer 5: pkg/server/eviction.go (stats)
+//
+// RELATED FILES:
+// - pkg/httpserver/httpserver.go (the per-document route table)
+//
+// NOTES:
+// - /api/docs/{id}/text is served as /api/text by a ServeMux holding the
+//   same routes as the legacy single-document API, bound to document {id}.
+//   Each document's mux is built once and kept while the document is
+//   loaded, so handler state (e.g. sync peer states) survives between
+//   requests
+// - Each request holds its document (Registry.Acquire) until it returns,
+//   so a document isn't evicted mid-request or while it has SSE clients
+// - "_stats" can't be a document ID (IDs start with a letter or digit)
+// ==============================================================================
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/server"
+)
+
+// DocumentPayload represents the JSON payload for POST /api/docs
+type DocumentPayload struct {
+	ID string `json:"id"`
+}
+
+// DocumentResponse describes one document
+type DocumentResponse struct {
+	ID string `json:"id"`
+}
+
+// DocumentsResponse lists the documents
+type DocumentsResponse struct {
+	Documents []string `json:"documents"`
+}
+
+// DocumentStatsResponse describes one loaded document
+type DocumentStatsResponse struct {
+	ID          string    `json:"id"`
+	MemoryBytes int64     `json:"memory_bytes"`
+	Pinned      bool      `json:"pinned"`
+	InUse       int       `json:"in_use"`
+	LastUsed    time.Time `json:"last_used"`
+	QueueDepth  int       `json:"queue_depth"`
+	Rejected    uint64    `json:"rejected"`
+
+	// SSE subscribers, and how they keep up (see server.EventStats)
+	Subscribers   int    `json:"subscribers"`
+	EventsDropped uint64 `json:"events_dropped"`
+	Resyncs       uint64 `json:"resyncs"`
+	Disconnects   uint64 `json:"disconnects"`
+	EventLagMs    int64  `json:"event_lag_ms"`
+}
+
+// RegistryStatsResponse is the JSON response for GET /api/docs/_stats
+type RegistryStatsResponse struct {
+	Loaded        int                     `json:"loaded"`
+	Loads         uint64                  `json:"loads"`
+	Evictions     uint64                  `json:"evictions"`
+	MemoryBytes   int64                   `json:"memory_bytes"`
+	MemoryBudget  int64                   `json:"memory_budget,omitempty"`
+	IdleTTLMillis int64                   `json:"idle_ttl_ms,omitempty"`
+	Documents     []DocumentStatsResponse `json:"documents"`
+}
+
+// docRoutes is the route table of one loaded document
+type docRoutes struct {
+	srv *server.Server
+	mux *http.ServeMux
+}
+
+// DocumentRouter serves /api/docs and everything below it
+type DocumentRouter struct {
+	reg      *server.Registry
+	register func(mux *http.ServeMux, srv *server.Server)
+
+	mu     sync.Mutex
+	routes map[string]*docRoutes // By document ID
+}
+
+// NewDocumentRouter creates a router for the documents in reg. register
+// adds the single-document routes (/api/text, …) for srv to mux. Routes of
+// documents the registry unloads are dropped.
+//
+// Example:
+//
+//	router := api.NewDocumentRouter(reg, func(mux *http.ServeMux, srv *server.Server) {
+//	    mux.HandleFunc("/api/text", api.TextHandler(srv))
+//	})
+//	mux.Handle("/api/docs", router)
+//	mux.Handle("/api/docs/", router)
+func NewDocumentRouter(reg *server.Registry, register func(mux *http.ServeMux, srv *server.Server)) *DocumentRouter {
+	d := &DocumentRouter{
+		reg:      reg,
+		register: register,
+		routes:   make(map[string]*docRoutes),
+	}
+	reg.OnUnload(d.forget)
+	return d
+}
+
+// forget drops the routes of an unloaded document
+func (d *DocumentRouter) forget(id string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.routes, id)
+}
+
+// ServeHTTP dispatches on the path below /api/docs
+func (d *DocumentRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/docs")
+	if rest == "" || rest == "/" {
+		d.serveDocuments(w, r)
+		return
+	}
+
+	id, route, _ := strings.Cut(strings.TrimPrefix(rest, "/"), "/")
+	if id == "_stats" && route == "" {
+		d.serveStats(w, r)
+		return
+	}
+	if route == "" {
+		d.serveDocument(w, r, id)
+		return
+	}
+	d.serveRoute(w, r, id, route)
+}
+
+// serveDocuments handles GET and POST /api/docs
+func (d *DocumentRouter) serveDocuments(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	switch r.Method {
+	case http.MethodGet:
+		ids, err := d.reg.List(ctx)
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(DocumentsResponse{Documents: ids})
+
+	case http.MethodPost:
+		var payload DocumentPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if _, err := d.reg.Create(ctx, payload.ID); err != nil {
+			writeDocumentError(w, err)
+			return
+		}
+		writeDocument(w, http.StatusCreated, payload.ID)
+		log.Printf("Document CREATE: id=%s", payload.ID)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// serveDocument handles GET, PUT and DELETE /api/docs/{id}
+func (d *DocumentRouter) serveDocument(w http.ResponseWriter, r *http.Request, id string) {
+	ctx := r.Context()
+
+	switch r.Method {
+	case http.MethodGet:
+		if _, err := d.reg.Get(ctx, id); err != nil {
+			writeDocumentError(w, err)
+			return
+		}
+		writeDocument(w, http.StatusOK, id)
+
+	case http.MethodPut:
+		// Idempotent create: 201 if new, 200 if it already existed
+		_, err := d.reg.Create(ctx, id)
+		if errors.Is(err, server.ErrDocumentExists) {
+			writeDocument(w, http.StatusOK, id)
+			return
+		}
+		if err != nil {
+			writeDocumentError(w, err)
+			return
+		}
+		writeDocument(w, http.StatusCreated, id)
+		log.Printf("Document CREATE: id=%s", id)
+
+	case http.MethodDelete:
+		if err := d.reg.Delete(ctx, id); err != nil {
+			writeDocumentError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		log.Printf("Document DELETE: id=%s", id)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// serveRoute serves /api/docs/{id}/{route} as /api/{route} of document id
+func (d *DocumentRouter) serveRoute(w http.ResponseWriter, r *http.Request, id, route string) {
+	srv, release, err := d.reg.Acquire(r.Context(), id)
+	if err != nil {
+		writeDocumentError(w, err)
+		return
+	}
+	defer release()
+
+	d.mu.Lock()
+	routes := d.routes[id]
+	if routes == nil || routes.srv != srv {
+		// First request, or the document was reloaded
+		routes = &docRoutes{srv: srv, mux: http.NewServeMux()}
+		d.register(routes.mux, srv)
+		d.routes[id] = routes
+	}
+	d.mu.Unlock()
+
+	inner := r.Clone(r.Context())
+	inner.URL.Path = "/api/" + route
+	inner.URL.RawPath = ""
+	routes.mux.ServeHTTP(w, inner)
+}
+
+// serveStats handles GET /api/docs/_stats
+func (d *DocumentRouter) serveStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	stats := d.reg.Stats()
+	resp := RegistryStatsResponse{
+		Loaded:        stats.Loaded,
+		Loads:         stats.Loads,
+		Evictions:     stats.Evictions,
+		MemoryBytes:   stats.MemoryBytes,
+		MemoryBudget:  stats.MemoryBudget,
+		IdleTTLMillis: stats.IdleTTL.Milliseconds(),
+		Documents:     make([]DocumentStatsResponse, 0, len(stats.Documents)),
+	}
+	for _, doc := range stats.Documents {
+		resp.Documents = append(resp.Documents, DocumentStatsResponse{
+			ID:          doc.ID,
+			MemoryBytes: doc.MemoryBytes,
+			Pinned:      doc.Pinned,
+			InUse:       doc.InUse,
+			LastUsed:    doc.LastUsed.UTC(),
+			QueueDepth:  doc.Queue.Depth,
+			Rejected:    doc.Queue.Rejected,
+
+			Subscribers:   doc.Events.Subscribers,
+			EventsDropped: doc.Events.Dropped,
+			Resyncs:       doc.Events.Resyncs,
+			Disconnects:   doc.Events.Disconnects,
+			EventLagMs:    doc.Events.MaxLag.Milliseconds(),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// writeDocument writes a DocumentResponse
+func writeDocument(w http.ResponseWriter, status int, id string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(DocumentResponse{ID: id})
+}
+
+// writeDocumentError maps registry errors to status codes
+func writeDocumentError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, server.ErrInvalidDocID):
+		status = http.StatusBadRequest
+	case errors.Is(err, server.ErrDocumentNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, server.ErrDocumentExists), errors.Is(err, server.ErrDocumentPinned),
+		errors.Is(err, server.ErrDocumentInUse):
+		status = http.StatusConflict
+	case errors.Is(err, server.ErrRegistryClosed):
+		status = http.StatusServiceUnavailable
+	}
+	http.Error(w, fmt.Sprint(err), status)
+}
@@ -0,0 +1,141 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/api"
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+	"github.com/joeblew999/automerge-wazero-example/pkg/server"
+)
+
+// newTestRouter creates a document router over an in-memory registry, with
+// the text routes registered per document
+func newTestRouter(t *testing.T) (http.HandlerFunc, *server.Registry) {
+	t.Helper()
+	reg, err := server.NewRegistry(server.Config{
+		Storage:  server.NewMemoryStorage(),
+		UserID:   "test-user",
+		WASMPath: automerge.TestWASMPath,
+	}, server.EvictionConfig{})
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+	t.Cleanup(func() { reg.Close(context.Background()) })
+
+	router := api.NewDocumentRouter(reg, func(mux *http.ServeMux, srv *server.Server) {
+		mux.HandleFunc("/api/text", api.TextHandler(srv))
+	})
+	return router.ServeHTTP, reg
+}
+
+func TestDocumentRouter_Errors(t *testing.T) {
+	handler, _ := newTestRouter(t)
+
+	tests := []struct {
+		method, url string
+		body        interface{}
+		want        int
+	}{
+		{"GET", "/api/docs/missing", nil, http.StatusNotFound},
+		{"GET", "/api/docs/missing/text", nil, http.StatusNotFound},
+		{"DELETE", "/api/docs/missing", nil, http.StatusNotFound},
+		{"POST", "/api/docs", map[string]string{"id": "a b"}, http.StatusBadRequest},
+		{"PUT", "/api/docs/.hidden", nil, http.StatusBadRequest},
+		{"PATCH", "/api/docs", nil, http.StatusMethodNotAllowed},
+		{"POST", "/api/docs/_stats", nil, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		rr := doRequest(t, handler, tt.method, tt.url, tt.body)
+		if rr.Code != tt.want {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.url, rr.Code, tt.want)
+		}
+	}
+
+	rr := doRequest(t, handler, "GET", "/api/docs", nil)
+	var list api.DocumentsResponse
+	json.Unmarshal(rr.Body.Bytes(), &list)
+	if rr.Code != http.StatusOK || list.Documents == nil || len(list.Documents) != 0 {
+		t.Errorf("GET /api/docs = %d %s, want an empty list", rr.Code, rr.Body.String())
+	}
+
+	rr = doRequest(t, handler, "GET", "/api/docs/_stats", nil)
+	var stats api.RegistryStatsResponse
+	json.Unmarshal(rr.Body.Bytes(), &stats)
+	if rr.Code != http.StatusOK || stats.Loaded != 0 || stats.Documents == nil {
+		t.Errorf("GET /api/docs/_stats = %d %s, want nothing loaded", rr.Code, rr.Body.String())
+	}
+}
+
+func TestDocumentRouter(t *testing.T) {
+	handler, reg := newTestRouter(t)
+
+	rr := doRequest(t, handler, "POST", "/api/docs", map[string]string{"id": "notes"})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("POST /api/docs = %d %s", rr.Code, rr.Body.String())
+	}
+
+	t.Run("Create", func(t *testing.T) {
+		if rr := doRequest(t, handler, "POST", "/api/docs", map[string]string{"id": "notes"}); rr.Code != http.StatusConflict {
+			t.Errorf("POST /api/docs again = %d, want 409", rr.Code)
+		}
+
+		// PUT is idempotent
+		if rr := doRequest(t, handler, "PUT", "/api/docs/todo", nil); rr.Code != http.StatusCreated {
+			t.Errorf("PUT /api/docs/todo = %d, want 201", rr.Code)
+		}
+		if rr := doRequest(t, handler, "PUT", "/api/docs/todo", nil); rr.Code != http.StatusOK {
+			t.Errorf("PUT /api/docs/todo again = %d, want 200", rr.Code)
+		}
+	})
+
+	t.Run("Per-document routes", func(t *testing.T) {
+		doRequest(t, handler, "POST", "/api/docs/notes/text", map[string]string{"text": "notes"})
+		doRequest(t, handler, "POST", "/api/docs/todo/text", map[string]string{"text": "todo"})
+
+		for id, want := range map[string]string{"notes": "notes", "todo": "todo"} {
+			rr := doRequest(t, handler, "GET", "/api/docs/"+id+"/text", nil)
+			if rr.Code != http.StatusOK || rr.Body.String() != want {
+				t.Errorf("GET /api/docs/%s/text = %d %q, want %q", id, rr.Code, rr.Body.String(), want)
+			}
+		}
+
+		if rr := doRequest(t, handler, "GET", "/api/docs/notes/nope", nil); rr.Code != http.StatusNotFound {
+			t.Errorf("GET /api/docs/notes/nope = %d, want 404", rr.Code)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		rr := doRequest(t, handler, "GET", "/api/docs", nil)
+		var list api.DocumentsResponse
+		json.Unmarshal(rr.Body.Bytes(), &list)
+		if !reflect.DeepEqual(list.Documents, []string{"notes", "todo"}) {
+			t.Errorf("GET /api/docs = %v, want [notes todo]", list.Documents)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		if rr := doRequest(t, handler, "DELETE", "/api/docs/notes", nil); rr.Code != http.StatusNoContent {
+			t.Fatalf("DELETE /api/docs/notes = %d %s", rr.Code, rr.Body.String())
+		}
+		if rr := doRequest(t, handler, "GET", "/api/docs/notes/text", nil); rr.Code != http.StatusNotFound {
+			t.Errorf("GET after DELETE = %d, want 404", rr.Code)
+		}
+
+		// A re-created document starts empty, with fresh routes
+		doRequest(t, handler, "PUT", "/api/docs/notes", nil)
+		if rr := doRequest(t, handler, "GET", "/api/docs/notes/text", nil); rr.Body.String() != "" {
+			t.Errorf("text of the re-created document = %q, want empty", rr.Body.String())
+		}
+	})
+
+	t.Run("Pinned", func(t *testing.T) {
+		reg.Pin(context.Background(), server.DefaultDocID)
+		if rr := doRequest(t, handler, "DELETE", "/api/docs/default", nil); rr.Code != http.StatusConflict {
+			t.Errorf("DELETE of the pinned document = %d, want 409", rr.Code)
+		}
+	})
+}
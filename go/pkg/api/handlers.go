@@ -26,12 +26,18 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
 	"github.com/joeblew999/automerge-wazero-example/pkg/server"
 )
 
@@ -47,12 +53,13 @@ func TextHandler(srv *server.Server) http.HandlerFunc {
 
 		switch r.Method {
 		case http.MethodGet:
-			text, err := srv.GetText(ctx)
+			text, info, err := srv.ReadText(ctx)
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				http.Error(w, err.Error(), errorStatus(err))
 				return
 			}
 
+			setReadHeaders(w, info)
 			w.Header().Set("Content-Type", "text/plain")
 			w.Write([]byte(text))
 
@@ -70,13 +77,10 @@ func TextHandler(srv *server.Server) http.HandlerFunc {
 			}
 
 			if err := srv.SetText(ctx, payload.Text); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				http.Error(w, err.Error(), errorStatus(err))
 				return
 			}
 
-			// Broadcast update to SSE clients
-			srv.Broadcast(payload.Text)
-
 			w.WriteHeader(http.StatusNoContent)
 
 		default:
@@ -85,9 +89,181 @@ func TextHandler(srv *server.Server) http.HandlerFunc {
 	}
 }
 
+// EventResponse is a change event as SSE clients receive it
+type EventResponse struct {
+	Type  string    `json:"type"`            // text, map, list, counter, richtext, comment, sync or merge
+	Op    string    `json:"op"`              // set, put, delete, push, insert, increment, mark, …
+	Path  string    `json:"path"`            // What changed, e.g. "/config/theme" or "/items[2]"
+	Paths []string  `json:"paths,omitempty"` // Sync and merge: every path their changes touched
+	Actor string    `json:"actor,omitempty"` // Empty for sync and merge
+	Heads []string  `json:"heads"`           // Heads after the change
+	Time  time.Time `json:"time"`
+	Text  *string   `json:"text,omitempty"` // ROOT.content, if the change may have touched it
+}
+
+// pathStrings renders paths as events report them (nil for none)
+func pathStrings(paths []automerge.Path) []string {
+	if len(paths) == 0 {
+		return nil
+	}
+	out := make([]string, len(paths))
+	for i, p := range paths {
+		out[i] = p.String()
+	}
+	return out
+}
+
+// eventResponse converts a server event for the wire
+func eventResponse(ev server.Event) EventResponse {
+	return EventResponse{
+		Type:  string(ev.Type),
+		Op:    ev.Op,
+		Path:  ev.Path.String(),
+		Paths: pathStrings(ev.Paths),
+		Actor: ev.Actor,
+		Heads: headStrings(ev.Heads),
+		Time:  ev.Time,
+		Text:  ev.Text,
+	}
+}
+
+// eventTypes are the event types a stream can be filtered by
+var eventTypes = []server.EventType{
+	server.EventText, server.EventMap, server.EventList, server.EventCounter,
+	server.EventRichText, server.EventComment, server.EventSync, server.EventMerge,
+}
+
+// parseEventTypes parses comma-separated event types ("map,text")
+func parseEventTypes(s string) ([]server.EventType, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var types []server.EventType
+	for _, name := range strings.Split(s, ",") {
+		t := server.EventType(strings.TrimSpace(name))
+		if !slices.Contains(eventTypes, t) {
+			return nil, fmt.Errorf("unknown event type %q", name)
+		}
+		types = append(types, t)
+	}
+	return types, nil
+}
+
+// parseEventFilters reads the stream's filters from the query:
+//   - path=P (repeatable): changes at, below or above P, of the types in
+//     types=T1,T2 (all types without it)
+//   - types=T1,T2 alone: those types anywhere
+//   - filter=P or filter=P:T1,T2 (repeatable): a filter with its own types
+//
+// No filters means every event.
+func parseEventFilters(query url.Values) ([]server.EventFilter, error) {
+	types, err := parseEventTypes(query.Get("types"))
+	if err != nil {
+		return nil, err
+	}
+
+	var filters []server.EventFilter
+	for _, p := range query["path"] {
+		path, err := parseEventPath(p)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, server.EventFilter{Path: path, Types: types})
+	}
+	if len(filters) == 0 && len(types) > 0 {
+		filters = append(filters, server.EventFilter{Path: automerge.Root(), Types: types})
+	}
+
+	for _, f := range query["filter"] {
+		pathStr, typesStr, _ := strings.Cut(f, ":")
+		path, err := parseEventPath(pathStr)
+		if err != nil {
+			return nil, err
+		}
+		types, err := parseEventTypes(typesStr)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, server.EventFilter{Path: path, Types: types})
+	}
+	return filters, nil
+}
+
+// wantsText reports whether a stream with these filters shows the text
+func wantsText(filters []server.EventFilter) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	text := server.Event{Type: server.EventText, Path: automerge.Root().Get("content")}
+	for _, f := range filters {
+		if f.Match(text) {
+			return true
+		}
+	}
+	return false
+}
+
 // StreamHandler handles GET /api/stream (SSE) requests
+//
+// The stream starts with a "snapshot" event holding the text, then sends
+// an "update" event (an EventResponse) for every change to the document:
+// local edits of any kind, sync messages and merges.
+//
+// Query params filter the events before they are sent (see
+// parseEventFilters), e.g. ?path=/metrics/*&types=map,counter. A filtered
+// stream only starts with the text snapshot if its filters cover the text.
+//
+// Every event has an SSE id. A client reconnecting with Last-Event-ID gets
+// the events it missed instead of the snapshot, or, if they are no longer
+// known, the snapshot again (the whole document as JSON for a filtered
+// stream that doesn't cover the text). A client that falls behind gets a
+// "resync" event holding the same snapshot in place of the updates it
+// missed, and if it still can't keep up its stream ends, for it to
+// reconnect and catch up that way.
+//
+// The events are only kept in memory (server.Resume): a restart, or the
+// document being evicted or deleted, forgets them, and a client
+// reconnecting after that gets the snapshot, not an error.
+//
+// With ?format=delta (and optionally path=...) the stream carries Quill
+// deltas instead: a "snapshot" event with the text as a delta, then a
+// "delta" event with the edits after each change to that text. A delta
+// stream always restarts from a snapshot.
 func StreamHandler(srv *server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			deltaPath automerge.Path
+			filters   []server.EventFilter
+		)
+		query := r.URL.Query()
+		format := query.Get("format")
+		switch format {
+		case "", "text":
+			var err error
+			if filters, err = parseEventFilters(query); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid filter: %v", err), http.StatusBadRequest)
+				return
+			}
+		case "delta":
+			pathStr := query.Get("path")
+			if pathStr == "" {
+				pathStr = "ROOT.content"
+			}
+			var err error
+			if deltaPath, err = automerge.ParseObjPath(pathStr); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid path: %v", err), http.StatusBadRequest)
+				return
+			}
+			// Only changes that may touch the text
+			filters = []server.EventFilter{{
+				Path:  deltaPath,
+				Types: []server.EventType{server.EventText, server.EventRichText, server.EventSync, server.EventMerge},
+			}}
+		default:
+			http.Error(w, "Invalid format (expected text or delta)", http.StatusBadRequest)
+			return
+		}
+
 		// Set SSE headers
 		w.Header().Set("Content-Type", "text/event-stream")
 		w.Header().Set("Cache-Control", "no-cache")
@@ -99,40 +275,137 @@ func StreamHandler(srv *server.Server) http.HandlerFunc {
 			return
 		}
 
-		// Create client channel
-		clientChan := make(chan string, 10)
+		// Subscribe before reading the snapshot, so no change falls between
+		var (
+			sub     *server.Subscription
+			missed  []server.Event
+			resumed bool
+		)
+		lastID := r.Header.Get("Last-Event-ID")
+		if lastID != "" && format != "delta" {
+			sub, missed, resumed = srv.Resume(0, lastID, filters...)
+		} else {
+			sub = srv.Subscribe(0, filters...)
+		}
+		defer sub.Close()
 
-		srv.AddClient(clientChan)
-		defer func() {
-			srv.RemoveClient(clientChan)
-			close(clientChan)
-		}()
+		if format == "delta" {
+			streamDeltas(w, r, flusher, srv, deltaPath, sub)
+			return
+		}
 
-		// Send initial snapshot
-		text, err := srv.GetText(r.Context())
-		if err == nil {
-			data, _ := json.Marshal(map[string]string{"text": text})
-			fmt.Fprintf(w, "event: snapshot\ndata: %s\n\n", data)
-			flusher.Flush()
+		ctx := r.Context()
+		switch {
+		case resumed:
+			for _, ev := range missed {
+				writeUpdate(w, ev)
+			}
+			fmt.Fprint(w, ": resumed\n\n")
+		case wantsText(filters) || lastID != "":
+			writeSnapshot(ctx, w, srv, sub.LastID, "snapshot", filters)
+		default:
+			// Let the client know the stream is open
+			fmt.Fprint(w, ": subscribed\n\n")
 		}
+		flusher.Flush()
 
 		// Listen for updates
 		for {
 			select {
-			case text, ok := <-clientChan:
+			case ev, ok := <-sub.C:
 				if !ok {
-					return
+					if sub.Overflowed() {
+						log.Printf("[%s] SSE client fell behind; ending its stream for it to resume", srv.UserID())
+					}
+					return // Document closed, or the client fell behind
+				}
+				if ev.Type == server.EventResync {
+					writeSnapshot(ctx, w, srv, ev.ID, "resync", filters)
+				} else {
+					writeUpdate(w, ev)
 				}
-				data, _ := json.Marshal(map[string]string{"text": text})
-				fmt.Fprintf(w, "event: update\ndata: %s\n\n", data)
 				flusher.Flush()
-			case <-r.Context().Done():
+			case <-ctx.Done():
 				return
 			}
 		}
 	}
 }
 
+// writeSSE writes one SSE event, with an id if id is set
+func writeSSE(w io.Writer, id, name string, data []byte) {
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+}
+
+// writeSnapshot writes the text, or for a filtered stream that doesn't
+// cover it the whole document as JSON, as an event called name
+func writeSnapshot(ctx context.Context, w io.Writer, srv *server.Server, id, name string, filters []server.EventFilter) {
+	var data []byte
+	if wantsText(filters) {
+		text, err := srv.GetText(ctx)
+		if err != nil {
+			return
+		}
+		data, _ = json.Marshal(map[string]string{"text": text})
+	} else {
+		// Not ReadJSON: a replica may lag behind the event id the
+		// snapshot is labelled with
+		value, err := srv.GetJSON(ctx, automerge.Root())
+		if err != nil {
+			return
+		}
+		data, _ = json.Marshal(map[string]interface{}{"json": value})
+	}
+	writeSSE(w, id, name, data)
+}
+
+// writeUpdate writes ev as an "update" event
+func writeUpdate(w io.Writer, ev server.Event) {
+	data, _ := json.Marshal(eventResponse(ev))
+	writeSSE(w, ev.ID, "update", data)
+}
+
+// streamDeltas sends the text at path as a delta, then the edits made
+// since the last event each time an event may have changed that text (the
+// subscription only carries those, and a resync just means more of them)
+func streamDeltas(w http.ResponseWriter, r *http.Request, flusher http.Flusher, srv *server.Server, path automerge.Path, sub *server.Subscription) {
+	ctx := r.Context()
+
+	delta, heads, err := srv.RichTextDelta(ctx, path)
+	if err != nil {
+		return
+	}
+	data, _ := json.Marshal(RichTextDeltaResponse{Delta: delta, Heads: headStrings(heads)})
+	writeSSE(w, sub.LastID, "snapshot", data)
+	flusher.Flush()
+
+	for {
+		select {
+		case ev, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			delta, next, err := srv.RichTextDeltaSince(ctx, path, heads)
+			if err != nil {
+				log.Printf("Warning: failed to compute delta: %v", err)
+				continue
+			}
+			heads = next
+			if len(delta.Ops) == 0 {
+				continue
+			}
+			data, _ := json.Marshal(RichTextDeltaResponse{Delta: delta, Heads: headStrings(heads)})
+			writeSSE(w, ev.ID, "delta", data)
+			flusher.Flush()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
 // DocHandler handles GET /api/doc (download doc.am snapshot)
 func DocHandler(srv *server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -142,12 +415,13 @@ func DocHandler(srv *server.Server) http.HandlerFunc {
 		}
 
 		ctx := r.Context()
-		data, err := srv.GetSnapshot(ctx)
+		data, info, err := srv.ReadSnapshot(ctx)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to save document: %v", err), http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("Failed to save document: %v", err), errorStatus(err))
 			return
 		}
 
+		setReadHeaders(w, info)
 		w.Header().Set("Content-Type", "application/octet-stream")
 		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-doc.am\"", srv.UserID()))
 		w.Write(data)
@@ -181,15 +455,12 @@ func MergeHandler(srv *server.Server) http.HandlerFunc {
 
 		// Merge the documents
 		if err := srv.Merge(ctx, otherDoc); err != nil {
-			http.Error(w, fmt.Sprintf("Merge failed: %v", err), http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("Merge failed: %v", err), errorStatus(err))
 			return
 		}
 
-		// After merge, get the new text and broadcast
-		text, err := srv.GetText(ctx)
-		if err == nil {
-			srv.Broadcast(text)
-		}
+		// SSE clients hear about the merge from the server's event
+		text, _ := srv.GetText(ctx)
 
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintf(w, "Merged successfully! New text: %s", text)
@@ -0,0 +1,276 @@
+package api_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/api"
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+	"github.com/joeblew999/automerge-wazero-example/pkg/server"
+)
+
+// sseEvent is one event read from an SSE stream
+type sseEvent struct {
+	id   string
+	name string
+	data string
+}
+
+// openStream connects to an SSE endpoint and returns its events
+func openStream(t *testing.T, url string) <-chan sseEvent {
+	t.Helper()
+	return resumeStream(t, url, "")
+}
+
+// resumeStream connects to an SSE endpoint with a Last-Event-ID (if set)
+// and returns its events
+func resumeStream(t *testing.T, url, lastID string) <-chan sseEvent {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s error = %v", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s returned %d", url, resp.StatusCode)
+	}
+
+	events := make(chan sseEvent, 16)
+	go func() {
+		defer resp.Body.Close()
+		defer close(events)
+		var ev sseEvent
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				ev.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				ev.name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				ev.data = strings.TrimPrefix(line, "data: ")
+			case line == "":
+				events <- ev
+				ev = sseEvent{}
+			}
+		}
+	}()
+	return events
+}
+
+// nextSSE waits for the stream's next event
+func nextSSE(t *testing.T, events <-chan sseEvent) sseEvent {
+	t.Helper()
+	select {
+	case ev, ok := <-events:
+		if !ok {
+			t.Fatal("stream ended")
+		}
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event on the stream")
+	}
+	return sseEvent{}
+}
+
+func TestStreamHandler_Events(t *testing.T) {
+	srv := newTestServer(t)
+	ts := httptest.NewServer(api.StreamHandler(srv))
+	defer ts.Close()
+
+	events := openStream(t, ts.URL)
+	if ev := nextSSE(t, events); ev.name != "snapshot" {
+		t.Fatalf("first event = %q, want snapshot", ev.name)
+	}
+
+	// Every kind of change is streamed, not just text
+	ctx := context.Background()
+	if err := srv.PutMapValue(ctx, automerge.Root(), "theme", "dark"); err != nil {
+		t.Fatalf("PutMapValue() error = %v", err)
+	}
+	ev := nextSSE(t, events)
+	var update api.EventResponse
+	if err := json.Unmarshal([]byte(ev.data), &update); err != nil {
+		t.Fatalf("invalid update %q: %v", ev.data, err)
+	}
+	if ev.name != "update" || update.Type != "map" || update.Op != "put" || update.Path != "/theme" {
+		t.Errorf("event = %s %+v, want a map put of /theme", ev.name, update)
+	}
+	if update.Actor == "" || len(update.Heads) == 0 || update.Text != nil {
+		t.Errorf("update = %+v, want an actor, heads and no text", update)
+	}
+
+	// Text changes carry the new text
+	if err := srv.SetText(ctx, "streamed"); err != nil {
+		t.Fatalf("SetText() error = %v", err)
+	}
+	json.Unmarshal([]byte(nextSSE(t, events).data), &update)
+	if update.Type != "text" || update.Text == nil || *update.Text != "streamed" {
+		t.Errorf("update = %+v, want a text change carrying %q", update, "streamed")
+	}
+}
+
+func TestStreamHandler_EndsOnClose(t *testing.T) {
+	srv := newTestServer(t)
+	ts := httptest.NewServer(api.StreamHandler(srv))
+	defer ts.Close()
+
+	events := openStream(t, ts.URL)
+	nextSSE(t, events) // snapshot
+	srv.Close(context.Background())
+
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Error("stream sent an event after the document closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("stream still open after the document closed")
+	}
+}
+
+func TestStreamHandler_Filters(t *testing.T) {
+	srv := newTestServer(t)
+	ts := httptest.NewServer(api.StreamHandler(srv))
+	defer ts.Close()
+
+	ctx := context.Background()
+	if err := srv.PutMapValue(ctx, automerge.Root(), "status", "ok"); err != nil {
+		t.Fatalf("PutMapValue() error = %v", err)
+	}
+
+	// Only map changes to /status: no text snapshot, no text or theme updates
+	events := openStream(t, ts.URL+"?path=/status&types=map")
+	srv.SetText(ctx, "ignored")
+	srv.PutMapValue(ctx, automerge.Root(), "theme", "dark")
+	srv.PutMapValue(ctx, automerge.Root(), "status", "degraded")
+
+	ev := nextSSE(t, events)
+	if ev.name == "" {
+		ev = nextSSE(t, events) // The ": subscribed" comment
+	}
+	var update api.EventResponse
+	if err := json.Unmarshal([]byte(ev.data), &update); err != nil {
+		t.Fatalf("invalid update %q: %v", ev.data, err)
+	}
+	if ev.name != "update" || update.Type != "map" || update.Path != "/status" {
+		t.Errorf("first event = %s %+v, want the put of /status", ev.name, update)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"unknown type", "?types=map,bogus", http.StatusBadRequest},
+		{"invalid path", "?path=metrics", http.StatusBadRequest},
+		{"invalid filter", "?filter=/items[x]:list", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(ts.URL + tt.query)
+			if err != nil {
+				t.Fatalf("GET error = %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamHandler_Resume(t *testing.T) {
+	srv := newTestServer(t)
+	ts := httptest.NewServer(api.StreamHandler(srv))
+	defer ts.Close()
+
+	ctx := context.Background()
+	events := openStream(t, ts.URL)
+	nextSSE(t, events) // snapshot
+	for _, theme := range []string{"dark", "light"} {
+		if err := srv.PutMapValue(ctx, automerge.Root(), "theme", theme); err != nil {
+			t.Fatalf("PutMapValue() error = %v", err)
+		}
+	}
+	first, second := nextSSE(t, events), nextSSE(t, events)
+	if first.id == "" || second.id == "" || first.id == second.id {
+		t.Fatalf("event ids = %q, %q; want distinct ids", first.id, second.id)
+	}
+
+	// Reconnecting after the first update replays the second, with no
+	// snapshot
+	resumed := resumeStream(t, ts.URL, first.id)
+	if ev := nextSSE(t, resumed); ev.name != "update" || ev.id != second.id || ev.data != second.data {
+		t.Errorf("first resumed event = %+v, want the missed %+v", ev, second)
+	}
+
+	// An unknown ID starts over from a snapshot
+	restarted := resumeStream(t, ts.URL, "unknown-1")
+	if ev := nextSSE(t, restarted); ev.name != "snapshot" || ev.id != second.id {
+		t.Errorf("first event = %+v, want a snapshot with id %q", ev, second.id)
+	}
+
+	// So does a filtered stream that doesn't cover the text, from the JSON
+	restarted = resumeStream(t, ts.URL+"?path=/theme", "unknown-1")
+	ev := nextSSE(t, restarted)
+	var snapshot struct {
+		JSON map[string]interface{} `json:"json"`
+	}
+	json.Unmarshal([]byte(ev.data), &snapshot)
+	if ev.name != "snapshot" || snapshot.JSON["theme"] != "light" {
+		t.Errorf("first event = %+v, want a JSON snapshot", ev)
+	}
+}
+
+func TestStreamHandler_SnapshotFromPrimary(t *testing.T) {
+	ctx := context.Background()
+	srv := server.New(server.Config{
+		StorageDir:    t.TempDir(),
+		UserID:        "test-user",
+		WASMPath:      automerge.TestWASMPath,
+		Replicas:      1,
+		ReplicaMaxLag: time.Hour,
+	})
+	if err := srv.Initialize(ctx); err != nil {
+		t.Fatalf("Failed to initialize server: %v", err)
+	}
+	defer srv.Close(ctx)
+	ts := httptest.NewServer(api.StreamHandler(srv))
+	defer ts.Close()
+
+	// Fork the replica, then change the document behind it
+	if err := srv.PutMapValue(ctx, automerge.Root(), "theme", "dark"); err != nil {
+		t.Fatalf("PutMapValue() error = %v", err)
+	}
+	if _, _, err := srv.ReadJSON(ctx, automerge.Root()); err != nil {
+		t.Fatalf("ReadJSON() error = %v", err)
+	}
+	if err := srv.PutMapValue(ctx, automerge.Root(), "theme", "light"); err != nil {
+		t.Fatalf("PutMapValue() error = %v", err)
+	}
+
+	// The snapshot is labelled with the last event, so it must include it
+	events := resumeStream(t, ts.URL+"?path=/theme", "unknown-1")
+	ev := nextSSE(t, events)
+	var snapshot struct {
+		JSON map[string]interface{} `json:"json"`
+	}
+	json.Unmarshal([]byte(ev.data), &snapshot)
+	if ev.name != "snapshot" || snapshot.JSON["theme"] != "light" {
+		t.Errorf("first event = %+v, want a JSON snapshot with the latest theme", ev)
+	}
+}
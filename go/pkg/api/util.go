@@ -1,6 +1,37 @@
 package api
 
-import "github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+	"github.com/joeblew999/automerge-wazero-example/pkg/server"
+)
+
+// errorStatus returns the status for a failed server call: 503 if the
+// document's queue is full or the document was closed (e.g. evicted or
+// deleted mid-request), so clients retry, and 500 otherwise
+func errorStatus(err error) int {
+	if errors.Is(err, server.ErrQueueFull) || errors.Is(err, server.ErrServerClosed) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// setReadHeaders reports which state of the document a read saw: its heads
+// (comma-separated, as ?since= takes them) and whether a read replica or
+// the primary served it
+func setReadHeaders(w http.ResponseWriter, info server.ReadInfo) {
+	source := "primary"
+	if info.Replica {
+		source = "replica"
+	}
+	w.Header().Set("X-Automerge-Heads", strings.Join(headStrings(info.Heads), ","))
+	w.Header().Set("X-Automerge-Source", source)
+}
 
 // parsePathString converts path string like "ROOT" to automerge.Path
 // For simplicity, just support "ROOT" for now
@@ -8,3 +39,58 @@ import "github.com/joeblew999/automerge-wazero-example/pkg/automerge"
 func parsePathString(pathStr string) automerge.Path {
 	return automerge.Root()
 }
+
+// parseEventPath parses a path in the form change events report
+// ("/metrics/cpu", "/items[2]", "/" for the root), or a dotted path
+// ("ROOT.metrics.cpu"). A "*" segment matches any one key or index.
+func parseEventPath(pathStr string) (automerge.Path, error) {
+	if strings.HasPrefix(pathStr, "ROOT") {
+		return automerge.ParseObjPath(pathStr)
+	}
+	if !strings.HasPrefix(pathStr, "/") {
+		return automerge.Path{}, fmt.Errorf("path must start with / or ROOT: %q", pathStr)
+	}
+
+	path := automerge.Root()
+	if pathStr == "/" {
+		return path, nil
+	}
+	for _, part := range strings.Split(pathStr[1:], "/") {
+		key, indexes, _ := strings.Cut(part, "[")
+		if key == "" && indexes == "" {
+			return automerge.Path{}, fmt.Errorf("empty segment in path %q", pathStr)
+		}
+		if key != "" {
+			path = path.Get(key)
+		}
+		if indexes == "" {
+			continue
+		}
+		// "2][0]" → 2, 0
+		for _, idx := range strings.Split(strings.TrimSuffix(indexes, "]"), "][") {
+			i, err := strconv.ParseUint(idx, 10, 32)
+			if err != nil {
+				return automerge.Path{}, fmt.Errorf("invalid index %q in path %q", idx, pathStr)
+			}
+			path = path.Index(uint(i))
+		}
+	}
+	return path, nil
+}
+
+// parseHeads parses comma-separated hex change hashes
+func parseHeads(s string) ([]automerge.ChangeHash, error) {
+	if s == "" {
+		return nil, nil
+	}
+	parts := strings.Split(s, ",")
+	heads := make([]automerge.ChangeHash, len(parts))
+	for i, part := range parts {
+		h, err := automerge.ParseChangeHash(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		heads[i] = h
+	}
+	return heads, nil
+}
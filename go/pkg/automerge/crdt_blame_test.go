@@ -0,0 +1,168 @@
+package automerge
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestDecodeBlame tests decoding of the attribution wire format
+func TestDecodeBlame(t *testing.T) {
+	hash := strings.Repeat("ab", 32)
+	raw := `[{"kind":"delete","start":2,"end":4,"text":"lo","actor":"aa","change":"` + hash + `","time":1700000000},` +
+		`{"start":0,"end":1,"text":"x","actor":"bb","change":"` + hash + `","time":0}]`
+
+	wire, err := decodeBlame(raw)
+	if err != nil {
+		t.Fatalf("decodeBlame failed: %v", err)
+	}
+	if len(wire) != 2 || wire[0].Kind != "delete" {
+		t.Fatalf("decodeBlame = %+v", wire)
+	}
+
+	span, err := wire[0].span()
+	if err != nil {
+		t.Fatalf("span failed: %v", err)
+	}
+	if span.Start != 2 || span.End != 4 || span.Text != "lo" || span.Actor != "aa" {
+		t.Errorf("span = %+v", span)
+	}
+	if span.Change.String() != hash {
+		t.Errorf("change = %s, want %s", span.Change, hash)
+	}
+	if !span.Time.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("time = %v", span.Time)
+	}
+
+	span, _ = wire[1].span()
+	if !span.Time.IsZero() {
+		t.Errorf("time = %v, want zero for an untimed change", span.Time)
+	}
+
+	if _, err := (blameSpanJSON{Change: "zz"}).span(); err == nil {
+		t.Error("expected error for invalid change hash")
+	}
+}
+
+// TestTextAttribution tests attributing merged text to its authors
+func TestTextAttribution(t *testing.T) {
+	ctx := context.Background()
+	alice, err := NewWithWASM(ctx, TestWASMPath)
+	if err != nil {
+		t.Fatalf("Failed to create document: %v", err)
+	}
+	defer alice.Close(ctx)
+	if err := alice.SetActor(ctx, "aaaa"); err != nil {
+		t.Fatalf("SetActor failed: %v", err)
+	}
+
+	path := Root().Get("content")
+	if err := alice.SpliceText(ctx, path, 0, 0, "Hello"); err != nil {
+		t.Fatalf("SpliceText failed: %v", err)
+	}
+	if _, err := alice.Commit(ctx, "greeting"); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	data, _ := alice.Save(ctx)
+	bob, err := LoadWithWASM(ctx, data, TestWASMPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	defer bob.Close(ctx)
+	if err := bob.SetActor(ctx, "bbbb"); err != nil {
+		t.Fatalf("SetActor failed: %v", err)
+	}
+	if err := bob.SpliceText(ctx, path, 5, 0, " world"); err != nil {
+		t.Fatalf("SpliceText failed: %v", err)
+	}
+	if err := alice.Merge(ctx, bob); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+
+	spans, err := alice.TextAttribution(ctx, path)
+	if err != nil {
+		t.Fatalf("TextAttribution failed: %v", err)
+	}
+	if len(spans) != 2 {
+		t.Fatalf("spans = %+v, want 2", spans)
+	}
+	if spans[0].Actor != "aaaa" || spans[0].Text != "Hello" || spans[0].Start != 0 || spans[0].End != 5 {
+		t.Errorf("first span = %+v", spans[0])
+	}
+	if spans[0].Time.IsZero() {
+		t.Error("committed change should carry a time")
+	}
+	if spans[1].Actor != "bbbb" || spans[1].Text != " world" || spans[1].Start != 5 || spans[1].End != 11 {
+		t.Errorf("second span = %+v", spans[1])
+	}
+}
+
+// TestTextAttributionDiff tests reporting inserted and deleted spans per actor
+func TestTextAttributionDiff(t *testing.T) {
+	ctx := context.Background()
+	alice, err := NewWithWASM(ctx, TestWASMPath)
+	if err != nil {
+		t.Fatalf("Failed to create document: %v", err)
+	}
+	defer alice.Close(ctx)
+	if err := alice.SetActor(ctx, "aaaa"); err != nil {
+		t.Fatalf("SetActor failed: %v", err)
+	}
+
+	path := Root().Get("content")
+	if err := alice.SpliceText(ctx, path, 0, 0, "The quick fox"); err != nil {
+		t.Fatalf("SpliceText failed: %v", err)
+	}
+	before, err := alice.GetHeads(ctx)
+	if err != nil {
+		t.Fatalf("GetHeads failed: %v", err)
+	}
+
+	data, _ := alice.Save(ctx)
+	bob, err := LoadWithWASM(ctx, data, TestWASMPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	defer bob.Close(ctx)
+	if err := bob.SetActor(ctx, "bbbb"); err != nil {
+		t.Fatalf("SetActor failed: %v", err)
+	}
+
+	// Alice deletes "quick ", Bob appends " jumps"
+	if err := alice.SpliceText(ctx, path, 4, 6, ""); err != nil {
+		t.Fatalf("SpliceText failed: %v", err)
+	}
+	if err := bob.SpliceText(ctx, path, 13, 0, " jumps"); err != nil {
+		t.Fatalf("SpliceText failed: %v", err)
+	}
+	if err := alice.Merge(ctx, bob); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	after, _ := alice.GetHeads(ctx)
+
+	edits, err := alice.TextAttributionDiff(ctx, path, before, after)
+	if err != nil {
+		t.Fatalf("TextAttributionDiff failed: %v", err)
+	}
+
+	var deleted, inserted *AttributionEdit
+	for i := range edits {
+		switch edits[i].Kind {
+		case EditDelete:
+			deleted = &edits[i]
+		case EditInsert:
+			inserted = &edits[i]
+		}
+	}
+	if len(edits) != 2 || deleted == nil || inserted == nil {
+		t.Fatalf("edits = %+v, want one insert and one delete", edits)
+	}
+	if deleted.Actor != "aaaa" || deleted.Text != "quick " || deleted.Start != 4 || deleted.End != 10 {
+		t.Errorf("delete = %+v", *deleted)
+	}
+	if inserted.Actor != "bbbb" || inserted.Text != " jumps" || inserted.Start != 7 || inserted.End != 13 {
+		t.Errorf("insert = %+v", *inserted)
+	}
+}
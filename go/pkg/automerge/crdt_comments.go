@@ -0,0 +1,407 @@
+// ==============================================================================
+// Layer 4: Go High-Level CRDT API - Comments (Cursor-Anchored Annotations)
+// ==============================================================================
+// ARCHITECTURE: This is the high-level Go API layer (Layer 4/7).
+//
+// RESPONSIBILITIES:
+// - Store comment threads inside the document, under the reserved
+//   ROOT._comments map, so they sync and merge like any other data
+// - Anchor each comment to a text range with a pair of cursors
+// - Resolve anchors back to current ranges, or report them as orphaned
+//
+// DEPENDENCIES:
+// - pkg/automerge cursors (GetCursor, LookupCursors)
+// - pkg/automerge structural JSON (GetJSON/UpdateJSON machinery)
+//
+// DEPENDENTS:
+// - Layer 5: pkg/server (comment operations with the server's user ID)
+//
+// RELATED FILES:
+// - pkg/automerge/crdt_cursor.go (anchors)
+// - Layer 5: pkg/server/crdt_comments.go (stateful server operations)
+// - Layer 6: pkg/api/crdt_comments.go (HTTP handlers)
+//
+// NOTES:
+// - Layout: ROOT._comments.<id> = {start, end, quote, author, body, created,
+//   resolved, replies: [{id, author, body, created}]}; start and end are
+//   cursors in their string form
+// - The start cursor sticks to the first commented character, the end cursor
+//   to the last one, so text typed just outside the range stays outside
+// - A comment is orphaned when all of its text was deleted or its text object
+//   no longer exists; orphaned comments are kept, not deleted
+// - ROOT._comments is created with the first comment: peers creating their
+//   first comments concurrently would create two maps, and only one survives
+//   the merge, so create it up front (EnsureComments) on shared documents;
+//   Layer 5 does so for every new document it creates; documents created
+//   elsewhere must call EnsureComments once before they are first synced
+// - GetJSON leaves ROOT._comments out of the root, and a root UpdateJSON
+//   neither deletes nor overwrites it
+// ==============================================================================
+
+package automerge
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// CommentsKey is the reserved root key holding all comments
+const CommentsKey = "_comments"
+
+// Comment is a comment thread anchored to a range of text
+type Comment struct {
+	ID          string
+	Path        Path           // Text object the comment is anchored in
+	StartCursor Cursor         // Before the first commented character (CursorAfter)
+	EndCursor   Cursor         // After the last commented character (CursorBefore)
+	Quote       string         // The commented text when the comment was made
+	Author      string         // User ID of the author
+	Body        string         // Comment text
+	Created     time.Time      // When the comment was made (second precision)
+	Resolved    bool           // Whether the thread was marked resolved
+	Replies     []CommentReply // Replies, oldest first
+}
+
+// CommentReply is a reply in a comment thread
+type CommentReply struct {
+	ID      string
+	Author  string
+	Body    string
+	Created time.Time
+}
+
+// CommentRange is a comment with its anchor resolved against the current text
+type CommentRange struct {
+	Comment
+	Start    uint // First commented character now
+	End      uint // End of the range now (exclusive)
+	Orphaned bool // All commented text is gone; Start and End are meaningless
+}
+
+// commentsPath is the path of the reserved comments map
+func commentsPath() Path {
+	return Root().Get(CommentsKey)
+}
+
+// newCommentID returns a random ID usable as a map key in a path
+func newCommentID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate comment ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hasRootKey reports whether the document root has key yet
+func (d *Document) hasRootKey(ctx context.Context, key string) (bool, error) {
+	keys, err := d.runtime.AmMapKeys(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, k := range keys {
+		if k == key {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// EnsureComments creates the (empty) comments map if the document has none.
+//
+// Call it once when a shared document is created, before peers start
+// commenting, so they all add comments to the same map. Layer 5 only does
+// this for the documents it creates: an application that creates documents
+// itself must call EnsureComments once before it first syncs them.
+//
+// Status: ✅ Implemented
+func (d *Document) EnsureComments(ctx context.Context) error {
+	if d.runtime == nil {
+		return fmt.Errorf("document not initialized")
+	}
+	ok, err := d.hasRootKey(ctx, CommentsKey)
+	if err != nil || ok {
+		return err
+	}
+	return d.UpdateJSON(ctx, commentsPath(), map[string]interface{}{})
+}
+
+// textNode reads the text object at path
+func (d *Document) textNode(ctx context.Context, path Path) (string, error) {
+	node, err := d.jsonNode(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	if node.Type != "text" {
+		return "", fmt.Errorf("%w: %s is not a text object", ErrTypeMismatch, path)
+	}
+	return node.Str, nil
+}
+
+// AddComment anchors a new comment to the characters start..end (exclusive)
+// of the text at path.
+//
+// Example:
+//
+//	// Comment on "World" in "Hello World"
+//	c, _ := doc.AddComment(ctx, automerge.Root().Get("content"), 6, 11, "alice", "Which one?")
+//
+// Status: ✅ Implemented
+func (d *Document) AddComment(ctx context.Context, path Path, start, end uint, author, body string) (*Comment, error) {
+	if d.runtime == nil {
+		return nil, fmt.Errorf("document not initialized")
+	}
+	if start >= end {
+		return nil, fmt.Errorf("%w: empty comment range %d..%d", ErrIndexOutOfBounds, start, end)
+	}
+	text, err := d.textNode(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	runes := []rune(text)
+	if end > uint(len(runes)) {
+		return nil, fmt.Errorf("%w: range %d..%d in text of length %d", ErrIndexOutOfBounds, start, end, len(runes))
+	}
+
+	startCursor, err := d.GetCursor(ctx, path, int(start), CursorAfter)
+	if err != nil {
+		return nil, err
+	}
+	endCursor, err := d.GetCursor(ctx, path, int(end), CursorBefore)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := newCommentID()
+	if err != nil {
+		return nil, err
+	}
+	comment := &Comment{
+		ID:          id,
+		Path:        path,
+		StartCursor: *startCursor,
+		EndCursor:   *endCursor,
+		Quote:       string(runes[start:end]),
+		Author:      author,
+		Body:        body,
+		Created:     time.Now().UTC().Truncate(time.Second),
+	}
+
+	record := map[string]interface{}{
+		"start":    comment.StartCursor.String(),
+		"end":      comment.EndCursor.String(),
+		"quote":    comment.Quote,
+		"author":   author,
+		"body":     body,
+		"created":  comment.Created.Format(time.RFC3339),
+		"resolved": false,
+		"replies":  []interface{}{},
+	}
+	ok, err := d.hasRootKey(ctx, CommentsKey)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		err = d.UpdateJSON(ctx, commentsPath(), map[string]interface{}{id: record})
+	} else {
+		err = d.UpdateJSON(ctx, commentsPath().Get(id), record)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to store comment: %w", err)
+	}
+	return comment, nil
+}
+
+// ReplyToComment appends a reply to a comment thread.
+//
+// Concurrent replies from different peers are all kept.
+//
+// Status: ✅ Implemented
+func (d *Document) ReplyToComment(ctx context.Context, id, author, body string) (*CommentReply, error) {
+	if d.runtime == nil {
+		return nil, fmt.Errorf("document not initialized")
+	}
+	comment, err := d.GetComment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	replyID, err := newCommentID()
+	if err != nil {
+		return nil, err
+	}
+	reply := CommentReply{ID: replyID, Author: author, Body: body, Created: time.Now().UTC().Truncate(time.Second)}
+
+	// Rewrite the list with the reply appended: UpdateJSON only inserts it
+	replies := make([]interface{}, 0, len(comment.Replies)+1)
+	for _, r := range append(comment.Replies, reply) {
+		replies = append(replies, map[string]interface{}{
+			"id":      r.ID,
+			"author":  r.Author,
+			"body":    r.Body,
+			"created": r.Created.Format(time.RFC3339),
+		})
+	}
+	if err := d.UpdateJSON(ctx, commentsPath().Get(id).Get("replies"), replies); err != nil {
+		return nil, fmt.Errorf("failed to store reply: %w", err)
+	}
+	return &reply, nil
+}
+
+// ResolveComment marks a comment thread as resolved (or reopens it)
+//
+// Status: ✅ Implemented
+func (d *Document) ResolveComment(ctx context.Context, id string, resolved bool) error {
+	if d.runtime == nil {
+		return fmt.Errorf("document not initialized")
+	}
+	if _, err := d.GetComment(ctx, id); err != nil {
+		return err
+	}
+	return d.UpdateJSON(ctx, commentsPath().Get(id).Get("resolved"), resolved)
+}
+
+// GetComment returns one comment thread by ID
+//
+// Status: ✅ Implemented
+func (d *Document) GetComment(ctx context.Context, id string) (*Comment, error) {
+	comments, err := d.comments(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range comments {
+		if comments[i].ID == id {
+			return &comments[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: comment %q", ErrKeyNotFound, id)
+}
+
+// comments reads all stored comment threads
+func (d *Document) comments(ctx context.Context) ([]Comment, error) {
+	ok, err := d.hasRootKey(ctx, CommentsKey)
+	if err != nil || !ok {
+		return nil, err
+	}
+	node, err := d.jsonNode(ctx, commentsPath())
+	if err != nil {
+		return nil, err
+	}
+	if node.Type != "map" {
+		return nil, fmt.Errorf("%w: %s is not a map", ErrTypeMismatch, CommentsKey)
+	}
+
+	comments := make([]Comment, 0, len(node.Map))
+	for id, n := range node.Map {
+		if n == nil || n.Type != "map" {
+			continue
+		}
+		c := Comment{
+			ID:      id,
+			Quote:   nodeString(n.Map["quote"]),
+			Author:  nodeString(n.Map["author"]),
+			Body:    nodeString(n.Map["body"]),
+			Created: nodeTime(n.Map["created"]),
+		}
+		// Unreadable anchors are left empty (the comment is orphaned)
+		if start, err := ParseCursor(nodeString(n.Map["start"])); err == nil {
+			c.StartCursor = start
+			c.Path = start.Path
+		}
+		if end, err := ParseCursor(nodeString(n.Map["end"])); err == nil {
+			c.EndCursor = end
+		}
+		if r := n.Map["resolved"]; r != nil && r.Type == "bool" {
+			c.Resolved = r.Bool
+		}
+		if replies := n.Map["replies"]; replies != nil && replies.Type == "list" {
+			for _, r := range replies.List {
+				if r == nil || r.Type != "map" {
+					continue
+				}
+				c.Replies = append(c.Replies, CommentReply{
+					ID:      nodeString(r.Map["id"]),
+					Author:  nodeString(r.Map["author"]),
+					Body:    nodeString(r.Map["body"]),
+					Created: nodeTime(r.Map["created"]),
+				})
+			}
+		}
+		comments = append(comments, c)
+	}
+	return comments, nil
+}
+
+// nodeString returns a str or text node's string ("" otherwise)
+func nodeString(n *jsonNode) string {
+	if n == nil || (n.Type != "str" && n.Type != "text") {
+		return ""
+	}
+	return n.Str
+}
+
+// nodeTime parses an RFC 3339 string node (zero time otherwise)
+func nodeTime(n *jsonNode) time.Time {
+	t, _ := time.Parse(time.RFC3339, nodeString(n))
+	return t
+}
+
+// Comments returns all comment threads with their anchors resolved against
+// the current text, ordered by position (orphaned comments last).
+//
+// Example:
+//
+//	comments, _ := doc.Comments(ctx)
+//	for _, c := range comments {
+//	    if !c.Orphaned {
+//	        fmt.Printf("%d-%d %s: %s\n", c.Start, c.End, c.Author, c.Body)
+//	    }
+//	}
+//
+// Status: ✅ Implemented
+func (d *Document) Comments(ctx context.Context) ([]CommentRange, error) {
+	if d.runtime == nil {
+		return nil, fmt.Errorf("document not initialized")
+	}
+	comments, err := d.comments(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resolve all anchors in one lookup
+	cursors := make([]Cursor, 0, 2*len(comments))
+	for _, c := range comments {
+		cursors = append(cursors, c.StartCursor, c.EndCursor)
+	}
+	indexes, err := d.LookupCursors(ctx, cursors)
+	if err != nil {
+		return nil, err
+	}
+
+	ranges := make([]CommentRange, len(comments))
+	for i, c := range comments {
+		start, end := indexes[2*i], indexes[2*i+1]
+		if start < 0 || end <= start {
+			ranges[i] = CommentRange{Comment: c, Orphaned: true}
+			continue
+		}
+		ranges[i] = CommentRange{Comment: c, Start: uint(start), End: uint(end)}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		a, b := ranges[i], ranges[j]
+		if a.Orphaned != b.Orphaned {
+			return !a.Orphaned
+		}
+		if a.Start != b.Start {
+			return a.Start < b.Start
+		}
+		if !a.Created.Equal(b.Created) {
+			return a.Created.Before(b.Created)
+		}
+		return a.ID < b.ID
+	})
+	return ranges, nil
+}
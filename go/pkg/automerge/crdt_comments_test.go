@@ -0,0 +1,126 @@
+package automerge_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+)
+
+func TestDocument_AddComment(t *testing.T) {
+	doc, ctx := newTestDoc(t)
+	path := automerge.Root().Get("content")
+
+	if err := doc.SpliceText(ctx, path, 0, 0, "Hello World"); err != nil {
+		t.Fatalf("Failed to add text: %v", err)
+	}
+
+	c, err := doc.AddComment(ctx, path, 6, 11, "alice", "Which one?")
+	if err != nil {
+		t.Fatalf("AddComment failed: %v", err)
+	}
+	if c.ID == "" || c.Quote != "World" || c.StartCursor.Bias != automerge.CursorAfter || c.EndCursor.Bias != automerge.CursorBefore {
+		t.Errorf("comment = %+v", c)
+	}
+
+	// Invalid ranges and non-text paths are rejected
+	if _, err := doc.AddComment(ctx, path, 3, 3, "alice", "empty"); !errors.Is(err, automerge.ErrIndexOutOfBounds) {
+		t.Errorf("empty range error = %v", err)
+	}
+	if _, err := doc.AddComment(ctx, path, 6, 99, "alice", "too long"); !errors.Is(err, automerge.ErrIndexOutOfBounds) {
+		t.Errorf("long range error = %v", err)
+	}
+	if _, err := doc.AddComment(ctx, automerge.Root(), 0, 1, "alice", "root"); err == nil {
+		t.Error("expected error for a non-text path")
+	}
+
+	// The comment follows the text as it is edited; text typed right after
+	// it stays outside
+	if err := doc.SpliceText(ctx, path, 0, 0, ">> "); err != nil {
+		t.Fatalf("SpliceText failed: %v", err)
+	}
+	if err := doc.SpliceText(ctx, path, 14, 0, "!!"); err != nil {
+		t.Fatalf("SpliceText failed: %v", err)
+	}
+
+	comments, err := doc.Comments(ctx)
+	if err != nil {
+		t.Fatalf("Comments failed: %v", err)
+	}
+	if len(comments) != 1 {
+		t.Fatalf("got %d comments, want 1", len(comments))
+	}
+	got := comments[0]
+	if got.Orphaned || got.Start != 9 || got.End != 14 || got.Author != "alice" || got.Body != "Which one?" {
+		t.Errorf("comment range = %+v", got)
+	}
+	if got.Path.String() != path.String() {
+		t.Errorf("path = %s, want %s", got.Path, path)
+	}
+
+	// The comments map is not part of the root's JSON
+	root, err := doc.GetJSON(ctx, automerge.Root())
+	if err != nil {
+		t.Fatalf("GetJSON failed: %v", err)
+	}
+	if _, ok := root.(map[string]interface{})[automerge.CommentsKey]; ok {
+		t.Errorf("GetJSON(ROOT) = %v, want no %s", root, automerge.CommentsKey)
+	}
+}
+
+func TestDocument_CommentThreads(t *testing.T) {
+	doc, ctx := newTestDoc(t)
+	path := automerge.Root().Get("content")
+
+	if err := doc.SpliceText(ctx, path, 0, 0, "one two three"); err != nil {
+		t.Fatalf("Failed to add text: %v", err)
+	}
+	if err := doc.EnsureComments(ctx); err != nil {
+		t.Fatalf("EnsureComments failed: %v", err)
+	}
+
+	late, err := doc.AddComment(ctx, path, 8, 13, "bob", "late")
+	if err != nil {
+		t.Fatalf("AddComment failed: %v", err)
+	}
+	early, err := doc.AddComment(ctx, path, 0, 3, "alice", "early")
+	if err != nil {
+		t.Fatalf("AddComment failed: %v", err)
+	}
+
+	if _, err := doc.ReplyToComment(ctx, early.ID, "bob", "agreed"); err != nil {
+		t.Fatalf("ReplyToComment failed: %v", err)
+	}
+	if _, err := doc.ReplyToComment(ctx, early.ID, "alice", "thanks"); err != nil {
+		t.Fatalf("ReplyToComment failed: %v", err)
+	}
+	if err := doc.ResolveComment(ctx, early.ID, true); err != nil {
+		t.Fatalf("ResolveComment failed: %v", err)
+	}
+	if _, err := doc.ReplyToComment(ctx, "missing", "bob", "?"); !errors.Is(err, automerge.ErrKeyNotFound) {
+		t.Errorf("reply to missing comment error = %v", err)
+	}
+
+	// Deleting all of "three" orphans the late comment
+	if err := doc.SpliceText(ctx, path, 7, 6, ""); err != nil {
+		t.Fatalf("SpliceText failed: %v", err)
+	}
+
+	comments, err := doc.Comments(ctx)
+	if err != nil {
+		t.Fatalf("Comments failed: %v", err)
+	}
+	if len(comments) != 2 || comments[0].ID != early.ID || comments[1].ID != late.ID {
+		t.Fatalf("comments = %+v", comments)
+	}
+	first := comments[0]
+	if !first.Resolved || first.Orphaned || first.Start != 0 || first.End != 3 {
+		t.Errorf("early comment = %+v", first)
+	}
+	if len(first.Replies) != 2 || first.Replies[0].Body != "agreed" || first.Replies[1].Author != "alice" {
+		t.Errorf("replies = %+v", first.Replies)
+	}
+	if !comments[1].Orphaned {
+		t.Errorf("late comment not orphaned: %+v", comments[1])
+	}
+}
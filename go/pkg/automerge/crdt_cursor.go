@@ -1,10 +1,81 @@
+// ==============================================================================
+// Layer 4: Go High-Level CRDT API - Cursors (Stable Positions)
+// ==============================================================================
+// ARCHITECTURE: This is the high-level Go API layer (Layer 4/7).
+//
+// RESPONSIBILITIES:
+// - Create cursors in text and list objects addressed by Path
+// - Resolve cursors back to indexes, one at a time or in batches
+// - Serialize cursors to a stable string clients can store and send back
+//
+// DEPENDENCIES:
+// - Layer 3: pkg/wazero (FFI to WASM)
+// - Context: Takes context.Context for FFI calls
+//
+// DEPENDENTS:
+// - Layer 5: pkg/server (stateful, thread-safe operations)
+// - pkg/automerge/crdt_comments.go (comment anchors)
+//
+// RELATED FILES (1:1 mapping):
+// - Layer 2: rust/automerge_wasi/src/cursor.rs (WASI exports)
+// - Layer 3: pkg/wazero/crdt_cursor.go (FFI wrappers)
+// - Layer 5: pkg/server/crdt_cursor.go (stateful server operations)
+// - Layer 6: pkg/api/crdt_cursor.go (HTTP handlers)
+// - Layer 7: web/js/crdt_cursor.js + web/components/crdt_cursor.html
+//
+// NOTES:
+// - A cursor is a position between elements (0..=length). Its bias picks
+//   the neighbour it sticks to, which decides where it goes when something
+//   is inserted exactly at the position
+// - A cursor whose element was deleted resolves to where the element was
+// - String form: "<bias>:<automerge cursor>:<dotted path>", e.g.
+//   "after:3@6a1f…:ROOT.content"
+// ==============================================================================
+
 package automerge
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/wazero"
 )
 
+// CursorBias selects which neighbour a cursor sticks to
+type CursorBias uint8
+
+const (
+	// CursorAfter sticks to the element after the position: text inserted
+	// at the position goes before the cursor (like a caret before a
+	// character)
+	CursorAfter CursorBias = iota
+	// CursorBefore sticks to the element before the position: text inserted
+	// at the position goes after the cursor (like the end of a selection)
+	CursorBefore
+)
+
+// String returns "after" or "before"
+func (b CursorBias) String() string {
+	if b == CursorBefore {
+		return "before"
+	}
+	return "after"
+}
+
+// ParseCursorBias parses "after" or "before" ("" means after)
+func ParseCursorBias(s string) (CursorBias, error) {
+	switch s {
+	case "", "after":
+		return CursorAfter, nil
+	case "before":
+		return CursorBefore, nil
+	default:
+		return 0, fmt.Errorf("invalid cursor bias %q (want before or after)", s)
+	}
+}
+
 // Cursor represents a stable position in a text or list object.
 // Cursors track positions that remain valid across concurrent edits.
 //
@@ -17,68 +88,157 @@ import (
 // - Text becomes "Hi Hello"
 // - User A's cursor now points to position 8 (5 + 3)
 type Cursor struct {
-	// Path to the text or list object (e.g., "ROOT.content")
-	Path string
-	// Cursor string (opaque, generated by Automerge)
+	// Path to the text or list object
+	Path Path
+	// Bias picks the neighbour the cursor sticks to
+	Bias CursorBias
+	// Value is the Automerge cursor (opaque)
 	Value string
 }
 
-// GetCursor creates a cursor at the given position in a text or list object.
+// GetCursor creates a cursor at index (0..=length) in a text or list object.
+//
+// Example:
 //
-// Parameters:
-//   - ctx: Context for cancellation
-//   - path: Object path (e.g., "ROOT.content")
-//   - index: Position in the object (character index for text, item index for lists)
+//	// Selection 6..11: the start follows "W", the end follows "d"
+//	start, _ := doc.GetCursor(ctx, automerge.Root().Get("content"), 6, automerge.CursorAfter)
+//	end, _ := doc.GetCursor(ctx, automerge.Root().Get("content"), 11, automerge.CursorBefore)
 //
-// Returns:
-//   - Cursor with the path and cursor value
-//   - Error if path is invalid or index is out of bounds
-func (d *Document) GetCursor(ctx context.Context, path string, index int) (*Cursor, error) {
+// Status: ✅ Implemented
+func (d *Document) GetCursor(ctx context.Context, path Path, index int, bias CursorBias) (*Cursor, error) {
 	if d.runtime == nil {
 		return nil, fmt.Errorf("document not initialized")
 	}
+	if index < 0 {
+		return nil, fmt.Errorf("%w: cursor index %d", ErrIndexOutOfBounds, index)
+	}
+	p, err := path.objPath()
+	if err != nil {
+		return nil, err
+	}
 
-	cursorValue, err := d.runtime.GetCursor(ctx, path, index)
+	value, err := d.runtime.AmCursor(ctx, p, uint(index), uint32(bias))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get cursor: %w", err)
+		return nil, fmt.Errorf("failed to get cursor: %w", cursorError(err, p, index))
 	}
 
-	return &Cursor{
-		Path:  path,
-		Value: cursorValue,
-	}, nil
+	return &Cursor{Path: path, Bias: bias, Value: value}, nil
+}
+
+// cursorError maps am_cursor error codes to package errors
+func cursorError(err error, path string, index int) error {
+	var wasmErr *wazero.WASMError
+	if !errors.As(err, &wasmErr) {
+		return err
+	}
+	switch wasmErr.Code {
+	case -1:
+		return fmt.Errorf("%w: %s", ErrObjectNotFound, path)
+	case -2:
+		return fmt.Errorf("%w: index %d in %s", ErrIndexOutOfBounds, index, path)
+	case -3:
+		return fmt.Errorf("%w: %s is not a text or list object", ErrTypeMismatch, path)
+	default:
+		return err
+	}
 }
 
 // LookupCursor finds the current position of a cursor.
 //
-// Parameters:
-//   - ctx: Context for cancellation
-//   - cursor: Cursor to look up
-//
-// Returns:
-//   - Current position (index) of the cursor
-//   - Error if cursor is invalid or not found
+// Status: ✅ Implemented
 func (d *Document) LookupCursor(ctx context.Context, cursor *Cursor) (int, error) {
+	if cursor == nil {
+		return 0, fmt.Errorf("cursor is nil")
+	}
+
+	indexes, err := d.LookupCursors(ctx, []Cursor{*cursor})
+	if err != nil {
+		return 0, err
+	}
+	if indexes[0] < 0 {
+		return 0, fmt.Errorf("failed to lookup cursor: %w: %s", ErrObjectNotFound, cursor)
+	}
+	return indexes[0], nil
+}
+
+// LookupCursors finds the current positions of many cursors in one call.
+//
+// The result has one index per cursor, or -1 for a cursor that can't be
+// resolved (its object no longer exists, or the value is invalid).
+//
+// Example:
+//
+//	indexes, _ := doc.LookupCursors(ctx, []automerge.Cursor{*start, *end})
+//
+// Status: ✅ Implemented
+func (d *Document) LookupCursors(ctx context.Context, cursors []Cursor) ([]int, error) {
 	if d.runtime == nil {
-		return 0, fmt.Errorf("document not initialized")
+		return nil, fmt.Errorf("document not initialized")
 	}
 
-	if cursor == nil {
-		return 0, fmt.Errorf("cursor is nil")
+	queries := make([]wazero.CursorQuery, len(cursors))
+	for i, c := range cursors {
+		p, err := c.Path.objPath()
+		if err != nil {
+			return nil, err
+		}
+		queries[i] = wazero.CursorQuery{Path: p, Cursor: c.Value, Bias: uint32(c.Bias)}
+	}
+
+	raw, err := d.runtime.AmLookupCursors(ctx, queries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup cursors: %w", err)
+	}
+
+	indexes := make([]int, len(cursors))
+	for i, index := range raw {
+		if index < 0 {
+			index = -1
+		}
+		indexes[i] = int(index)
+	}
+	return indexes, nil
+}
+
+// String returns the stable string form of the cursor (see ParseCursor)
+func (c Cursor) String() string {
+	p, err := c.Path.objPath()
+	if err != nil {
+		p = c.Path.String()
 	}
+	return c.Bias.String() + ":" + c.Value + ":" + p
+}
 
-	index, err := d.runtime.LookupCursor(ctx, cursor.Path, cursor.Value)
+// ParseCursor parses the string form of a cursor
+//
+// Status: ✅ Implemented
+func ParseCursor(s string) (Cursor, error) {
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+		return Cursor{}, fmt.Errorf("invalid cursor %q", s)
+	}
+	bias, err := ParseCursorBias(parts[0])
 	if err != nil {
-		return 0, fmt.Errorf("failed to lookup cursor: %w", err)
+		return Cursor{}, err
 	}
+	path, err := ParseObjPath(parts[2])
+	if err != nil {
+		return Cursor{}, fmt.Errorf("invalid cursor %q: %w", s, err)
+	}
+	return Cursor{Path: path, Bias: bias, Value: parts[1]}, nil
+}
 
-	return index, nil
+// MarshalText encodes the cursor as its string form (e.g. in JSON)
+func (c Cursor) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
 }
 
-// String returns a string representation of the cursor.
-func (c *Cursor) String() string {
-	if c == nil {
-		return "<nil cursor>"
+// UnmarshalText decodes the string form of a cursor
+func (c *Cursor) UnmarshalText(data []byte) error {
+	parsed, err := ParseCursor(string(data))
+	if err != nil {
+		return err
 	}
-	return fmt.Sprintf("Cursor{path=%s, value=%s}", c.Path, c.Value)
+	*c = parsed
+	return nil
 }
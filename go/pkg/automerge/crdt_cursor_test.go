@@ -30,20 +30,23 @@ func TestDocument_GetCursor(t *testing.T) {
 
 	tests := []struct {
 		name      string
-		path      string
+		path      automerge.Path
 		index     int
 		wantError bool
 	}{
-		{"valid cursor at beginning", "ROOT.content", 0, false},
-		{"valid cursor in middle", "ROOT.content", 5, false},
-		{"valid cursor near end", "ROOT.content", 10, false}, // Last character 'd'
-		{"invalid path", "INVALID.path", 0, true},
-		{"index out of bounds", "ROOT.content", 999, true},
+		{"valid cursor at beginning", path, 0, false},
+		{"valid cursor in middle", path, 5, false},
+		{"valid cursor near end", path, 10, false}, // Last character 'd'
+		{"valid cursor at end", path, 11, false},
+		{"invalid path", automerge.Root().Get("missing"), 0, true},
+		{"not a sequence", automerge.Root(), 0, true},
+		{"index out of bounds", path, 999, true},
+		{"negative index", path, -1, true},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			cursor, err := doc.GetCursor(ctx, tt.path, tt.index)
+			cursor, err := doc.GetCursor(ctx, tt.path, tt.index, automerge.CursorAfter)
 			if tt.wantError {
 				if err == nil {
 					t.Error("Expected error but got none")
@@ -56,7 +59,7 @@ func TestDocument_GetCursor(t *testing.T) {
 			if cursor == nil {
 				t.Fatal("Cursor is nil")
 			}
-			if cursor.Path != tt.path {
+			if cursor.Path.String() != tt.path.String() {
 				t.Errorf("Expected path %s, got %s", tt.path, cursor.Path)
 			}
 			if cursor.Value == "" {
@@ -75,7 +78,7 @@ func TestDocument_LookupCursor(t *testing.T) {
 		t.Fatalf("Failed to add text: %v", err)
 	}
 
-	cursor, err := doc.GetCursor(ctx, "ROOT.content", 5)
+	cursor, err := doc.GetCursor(ctx, path, 5, automerge.CursorAfter)
 	if err != nil {
 		t.Fatalf("Failed to get cursor: %v", err)
 	}
@@ -98,7 +101,7 @@ func TestDocument_CursorSurvivesEdits(t *testing.T) {
 		t.Fatalf("Failed to add text: %v", err)
 	}
 
-	cursor, err := doc.GetCursor(ctx, "ROOT.content", 6)
+	cursor, err := doc.GetCursor(ctx, path, 6, automerge.CursorAfter)
 	if err != nil {
 		t.Fatalf("Failed to get cursor: %v", err)
 	}
@@ -130,22 +133,113 @@ func TestDocument_CursorSurvivesEdits(t *testing.T) {
 	t.Logf("Cursor moved from index 6 to index %d after inserting 'Hi '", index)
 }
 
-func TestCursor_String(t *testing.T) {
-	tests := []struct {
-		name     string
-		cursor   *automerge.Cursor
-		expected string
-	}{
-		{"nil cursor", nil, "<nil cursor>"},
-		{"valid cursor", &automerge.Cursor{Path: "ROOT.content", Value: "abc123"}, "Cursor{path=ROOT.content, value=abc123}"},
+func TestDocument_CursorBias(t *testing.T) {
+	doc, ctx := newTestDoc(t)
+	path := automerge.Root().Get("content")
+
+	if err := doc.SpliceText(ctx, path, 0, 0, "Hello World"); err != nil {
+		t.Fatalf("Failed to add text: %v", err)
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result := tt.cursor.String()
-			if result != tt.expected {
-				t.Errorf("Expected %q, got %q", tt.expected, result)
+	// Both cursors between "Hello" and " World"
+	after, err := doc.GetCursor(ctx, path, 5, automerge.CursorAfter)
+	if err != nil {
+		t.Fatalf("GetCursor failed: %v", err)
+	}
+	before, err := doc.GetCursor(ctx, path, 5, automerge.CursorBefore)
+	if err != nil {
+		t.Fatalf("GetCursor failed: %v", err)
+	}
+	end, err := doc.GetCursor(ctx, path, 11, automerge.CursorAfter)
+	if err != nil {
+		t.Fatalf("GetCursor failed: %v", err)
+	}
+	cursors := []automerge.Cursor{*after, *before, *end}
+
+	lookup := func(want ...int) {
+		t.Helper()
+		got, err := doc.LookupCursors(ctx, cursors)
+		if err != nil {
+			t.Fatalf("LookupCursors failed: %v", err)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("LookupCursors = %v, want %v", got, want)
+				return
 			}
-		})
+		}
+	}
+	lookup(5, 5, 11)
+
+	// Text typed at the position goes before the after-biased cursor only
+	if err := doc.SpliceText(ctx, path, 5, 0, "!!"); err != nil {
+		t.Fatalf("SpliceText failed: %v", err)
+	}
+	lookup(7, 5, 13)
+
+	// Deleting around the position puts both where the text was
+	if err := doc.SpliceText(ctx, path, 3, 4, ""); err != nil {
+		t.Fatalf("SpliceText failed: %v", err)
+	}
+	lookup(3, 3, 9)
+}
+
+func TestDocument_ListCursor(t *testing.T) {
+	doc, ctx := newTestDoc(t)
+	items := automerge.Root().Get("items")
+
+	if err := doc.UpdateJSON(ctx, items, []interface{}{"a", "b", "c"}); err != nil {
+		t.Fatalf("UpdateJSON failed: %v", err)
+	}
+	cursor, err := doc.GetCursor(ctx, items, 2, automerge.CursorAfter)
+	if err != nil {
+		t.Fatalf("GetCursor failed: %v", err)
+	}
+
+	if err := doc.UpdateJSON(ctx, items, []interface{}{"z", "a", "c"}); err != nil {
+		t.Fatalf("UpdateJSON failed: %v", err)
+	}
+	index, err := doc.LookupCursor(ctx, cursor)
+	if err != nil {
+		t.Fatalf("LookupCursor failed: %v", err)
+	}
+	if index != 2 {
+		t.Errorf("Expected cursor at index 2, got %d", index)
+	}
+
+	// Cursors into objects that are gone don't resolve
+	stale := automerge.Cursor{Path: automerge.Root().Get("missing"), Value: cursor.Value}
+	indexes, err := doc.LookupCursors(ctx, []automerge.Cursor{*cursor, stale})
+	if err != nil {
+		t.Fatalf("LookupCursors failed: %v", err)
+	}
+	if indexes[0] != 2 || indexes[1] != -1 {
+		t.Errorf("LookupCursors = %v, want [2 -1]", indexes)
+	}
+}
+
+func TestCursor_String(t *testing.T) {
+	cursor := automerge.Cursor{
+		Path:  automerge.Root().Get("items").Index(3).Get("title"),
+		Bias:  automerge.CursorBefore,
+		Value: "7@abc123",
+	}
+	const want = "before:7@abc123:ROOT.items.3.title"
+	if got := cursor.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	parsed, err := automerge.ParseCursor(want)
+	if err != nil {
+		t.Fatalf("ParseCursor failed: %v", err)
+	}
+	if parsed.String() != want || parsed.Bias != automerge.CursorBefore || parsed.Value != "7@abc123" {
+		t.Errorf("ParseCursor = %+v", parsed)
+	}
+
+	for _, bad := range []string{"", "after:7@abc", "sideways:7@abc:ROOT.content", "after::ROOT.content", "after:7@abc:content"} {
+		if _, err := automerge.ParseCursor(bad); err == nil {
+			t.Errorf("ParseCursor(%q) succeeded", bad)
+		}
 	}
 }
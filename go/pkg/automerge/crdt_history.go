@@ -2,6 +2,7 @@ package automerge
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 )
 
@@ -100,6 +101,55 @@ func (d *Document) Fork(ctx context.Context) (*Document, error) {
 	}
 }
 
+// ChangedPaths returns the paths the changes between the before and after
+// heads touched, each once: the entry for map changes and counter
+// increments, the element for list puts, inserts and deletes, and the text
+// itself for text edits and marks.
+//
+// Use it to tell what changes from peers (sync, merge) did: record the
+// heads, apply the changes, then ask for the paths since the recorded heads.
+//
+// Example:
+//
+//	before, _ := doc.GetHeads(ctx)
+//	// ... apply changes ...
+//	after, _ := doc.GetHeads(ctx)
+//	paths, _ := doc.ChangedPaths(ctx, before, after) // [/config/theme /items[2]]
+//
+// Status: ✅ Implemented
+func (d *Document) ChangedPaths(ctx context.Context, before, after []ChangeHash) ([]Path, error) {
+	if d.runtime == nil {
+		return nil, fmt.Errorf("document not initialized")
+	}
+
+	raw, err := d.runtime.AmDiffPaths(ctx, hashesToBytes(before), hashesToBytes(after))
+	if err != nil {
+		return nil, err
+	}
+
+	var wire [][]interface{}
+	if err := json.Unmarshal([]byte(raw), &wire); err != nil {
+		return nil, fmt.Errorf("failed to parse paths JSON: %w", err)
+	}
+
+	paths := make([]Path, len(wire))
+	for i, props := range wire {
+		path := Root()
+		for _, prop := range props {
+			switch p := prop.(type) {
+			case string:
+				path = path.Get(p)
+			case float64:
+				path = path.Index(uint(p))
+			default:
+				return nil, fmt.Errorf("invalid path segment %v", prop)
+			}
+		}
+		paths[i] = path
+	}
+	return paths, nil
+}
+
 // ForkAt creates a copy of the document at a specific point in history.
 //
 // Useful for time-travel debugging or exploring alternative histories.
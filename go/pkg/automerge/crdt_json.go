@@ -0,0 +1,687 @@
+// ==============================================================================
+// Layer 4: Go High-Level CRDT API - Structural JSON Updates
+// ==============================================================================
+// ARCHITECTURE: This is the high-level Go API layer (Layer 4/7).
+//
+// RESPONSIBILITIES:
+// - Read any subtree as plain Go values (GetJSON)
+// - Save a JSON value over a subtree as a minimal set of CRDT operations (UpdateJSON)
+// - Text diffing for string fields stored as Text objects
+//
+// DEPENDENCIES:
+// - Layer 3: pkg/wazero (FFI to WASM)
+// - Context: Takes context.Context for FFI calls
+//
+// DEPENDENTS:
+// - Layer 5: pkg/server (document operations)
+//
+// RELATED FILES (1:1 mapping):
+// - Layer 2: rust/automerge_wasi/src/object.rs (WASI exports)
+// - Layer 3: pkg/wazero/crdt_object.go (FFI wrappers)
+//
+// NOTES:
+// - Replacing a subtree wholesale would discard concurrent edits made by other
+//   peers; UpdateJSON only touches what actually changed
+// - Text positions are Unicode code points (runes), matching SpliceText
+// - The reserved root keys (CommentsKey, MarksKey) are hidden from root reads
+//   and left alone by root updates
+// ==============================================================================
+
+package automerge
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// maxLCSCells bounds the LCS table used for list and text diffs. Larger
+// changed regions are replaced wholesale instead of diffed.
+const maxLCSCells = 1 << 22
+
+// jsonNode is one node of the typed JSON rendered by am_obj_json.
+//
+// Unlike plain JSON it keeps Automerge types apart, so a Text object is not
+// mistaken for a string scalar and counters are not mistaken for ints.
+type jsonNode struct {
+	Type string // map, list, text, str, int, uint, f64, bool, null, counter, timestamp, bytes
+	Map  map[string]*jsonNode
+	List []*jsonNode
+	Str  string      // text, str, bytes (hex)
+	Num  json.Number // int, uint, f64, counter, timestamp
+	Bool bool
+}
+
+// UnmarshalJSON decodes a {"t": <type>, "v": <value>} node
+func (n *jsonNode) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		T string          `json:"t"`
+		V json.RawMessage `json:"v"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	n.Type = raw.T
+	switch raw.T {
+	case "map":
+		return json.Unmarshal(raw.V, &n.Map)
+	case "list":
+		return json.Unmarshal(raw.V, &n.List)
+	case "text", "str", "bytes":
+		return json.Unmarshal(raw.V, &n.Str)
+	case "int", "uint", "f64", "counter", "timestamp":
+		return json.Unmarshal(raw.V, &n.Num)
+	case "bool":
+		return json.Unmarshal(raw.V, &n.Bool)
+	case "null":
+		return nil
+	default:
+		return fmt.Errorf("unknown node type %q", raw.T)
+	}
+}
+
+// value converts the node into plain Go values
+func (n *jsonNode) value() interface{} {
+	switch n.Type {
+	case "map":
+		m := make(map[string]interface{}, len(n.Map))
+		for k, child := range n.Map {
+			m[k] = child.value()
+		}
+		return m
+	case "list":
+		l := make([]interface{}, len(n.List))
+		for i, child := range n.List {
+			l[i] = child.value()
+		}
+		return l
+	case "text", "str":
+		return n.Str
+	case "int", "counter", "timestamp":
+		i, _ := n.Num.Int64()
+		return i
+	case "uint":
+		u, _ := strconv.ParseUint(string(n.Num), 10, 64)
+		return u
+	case "f64":
+		f, _ := n.Num.Float64()
+		return f
+	case "bool":
+		return n.Bool
+	case "bytes":
+		b, _ := hex.DecodeString(n.Str)
+		return b
+	default:
+		return nil
+	}
+}
+
+// scalar converts a scalar node into a typed Value (objects become null)
+func (n *jsonNode) scalar() Value {
+	switch n.Type {
+	case "str":
+		return NewString(n.Str)
+	case "int":
+		i, _ := n.Num.Int64()
+		return NewInt(i)
+	case "uint":
+		u, _ := strconv.ParseUint(string(n.Num), 10, 64)
+		return NewUint(u)
+	case "f64":
+		f, _ := n.Num.Float64()
+		return NewFloat(f)
+	case "bool":
+		return NewBool(n.Bool)
+	case "counter":
+		c, _ := n.Num.Int64()
+		return NewCounter(c)
+	case "timestamp":
+		t, _ := n.Num.Int64()
+		return NewTimestamp(t)
+	case "bytes":
+		b, _ := hex.DecodeString(n.Str)
+		return NewBytes(b)
+	default:
+		return NewNull()
+	}
+}
+
+// equal reports whether the node holds the same JSON value as v (a
+// normalized value, see normalizeJSON)
+func (n *jsonNode) equal(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return n.Type == "null"
+	case bool:
+		return n.Type == "bool" && n.Bool == v
+	case string:
+		return (n.Type == "str" || n.Type == "text") && n.Str == v
+	case json.Number:
+		switch n.Type {
+		case "int", "uint", "f64", "counter", "timestamp":
+			return numbersEqual(n.Num, v)
+		}
+		return false
+	case map[string]interface{}:
+		if n.Type != "map" || len(n.Map) != len(v) {
+			return false
+		}
+		for k, x := range v {
+			child, ok := n.Map[k]
+			if !ok || !child.equal(x) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		if n.Type != "list" || len(n.List) != len(v) {
+			return false
+		}
+		for i, x := range v {
+			if !n.List[i].equal(x) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// numbersEqual compares two JSON numbers by value ("1" == "1.0")
+func numbersEqual(a, b json.Number) bool {
+	if a == b {
+		return true
+	}
+	if x, err := a.Int64(); err == nil {
+		if y, err := b.Int64(); err == nil {
+			return x == y
+		}
+	}
+	x, errA := a.Float64()
+	y, errB := b.Float64()
+	return errA == nil && errB == nil && x == y
+}
+
+// normalizeJSON turns any JSON-encodable value into the shapes encoding/json
+// produces (map[string]interface{}, []interface{}, string, json.Number, bool, nil).
+// A json.RawMessage is decoded as-is.
+func normalizeJSON(v interface{}) (interface{}, error) {
+	data, ok := v.(json.RawMessage)
+	if !ok {
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			return nil, fmt.Errorf("value is not JSON-encodable: %w", err)
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var out interface{}
+	if err := dec.Decode(&out); err != nil {
+		return nil, fmt.Errorf("invalid JSON value: %w", err)
+	}
+	return out, nil
+}
+
+// jsonScalar converts a normalized JSON scalar into an Automerge scalar.
+//
+// When the value replaces an existing numeric scalar (hint), its numeric
+// type is kept where the new number fits, so timestamps stay timestamps.
+func jsonScalar(v interface{}, hint *jsonNode) ScalarValue {
+	switch v := v.(type) {
+	case bool:
+		return Boolean(v)
+	case string:
+		return String(v)
+	case json.Number:
+		if hint != nil {
+			switch hint.Type {
+			case "uint":
+				if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+					return Uint(u)
+				}
+			case "timestamp":
+				if i, err := v.Int64(); err == nil {
+					return Timestamp(i)
+				}
+			case "f64":
+				if f, err := v.Float64(); err == nil {
+					return Float(f)
+				}
+			}
+		}
+		if i, err := v.Int64(); err == nil {
+			return Int(i)
+		}
+		f, _ := v.Float64()
+		return Float(f)
+	default:
+		return Null{}
+	}
+}
+
+// prop returns the segment in the form the object exports expect
+// (map key, or decimal list index)
+func (s segment) prop() string {
+	if s.index != nil {
+		return strconv.FormatUint(uint64(*s.index), 10)
+	}
+	return s.key
+}
+
+// indexSegment returns a list index segment that owns its index
+func indexSegment(i int) segment {
+	idx := uint(i)
+	return segment{index: &idx}
+}
+
+// GetJSON returns the value at path as plain Go values: maps, slices,
+// strings (Text objects included), numbers, bools and nil.
+//
+// The reserved root keys (CommentsKey, MarksKey) are left out of the root;
+// read them with their own path.
+//
+// Status: ✅ Implemented
+func (d *Document) GetJSON(ctx context.Context, path Path) (interface{}, error) {
+	node, err := d.jsonNode(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if node.Type == "map" {
+		for k := range node.Map {
+			if reservedKey(path, k) {
+				delete(node.Map, k)
+			}
+		}
+	}
+	return node.value(), nil
+}
+
+// jsonNode reads the typed subtree at path
+func (d *Document) jsonNode(ctx context.Context, path Path) (*jsonNode, error) {
+	p, err := path.objPath()
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := d.runtime.AmObjJSON(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	var node jsonNode
+	if err := json.Unmarshal([]byte(raw), &node); err != nil {
+		return nil, fmt.Errorf("failed to decode document JSON: %w", err)
+	}
+	return &node, nil
+}
+
+// UpdateJSON saves newValue over the subtree at path.
+//
+// Instead of replacing the subtree, the current value is compared with
+// newValue and only the needed operations are emitted:
+//   - map keys are put or deleted individually
+//   - lists are diffed element-wise (insertions, deletions, in-place updates)
+//   - strings stored as Text objects are updated with character splices
+//   - counters are incremented by the difference
+//
+// so concurrent edits by other peers to untouched parts survive a merge.
+//
+// newValue may be any JSON-encodable Go value or a json.RawMessage. The root
+// can only be updated with an object; its reserved keys (CommentsKey,
+// MarksKey) are kept whether newValue has them or not. If path does not exist yet but its
+// parent does, the value is created there (appended, for the index just past
+// the end of a list).
+//
+// The update is all or nothing: if an operation fails partway, the ones
+// already made are rolled back.
+//
+// Status: ✅ Implemented
+func (d *Document) UpdateJSON(ctx context.Context, path Path, newValue interface{}) error {
+	value, err := normalizeJSON(newValue)
+	if err != nil {
+		return err
+	}
+
+	// Close earlier edits so a rollback only discards ours
+	if _, err := d.GetHeads(ctx); err != nil {
+		return err
+	}
+	if err := d.updateJSON(ctx, path, value); err != nil {
+		if _, rbErr := d.Rollback(ctx); rbErr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// updateJSON is UpdateJSON without the rollback
+func (d *Document) updateJSON(ctx context.Context, path Path, value interface{}) error {
+	if path.IsRoot() {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%w: the document root can only be updated with an object", ErrTypeMismatch)
+		}
+		cur, err := d.jsonNode(ctx, path)
+		if err != nil {
+			return err
+		}
+		return d.patchMap(ctx, path, cur, m)
+	}
+
+	cur, err := d.jsonNode(ctx, path)
+	if err != nil {
+		// Allow creating a missing value, as long as the parent exists
+		parent, perr := d.jsonNode(ctx, path.Parent())
+		if perr != nil {
+			return err
+		}
+		// A list grows by inserting, not by putting past its end
+		if seg := path.last(); parent.Type == "list" && seg.index != nil && int(*seg.index) == len(parent.List) {
+			return d.insertJSON(ctx, path.Parent(), len(parent.List), value)
+		}
+		cur = nil
+	}
+	return d.patchValue(ctx, path.Parent(), path.last(), cur, value)
+}
+
+// patchValue updates the value at parent/seg (currently cur, nil if absent) to v
+func (d *Document) patchValue(ctx context.Context, parent Path, seg segment, cur *jsonNode, v interface{}) error {
+	if cur != nil {
+		target := parent.child(seg)
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if cur.Type == "map" {
+				return d.patchMap(ctx, target, cur, v)
+			}
+		case []interface{}:
+			if cur.Type == "list" {
+				return d.patchList(ctx, target, cur.List, v)
+			}
+		case string:
+			if cur.Type == "text" {
+				return d.patchText(ctx, target, cur.Str, v)
+			}
+		case json.Number:
+			if cur.Type == "counter" {
+				if to, err := v.Int64(); err == nil {
+					from, _ := cur.Num.Int64()
+					if to == from {
+						return nil
+					}
+					p, err := parent.objPath()
+					if err != nil {
+						return err
+					}
+					return d.runtime.AmObjIncrement(ctx, p, seg.prop(), to-from)
+				}
+			}
+		}
+		if cur.equal(v) {
+			return nil
+		}
+	}
+	return d.putJSON(ctx, parent, seg, v, cur)
+}
+
+// patchMap updates the map at path from cur to m
+func (d *Document) patchMap(ctx context.Context, path Path, cur *jsonNode, m map[string]interface{}) error {
+	p, err := path.objPath()
+	if err != nil {
+		return err
+	}
+
+	var removed []string
+	for k := range cur.Map {
+		if _, ok := m[k]; !ok && !reservedKey(path, k) {
+			removed = append(removed, k)
+		}
+	}
+	sort.Strings(removed)
+	for _, k := range removed {
+		if err := d.runtime.AmObjDelete(ctx, p, k); err != nil {
+			return err
+		}
+	}
+
+	for _, k := range sortedKeys(m) {
+		if reservedKey(path, k) {
+			continue
+		}
+		if err := d.patchValue(ctx, path, segment{key: k}, cur.Map[k], m[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reservedKey reports whether k is a root key the library keeps its own data
+// under (comments, mark records), which a root update must leave alone
+func reservedKey(path Path, k string) bool {
+	return path.IsRoot() && (k == CommentsKey || k == MarksKey)
+}
+
+// patchList updates the list at path from cur to l.
+//
+// Elements common to both (longest common subsequence) are kept. Between
+// them, old and new elements are paired up and patched in place; the
+// remainder is deleted or inserted.
+func (d *Document) patchList(ctx context.Context, path Path, cur []*jsonNode, l []interface{}) error {
+	p, err := path.objPath()
+	if err != nil {
+		return err
+	}
+
+	pairs := lcsPairs(len(cur), len(l), func(i, j int) bool { return cur[i].equal(l[j]) })
+	pairs = append(pairs, [2]int{len(cur), len(l)})
+
+	// idx is the live position in the document list; everything before it
+	// already matches l[:idx]
+	i, j, idx := 0, 0, 0
+	for _, pair := range pairs {
+		for ; i < pair[0] && j < pair[1]; i, j, idx = i+1, j+1, idx+1 {
+			if err := d.patchValue(ctx, path, indexSegment(idx), cur[i], l[j]); err != nil {
+				return err
+			}
+		}
+		for ; i < pair[0]; i++ {
+			if err := d.runtime.AmObjDelete(ctx, p, strconv.Itoa(idx)); err != nil {
+				return err
+			}
+		}
+		for ; j < pair[1]; j, idx = j+1, idx+1 {
+			if err := d.insertJSON(ctx, path, idx, l[j]); err != nil {
+				return err
+			}
+		}
+		// Skip the matched element itself
+		i, j, idx = i+1, j+1, idx+1
+	}
+	return nil
+}
+
+// patchText updates the Text object at path from one string to another with splices
+func (d *Document) patchText(ctx context.Context, path Path, from, to string) error {
+	p, err := path.objPath()
+	if err != nil {
+		return err
+	}
+	for _, s := range diffText(from, to) {
+		if err := d.runtime.AmObjSpliceText(ctx, p, uint(s.Pos), int64(s.Del), s.Insert); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putJSON writes v at parent/seg, replacing whatever is there (hint)
+func (d *Document) putJSON(ctx context.Context, parent Path, seg segment, v interface{}, hint *jsonNode) error {
+	p, err := parent.objPath()
+	if err != nil {
+		return err
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if err := d.runtime.AmObjPutObject(ctx, p, seg.prop(), ObjTypeMap.tag()); err != nil {
+			return err
+		}
+		return d.fillMap(ctx, parent.child(seg), v)
+	case []interface{}:
+		if err := d.runtime.AmObjPutObject(ctx, p, seg.prop(), ObjTypeList.tag()); err != nil {
+			return err
+		}
+		return d.fillList(ctx, parent.child(seg), v)
+	default:
+		kind, data := encodeScalar(jsonScalar(v, hint))
+		return d.runtime.AmObjPut(ctx, p, seg.prop(), kind, data)
+	}
+}
+
+// insertJSON inserts v at index in the list at path
+func (d *Document) insertJSON(ctx context.Context, path Path, index int, v interface{}) error {
+	p, err := path.objPath()
+	if err != nil {
+		return err
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if err := d.runtime.AmObjInsertObject(ctx, p, uint(index), ObjTypeMap.tag()); err != nil {
+			return err
+		}
+		return d.fillMap(ctx, path.child(indexSegment(index)), v)
+	case []interface{}:
+		if err := d.runtime.AmObjInsertObject(ctx, p, uint(index), ObjTypeList.tag()); err != nil {
+			return err
+		}
+		return d.fillList(ctx, path.child(indexSegment(index)), v)
+	default:
+		kind, data := encodeScalar(jsonScalar(v, nil))
+		return d.runtime.AmObjInsert(ctx, p, uint(index), kind, data)
+	}
+}
+
+// fillMap populates a freshly created map
+func (d *Document) fillMap(ctx context.Context, path Path, m map[string]interface{}) error {
+	for _, k := range sortedKeys(m) {
+		if err := d.putJSON(ctx, path, segment{key: k}, m[k], nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fillList populates a freshly created list
+func (d *Document) fillList(ctx context.Context, path Path, l []interface{}) error {
+	for i, v := range l {
+		if err := d.insertJSON(ctx, path, i, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// textSplice is one splice produced by diffText. Splices are applied in
+// order; Pos refers to the text as left by the previous splices.
+type textSplice struct {
+	Pos    int
+	Del    int
+	Insert string
+}
+
+// diffText computes the character splices that turn from into to.
+//
+// Unchanged characters are never deleted and re-inserted, so concurrent
+// edits elsewhere in the text (and cursors/marks anchored there) survive.
+func diffText(from, to string) []textSplice {
+	a, b := []rune(from), []rune(to)
+	pairs := lcsPairs(len(a), len(b), func(i, j int) bool { return a[i] == b[j] })
+	pairs = append(pairs, [2]int{len(a), len(b)})
+
+	var splices []textSplice
+	i, j := 0, 0
+	for _, pair := range pairs {
+		if pair[0] > i || pair[1] > j {
+			// Everything before j already matches to, so j is the live position
+			splices = append(splices, textSplice{
+				Pos:    j,
+				Del:    pair[0] - i,
+				Insert: string(b[j:pair[1]]),
+			})
+		}
+		i, j = pair[0]+1, pair[1]+1
+	}
+	return splices
+}
+
+// lcsPairs returns the index pairs (i, j) of a longest common subsequence of
+// two sequences of length n and m, in increasing order.
+//
+// The common prefix and suffix are matched directly. If the remaining middle
+// is larger than maxLCSCells, nothing in it is matched.
+func lcsPairs(n, m int, eq func(i, j int) bool) [][2]int {
+	var pairs [][2]int
+
+	pre := 0
+	for pre < n && pre < m && eq(pre, pre) {
+		pairs = append(pairs, [2]int{pre, pre})
+		pre++
+	}
+	suf := 0
+	for suf < n-pre && suf < m-pre && eq(n-1-suf, m-1-suf) {
+		suf++
+	}
+
+	rows, cols := n-pre-suf, m-pre-suf
+	if rows > 0 && cols > 0 && rows*cols <= maxLCSCells {
+		// table[i*w+j] = LCS length of the middles from i and j onwards
+		w := cols + 1
+		table := make([]int32, (rows+1)*w)
+		for i := rows - 1; i >= 0; i-- {
+			for j := cols - 1; j >= 0; j-- {
+				switch {
+				case eq(pre+i, pre+j):
+					table[i*w+j] = table[(i+1)*w+j+1] + 1
+				case table[(i+1)*w+j] >= table[i*w+j+1]:
+					table[i*w+j] = table[(i+1)*w+j]
+				default:
+					table[i*w+j] = table[i*w+j+1]
+				}
+			}
+		}
+
+		for i, j := 0, 0; i < rows && j < cols; {
+			switch {
+			case eq(pre+i, pre+j):
+				pairs = append(pairs, [2]int{pre + i, pre + j})
+				i, j = i+1, j+1
+			case table[(i+1)*w+j] >= table[i*w+j+1]:
+				i++
+			default:
+				j++
+			}
+		}
+	}
+
+	for k := suf; k > 0; k-- {
+		pairs = append(pairs, [2]int{n - k, m - k})
+	}
+	return pairs
+}
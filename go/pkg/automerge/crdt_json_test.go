@@ -0,0 +1,264 @@
+package automerge
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// applySplices applies diffText output to s
+func applySplices(s string, splices []textSplice) string {
+	r := []rune(s)
+	for _, sp := range splices {
+		tail := append([]rune(sp.Insert), r[sp.Pos+sp.Del:]...)
+		r = append(r[:sp.Pos], tail...)
+	}
+	return string(r)
+}
+
+// TestDiffText tests that text diffs reproduce the target and keep unchanged text
+func TestDiffText(t *testing.T) {
+	tests := []struct {
+		name      string
+		from, to  string
+		maxDelete int // upper bound on deleted characters (0 = pure insertion)
+	}{
+		{"identical", "Hello", "Hello", 0},
+		{"append", "Hello", "Hello, world", 0},
+		{"prepend", "world", "Hello world", 0},
+		{"insert middle", "Hllo", "Hello", 0},
+		{"delete middle", "Hello", "Hllo", 1},
+		{"replace word", "The quick fox", "The slow fox", 5},
+		{"two edits", "abc def ghi", "abX def ghY", 2},
+		{"empty to text", "", "abc", 0},
+		{"text to empty", "abc", "", 3},
+		{"unicode", "héllo 世界", "héllo, 世界!", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			splices := diffText(tt.from, tt.to)
+			if got := applySplices(tt.from, splices); got != tt.to {
+				t.Fatalf("applying splices gave %q, want %q (splices %+v)", got, tt.to, splices)
+			}
+
+			deleted := 0
+			for _, sp := range splices {
+				deleted += sp.Del
+			}
+			if deleted > tt.maxDelete {
+				t.Errorf("deleted %d characters, want at most %d (splices %+v)", deleted, tt.maxDelete, splices)
+			}
+		})
+	}
+}
+
+// TestLCSPairs tests the common subsequence used by list and text diffs
+func TestLCSPairs(t *testing.T) {
+	a := []string{"a", "b", "c", "d"}
+	b := []string{"a", "x", "c", "d", "e"}
+
+	pairs := lcsPairs(len(a), len(b), func(i, j int) bool { return a[i] == b[j] })
+	want := [][2]int{{0, 0}, {2, 2}, {3, 3}}
+	if !reflect.DeepEqual(pairs, want) {
+		t.Errorf("lcsPairs = %v, want %v", pairs, want)
+	}
+}
+
+// TestUpdateJSON_Nested tests creating and updating a nested subtree
+func TestUpdateJSON_Nested(t *testing.T) {
+	ctx := context.Background()
+	doc, err := NewWithWASM(ctx, TestWASMPath)
+	if err != nil {
+		t.Fatalf("Failed to create document: %v", err)
+	}
+	defer doc.Close(ctx)
+
+	path := Root().Get("profile")
+	initial := map[string]interface{}{
+		"name": "Alice",
+		"age":  30,
+		"tags": []string{"a", "b", "c"},
+		"address": map[string]interface{}{
+			"city": "Berlin",
+		},
+	}
+	if err := doc.UpdateJSON(ctx, path, initial); err != nil {
+		t.Fatalf("UpdateJSON (create) failed: %v", err)
+	}
+
+	updated := json.RawMessage(`{"name":"Alice","age":31,"tags":["a","c","d"],"address":{"city":"Paris","zip":"75001"}}`)
+	if err := doc.UpdateJSON(ctx, path, updated); err != nil {
+		t.Fatalf("UpdateJSON (update) failed: %v", err)
+	}
+
+	got, err := doc.GetJSON(ctx, path)
+	if err != nil {
+		t.Fatalf("GetJSON failed: %v", err)
+	}
+	want := map[string]interface{}{
+		"name": "Alice",
+		"age":  int64(31),
+		"tags": []interface{}{"a", "c", "d"},
+		"address": map[string]interface{}{
+			"city": "Paris",
+			"zip":  "75001",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetJSON = %#v, want %#v", got, want)
+	}
+}
+
+// TestUpdateJSON_KeepsText tests that a Text field is spliced, not replaced
+func TestUpdateJSON_KeepsText(t *testing.T) {
+	ctx := context.Background()
+	doc, err := NewWithWASM(ctx, TestWASMPath)
+	if err != nil {
+		t.Fatalf("Failed to create document: %v", err)
+	}
+	defer doc.Close(ctx)
+
+	content := Root().Get("content")
+	if err := doc.SpliceText(ctx, content, 0, 0, "Hello world"); err != nil {
+		t.Fatalf("SpliceText failed: %v", err)
+	}
+
+	if err := doc.UpdateJSON(ctx, content, "Hello brave world"); err != nil {
+		t.Fatalf("UpdateJSON failed: %v", err)
+	}
+
+	text, err := doc.GetText(ctx, content)
+	if err != nil {
+		t.Fatalf("GetText failed (content should still be a Text object): %v", err)
+	}
+	if text != "Hello brave world" {
+		t.Errorf("GetText = %q, want %q", text, "Hello brave world")
+	}
+}
+
+// TestUpdateJSON_ConcurrentFields tests that two peers saving the whole
+// object with non-overlapping changes both keep their edits after merge
+func TestUpdateJSON_ConcurrentFields(t *testing.T) {
+	ctx := context.Background()
+	doc1, err := NewWithWASM(ctx, TestWASMPath)
+	if err != nil {
+		t.Fatalf("Failed to create document: %v", err)
+	}
+	defer doc1.Close(ctx)
+
+	base := map[string]interface{}{
+		"content": "The quick fox",
+		"meta":    map[string]interface{}{"title": "Draft", "rev": 1},
+	}
+	if err := doc1.UpdateJSON(ctx, Root(), base); err != nil {
+		t.Fatalf("UpdateJSON (base) failed: %v", err)
+	}
+
+	data, err := doc1.Save(ctx)
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	doc2, err := LoadWithWASM(ctx, data, TestWASMPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	defer doc2.Close(ctx)
+
+	// Peer 1 edits the text, peer 2 edits the title; each saves the whole object
+	if err := doc1.UpdateJSON(ctx, Root(), map[string]interface{}{
+		"content": "The quick brown fox",
+		"meta":    map[string]interface{}{"title": "Draft", "rev": 1},
+	}); err != nil {
+		t.Fatalf("UpdateJSON (peer 1) failed: %v", err)
+	}
+	if err := doc2.UpdateJSON(ctx, Root(), map[string]interface{}{
+		"content": "The quick fox jumps",
+		"meta":    map[string]interface{}{"title": "Final", "rev": 1},
+	}); err != nil {
+		t.Fatalf("UpdateJSON (peer 2) failed: %v", err)
+	}
+
+	if err := doc1.Merge(ctx, doc2); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+
+	got, err := doc1.GetJSON(ctx, Root())
+	if err != nil {
+		t.Fatalf("GetJSON failed: %v", err)
+	}
+	want := map[string]interface{}{
+		"content": "The quick brown fox jumps",
+		"meta":    map[string]interface{}{"title": "Final", "rev": int64(1)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("merged = %#v, want %#v", got, want)
+	}
+}
+
+// TestUpdateJSON_Append tests that a value at the index just past the end
+// of a list is appended, and that a failed update changes nothing
+func TestUpdateJSON_Append(t *testing.T) {
+	ctx := context.Background()
+	doc, err := NewWithWASM(ctx, TestWASMPath)
+	if err != nil {
+		t.Fatalf("Failed to create document: %v", err)
+	}
+	defer doc.Close(ctx)
+
+	items := Root().Get("items")
+	if err := doc.UpdateJSON(ctx, items, []interface{}{"a"}); err != nil {
+		t.Fatalf("UpdateJSON (create) failed: %v", err)
+	}
+	if err := doc.UpdateJSON(ctx, items.Index(1), map[string]interface{}{"name": "b"}); err != nil {
+		t.Fatalf("UpdateJSON (append) failed: %v", err)
+	}
+	if err := doc.UpdateJSON(ctx, items.Index(5), "f"); err == nil {
+		t.Error("UpdateJSON past the end of a list succeeded")
+	}
+
+	got, err := doc.GetJSON(ctx, items)
+	if err != nil {
+		t.Fatalf("GetJSON failed: %v", err)
+	}
+	want := []interface{}{"a", map[string]interface{}{"name": "b"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetJSON = %#v, want %#v", got, want)
+	}
+}
+
+// TestUpdateJSON_KeepsReservedKeys tests that a root update neither deletes
+// nor overwrites comments
+func TestUpdateJSON_KeepsReservedKeys(t *testing.T) {
+	ctx := context.Background()
+	doc, err := NewWithWASM(ctx, TestWASMPath)
+	if err != nil {
+		t.Fatalf("Failed to create document: %v", err)
+	}
+	defer doc.Close(ctx)
+
+	content := Root().Get("content")
+	if err := doc.SpliceText(ctx, content, 0, 0, "Hello World"); err != nil {
+		t.Fatalf("SpliceText failed: %v", err)
+	}
+	if _, err := doc.AddComment(ctx, content, 6, 11, "alice", "Which one?"); err != nil {
+		t.Fatalf("AddComment failed: %v", err)
+	}
+
+	// Neither a value without the reserved key nor one that sets it touches it
+	if err := doc.UpdateJSON(ctx, Root(), map[string]interface{}{"content": "Hello World"}); err != nil {
+		t.Fatalf("UpdateJSON failed: %v", err)
+	}
+	if err := doc.UpdateJSON(ctx, Root(), map[string]interface{}{"content": "Hello World", CommentsKey: "gone"}); err != nil {
+		t.Fatalf("UpdateJSON failed: %v", err)
+	}
+
+	comments, err := doc.Comments(ctx)
+	if err != nil {
+		t.Fatalf("Comments failed: %v", err)
+	}
+	if len(comments) != 1 || comments[0].Body != "Which one?" || comments[0].Orphaned {
+		t.Errorf("comments after a root update = %+v", comments)
+	}
+}
@@ -28,6 +28,11 @@
 // - This layer is pure CRDT - no state, no mutex, no persistence
 // - All state management happens in Layer 5 (pkg/server)
 // - Marks are CRDT-aware (concurrent formatting merges correctly)
+// - Automerge doesn't report a mark's expand setting, so each mark is
+//   recorded with it under the reserved ROOT._marks map (MarksKey); records
+//   are pruned when the marks of their text change (Mark, Unmark)
+// - ROOT._marks is hidden from GetJSON and kept by a root UpdateJSON; create
+//   it up front (EnsureMarks) on shared documents, as for comments
 // ==============================================================================
 
 package automerge
@@ -38,6 +43,10 @@ import (
 	"fmt"
 )
 
+// MarksKey is the reserved root key where marks are recorded with their
+// expand setting
+const MarksKey = "_marks"
+
 // Rich Text Operations - M2 Milestone
 //
 // Marks allow you to add formatting (bold, italic, links, etc.) to text
@@ -55,31 +64,21 @@ import (
 //       End: 5,
 //   }, ExpandBoth)
 //
-// Status: ✅ Implemented (current implementation uses ROOT["content"] text object)
+// Status: ✅ Implemented
 func (d *Document) Mark(ctx context.Context, path Path, mark Mark, expand ExpandMark) error {
 	if d.runtime == nil {
 		return fmt.Errorf("document not initialized")
 	}
 
-	// Convert Value to string
-	var valueStr string
-	if s, ok := mark.Value.AsString(); ok {
-		valueStr = s
-	} else if b, ok := mark.Value.AsBool(); ok {
-		if b {
-			valueStr = "true"
-		} else {
-			valueStr = "false"
-		}
-	} else if i, ok := mark.Value.AsInt(); ok {
-		valueStr = fmt.Sprintf("%d", i)
-	} else if f, ok := mark.Value.AsFloat(); ok {
-		valueStr = fmt.Sprintf("%f", f)
-	} else {
-		valueStr = fmt.Sprintf("%v", mark.Value)
+	kind, value := encodeScalar(mark.Value.Scalar())
+	if d.isContentPath(path) {
+		return d.runtime.AmMark(ctx, mark.Name, kind, value, mark.Start, mark.End, uint8(expand))
 	}
-
-	return d.runtime.AmMark(ctx, mark.Name, valueStr, mark.Start, mark.End, uint8(expand))
+	p, err := path.objPath()
+	if err != nil {
+		return err
+	}
+	return d.runtime.AmObjMark(ctx, p, mark.Name, kind, value, mark.Start, mark.End, uint8(expand))
 }
 
 // Unmark removes formatting from a range of text.
@@ -90,7 +89,33 @@ func (d *Document) Unmark(ctx context.Context, path Path, name string, start, en
 		return fmt.Errorf("document not initialized")
 	}
 
-	return d.runtime.AmUnmark(ctx, name, start, end, uint8(expand))
+	if d.isContentPath(path) {
+		return d.runtime.AmUnmark(ctx, name, start, end, uint8(expand))
+	}
+	p, err := path.objPath()
+	if err != nil {
+		return err
+	}
+	return d.runtime.AmObjUnmark(ctx, p, name, start, end, uint8(expand))
+}
+
+// EnsureMarks creates the (empty) map marks are recorded in if the document
+// has none.
+//
+// Like EnsureComments, call it once when a shared document is created,
+// before peers start marking, so they all record their marks in the same
+// map. Layer 5 does so for every new document it creates.
+//
+// Status: ✅ Implemented
+func (d *Document) EnsureMarks(ctx context.Context) error {
+	if d.runtime == nil {
+		return fmt.Errorf("document not initialized")
+	}
+	ok, err := d.hasRootKey(ctx, MarksKey)
+	if err != nil || ok {
+		return err
+	}
+	return d.UpdateJSON(ctx, Root().Get(MarksKey), map[string]interface{}{})
 }
 
 // GetMarks retrieves all marks at a specific position.
@@ -101,7 +126,17 @@ func (d *Document) GetMarks(ctx context.Context, path Path, index uint) ([]Mark,
 		return nil, fmt.Errorf("document not initialized")
 	}
 
-	count, err := d.runtime.AmGetMarksCount(ctx, index)
+	var count uint32
+	var err error
+	if d.isContentPath(path) {
+		count, err = d.runtime.AmGetMarksCount(ctx, index)
+	} else {
+		var p string
+		if p, err = path.objPath(); err != nil {
+			return nil, err
+		}
+		count, err = d.runtime.AmObjGetMarksCount(ctx, p, index)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get marks count: %w", err)
 	}
@@ -135,7 +170,17 @@ func (d *Document) Marks(ctx context.Context, path Path) ([]Mark, error) {
 		return nil, fmt.Errorf("document not initialized")
 	}
 
-	marksJSON, err := d.runtime.AmMarks(ctx)
+	var marksJSON string
+	var err error
+	if d.isContentPath(path) {
+		marksJSON, err = d.runtime.AmMarks(ctx)
+	} else {
+		var p string
+		if p, err = path.objPath(); err != nil {
+			return nil, err
+		}
+		marksJSON, err = d.runtime.AmObjMarks(ctx, p)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get marks: %w", err)
 	}
@@ -146,10 +191,11 @@ func (d *Document) Marks(ctx context.Context, path Path) ([]Mark, error) {
 
 	// Parse JSON
 	var rawMarks []struct {
-		Name  string `json:"name"`
-		Value string `json:"value"`
-		Start uint   `json:"start"`
-		End   uint   `json:"end"`
+		Name   string    `json:"name"`
+		Value  *jsonNode `json:"value"`
+		Start  uint      `json:"start"`
+		End    uint      `json:"end"`
+		Expand uint8     `json:"expand"`
 	}
 
 	if err := json.Unmarshal([]byte(marksJSON), &rawMarks); err != nil {
@@ -159,39 +205,202 @@ func (d *Document) Marks(ctx context.Context, path Path) ([]Mark, error) {
 	// Convert to Mark structs
 	marks := make([]Mark, len(rawMarks))
 	for i, raw := range rawMarks {
+		value := NewNull()
+		if raw.Value != nil {
+			value = raw.Value.scalar()
+		}
 		marks[i] = Mark{
-			Name:  raw.Name,
-			Value: NewString(raw.Value), // Convert string to Value
-			Start: raw.Start,
-			End:   raw.End,
+			Name:   raw.Name,
+			Value:  value,
+			Start:  raw.Start,
+			End:    raw.End,
+			Expand: ExpandMark(raw.Expand),
 		}
 	}
 
 	return marks, nil
 }
 
+// Span is a run of text sharing the same active marks, or a block marker.
+//
+// Renderers walk the spans in order: text spans carry the characters and
+// their formatting, block spans start a new paragraph, heading, list item...
+type Span struct {
+	Text  string           // Characters in the span (empty for blocks)
+	Marks map[string]Value // Active marks by name (empty if unformatted)
+	Block *Block           // Block marker (nil for text spans)
+}
+
+// Block describes a block marker: the start of a paragraph, heading, list
+// item, code block... and the text up to the next marker belongs to it.
+//
+// The fields follow the Automerge block convention (a map with "type",
+// "parents" and "attrs"), so blocks interoperate with other Automerge clients.
+type Block struct {
+	Type    string                 // e.g. "paragraph", "heading", "ordered-list-item"
+	Parents []string               // Enclosing block types, outermost first
+	Attrs   map[string]interface{} // Block attributes (e.g. {"level": 2})
+}
+
+// spanJSON is the wire format produced by am_spans
+type spanJSON struct {
+	Text  string               `json:"text"`
+	Marks map[string]*jsonNode `json:"marks"`
+	Block *jsonNode            `json:"block"`
+}
+
+// blockFromNode converts a block marker map into a Block
+func blockFromNode(n *jsonNode) *Block {
+	block := &Block{Attrs: map[string]interface{}{}}
+	if n == nil || n.Type != "map" {
+		return block
+	}
+	if t := n.Map["type"]; t != nil {
+		block.Type, _ = t.value().(string)
+	}
+	if p := n.Map["parents"]; p != nil && p.Type == "list" {
+		for _, parent := range p.List {
+			if s, ok := parent.value().(string); ok {
+				block.Parents = append(block.Parents, s)
+			}
+		}
+	}
+	if a := n.Map["attrs"]; a != nil && a.Type == "map" {
+		block.Attrs = a.value().(map[string]interface{})
+	}
+	return block
+}
+
+// Spans returns the text at path split into spans, each carrying its active
+// marks, with block markers as spans of their own.
+//
+// Example:
+//
+//	spans, _ := doc.Spans(ctx, automerge.Root().Get("content"))
+//	for _, s := range spans {
+//	    if _, bold := s.Marks["bold"]; bold {
+//	        fmt.Printf("<b>%s</b>", s.Text)
+//	    }
+//	}
+//
+// Status: ✅ Implemented
+func (d *Document) Spans(ctx context.Context, path Path) ([]Span, error) {
+	if d.runtime == nil {
+		return nil, fmt.Errorf("document not initialized")
+	}
+	p, err := path.objPath()
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := d.runtime.AmSpans(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	var wire []spanJSON
+	if err := json.Unmarshal([]byte(raw), &wire); err != nil {
+		return nil, fmt.Errorf("failed to parse spans JSON: %w", err)
+	}
+
+	spans := make([]Span, len(wire))
+	for i, w := range wire {
+		spans[i].Marks = make(map[string]Value, len(w.Marks))
+		if w.Block != nil {
+			spans[i].Block = blockFromNode(w.Block)
+			continue
+		}
+		spans[i].Text = w.Text
+		for name, node := range w.Marks {
+			spans[i].Marks[name] = node.scalar()
+		}
+	}
+	return spans, nil
+}
+
+// blockJSON is the marker map written for a Block
+func (b Block) blockJSON() map[string]interface{} {
+	parents := make([]interface{}, len(b.Parents))
+	for i, p := range b.Parents {
+		parents[i] = p
+	}
+	attrs := b.Attrs
+	if attrs == nil {
+		attrs = map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"type":    b.Type,
+		"parents": parents,
+		"attrs":   attrs,
+	}
+}
+
 // SplitBlock inserts a block marker (e.g., paragraph break) at an index.
 //
+// The text from the marker up to the next marker belongs to the new block.
+// Markers occupy one position in the text, so indexes after it shift by one.
 // Returns the path to the newly created block marker object.
 //
-// Status: ❌ Not implemented (requires M4)
-func (d *Document) SplitBlock(ctx context.Context, path Path, index uint) (Path, error) {
-	return Path{}, &NotImplementedError{
-		Feature:   "SplitBlock",
-		Milestone: "M4",
-		Message:   "Requires am_split_block WASI export",
+// Example:
+//
+//	// "TitleBody" → heading "Title", paragraph "Body"
+//	doc.SplitBlock(ctx, path, 0, Block{Type: "heading", Attrs: map[string]interface{}{"level": 1}})
+//	doc.SplitBlock(ctx, path, 6, Block{Type: "paragraph"})
+//
+// Status: ✅ Implemented
+func (d *Document) SplitBlock(ctx context.Context, path Path, index uint, block Block) (Path, error) {
+	if d.runtime == nil {
+		return Path{}, fmt.Errorf("document not initialized")
+	}
+	p, err := path.objPath()
+	if err != nil {
+		return Path{}, err
+	}
+
+	if err := d.runtime.AmSplitBlock(ctx, p, index); err != nil {
+		return Path{}, err
+	}
+	marker := path.Index(index)
+	if err := d.UpdateJSON(ctx, marker, block.blockJSON()); err != nil {
+		return Path{}, err
+	}
+	return marker, nil
+}
+
+// UpdateBlock changes the type, parents and attributes of the block marker
+// at an index (e.g. turning a paragraph into a heading).
+//
+// Status: ✅ Implemented
+func (d *Document) UpdateBlock(ctx context.Context, path Path, index uint, block Block) error {
+	if d.runtime == nil {
+		return fmt.Errorf("document not initialized")
+	}
+
+	marker := path.Index(index)
+	node, err := d.jsonNode(ctx, marker)
+	if err != nil {
+		return err
+	}
+	if node.Type != "map" {
+		return fmt.Errorf("%w: no block marker at index %d", ErrTypeMismatch, index)
 	}
+	return d.UpdateJSON(ctx, marker, block.blockJSON())
 }
 
-// JoinBlock removes a block marker at an index.
+// JoinBlock removes a block marker at an index, merging its text into the
+// previous block.
 //
-// Status: ❌ Not implemented (requires M4)
+// Status: ✅ Implemented
 func (d *Document) JoinBlock(ctx context.Context, path Path, index uint) error {
-	return &NotImplementedError{
-		Feature:   "JoinBlock",
-		Milestone: "M4",
-		Message:   "Requires am_join_block WASI export",
+	if d.runtime == nil {
+		return fmt.Errorf("document not initialized")
+	}
+	p, err := path.objPath()
+	if err != nil {
+		return err
 	}
+
+	return d.runtime.AmJoinBlock(ctx, p, index)
 }
 
 // ExpandMark controls how marks expand when text is inserted at boundaries
@@ -203,3 +412,105 @@ const (
 	ExpandAfter  ExpandMark = 2 // Expand when inserting after
 	ExpandBoth   ExpandMark = 3 // Expand in both directions
 )
+
+// PatchAction tells what a Patch does to a text object
+type PatchAction string
+
+const (
+	PatchInsert PatchAction = "insert" // Text inserted at Index (with Marks)
+	PatchDelete PatchAction = "delete" // Length positions deleted at Index
+	PatchBlock  PatchAction = "block"  // Block marker inserted (or replaced) at Index
+	PatchMark   PatchAction = "mark"   // Mark set over Mark.Start..Mark.End (null value = removed)
+)
+
+// Patch is one edit to a text object, as reported by TextPatches.
+//
+// Patches apply in order: each Index refers to the text with the previous
+// patches already applied, so replaying them on the before text yields
+// the after text.
+type Patch struct {
+	Action  PatchAction
+	Index   uint             // Position of the edit (insert, delete, block)
+	Text    string           // Inserted characters (insert)
+	Marks   map[string]Value // Marks on the inserted characters (insert)
+	Length  uint             // Number of positions deleted (delete)
+	Block   *Block           // Marker content (block)
+	Replace bool             // The existing marker at Index changed (block)
+	Mark    Mark             // Mark name, value and range (mark)
+}
+
+// patchJSON is the wire format produced by am_text_patches
+type patchJSON struct {
+	Action  string               `json:"action"`
+	Index   uint                 `json:"index"`
+	Text    string               `json:"text"`
+	Marks   map[string]*jsonNode `json:"marks"`
+	Length  uint                 `json:"length"`
+	Block   *jsonNode            `json:"block"`
+	Replace bool                 `json:"replace"`
+	Name    string               `json:"name"`
+	Value   *jsonNode            `json:"value"`
+	Start   uint                 `json:"start"`
+	End     uint                 `json:"end"`
+}
+
+// TextPatches returns the edits made to the text at path between the before
+// and after heads, in the order they apply.
+//
+// Use it to turn new changes (local or merged from peers) into incremental
+// updates for editors: record the heads, apply changes, then ask for the
+// patches since the recorded heads.
+//
+// Example:
+//
+//	before, _ := doc.GetHeads(ctx)
+//	// ... apply changes ...
+//	after, _ := doc.GetHeads(ctx)
+//	patches, _ := doc.TextPatches(ctx, automerge.Root().Get("content"), before, after)
+//
+// Status: ✅ Implemented
+func (d *Document) TextPatches(ctx context.Context, path Path, before, after []ChangeHash) ([]Patch, error) {
+	if d.runtime == nil {
+		return nil, fmt.Errorf("document not initialized")
+	}
+	p, err := path.objPath()
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := d.runtime.AmTextPatches(ctx, p, hashesToBytes(before), hashesToBytes(after))
+	if err != nil {
+		return nil, err
+	}
+
+	var wire []patchJSON
+	if err := json.Unmarshal([]byte(raw), &wire); err != nil {
+		return nil, fmt.Errorf("failed to parse patches JSON: %w", err)
+	}
+
+	patches := make([]Patch, len(wire))
+	for i, w := range wire {
+		patch := Patch{Action: PatchAction(w.Action), Index: w.Index}
+		switch patch.Action {
+		case PatchInsert:
+			patch.Text = w.Text
+			patch.Marks = make(map[string]Value, len(w.Marks))
+			for name, node := range w.Marks {
+				patch.Marks[name] = node.scalar()
+			}
+		case PatchDelete:
+			patch.Length = w.Length
+		case PatchBlock:
+			patch.Block = blockFromNode(w.Block)
+			patch.Replace = w.Replace
+		case PatchMark:
+			patch.Index = w.Start
+			patch.Mark = Mark{Name: w.Name, Value: NewNull(), Start: w.Start, End: w.End}
+			if w.Value != nil {
+				patch.Mark.Value = w.Value.scalar()
+			}
+		}
+		patches[i] = patch
+	}
+	return patches, nil
+}
@@ -2,6 +2,8 @@ package automerge
 
 import (
 	"context"
+	"encoding/json"
+	"reflect"
 	"testing"
 )
 
@@ -104,6 +106,54 @@ func TestDocument_Unmark(t *testing.T) {
 	t.Log("Successfully unmarked portion of text")
 }
 
+// TestDocument_MarkRecords tests that mark records stay out of the root's
+// JSON and go away with the marks they describe
+func TestDocument_MarkRecords(t *testing.T) {
+	ctx := context.Background()
+	doc, err := NewWithWASM(ctx, TestWASMPath)
+	if err != nil {
+		t.Fatalf("failed to create document: %v", err)
+	}
+	defer doc.Close(ctx)
+
+	content := Root().Get("content")
+	if err := doc.EnsureMarks(ctx); err != nil {
+		t.Fatalf("EnsureMarks failed: %v", err)
+	}
+	if err := doc.SpliceText(ctx, content, 0, 0, "Hello World"); err != nil {
+		t.Fatalf("failed to add text: %v", err)
+	}
+	if err := doc.Mark(ctx, content, Mark{Name: "bold", Value: NewBool(true), Start: 0, End: 5}, ExpandAfter); err != nil {
+		t.Fatalf("failed to mark text: %v", err)
+	}
+
+	records := func() int {
+		t.Helper()
+		v, err := doc.GetJSON(ctx, Root().Get(MarksKey))
+		if err != nil {
+			t.Fatalf("GetJSON(%s) failed: %v", MarksKey, err)
+		}
+		return len(v.(map[string]interface{}))
+	}
+	if n := records(); n != 1 {
+		t.Errorf("%d mark records, want 1", n)
+	}
+	root, err := doc.GetJSON(ctx, Root())
+	if err != nil {
+		t.Fatalf("GetJSON failed: %v", err)
+	}
+	if _, ok := root.(map[string]interface{})[MarksKey]; ok {
+		t.Errorf("GetJSON(ROOT) = %v, want no %s", root, MarksKey)
+	}
+
+	if err := doc.Unmark(ctx, content, "bold", 0, 5, ExpandNone); err != nil {
+		t.Fatalf("failed to unmark text: %v", err)
+	}
+	if n := records(); n != 0 {
+		t.Errorf("%d mark records after unmarking, want 0", n)
+	}
+}
+
 func TestDocument_Marks(t *testing.T) {
 	ctx := context.Background()
 	doc, err := NewWithWASM(ctx, TestWASMPath)
@@ -342,3 +392,264 @@ func TestDocument_Mark_SaveLoad(t *testing.T) {
 
 	t.Log("Marks successfully persisted through save/load")
 }
+
+func TestBlockFromNode(t *testing.T) {
+	var node jsonNode
+	raw := `{"t":"map","v":{"type":{"t":"str","v":"heading"},"parents":{"t":"list","v":[{"t":"str","v":"blockquote"}]},"attrs":{"t":"map","v":{"level":{"t":"int","v":2}}}}}`
+	if err := json.Unmarshal([]byte(raw), &node); err != nil {
+		t.Fatalf("failed to decode node: %v", err)
+	}
+
+	block := blockFromNode(&node)
+	if block.Type != "heading" {
+		t.Errorf("Type = %q, want heading", block.Type)
+	}
+	if !reflect.DeepEqual(block.Parents, []string{"blockquote"}) {
+		t.Errorf("Parents = %v", block.Parents)
+	}
+	if block.Attrs["level"] != int64(2) {
+		t.Errorf("Attrs = %v", block.Attrs)
+	}
+}
+
+func TestDocument_Spans(t *testing.T) {
+	ctx := context.Background()
+	doc, err := NewWithWASM(ctx, TestWASMPath)
+	if err != nil {
+		t.Fatalf("failed to create document: %v", err)
+	}
+	defer doc.Close(ctx)
+
+	path := Root().Get("content")
+	if err := doc.SpliceText(ctx, path, 0, 0, "Hello big World"); err != nil {
+		t.Fatalf("failed to add text: %v", err)
+	}
+	if err := doc.Mark(ctx, path, Mark{Name: "bold", Value: NewBool(true), Start: 0, End: 9}, ExpandNone); err != nil {
+		t.Fatalf("failed to mark text: %v", err)
+	}
+	if err := doc.Mark(ctx, path, Mark{Name: "italic", Value: NewBool(true), Start: 6, End: 15}, ExpandNone); err != nil {
+		t.Fatalf("failed to mark text: %v", err)
+	}
+
+	spans, err := doc.Spans(ctx, path)
+	if err != nil {
+		t.Fatalf("Spans failed: %v", err)
+	}
+
+	type want struct {
+		text  string
+		marks []string
+	}
+	wants := []want{
+		{"Hello ", []string{"bold"}},
+		{"big", []string{"bold", "italic"}},
+		{" World", []string{"italic"}},
+	}
+	if len(spans) != len(wants) {
+		t.Fatalf("got %d spans, want %d: %+v", len(spans), len(wants), spans)
+	}
+	for i, w := range wants {
+		if spans[i].Text != w.text || spans[i].Block != nil {
+			t.Errorf("span %d = %+v, want text %q", i, spans[i], w.text)
+		}
+		if len(spans[i].Marks) != len(w.marks) {
+			t.Errorf("span %d marks = %v, want %v", i, spans[i].Marks, w.marks)
+		}
+		for _, name := range w.marks {
+			if _, ok := spans[i].Marks[name]; !ok {
+				t.Errorf("span %d missing mark %q", i, name)
+			}
+		}
+	}
+}
+
+func TestDocument_Blocks(t *testing.T) {
+	ctx := context.Background()
+	doc, err := NewWithWASM(ctx, TestWASMPath)
+	if err != nil {
+		t.Fatalf("failed to create document: %v", err)
+	}
+	defer doc.Close(ctx)
+
+	path := Root().Get("content")
+	if err := doc.SpliceText(ctx, path, 0, 0, "TitleBody"); err != nil {
+		t.Fatalf("failed to add text: %v", err)
+	}
+	heading := Block{Type: "heading", Attrs: map[string]interface{}{"level": 1}}
+	if _, err := doc.SplitBlock(ctx, path, 0, heading); err != nil {
+		t.Fatalf("SplitBlock failed: %v", err)
+	}
+	// "Title" now spans 1-5, so "Body" starts at 6
+	if _, err := doc.SplitBlock(ctx, path, 6, Block{Type: "paragraph"}); err != nil {
+		t.Fatalf("SplitBlock failed: %v", err)
+	}
+
+	// A peer turns the paragraph into a quote while we edit the title
+	data, _ := doc.Save(ctx)
+	peer, err := LoadWithWASM(ctx, data, TestWASMPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	defer peer.Close(ctx)
+	if err := peer.UpdateBlock(ctx, path, 6, Block{Type: "blockquote"}); err != nil {
+		t.Fatalf("UpdateBlock failed: %v", err)
+	}
+	if err := doc.SpliceText(ctx, path, 6, 0, "!"); err != nil {
+		t.Fatalf("failed to add text: %v", err)
+	}
+	if err := doc.Merge(ctx, peer); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+
+	spans, err := doc.Spans(ctx, path)
+	if err != nil {
+		t.Fatalf("Spans failed: %v", err)
+	}
+	if len(spans) != 4 {
+		t.Fatalf("got %d spans, want 4: %+v", len(spans), spans)
+	}
+	if spans[0].Block == nil || spans[0].Block.Type != "heading" || spans[0].Block.Attrs["level"] != int64(1) {
+		t.Errorf("span 0 = %+v, want heading level 1", spans[0].Block)
+	}
+	if spans[1].Text != "Title!" {
+		t.Errorf("span 1 text = %q, want %q", spans[1].Text, "Title!")
+	}
+	if spans[2].Block == nil || spans[2].Block.Type != "blockquote" {
+		t.Errorf("span 2 = %+v, want blockquote", spans[2].Block)
+	}
+	if spans[3].Text != "Body" {
+		t.Errorf("span 3 text = %q, want %q", spans[3].Text, "Body")
+	}
+
+	if err := doc.UpdateBlock(ctx, path, 1, Block{Type: "paragraph"}); err == nil {
+		t.Error("UpdateBlock on a character should fail")
+	}
+
+	// Joining the quote merges "Body" into the heading
+	if err := doc.JoinBlock(ctx, path, 7); err != nil {
+		t.Fatalf("JoinBlock failed: %v", err)
+	}
+	spans, _ = doc.Spans(ctx, path)
+	if len(spans) != 2 || spans[1].Text != "Title!Body" {
+		t.Errorf("after join spans = %+v", spans)
+	}
+}
+
+func TestDocument_Marks_TypedValuesAndExpand(t *testing.T) {
+	ctx := context.Background()
+	doc, err := NewWithWASM(ctx, TestWASMPath)
+	if err != nil {
+		t.Fatalf("failed to create document: %v", err)
+	}
+	defer doc.Close(ctx)
+
+	path := Root().Get("content")
+	if err := doc.SpliceText(ctx, path, 0, 0, "bold link"); err != nil {
+		t.Fatalf("failed to add text: %v", err)
+	}
+	if err := doc.Mark(ctx, path, Mark{Name: "bold", Value: NewBool(true), Start: 0, End: 4}, ExpandBoth); err != nil {
+		t.Fatalf("failed to mark text: %v", err)
+	}
+	if err := doc.Mark(ctx, path, Mark{Name: "link", Value: NewString("https://example.com"), Start: 5, End: 9}, ExpandNone); err != nil {
+		t.Fatalf("failed to mark text: %v", err)
+	}
+
+	marks, err := doc.Marks(ctx, path)
+	if err != nil {
+		t.Fatalf("Marks failed: %v", err)
+	}
+	if len(marks) != 2 {
+		t.Fatalf("got %d marks, want 2: %+v", len(marks), marks)
+	}
+	if b, ok := marks[0].Value.AsBool(); !ok || !b {
+		t.Errorf("bold value = %#v, want bool true", marks[0].Value)
+	}
+	if marks[0].Expand != ExpandBoth {
+		t.Errorf("bold expand = %v, want ExpandBoth", marks[0].Expand)
+	}
+	if s, ok := marks[1].Value.AsString(); !ok || s != "https://example.com" {
+		t.Errorf("link value = %#v, want URL string", marks[1].Value)
+	}
+	if marks[1].Expand != ExpandNone {
+		t.Errorf("link expand = %v, want ExpandNone", marks[1].Expand)
+	}
+
+	// A peer types at the end of both marks concurrently
+	data, _ := doc.Save(ctx)
+	peer, err := LoadWithWASM(ctx, data, TestWASMPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	defer peer.Close(ctx)
+	if err := peer.SpliceText(ctx, path, 9, 0, "!"); err != nil {
+		t.Fatalf("SpliceText failed: %v", err)
+	}
+	if err := peer.SpliceText(ctx, path, 4, 0, "er"); err != nil {
+		t.Fatalf("SpliceText failed: %v", err)
+	}
+	if err := doc.Merge(ctx, peer); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+
+	marks, _ = doc.Marks(ctx, path)
+	if len(marks) != 2 || marks[0].End != 6 {
+		t.Errorf("bold should grow over the typed text: %+v", marks)
+	}
+	if len(marks) == 2 && (marks[1].Start != 7 || marks[1].End != 11) {
+		t.Errorf("link should not grow over the typed text: %+v", marks[1])
+	}
+}
+
+func TestDocument_TextPatches(t *testing.T) {
+	ctx := context.Background()
+	doc, err := NewWithWASM(ctx, TestWASMPath)
+	if err != nil {
+		t.Fatalf("failed to create document: %v", err)
+	}
+	defer doc.Close(ctx)
+
+	path := Root().Get("content")
+	if err := doc.SpliceText(ctx, path, 0, 0, "Hello"); err != nil {
+		t.Fatalf("failed to add text: %v", err)
+	}
+	before, err := doc.GetHeads(ctx)
+	if err != nil {
+		t.Fatalf("GetHeads failed: %v", err)
+	}
+
+	if err := doc.SpliceText(ctx, path, 5, 0, " World"); err != nil {
+		t.Fatalf("failed to add text: %v", err)
+	}
+	if err := doc.Mark(ctx, path, Mark{Name: "bold", Value: NewBool(true), Start: 0, End: 5}, ExpandNone); err != nil {
+		t.Fatalf("failed to mark text: %v", err)
+	}
+	after, err := doc.GetHeads(ctx)
+	if err != nil {
+		t.Fatalf("GetHeads failed: %v", err)
+	}
+
+	patches, err := doc.TextPatches(ctx, path, before, after)
+	if err != nil {
+		t.Fatalf("TextPatches failed: %v", err)
+	}
+
+	var inserted string
+	var marked bool
+	for _, p := range patches {
+		switch p.Action {
+		case PatchInsert:
+			inserted += p.Text
+		case PatchMark:
+			if b, _ := p.Mark.Value.AsBool(); p.Mark.Name == "bold" && b && p.Mark.Start == 0 && p.Mark.End == 5 {
+				marked = true
+			}
+		}
+	}
+	if inserted != " World" || !marked {
+		t.Errorf("patches = %+v", patches)
+	}
+
+	if none, err := doc.TextPatches(ctx, path, after, after); err != nil || len(none) != 0 {
+		t.Errorf("TextPatches(after, after) = %+v, %v", none, err)
+	}
+}
@@ -78,6 +78,41 @@ func (d *Document) FreeSyncState(ctx context.Context, state *SyncState) error {
 	return d.runtime.AmSyncStateFree(ctx, state.peerID)
 }
 
+// EncodeSyncState encodes a peer's sync state for storage.
+//
+// Only what outlives a connection is kept (the heads both sides share):
+// restore it with LoadSyncState when the peer reconnects, so it isn't sent
+// every change again.
+//
+// Status: ✅ Implemented
+func (d *Document) EncodeSyncState(ctx context.Context, state *SyncState) ([]byte, error) {
+	if d.runtime == nil {
+		return nil, fmt.Errorf("document not initialized")
+	}
+	if state == nil {
+		return nil, fmt.Errorf("sync state is nil")
+	}
+
+	return d.runtime.AmSyncStateEncode(ctx, state.peerID)
+}
+
+// LoadSyncState starts a peer connection from a state encoded by
+// EncodeSyncState. Free it with FreeSyncState like one from InitSyncState.
+//
+// Status: ✅ Implemented
+func (d *Document) LoadSyncState(ctx context.Context, data []byte) (*SyncState, error) {
+	if d.runtime == nil {
+		return nil, fmt.Errorf("document not initialized")
+	}
+
+	peerID, err := d.runtime.AmSyncStateLoad(ctx, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sync state: %w", err)
+	}
+
+	return &SyncState{peerID: peerID}, nil
+}
+
 // GenerateSyncMessage generates a sync message to send to a peer.
 //
 // The sync state tracks what the peer has already seen, so we only send
@@ -46,7 +46,7 @@ func (d *Document) GetText(ctx context.Context, path Path) (string, error) {
 // which enables better conflict resolution when merging.
 //
 // Parameters:
-//   - path: Path to text object (currently only Root().Get("content"))
+//   - path: Path to a text object (e.g. Root().Get("content"))
 //   - pos: Character position (0-indexed)
 //   - del: Number of characters to delete (can be 0)
 //   - text: Text to insert (can be empty)
@@ -63,11 +63,16 @@ func (d *Document) GetText(ctx context.Context, path Path) (string, error) {
 //
 // Status: ✅ WASI export exists, ✅ Go wrapper implemented
 func (d *Document) SpliceText(ctx context.Context, path Path, pos uint, del int, text string) error {
-	if !d.isContentPath(path) {
-		return ErrInvalidPath
+	if d.isContentPath(path) {
+		return d.runtime.AmTextSplice(ctx, pos, int64(del), text)
 	}
 
-	return d.runtime.AmTextSplice(ctx, pos, int64(del), text)
+	// Any other text object, addressed by path
+	p, err := path.objPath()
+	if err != nil {
+		return err
+	}
+	return d.runtime.AmObjSpliceText(ctx, p, pos, int64(del), text)
 }
 
 // UpdateText replaces all text content.
@@ -0,0 +1,279 @@
+// ==============================================================================
+// Layer 4: Go High-Level CRDT API - Undo/Redo
+// ==============================================================================
+// ARCHITECTURE: This is the high-level Go API layer (Layer 4/7).
+//
+// RESPONSIBILITIES:
+// - Revert the edits between two points in history as a new change
+// - UndoManager: per-user undo/redo stacks grouped by transaction
+//
+// DEPENDENCIES:
+// - Layer 3: pkg/wazero (FFI to WASM)
+// - Context: Takes context.Context for FFI calls
+//
+// DEPENDENTS:
+// - Layer 5: pkg/server (stateful, thread-safe operations)
+//
+// RELATED FILES (1:1 mapping):
+// - Layer 2: rust/automerge_wasi/src/undo.rs (WASI exports)
+// - Layer 3: pkg/wazero/crdt_undo.go (FFI wrappers)
+//
+// NOTES:
+// - Undo and redo never rewrite history: they append forward changes that
+//   sync and merge like any other edit
+// - Edits by other actors (merged before or after) are left alone
+// - Undo and redo replace values and elements with new ones; UndoManager
+//   keeps track of the replacements so earlier steps still apply to them
+// - UndoManager is not thread-safe; callers serialize access (as Layer 5 does)
+// ==============================================================================
+
+package automerge
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Revert applies a new change that reverts everything that changed between
+// the before and after heads.
+//
+// Map keys and list elements are restored to their value at before, inserted
+// elements and characters are removed and deleted ones are reinserted where
+// they were. Values that were changed again after `after` (by anyone) are
+// left alone, so concurrent edits survive. Reverting the change made by a
+// Revert reapplies the original edits.
+//
+// Status: ✅ Implemented
+func (d *Document) Revert(ctx context.Context, before, after []ChangeHash) error {
+	return d.revert(ctx, before, after, nil)
+}
+
+// revert is Revert for a caller that tracks replaced IDs: restoring a value
+// or reinserting an element creates a new op or element ID standing in for
+// the old one. remap holds the replacements made by earlier reverts (old ID
+// to new ID); the ones this revert makes are added to it.
+func (d *Document) revert(ctx context.Context, before, after []ChangeHash, remap map[string]string) error {
+	if d.runtime == nil {
+		return fmt.Errorf("document not initialized")
+	}
+
+	var in strings.Builder
+	for old, id := range remap {
+		in.WriteString(old + "\t" + id + "\n")
+	}
+	out, err := d.runtime.AmRevert(ctx, hashesToBytes(before), hashesToBytes(after), in.String())
+	if err != nil || remap == nil {
+		return err
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if old, id, ok := strings.Cut(line, "\t"); ok {
+			remap[old] = id
+		}
+	}
+	return nil
+}
+
+func hashesToBytes(hashes []ChangeHash) [][]byte {
+	out := make([][]byte, len(hashes))
+	for i := range hashes {
+		out[i] = hashes[i][:]
+	}
+	return out
+}
+
+func sameHeads(a, b []ChangeHash) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := make(map[ChangeHash]bool, len(a))
+	for _, h := range a {
+		seen[h] = true
+	}
+	for _, h := range b {
+		if !seen[h] {
+			return false
+		}
+	}
+	return true
+}
+
+// undoStep is one undoable transaction: the heads around it
+type undoStep struct {
+	before []ChangeHash
+	after  []ChangeHash
+}
+
+// UndoManager records the changes a local user makes to a document and can
+// undo and redo them.
+//
+// Edits are grouped into transactions with Begin/Commit (or Transact); each
+// transaction is undone or redone as a whole. Undo and redo produce new
+// changes that revert or reapply the transaction's edits to maps, lists,
+// text and marks without touching other actors' concurrent edits.
+//
+// Only edits made inside a transaction are recorded. Do not merge remote
+// changes while a transaction is open - they would become part of it.
+//
+// Example:
+//
+//	um := automerge.NewUndoManager(doc)
+//	_ = um.Transact(ctx, func() error {
+//	    return doc.SpliceText(ctx, path, 0, 0, "Hello")
+//	})
+//	_ = um.Undo(ctx) // removes "Hello"
+//	_ = um.Redo(ctx) // puts it back
+type UndoManager struct {
+	doc   *Document
+	undo  []undoStep
+	redo  []undoStep
+	open  []ChangeHash // heads at Begin
+	depth int          // nested Begin calls
+
+	// remap maps the op and element IDs the recorded steps wrote to the ones
+	// undo/redo replaced them with, so each step still recognizes its edits
+	remap map[string]string
+
+	// MaxSteps limits the undo history (0 = unlimited)
+	MaxSteps int
+}
+
+// NewUndoManager creates an undo manager for doc
+func NewUndoManager(doc *Document) *UndoManager {
+	return &UndoManager{doc: doc, remap: make(map[string]string)}
+}
+
+// Begin starts a transaction. Transactions may be nested; only the
+// outermost one is recorded.
+func (u *UndoManager) Begin(ctx context.Context) error {
+	if u.depth == 0 {
+		// GetHeads also closes any pending change, so earlier edits are not
+		// folded into this transaction
+		heads, err := u.doc.GetHeads(ctx)
+		if err != nil {
+			return err
+		}
+		u.open = heads
+	}
+	u.depth++
+	return nil
+}
+
+// Commit ends the current transaction and records it as one undo step.
+// Committing a transaction that changed nothing records nothing.
+func (u *UndoManager) Commit(ctx context.Context) error {
+	if u.depth == 0 {
+		return fmt.Errorf("automerge: Commit without Begin")
+	}
+	u.depth--
+	if u.depth > 0 {
+		return nil
+	}
+
+	heads, err := u.doc.GetHeads(ctx)
+	if err != nil {
+		return err
+	}
+	before := u.open
+	u.open = nil
+	if sameHeads(before, heads) {
+		return nil
+	}
+
+	u.push(undoStep{before: before, after: heads})
+	u.redo = nil
+	return nil
+}
+
+// Transact runs fn inside a transaction. Edits made before fn fails are
+// still recorded, so they can be undone.
+func (u *UndoManager) Transact(ctx context.Context, fn func() error) error {
+	if err := u.Begin(ctx); err != nil {
+		return err
+	}
+	fnErr := fn()
+	if err := u.Commit(ctx); err != nil {
+		return err
+	}
+	return fnErr
+}
+
+// CanUndo reports whether there is a transaction to undo
+func (u *UndoManager) CanUndo() bool {
+	return len(u.undo) > 0
+}
+
+// CanRedo reports whether there is an undone transaction to redo
+func (u *UndoManager) CanRedo() bool {
+	return len(u.redo) > 0
+}
+
+// Undo reverts the most recent transaction
+func (u *UndoManager) Undo(ctx context.Context) error {
+	if u.depth > 0 {
+		return fmt.Errorf("automerge: cannot undo inside a transaction")
+	}
+	if len(u.undo) == 0 {
+		return ErrNothingToUndo
+	}
+
+	step := u.undo[len(u.undo)-1]
+	inverse, err := u.apply(ctx, step)
+	if err != nil {
+		return err
+	}
+	u.undo = u.undo[:len(u.undo)-1]
+	if inverse != nil {
+		u.redo = append(u.redo, *inverse)
+	}
+	return nil
+}
+
+// Redo reapplies the most recently undone transaction
+func (u *UndoManager) Redo(ctx context.Context) error {
+	if u.depth > 0 {
+		return fmt.Errorf("automerge: cannot redo inside a transaction")
+	}
+	if len(u.redo) == 0 {
+		return ErrNothingToRedo
+	}
+
+	step := u.redo[len(u.redo)-1]
+	inverse, err := u.apply(ctx, step)
+	if err != nil {
+		return err
+	}
+	u.redo = u.redo[:len(u.redo)-1]
+	if inverse != nil {
+		u.push(*inverse)
+	}
+	return nil
+}
+
+// apply reverts step and returns the step that reverts the revert
+// (nil if the revert changed nothing)
+func (u *UndoManager) apply(ctx context.Context, step undoStep) (*undoStep, error) {
+	before, err := u.doc.GetHeads(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.doc.revert(ctx, step.before, step.after, u.remap); err != nil {
+		return nil, err
+	}
+	after, err := u.doc.GetHeads(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if sameHeads(before, after) {
+		return nil, nil
+	}
+	return &undoStep{before: before, after: after}, nil
+}
+
+// push adds an undo step, dropping the oldest beyond MaxSteps
+func (u *UndoManager) push(step undoStep) {
+	u.undo = append(u.undo, step)
+	if u.MaxSteps > 0 && len(u.undo) > u.MaxSteps {
+		u.undo = u.undo[len(u.undo)-u.MaxSteps:]
+	}
+}
@@ -0,0 +1,347 @@
+package automerge
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// TestSameHeads tests order-insensitive heads comparison
+func TestSameHeads(t *testing.T) {
+	a, b := ChangeHash{1}, ChangeHash{2}
+
+	if !sameHeads([]ChangeHash{a, b}, []ChangeHash{b, a}) {
+		t.Error("expected heads in different order to be equal")
+	}
+	if sameHeads([]ChangeHash{a}, []ChangeHash{a, b}) {
+		t.Error("expected heads of different length to differ")
+	}
+	if !sameHeads(nil, nil) {
+		t.Error("expected empty heads to be equal")
+	}
+}
+
+// TestUndoManager_Empty tests undo/redo with no history
+func TestUndoManager_Empty(t *testing.T) {
+	um := NewUndoManager(&Document{})
+
+	if um.CanUndo() || um.CanRedo() {
+		t.Fatal("new manager should have nothing to undo or redo")
+	}
+	if err := um.Undo(context.Background()); !errors.Is(err, ErrNothingToUndo) {
+		t.Errorf("Undo = %v, want ErrNothingToUndo", err)
+	}
+	if err := um.Redo(context.Background()); !errors.Is(err, ErrNothingToRedo) {
+		t.Errorf("Redo = %v, want ErrNothingToRedo", err)
+	}
+}
+
+// TestUndoManager_MapAndList tests undo/redo of map and list edits
+func TestUndoManager_MapAndList(t *testing.T) {
+	ctx := context.Background()
+	doc, err := NewWithWASM(ctx, TestWASMPath)
+	if err != nil {
+		t.Fatalf("Failed to create document: %v", err)
+	}
+	defer doc.Close(ctx)
+
+	path := Root().Get("settings")
+	initial := map[string]interface{}{"theme": "light", "tabs": []interface{}{"a", "b"}}
+	if err := doc.UpdateJSON(ctx, path, initial); err != nil {
+		t.Fatalf("UpdateJSON failed: %v", err)
+	}
+
+	um := NewUndoManager(doc)
+	err = um.Transact(ctx, func() error {
+		return doc.UpdateJSON(ctx, path, map[string]interface{}{
+			"theme": "dark",
+			"tabs":  []interface{}{"a", "c"},
+			"font":  "mono",
+		})
+	})
+	if err != nil {
+		t.Fatalf("Transact failed: %v", err)
+	}
+
+	if err := um.Undo(ctx); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	got, err := doc.GetJSON(ctx, path)
+	if err != nil {
+		t.Fatalf("GetJSON failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, initial) {
+		t.Errorf("after undo = %#v, want %#v", got, initial)
+	}
+
+	if err := um.Redo(ctx); err != nil {
+		t.Fatalf("Redo failed: %v", err)
+	}
+	got, _ = doc.GetJSON(ctx, path)
+	want := map[string]interface{}{"theme": "dark", "tabs": []interface{}{"a", "c"}, "font": "mono"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("after redo = %#v, want %#v", got, want)
+	}
+	if !um.CanUndo() || um.CanRedo() {
+		t.Error("after redo the transaction should be undoable again")
+	}
+}
+
+// TestUndoManager_TextAndMarks tests that text edits and formatting are undone together
+func TestUndoManager_TextAndMarks(t *testing.T) {
+	ctx := context.Background()
+	doc, err := NewWithWASM(ctx, TestWASMPath)
+	if err != nil {
+		t.Fatalf("Failed to create document: %v", err)
+	}
+	defer doc.Close(ctx)
+
+	path := Root().Get("content")
+	if err := doc.SpliceText(ctx, path, 0, 0, "Hello world"); err != nil {
+		t.Fatalf("SpliceText failed: %v", err)
+	}
+
+	um := NewUndoManager(doc)
+	err = um.Transact(ctx, func() error {
+		if err := doc.SpliceText(ctx, path, 5, 6, ", friend"); err != nil {
+			return err
+		}
+		return doc.Mark(ctx, path, Mark{Name: "bold", Value: NewBool(true), Start: 0, End: 5}, ExpandNone)
+	})
+	if err != nil {
+		t.Fatalf("Transact failed: %v", err)
+	}
+
+	if err := um.Undo(ctx); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	text, _ := doc.GetText(ctx, path)
+	if text != "Hello world" {
+		t.Errorf("text after undo = %q, want %q", text, "Hello world")
+	}
+	marks, err := doc.Marks(ctx, path)
+	if err != nil {
+		t.Fatalf("Marks failed: %v", err)
+	}
+	if len(marks) != 0 {
+		t.Errorf("marks after undo = %+v, want none", marks)
+	}
+
+	if err := um.Redo(ctx); err != nil {
+		t.Fatalf("Redo failed: %v", err)
+	}
+	text, _ = doc.GetText(ctx, path)
+	if text != "Hello, friend" {
+		t.Errorf("text after redo = %q, want %q", text, "Hello, friend")
+	}
+}
+
+// TestUndoManager_ConsecutiveEdits tests undo and redo of two edits to the
+// same key and the same text, which replace each other's values and
+// characters
+func TestUndoManager_ConsecutiveEdits(t *testing.T) {
+	ctx := context.Background()
+	doc, err := NewWithWASM(ctx, TestWASMPath)
+	if err != nil {
+		t.Fatalf("Failed to create document: %v", err)
+	}
+	defer doc.Close(ctx)
+
+	title, content := Root().Get("title"), Root().Get("content")
+	if err := doc.SpliceText(ctx, content, 0, 0, "abc"); err != nil {
+		t.Fatalf("SpliceText failed: %v", err)
+	}
+
+	um := NewUndoManager(doc)
+	if err := um.Transact(ctx, func() error {
+		if err := doc.UpdateJSON(ctx, title, "one"); err != nil {
+			return err
+		}
+		return doc.SpliceText(ctx, content, 3, 0, "def")
+	}); err != nil {
+		t.Fatalf("Transact failed: %v", err)
+	}
+	if err := um.Transact(ctx, func() error {
+		if err := doc.UpdateJSON(ctx, title, "two"); err != nil {
+			return err
+		}
+		return doc.SpliceText(ctx, content, 2, 3, "")
+	}); err != nil {
+		t.Fatalf("Transact failed: %v", err)
+	}
+
+	check := func(step string, wantTitle interface{}, wantText string) {
+		t.Helper()
+		got, err := doc.GetJSON(ctx, Root())
+		if err != nil {
+			t.Fatalf("GetJSON failed: %v", err)
+		}
+		if got.(map[string]interface{})["title"] != wantTitle {
+			t.Errorf("title after %s = %v, want %v", step, got.(map[string]interface{})["title"], wantTitle)
+		}
+		if text, _ := doc.GetText(ctx, content); text != wantText {
+			t.Errorf("text after %s = %q, want %q", step, text, wantText)
+		}
+	}
+
+	// Twice, so the second round undoes and redoes the edits made by redo
+	for round := 0; round < 2; round++ {
+		if err := um.Undo(ctx); err != nil {
+			t.Fatalf("Undo failed: %v", err)
+		}
+		check("first undo", "one", "abcdef")
+		if err := um.Undo(ctx); err != nil {
+			t.Fatalf("Undo failed: %v", err)
+		}
+		check("second undo", nil, "abc")
+
+		if err := um.Redo(ctx); err != nil {
+			t.Fatalf("Redo failed: %v", err)
+		}
+		check("first redo", "one", "abcdef")
+		if err := um.Redo(ctx); err != nil {
+			t.Fatalf("Redo failed: %v", err)
+		}
+		check("second redo", "two", "abf")
+	}
+}
+
+// TestUndoManager_KeepsMarkExpand tests that marks restored by undo keep
+// their expand setting
+func TestUndoManager_KeepsMarkExpand(t *testing.T) {
+	ctx := context.Background()
+	doc, err := NewWithWASM(ctx, TestWASMPath)
+	if err != nil {
+		t.Fatalf("Failed to create document: %v", err)
+	}
+	defer doc.Close(ctx)
+
+	path := Root().Get("content")
+	if err := doc.SpliceText(ctx, path, 0, 0, "Hello"); err != nil {
+		t.Fatalf("SpliceText failed: %v", err)
+	}
+	if err := doc.Mark(ctx, path, Mark{Name: "bold", Value: NewBool(true), Start: 0, End: 5}, ExpandBoth); err != nil {
+		t.Fatalf("Mark failed: %v", err)
+	}
+
+	um := NewUndoManager(doc)
+	if err := um.Transact(ctx, func() error {
+		return doc.SpliceText(ctx, path, 0, 5, "")
+	}); err != nil {
+		t.Fatalf("Transact failed: %v", err)
+	}
+	if err := um.Undo(ctx); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+
+	marks, err := doc.Marks(ctx, path)
+	if err != nil {
+		t.Fatalf("Marks failed: %v", err)
+	}
+	if len(marks) != 1 || marks[0].Start != 0 || marks[0].End != 5 || marks[0].Expand != ExpandBoth {
+		t.Errorf("marks after undo = %+v, want bold 0-5 expanding both ways", marks)
+	}
+}
+
+// TestUndoManager_KeepsConcurrentEdits tests that undo leaves other peers' edits alone
+func TestUndoManager_KeepsConcurrentEdits(t *testing.T) {
+	ctx := context.Background()
+	alice, err := NewWithWASM(ctx, TestWASMPath)
+	if err != nil {
+		t.Fatalf("Failed to create document: %v", err)
+	}
+	defer alice.Close(ctx)
+
+	path := Root().Get("content")
+	if err := alice.SpliceText(ctx, path, 0, 0, "The fox"); err != nil {
+		t.Fatalf("SpliceText failed: %v", err)
+	}
+	data, err := alice.Save(ctx)
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	bob, err := LoadWithWASM(ctx, data, TestWASMPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	defer bob.Close(ctx)
+
+	// Alice inserts "quick ", Bob concurrently appends " jumps"
+	um := NewUndoManager(alice)
+	if err := um.Transact(ctx, func() error {
+		return alice.SpliceText(ctx, path, 4, 0, "quick ")
+	}); err != nil {
+		t.Fatalf("Transact failed: %v", err)
+	}
+	if err := bob.SpliceText(ctx, path, 7, 0, " jumps"); err != nil {
+		t.Fatalf("SpliceText failed: %v", err)
+	}
+
+	if err := alice.Merge(ctx, bob); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	text, _ := alice.GetText(ctx, path)
+	if text != "The quick fox jumps" {
+		t.Fatalf("merged text = %q, want %q", text, "The quick fox jumps")
+	}
+
+	// Alice's undo only removes her own insertion
+	if err := um.Undo(ctx); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	text, _ = alice.GetText(ctx, path)
+	if text != "The fox jumps" {
+		t.Errorf("text after undo = %q, want %q", text, "The fox jumps")
+	}
+
+	// The undo is an ordinary change that syncs to Bob
+	if err := bob.Merge(ctx, alice); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	bobText, _ := bob.GetText(ctx, path)
+	if bobText != text {
+		t.Errorf("bob text = %q, want %q", bobText, text)
+	}
+}
+
+// TestUndoManager_SkipsOverwrittenValues tests that undo does not clobber a newer remote value
+func TestUndoManager_SkipsOverwrittenValues(t *testing.T) {
+	ctx := context.Background()
+	alice, err := NewWithWASM(ctx, TestWASMPath)
+	if err != nil {
+		t.Fatalf("Failed to create document: %v", err)
+	}
+	defer alice.Close(ctx)
+
+	um := NewUndoManager(alice)
+	if err := um.Transact(ctx, func() error {
+		return alice.UpdateJSON(ctx, Root().Get("title"), "Draft")
+	}); err != nil {
+		t.Fatalf("Transact failed: %v", err)
+	}
+
+	data, _ := alice.Save(ctx)
+	bob, err := LoadWithWASM(ctx, data, TestWASMPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	defer bob.Close(ctx)
+	if err := bob.UpdateJSON(ctx, Root().Get("title"), "Final"); err != nil {
+		t.Fatalf("UpdateJSON failed: %v", err)
+	}
+	if err := alice.Merge(ctx, bob); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+
+	if err := um.Undo(ctx); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	got, err := alice.GetJSON(ctx, Root().Get("title"))
+	if err != nil {
+		t.Fatalf("GetJSON failed: %v", err)
+	}
+	if got != "Final" {
+		t.Errorf("title after undo = %v, want %q", got, "Final")
+	}
+}
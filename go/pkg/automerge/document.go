@@ -2,6 +2,8 @@ package automerge
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/joeblew999/automerge-wazero-example/pkg/wazero"
 )
@@ -9,6 +11,7 @@ import (
 // Document represents an Automerge CRDT document
 type Document struct {
 	runtime *wazero.Runtime
+	saved   []ChangeHash // Heads at the last Save, SaveIncremental or Load (nil = none)
 }
 
 // New creates a new empty Automerge document
@@ -54,7 +57,12 @@ func LoadWithWASM(ctx context.Context, data []byte, wasmPath string) (*Document,
 		return nil, err
 	}
 
-	return &Document{runtime: runtime}, nil
+	doc := &Document{runtime: runtime}
+	if doc.saved, err = doc.GetHeads(ctx); err != nil {
+		runtime.Close(ctx)
+		return nil, err
+	}
+	return doc, nil
 }
 
 // Close closes the document and frees resources
@@ -62,9 +70,77 @@ func (d *Document) Close(ctx context.Context) error {
 	return d.runtime.Close(ctx)
 }
 
+// MemorySize returns the bytes of WASM memory the document's runtime holds.
+// It never shrinks: freed memory is reused, not returned.
+func (d *Document) MemorySize() uint64 {
+	if d.runtime == nil {
+		return 0
+	}
+	return d.runtime.MemorySize()
+}
+
 // Save serializes the document to binary format
 func (d *Document) Save(ctx context.Context) ([]byte, error) {
-	return d.runtime.AmSave(ctx)
+	data, err := d.runtime.AmSave(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if d.saved, err = d.GetHeads(ctx); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// SaveIncremental returns the changes made since the last Save,
+// SaveIncremental or Load, and marks them as saved. The result is empty when
+// nothing changed.
+//
+// Appending each result to a snapshot's log is much cheaper than rewriting
+// the snapshot after every edit; LoadIncremental replays the log.
+//
+// Example:
+//
+//	snapshot, _ := doc.Save(ctx)
+//	// ... edits ...
+//	chunk, _ := doc.SaveIncremental(ctx) // just the new changes
+//
+//	restored, _ := automerge.LoadWithWASM(ctx, snapshot, wasmPath)
+//	restored.LoadIncremental(ctx, chunk)
+//
+// Status: ✅ Implemented
+func (d *Document) SaveIncremental(ctx context.Context) ([]byte, error) {
+	heads, err := d.GetHeads(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if sameHeads(heads, d.saved) {
+		return nil, nil
+	}
+
+	changes, err := d.GetChanges(ctx, d.saved)
+	if err != nil {
+		return nil, err
+	}
+	d.saved = heads
+	return changes, nil
+}
+
+// LoadIncremental applies changes produced by SaveIncremental (or GetChanges)
+// to the document. Changes it already has are skipped, so replaying a chunk
+// twice is harmless.
+//
+// Loaded changes are not marked as saved: a later SaveIncremental includes
+// them.
+//
+// Status: ✅ Implemented
+func (d *Document) LoadIncremental(ctx context.Context, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if err := d.ApplyChanges(ctx, data); err != nil {
+		return fmt.Errorf("%w: %v", ErrLoadFailed, err)
+	}
+	return nil
 }
 
 // Merge merges another document into this one (CRDT magic!)
@@ -103,3 +179,31 @@ func (d *Document) GetActor(ctx context.Context) (string, error) {
 func (d *Document) SetActor(ctx context.Context, actorID string) error {
 	return d.runtime.AmSetActor(ctx, actorID)
 }
+
+// Commit closes the pending operations into one change with the given
+// message (may be empty) and the current time.
+//
+// Operations are otherwise committed implicitly (on Save, Merge, GetHeads...)
+// without a timestamp, because the WASM sandbox has no clock. Commit after
+// local edits when change times matter, e.g. for TextAttribution.
+// Returns false if there was nothing to commit.
+//
+// Status: ✅ Implemented
+func (d *Document) Commit(ctx context.Context, message string) (bool, error) {
+	if d.runtime == nil {
+		return false, fmt.Errorf("document not initialized")
+	}
+	return d.runtime.AmCommit(ctx, message, time.Now().Unix())
+}
+
+// Rollback discards the operations made since the last commit and returns
+// how many were discarded. Use it to abandon a multi-step edit that failed
+// halfway (close earlier edits first with Commit or GetHeads).
+//
+// Status: ✅ Implemented
+func (d *Document) Rollback(ctx context.Context) (int, error) {
+	if d.runtime == nil {
+		return 0, fmt.Errorf("document not initialized")
+	}
+	return d.runtime.AmRollback(ctx)
+}
@@ -218,6 +218,76 @@ func TestDocument_SaveAndLoad(t *testing.T) {
 	}
 }
 
+// TestDocument_SaveIncremental verifies a snapshot plus incremental chunks
+// restores the document
+func TestDocument_SaveIncremental(t *testing.T) {
+	ctx := context.Background()
+
+	doc1, err := automerge.NewWithWASM(ctx, automerge.TestWASMPath)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer doc1.Close(ctx)
+
+	path := automerge.Root().Get("content")
+	if err := doc1.SpliceText(ctx, path, 0, 0, "Hello"); err != nil {
+		t.Fatalf("SpliceText() error = %v", err)
+	}
+	snapshot, err := doc1.Save(ctx)
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	// Nothing changed since the snapshot
+	chunk, err := doc1.SaveIncremental(ctx)
+	if err != nil {
+		t.Fatalf("SaveIncremental() error = %v", err)
+	}
+	if len(chunk) != 0 {
+		t.Errorf("SaveIncremental() after Save = %d bytes, want 0", len(chunk))
+	}
+
+	var chunks [][]byte
+	for _, s := range []string{", World", "!"} {
+		length, _ := doc1.TextLength(ctx, path)
+		if err := doc1.SpliceText(ctx, path, uint(length), 0, s); err != nil {
+			t.Fatalf("SpliceText() error = %v", err)
+		}
+		chunk, err := doc1.SaveIncremental(ctx)
+		if err != nil {
+			t.Fatalf("SaveIncremental() error = %v", err)
+		}
+		if len(chunk) == 0 || len(chunk) >= len(snapshot)+len(s)+64 {
+			t.Errorf("SaveIncremental() = %d bytes, snapshot %d bytes", len(chunk), len(snapshot))
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	doc2, err := automerge.LoadWithWASM(ctx, snapshot, automerge.TestWASMPath)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	defer doc2.Close(ctx)
+
+	// Replaying a chunk twice is harmless
+	for _, chunk := range append(chunks, chunks[0]) {
+		if err := doc2.LoadIncremental(ctx, chunk); err != nil {
+			t.Fatalf("LoadIncremental() error = %v", err)
+		}
+	}
+	text, err := doc2.GetText(ctx, path)
+	if err != nil {
+		t.Fatalf("GetText() error = %v", err)
+	}
+	if text != "Hello, World!" {
+		t.Errorf("GetText() = %q, want %q", text, "Hello, World!")
+	}
+
+	if err := doc2.LoadIncremental(ctx, []byte("garbage")); !errors.Is(err, automerge.ErrLoadFailed) {
+		t.Errorf("LoadIncremental(garbage) error = %v, want ErrLoadFailed", err)
+	}
+}
+
 // TestDocument_LoadFromTestData verifies loading pre-generated snapshots
 func TestDocument_LoadFromTestData(t *testing.T) {
 	ctx := context.Background()
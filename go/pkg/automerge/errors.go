@@ -28,6 +28,10 @@ var (
 	ErrKeyNotFound    = errors.New("automerge: key not found")
 	ErrTypeMismatch   = errors.New("automerge: type mismatch")
 	ErrIndexOutOfBounds = errors.New("automerge: index out of bounds")
+
+	// Undo/redo errors
+	ErrNothingToUndo = errors.New("automerge: nothing to undo")
+	ErrNothingToRedo = errors.New("automerge: nothing to redo")
 )
 
 // NotImplementedError provides context about unimplemented features
@@ -0,0 +1,611 @@
+// ==============================================================================
+// Layer 4: Go High-Level CRDT API - Rich Text Deltas (Quill)
+// ==============================================================================
+// ARCHITECTURE: Helper sub-package of the high-level Go API layer (Layer 4/7).
+//
+// RESPONSIBILITIES:
+// - Quill-style Delta type (retain/insert/delete with attributes) and its
+//   JSON form, so browser editors can bind to a text object directly
+// - Apply a Delta to a text object as splices, block markers and marks, as
+//   a single change
+// - Convert spans (full document) and patches (incremental edits) to Deltas
+//
+// DEPENDENCIES:
+// - pkg/automerge (Document: SpliceText, SplitBlock, Mark, Unmark, Spans,
+//   Commit, Rollback; Patch, Span, Block types)
+//
+// DEPENDENTS:
+// - Layer 5: pkg/server (ApplyRichTextDelta, RichTextDelta)
+// - Layer 6: pkg/api (POST /api/richtext/delta, GET /api/stream?format=delta)
+//
+// RELATED FILES:
+// - pkg/automerge/richtext/import.go (single-change transactions, mark expand)
+// - pkg/automerge/crdt_richtext.go (Document.TextPatches)
+//
+// NOTES:
+// - Lengths count characters (code points) like the rest of the API, and a
+//   block marker counts as one; Quill counts UTF-16 units, so text outside
+//   the Basic Multilingual Plane (e.g. emoji) needs converting in the client
+// - Attributes are marks: a value sets the mark, null removes it
+// - Block markers are embeds: {"insert": {"block": {"type": .., "parents": ..,
+//   "attrs": ..}}}; other embeds are rejected
+// - Inserted text carries exactly its attributes: marks it would inherit
+//   from its neighbours are removed, as in Quill
+// ==============================================================================
+
+package richtext
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+)
+
+// ErrInvalidDelta is returned for deltas that can't be applied as marks and
+// block markers (unsupported embeds or attribute values)
+var ErrInvalidDelta = errors.New("invalid delta")
+
+// DeltaOp is one operation of a Delta. Exactly one of Insert (or Block),
+// Delete and Retain is set.
+type DeltaOp struct {
+	Insert     string                 // Inserted text
+	Block      *automerge.Block       // Inserted block marker (embed)
+	Delete     uint                   // Number of positions deleted
+	Retain     uint                   // Number of positions kept (and formatted)
+	Attributes map[string]interface{} // Marks of inserted or retained positions
+}
+
+// Delta is a Quill-style list of operations walking a text from its start.
+//
+// Build one with Insert, InsertBlock, Retain and Delete; they merge
+// adjacent operations the way Quill does, so equal edits compare equal.
+//
+// Example:
+//
+//	// Make the first 5 characters bold and add "!" after them
+//	d := new(richtext.Delta).Retain(5, map[string]interface{}{"bold": true}).Insert("!", nil)
+//
+// Status: ✅ Implemented
+type Delta struct {
+	Ops []DeltaOp
+}
+
+// Insert appends a text insertion
+func (d *Delta) Insert(text string, attrs map[string]interface{}) *Delta {
+	d.push(DeltaOp{Insert: text, Attributes: attrs})
+	return d
+}
+
+// InsertBlock appends a block marker insertion
+func (d *Delta) InsertBlock(block automerge.Block) *Delta {
+	d.push(DeltaOp{Block: &block})
+	return d
+}
+
+// Retain appends n kept positions, setting (or with a nil value removing)
+// the marks in attrs
+func (d *Delta) Retain(n uint, attrs map[string]interface{}) *Delta {
+	d.push(DeltaOp{Retain: n, Attributes: attrs})
+	return d
+}
+
+// Delete appends n deleted positions
+func (d *Delta) Delete(n uint) *Delta {
+	d.push(DeltaOp{Delete: n})
+	return d
+}
+
+func (op DeltaOp) isInsert() bool {
+	return op.Insert != "" || op.Block != nil
+}
+
+// length returns the number of positions op covers
+func (op DeltaOp) length() uint {
+	switch {
+	case op.Block != nil:
+		return 1
+	case op.Insert != "":
+		return uint(utf8.RuneCountInString(op.Insert))
+	case op.Delete > 0:
+		return op.Delete
+	default:
+		return op.Retain
+	}
+}
+
+// push appends op, merging it into the previous operation where possible.
+// Inserts go before a trailing delete, so equal edits have one form.
+func (d *Delta) push(op DeltaOp) {
+	if op.length() == 0 {
+		return
+	}
+	if len(op.Attributes) == 0 {
+		op.Attributes = nil
+	}
+
+	index := len(d.Ops)
+	if index > 0 {
+		last := &d.Ops[index-1]
+		if op.Delete > 0 && last.Delete > 0 {
+			last.Delete += op.Delete
+			return
+		}
+		if last.Delete > 0 && op.isInsert() {
+			index--
+			if index == 0 {
+				d.Ops = append([]DeltaOp{op}, d.Ops...)
+				return
+			}
+			last = &d.Ops[index-1]
+		}
+		if reflect.DeepEqual(op.Attributes, last.Attributes) {
+			if op.Insert != "" && last.Insert != "" {
+				last.Insert += op.Insert
+				return
+			}
+			if op.Retain > 0 && last.Retain > 0 {
+				last.Retain += op.Retain
+				return
+			}
+		}
+	}
+	d.Ops = append(d.Ops, DeltaOp{})
+	copy(d.Ops[index+1:], d.Ops[index:])
+	d.Ops[index] = op
+}
+
+// chop drops a trailing retain without attributes, which changes nothing
+func (d *Delta) chop() *Delta {
+	if n := len(d.Ops); n > 0 && d.Ops[n-1].Retain > 0 && d.Ops[n-1].Attributes == nil {
+		d.Ops = d.Ops[:n-1]
+	}
+	return d
+}
+
+// opIter walks the operations of a Delta, splitting them on demand
+type opIter struct {
+	ops    []DeltaOp
+	i      int
+	offset uint // positions of ops[i] already consumed
+}
+
+// infinity is the length of the implicit retain after the last operation
+const infinity = ^uint(0)
+
+func (it *opIter) hasNext() bool {
+	return it.i < len(it.ops)
+}
+
+func (it *opIter) peekLength() uint {
+	if !it.hasNext() {
+		return infinity
+	}
+	return it.ops[it.i].length() - it.offset
+}
+
+func (it *opIter) peekIsInsert() bool {
+	return it.hasNext() && it.ops[it.i].isInsert()
+}
+
+func (it *opIter) peekIsDelete() bool {
+	return it.hasNext() && it.ops[it.i].Delete > 0
+}
+
+// next returns up to n positions of the current operation
+func (it *opIter) next(n uint) DeltaOp {
+	if !it.hasNext() {
+		return DeltaOp{Retain: n}
+	}
+	op := it.ops[it.i]
+	offset := it.offset
+	if rest := op.length() - offset; n >= rest {
+		n = rest
+		it.i++
+		it.offset = 0
+	} else {
+		it.offset += n
+	}
+
+	switch {
+	case op.Delete > 0:
+		return DeltaOp{Delete: n}
+	case op.Retain > 0:
+		return DeltaOp{Retain: n, Attributes: op.Attributes}
+	case op.Block != nil:
+		return op
+	default:
+		runes := []rune(op.Insert)
+		return DeltaOp{Insert: string(runes[offset : offset+n]), Attributes: op.Attributes}
+	}
+}
+
+// composeAttributes applies the attribute changes b on top of a. Null values
+// in b remove attributes; they are kept when the result is itself a change
+// (keepNull), so they still remove marks when applied.
+func composeAttributes(a, b map[string]interface{}, keepNull bool) map[string]interface{} {
+	out := map[string]interface{}{}
+	for k, v := range b {
+		if v != nil || keepNull {
+			out[k] = v
+		}
+	}
+	for k, v := range a {
+		if _, ok := b[k]; !ok {
+			out[k] = v
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// Compose returns a Delta with the effect of a followed by b.
+//
+// Status: ✅ Implemented
+func Compose(a, b Delta) Delta {
+	x, y := &opIter{ops: a.Ops}, &opIter{ops: b.Ops}
+	var out Delta
+
+	for x.hasNext() || y.hasNext() {
+		if y.peekIsInsert() {
+			out.push(y.next(infinity))
+			continue
+		}
+		if x.peekIsDelete() {
+			out.push(x.next(infinity))
+			continue
+		}
+
+		n := x.peekLength()
+		if m := y.peekLength(); m < n {
+			n = m
+		}
+		first, second := x.next(n), y.next(n)
+		switch {
+		case second.Retain > 0:
+			op := first
+			if first.Retain > 0 {
+				op = DeltaOp{Retain: n}
+			}
+			op.Attributes = composeAttributes(first.Attributes, second.Attributes, first.Retain > 0)
+			out.push(op)
+		case first.Retain > 0:
+			out.push(second)
+		default:
+			// b deletes what a inserted: both cancel out
+		}
+	}
+	return *out.chop()
+}
+
+// attrJSON converts a mark value to its Delta attribute (JSON) form
+func attrJSON(v automerge.Value) interface{} {
+	switch s := v.Scalar().(type) {
+	case automerge.String:
+		return string(s)
+	case automerge.Boolean:
+		return bool(s)
+	case automerge.Int:
+		return int64(s)
+	case automerge.Uint:
+		return uint64(s)
+	case automerge.Float:
+		return float64(s)
+	case nil, automerge.Null:
+		return nil
+	default:
+		return valueString(v)
+	}
+}
+
+// attrValue converts a Delta attribute to a mark value (ok is false for a
+// null attribute, which removes the mark)
+func attrValue(v interface{}) (automerge.Value, bool, error) {
+	switch x := v.(type) {
+	case nil:
+		return automerge.Value{}, false, nil
+	case string:
+		return automerge.NewString(x), true, nil
+	case bool:
+		return automerge.NewBool(x), true, nil
+	case int:
+		return automerge.NewInt(int64(x)), true, nil
+	case int64:
+		return automerge.NewInt(x), true, nil
+	case uint64:
+		return automerge.NewUint(x), true, nil
+	case float64:
+		return automerge.NewFloat(x), true, nil
+	case json.Number:
+		if i, err := x.Int64(); err == nil {
+			return automerge.NewInt(i), true, nil
+		}
+		f, err := x.Float64()
+		if err != nil {
+			return automerge.Value{}, false, fmt.Errorf("%w: bad number %q", ErrInvalidDelta, x)
+		}
+		return automerge.NewFloat(f), true, nil
+	default:
+		return automerge.Value{}, false, fmt.Errorf("%w: attribute values must be strings, numbers, booleans or null", ErrInvalidDelta)
+	}
+}
+
+// attrsFromMarks converts the marks of a span or patch to attributes
+func attrsFromMarks(marks map[string]automerge.Value) map[string]interface{} {
+	var attrs map[string]interface{}
+	for name, value := range marks {
+		if !isSet(value) {
+			continue
+		}
+		if attrs == nil {
+			attrs = map[string]interface{}{}
+		}
+		attrs[name] = attrJSON(value)
+	}
+	return attrs
+}
+
+// DeltaFromSpans returns a Delta inserting the whole text, for loading a
+// document into an editor.
+//
+// Status: ✅ Implemented
+func DeltaFromSpans(spans []automerge.Span) Delta {
+	var d Delta
+	for _, s := range spans {
+		if s.Block != nil {
+			d.InsertBlock(*s.Block)
+			continue
+		}
+		d.Insert(s.Text, attrsFromMarks(s.Marks))
+	}
+	return d
+}
+
+// DeltaFromPatches returns the Delta with the same effect as patches
+// (see Document.TextPatches), for sending remote edits to an editor.
+//
+// Example:
+//
+//	patches, _ := doc.TextPatches(ctx, path, lastHeads, heads)
+//	delta := richtext.DeltaFromPatches(patches)
+//	json.NewEncoder(w).Encode(delta) // {"ops":[{"retain":5},{"insert":"!"}]}
+//
+// Status: ✅ Implemented
+func DeltaFromPatches(patches []automerge.Patch) Delta {
+	var out Delta
+	for _, p := range patches {
+		var d Delta
+		switch p.Action {
+		case automerge.PatchInsert:
+			d.Retain(p.Index, nil).Insert(p.Text, attrsFromMarks(p.Marks))
+		case automerge.PatchDelete:
+			d.Retain(p.Index, nil).Delete(p.Length)
+		case automerge.PatchBlock:
+			d.Retain(p.Index, nil)
+			if p.Replace {
+				d.Delete(1)
+			}
+			if p.Block != nil {
+				d.InsertBlock(*p.Block)
+			}
+		case automerge.PatchMark:
+			attrs := map[string]interface{}{p.Mark.Name: attrJSON(p.Mark.Value)}
+			d.Retain(p.Mark.Start, nil).Retain(p.Mark.End-p.Mark.Start, attrs)
+		default:
+			continue
+		}
+		out = Compose(out, d)
+	}
+	return out
+}
+
+// ApplyDelta applies a Delta to the text at path as a single change:
+// inserts become splices (and block markers), deletes remove positions and
+// attributes set or remove marks.
+//
+// Edits made before the call are committed first. If any step fails (e.g.
+// the delta walks past the end of the text) the document is left
+// unchanged.
+//
+// Example:
+//
+//	var delta richtext.Delta
+//	json.Unmarshal([]byte(`{"ops":[{"retain":6},{"insert":"big ","attributes":{"bold":true}}]}`), &delta)
+//	err := richtext.ApplyDelta(ctx, doc, automerge.Root().Get("content"), delta, "edit")
+//
+// Status: ✅ Implemented
+func ApplyDelta(ctx context.Context, doc *automerge.Document, path automerge.Path, delta Delta, message string) error {
+	return transact(ctx, doc, message, func() error {
+		return applyDelta(ctx, doc, path, delta)
+	})
+}
+
+func applyDelta(ctx context.Context, doc *automerge.Document, path automerge.Path, delta Delta) error {
+	var at uint
+	for _, op := range delta.Ops {
+		switch {
+		case op.Block != nil:
+			if _, err := doc.SplitBlock(ctx, path, at, *op.Block); err != nil {
+				return fmt.Errorf("failed to insert block at %d: %w", at, err)
+			}
+			at++
+		case op.Insert != "":
+			n := op.length()
+			if err := doc.SpliceText(ctx, path, at, 0, op.Insert); err != nil {
+				return fmt.Errorf("failed to insert text at %d: %w", at, err)
+			}
+			if err := setMarks(ctx, doc, path, at, at+n, op.Attributes, true); err != nil {
+				return err
+			}
+			at += n
+		case op.Delete > 0:
+			if err := doc.SpliceText(ctx, path, at, int(op.Delete), ""); err != nil {
+				return fmt.Errorf("failed to delete at %d: %w", at, err)
+			}
+		default:
+			if err := setMarks(ctx, doc, path, at, at+op.Retain, op.Attributes, false); err != nil {
+				return err
+			}
+			at += op.Retain
+		}
+	}
+	return nil
+}
+
+// setMarks sets (or removes, for nil values) the marks in attrs over
+// start..end. With exact, marks not in attrs that the range inherited from
+// its neighbours are removed too.
+func setMarks(ctx context.Context, doc *automerge.Document, path automerge.Path, start, end uint, attrs map[string]interface{}, exact bool) error {
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	if exact {
+		spans, err := doc.Spans(ctx, path)
+		if err != nil {
+			return err
+		}
+		for name := range marksAt(spans, start) {
+			if _, ok := attrs[name]; !ok {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value, set, err := attrValue(attrs[name])
+		if err != nil {
+			return err
+		}
+		if !set {
+			if err := doc.Unmark(ctx, path, name, start, end, markExpand(name)); err != nil {
+				return fmt.Errorf("failed to remove mark %q: %w", name, err)
+			}
+			continue
+		}
+		mark := automerge.Mark{Name: name, Value: value, Start: start, End: end}
+		if err := doc.Mark(ctx, path, mark, markExpand(name)); err != nil {
+			return fmt.Errorf("failed to apply mark %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// marksAt returns the marks active on the character at pos
+func marksAt(spans []automerge.Span, pos uint) map[string]automerge.Value {
+	var at uint
+	for _, s := range spans {
+		n := Length([]automerge.Span{s})
+		if pos < at+n {
+			if s.Block != nil {
+				return nil
+			}
+			return s.Marks
+		}
+		at += n
+	}
+	return nil
+}
+
+// deltaOpJSON is the Quill wire format of a DeltaOp
+type deltaOpJSON struct {
+	Insert     json.RawMessage        `json:"insert,omitempty"`
+	Delete     uint                   `json:"delete,omitempty"`
+	Retain     uint                   `json:"retain,omitempty"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// blockEmbedJSON is the embed form of a block marker
+type blockEmbedJSON struct {
+	Block *embeddedBlockJSON `json:"block"`
+}
+
+type embeddedBlockJSON struct {
+	Type    string                 `json:"type"`
+	Parents []string               `json:"parents"`
+	Attrs   map[string]interface{} `json:"attrs"`
+}
+
+// MarshalJSON encodes the delta as {"ops": [...]}
+func (d Delta) MarshalJSON() ([]byte, error) {
+	ops := make([]deltaOpJSON, len(d.Ops))
+	for i, op := range d.Ops {
+		w := deltaOpJSON{Delete: op.Delete, Retain: op.Retain, Attributes: op.Attributes}
+		var err error
+		switch {
+		case op.Block != nil:
+			parents := op.Block.Parents
+			if parents == nil {
+				parents = []string{}
+			}
+			attrs := op.Block.Attrs
+			if attrs == nil {
+				attrs = map[string]interface{}{}
+			}
+			w.Insert, err = json.Marshal(blockEmbedJSON{&embeddedBlockJSON{Type: op.Block.Type, Parents: parents, Attrs: attrs}})
+		case op.Insert != "":
+			w.Insert, err = json.Marshal(op.Insert)
+		}
+		if err != nil {
+			return nil, err
+		}
+		ops[i] = w
+	}
+	return json.Marshal(struct {
+		Ops []deltaOpJSON `json:"ops"`
+	}{ops})
+}
+
+// UnmarshalJSON decodes {"ops": [...]}, rejecting operations and attribute
+// values ApplyDelta can't write
+func (d *Delta) UnmarshalJSON(data []byte) error {
+	var wire struct {
+		Ops []deltaOpJSON `json:"ops"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&wire); err != nil {
+		return err
+	}
+
+	d.Ops = nil
+	for i, w := range wire.Ops {
+		op := DeltaOp{Delete: w.Delete, Retain: w.Retain, Attributes: w.Attributes}
+		for _, v := range w.Attributes {
+			if _, _, err := attrValue(v); err != nil {
+				return fmt.Errorf("op %d: %w", i, err)
+			}
+		}
+
+		if len(w.Insert) > 0 {
+			if err := json.Unmarshal(w.Insert, &op.Insert); err != nil {
+				var embed blockEmbedJSON
+				if err := json.Unmarshal(w.Insert, &embed); err != nil || embed.Block == nil {
+					return fmt.Errorf("op %d: %w: only text and block embeds can be inserted", i, ErrInvalidDelta)
+				}
+				op.Block = &automerge.Block{Type: embed.Block.Type, Parents: embed.Block.Parents, Attrs: embed.Block.Attrs}
+			}
+		}
+
+		kinds := 0
+		for _, set := range []bool{op.isInsert(), op.Delete > 0, op.Retain > 0} {
+			if set {
+				kinds++
+			}
+		}
+		if kinds != 1 {
+			return fmt.Errorf("op %d: %w: expected one of insert, delete or retain", i, ErrInvalidDelta)
+		}
+		d.Ops = append(d.Ops, op)
+	}
+	return nil
+}
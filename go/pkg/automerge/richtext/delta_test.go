@@ -0,0 +1,285 @@
+package richtext
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+)
+
+// deltaJSON renders a delta for comparison in tests
+func deltaJSON(t *testing.T, d Delta) string {
+	t.Helper()
+	data, err := json.Marshal(d)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	return string(data)
+}
+
+// TestDelta_Push tests that adjacent operations merge like in Quill
+func TestDelta_Push(t *testing.T) {
+	boldAttr := map[string]interface{}{"bold": true}
+
+	d := new(Delta).Insert("ab", nil).Insert("c", nil).Insert("d", boldAttr).Retain(2, nil).Retain(1, nil).Delete(1).Delete(2).Insert("x", nil)
+	want := `{"ops":[{"insert":"abc"},{"insert":"d","attributes":{"bold":true}},{"retain":3},{"insert":"x"},{"delete":3}]}`
+	if got := deltaJSON(t, *d); got != want {
+		t.Errorf("delta = %s, want %s", got, want)
+	}
+
+	// Inserts after a leading delete go first
+	d = new(Delta).Delete(1).Insert("a", nil)
+	if got := deltaJSON(t, *d); got != `{"ops":[{"insert":"a"},{"delete":1}]}` {
+		t.Errorf("delta = %s", got)
+	}
+}
+
+// TestCompose tests combining two deltas into one
+func TestCompose(t *testing.T) {
+	boldAttr := map[string]interface{}{"bold": true}
+	unbold := map[string]interface{}{"bold": nil}
+
+	tests := []struct {
+		name string
+		a, b *Delta
+		want string
+	}{
+		{
+			name: "insert into insert",
+			a:    new(Delta).Insert("Hello", nil),
+			b:    new(Delta).Retain(5, nil).Insert(" World", nil),
+			want: `{"ops":[{"insert":"Hello World"}]}`,
+		},
+		{
+			name: "delete cancels insert",
+			a:    new(Delta).Insert("abc", nil),
+			b:    new(Delta).Retain(1, nil).Delete(1),
+			want: `{"ops":[{"insert":"ac"}]}`,
+		},
+		{
+			name: "format inserted text",
+			a:    new(Delta).Insert("abc", nil),
+			b:    new(Delta).Retain(2, boldAttr),
+			want: `{"ops":[{"insert":"ab","attributes":{"bold":true}},{"insert":"c"}]}`,
+		},
+		{
+			name: "remove format from inserted text",
+			a:    new(Delta).Insert("ab", boldAttr),
+			b:    new(Delta).Retain(1, unbold),
+			want: `{"ops":[{"insert":"a"},{"insert":"b","attributes":{"bold":true}}]}`,
+		},
+		{
+			name: "removals are kept on retains",
+			a:    new(Delta).Retain(3, boldAttr),
+			b:    new(Delta).Retain(1, unbold),
+			want: `{"ops":[{"retain":1,"attributes":{"bold":null}},{"retain":2,"attributes":{"bold":true}}]}`,
+		},
+		{
+			name: "edits at different positions",
+			a:    new(Delta).Retain(2, nil).Delete(1),
+			b:    new(Delta).Insert("x", nil),
+			want: `{"ops":[{"insert":"x"},{"retain":2},{"delete":1}]}`,
+		},
+		{
+			name: "unicode positions are characters",
+			a:    new(Delta).Insert("héllo", nil),
+			b:    new(Delta).Retain(2, nil).Delete(1),
+			want: `{"ops":[{"insert":"hélo"}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := deltaJSON(t, Compose(*tt.a, *tt.b)); got != tt.want {
+				t.Errorf("Compose = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestDelta_JSON tests decoding Quill deltas, including block embeds
+func TestDelta_JSON(t *testing.T) {
+	src := `{"ops":[{"insert":{"block":{"type":"heading","parents":[],"attrs":{"level":1}}}},` +
+		`{"insert":"Title","attributes":{"bold":true,"size":12}},{"retain":3,"attributes":{"italic":null}},{"delete":2}]}`
+
+	var d Delta
+	if err := json.Unmarshal([]byte(src), &d); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if len(d.Ops) != 4 || d.Ops[0].Block == nil || d.Ops[0].Block.Type != "heading" ||
+		d.Ops[1].Insert != "Title" || d.Ops[2].Retain != 3 || d.Ops[3].Delete != 2 {
+		t.Fatalf("ops = %+v", d.Ops)
+	}
+	if v, set, err := attrValue(d.Ops[1].Attributes["size"]); err != nil || !set || v.Scalar() != automerge.Int(12) {
+		t.Errorf("size = %v, %v, %v", v, set, err)
+	}
+	if got := deltaJSON(t, d); got != src {
+		t.Errorf("round trip = %s\nwant %s", got, src)
+	}
+
+	for _, bad := range []string{
+		`{"ops":[{"insert":{"image":"a.png"}}]}`,
+		`{"ops":[{"insert":"x","attributes":{"color":{"r":1}}}]}`,
+		`{"ops":[{"retain":1,"delete":1}]}`,
+		`{"ops":[{}]}`,
+	} {
+		if err := json.Unmarshal([]byte(bad), &d); !errors.Is(err, ErrInvalidDelta) {
+			t.Errorf("Unmarshal(%s) error = %v, want ErrInvalidDelta", bad, err)
+		}
+	}
+}
+
+// TestDeltaFromSpans tests converting a whole document to a delta
+func TestDeltaFromSpans(t *testing.T) {
+	spans := []automerge.Span{
+		block("heading", nil, map[string]interface{}{"level": int64(1)}),
+		text("Hi ", nil),
+		text("there", map[string]automerge.Value{"link": automerge.NewString("https://a.org"), "bold": automerge.NewBool(false)}),
+	}
+	want := `{"ops":[{"insert":{"block":{"type":"heading","parents":[],"attrs":{"level":1}}}},` +
+		`{"insert":"Hi "},{"insert":"there","attributes":{"link":"https://a.org"}}]}`
+	if got := deltaJSON(t, DeltaFromSpans(spans)); got != want {
+		t.Errorf("DeltaFromSpans = %s\nwant %s", got, want)
+	}
+}
+
+// TestDeltaFromPatches tests converting a patch stream to a single delta
+func TestDeltaFromPatches(t *testing.T) {
+	patches := []automerge.Patch{
+		{Action: automerge.PatchInsert, Index: 5, Text: " World"},
+		{Action: automerge.PatchDelete, Index: 0, Length: 1},
+		{Action: automerge.PatchInsert, Index: 0, Text: "J", Marks: map[string]automerge.Value{"bold": automerge.NewBool(true)}},
+		{Action: automerge.PatchMark, Mark: automerge.Mark{Name: "italic", Value: automerge.NewBool(true), Start: 1, End: 3}},
+		{Action: automerge.PatchMark, Mark: automerge.Mark{Name: "bold", Value: automerge.NewNull(), Start: 3, End: 4}},
+		{Action: automerge.PatchBlock, Index: 0, Block: &automerge.Block{Type: "paragraph"}},
+	}
+	want := `{"ops":[{"insert":{"block":{"type":"paragraph","parents":[],"attrs":{}}}},` +
+		`{"insert":"J","attributes":{"bold":true}},{"delete":1},{"retain":2,"attributes":{"italic":true}},` +
+		`{"retain":1,"attributes":{"bold":null}},{"retain":1},{"insert":" World"}]}`
+	if got := deltaJSON(t, DeltaFromPatches(patches)); got != want {
+		t.Errorf("DeltaFromPatches = %s\nwant %s", got, want)
+	}
+}
+
+// TestApplyDelta tests applying an editor delta as one change
+func TestApplyDelta(t *testing.T) {
+	ctx := context.Background()
+	doc, err := automerge.NewWithWASM(ctx, testWASMPath)
+	if err != nil {
+		t.Fatalf("Failed to create document: %v", err)
+	}
+	defer doc.Close(ctx)
+
+	path := automerge.Root().Get("content")
+	if err := Replace(ctx, doc, path, []automerge.Span{text("Hello World", bold)}, ""); err != nil {
+		t.Fatalf("Replace failed: %v", err)
+	}
+	before, err := doc.GetHeads(ctx)
+	if err != nil {
+		t.Fatalf("GetHeads failed: %v", err)
+	}
+
+	// "Hello World" (bold) → "Hello big World" with only "big" italic and
+	// "World" no longer bold
+	var delta Delta
+	src := `{"ops":[{"retain":6},{"insert":"big ","attributes":{"italic":true}},{"retain":5,"attributes":{"bold":null}}]}`
+	if err := json.Unmarshal([]byte(src), &delta); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if err := ApplyDelta(ctx, doc, path, delta, "edit"); err != nil {
+		t.Fatalf("ApplyDelta failed: %v", err)
+	}
+
+	spans, err := doc.Spans(ctx, path)
+	if err != nil {
+		t.Fatalf("Spans failed: %v", err)
+	}
+	want := []automerge.Span{
+		text("Hello ", bold),
+		text("big ", map[string]automerge.Value{"italic": automerge.NewBool(true)}),
+		text("World", nil),
+	}
+	if dumpSpans(spans) != dumpSpans(want) {
+		t.Errorf("Spans =\n%s\nwant\n%s", dumpSpans(spans), dumpSpans(want))
+	}
+
+	// The patches since before convert back to an equivalent delta
+	after, err := doc.GetHeads(ctx)
+	if err != nil {
+		t.Fatalf("GetHeads failed: %v", err)
+	}
+	patches, err := doc.TextPatches(ctx, path, before, after)
+	if err != nil {
+		t.Fatalf("TextPatches failed: %v", err)
+	}
+	if got := deltaJSON(t, DeltaFromPatches(patches)); got != deltaJSON(t, delta) {
+		t.Errorf("DeltaFromPatches = %s, want %s", got, deltaJSON(t, delta))
+	}
+
+	// Walking past the end fails and changes nothing
+	if err := ApplyDelta(ctx, doc, path, *new(Delta).Retain(100, nil).Insert("x", nil), ""); err == nil {
+		t.Error("expected error for a delta longer than the text")
+	}
+	if got, _ := doc.GetText(ctx, path); got != "Hello big World" {
+		t.Errorf("text = %q after failed delta", got)
+	}
+}
+
+// TestApplyDelta_NestedText tests that deltas format a text object other
+// than ROOT.content, and leave ROOT.content alone
+func TestApplyDelta_NestedText(t *testing.T) {
+	ctx := context.Background()
+	doc, err := automerge.NewWithWASM(ctx, testWASMPath)
+	if err != nil {
+		t.Fatalf("Failed to create document: %v", err)
+	}
+	defer doc.Close(ctx)
+
+	content := automerge.Root().Get("content")
+	if err := Replace(ctx, doc, content, []automerge.Span{text("Hello World", bold)}, ""); err != nil {
+		t.Fatalf("Replace failed: %v", err)
+	}
+	path := automerge.Root().Get("notes")
+	if err := Replace(ctx, doc, path, []automerge.Span{text("Hello World", bold)}, ""); err != nil {
+		t.Fatalf("Replace failed: %v", err)
+	}
+
+	var delta Delta
+	src := `{"ops":[{"retain":6},{"retain":5,"attributes":{"bold":null,"italic":true}}]}`
+	if err := json.Unmarshal([]byte(src), &delta); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if err := ApplyDelta(ctx, doc, path, delta, "edit"); err != nil {
+		t.Fatalf("ApplyDelta failed: %v", err)
+	}
+
+	spans, err := doc.Spans(ctx, path)
+	if err != nil {
+		t.Fatalf("Spans failed: %v", err)
+	}
+	want := []automerge.Span{
+		text("Hello ", bold),
+		text("World", map[string]automerge.Value{"italic": automerge.NewBool(true)}),
+	}
+	if dumpSpans(spans) != dumpSpans(want) {
+		t.Errorf("Spans =\n%s\nwant\n%s", dumpSpans(spans), dumpSpans(want))
+	}
+
+	marks, err := doc.GetMarks(ctx, path, 8)
+	if err != nil {
+		t.Fatalf("GetMarks failed: %v", err)
+	}
+	if len(marks) != 1 || marks[0].Name != "italic" {
+		t.Errorf("GetMarks(8) = %+v, want italic only", marks)
+	}
+
+	spans, err = doc.Spans(ctx, content)
+	if err != nil {
+		t.Fatalf("Spans failed: %v", err)
+	}
+	if want := []automerge.Span{text("Hello World", bold)}; dumpSpans(spans) != dumpSpans(want) {
+		t.Errorf("ROOT.content spans =\n%s\nwant\n%s", dumpSpans(spans), dumpSpans(want))
+	}
+}
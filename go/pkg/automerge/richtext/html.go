@@ -0,0 +1,230 @@
+// ==============================================================================
+// Layer 4: Go High-Level CRDT API - Rich Text Export (HTML)
+// ==============================================================================
+// ARCHITECTURE: Helper sub-package of the high-level Go API layer (Layer 4/7).
+//
+// RESPONSIBILITIES:
+// - Render spans, marks and blocks to sanitized HTML
+// - Configurable mark → tag mapping (HTMLOptions)
+//
+// DEPENDENCIES:
+// - pkg/automerge (Span, Block, Value types only - no WASM calls)
+//
+// DEPENDENTS:
+// - Layer 6: pkg/api (GET /api/richtext/export?format=html)
+//
+// RELATED FILES:
+// - pkg/automerge/richtext/richtext.go (block grouping, mark walking)
+// - pkg/automerge/richtext/markdown.go (Markdown exporter)
+//
+// NOTES:
+// - All text and attribute values are escaped; URL attributes (href, src,
+//   cite) only accept relative, http, https and mailto URLs
+// - Mark tags and attributes are validated, so a bad mapping drops the mark
+//   rather than producing markup (script/style/event handlers are refused)
+// - Newlines inside a block become <br>
+// ==============================================================================
+
+package richtext
+
+import (
+	"html"
+	"strconv"
+	"strings"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+)
+
+// HTMLMark describes how a mark renders in HTML
+type HTMLMark struct {
+	Tag  string // Element name, e.g. "strong"
+	Attr string // Attribute that receives the mark value, e.g. "href" ("" = none)
+}
+
+// HTMLOptions configures the HTML exporter
+type HTMLOptions struct {
+	// Marks maps mark names to elements; marks not listed render as plain
+	// text. Nil uses DefaultHTMLMarks.
+	Marks map[string]HTMLMark
+}
+
+// DefaultHTMLMarks returns the default mark → element mapping
+func DefaultHTMLMarks() map[string]HTMLMark {
+	return map[string]HTMLMark{
+		"bold":          {Tag: "strong"},
+		"italic":        {Tag: "em"},
+		"underline":     {Tag: "u"},
+		"strikethrough": {Tag: "s"},
+		"highlight":     {Tag: "mark"},
+		"code":          {Tag: "code"},
+		"link":          {Tag: "a", Attr: "href"},
+	}
+}
+
+// unsafeTags may never be produced by a mark mapping
+var unsafeTags = map[string]bool{
+	"script": true, "style": true, "iframe": true, "object": true,
+	"embed": true, "link": true, "meta": true, "base": true, "form": true,
+}
+
+// urlAttrs hold URLs and are checked with safeURL
+var urlAttrs = map[string]bool{"href": true, "src": true, "cite": true}
+
+// validName reports whether s is a plain lowercase element/attribute name
+func validName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		if !(r >= 'a' && r <= 'z') && !(i > 0 && (r >= '0' && r <= '9' || r == '-')) {
+			return false
+		}
+	}
+	return true
+}
+
+// HTML renders rich text spans as an HTML fragment.
+//
+// Example:
+//
+//	spans, _ := doc.Spans(ctx, automerge.Root().Get("content"))
+//	out := richtext.HTML(spans, richtext.HTMLOptions{})
+//	// <h2>Title</h2><p>Some <strong>bold</strong> text</p>
+//
+// Status: ✅ Implemented
+func HTML(spans []automerge.Span, opts HTMLOptions) string {
+	marks := opts.Marks
+	if marks == nil {
+		marks = DefaultHTMLMarks()
+	}
+	w := &htmlWriter{marks: marks}
+
+	var lists []bool // open lists, innermost last (true = <ol>)
+	for _, sec := range sections(spans) {
+		path := listPath(sec)
+
+		// Keep the open lists this item shares, close the rest
+		common := 0
+		for common < len(lists) && common < len(path) && lists[common] == path[common] {
+			common++
+		}
+		for len(lists) > common {
+			w.b.WriteString("</li>" + listTag(lists[len(lists)-1], true))
+			lists = lists[:len(lists)-1]
+		}
+		if len(path) > 0 && len(path) == common {
+			w.b.WriteString("</li>") // next item of the same list
+		}
+		for _, ordered := range path[common:] {
+			w.b.WriteString(listTag(ordered, false))
+			lists = append(lists, ordered)
+		}
+		if len(path) > 0 {
+			w.b.WriteString("<li>")
+			w.inline(sec.spans)
+			continue
+		}
+
+		w.block(sec)
+	}
+	for i := len(lists) - 1; i >= 0; i-- {
+		w.b.WriteString("</li>" + listTag(lists[i], true))
+	}
+	return w.b.String()
+}
+
+func listTag(ordered, closing bool) string {
+	tag := "ul"
+	if ordered {
+		tag = "ol"
+	}
+	if closing {
+		return "</" + tag + ">"
+	}
+	return "<" + tag + ">"
+}
+
+type htmlWriter struct {
+	b     strings.Builder
+	marks map[string]HTMLMark
+}
+
+// block renders a non-list block
+func (w *htmlWriter) block(sec section) {
+	attrs := sec.attrs()
+	switch sec.blockType() {
+	case BlockHeading:
+		tag := "h" + strconv.Itoa(headingLevel(attrs))
+		w.b.WriteString("<" + tag + ">")
+		w.inline(sec.spans)
+		w.b.WriteString("</" + tag + ">")
+	case BlockQuote:
+		w.b.WriteString("<blockquote><p>")
+		w.inline(sec.spans)
+		w.b.WriteString("</p></blockquote>")
+	case BlockCode:
+		w.b.WriteString("<pre><code")
+		if lang := safeLanguage(attrString(attrs, "language")); lang != "" {
+			w.b.WriteString(` class="language-` + lang + `"`)
+		}
+		w.b.WriteString(">" + html.EscapeString(sec.text()) + "</code></pre>")
+	case BlockImage:
+		src, ok := safeURL(attrString(attrs, "src"))
+		if !ok {
+			return
+		}
+		w.b.WriteString(`<img src="` + html.EscapeString(src) + `" alt="` + html.EscapeString(attrString(attrs, "alt")) + `"`)
+		if title := attrString(attrs, "title"); title != "" {
+			w.b.WriteString(` title="` + html.EscapeString(title) + `"`)
+		}
+		w.b.WriteString(">")
+	default:
+		w.b.WriteString("<p>")
+		w.inline(sec.spans)
+		w.b.WriteString("</p>")
+	}
+}
+
+func (w *htmlWriter) inline(spans []automerge.Span) {
+	walkMarks(spans, w.renders, w)
+}
+
+// renders reports whether a mark has a valid, safe mapping for this value
+func (w *htmlWriter) renders(name string, value automerge.Value) bool {
+	m, ok := w.marks[name]
+	if !ok || !validName(m.Tag) || unsafeTags[m.Tag] {
+		return false
+	}
+	if m.Attr == "" {
+		return true
+	}
+	if !validName(m.Attr) || strings.HasPrefix(m.Attr, "on") || m.Attr == "style" {
+		return false
+	}
+	if urlAttrs[m.Attr] {
+		_, ok := safeURL(valueString(value))
+		return ok
+	}
+	return true
+}
+
+func (w *htmlWriter) open(name string, value automerge.Value) {
+	m := w.marks[name]
+	w.b.WriteString("<" + m.Tag)
+	if m.Attr != "" {
+		v := valueString(value)
+		if urlAttrs[m.Attr] {
+			v, _ = safeURL(v)
+		}
+		w.b.WriteString(" " + m.Attr + `="` + html.EscapeString(v) + `"`)
+	}
+	w.b.WriteString(">")
+}
+
+func (w *htmlWriter) close(name string, value automerge.Value) {
+	w.b.WriteString("</" + w.marks[name].Tag + ">")
+}
+
+func (w *htmlWriter) text(s string) {
+	w.b.WriteString(strings.ReplaceAll(html.EscapeString(s), "\n", "<br>"))
+}
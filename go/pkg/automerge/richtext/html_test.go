@@ -0,0 +1,126 @@
+package richtext
+
+import (
+	"testing"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+)
+
+func text(s string, marks map[string]automerge.Value) automerge.Span {
+	return automerge.Span{Text: s, Marks: marks}
+}
+
+func block(typ string, parents []string, attrs map[string]interface{}) automerge.Span {
+	return automerge.Span{Block: &automerge.Block{Type: typ, Parents: parents, Attrs: attrs}}
+}
+
+var bold = map[string]automerge.Value{"bold": automerge.NewBool(true)}
+
+// TestHTML tests rendering marks and blocks to HTML
+func TestHTML(t *testing.T) {
+	tests := []struct {
+		name  string
+		spans []automerge.Span
+		want  string
+	}{
+		{
+			name:  "plain text",
+			spans: []automerge.Span{text("Hello\nWorld", nil)},
+			want:  "<p>Hello<br>World</p>",
+		},
+		{
+			name: "overlapping marks nest",
+			spans: []automerge.Span{
+				text("a", bold),
+				text("b", map[string]automerge.Value{"bold": automerge.NewBool(true), "italic": automerge.NewBool(true)}),
+				text("c", map[string]automerge.Value{"italic": automerge.NewBool(true)}),
+			},
+			want: "<p><strong>a<em>b</em></strong><em>c</em></p>",
+		},
+		{
+			name: "cleared and unmapped marks",
+			spans: []automerge.Span{
+				text("a", map[string]automerge.Value{"bold": automerge.NewBool(false)}),
+				text("b", map[string]automerge.Value{"comment": automerge.NewString("x")}),
+			},
+			want: "<p>ab</p>",
+		},
+		{
+			name: "headings and paragraphs",
+			spans: []automerge.Span{
+				block("heading", nil, map[string]interface{}{"level": int64(2)}),
+				text("Title", nil),
+				block("paragraph", nil, nil),
+				text("Body", bold),
+			},
+			want: "<h2>Title</h2><p><strong>Body</strong></p>",
+		},
+		{
+			name: "nested lists",
+			spans: []automerge.Span{
+				block("unordered-list-item", nil, nil),
+				text("one", nil),
+				block("ordered-list-item", []string{"unordered-list-item"}, nil),
+				text("one.a", nil),
+				block("unordered-list-item", nil, nil),
+				text("two", nil),
+				block("paragraph", nil, nil),
+				text("after", nil),
+			},
+			want: "<ul><li>one<ol><li>one.a</li></ol></li><li>two</li></ul><p>after</p>",
+		},
+		{
+			name: "code block",
+			spans: []automerge.Span{
+				block("code-block", nil, map[string]interface{}{"language": `go"><script>`}),
+				text("a < b", bold),
+			},
+			want: `<pre><code class="language-goscript">a &lt; b</code></pre>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HTML(tt.spans, HTMLOptions{}); got != tt.want {
+				t.Errorf("HTML() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestHTML_Sanitized tests that text, values and mappings cannot inject markup
+func TestHTML_Sanitized(t *testing.T) {
+	spans := []automerge.Span{
+		text("<script>alert(1)</script>", nil),
+		text("ok", map[string]automerge.Value{"link": automerge.NewString(`https://example.com/?a="b"`)}),
+		text("bad", map[string]automerge.Value{"link": automerge.NewString("javascript:alert(1)")}),
+		text("x", map[string]automerge.Value{"evil": automerge.NewString("1")}),
+		block("image", nil, map[string]interface{}{"src": "data:text/html,hi", "alt": "a"}),
+	}
+	opts := HTMLOptions{Marks: DefaultHTMLMarks()}
+	opts.Marks["evil"] = HTMLMark{Tag: "a", Attr: "onclick"}
+
+	want := `<p>&lt;script&gt;alert(1)&lt;/script&gt;<a href="https://example.com/?a=&#34;b&#34;">ok</a>badx</p>`
+	if got := HTML(spans, opts); got != want {
+		t.Errorf("HTML() = %q, want %q", got, want)
+	}
+}
+
+// TestHTML_CustomMarks tests a custom mark → tag mapping
+func TestHTML_CustomMarks(t *testing.T) {
+	spans := []automerge.Span{
+		text("Hi", map[string]automerge.Value{
+			"bold":    automerge.NewBool(true),
+			"comment": automerge.NewString("c1"),
+		}),
+	}
+	opts := HTMLOptions{Marks: map[string]HTMLMark{
+		"bold":    {Tag: "b"},
+		"comment": {Tag: "span", Attr: "data-comment"},
+	}}
+
+	want := `<p><b><span data-comment="c1">Hi</span></b></p>`
+	if got := HTML(spans, opts); got != want {
+		t.Errorf("HTML() = %q, want %q", got, want)
+	}
+}
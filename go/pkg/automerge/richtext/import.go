@@ -0,0 +1,264 @@
+// ==============================================================================
+// Layer 4: Go High-Level CRDT API - Rich Text Import
+// ==============================================================================
+// ARCHITECTURE: Helper sub-package of the high-level Go API layer (Layer 4/7).
+//
+// RESPONSIBILITIES:
+// - Write parsed rich text (spans) into a text object as splices, block
+//   markers and marks
+// - Make the whole import one change, or nothing on failure
+//
+// DEPENDENCIES:
+// - pkg/automerge (Document: SpliceText, SplitBlock, Mark, Commit, Rollback)
+//
+// DEPENDENTS:
+// - Layer 5: pkg/server (ImportRichText, PasteRichText)
+//
+// RELATED FILES:
+// - pkg/automerge/richtext/parse_html.go (HTML → spans)
+// - pkg/automerge/richtext/parse_markdown.go (Markdown → spans)
+//
+// NOTES:
+// - Positions are character offsets; block markers count as one character
+// - Imported marks expand after their end (links don't expand), like typing
+//   in an editor would
+// ==============================================================================
+
+package richtext
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+)
+
+// spanBuilder accumulates spans, merging adjacent text with equal marks
+type spanBuilder struct {
+	spans []automerge.Span
+}
+
+// text appends s with a copy of marks
+func (b *spanBuilder) text(s string, marks map[string]automerge.Value) {
+	if s == "" {
+		return
+	}
+	if n := len(b.spans); n > 0 && b.spans[n-1].Block == nil && sameMarks(b.spans[n-1].Marks, marks) {
+		b.spans[n-1].Text += s
+		return
+	}
+	var copied map[string]automerge.Value
+	if len(marks) > 0 {
+		copied = make(map[string]automerge.Value, len(marks))
+		for k, v := range marks {
+			copied[k] = v
+		}
+	}
+	b.spans = append(b.spans, automerge.Span{Text: s, Marks: copied})
+}
+
+// trimSpace removes one trailing space from the last text span
+func (b *spanBuilder) trimSpace() {
+	n := len(b.spans)
+	if n == 0 || b.spans[n-1].Block != nil || !strings.HasSuffix(b.spans[n-1].Text, " ") {
+		return
+	}
+	b.spans[n-1].Text = strings.TrimSuffix(b.spans[n-1].Text, " ")
+	if b.spans[n-1].Text == "" {
+		b.spans = b.spans[:n-1]
+	}
+}
+
+// block appends a block marker
+func (b *spanBuilder) block(typ string, parents []string, attrs map[string]interface{}) {
+	if attrs == nil {
+		attrs = map[string]interface{}{}
+	}
+	b.spans = append(b.spans, automerge.Span{Block: &automerge.Block{
+		Type:    typ,
+		Parents: append([]string(nil), parents...),
+		Attrs:   attrs,
+	}})
+}
+
+// result returns the spans. A lone paragraph marker is dropped, so plain
+// text imports as plain text.
+func (b *spanBuilder) result() []automerge.Span {
+	blocks := 0
+	for _, s := range b.spans {
+		if s.Block != nil {
+			blocks++
+		}
+	}
+	if blocks == 1 && len(b.spans) > 0 && b.spans[0].Block != nil && b.spans[0].Block.Type == BlockParagraph {
+		return b.spans[1:]
+	}
+	return b.spans
+}
+
+func sameMarks(a, b map[string]automerge.Value) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		w, ok := b[k]
+		if !ok || !reflect.DeepEqual(v.Scalar(), w.Scalar()) {
+			return false
+		}
+	}
+	return true
+}
+
+// markRange is a run of characters carrying one mark value
+type markRange struct {
+	name       string
+	value      automerge.Value
+	start, end uint
+}
+
+// layout computes the plain text, block marker positions and mark ranges of
+// spans inserted at pos
+func layout(spans []automerge.Span, pos uint) (string, []uint, []*automerge.Block, []markRange) {
+	var text []byte
+	var markers []uint
+	var blocks []*automerge.Block
+	var ranges []markRange
+	open := map[string]int{} // mark name → index in ranges of its current run
+
+	at := pos
+	for _, s := range spans {
+		if s.Block != nil {
+			markers = append(markers, at)
+			blocks = append(blocks, s.Block)
+			at++
+			open = map[string]int{} // marks don't span block markers
+			continue
+		}
+		n := uint(utf8.RuneCountInString(s.Text))
+		if n == 0 {
+			continue
+		}
+		for name := range open {
+			if v, ok := s.Marks[name]; !ok || !reflect.DeepEqual(v.Scalar(), ranges[open[name]].value.Scalar()) || ranges[open[name]].end != at {
+				delete(open, name)
+			}
+		}
+		for name, value := range s.Marks {
+			if !isSet(value) {
+				continue
+			}
+			if i, ok := open[name]; ok {
+				ranges[i].end = at + n
+				continue
+			}
+			open[name] = len(ranges)
+			ranges = append(ranges, markRange{name: name, value: value, start: at, end: at + n})
+		}
+		text = append(text, s.Text...)
+		at += n
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].start != ranges[j].start {
+			return ranges[i].start < ranges[j].start
+		}
+		return ranges[i].name < ranges[j].name
+	})
+	return string(text), markers, blocks, ranges
+}
+
+// Length returns the number of positions spans occupy in a text object
+// (characters plus one per block marker)
+func Length(spans []automerge.Span) uint {
+	var n uint
+	for _, s := range spans {
+		if s.Block != nil {
+			n++
+			continue
+		}
+		n += uint(utf8.RuneCountInString(s.Text))
+	}
+	return n
+}
+
+// Splice deletes del positions at pos in the text at path and inserts
+// spans there (text, block markers and marks), as a single change.
+//
+// Edits made before the call are committed first. If any step fails the
+// import is rolled back and the document is left unchanged.
+//
+// Example:
+//
+//	spans, _ := richtext.ParseMarkdown("# Notes\n\nSome **bold** text", richtext.MarkdownOptions{})
+//	err := richtext.Splice(ctx, doc, automerge.Root().Get("content"), 0, 0, spans, "import notes")
+//
+// Status: ✅ Implemented
+func Splice(ctx context.Context, doc *automerge.Document, path automerge.Path, pos, del uint, spans []automerge.Span, message string) error {
+	return transact(ctx, doc, message, func() error {
+		return splice(ctx, doc, path, pos, del, spans)
+	})
+}
+
+// transact runs fn as a single change: committed with message if fn
+// succeeds, rolled back if it fails
+func transact(ctx context.Context, doc *automerge.Document, message string, fn func() error) error {
+	// Close earlier edits so a rollback only discards ours
+	if _, err := doc.GetHeads(ctx); err != nil {
+		return err
+	}
+
+	if err := fn(); err != nil {
+		if _, rbErr := doc.Rollback(ctx); rbErr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+		return err
+	}
+	_, err := doc.Commit(ctx, message)
+	return err
+}
+
+// Replace replaces the whole text at path with spans, as a single change
+//
+// Status: ✅ Implemented
+func Replace(ctx context.Context, doc *automerge.Document, path automerge.Path, spans []automerge.Span, message string) error {
+	current, err := doc.Spans(ctx, path)
+	if err != nil {
+		return err
+	}
+	return Splice(ctx, doc, path, 0, Length(current), spans, message)
+}
+
+func splice(ctx context.Context, doc *automerge.Document, path automerge.Path, pos, del uint, spans []automerge.Span) error {
+	text, markers, blocks, ranges := layout(spans, pos)
+
+	if err := doc.SpliceText(ctx, path, pos, int(del), text); err != nil {
+		return fmt.Errorf("failed to insert text: %w", err)
+	}
+	// Ascending order: each marker lands at its final index because all
+	// markers before it are already in place
+	for i, at := range markers {
+		if _, err := doc.SplitBlock(ctx, path, at, *blocks[i]); err != nil {
+			return fmt.Errorf("failed to insert block at %d: %w", at, err)
+		}
+	}
+	for _, r := range ranges {
+		mark := automerge.Mark{Name: r.name, Value: r.value, Start: r.start, End: r.end}
+		if err := doc.Mark(ctx, path, mark, markExpand(r.name)); err != nil {
+			return fmt.Errorf("failed to apply mark %q: %w", r.name, err)
+		}
+	}
+	return nil
+}
+
+// markExpand is how imported and edited marks expand: after their end, like
+// typing in an editor, except links
+func markExpand(name string) automerge.ExpandMark {
+	if name == "link" {
+		return automerge.ExpandNone
+	}
+	return automerge.ExpandAfter
+}
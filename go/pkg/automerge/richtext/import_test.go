@@ -0,0 +1,114 @@
+package richtext
+
+import (
+	"context"
+	"testing"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+)
+
+// testWASMPath is automerge.TestWASMPath seen from this sub-package
+const testWASMPath = "../" + automerge.TestWASMPath
+
+// TestLayout tests computing text, marker positions and mark ranges
+func TestLayout(t *testing.T) {
+	spans := []automerge.Span{
+		block("heading", nil, nil),
+		text("ab", bold),
+		text("c", map[string]automerge.Value{"bold": automerge.NewBool(true), "italic": automerge.NewBool(true)}),
+		block("paragraph", nil, nil),
+		text("d", bold),
+	}
+
+	text, markers, blocks, ranges := layout(spans, 10)
+	if text != "abcd" {
+		t.Errorf("text = %q", text)
+	}
+	if len(markers) != 2 || markers[0] != 10 || markers[1] != 14 || blocks[0].Type != "heading" {
+		t.Errorf("markers = %v", markers)
+	}
+	want := []markRange{
+		{name: "bold", start: 11, end: 14},
+		{name: "italic", start: 13, end: 14},
+		{name: "bold", start: 15, end: 16},
+	}
+	if len(ranges) != len(want) {
+		t.Fatalf("ranges = %+v", ranges)
+	}
+	for i, r := range ranges {
+		if r.name != want[i].name || r.start != want[i].start || r.end != want[i].end {
+			t.Errorf("range %d = %+v, want %+v", i, r, want[i])
+		}
+	}
+	if Length(spans) != 6 {
+		t.Errorf("Length = %d, want 6", Length(spans))
+	}
+}
+
+// TestReplace tests importing Markdown into a document as one change
+func TestReplace(t *testing.T) {
+	ctx := context.Background()
+	doc, err := automerge.NewWithWASM(ctx, testWASMPath)
+	if err != nil {
+		t.Fatalf("Failed to create document: %v", err)
+	}
+	defer doc.Close(ctx)
+
+	path := automerge.Root().Get("content")
+	if err := doc.SpliceText(ctx, path, 0, 0, "old text"); err != nil {
+		t.Fatalf("SpliceText failed: %v", err)
+	}
+
+	spans := ParseMarkdown("## Notes\n\nSome **bold** text", MarkdownOptions{})
+	if err := Replace(ctx, doc, path, spans, "import"); err != nil {
+		t.Fatalf("Replace failed: %v", err)
+	}
+
+	got, err := doc.Spans(ctx, path)
+	if err != nil {
+		t.Fatalf("Spans failed: %v", err)
+	}
+	if dumpSpans(got) != dumpSpans(spans) {
+		t.Errorf("Spans =\n%s\nwant\n%s", dumpSpans(got), dumpSpans(spans))
+	}
+
+	attribution, err := doc.TextAttribution(ctx, path)
+	if err != nil {
+		t.Fatalf("TextAttribution failed: %v", err)
+	}
+	for _, span := range attribution {
+		if span.Change != attribution[0].Change {
+			t.Errorf("import spread over several changes: %+v", attribution)
+			break
+		}
+	}
+}
+
+// TestSplice_RollsBackOnError tests that a failed import leaves the text unchanged
+func TestSplice_RollsBackOnError(t *testing.T) {
+	ctx := context.Background()
+	doc, err := automerge.NewWithWASM(ctx, testWASMPath)
+	if err != nil {
+		t.Fatalf("Failed to create document: %v", err)
+	}
+	defer doc.Close(ctx)
+
+	path := automerge.Root().Get("content")
+	if err := doc.SpliceText(ctx, path, 0, 0, "keep"); err != nil {
+		t.Fatalf("SpliceText failed: %v", err)
+	}
+
+	// Inserting past the end fails
+	spans := []automerge.Span{text("new", bold)}
+	if err := Splice(ctx, doc, path, 100, 0, spans, ""); err == nil {
+		t.Fatal("expected error for an out of range position")
+	}
+
+	got, err := doc.GetText(ctx, path)
+	if err != nil {
+		t.Fatalf("GetText failed: %v", err)
+	}
+	if got != "keep" {
+		t.Errorf("text = %q, want %q", got, "keep")
+	}
+}
@@ -0,0 +1,315 @@
+// ==============================================================================
+// Layer 4: Go High-Level CRDT API - Rich Text Export (Markdown)
+// ==============================================================================
+// ARCHITECTURE: Helper sub-package of the high-level Go API layer (Layer 4/7).
+//
+// RESPONSIBILITIES:
+// - Render spans, marks and blocks to CommonMark
+// - Configurable mark → delimiter mapping (MarkdownOptions)
+//
+// DEPENDENCIES:
+// - pkg/automerge (Span, Block, Value types only - no WASM calls)
+//
+// DEPENDENTS:
+// - Layer 6: pkg/api (GET /api/richtext/export?format=markdown)
+//
+// RELATED FILES:
+// - pkg/automerge/richtext/richtext.go (block grouping, mark walking)
+// - pkg/automerge/richtext/html.go (HTML exporter)
+//
+// NOTES:
+// - Markdown punctuation in the text is backslash-escaped, so text never
+//   turns into markup; no raw HTML is emitted
+// - Whitespace at the edges of a mark is moved outside the delimiters
+//   ("** bold**" is not emphasis in CommonMark)
+// - Marks without a CommonMark equivalent (underline, highlight) render as
+//   plain text by default; newlines inside a block become hard breaks
+// ==============================================================================
+
+package richtext
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+)
+
+// MarkdownMark describes how a mark renders in Markdown
+type MarkdownMark struct {
+	Open  string // Delimiter before the text, e.g. "**"
+	Close string // Delimiter after the text
+	Link  bool   // Render as [text](value) instead of using delimiters
+	Code  bool   // Inline code: the text inside is not escaped
+}
+
+// MarkdownOptions configures the Markdown exporter
+type MarkdownOptions struct {
+	// Marks maps mark names to delimiters; marks not listed render as plain
+	// text. Nil uses DefaultMarkdownMarks.
+	Marks map[string]MarkdownMark
+}
+
+// DefaultMarkdownMarks returns the default mark → delimiter mapping
+func DefaultMarkdownMarks() map[string]MarkdownMark {
+	return map[string]MarkdownMark{
+		"bold":   {Open: "**", Close: "**"},
+		"italic": {Open: "_", Close: "_"},
+		"code":   {Open: "`", Close: "`", Code: true},
+		"link":   {Link: true},
+	}
+}
+
+// Markdown renders rich text spans as CommonMark.
+//
+// Example:
+//
+//	spans, _ := doc.Spans(ctx, automerge.Root().Get("content"))
+//	out := richtext.Markdown(spans, richtext.MarkdownOptions{})
+//	// ## Title
+//	//
+//	// Some **bold** text
+//
+// Status: ✅ Implemented
+func Markdown(spans []automerge.Span, opts MarkdownOptions) string {
+	marks := opts.Marks
+	if marks == nil {
+		marks = DefaultMarkdownMarks()
+	}
+	w := &markdownWriter{marks: marks}
+
+	var lists []bool  // open lists, innermost last (true = ordered)
+	var numbers []int // next item number per open list
+	var indents []int // marker width per open list
+	for i, sec := range sections(spans) {
+		path := listPath(sec)
+
+		common := 0
+		for common < len(lists) && common < len(path) && lists[common] == path[common] {
+			common++
+		}
+		lists, numbers, indents = lists[:common], numbers[:common], indents[:common]
+		for _, ordered := range path[common:] {
+			lists = append(lists, ordered)
+			numbers = append(numbers, 1)
+			indents = append(indents, 0)
+		}
+
+		if i > 0 {
+			if len(path) > 0 && w.inList {
+				w.buf = append(w.buf, '\n')
+			} else {
+				w.buf = append(w.buf, "\n\n"...)
+			}
+		}
+		w.inList = len(path) > 0
+
+		if len(path) > 0 {
+			indent := 0
+			for _, n := range indents[:len(indents)-1] {
+				indent += n
+			}
+			marker := "- "
+			if lists[len(lists)-1] {
+				marker = strconv.Itoa(numbers[len(numbers)-1]) + ". "
+				numbers[len(numbers)-1]++
+			}
+			indents[len(indents)-1] = len(marker)
+			pad := strings.Repeat(" ", indent)
+			w.buf = append(w.buf, pad+marker...)
+			w.startBlock(pad + strings.Repeat(" ", len(marker)))
+			w.inline(sec.spans)
+			continue
+		}
+
+		w.block(sec)
+	}
+	if len(w.buf) > 0 {
+		w.buf = append(w.buf, '\n')
+	}
+	return string(w.buf)
+}
+
+type markdownWriter struct {
+	buf       []byte
+	marks     map[string]MarkdownMark
+	inList    bool     // previous block was a list item
+	prefix    string   // written after each newline inside the block
+	lineStart bool     // nothing but the prefix written on this line yet
+	pending   []string // opening delimiters not written yet
+	code      int      // open inline code marks
+}
+
+// startBlock resets line state for a new block
+func (w *markdownWriter) startBlock(prefix string) {
+	w.prefix = prefix
+	w.lineStart = true
+}
+
+// block renders a non-list block
+func (w *markdownWriter) block(sec section) {
+	attrs := sec.attrs()
+	switch sec.blockType() {
+	case BlockHeading:
+		w.buf = append(w.buf, strings.Repeat("#", headingLevel(attrs))+" "...)
+		w.startBlock("")
+		w.lineStart = false
+		w.inline(headingSpans(sec.spans))
+	case BlockQuote:
+		w.buf = append(w.buf, "> "...)
+		w.startBlock("> ")
+		w.inline(sec.spans)
+	case BlockCode:
+		text := sec.text()
+		fence := "```"
+		for strings.Contains(text, fence) {
+			fence += "`"
+		}
+		w.buf = append(w.buf, fence+safeLanguage(attrString(attrs, "language"))+"\n"...)
+		w.buf = append(w.buf, text...)
+		if !strings.HasSuffix(text, "\n") {
+			w.buf = append(w.buf, '\n')
+		}
+		w.buf = append(w.buf, fence...)
+	case BlockImage:
+		src, ok := safeURL(attrString(attrs, "src"))
+		if !ok {
+			return
+		}
+		w.buf = append(w.buf, "!["+escapeMarkdown(attrString(attrs, "alt"), false)+"]("+linkDestination(src)...)
+		if title := attrString(attrs, "title"); title != "" {
+			w.buf = append(w.buf, ` "`+strings.ReplaceAll(escapeMarkdown(title, false), `"`, `\"`)+`"`...)
+		}
+		w.buf = append(w.buf, ')')
+	default:
+		w.startBlock("")
+		w.inline(sec.spans)
+	}
+}
+
+// headingSpans replaces newlines, which would end an ATX heading
+func headingSpans(spans []automerge.Span) []automerge.Span {
+	out := make([]automerge.Span, len(spans))
+	for i, s := range spans {
+		s.Text = strings.ReplaceAll(s.Text, "\n", " ")
+		out[i] = s
+	}
+	return out
+}
+
+func (w *markdownWriter) inline(spans []automerge.Span) {
+	walkMarks(spans, w.renders, w)
+}
+
+func (w *markdownWriter) renders(name string, value automerge.Value) bool {
+	m, ok := w.marks[name]
+	if !ok {
+		return false
+	}
+	if m.Link {
+		_, ok := safeURL(valueString(value))
+		return ok
+	}
+	return m.Open != "" || m.Close != ""
+}
+
+func (w *markdownWriter) open(name string, value automerge.Value) {
+	m := w.marks[name]
+	if m.Code {
+		w.code++
+	}
+	if m.Link {
+		w.pending = append(w.pending, "[")
+		return
+	}
+	w.pending = append(w.pending, m.Open)
+}
+
+func (w *markdownWriter) close(name string, value automerge.Value) {
+	m := w.marks[name]
+	if m.Code {
+		w.code--
+	}
+	if len(w.pending) > 0 {
+		// Nothing was written inside the mark: drop it
+		w.pending = w.pending[:len(w.pending)-1]
+		return
+	}
+
+	// Move trailing spaces outside the delimiter
+	end := len(w.buf)
+	for end > 0 && (w.buf[end-1] == ' ' || w.buf[end-1] == '\t') {
+		end--
+	}
+	trailing := string(w.buf[end:])
+	w.buf = w.buf[:end]
+
+	if m.Link {
+		url, _ := safeURL(valueString(value))
+		w.buf = append(w.buf, "]("+linkDestination(url)+")"...)
+	} else {
+		w.buf = append(w.buf, m.Close...)
+	}
+	w.buf = append(w.buf, trailing...)
+}
+
+func (w *markdownWriter) text(s string) {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if i > 0 {
+			w.buf = append(w.buf, "\\\n"+w.prefix...)
+			w.lineStart = true
+		}
+		if line == "" {
+			continue
+		}
+
+		// Leading spaces go before any pending delimiters
+		trimmed := strings.TrimLeft(line, " \t")
+		w.buf = append(w.buf, line[:len(line)-len(trimmed)]...)
+		if trimmed == "" {
+			continue
+		}
+		for _, d := range w.pending {
+			w.buf = append(w.buf, d...)
+			w.lineStart = false
+		}
+		w.pending = w.pending[:0]
+
+		if w.code > 0 {
+			w.buf = append(w.buf, trimmed...)
+		} else {
+			w.buf = append(w.buf, escapeMarkdown(trimmed, w.lineStart)...)
+		}
+		w.lineStart = false
+	}
+}
+
+// escapeMarkdown backslash-escapes characters that could start markup.
+// At the start of a line, block markers (#, -, +, =, "1.") are escaped too.
+func escapeMarkdown(s string, lineStart bool) string {
+	var b strings.Builder
+	digits := lineStart
+	for i, r := range s {
+		switch {
+		case strings.ContainsRune("\\`*_[]<>&~", r):
+			b.WriteByte('\\')
+		case i == 0 && lineStart && strings.ContainsRune("#-+=", r):
+			b.WriteByte('\\')
+		case digits && i > 0 && (r == '.' || r == ')'):
+			b.WriteByte('\\')
+		}
+		digits = digits && r >= '0' && r <= '9'
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// linkDestination wraps URLs containing spaces or parentheses in <...>
+func linkDestination(url string) string {
+	if !strings.ContainsAny(url, " ()<>") {
+		return url
+	}
+	url = strings.NewReplacer("<", "%3C", ">", "%3E").Replace(url)
+	return "<" + url + ">"
+}
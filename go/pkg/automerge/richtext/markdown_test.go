@@ -0,0 +1,106 @@
+package richtext
+
+import (
+	"testing"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+)
+
+// TestMarkdown tests rendering marks and blocks to CommonMark
+func TestMarkdown(t *testing.T) {
+	tests := []struct {
+		name  string
+		spans []automerge.Span
+		want  string
+	}{
+		{
+			name:  "empty",
+			spans: nil,
+			want:  "",
+		},
+		{
+			name: "whitespace moves outside delimiters",
+			spans: []automerge.Span{
+				text("Some", nil),
+				text(" bold ", bold),
+				text("text", nil),
+			},
+			want: "Some **bold** text\n",
+		},
+		{
+			name: "escaping",
+			spans: []automerge.Span{
+				text("# 1. *not* [markup]\n- item\n2. x", nil),
+			},
+			want: "\\# 1. \\*not\\* \\[markup\\]\\\n\\- item\\\n2\\. x\n",
+		},
+		{
+			name: "links and code",
+			spans: []automerge.Span{
+				text("see ", nil),
+				text("docs", map[string]automerge.Value{"link": automerge.NewString("https://example.com/a b")}),
+				text(" and ", nil),
+				text("a*b", map[string]automerge.Value{"code": automerge.NewBool(true)}),
+			},
+			want: "see [docs](<https://example.com/a b>) and `a*b`\n",
+		},
+		{
+			name: "blocks",
+			spans: []automerge.Span{
+				block("heading", nil, map[string]interface{}{"level": int64(2)}),
+				text("Title", nil),
+				block("paragraph", nil, nil),
+				text("Body", nil),
+				block("blockquote", nil, nil),
+				text("quoted\nlines", nil),
+				block("code-block", nil, map[string]interface{}{"language": "go"}),
+				text("x := `a`", nil),
+			},
+			want: "## Title\n\nBody\n\n> quoted\\\n> lines\n\n```go\nx := `a`\n```\n",
+		},
+		{
+			name: "lists",
+			spans: []automerge.Span{
+				block("ordered-list-item", nil, nil),
+				text("one", nil),
+				block("unordered-list-item", []string{"ordered-list-item"}, nil),
+				text("nested", nil),
+				block("ordered-list-item", nil, nil),
+				text("two", nil),
+				block("paragraph", nil, nil),
+				text("after", nil),
+			},
+			want: "1. one\n   - nested\n2. two\n\nafter\n",
+		},
+		{
+			name: "unsafe link renders as text",
+			spans: []automerge.Span{
+				text("x", map[string]automerge.Value{"link": automerge.NewString("javascript:alert(1)")}),
+			},
+			want: "x\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Markdown(tt.spans, MarkdownOptions{}); got != tt.want {
+				t.Errorf("Markdown() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMarkdown_CustomMarks tests a custom mark → delimiter mapping
+func TestMarkdown_CustomMarks(t *testing.T) {
+	spans := []automerge.Span{
+		text("gone", map[string]automerge.Value{"strikethrough": automerge.NewBool(true)}),
+		text(" kept", bold),
+	}
+	opts := MarkdownOptions{Marks: DefaultMarkdownMarks()}
+	opts.Marks["strikethrough"] = MarkdownMark{Open: "~~", Close: "~~"}
+
+	want := "~~gone~~ **kept**\n"
+	if got := Markdown(spans, opts); got != want {
+		t.Errorf("Markdown() = %q, want %q", got, want)
+	}
+}
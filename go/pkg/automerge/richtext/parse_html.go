@@ -0,0 +1,368 @@
+// ==============================================================================
+// Layer 4: Go High-Level CRDT API - Rich Text Import (HTML)
+// ==============================================================================
+// ARCHITECTURE: Helper sub-package of the high-level Go API layer (Layer 4/7).
+//
+// RESPONSIBILITIES:
+// - Parse a safe subset of HTML into spans (text, marks, block markers)
+// - Reverse the HTMLOptions mark mapping used by the exporter
+//
+// DEPENDENCIES:
+// - pkg/automerge (Span, Block, Value types only - no WASM calls)
+// - encoding/xml in its lenient HTML mode (no third-party HTML parser)
+//
+// DEPENDENTS:
+// - Layer 6: pkg/api (POST /api/richtext/import?format=html)
+//
+// RELATED FILES:
+// - pkg/automerge/richtext/html.go (exporter - round-trips with this)
+// - pkg/automerge/richtext/import.go (writes spans into a document)
+//
+// NOTES:
+// - Blocks: p, h1-h6, blockquote, pre (+ code class="language-x"), ul/ol/li
+//   (nested), img; other containers (div, section...) only separate blocks
+// - Marks: elements in the mapping plus b, i, del, strike, ins aliases;
+//   unknown elements keep their text and lose the tag
+// - script, style, iframe... are dropped with their content; only safe URLs
+//   survive in links and images
+// - Whitespace collapses as in a browser, except inside pre; br is "\n"
+// ==============================================================================
+
+package richtext
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+)
+
+// htmlSkipped elements are dropped together with their content
+var htmlSkipped = map[string]bool{
+	"script": true, "style": true, "head": true, "title": true, "iframe": true,
+	"object": true, "embed": true, "template": true, "noscript": true,
+	"svg": true, "math": true, "textarea": true, "select": true,
+}
+
+// htmlContainers separate blocks without being blocks themselves
+var htmlContainers = map[string]bool{
+	"div": true, "section": true, "article": true, "header": true, "footer": true,
+	"main": true, "aside": true, "nav": true, "hr": true, "table": true, "tr": true,
+	"figure": true, "figcaption": true, "body": true, "html": true,
+}
+
+// htmlTagAliases map common synonyms to the tag used by the mapping
+var htmlTagAliases = map[string]string{
+	"b": "strong", "strong": "b", "i": "em", "em": "i",
+	"del": "s", "strike": "s", "ins": "u",
+}
+
+// htmlMarkTag is a mark recognised from an element
+type htmlMarkTag struct {
+	name string
+	attr string
+}
+
+// htmlFrame is an open element
+type htmlFrame struct {
+	tag   string
+	mark  string // mark set by this element ("" = none)
+	value automerge.Value
+	block bool // element started a block context (li, blockquote)
+}
+
+type htmlParser struct {
+	b      *spanBuilder
+	tags   map[string]htmlMarkTag
+	frames []htmlFrame
+	lists  []string               // open ul/ol, outermost first
+	skip   int                    // depth inside a dropped element
+	pre    int                    // depth inside pre
+	code   map[string]interface{} // attrs of the open code block
+
+	needBlock bool // the next text starts a new paragraph
+	blocks    int  // block markers emitted
+	context   int  // li/blockquote depth that absorbs nested paragraphs
+	hasText   bool // text written since the last block marker
+	lastSpace bool // the last character written was a collapsed space
+}
+
+// ParseHTML parses an HTML fragment into rich text spans that can be
+// written into a document with Splice or Replace.
+//
+// Marks are recognised by reversing opts.Marks (nil uses DefaultHTMLMarks).
+// Anything outside the supported subset is dropped or reduced to its text,
+// so the result is safe to render again with HTML.
+//
+// Example:
+//
+//	spans, err := richtext.ParseHTML("<h2>Title</h2><p>Some <b>bold</b> text</p>", richtext.HTMLOptions{})
+//
+// Status: ✅ Implemented
+func ParseHTML(src string, opts HTMLOptions) ([]automerge.Span, error) {
+	marks := opts.Marks
+	if marks == nil {
+		marks = DefaultHTMLMarks()
+	}
+
+	p := &htmlParser{b: &spanBuilder{}, tags: map[string]htmlMarkTag{}}
+	names := make([]string, 0, len(marks))
+	for name := range marks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		m := marks[name]
+		if _, taken := p.tags[m.Tag]; !taken && validName(m.Tag) && !unsafeTags[m.Tag] {
+			p.tags[m.Tag] = htmlMarkTag{name: name, attr: m.Attr}
+		}
+	}
+	for alias, tag := range htmlTagAliases {
+		if m, ok := p.tags[tag]; ok {
+			if _, taken := p.tags[alias]; !taken {
+				p.tags[alias] = m
+			}
+		}
+	}
+
+	d := xml.NewDecoder(strings.NewReader(src))
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		var syntaxErr *xml.SyntaxError
+		if errors.As(err, &syntaxErr) && syntaxErr.Msg == "unexpected EOF" {
+			break // unclosed elements at the end, as browsers allow
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid HTML: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			p.start(strings.ToLower(t.Name.Local), t.Attr)
+		case xml.EndElement:
+			p.end(strings.ToLower(t.Name.Local))
+		case xml.CharData:
+			p.text(string(t))
+		}
+	}
+	p.trimTrailingSpace()
+	return p.b.result(), nil
+}
+
+func htmlAttr(attrs []xml.Attr, name string) string {
+	for _, a := range attrs {
+		if strings.EqualFold(a.Name.Local, name) {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// startBlock emits a block marker
+func (p *htmlParser) startBlock(typ string, parents []string, attrs map[string]interface{}) {
+	p.trimTrailingSpace()
+	p.b.block(typ, parents, attrs)
+	p.blocks++
+	p.needBlock, p.hasText = false, false
+}
+
+func (p *htmlParser) start(tag string, attrs []xml.Attr) {
+	if p.skip > 0 || htmlSkipped[tag] {
+		p.skip++
+		return
+	}
+	frame := htmlFrame{tag: tag}
+
+	switch {
+	case tag == "p":
+		if p.context > 0 {
+			if p.hasText {
+				p.lineBreak()
+			}
+		} else {
+			p.startBlock(BlockParagraph, nil, nil)
+		}
+	case len(tag) == 2 && tag[0] == 'h' && tag[1] >= '1' && tag[1] <= '6':
+		p.startBlock(BlockHeading, nil, map[string]interface{}{"level": int64(tag[1] - '0')})
+	case tag == "blockquote":
+		p.startBlock(BlockQuote, nil, nil)
+		frame.block = true
+		p.context++
+	case tag == "pre":
+		p.code = map[string]interface{}{}
+		p.startBlock(BlockCode, nil, p.code)
+		p.pre++
+	case tag == "code" && p.pre > 0:
+		class := htmlAttr(attrs, "class")
+		for _, c := range strings.Fields(class) {
+			if lang := safeLanguage(strings.TrimPrefix(c, "language-")); strings.HasPrefix(c, "language-") && lang != "" {
+				p.code["language"] = lang
+			}
+		}
+	case tag == "ul" || tag == "ol":
+		p.lists = append(p.lists, tag)
+		p.needBlock = true
+	case tag == "li":
+		typ, parents := BlockUnorderedLI, []string(nil)
+		for i, list := range p.lists {
+			t := BlockUnorderedLI
+			if list == "ol" {
+				t = BlockOrderedLI
+			}
+			if i == len(p.lists)-1 {
+				typ = t
+			} else {
+				parents = append(parents, t)
+			}
+		}
+		p.startBlock(typ, parents, nil)
+		frame.block = true
+		p.context++
+	case tag == "img":
+		if src, ok := safeURL(htmlAttr(attrs, "src")); ok {
+			imgAttrs := map[string]interface{}{"src": src, "alt": htmlAttr(attrs, "alt")}
+			if title := htmlAttr(attrs, "title"); title != "" {
+				imgAttrs["title"] = title
+			}
+			p.startBlock(BlockImage, nil, imgAttrs)
+			p.needBlock = true
+		}
+	case tag == "br":
+		p.lineBreak()
+	case htmlContainers[tag]:
+		p.needBlock = true
+	default:
+		if m, ok := p.tags[tag]; ok && p.pre == 0 {
+			frame.mark, frame.value = p.markValue(m, attrs)
+		}
+	}
+	p.frames = append(p.frames, frame)
+}
+
+// markValue returns the mark an element sets ("" if none)
+func (p *htmlParser) markValue(m htmlMarkTag, attrs []xml.Attr) (string, automerge.Value) {
+	if m.attr == "" {
+		return m.name, automerge.NewBool(true)
+	}
+	v := htmlAttr(attrs, m.attr)
+	if urlAttrs[m.attr] {
+		var ok bool
+		if v, ok = safeURL(v); !ok {
+			return "", automerge.Value{}
+		}
+	}
+	if v == "" {
+		return "", automerge.Value{}
+	}
+	return m.name, automerge.NewString(v)
+}
+
+func (p *htmlParser) end(tag string) {
+	if p.skip > 0 {
+		p.skip--
+		return
+	}
+
+	// Pop up to the matching element (tolerates misnested tags)
+	i := len(p.frames) - 1
+	for i >= 0 && p.frames[i].tag != tag {
+		i--
+	}
+	if i < 0 {
+		return
+	}
+	for _, f := range p.frames[i:] {
+		if f.block {
+			p.context--
+		}
+	}
+	p.frames = p.frames[:i]
+
+	switch {
+	case tag == "pre":
+		p.pre--
+		p.needBlock = true
+	case tag == "ul" || tag == "ol":
+		if n := len(p.lists); n > 0 {
+			p.lists = p.lists[:n-1]
+		}
+		p.needBlock = true
+	case tag == "p" || tag == "li" || tag == "blockquote" || htmlContainers[tag] ||
+		len(tag) == 2 && tag[0] == 'h' && tag[1] >= '1' && tag[1] <= '6':
+		if p.context == 0 {
+			p.needBlock = true
+		}
+	}
+}
+
+// marks returns the marks set by the open elements
+func (p *htmlParser) marks() map[string]automerge.Value {
+	out := map[string]automerge.Value{}
+	for _, f := range p.frames {
+		if f.mark != "" {
+			out[f.mark] = f.value
+		}
+	}
+	return out
+}
+
+func (p *htmlParser) lineBreak() {
+	p.trimTrailingSpace()
+	p.b.text("\n", p.marks())
+	p.hasText = true
+	p.lastSpace = true // spaces after a break are dropped
+}
+
+func (p *htmlParser) text(s string) {
+	if p.skip > 0 {
+		return
+	}
+	if p.pre > 0 {
+		if !p.hasText {
+			s = strings.TrimPrefix(s, "\n") // browsers drop a newline after <pre>
+		}
+		p.b.text(s, nil)
+		p.hasText = p.hasText || s != ""
+		return
+	}
+
+	// Collapse whitespace like a browser
+	marks := p.marks()
+	var out strings.Builder
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			if p.hasText && !p.lastSpace && !p.needBlock {
+				out.WriteByte(' ')
+				p.lastSpace = true
+			}
+			continue
+		}
+		if p.needBlock && p.blocks > 0 {
+			p.startBlock(BlockParagraph, nil, nil)
+		}
+		p.needBlock = false
+		out.WriteRune(r)
+		p.hasText, p.lastSpace = true, false
+	}
+	p.b.text(out.String(), marks)
+}
+
+// trimTrailingSpace drops a collapsed space at the end of a block
+func (p *htmlParser) trimTrailingSpace() {
+	if p.lastSpace {
+		p.b.trimSpace()
+	}
+	p.lastSpace = false
+}
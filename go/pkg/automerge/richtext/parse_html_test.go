@@ -0,0 +1,137 @@
+package richtext
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+)
+
+// dumpSpans renders spans one per line for comparison and failure output
+func dumpSpans(spans []automerge.Span) string {
+	var b strings.Builder
+	for _, s := range spans {
+		if s.Block != nil {
+			keys := make([]string, 0, len(s.Block.Attrs))
+			for k := range s.Block.Attrs {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			fmt.Fprintf(&b, "block %s parents=%v", s.Block.Type, s.Block.Parents)
+			for _, k := range keys {
+				fmt.Fprintf(&b, " %s=%v", k, s.Block.Attrs[k])
+			}
+			b.WriteByte('\n')
+			continue
+		}
+		names := make([]string, 0, len(s.Marks))
+		for name := range s.Marks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(&b, "text %q", s.Text)
+		for _, name := range names {
+			fmt.Fprintf(&b, " %s=%v", name, s.Marks[name].Scalar())
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// roundTripSpans uses every construct both exporters and importers support
+func roundTripSpans() []automerge.Span {
+	link := map[string]automerge.Value{"link": automerge.NewString("https://example.com/a")}
+	return []automerge.Span{
+		block("heading", nil, map[string]interface{}{"level": int64(2)}),
+		text("Title", nil),
+		block("paragraph", nil, nil),
+		text("Some ", nil),
+		text("bold", bold),
+		text(" and ", nil),
+		text("italic", map[string]automerge.Value{"italic": automerge.NewBool(true)}),
+		text(" <text> & a ", nil),
+		text("link", link),
+		text("\nnext line", nil),
+		block("blockquote", nil, nil),
+		text("quoted", nil),
+		block("unordered-list-item", nil, nil),
+		text("one", nil),
+		block("ordered-list-item", []string{"unordered-list-item"}, nil),
+		text("nested", nil),
+		block("unordered-list-item", nil, nil),
+		text("two", nil),
+		block("code-block", nil, map[string]interface{}{"language": "go"}),
+		text("if a < b {\n\treturn\n}", nil),
+		block("image", nil, map[string]interface{}{"src": "https://example.com/i.png", "alt": "pic"}),
+	}
+}
+
+// TestParseHTML tests parsing the supported HTML subset into spans
+func TestParseHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []automerge.Span
+	}{
+		{
+			name: "single paragraph is plain text",
+			src:  "<p>  Hello\n   <b>World</b> </p>",
+			want: []automerge.Span{text("Hello ", nil), text("World", bold)},
+		},
+		{
+			name: "unsafe content is dropped",
+			src:  `<p onclick="x()">a<script>alert(1)</script><a href="javascript:alert(1)">b</a><iframe src="x">c</iframe></p><div>d</div>`,
+			want: []automerge.Span{
+				block("paragraph", nil, nil),
+				text("ab", nil),
+				block("paragraph", nil, nil),
+				text("d", nil),
+			},
+		},
+		{
+			name: "unknown tags keep text, unclosed tags are tolerated",
+			src:  "<p>x <custom>y</custom><br>z<p>w",
+			want: []automerge.Span{
+				block("paragraph", nil, nil),
+				text("x y\nz", nil),
+				block("paragraph", nil, nil),
+				text("w", nil),
+			},
+		},
+		{
+			name: "list items absorb paragraphs",
+			src:  "<ol><li><p>one</p><p>more</p></li></ol>",
+			want: []automerge.Span{
+				block("ordered-list-item", nil, nil),
+				text("one\nmore", nil),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseHTML(tt.src, HTMLOptions{})
+			if err != nil {
+				t.Fatalf("ParseHTML failed: %v", err)
+			}
+			if dumpSpans(got) != dumpSpans(tt.want) {
+				t.Errorf("ParseHTML(%q) =\n%s\nwant\n%s", tt.src, dumpSpans(got), dumpSpans(tt.want))
+			}
+		})
+	}
+}
+
+// TestHTMLRoundTrip tests that exported HTML imports back unchanged
+func TestHTMLRoundTrip(t *testing.T) {
+	spans := roundTripSpans()
+	out := HTML(spans, HTMLOptions{})
+	got, err := ParseHTML(out, HTMLOptions{})
+	if err != nil {
+		t.Fatalf("ParseHTML failed: %v", err)
+	}
+	if dumpSpans(got) != dumpSpans(spans) {
+		t.Errorf("round trip via\n%s\ngot\n%s\nwant\n%s", out, dumpSpans(got), dumpSpans(spans))
+	}
+}
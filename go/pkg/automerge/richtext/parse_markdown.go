@@ -0,0 +1,518 @@
+// ==============================================================================
+// Layer 4: Go High-Level CRDT API - Rich Text Import (Markdown)
+// ==============================================================================
+// ARCHITECTURE: Helper sub-package of the high-level Go API layer (Layer 4/7).
+//
+// RESPONSIBILITIES:
+// - Parse CommonMark into spans (text, marks, block markers)
+// - Reverse the MarkdownOptions mark mapping used by the exporter
+//
+// DEPENDENCIES:
+// - pkg/automerge (Span, Block, Value types only - no WASM calls)
+//
+// DEPENDENTS:
+// - Layer 6: pkg/api (POST /api/richtext/import?format=markdown)
+//
+// RELATED FILES:
+// - pkg/automerge/richtext/markdown.go (exporter - round-trips with this)
+// - pkg/automerge/richtext/import.go (writes spans into a document)
+//
+// NOTES:
+// - Supported: ATX headings, paragraphs, block quotes, fenced code, nested
+//   bullet/ordered lists, standalone images, emphasis (*, _, **, __),
+//   inline code, links, autolinks, backslash escapes, entities, hard breaks
+// - Not supported (imported as paragraph text): setext headings, thematic
+//   breaks, indented code, tables; raw HTML is kept as literal text
+// - Soft line breaks become spaces, hard breaks become "\n"
+// ==============================================================================
+
+package richtext
+
+import (
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+)
+
+var (
+	mdHeading = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	mdFence   = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})[ \t]*([^ \t`]*)")
+	mdQuote   = regexp.MustCompile(`^ {0,3}> ?(.*)$`)
+	mdItem    = regexp.MustCompile(`^( *)([-+*]|[0-9]{1,9}[.)])( +|$)(.*)$`)
+	mdImage   = regexp.MustCompile(`^!\[((?:[^\]\\]|\\.)*)\]\(\s*(<[^>]*>|[^\s)]+)(?:\s+"((?:[^"\\]|\\.)*)")?\s*\)$`)
+	mdEntity  = regexp.MustCompile(`^&(?:#[0-9]{1,7}|#[xX][0-9a-fA-F]{1,6}|[a-zA-Z][a-zA-Z0-9]{1,31});`)
+	mdAutoURL = regexp.MustCompile(`^<([a-zA-Z][a-zA-Z0-9+.-]{1,31}:[^\s<>]*)>`)
+)
+
+// mdBlock is a block of Markdown source lines before inline parsing
+type mdBlock struct {
+	typ     string
+	parents []string
+	attrs   map[string]interface{}
+	lines   []string
+	raw     bool // code block: lines are kept verbatim
+}
+
+// mdListItem is an open list item while parsing nested lists
+type mdListItem struct {
+	content int    // column where the item's content starts
+	typ     string // ordered-list-item or unordered-list-item
+}
+
+// ParseMarkdown parses CommonMark into rich text spans that can be written
+// into a document with Splice or Replace.
+//
+// Marks are recognised by reversing opts.Marks (nil uses
+// DefaultMarkdownMarks); "*" and "_", "**" and "__" are interchangeable.
+//
+// Example:
+//
+//	spans := richtext.ParseMarkdown("## Title\n\nSome **bold** text", richtext.MarkdownOptions{})
+//
+// Status: ✅ Implemented
+func ParseMarkdown(src string, opts MarkdownOptions) []automerge.Span {
+	marks := opts.Marks
+	if marks == nil {
+		marks = DefaultMarkdownMarks()
+	}
+
+	b := &spanBuilder{}
+	p := newMarkdownInline(marks, b)
+	for _, blk := range markdownBlocks(src) {
+		if blk.typ == BlockParagraph && len(blk.lines) == 1 && len(blk.parents) == 0 {
+			if m := mdImage.FindStringSubmatch(strings.TrimSpace(blk.lines[0])); m != nil {
+				if url, ok := safeURL(strings.Trim(m[2], "<>")); ok {
+					attrs := map[string]interface{}{"src": url, "alt": unescapeMarkdown(m[1])}
+					if m[3] != "" {
+						attrs["title"] = unescapeMarkdown(m[3])
+					}
+					b.block(BlockImage, nil, attrs)
+					continue
+				}
+			}
+		}
+
+		b.block(blk.typ, blk.parents, blk.attrs)
+		if blk.raw {
+			b.text(strings.Join(blk.lines, "\n"), nil)
+			continue
+		}
+		p.parse(joinMarkdownLines(blk.lines), map[string]automerge.Value{})
+	}
+	return b.result()
+}
+
+// markdownBlocks splits Markdown source into blocks
+func markdownBlocks(src string) []mdBlock {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	lines := strings.Split(strings.TrimRight(src, "\n"), "\n")
+
+	var blocks []mdBlock
+	cur := -1 // index of the block still accepting continuation lines
+	var list []mdListItem
+	var fence string
+	var fenceIndent int
+
+	add := func(blk mdBlock) int {
+		blocks = append(blocks, blk)
+		return len(blocks) - 1
+	}
+
+	for _, line := range lines {
+		if fence != "" {
+			trimmed := strings.TrimLeft(line, " ")
+			if len(line)-len(trimmed) <= 3 && strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]+" \t") == "" {
+				fence = ""
+				continue
+			}
+			for i := 0; i < fenceIndent && strings.HasPrefix(line, " "); i++ {
+				line = line[1:]
+			}
+			blocks[len(blocks)-1].lines = append(blocks[len(blocks)-1].lines, line)
+			continue
+		}
+
+		if strings.TrimSpace(line) == "" {
+			cur = -1
+			continue
+		}
+
+		if m := mdFence.FindStringSubmatch(line); m != nil {
+			attrs := map[string]interface{}{}
+			if lang := safeLanguage(m[3]); lang != "" {
+				attrs["language"] = lang
+			}
+			add(mdBlock{typ: BlockCode, attrs: attrs, raw: true})
+			fence, fenceIndent = m[2], len(m[1])
+			cur, list = -1, nil
+			continue
+		}
+
+		if m := mdHeading.FindStringSubmatch(line); m != nil {
+			add(mdBlock{
+				typ:   BlockHeading,
+				attrs: map[string]interface{}{"level": int64(len(m[1]))},
+				lines: []string{m[2]},
+			})
+			cur, list = -1, nil
+			continue
+		}
+
+		if m := mdQuote.FindStringSubmatch(line); m != nil {
+			if cur >= 0 && blocks[cur].typ == BlockQuote {
+				blocks[cur].lines = append(blocks[cur].lines, m[1])
+			} else {
+				cur = add(mdBlock{typ: BlockQuote, lines: []string{m[1]}})
+			}
+			list = nil
+			continue
+		}
+
+		if m := mdItem.FindStringSubmatch(line); m != nil && (m[4] != "" || cur < 0) {
+			marker, spaces := len(m[1]), len(m[3])
+			if spaces > 4 || spaces == 0 {
+				spaces = 1
+			}
+			for len(list) > 0 && list[len(list)-1].content > marker {
+				list = list[:len(list)-1]
+			}
+			var parents []string
+			for _, item := range list {
+				parents = append(parents, item.typ)
+			}
+			typ := BlockUnorderedLI
+			if strings.ContainsAny(m[2], ".)") {
+				typ = BlockOrderedLI
+			}
+			list = append(list, mdListItem{content: marker + len(m[2]) + spaces, typ: typ})
+			cur = add(mdBlock{typ: typ, parents: parents, lines: []string{m[4]}})
+			continue
+		}
+
+		if cur >= 0 {
+			blocks[cur].lines = append(blocks[cur].lines, strings.TrimLeft(line, " \t"))
+			continue
+		}
+		list = nil
+		cur = add(mdBlock{typ: BlockParagraph, lines: []string{strings.TrimLeft(line, " \t")}})
+	}
+	return blocks
+}
+
+// joinMarkdownLines joins a block's lines: hard breaks (trailing backslash
+// or two spaces) become "\n", soft breaks become spaces
+func joinMarkdownLines(lines []string) string {
+	var b strings.Builder
+	for i, line := range lines {
+		last := i == len(lines)-1
+		trimmed := strings.TrimRight(line, " ")
+		backslashes := len(trimmed) - len(strings.TrimRight(trimmed, "\\"))
+		switch {
+		case last:
+			b.WriteString(trimmed)
+		case backslashes%2 == 1:
+			b.WriteString(trimmed[:len(trimmed)-1])
+			b.WriteByte('\n')
+		case len(line)-len(trimmed) >= 2:
+			b.WriteString(trimmed)
+			b.WriteByte('\n')
+		default:
+			b.WriteString(trimmed)
+			b.WriteByte(' ')
+		}
+	}
+	return b.String()
+}
+
+// unescapeMarkdown removes backslash escapes
+func unescapeMarkdown(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func isASCIIPunct(c byte) bool {
+	return c < 128 && unicode.IsPunct(rune(c)) || strings.IndexByte("$+<=>^`|~", c) >= 0
+}
+
+// mdDelim is an emphasis delimiter and the mark it toggles
+type mdDelim struct {
+	text string
+	name string
+}
+
+// markdownInline parses inline Markdown into the span builder
+type markdownInline struct {
+	b      *spanBuilder
+	delims []mdDelim // longest first
+	code   string    // mark for `code` spans ("" = none)
+	link   string    // mark for links ("" = none)
+}
+
+// delimAliases are CommonMark spellings of the same emphasis
+var delimAliases = map[string]string{"**": "__", "__": "**", "*": "_", "_": "*"}
+
+func newMarkdownInline(marks map[string]MarkdownMark, b *spanBuilder) *markdownInline {
+	p := &markdownInline{b: b}
+
+	names := make([]string, 0, len(marks))
+	for name := range marks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	seen := map[string]bool{}
+	for _, name := range names {
+		m := marks[name]
+		switch {
+		case m.Link:
+			if p.link == "" {
+				p.link = name
+			}
+		case m.Code && m.Open == "`":
+			if p.code == "" {
+				p.code = name
+			}
+		case m.Open != "" && m.Open == m.Close && !seen[m.Open]:
+			p.delims = append(p.delims, mdDelim{m.Open, name})
+			seen[m.Open] = true
+		}
+	}
+	for _, d := range append([]mdDelim(nil), p.delims...) {
+		if alias, ok := delimAliases[d.text]; ok && !seen[alias] {
+			p.delims = append(p.delims, mdDelim{alias, d.name})
+			seen[alias] = true
+		}
+	}
+	sort.SliceStable(p.delims, func(i, j int) bool { return len(p.delims[i].text) > len(p.delims[j].text) })
+	return p
+}
+
+// parse appends s to the builder with the given marks active
+func (p *markdownInline) parse(s string, marks map[string]automerge.Value) {
+	var text strings.Builder
+	flush := func() {
+		p.b.text(text.String(), marks)
+		text.Reset()
+	}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]):
+			text.WriteByte(s[i+1])
+			i += 2
+			continue
+
+		case c == '`':
+			run := len(s[i:]) - len(strings.TrimLeft(s[i:], "`"))
+			end := closingBackticks(s, i+run, run)
+			if end < 0 {
+				text.WriteString(s[i : i+run])
+				i += run
+				continue
+			}
+			code := s[i+run : end]
+			if len(code) >= 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+				code = code[1 : len(code)-1]
+			}
+			if p.code == "" {
+				text.WriteString(code)
+			} else {
+				flush()
+				p.b.text(code, withMark(marks, p.code, automerge.NewBool(true)))
+			}
+			i = end + run
+			continue
+
+		case c == '[':
+			if label, dest, n, ok := parseLink(s[i:]); ok {
+				flush()
+				if url, safe := safeURL(dest); safe && p.link != "" {
+					p.parse(label, withMark(marks, p.link, automerge.NewString(url)))
+				} else {
+					p.parse(label, marks)
+				}
+				i += n
+				continue
+			}
+
+		case c == '<':
+			if m := mdAutoURL.FindStringSubmatch(s[i:]); m != nil {
+				if url, safe := safeURL(m[1]); safe && p.link != "" {
+					flush()
+					p.b.text(m[1], withMark(marks, p.link, automerge.NewString(url)))
+					i += len(m[0])
+					continue
+				}
+			}
+
+		case c == '&':
+			if m := mdEntity.FindString(s[i:]); m != "" {
+				text.WriteString(html.UnescapeString(m))
+				i += len(m)
+				continue
+			}
+		}
+
+		if d, ok := p.delimAt(s, i); ok {
+			before, _ := utf8.DecodeLastRuneInString(s[:i])
+			after, _ := utf8.DecodeRuneInString(s[i+len(d.text):])
+			_, active := marks[d.name]
+			switch {
+			case active && i > 0 && !unicode.IsSpace(before):
+				flush()
+				marks = withoutMark(marks, d.name)
+				i += len(d.text)
+				continue
+			case !active && i+len(d.text) < len(s) && !unicode.IsSpace(after) &&
+				!(d.text[0] == '_' && i > 0 && isWordRune(before)) &&
+				strings.Contains(s[i+len(d.text)+1:], d.text):
+				flush()
+				marks = withMark(marks, d.name, automerge.NewBool(true))
+				i += len(d.text)
+				continue
+			}
+		}
+
+		_, size := utf8.DecodeRuneInString(s[i:])
+		text.WriteString(s[i : i+size])
+		i += size
+	}
+	flush()
+}
+
+// delimAt returns the emphasis delimiter starting at s[i]
+func (p *markdownInline) delimAt(s string, i int) (mdDelim, bool) {
+	for _, d := range p.delims {
+		if strings.HasPrefix(s[i:], d.text) {
+			return d, true
+		}
+	}
+	return mdDelim{}, false
+}
+
+// closingBackticks finds a backtick run of exactly n starting at or after
+// from, returning its index or -1
+func closingBackticks(s string, from, n int) int {
+	for i := from; i < len(s); {
+		if s[i] != '`' {
+			i++
+			continue
+		}
+		run := len(s[i:]) - len(strings.TrimLeft(s[i:], "`"))
+		if run == n {
+			return i
+		}
+		i += run
+	}
+	return -1
+}
+
+// parseLink parses [label](dest "title") at the start of s, returning the
+// label, unescaped destination and bytes consumed
+func parseLink(s string) (label, dest string, n int, ok bool) {
+	depth := 0
+	end := -1
+	for i := 0; i < len(s) && end < 0; i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				end = i
+			}
+		}
+	}
+	if end < 0 || end+1 >= len(s) || s[end+1] != '(' {
+		return "", "", 0, false
+	}
+	label = s[1:end]
+
+	rest := s[end+2:]
+	trimmed := strings.TrimLeft(rest, " \t")
+	if strings.HasPrefix(trimmed, "<") {
+		close := strings.IndexByte(trimmed, '>')
+		if close < 0 {
+			return "", "", 0, false
+		}
+		dest = trimmed[1:close]
+		trimmed = trimmed[close+1:]
+	} else {
+		// Balanced parentheses are part of the destination
+		stop, depth := -1, 0
+		for i := 0; i < len(trimmed) && stop < 0; i++ {
+			switch trimmed[i] {
+			case '\\':
+				i++
+			case '(':
+				depth++
+			case ')':
+				if depth == 0 {
+					stop = i
+				}
+				depth--
+			case ' ', '\t':
+				stop = i
+			}
+		}
+		if stop < 0 {
+			return "", "", 0, false
+		}
+		dest = trimmed[:stop]
+		trimmed = trimmed[stop:]
+	}
+
+	// Optional title, ignored
+	trimmed = strings.TrimLeft(trimmed, " \t")
+	if strings.HasPrefix(trimmed, `"`) {
+		close := strings.Index(trimmed[1:], `"`)
+		if close < 0 {
+			return "", "", 0, false
+		}
+		trimmed = strings.TrimLeft(trimmed[close+2:], " \t")
+	}
+	if !strings.HasPrefix(trimmed, ")") {
+		return "", "", 0, false
+	}
+	n = len(s) - len(trimmed) + 1
+	return label, unescapeMarkdown(dest), n, true
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// withMark returns a copy of marks with name set
+func withMark(marks map[string]automerge.Value, name string, value automerge.Value) map[string]automerge.Value {
+	out := make(map[string]automerge.Value, len(marks)+1)
+	for k, v := range marks {
+		out[k] = v
+	}
+	out[name] = value
+	return out
+}
+
+// withoutMark returns a copy of marks without name
+func withoutMark(marks map[string]automerge.Value, name string) map[string]automerge.Value {
+	out := make(map[string]automerge.Value, len(marks))
+	for k, v := range marks {
+		if k != name {
+			out[k] = v
+		}
+	}
+	return out
+}
@@ -0,0 +1,97 @@
+package richtext
+
+import (
+	"testing"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+)
+
+// TestParseMarkdown tests parsing CommonMark into spans
+func TestParseMarkdown(t *testing.T) {
+	italic := map[string]automerge.Value{"italic": automerge.NewBool(true)}
+
+	tests := []struct {
+		name string
+		src  string
+		want []automerge.Span
+	}{
+		{
+			name: "plain paragraph has no marker",
+			src:  "Hello\nWorld",
+			want: []automerge.Span{text("Hello World", nil)},
+		},
+		{
+			name: "emphasis spellings",
+			src:  "__a__ *b* snake_case_name",
+			want: []automerge.Span{
+				text("a", bold),
+				text(" ", nil),
+				text("b", italic),
+				text(" snake_case_name", nil),
+			},
+		},
+		{
+			name: "escapes, entities and code",
+			src:  "\\*x\\* &amp; `a*b`",
+			want: []automerge.Span{
+				text("*x* & ", nil),
+				text("a*b", map[string]automerge.Value{"code": automerge.NewBool(true)}),
+			},
+		},
+		{
+			name: "links",
+			src:  "[docs](https://example.com) [bad](javascript:alert(1)) <https://a.org>",
+			want: []automerge.Span{
+				text("docs", map[string]automerge.Value{"link": automerge.NewString("https://example.com")}),
+				text(" bad ", nil),
+				text("https://a.org", map[string]automerge.Value{"link": automerge.NewString("https://a.org")}),
+			},
+		},
+		{
+			name: "blocks",
+			src:  "# Title\n\nFirst\\\nline\n\n> quote\n\n```go\nx := 1\n```\n\n![alt](https://img.example/a.png)",
+			want: []automerge.Span{
+				block("heading", nil, map[string]interface{}{"level": int64(1)}),
+				text("Title", nil),
+				block("paragraph", nil, nil),
+				text("First\nline", nil),
+				block("blockquote", nil, nil),
+				text("quote", nil),
+				block("code-block", nil, map[string]interface{}{"language": "go"}),
+				text("x := 1", nil),
+				block("image", nil, map[string]interface{}{"src": "https://img.example/a.png", "alt": "alt"}),
+			},
+		},
+		{
+			name: "nested lists",
+			src:  "- one\n  1. nested\n- two",
+			want: []automerge.Span{
+				block("unordered-list-item", nil, nil),
+				text("one", nil),
+				block("ordered-list-item", []string{"unordered-list-item"}, nil),
+				text("nested", nil),
+				block("unordered-list-item", nil, nil),
+				text("two", nil),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseMarkdown(tt.src, MarkdownOptions{})
+			if dumpSpans(got) != dumpSpans(tt.want) {
+				t.Errorf("ParseMarkdown(%q) =\n%s\nwant\n%s", tt.src, dumpSpans(got), dumpSpans(tt.want))
+			}
+		})
+	}
+}
+
+// TestMarkdownRoundTrip tests that exported Markdown imports back unchanged
+func TestMarkdownRoundTrip(t *testing.T) {
+	spans := roundTripSpans()
+	md := Markdown(spans, MarkdownOptions{})
+	got := ParseMarkdown(md, MarkdownOptions{})
+	if dumpSpans(got) != dumpSpans(spans) {
+		t.Errorf("round trip via\n%s\ngot\n%s\nwant\n%s", md, dumpSpans(got), dumpSpans(spans))
+	}
+}
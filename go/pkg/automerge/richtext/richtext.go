@@ -0,0 +1,294 @@
+// ==============================================================================
+// Layer 4: Go High-Level CRDT API - Rich Text Conversion (shared)
+// ==============================================================================
+// ARCHITECTURE: Helper sub-package of the high-level Go API layer (Layer 4/7).
+//
+// RESPONSIBILITIES:
+// - Group spans (automerge.Document.Spans) into blocks
+// - Walk inline marks as properly nested open/close events
+// - Helpers shared by the HTML and Markdown exporters
+//
+// DEPENDENCIES:
+// - pkg/automerge (Span, Block, Value types only - no WASM calls)
+//
+// DEPENDENTS:
+// - Layer 6: pkg/api (GET /api/richtext/export)
+//
+// RELATED FILES:
+// - pkg/automerge/richtext/html.go (HTML exporter)
+// - pkg/automerge/richtext/markdown.go (Markdown exporter)
+// - pkg/automerge/crdt_richtext.go (Spans, Block)
+//
+// NOTES:
+// - Pure functions over []automerge.Span, safe for concurrent use
+// - Block types follow the Automerge block convention: "paragraph",
+//   "heading" (attrs.level), "blockquote", "code-block" (attrs.language),
+//   "ordered-list-item", "unordered-list-item", "image" (attrs.src/alt/title);
+//   unknown types render as paragraphs
+// - Only list items are nested by their parents; other parents are ignored
+// ==============================================================================
+
+// Package richtext converts Automerge rich text (spans, marks and block
+// markers) to and from HTML and Markdown.
+//
+// Export a text object:
+//
+//	spans, _ := doc.Spans(ctx, automerge.Root().Get("content"))
+//	html := richtext.HTML(spans, richtext.HTMLOptions{})
+//	md := richtext.Markdown(spans, richtext.MarkdownOptions{})
+package richtext
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+)
+
+// Block types with dedicated rendering
+const (
+	BlockParagraph   = "paragraph"
+	BlockHeading     = "heading"
+	BlockQuote       = "blockquote"
+	BlockCode        = "code-block"
+	BlockOrderedLI   = "ordered-list-item"
+	BlockUnorderedLI = "unordered-list-item"
+	BlockImage       = "image"
+)
+
+// section is a block marker and the text up to the next marker
+type section struct {
+	block *automerge.Block // nil for text before the first marker
+	spans []automerge.Span
+}
+
+// sections groups spans by block. Text before the first marker forms an
+// implicit paragraph (omitted if empty).
+func sections(spans []automerge.Span) []section {
+	var out []section
+	cur := section{}
+	for _, s := range spans {
+		if s.Block != nil {
+			if cur.block != nil || len(cur.spans) > 0 {
+				out = append(out, cur)
+			}
+			cur = section{block: s.Block}
+			continue
+		}
+		cur.spans = append(cur.spans, s)
+	}
+	if cur.block != nil || len(cur.spans) > 0 {
+		out = append(out, cur)
+	}
+	return out
+}
+
+// blockType returns the block's type, "paragraph" for implicit blocks
+func (s section) blockType() string {
+	if s.block == nil || s.block.Type == "" {
+		return BlockParagraph
+	}
+	return s.block.Type
+}
+
+func (s section) attrs() map[string]interface{} {
+	if s.block == nil {
+		return nil
+	}
+	return s.block.Attrs
+}
+
+// text concatenates the section's characters, ignoring marks
+func (s section) text() string {
+	var b strings.Builder
+	for _, span := range s.spans {
+		b.WriteString(span.Text)
+	}
+	return b.String()
+}
+
+// listKind reports whether a block type is a list item and which kind
+func listKind(blockType string) (ordered, ok bool) {
+	switch blockType {
+	case BlockOrderedLI:
+		return true, true
+	case BlockUnorderedLI:
+		return false, true
+	}
+	return false, false
+}
+
+// listPath returns the list nesting of a block: one entry per enclosing
+// list item in its parents, then its own kind (true = ordered). Non-list
+// blocks have an empty path.
+func listPath(s section) []bool {
+	ordered, ok := listKind(s.blockType())
+	if !ok {
+		return nil
+	}
+	var path []bool
+	for _, parent := range s.block.Parents {
+		if o, ok := listKind(parent); ok {
+			path = append(path, o)
+		}
+	}
+	return append(path, ordered)
+}
+
+// inlineWriter receives nested mark and text events from walkMarks
+type inlineWriter interface {
+	open(name string, value automerge.Value)
+	close(name string, value automerge.Value)
+	text(s string)
+}
+
+type activeMark struct {
+	name  string
+	value automerge.Value
+}
+
+// walkMarks emits text with properly nested open/close events. A mark stays
+// open across spans while its value is unchanged; marks that render is
+// false for are skipped. New marks open in name order.
+func walkMarks(spans []automerge.Span, renders func(name string, value automerge.Value) bool, w inlineWriter) {
+	var stack []activeMark
+	for _, span := range spans {
+		if span.Text == "" {
+			continue
+		}
+		want := map[string]automerge.Value{}
+		for name, value := range span.Marks {
+			if isSet(value) && renders(name, value) {
+				want[name] = value
+			}
+		}
+
+		// Close everything above the first mark that ended or changed
+		keep := 0
+		for keep < len(stack) {
+			v, ok := want[stack[keep].name]
+			if !ok || !reflect.DeepEqual(v.Scalar(), stack[keep].value.Scalar()) {
+				break
+			}
+			keep++
+		}
+		for i := len(stack) - 1; i >= keep; i-- {
+			w.close(stack[i].name, stack[i].value)
+		}
+		stack = stack[:keep]
+
+		var names []string
+		for name := range want {
+			open := false
+			for _, m := range stack {
+				if m.name == name {
+					open = true
+					break
+				}
+			}
+			if !open {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			w.open(name, want[name])
+			stack = append(stack, activeMark{name, want[name]})
+		}
+
+		w.text(span.Text)
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		w.close(stack[i].name, stack[i].value)
+	}
+}
+
+// isSet reports whether a mark value turns the mark on (false and null
+// values are how marks are cleared)
+func isSet(v automerge.Value) bool {
+	switch s := v.Scalar().(type) {
+	case nil, automerge.Null:
+		return false
+	case automerge.Boolean:
+		return bool(s)
+	}
+	return true
+}
+
+// valueString formats a mark value for an attribute or link target
+func valueString(v automerge.Value) string {
+	switch s := v.Scalar().(type) {
+	case automerge.String:
+		return string(s)
+	case nil, automerge.Null:
+		return ""
+	default:
+		return fmt.Sprint(s)
+	}
+}
+
+// attrString returns a string block attribute
+func attrString(attrs map[string]interface{}, key string) string {
+	s, _ := attrs[key].(string)
+	return s
+}
+
+// attrInt returns a numeric block attribute
+func attrInt(attrs map[string]interface{}, key string) (int, bool) {
+	switch n := attrs[key].(type) {
+	case int:
+		return n, true
+	case int64:
+		return int(n), true
+	case uint64:
+		return int(n), true
+	case float64:
+		return int(n), true
+	}
+	return 0, false
+}
+
+// headingLevel returns a heading's level clamped to 1-6
+func headingLevel(attrs map[string]interface{}) int {
+	level, _ := attrInt(attrs, "level")
+	if level < 1 {
+		return 1
+	}
+	if level > 6 {
+		return 6
+	}
+	return level
+}
+
+// safeURL returns the URL if it is relative or uses an allowed scheme
+// (http, https, mailto); javascript:, data: and malformed URLs are rejected
+func safeURL(raw string) (string, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", false
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https", "mailto":
+		return raw, true
+	}
+	return "", false
+}
+
+// safeLanguage keeps only characters valid in a code block language name
+func safeLanguage(lang string) string {
+	var b strings.Builder
+	for _, r := range lang {
+		if r < 128 && (r == '-' || r == '_' || r == '+' || r == '#' || r == '.' ||
+			(r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -1,6 +1,11 @@
 package automerge
 
-import "fmt"
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 // ObjType represents the type of an Automerge object
 type ObjType string
@@ -70,6 +75,31 @@ func NewNull() Value {
 	return Value{scalar: Null{}}
 }
 
+// NewUint creates an unsigned integer value
+func NewUint(u uint64) Value {
+	return Value{scalar: Uint(u)}
+}
+
+// NewCounter creates a counter value
+func NewCounter(c int64) Value {
+	return Value{scalar: Counter(c)}
+}
+
+// NewTimestamp creates a timestamp value (milliseconds since the Unix epoch)
+func NewTimestamp(ms int64) Value {
+	return Value{scalar: Timestamp(ms)}
+}
+
+// NewBytes creates a byte array value
+func NewBytes(b []byte) Value {
+	return Value{scalar: Bytes(b)}
+}
+
+// Scalar returns the underlying scalar, or nil for object references
+func (v Value) Scalar() ScalarValue {
+	return v.scalar
+}
+
 // IsScalar returns true if this is a scalar value
 func (v Value) IsScalar() bool {
 	return v.scalar != nil
@@ -112,6 +142,56 @@ func (v Value) AsFloat() (float64, bool) {
 	return 0, false
 }
 
+// Scalar kinds as passed across the FFI boundary.
+// Must match rust/automerge_wasi/src/value.rs (KIND_*).
+const (
+	scalarKindNull      uint8 = 0
+	scalarKindBool      uint8 = 1
+	scalarKindInt       uint8 = 2
+	scalarKindUint      uint8 = 3
+	scalarKindFloat     uint8 = 4
+	scalarKindString    uint8 = 5
+	scalarKindCounter   uint8 = 6
+	scalarKindTimestamp uint8 = 7
+	scalarKindBytes     uint8 = 8
+)
+
+// encodeScalar converts a scalar into its FFI (kind, bytes) form
+func encodeScalar(s ScalarValue) (uint8, []byte) {
+	switch v := s.(type) {
+	case String:
+		return scalarKindString, []byte(v)
+	case Int:
+		return scalarKindInt, []byte(strconv.FormatInt(int64(v), 10))
+	case Uint:
+		return scalarKindUint, []byte(strconv.FormatUint(uint64(v), 10))
+	case Float:
+		return scalarKindFloat, []byte(strconv.FormatFloat(float64(v), 'g', -1, 64))
+	case Boolean:
+		return scalarKindBool, []byte(strconv.FormatBool(bool(v)))
+	case Counter:
+		return scalarKindCounter, []byte(strconv.FormatInt(int64(v), 10))
+	case Timestamp:
+		return scalarKindTimestamp, []byte(strconv.FormatInt(int64(v), 10))
+	case Bytes:
+		return scalarKindBytes, []byte(v)
+	default:
+		return scalarKindNull, nil
+	}
+}
+
+// Object type tags as passed across the FFI boundary (0=map, 1=list, 2=text)
+func (t ObjType) tag() uint8 {
+	switch t {
+	case ObjTypeList:
+		return 1
+	case ObjTypeText:
+		return 2
+	default:
+		return 0
+	}
+}
+
 // ObjID represents an object identifier
 // Currently opaque - will be expanded when we support multi-object operations
 type ObjID struct {
@@ -174,6 +254,75 @@ func (p Path) Key() string {
 	return seg.key
 }
 
+// Parent returns the path without its last segment (root stays root)
+func (p Path) Parent() Path {
+	if len(p.segments) == 0 {
+		return p
+	}
+	n := len(p.segments) - 1
+	return Path{segments: p.segments[:n:n]}
+}
+
+// last returns the final segment of a non-root path
+func (p Path) last() segment {
+	return p.segments[len(p.segments)-1]
+}
+
+// child appends a segment to the path
+func (p Path) child(seg segment) Path {
+	segments := make([]segment, len(p.segments), len(p.segments)+1)
+	copy(segments, p.segments)
+	return Path{segments: append(segments, seg)}
+}
+
+// objPath returns the dotted form used by path-based WASI exports
+// ("ROOT", "ROOT.config", "ROOT.items.0").
+//
+// Map keys containing "." (or empty keys) cannot be addressed this way.
+func (p Path) objPath() (string, error) {
+	var b strings.Builder
+	b.WriteString("ROOT")
+	for _, seg := range p.segments {
+		b.WriteByte('.')
+		if seg.index != nil {
+			b.WriteString(strconv.FormatUint(uint64(*seg.index), 10))
+			continue
+		}
+		if seg.key == "" || strings.Contains(seg.key, ".") {
+			return "", fmt.Errorf("%w: key %q cannot be addressed", ErrInvalidPath, seg.key)
+		}
+		b.WriteString(seg.key)
+	}
+	return b.String(), nil
+}
+
+// ObjPath returns the dotted form of the path ("ROOT.content"), as used by
+// the HTTP API
+func (p Path) ObjPath() (string, error) {
+	return p.objPath()
+}
+
+// ParseObjPath parses the dotted form ObjPath produces ("ROOT.content",
+// "ROOT.items.0.title"). Numeric segments are list indexes.
+func ParseObjPath(s string) (Path, error) {
+	segments := strings.Split(s, ".")
+	if segments[0] != "ROOT" {
+		return Path{}, fmt.Errorf("%w: %q must start with ROOT", ErrInvalidPath, s)
+	}
+	path := Root()
+	for _, seg := range segments[1:] {
+		if seg == "" {
+			return Path{}, fmt.Errorf("%w: empty segment in %q", ErrInvalidPath, s)
+		}
+		if idx, err := strconv.ParseUint(seg, 10, 32); err == nil {
+			path = path.Index(uint(idx))
+		} else {
+			path = path.Get(seg)
+		}
+	}
+	return path, nil
+}
+
 // String returns a human-readable path representation
 func (p Path) String() string {
 	if p.IsRoot() {
@@ -197,6 +346,17 @@ func (h ChangeHash) String() string {
 	return fmt.Sprintf("%x", h[:])
 }
 
+// ParseChangeHash parses the hex form produced by ChangeHash.String
+func ParseChangeHash(s string) (ChangeHash, error) {
+	var h ChangeHash
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != len(h) {
+		return h, fmt.Errorf("invalid change hash %q", s)
+	}
+	copy(h[:], b)
+	return h, nil
+}
+
 // Change represents a single change in the document history
 // Currently opaque - will be expanded in M1 when we implement sync protocol
 type Change struct {
@@ -213,9 +373,15 @@ type ActorID string
 // For M4 milestone
 type Mark struct {
 	Name  string
-	Value Value
+	Value Value // Any scalar (bool for bold, string for a link URL...)
 	Start uint
 	End   uint
+
+	// Expand is how the mark grows when text is inserted at its edges.
+	// Reported by Marks/GetMarks; Document.Mark takes it as a parameter.
+	// Marks not made through Document.Mark (other Automerge clients) report
+	// ExpandNone.
+	Expand ExpandMark
 }
 
 // MarkSet is a collection of marks at a position
@@ -6,7 +6,17 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"strconv"
+	"time"
+)
+
+// Storage backends for Config.Storage
+const (
+	StorageFS     = "fs"
+	StorageMemory = "memory"
+	StorageSQLite = "sqlite"
+	StorageS3     = "s3"
 )
 
 // Config holds all configuration for the Automerge WASI HTTP server.
@@ -24,7 +34,53 @@ type Config struct {
 	// Env: PORT
 	Port string
 
-	// StorageDir is where .am snapshot files are saved
+	// Storage selects the persistence backend: "fs" (files under
+	// StorageDir), "sqlite" (a database at SQLitePath), "s3" (objects in
+	// S3Bucket) or "memory" (nothing survives a restart)
+	// (default: "fs")
+	// Env: STORAGE
+	Storage string
+
+	// SQLitePath is the database file of the "sqlite" backend
+	// (default: <StorageDir>/automerge.db)
+	// Env: SQLITE_PATH
+	SQLitePath string
+
+	// S3Bucket and S3Prefix locate the "s3" backend's objects:
+	// <S3Prefix>/<document ID>/<key>
+	// Env: S3_BUCKET (required for "s3"), S3_PREFIX
+	S3Bucket string
+	S3Prefix string
+
+	// S3Endpoint is the S3-compatible API's URL
+	// (default: https://s3.<S3Region>.amazonaws.com)
+	// Env: S3_ENDPOINT
+	S3Endpoint string
+
+	// S3Region signs S3 requests
+	// (default: "us-east-1")
+	// Env: S3_REGION (or AWS_REGION)
+	S3Region string
+
+	// S3PathStyle puts the bucket in the URL path instead of the host name
+	// (needed by MinIO and most self-hosted servers)
+	// (default: false)
+	// Env: S3_PATH_STYLE
+	S3PathStyle bool
+
+	// S3MaxRetries is how often a failed S3 request is retried
+	// (default: 3, negative disables)
+	// Env: S3_MAX_RETRIES
+	S3MaxRetries int
+
+	// S3 credentials
+	// Env: AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+	S3SessionToken    string
+
+	// StorageDir is where the "fs" backend keeps documents, one directory
+	// per document: <StorageDir>/default/snapshot, …
 	// (default: current directory)
 	// Env: STORAGE_DIR
 	StorageDir string
@@ -69,17 +125,125 @@ type Config struct {
 	// (default: true)
 	// Env: ENABLE_UI (set to "false" to disable)
 	EnableUI bool
+
+	// CompactBytes compacts the change chunks into a fresh snapshot once
+	// they hold this many bytes
+	// (default: 1048576)
+	// Env: COMPACT_BYTES
+	CompactBytes int64
+
+	// CompactChanges compacts the change chunks once there are this many
+	// (default: 1000)
+	// Env: COMPACT_CHANGES
+	CompactChanges int
+
+	// Backups is how many previous snapshots to keep (snapshot.1 …) for
+	// startup to fall back to if the snapshot is damaged
+	// (default: 2, negative disables)
+	// Env: SNAPSHOT_BACKUPS
+	Backups int
+
+	// FlushInterval is how often queued changes are written to storage
+	// (default: 1s)
+	// Env: FLUSH_INTERVAL (Go duration, e.g. "500ms")
+	FlushInterval time.Duration
+
+	// MaxDirtyChanges flushes early once this many saves are queued
+	// (default: 100)
+	// Env: MAX_DIRTY_CHANGES
+	MaxDirtyChanges int
+
+	// QueueSize is how many operations may wait for a document; requests
+	// beyond that get 503 until the queue drains
+	// (default: 256)
+	// Env: DOC_QUEUE_SIZE
+	QueueSize int
+
+	// DocIdleTTL unloads documents unused for this long; they are loaded
+	// again from storage on their next request
+	// (default: 0, never)
+	// Env: DOC_IDLE_TTL (Go duration, e.g. "10m")
+	DocIdleTTL time.Duration
+
+	// DocMemoryBudget unloads least recently used documents while the
+	// loaded ones hold more WASM memory than this many bytes
+	// (default: 0, no budget)
+	// Env: DOC_MEMORY_BUDGET
+	DocMemoryBudget int64
+
+	// EvictInterval is how often idle documents are looked for
+	// (default: 30s)
+	// Env: EVICT_INTERVAL
+	EvictInterval time.Duration
+
+	// ReadReplicas is how many read-only copies of each document serve
+	// heavy reads (GET /api/doc, /api/text, /api/json, rich text export)
+	// so they don't wait behind writes
+	// (default: 0, reads run on the document)
+	// Env: DOC_READ_REPLICAS
+	ReadReplicas int
+
+	// ReplicaMaxLag is how stale a read replica may be before a read brings
+	// it up to date (default: 1s, negative: on every read)
+	// Env: REPLICA_MAX_LAG (Go duration, e.g. "250ms")
+	ReplicaMaxLag time.Duration
+
+	// EventLogSize is how many recent change events each document keeps
+	// for SSE clients that reconnect with Last-Event-ID
+	// (default: 1024, negative: none)
+	// Env: EVENT_LOG_SIZE
+	EventLogSize int
+
+	// ResumeWindow is how long after its last SSE client leaves a document
+	// keeps recording events for it to resume (default: 1m)
+	// Env: EVENT_RESUME_WINDOW
+	ResumeWindow time.Duration
+
+	// ResyncAfter is how long an SSE client may stay behind before the
+	// updates it is waiting for are replaced by a "resync" event
+	// (default: 5s)
+	// Env: EVENT_RESYNC_AFTER
+	ResyncAfter time.Duration
+
+	// SyncPeerIdleTTL is how long a sync peer's state stays in memory
+	// unused once it is stored (default: 10m)
+	// Env: SYNC_PEER_IDLE_TTL
+	SyncPeerIdleTTL time.Duration
 }
 
 // NewFromEnv creates a Config from environment variables with sensible defaults.
 //
 // Environment Variables:
 //   - PORT: HTTP port (default: "8080")
-//   - STORAGE_DIR: Directory for .am snapshots (default: ".")
+//   - STORAGE: Storage backend, "fs", "sqlite", "s3" or "memory" (default: "fs")
+//   - STORAGE_DIR: Directory for the "fs" backend (default: ".")
+//   - SQLITE_PATH: Database of the "sqlite" backend (default: "<STORAGE_DIR>/automerge.db")
+//   - S3_BUCKET, S3_PREFIX, S3_ENDPOINT, S3_REGION, S3_PATH_STYLE, S3_MAX_RETRIES:
+//     Location and behavior of the "s3" backend
+//   - AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN: S3 credentials
 //   - USER_ID: Server instance identifier (default: "default")
 //   - WASM_PATH: Path to .wasm file (default: relative path for dev)
 //   - WEB_PATH: Path to web UI folder (default: "../web")
 //   - ENABLE_UI: Enable web UI (default: "true")
+//   - COMPACT_BYTES: Change chunk bytes that trigger compaction (default: 1048576)
+//   - COMPACT_CHANGES: Change chunks that trigger compaction (default: 1000)
+//   - SNAPSHOT_BACKUPS: Previous snapshots to keep (default: 2)
+//   - FLUSH_INTERVAL: How often queued changes are written (default: "1s")
+//   - MAX_DIRTY_CHANGES: Queued saves that trigger an early flush (default: 100)
+//   - DOC_QUEUE_SIZE: Operations that may wait per document (default: 256)
+//   - DOC_IDLE_TTL: Unload documents idle this long (default: never)
+//   - DOC_MEMORY_BUDGET: WASM bytes of loaded documents before the least
+//     recently used are unloaded (default: no budget)
+//   - EVICT_INTERVAL: How often idle documents are looked for (default: "30s")
+//   - DOC_READ_REPLICAS: Read-only copies of each document for heavy reads (default: 0)
+//   - REPLICA_MAX_LAG: How stale a read replica may be (default: "1s")
+//   - EVENT_LOG_SIZE: Change events kept for resuming SSE clients (default: 1024)
+//   - EVENT_RESUME_WINDOW: How long events are kept recording after the last
+//     SSE client leaves (default: "1m")
+//   - EVENT_RESYNC_AFTER: How long an SSE client may stay behind before it is
+//     resynced (default: "5s")
+//   - SYNC_PEER_IDLE_TTL: How long an unused sync peer state stays in memory
+//     (default: "10m")
 //
 // Example:
 //
@@ -93,13 +257,48 @@ func NewFromEnv() Config {
 		panic("WASM_PATH environment variable required. Use 'make run' or 'make dev' to set automatically.")
 	}
 
+	storageDir := getEnv("STORAGE_DIR", ".")
+
 	return Config{
 		Port:       getEnv("PORT", "8080"),
-		StorageDir: getEnv("STORAGE_DIR", "."),
+		Storage:    getEnv("STORAGE", StorageFS),
+		SQLitePath: getEnv("SQLITE_PATH", filepath.Join(storageDir, "automerge.db")),
+		StorageDir: storageDir,
 		UserID:     getEnv("USER_ID", "default"),
 		WASMPath:   wasmPath,
 		WebPath:    getEnv("WEB_PATH", "../web"),
 		EnableUI:   getEnvBool("ENABLE_UI", true),
+
+		S3Bucket:          os.Getenv("S3_BUCKET"),
+		S3Prefix:          os.Getenv("S3_PREFIX"),
+		S3Endpoint:        os.Getenv("S3_ENDPOINT"),
+		S3Region:          getEnv("S3_REGION", getEnv("AWS_REGION", "us-east-1")),
+		S3PathStyle:       getEnvBool("S3_PATH_STYLE", false),
+		S3MaxRetries:      int(getEnvInt64("S3_MAX_RETRIES", 3)),
+		S3AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		S3SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		S3SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+
+		CompactBytes:   getEnvInt64("COMPACT_BYTES", 1<<20),
+		CompactChanges: int(getEnvInt64("COMPACT_CHANGES", 1000)),
+		Backups:        int(getEnvInt64("SNAPSHOT_BACKUPS", 2)),
+
+		FlushInterval:   getEnvDuration("FLUSH_INTERVAL", time.Second),
+		MaxDirtyChanges: int(getEnvInt64("MAX_DIRTY_CHANGES", 100)),
+		QueueSize:       int(getEnvInt64("DOC_QUEUE_SIZE", 256)),
+
+		DocIdleTTL:      getEnvDuration("DOC_IDLE_TTL", 0),
+		DocMemoryBudget: getEnvInt64("DOC_MEMORY_BUDGET", 0),
+		EvictInterval:   getEnvDuration("EVICT_INTERVAL", 30*time.Second),
+
+		ReadReplicas:  int(getEnvInt64("DOC_READ_REPLICAS", 0)),
+		ReplicaMaxLag: getEnvDuration("REPLICA_MAX_LAG", time.Second),
+
+		EventLogSize: int(getEnvInt64("EVENT_LOG_SIZE", 1024)),
+		ResumeWindow: getEnvDuration("EVENT_RESUME_WINDOW", time.Minute),
+		ResyncAfter:  getEnvDuration("EVENT_RESYNC_AFTER", 5*time.Second),
+
+		SyncPeerIdleTTL: getEnvDuration("SYNC_PEER_IDLE_TTL", 10*time.Minute),
 	}
 }
 
@@ -121,3 +320,25 @@ func getEnvBool(key string, defaultValue bool) bool {
 	}
 	return defaultValue
 }
+
+// getEnvInt64 returns environment variable as int64 or default value
+func getEnvInt64(key string, defaultValue int64) int64 {
+	if value := os.Getenv(key); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+// getEnvDuration returns environment variable as time.Duration or default value
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
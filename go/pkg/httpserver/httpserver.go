@@ -26,6 +26,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"path/filepath"
 
 	"github.com/joeblew999/automerge-wazero-example/pkg/api"
 	"github.com/joeblew999/automerge-wazero-example/pkg/config"
@@ -34,9 +35,12 @@ import (
 
 // HTTPServer wraps the Automerge server with HTTP routes.
 type HTTPServer struct {
-	cfg    config.Config
-	server *server.Server
-	mux    *http.ServeMux
+	cfg      config.Config
+	server   *server.Server // The default document (legacy /api/… routes)
+	registry *server.Registry
+	storage  server.Storage
+	mux      *http.ServeMux
+	http     *http.Server
 }
 
 // New creates a new HTTP server with the given configuration.
@@ -46,30 +50,114 @@ type HTTPServer struct {
 func New(cfg config.Config) (*HTTPServer, error) {
 	ctx := context.Background()
 
-	// Create and initialize Automerge server
-	srv := server.New(server.Config{
+	storage, err := openStorage(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the document registry and open the default document
+	reg, err := server.NewRegistry(server.Config{
 		StorageDir: cfg.StorageDir,
+		Storage:    storage,
 		UserID:     cfg.UserID,
 		WASMPath:   cfg.WASMPath,
+
+		CompactBytes:   cfg.CompactBytes,
+		CompactChanges: cfg.CompactChanges,
+		Backups:        cfg.Backups,
+
+		FlushInterval:   cfg.FlushInterval,
+		MaxDirtyChanges: cfg.MaxDirtyChanges,
+		QueueSize:       cfg.QueueSize,
+
+		Replicas:      cfg.ReadReplicas,
+		ReplicaMaxLag: cfg.ReplicaMaxLag,
+
+		EventLogSize: cfg.EventLogSize,
+		ResumeWindow: cfg.ResumeWindow,
+		ResyncAfter:  cfg.ResyncAfter,
+
+		SyncPeerIdleTTL: cfg.SyncPeerIdleTTL,
+	}, server.EvictionConfig{
+		IdleTTL:      cfg.DocIdleTTL,
+		MemoryBudget: cfg.DocMemoryBudget,
+		Interval:     cfg.EvictInterval,
 	})
+	if err != nil {
+		storage.Close()
+		return nil, err
+	}
 
-	if err := srv.Initialize(ctx); err != nil {
+	// Pinned: the single-document routes hold on to its Server
+	srv, err := reg.Pin(ctx, server.DefaultDocID)
+	if err != nil {
+		reg.Close(ctx)
+		storage.Close()
 		return nil, fmt.Errorf("failed to initialize document: %w", err)
 	}
 
 	// Create HTTP server
 	h := &HTTPServer{
-		cfg:    cfg,
-		server: srv,
-		mux:    http.NewServeMux(),
+		cfg:      cfg,
+		server:   srv,
+		registry: reg,
+		storage:  storage,
+		mux:      http.NewServeMux(),
 	}
 
 	// Setup routes
 	h.setupRoutes()
+	h.http = &http.Server{Addr: ":" + cfg.Port, Handler: api.WithUser(h.mux)}
+	// Shutdown waits for every handler, event streams included: end them
+	// right away rather than when the documents close
+	h.http.RegisterOnShutdown(h.registry.CloseSubscriptions)
 
 	return h, nil
 }
 
+// openStorage creates the storage backend selected by cfg.Storage
+func openStorage(cfg config.Config) (server.Storage, error) {
+	switch cfg.Storage {
+	case "", config.StorageFS:
+		storage, err := server.NewFileStorage(cfg.StorageDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open storage: %w", err)
+		}
+		return storage, nil
+	case config.StorageSQLite:
+		path := cfg.SQLitePath
+		if path == "" {
+			path = filepath.Join(cfg.StorageDir, "automerge.db")
+		}
+		storage, err := server.NewSQLiteStorage(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open storage: %w", err)
+		}
+		return storage, nil
+	case config.StorageS3:
+		storage, err := server.NewS3Storage(server.S3Config{
+			Endpoint:        cfg.S3Endpoint,
+			Region:          cfg.S3Region,
+			Bucket:          cfg.S3Bucket,
+			Prefix:          cfg.S3Prefix,
+			AccessKeyID:     cfg.S3AccessKeyID,
+			SecretAccessKey: cfg.S3SecretAccessKey,
+			SessionToken:    cfg.S3SessionToken,
+			PathStyle:       cfg.S3PathStyle,
+			MaxRetries:      cfg.S3MaxRetries,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to open storage: %w", err)
+		}
+		return storage, nil
+	case config.StorageMemory:
+		return server.NewMemoryStorage(), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q (want %q, %q, %q or %q)",
+			cfg.Storage, config.StorageFS, config.StorageSQLite, config.StorageS3, config.StorageMemory)
+	}
+}
+
 // setupRoutes configures all HTTP routes
 func (h *HTTPServer) setupRoutes() {
 	// Health check endpoints (Kubernetes-compatible)
@@ -79,54 +167,80 @@ func (h *HTTPServer) setupRoutes() {
 	h.mux.HandleFunc("/healthz/ready", api.ReadinessHandler(h.server)) // Readiness probe (alt)
 	h.mux.HandleFunc("/readyz", api.ReadinessHandler(h.server))        // Readiness probe
 
+	// Single-document API for the default document
+	registerDocumentRoutes(h.mux, h.server)
+
+	// Multi-document API: /api/docs/{id}/… serves the same routes per document
+	router := api.NewDocumentRouter(h.registry, registerDocumentRoutes)
+	h.mux.Handle("/api/docs", router)
+	h.mux.Handle("/api/docs/", router)
+
+	// Static files (if UI enabled)
+	if h.cfg.EnableUI {
+		staticCfg := api.StaticConfig{
+			WebPath: h.cfg.WebPath,
+		}
+
+		h.mux.Handle("/web/", api.WebHandler(staticCfg))        // Serves web/css/, web/js/, web/components/
+		h.mux.Handle("/vendor/", api.VendorHandler(staticCfg))  // Serves web/vendor/automerge.js
+		h.mux.HandleFunc("/", h.handleRoot)                     // Serves web/index.html for root
+	}
+}
+
+// registerDocumentRoutes adds the routes of one document (/api/text, …)
+// for srv to mux
+func registerDocumentRoutes(mux *http.ServeMux, srv *server.Server) {
 	// M0 - Core Document & Text operations
-	h.mux.HandleFunc("/api/text", api.TextHandler(h.server))
-	h.mux.HandleFunc("/api/stream", api.StreamHandler(h.server))
-	h.mux.HandleFunc("/api/merge", api.MergeHandler(h.server))
-	h.mux.HandleFunc("/api/doc", api.DocHandler(h.server))
+	mux.HandleFunc("/api/text", api.TextHandler(srv))
+	mux.HandleFunc("/api/stream", api.StreamHandler(srv))
+	mux.HandleFunc("/api/merge", api.MergeHandler(srv))
+	mux.HandleFunc("/api/doc", api.DocHandler(srv))
+	mux.HandleFunc("/api/text/blame", api.TextBlameHandler(srv))
+	mux.HandleFunc("/api/actors", api.ActorsHandler(srv))
+	mux.HandleFunc("/api/json", api.JSONHandler(srv))
 
 	// M0 - Map operations
-	h.mux.HandleFunc("/api/map", api.MapHandler(h.server))
-	h.mux.HandleFunc("/api/map/keys", api.MapKeysHandler(h.server))
+	mux.HandleFunc("/api/map", api.MapHandler(srv))
+	mux.HandleFunc("/api/map/keys", api.MapKeysHandler(srv))
 
 	// M0 - List operations
-	h.mux.HandleFunc("/api/list/push", api.ListPushHandler(h.server))
-	h.mux.HandleFunc("/api/list/insert", api.ListInsertHandler(h.server))
-	h.mux.HandleFunc("/api/list", api.ListGetHandler(h.server))
-	h.mux.HandleFunc("/api/list/delete", api.ListDeleteHandler(h.server))
-	h.mux.HandleFunc("/api/list/len", api.ListLenHandler(h.server))
+	mux.HandleFunc("/api/list/push", api.ListPushHandler(srv))
+	mux.HandleFunc("/api/list/insert", api.ListInsertHandler(srv))
+	mux.HandleFunc("/api/list", api.ListGetHandler(srv))
+	mux.HandleFunc("/api/list/delete", api.ListDeleteHandler(srv))
+	mux.HandleFunc("/api/list/len", api.ListLenHandler(srv))
 
 	// M0 - Counter operations
-	h.mux.HandleFunc("/api/counter", api.CounterHandler(h.server))
-	h.mux.HandleFunc("/api/counter/increment", api.CounterIncrementHandler(h.server))
-	h.mux.HandleFunc("/api/counter/get", api.CounterGetHandler(h.server))
+	mux.HandleFunc("/api/counter", api.CounterHandler(srv))
+	mux.HandleFunc("/api/counter/increment", api.CounterIncrementHandler(srv))
+	mux.HandleFunc("/api/counter/get", api.CounterGetHandler(srv))
 
 	// M0 - History operations
-	h.mux.HandleFunc("/api/heads", api.HeadsHandler(h.server))
-	h.mux.HandleFunc("/api/changes", api.ChangesHandler(h.server))
+	mux.HandleFunc("/api/heads", api.HeadsHandler(srv))
+	mux.HandleFunc("/api/changes", api.ChangesHandler(srv))
 
 	// M1 - Sync operations
-	h.mux.HandleFunc("/api/sync", api.SyncHandler(h.server))
+	mux.HandleFunc("/api/sync", api.SyncHandler(srv))
 
 	// M2 - RichText operations
-	h.mux.HandleFunc("/api/richtext/mark", api.RichTextMarkHandler(h.server))
-	h.mux.HandleFunc("/api/richtext/unmark", api.RichTextUnmarkHandler(h.server))
-	h.mux.HandleFunc("/api/richtext/marks", api.RichTextMarksHandler(h.server))
+	mux.HandleFunc("/api/richtext/mark", api.RichTextMarkHandler(srv))
+	mux.HandleFunc("/api/richtext/unmark", api.RichTextUnmarkHandler(srv))
+	mux.HandleFunc("/api/richtext/marks", api.RichTextMarksHandler(srv))
+	mux.HandleFunc("/api/richtext/block/split", api.RichTextSplitBlockHandler(srv))
+	mux.HandleFunc("/api/richtext/block/update", api.RichTextUpdateBlockHandler(srv))
+	mux.HandleFunc("/api/richtext/block/join", api.RichTextJoinBlockHandler(srv))
+	mux.HandleFunc("/api/richtext/export", api.RichTextExportHandler(srv))
+	mux.HandleFunc("/api/richtext/import", api.RichTextImportHandler(srv))
+	mux.HandleFunc("/api/richtext/delta", api.RichTextDeltaHandler(srv))
 
 	// Cursor operations (stable position tracking)
-	h.mux.HandleFunc("/api/cursor", api.CursorGetHandler(h.server))
-	h.mux.HandleFunc("/api/cursor/lookup", api.CursorLookupHandler(h.server))
+	mux.HandleFunc("/api/cursor", api.CursorGetHandler(srv))
+	mux.HandleFunc("/api/cursor/lookup", api.CursorLookupHandler(srv))
 
-	// Static files (if UI enabled)
-	if h.cfg.EnableUI {
-		staticCfg := api.StaticConfig{
-			WebPath: h.cfg.WebPath,
-		}
-
-		h.mux.Handle("/web/", api.WebHandler(staticCfg))        // Serves web/css/, web/js/, web/components/
-		h.mux.Handle("/vendor/", api.VendorHandler(staticCfg))  // Serves web/vendor/automerge.js
-		h.mux.HandleFunc("/", h.handleRoot)                     // Serves web/index.html for root
-	}
+	// Comments (cursor-anchored annotations)
+	mux.HandleFunc("/api/comments", api.CommentsHandler(srv))
+	mux.HandleFunc("/api/comments/reply", api.CommentReplyHandler(srv))
+	mux.HandleFunc("/api/comments/resolve", api.CommentResolveHandler(srv))
 }
 
 // handleRoot serves the web UI index page
@@ -142,23 +256,53 @@ func (h *HTTPServer) handleRoot(w http.ResponseWriter, r *http.Request) {
 //
 // This is a blocking call that runs until the server is stopped or encounters an error.
 func (h *HTTPServer) ListenAndServe() error {
-	addr := ":" + h.cfg.Port
 	log.Printf("[%s] Server starting on http://localhost:%s", h.cfg.UserID, h.cfg.Port)
 
 	if !h.cfg.EnableUI {
 		log.Printf("[%s] UI disabled - only API routes available", h.cfg.UserID)
 	}
 
-	return http.ListenAndServe(addr, h.mux)
+	return h.http.ListenAndServe()
+}
+
+// Shutdown gracefully stops the HTTP server, then flushes queued changes to
+// disk and closes the document.
+//
+// Event streams (/api/stream) are ended as the shutdown starts, so waiting
+// for them doesn't use up ctx; the final flush gets its own time
+// (server.CloseFlushTimeout) even if ctx runs out.
+//
+// ListenAndServe returns http.ErrServerClosed once Shutdown is called.
+//
+// Example:
+//
+//	go srv.ListenAndServe()
+//	<-stop // e.g. SIGTERM
+//	srv.Shutdown(ctx)
+func (h *HTTPServer) Shutdown(ctx context.Context) error {
+	err := h.http.Shutdown(ctx)
+	if closeErr := h.registry.Close(ctx); err == nil {
+		err = closeErr
+	}
+	// The registry doesn't close storage it was given
+	if closeErr := h.storage.Close(); err == nil {
+		err = closeErr
+	}
+	return err
 }
 
-// Server returns the underlying Automerge server.
+// Server returns the Automerge server of the default document.
 //
 // Use this if you need direct access to server methods for custom routes.
 func (h *HTTPServer) Server() *server.Server {
 	return h.server
 }
 
+// Registry returns the document registry behind /api/docs.
+func (h *HTTPServer) Registry() *server.Registry {
+	return h.registry
+}
+
 // Mux returns the HTTP mux for adding custom routes.
 //
 // Example:
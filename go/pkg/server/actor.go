@@ -0,0 +1,257 @@
+// ==============================================================================
+// Layer 5: Go Server - Document Goroutine
+// ==============================================================================
+// ARCHITECTURE: This is the stateful server layer (Layer 5/7).
+//
+// RESPONSIBILITIES:
+// - Run every operation on the document from one goroutine, in order
+// - Queue operations with a bounded queue: ErrQueueFull when it is full
+// - Drop queued operations whose context is cancelled before they run
+// - Report queue depth and counts for readiness probes and stats
+//
+// DEPENDENCIES:
+// - pkg/server/server.go (the Server whose document the goroutine owns)
+//
+// DEPENDENTS:
+// - Every Server method that touches the document (crdt_*.go, document.go,
+//   persister.go)
+//
+// NOTES:
+// - The WASM instance is single-threaded, so a read-write lock gave reads
+//   no parallelism; one goroutine per document gives the same ordering
+//   without lock contention, and documents run in parallel with each other
+// - The goroutine owns s.doc, s.actors and the persistence queue: only
+//   functions passed to do/call touch them
+// - Each operation runs with the actor of the user its context carries
+//   (WithUser, see crdt_blame.go)
+// - Never call do/call from inside an operation: it would wait for itself
+// - An operation that has started runs to completion even if its caller
+//   gives up, so a cancelled request never half-applies a change
+// ==============================================================================
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultQueueSize is how many operations may wait for a document
+const DefaultQueueSize = 256
+
+// Document goroutine errors
+var (
+	ErrQueueFull    = errors.New("document busy: operation queue full")
+	ErrServerClosed = errors.New("document closed")
+)
+
+// Operation states
+const (
+	opQueued int32 = iota
+	opRunning
+	opCancelled
+)
+
+// op is an operation waiting for the document goroutine
+type op struct {
+	fn     func() error
+	user   string // The user it acts for (WithUser), "" for this server's
+	state  atomic.Int32
+	done   chan error // Buffered: the goroutine never waits for the caller
+	queued time.Time
+}
+
+// QueueStats describes a document's operation queue
+type QueueStats struct {
+	Depth     int           // Operations waiting now
+	MaxDepth  int           // Most operations ever waiting at once
+	Capacity  int           // Operations that may wait (Config.QueueSize)
+	Processed uint64        // Operations run
+	Rejected  uint64        // Operations refused with ErrQueueFull
+	Cancelled uint64        // Operations dropped because their context ended
+	MaxWait   time.Duration // Longest an operation waited to run
+}
+
+// queueMetrics are updated atomically by callers and the goroutine
+type queueMetrics struct {
+	maxDepth  atomic.Int64
+	processed atomic.Uint64
+	rejected  atomic.Uint64
+	cancelled atomic.Uint64
+	maxWait   atomic.Int64 // Nanoseconds
+}
+
+// startOps starts the document goroutine (called from New)
+func (s *Server) startOps() {
+	go func() {
+		defer close(s.opsDone)
+		for {
+			select {
+			case <-s.opsStop:
+				// Fail whatever is still queued
+				for {
+					select {
+					case o := <-s.ops:
+						if o.state.CompareAndSwap(opQueued, opCancelled) {
+							o.done <- ErrServerClosed
+						}
+					default:
+						return
+					}
+				}
+			case o := <-s.ops:
+				s.runOp(o)
+			}
+		}
+	}()
+}
+
+// stopOps stops the document goroutine once the operations already queued
+// have run, and waits for it (safe to call more than once)
+func (s *Server) stopOps() {
+	s.opsStopOnce.Do(func() {
+		// Queue the stop behind everything already waiting; unlike do, wait
+		// for room rather than fail
+		s.ops <- &op{
+			fn:     func() error { close(s.opsStop); return nil },
+			done:   make(chan error, 1),
+			queued: time.Now(),
+		}
+	})
+	<-s.opsDone
+}
+
+// runOp runs one operation on the document goroutine
+func (s *Server) runOp(o *op) {
+	if !o.state.CompareAndSwap(opQueued, opRunning) {
+		return // Its caller gave up while it was queued
+	}
+	wait := time.Since(o.queued)
+	for {
+		max := s.metrics.maxWait.Load()
+		if int64(wait) <= max || s.metrics.maxWait.CompareAndSwap(max, int64(wait)) {
+			break
+		}
+	}
+
+	defer func() {
+		// A panic must not take the document goroutine (and every later
+		// request) down with it
+		if r := recover(); r != nil {
+			o.done <- fmt.Errorf("document operation panicked: %v", r)
+		}
+	}()
+	err := s.actAs(o.user)
+	if err == nil {
+		err = o.fn()
+	}
+	s.metrics.processed.Add(1)
+	o.done <- err
+}
+
+// do runs fn on the document goroutine and returns its error. It fails
+// with ErrQueueFull if too many operations are waiting, with ctx.Err() if
+// ctx ends before fn starts, and with ErrServerClosed after Close.
+func (s *Server) do(ctx context.Context, fn func() error) error {
+	return s.exec(ctx, fn, false)
+}
+
+// doWait is do for internal work that must not be refused (flushing,
+// closing): it waits for room in the queue instead
+func (s *Server) doWait(ctx context.Context, fn func() error) error {
+	return s.exec(ctx, fn, true)
+}
+
+// exec queues fn and waits for its result
+func (s *Server) exec(ctx context.Context, fn func() error, wait bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case <-s.opsDone:
+		return ErrServerClosed
+	default:
+	}
+
+	o := &op{fn: fn, user: userFrom(ctx), done: make(chan error, 1), queued: time.Now()}
+	if wait {
+		select {
+		case s.ops <- o:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.opsDone:
+			return ErrServerClosed
+		}
+	} else {
+		select {
+		case s.ops <- o:
+		default:
+			s.metrics.rejected.Add(1)
+			return ErrQueueFull
+		}
+	}
+	depth := int64(len(s.ops))
+	for {
+		max := s.metrics.maxDepth.Load()
+		if depth <= max || s.metrics.maxDepth.CompareAndSwap(max, depth) {
+			break
+		}
+	}
+
+	select {
+	case err := <-o.done:
+		return err
+	case <-ctx.Done():
+		if o.state.CompareAndSwap(opQueued, opCancelled) {
+			s.metrics.cancelled.Add(1)
+			return ctx.Err()
+		}
+		return <-o.done // Already running: wait for it to finish
+	case <-s.opsDone:
+		if o.state.CompareAndSwap(opQueued, opCancelled) {
+			return ErrServerClosed
+		}
+		return <-o.done
+	}
+}
+
+// call is do for operations that return a value
+func call[T any](ctx context.Context, s *Server, fn func() (T, error)) (T, error) {
+	var result T
+	err := s.do(ctx, func() error {
+		var err error
+		result, err = fn()
+		return err
+	})
+	return result, err
+}
+
+// QueueStats returns the state of the document's operation queue
+func (s *Server) QueueStats() QueueStats {
+	return QueueStats{
+		Depth:     len(s.ops),
+		MaxDepth:  int(s.metrics.maxDepth.Load()),
+		Capacity:  cap(s.ops),
+		Processed: s.metrics.processed.Load(),
+		Rejected:  s.metrics.rejected.Load(),
+		Cancelled: s.metrics.cancelled.Load(),
+		MaxWait:   time.Duration(s.metrics.maxWait.Load()),
+	}
+}
+
+// queueStatus reports the queue for readiness probes
+func (s *Server) queueStatus() map[string]interface{} {
+	stats := s.QueueStats()
+	return map[string]interface{}{
+		"depth":       stats.Depth,
+		"max_depth":   stats.MaxDepth,
+		"capacity":    stats.Capacity,
+		"processed":   stats.Processed,
+		"rejected":    stats.Rejected,
+		"cancelled":   stats.Cancelled,
+		"max_wait_ms": stats.MaxWait.Milliseconds(),
+	}
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newQueueServer returns a Server with no document, for exercising the
+// document goroutine on its own
+func newQueueServer(t *testing.T, queueSize int) *Server {
+	t.Helper()
+	s := New(Config{Storage: NewMemoryStorage(), QueueSize: queueSize})
+	t.Cleanup(func() { s.Close(context.Background()) })
+	return s
+}
+
+// block occupies the document goroutine until the returned func is called
+func block(t *testing.T, s *Server) (unblock func()) {
+	t.Helper()
+	started, release := make(chan struct{}), make(chan struct{})
+	go s.do(context.Background(), func() error {
+		close(started)
+		<-release
+		return nil
+	})
+	<-started
+	return func() { close(release) }
+}
+
+func TestServer_QueueOrder(t *testing.T) {
+	s := newQueueServer(t, 0)
+	unblock := block(t, s)
+
+	var (
+		mu    sync.Mutex
+		order []int
+		wg    sync.WaitGroup
+	)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go s.do(context.Background(), func() error {
+			defer wg.Done()
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			return nil
+		})
+		// Queue them in order
+		for s.QueueStats().Depth != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	unblock()
+	wg.Wait()
+
+	if !reflect.DeepEqual(order, []int{0, 1, 2, 3, 4}) {
+		t.Errorf("operations ran in order %v, want [0 1 2 3 4]", order)
+	}
+	if stats := s.QueueStats(); stats.MaxDepth != 5 || stats.Processed != 6 {
+		t.Errorf("QueueStats() = %+v, want MaxDepth 5, Processed 6", stats)
+	}
+}
+
+func TestServer_QueueFull(t *testing.T) {
+	ctx := context.Background()
+	s := newQueueServer(t, 1)
+	unblock := block(t, s)
+
+	queued := make(chan error)
+	go func() { queued <- s.do(ctx, func() error { return nil }) }()
+	for s.QueueStats().Depth != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := s.do(ctx, func() error { return nil }); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("do() with a full queue error = %v, want ErrQueueFull", err)
+	}
+	if _, err := s.GetText(ctx); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("GetText() with a full queue error = %v, want ErrQueueFull", err)
+	}
+	if ready, _ := s.IsReady(); ready {
+		t.Error("IsReady() = true with a full queue")
+	}
+
+	unblock()
+	if err := <-queued; err != nil {
+		t.Errorf("queued do() error = %v", err)
+	}
+	if stats := s.QueueStats(); stats.Rejected != 3 || stats.Capacity != 1 {
+		t.Errorf("QueueStats() = %+v, want Rejected 3, Capacity 1", stats)
+	}
+}
+
+func TestServer_QueueCancel(t *testing.T) {
+	s := newQueueServer(t, 0)
+	unblock := block(t, s)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ran := false
+	result := make(chan error)
+	go func() {
+		result <- s.do(ctx, func() error {
+			ran = true
+			return nil
+		})
+	}()
+	for s.QueueStats().Depth != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	if err := <-result; !errors.Is(err, context.Canceled) {
+		t.Errorf("do() cancelled while queued error = %v, want context.Canceled", err)
+	}
+	unblock()
+
+	// The goroutine skips it
+	s.do(context.Background(), func() error { return nil })
+	if ran {
+		t.Error("an operation cancelled while queued still ran")
+	}
+	if stats := s.QueueStats(); stats.Cancelled != 1 {
+		t.Errorf("Cancelled = %d, want 1", stats.Cancelled)
+	}
+
+	// An operation that has started finishes even if its caller gives up
+	ctx, cancel = context.WithCancel(context.Background())
+	err := s.do(ctx, func() error {
+		cancel()
+		return nil
+	})
+	if err != nil {
+		t.Errorf("do() cancelled while running error = %v, want nil", err)
+	}
+}
+
+func TestServer_QueuePanic(t *testing.T) {
+	s := newQueueServer(t, 0)
+	err := s.do(context.Background(), func() error { panic("boom") })
+	if err == nil {
+		t.Fatal("do() of a panicking operation error = nil")
+	}
+	if err := s.do(context.Background(), func() error { return nil }); err != nil {
+		t.Errorf("do() after a panic error = %v", err)
+	}
+}
+
+func TestServer_QueueClosed(t *testing.T) {
+	ctx := context.Background()
+	s := newQueueServer(t, 0)
+	if err := s.Close(ctx); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := s.Close(ctx); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+	if _, err := s.GetText(ctx); !errors.Is(err, ErrServerClosed) {
+		t.Errorf("GetText() after Close() error = %v, want ErrServerClosed", err)
+	}
+	if err := s.Flush(ctx); !errors.Is(err, ErrServerClosed) {
+		t.Errorf("Flush() after Close() error = %v, want ErrServerClosed", err)
+	}
+}
+
+// TestServer_QueueIndependent checks a busy document doesn't hold up others
+func TestServer_QueueIndependent(t *testing.T) {
+	busy := newQueueServer(t, 0)
+	idle := newQueueServer(t, 0)
+	unblock := block(t, busy)
+	defer unblock()
+
+	done := make(chan error)
+	go func() { done <- idle.do(context.Background(), func() error { return nil }) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("do() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("an operation on one document waited for another document")
+	}
+}
+
+// TestServer_EventsWhileBusy checks subscribers don't wait for the
+// document
+func TestServer_EventsWhileBusy(t *testing.T) {
+	s := newQueueServer(t, 0)
+	unblock := block(t, s)
+	defer unblock()
+
+	sub := s.Subscribe(1)
+	s.publish(Event{Type: EventMap, Op: "put"})
+	s.publish(Event{Type: EventMap, Op: "delete"}) // Buffer full: queued
+	for _, want := range []string{"put", "delete"} {
+		if ev := <-sub.C; ev.Op != want {
+			t.Errorf("subscriber received %q, want %q", ev.Op, want)
+		}
+	}
+	sub.Close()
+	if _, ok := <-sub.C; ok {
+		t.Error("subscription channel still open after Close()")
+	}
+}
@@ -0,0 +1,237 @@
+// ==============================================================================
+// Layer 5: Go Server - Text Attribution (Stateful + Thread-safe)
+// ==============================================================================
+// ARCHITECTURE: This is the stateful server layer (Layer 5/7).
+//
+// RESPONSIBILITIES:
+// - Thread-safe CRDT operations (run on the document goroutine)
+// - Actor ID → user ID registry (persisted as actors.json in Storage)
+// - An actor of its own for each user that edits through this server
+// - Attribution spans annotated with user IDs
+//
+// DEPENDENCIES:
+// - Layer 4: pkg/automerge (pure CRDT operations)
+//
+// DEPENDENTS:
+// - Layer 6: pkg/api (HTTP handlers)
+//
+// RELATED FILES (1:1 mapping):
+// - Layer 2: rust/automerge_wasi/src/blame.rs (WASI exports)
+// - Layer 3: pkg/wazero/crdt_blame.go (FFI wrappers)
+// - Layer 4: pkg/automerge/crdt_blame.go (pure CRDT API)
+// - Layer 6: pkg/api/crdt_blame.go (HTTP handlers)
+//
+// NOTES:
+// - All public methods are thread-safe (run on the document goroutine)
+// - A loaded document gets a fresh actor ID, so each server start registers
+//   a new actor for the same user; old mappings are kept for old changes
+// - Operations whose context carries a user (WithUser) run with that user's
+//   actor, made on first use and kept across restarts (user_actors.json);
+//   only actors this server made are reused, never ones peers registered,
+//   which the peers go on using themselves
+// - Peers syncing their own changes register their actors with
+//   RegisterActor; an actor keeps the first user it was registered to, and
+//   the actors this server makes changes with can't be registered
+// - Registration is trusted: anyone who can call RegisterActor can claim an
+//   actor nobody registered yet, so expose it to authenticated peers only
+// - Actors nobody registered are reported with an empty user ID
+// - The registry is written by the persister (Flush), not on the document
+//   goroutine: a registration is as durable as an edit
+// ==============================================================================
+
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+)
+
+// Blame operations - maps to automerge/crdt_blame.go
+
+// BlameSpan is an attribution span with the user behind the actor
+type BlameSpan struct {
+	automerge.AttributionSpan
+	UserID string
+}
+
+// BlameEdit is an inserted or deleted span with the user behind the actor
+type BlameEdit struct {
+	automerge.AttributionEdit
+	UserID string
+}
+
+// loadActors reads the actor registry and the actors made for users, and
+// registers this server's own actor (called from Initialize, before the
+// server is shared)
+func (s *Server) loadActors(ctx context.Context) error {
+	for key, into := range map[string]*map[string]string{actorsKey: &s.actors, userActorsKey: &s.userActors} {
+		data, err := s.storage.Get(ctx, s.docID, key)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", key, err)
+		}
+		if err := json.Unmarshal(data, into); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", key, err)
+		}
+	}
+	// Only reuse actors still registered to their user
+	for userID, actor := range s.userActors {
+		if s.actors[actor] != userID {
+			delete(s.userActors, userID)
+		}
+	}
+
+	actor, err := s.doc.GetActor(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get actor: %w", err)
+	}
+	s.ownActor, s.actor = actor, actor
+	s.registerActor(actor, s.userID)
+	return nil
+}
+
+// ErrActorRegistered is returned when registering an actor already
+// registered to another user, or one this server makes changes with
+var ErrActorRegistered = errors.New("actor is already registered")
+
+// userKey is the context key of the user an operation acts for
+type userKey struct{}
+
+// WithUser returns a context whose operations make their changes as userID:
+// with an actor registered to userID instead of this server's own, so
+// blame names userID
+//
+// Example:
+//
+//	srv.SetText(server.WithUser(ctx, "alice"), "Hello") // Blamed on alice
+func WithUser(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userKey{}, userID)
+}
+
+// userFrom returns the user set by WithUser ("" if none)
+func userFrom(ctx context.Context) string {
+	userID, _ := ctx.Value(userKey{}).(string)
+	return userID
+}
+
+// registerActor records actor → userID for the persister to write (runs on
+// the document goroutine)
+func (s *Server) registerActor(actor, userID string) {
+	if s.actors[actor] == userID {
+		return
+	}
+	s.actors[actor] = userID
+	s.dirtyKeys[actorsKey] = true
+}
+
+// actAs switches the document to userID's actor, or to this server's own
+// if userID is "" or this server's user (runs on the document goroutine,
+// before each operation)
+func (s *Server) actAs(userID string) error {
+	if s.doc == nil {
+		return nil
+	}
+
+	actor := s.ownActor
+	if userID != "" && userID != s.userID {
+		actor = s.userActors[userID]
+		if actor == "" {
+			id := make([]byte, 16)
+			rand.Read(id)
+			actor = hex.EncodeToString(id)
+			s.userActors[userID] = actor
+			s.dirtyKeys[userActorsKey] = true
+			s.registerActor(actor, userID)
+		}
+	}
+	if actor == s.actor {
+		return nil
+	}
+
+	// Every operation commits its changes (saveDocument), so none are left
+	// to be made under the wrong actor
+	if err := s.doc.SetActor(context.Background(), actor); err != nil {
+		return fmt.Errorf("failed to set actor: %w", err)
+	}
+	s.actor = actor
+	return nil
+}
+
+// RegisterActor records that changes by actor were made by userID (thread-safe).
+// Peers that sync their own changes call this so blame can name them. It
+// fails with ErrActorRegistered if actor is registered to another user, or
+// is one this server makes changes with (its own, or one made for a user).
+//
+// Registration is trusted, first come first served: whoever registers an
+// actor first names the user blame reports for its changes, whether or not
+// they made them. Only expose it (POST /api/actors) to authenticated peers,
+// as with the X-User-ID header.
+func (s *Server) RegisterActor(ctx context.Context, actor, userID string) error {
+	if actor == "" || userID == "" {
+		return fmt.Errorf("actor and user ID are required")
+	}
+	if _, err := hex.DecodeString(actor); err != nil {
+		return fmt.Errorf("invalid actor ID %q: must be hex", actor)
+	}
+
+	return s.do(ctx, func() error {
+		if registered, ok := s.actors[actor]; ok && registered != userID {
+			return fmt.Errorf("%w: %s", ErrActorRegistered, actor)
+		}
+		// A peer making changes with it would clash with ours
+		if actor == s.ownActor || s.userActors[s.actors[actor]] == actor {
+			return fmt.Errorf("%w: %s is used by this server", ErrActorRegistered, actor)
+		}
+		s.registerActor(actor, userID)
+		return nil
+	})
+}
+
+// UserForActor returns the user registered for actor ("" if unknown) (thread-safe)
+func (s *Server) UserForActor(actor string) string {
+	user, _ := call(context.Background(), s, func() (string, error) {
+		return s.actors[actor], nil
+	})
+	return user
+}
+
+// TextBlame returns who wrote each span of the text at path (thread-safe)
+func (s *Server) TextBlame(ctx context.Context, path automerge.Path) ([]BlameSpan, error) {
+	return call(ctx, s, func() ([]BlameSpan, error) {
+		spans, err := s.doc.TextAttribution(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+
+		result := make([]BlameSpan, len(spans))
+		for i, span := range spans {
+			result[i] = BlameSpan{AttributionSpan: span, UserID: s.actors[span.Actor]}
+		}
+		return result, nil
+	})
+}
+
+// TextBlameDiff returns the spans inserted and deleted at path between two
+// sets of heads, with the user behind each edit (thread-safe)
+func (s *Server) TextBlameDiff(ctx context.Context, path automerge.Path, before, after []automerge.ChangeHash) ([]BlameEdit, error) {
+	return call(ctx, s, func() ([]BlameEdit, error) {
+		edits, err := s.doc.TextAttributionDiff(ctx, path, before, after)
+		if err != nil {
+			return nil, err
+		}
+
+		result := make([]BlameEdit, len(edits))
+		for i, edit := range edits {
+			result[i] = BlameEdit{AttributionEdit: edit, UserID: s.actors[edit.Actor]}
+		}
+		return result, nil
+	})
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"log"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+)
+
+// Comment operations - maps to automerge/crdt_comments.go
+
+// commentPath is the path of a comment thread, for its events
+func commentPath(id string) automerge.Path {
+	return automerge.Root().Get(automerge.CommentsKey).Get(id)
+}
+
+// Comments returns all comment threads with their current ranges (thread-safe)
+func (s *Server) Comments(ctx context.Context) ([]automerge.CommentRange, error) {
+	return call(ctx, s, func() ([]automerge.CommentRange, error) {
+		return s.doc.Comments(ctx)
+	})
+}
+
+// AddComment anchors a comment to start..end of the text at path (thread-safe).
+// An empty author defaults to this server's user ID.
+func (s *Server) AddComment(ctx context.Context, path automerge.Path, start, end uint, author, body string) (*automerge.Comment, error) {
+	return call(ctx, s, func() (*automerge.Comment, error) {
+		if author == "" {
+			author = s.userID
+		}
+		comment, err := s.doc.AddComment(ctx, path, start, end, author, body)
+		if err != nil {
+			return nil, err
+		}
+
+		// Save snapshot
+		if err := s.saveDocument(ctx); err != nil {
+			log.Printf("Warning: failed to save snapshot: %v", err)
+		}
+		s.emit(ctx, Event{Type: EventComment, Op: "add", Path: commentPath(comment.ID)})
+
+		return comment, nil
+	})
+}
+
+// ReplyToComment appends a reply to a comment thread (thread-safe).
+// An empty author defaults to this server's user ID.
+func (s *Server) ReplyToComment(ctx context.Context, id, author, body string) (*automerge.CommentReply, error) {
+	return call(ctx, s, func() (*automerge.CommentReply, error) {
+		if author == "" {
+			author = s.userID
+		}
+		reply, err := s.doc.ReplyToComment(ctx, id, author, body)
+		if err != nil {
+			return nil, err
+		}
+
+		// Save snapshot
+		if err := s.saveDocument(ctx); err != nil {
+			log.Printf("Warning: failed to save snapshot: %v", err)
+		}
+		s.emit(ctx, Event{Type: EventComment, Op: "reply", Path: commentPath(id)})
+
+		return reply, nil
+	})
+}
+
+// ResolveComment marks a comment thread resolved or reopens it (thread-safe)
+func (s *Server) ResolveComment(ctx context.Context, id string, resolved bool) error {
+	return s.do(ctx, func() error {
+		if err := s.doc.ResolveComment(ctx, id, resolved); err != nil {
+			return err
+		}
+
+		// Save snapshot
+		if err := s.saveDocument(ctx); err != nil {
+			log.Printf("Warning: failed to save snapshot: %v", err)
+		}
+		s.emit(ctx, Event{Type: EventComment, Op: "resolve", Path: commentPath(id)})
+
+		return nil
+	})
+}
@@ -4,10 +4,10 @@
 // ARCHITECTURE: This is the stateful server layer (Layer 5/7).
 //
 // RESPONSIBILITIES:
-// - Thread-safe CRDT operations (mutex protection)
-// - State management (owns *automerge.Document, sync.RWMutex)
+// - Thread-safe CRDT operations (run on the document goroutine)
+// - State management (owns *automerge.Document)
 // - Persistence (saveDocument after mutations)
-// - SSE broadcasting to connected clients
+// - Change events for subscribers (events.go)
 //
 // DEPENDENCIES:
 // - Layer 4: pkg/automerge (pure CRDT operations)
@@ -23,9 +23,9 @@
 // - Layer 7: web/js/crdt_richtext.js + web/components/crdt_richtext.html
 //
 // NOTES:
-// - All public methods are thread-safe (use s.mu.Lock/RLock)
+// - All public methods are thread-safe (run on the document goroutine)
 // - This layer delegates to Layer 4 for actual CRDT operations
-// - Broadcasts updates to SSE clients after mutations
+// - Publishes an event after each mutation
 // ==============================================================================
 
 package server
@@ -35,46 +35,190 @@ import (
 	"log"
 
 	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge/richtext"
 )
 
 // RichText operations - maps to automerge/richtext.go (M2 milestone)
 
 // RichTextMark applies a mark (bold, italic, etc.) to a range of text (thread-safe)
 func (s *Server) RichTextMark(ctx context.Context, path automerge.Path, mark automerge.Mark, expand automerge.ExpandMark) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	return s.do(ctx, func() error {
+		if err := s.doc.Mark(ctx, path, mark, expand); err != nil {
+			return err
+		}
 
-	if err := s.doc.Mark(ctx, path, mark, expand); err != nil {
-		return err
-	}
-
-	if err := s.saveDocument(ctx); err != nil {
-		log.Printf("Warning: failed to save snapshot: %v", err)
-	}
+		if err := s.saveDocument(ctx); err != nil {
+			log.Printf("Warning: failed to save snapshot: %v", err)
+		}
+		s.emit(ctx, Event{Type: EventRichText, Op: "mark", Path: path})
 
-	return nil
+		return nil
+	})
 }
 
 // RichTextUnmark removes a mark from a range of text (thread-safe)
 func (s *Server) RichTextUnmark(ctx context.Context, path automerge.Path, name string, start, end uint, expand automerge.ExpandMark) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	return s.do(ctx, func() error {
+		if err := s.doc.Unmark(ctx, path, name, start, end, expand); err != nil {
+			return err
+		}
 
-	if err := s.doc.Unmark(ctx, path, name, start, end, expand); err != nil {
-		return err
-	}
+		if err := s.saveDocument(ctx); err != nil {
+			log.Printf("Warning: failed to save snapshot: %v", err)
+		}
+		s.emit(ctx, Event{Type: EventRichText, Op: "unmark", Path: path})
 
-	if err := s.saveDocument(ctx); err != nil {
-		log.Printf("Warning: failed to save snapshot: %v", err)
-	}
-
-	return nil
+		return nil
+	})
 }
 
 // GetRichTextMarks retrieves all marks at a specific position (thread-safe)
 func (s *Server) GetRichTextMarks(ctx context.Context, path automerge.Path, pos uint) ([]automerge.Mark, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	return call(ctx, s, func() ([]automerge.Mark, error) {
+		return s.doc.GetMarks(ctx, path, pos)
+	})
+}
+
+// GetRichTextSpans retrieves the text split into spans with their active marks (thread-safe)
+func (s *Server) GetRichTextSpans(ctx context.Context, path automerge.Path) ([]automerge.Span, error) {
+	return call(ctx, s, func() ([]automerge.Span, error) {
+		return s.doc.Spans(ctx, path)
+	})
+}
+
+// SplitBlock inserts a block marker (paragraph, heading...) into the text (thread-safe)
+func (s *Server) SplitBlock(ctx context.Context, path automerge.Path, index uint, block automerge.Block) error {
+	return s.do(ctx, func() error {
+		if _, err := s.doc.SplitBlock(ctx, path, index, block); err != nil {
+			return err
+		}
+
+		if err := s.saveDocument(ctx); err != nil {
+			log.Printf("Warning: failed to save snapshot: %v", err)
+		}
+		s.emit(ctx, Event{Type: EventRichText, Op: "split_block", Path: path})
+
+		return nil
+	})
+}
+
+// UpdateBlock changes the type and attributes of a block marker (thread-safe)
+func (s *Server) UpdateBlock(ctx context.Context, path automerge.Path, index uint, block automerge.Block) error {
+	return s.do(ctx, func() error {
+		if err := s.doc.UpdateBlock(ctx, path, index, block); err != nil {
+			return err
+		}
+
+		if err := s.saveDocument(ctx); err != nil {
+			log.Printf("Warning: failed to save snapshot: %v", err)
+		}
+		s.emit(ctx, Event{Type: EventRichText, Op: "update_block", Path: path})
+
+		return nil
+	})
+}
+
+// JoinBlock removes a block marker from the text (thread-safe)
+func (s *Server) JoinBlock(ctx context.Context, path automerge.Path, index uint) error {
+	return s.do(ctx, func() error {
+		if err := s.doc.JoinBlock(ctx, path, index); err != nil {
+			return err
+		}
+
+		if err := s.saveDocument(ctx); err != nil {
+			log.Printf("Warning: failed to save snapshot: %v", err)
+		}
+		s.emit(ctx, Event{Type: EventRichText, Op: "join_block", Path: path})
 
-	return s.doc.GetMarks(ctx, path, pos)
+		return nil
+	})
+}
+
+// ImportRichText replaces the text with parsed rich text, as one change (thread-safe)
+func (s *Server) ImportRichText(ctx context.Context, path automerge.Path, spans []automerge.Span) error {
+	return s.do(ctx, func() error {
+		if err := richtext.Replace(ctx, s.doc, path, spans, "Import rich text"); err != nil {
+			return err
+		}
+
+		if err := s.saveDocument(ctx); err != nil {
+			log.Printf("Warning: failed to save snapshot: %v", err)
+		}
+		s.emit(ctx, Event{Type: EventRichText, Op: "import", Path: path})
+
+		return nil
+	})
+}
+
+// PasteRichText replaces del positions at pos with parsed rich text, as one change (thread-safe)
+func (s *Server) PasteRichText(ctx context.Context, path automerge.Path, pos, del uint, spans []automerge.Span) error {
+	return s.do(ctx, func() error {
+		if err := richtext.Splice(ctx, s.doc, path, pos, del, spans, "Paste rich text"); err != nil {
+			return err
+		}
+
+		if err := s.saveDocument(ctx); err != nil {
+			log.Printf("Warning: failed to save snapshot: %v", err)
+		}
+		s.emit(ctx, Event{Type: EventRichText, Op: "paste", Path: path})
+
+		return nil
+	})
+}
+
+// ApplyRichTextDelta applies an editor (Quill) delta to the text at path, as one change (thread-safe)
+func (s *Server) ApplyRichTextDelta(ctx context.Context, path automerge.Path, delta richtext.Delta) error {
+	return s.do(ctx, func() error {
+		if err := richtext.ApplyDelta(ctx, s.doc, path, delta, "Apply delta"); err != nil {
+			return err
+		}
+
+		if err := s.saveDocument(ctx); err != nil {
+			log.Printf("Warning: failed to save snapshot: %v", err)
+		}
+		s.emit(ctx, Event{Type: EventRichText, Op: "delta", Path: path})
+
+		return nil
+	})
+}
+
+// RichTextDelta returns the text at path as a delta and the heads it was read at (thread-safe)
+func (s *Server) RichTextDelta(ctx context.Context, path automerge.Path) (richtext.Delta, []automerge.ChangeHash, error) {
+	var (
+		heads []automerge.ChangeHash
+		spans []automerge.Span
+	)
+	err := s.do(ctx, func() error {
+		var err error
+		if heads, err = s.doc.GetHeads(ctx); err != nil {
+			return err
+		}
+		spans, err = s.doc.Spans(ctx, path)
+		return err
+	})
+	if err != nil {
+		return richtext.Delta{}, nil, err
+	}
+	return richtext.DeltaFromSpans(spans), heads, nil
+}
+
+// RichTextDeltaSince returns the edits to the text at path since the given
+// heads as a delta, and the current heads (thread-safe)
+func (s *Server) RichTextDeltaSince(ctx context.Context, path automerge.Path, since []automerge.ChangeHash) (richtext.Delta, []automerge.ChangeHash, error) {
+	var (
+		heads   []automerge.ChangeHash
+		patches []automerge.Patch
+	)
+	err := s.do(ctx, func() error {
+		var err error
+		if heads, err = s.doc.GetHeads(ctx); err != nil {
+			return err
+		}
+		patches, err = s.doc.TextPatches(ctx, path, since, heads)
+		return err
+	})
+	if err != nil {
+		return richtext.Delta{}, nil, err
+	}
+	return richtext.DeltaFromPatches(patches), heads, nil
 }
@@ -4,10 +4,10 @@
 // ARCHITECTURE: This is the stateful server layer (Layer 5/7).
 //
 // RESPONSIBILITIES:
-// - Thread-safe CRDT operations (mutex protection)
-// - State management (owns *automerge.Document, sync.RWMutex)
+// - Thread-safe CRDT operations (run on the document goroutine)
+// - State management (owns *automerge.Document)
 // - Persistence (saveDocument after mutations)
-// - SSE broadcasting to connected clients
+// - Change events for subscribers (events.go)
 //
 // DEPENDENCIES:
 // - Layer 4: pkg/automerge (pure CRDT operations)
@@ -23,8 +23,14 @@
 // - Layer 7: web/js/sync.js + web/components/sync.html (frontend)
 //
 // NOTES:
-// - All public methods are thread-safe (use s.mu.RLock/Lock)
+// - All public methods are thread-safe (run on the document goroutine)
 // - Sync state is per-peer (not global)
+// - SyncPeer keeps one state per peer ID and persists it under
+//   sync.<peer ID> once a message was received from that peer, so a restart
+//   doesn't resend what the peer already has
+// - Peer IDs come from clients, so states can't stay in memory for good:
+//   once persisted, a state unused for SyncPeerIdleTTL is freed by the
+//   persister, and SyncPeer restores it from storage when the peer is back
 // - This layer delegates to Layer 4 for actual CRDT operations
 // ==============================================================================
 
@@ -32,7 +38,10 @@ package server
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"time"
 
 	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
 )
@@ -41,41 +50,158 @@ import (
 
 // InitSyncState initializes a new sync state for a peer (thread-safe)
 func (s *Server) InitSyncState(ctx context.Context) (*automerge.SyncState, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	return call(ctx, s, func() (*automerge.SyncState, error) {
+		return s.doc.InitSyncState(ctx)
+	})
+}
+
+// ErrInvalidPeerID is returned for a peer ID that can't name a storage key
+var ErrInvalidPeerID = errors.New("invalid peer ID")
 
-	return s.doc.InitSyncState(ctx)
+// DefaultSyncPeerIdleTTL is how long an unused sync peer state is kept in
+// memory by default (see Config.SyncPeerIdleTTL)
+const DefaultSyncPeerIdleTTL = 10 * time.Minute
+
+// SyncPeer returns the sync state of peerID, restored from storage or
+// initialized on first use (thread-safe)
+//
+// The server owns the state: callers must not free it. It is written back
+// by the persister after each message received with it, and freed once
+// unused for SyncPeerIdleTTL: use it right away and call SyncPeer again for
+// the next exchange rather than holding on to it.
+//
+// Example:
+//
+//	state, _ := srv.SyncPeer(ctx, "browser-1")
+//	srv.ReceiveSyncMessage(ctx, state, msg)
+//	reply, _ := srv.GenerateSyncMessage(ctx, state)
+func (s *Server) SyncPeer(ctx context.Context, peerID string) (*automerge.SyncState, error) {
+	key := syncKeyPrefix + peerID
+	if err := validateName("key", key); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPeerID, err)
+	}
+
+	state, err := call(ctx, s, func() (*automerge.SyncState, error) {
+		state := s.syncPeers[peerID]
+		s.touchSyncPeer(state)
+		return state, nil
+	})
+	if err != nil || state != nil {
+		return state, err
+	}
+
+	// Read the stored state off the goroutine
+	data, err := s.storage.Get(ctx, s.docID, key)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+
+	return call(ctx, s, func() (*automerge.SyncState, error) {
+		if state := s.syncPeers[peerID]; state != nil {
+			s.touchSyncPeer(state)
+			return state, nil // Another request got here first
+		}
+		var state *automerge.SyncState
+		if data != nil {
+			loaded, err := s.doc.LoadSyncState(ctx, data)
+			if err != nil {
+				log.Printf("Warning: failed to load %s, starting over: %v", key, err)
+			}
+			state = loaded
+		}
+		if state == nil {
+			initial, err := s.doc.InitSyncState(ctx)
+			if err != nil {
+				return nil, err
+			}
+			state = initial
+		}
+		s.syncPeers[peerID] = state
+		s.syncPeerIDs[state] = peerID
+		s.touchSyncPeer(state)
+		return state, nil
+	})
+}
+
+// touchSyncPeer records that a peer's state (nil or not a peer's: ignored)
+// is in use (runs on the document goroutine)
+func (s *Server) touchSyncPeer(state *automerge.SyncState) {
+	if peerID, ok := s.syncPeerIDs[state]; ok {
+		s.syncPeerUsed[peerID] = time.Now()
+	}
+}
+
+// forgetSyncPeer removes a peer's state from the server (runs on the
+// document goroutine)
+func (s *Server) forgetSyncPeer(peerID string, state *automerge.SyncState) {
+	delete(s.syncPeers, peerID)
+	delete(s.syncPeerIDs, state)
+	delete(s.syncPeerUsed, peerID)
+}
+
+// expireSyncPeers frees the peer states unused for syncPeerIdle whose
+// latest version is stored (called by the persister after a flush)
+func (s *Server) expireSyncPeers(ctx context.Context) {
+	// Not while a flush is writing states: a failed write marks the state
+	// dirty again, and needs it to still be here
+	s.persistMu.Lock()
+	defer s.persistMu.Unlock()
+
+	s.do(ctx, func() error {
+		for peerID, used := range s.syncPeerUsed {
+			if time.Since(used) < s.syncPeerIdle || s.dirtyKeys[syncKeyPrefix+peerID] {
+				continue
+			}
+			state := s.syncPeers[peerID]
+			s.forgetSyncPeer(peerID, state)
+			if err := s.doc.FreeSyncState(ctx, state); err != nil {
+				log.Printf("Warning: failed to free sync state of %s: %v", peerID, err)
+			}
+		}
+		return nil
+	})
 }
 
 // FreeSyncState frees a peer's sync state (thread-safe)
 func (s *Server) FreeSyncState(ctx context.Context, state *automerge.SyncState) error {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	return s.doc.FreeSyncState(ctx, state)
+	return s.do(ctx, func() error {
+		if peerID, ok := s.syncPeerIDs[state]; ok {
+			s.forgetSyncPeer(peerID, state)
+			delete(s.dirtyKeys, syncKeyPrefix+peerID)
+		}
+		return s.doc.FreeSyncState(ctx, state)
+	})
 }
 
 // GenerateSyncMessage generates a sync message for the given peer (thread-safe)
 func (s *Server) GenerateSyncMessage(ctx context.Context, state *automerge.SyncState) ([]byte, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	return s.doc.GenerateSyncMessage(ctx, state)
+	return call(ctx, s, func() ([]byte, error) {
+		s.touchSyncPeer(state)
+		return s.doc.GenerateSyncMessage(ctx, state)
+	})
 }
 
 // ReceiveSyncMessage processes a sync message from a peer (thread-safe)
 func (s *Server) ReceiveSyncMessage(ctx context.Context, state *automerge.SyncState, message []byte) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	return s.do(ctx, func() error {
+		before, err := s.doc.GetHeads(ctx)
+		if err != nil {
+			return err
+		}
+		if err := s.doc.ReceiveSyncMessage(ctx, state, message); err != nil {
+			return err
+		}
+		if peerID, ok := s.syncPeerIDs[state]; ok {
+			s.dirtyKeys[syncKeyPrefix+peerID] = true
+			s.syncPeerUsed[peerID] = time.Now()
+		}
 
-	if err := s.doc.ReceiveSyncMessage(ctx, state, message); err != nil {
-		return err
-	}
-
-	// Save after receiving sync (document may have been updated)
-	if err := s.saveDocument(ctx); err != nil {
-		log.Printf("Warning: failed to save snapshot after sync: %v", err)
-	}
+		// Save after receiving sync (document may have been updated)
+		if err := s.saveDocument(ctx); err != nil {
+			log.Printf("Warning: failed to save snapshot after sync: %v", err)
+		}
+		s.emitIncoming(ctx, EventSync, "receive", before)
 
-	return nil
+		return nil
+	})
 }
@@ -3,9 +3,9 @@
 //
 // Responsibilities:
 // - Own the Document instance and manage its lifecycle
-// - Add thread safety with mutex protection (s.mu.Lock/RLock)
+// - Add thread safety: operations run on the document goroutine (actor.go)
 // - Add persistence (call saveDocument after mutations)
-// - Manage SSE broadcast to connected clients
+// - Publish change events to subscribers (events.go)
 //
 // Dependencies:
 // ⬇️  Calls: go/pkg/automerge/text.go (Layer 4 - stateless CRDT API)
@@ -18,9 +18,9 @@
 //
 // Design Note:
 // This layer adds MUTATION side effects that Layer 4 doesn't have:
-// - Mutex locking (thread safety for concurrent HTTP requests)
+// - Serialization (one goroutine per document for concurrent HTTP requests)
 // - Disk writes (saveDocument after each mutation)
-// - SSE broadcasts (notify all connected clients)
+// - Change events (notify subscribers such as SSE streams)
 // ═══════════════════════════════════════════════════════════════
 
 package server
@@ -36,34 +36,33 @@ import (
 
 // GetText returns the current text from the document (thread-safe)
 func (s *Server) GetText(ctx context.Context) (string, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	path := automerge.Root().Get("content")
-	return s.doc.GetText(ctx, path)
+	return call(ctx, s, func() (string, error) {
+		path := automerge.Root().Get("content")
+		return s.doc.GetText(ctx, path)
+	})
 }
 
 // SetText replaces the entire text in the document (thread-safe)
 func (s *Server) SetText(ctx context.Context, text string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	path := automerge.Root().Get("content")
+	return s.do(ctx, func() error {
+		path := automerge.Root().Get("content")
 
-	currentLen, err := s.doc.TextLength(ctx, path)
-	if err != nil {
-		return err
-	}
+		currentLen, err := s.doc.TextLength(ctx, path)
+		if err != nil {
+			return err
+		}
 
-	// Delete all current text and insert new text
-	if err := s.doc.SpliceText(ctx, path, 0, int(currentLen), text); err != nil {
-		return err
-	}
+		// Delete all current text and insert new text
+		if err := s.doc.SpliceText(ctx, path, 0, int(currentLen), text); err != nil {
+			return err
+		}
 
-	// Save snapshot
-	if err := s.saveDocument(ctx); err != nil {
-		log.Printf("Warning: failed to save snapshot: %v", err)
-	}
+		// Save snapshot
+		if err := s.saveDocument(ctx); err != nil {
+			log.Printf("Warning: failed to save snapshot: %v", err)
+		}
+		s.emit(ctx, Event{Type: EventText, Op: "set", Path: path})
 
-	return nil
+		return nil
+	})
 }
@@ -0,0 +1,204 @@
+// ==============================================================================
+// Layer 5: Go Server - Event Delivery to Slow Subscribers
+// ==============================================================================
+// ARCHITECTURE: This is the stateful server layer (Layer 5/7).
+//
+// RESPONSIBILITIES:
+// - Queue events for a subscriber whose channel is full, and move them into
+//   the channel as it makes room
+// - Coalesce queued text snapshots: only the latest text per path matters
+// - Replace the queue with one "resync" event once a subscriber has been
+//   behind for too long or too far
+// - Close subscribers that are still behind when they would need another
+//   resync
+// - Count published, coalesced and dropped events, resyncs and disconnects,
+//   and report how far behind subscribers are (EventStats)
+//
+// DEPENDENCIES:
+// - pkg/server/events.go (Subscription, publish)
+//
+// DEPENDENTS:
+// - pkg/server/events.go (publish delivers through deliver)
+// - pkg/api/handlers.go (StreamHandler turns a resync into a fresh snapshot)
+//
+// NOTES:
+// - publish never waits: events beyond a subscriber's channel wait in its
+//   pending queue, which a goroutine of its own (the pump) drains
+// - A subscriber is "behind" while events wait in its queue. It gets a
+//   resync when that has lasted ResyncAfter, or when the queue (after
+//   coalescing) holds more events than its channel.
+// - A resync stands for every event it replaced: its ID is the last one's,
+//   so resuming after it misses nothing
+// - A subscriber that needs a second resync before its queue ever emptied
+//   can't keep up at all: it is closed (Overflowed), and reconnects
+// - All of this is guarded by Server.subsMu
+// ==============================================================================
+
+package server
+
+import (
+	"log"
+	"slices"
+	"time"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+)
+
+// DefaultResyncAfter is how long a subscriber may stay behind before it is
+// resynced
+const DefaultResyncAfter = 5 * time.Second
+
+// EventStats describes a document's change events and their subscribers
+type EventStats struct {
+	Subscribers int
+	Published   uint64        // Events published
+	Coalesced   uint64        // Queued text snapshots replaced by a later one
+	Dropped     uint64        // Queued events replaced by a resync
+	Resyncs     uint64        // Resync events sent
+	Disconnects uint64        // Subscribers closed for staying behind
+	Behind      int           // Subscribers behind now
+	MaxPending  int           // Most events queued for one subscriber now
+	MaxLag      time.Duration // Longest a subscriber has been behind now
+	ResyncAfter time.Duration // Config.ResyncAfter
+}
+
+// eventMetrics are guarded by Server.subsMu
+type eventMetrics struct {
+	published   uint64
+	coalesced   uint64
+	dropped     uint64
+	resyncs     uint64
+	disconnects uint64
+}
+
+// deliver sends ev to sub, or queues it if sub's channel is full
+func (s *Server) deliver(sub *Subscription, ev Event) {
+	if len(sub.pending) == 0 && !sub.pumping {
+		select {
+		case sub.ch <- ev:
+			return
+		default:
+			sub.behindSince = time.Now()
+		}
+	}
+
+	// Only the latest text matters: drop an older one still waiting (not a
+	// sync or merge listing its paths: those say what else changed)
+	if ev.Text != nil && len(ev.Paths) == 0 {
+		i := slices.IndexFunc(sub.pending, func(p Event) bool {
+			return p.Text != nil && len(p.Paths) == 0 && p.Type == ev.Type && p.Path.String() == ev.Path.String()
+		})
+		if i >= 0 {
+			sub.pending = slices.Delete(sub.pending, i, i+1)
+			s.eventMetrics.coalesced++
+		}
+	}
+	sub.pending = append(sub.pending, ev)
+	if !sub.pumping {
+		sub.pumping = true
+		go s.pump(sub)
+	}
+
+	if len(sub.pending) > cap(sub.ch) || (s.resyncAfter > 0 && time.Since(sub.behindSince) >= s.resyncAfter) {
+		s.resync(sub)
+	}
+}
+
+// resync replaces sub's queue with a resync event, or closes sub if it
+// hasn't caught up since the last one
+func (s *Server) resync(sub *Subscription) {
+	if sub.resynced {
+		log.Printf("Warning: event subscriber still %d events behind after a resync; closing it", len(sub.pending))
+		s.eventMetrics.dropped += uint64(len(sub.pending))
+		s.eventMetrics.disconnects++
+		sub.overflowed = true
+		s.unsubscribe(sub)
+		return
+	}
+
+	last := sub.pending[len(sub.pending)-1]
+	s.eventMetrics.dropped += uint64(len(sub.pending))
+	s.eventMetrics.resyncs++
+	sub.pending = append(sub.pending[:0], Event{
+		ID:    last.ID,
+		Type:  EventResync,
+		Path:  automerge.Root(),
+		Heads: last.Heads,
+		Time:  last.Time,
+		seq:   last.seq,
+	})
+	sub.resynced = true
+	sub.behindSince = time.Now()
+}
+
+// pump moves sub's queued events into its channel as the subscriber makes
+// room, until the queue is empty or sub is closed (then it closes the
+// channel)
+func (s *Server) pump(sub *Subscription) {
+	for {
+		s.subsMu.Lock()
+		if sub.closed || len(sub.pending) == 0 {
+			sub.pumping = false
+			if sub.closed {
+				close(sub.ch)
+			} else {
+				// Caught up
+				sub.behindSince = time.Time{}
+				sub.resynced = false
+			}
+			s.subsMu.Unlock()
+			return
+		}
+		ev := sub.pending[0]
+		sub.pending = sub.pending[1:]
+		s.subsMu.Unlock()
+
+		select {
+		case sub.ch <- ev:
+		case <-sub.done:
+		}
+	}
+}
+
+// EventStats returns the state of the document's change events and their
+// subscribers
+func (s *Server) EventStats() EventStats {
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+
+	stats := EventStats{
+		Subscribers: len(s.subs),
+		Published:   s.eventMetrics.published,
+		Coalesced:   s.eventMetrics.coalesced,
+		Dropped:     s.eventMetrics.dropped,
+		Resyncs:     s.eventMetrics.resyncs,
+		Disconnects: s.eventMetrics.disconnects,
+		ResyncAfter: s.resyncAfter,
+	}
+	for _, sub := range s.subs {
+		if sub.behindSince.IsZero() {
+			continue
+		}
+		stats.Behind++
+		stats.MaxPending = max(stats.MaxPending, len(sub.pending))
+		stats.MaxLag = max(stats.MaxLag, time.Since(sub.behindSince))
+	}
+	return stats
+}
+
+// eventStatus reports the events for readiness probes
+func (s *Server) eventStatus() map[string]interface{} {
+	stats := s.EventStats()
+	return map[string]interface{}{
+		"subscribers":     stats.Subscribers,
+		"published":       stats.Published,
+		"coalesced":       stats.Coalesced,
+		"dropped":         stats.Dropped,
+		"resyncs":         stats.Resyncs,
+		"disconnects":     stats.Disconnects,
+		"behind":          stats.Behind,
+		"max_pending":     stats.MaxPending,
+		"max_lag_ms":      stats.MaxLag.Milliseconds(),
+		"resync_after_ms": stats.ResyncAfter.Milliseconds(),
+	}
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+)
+
+// deliverLocked delivers events to sub and runs check before the pump can
+// move any of them
+func deliverLocked(s *Server, sub *Subscription, events []Event, check func()) {
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+	for _, ev := range events {
+		s.deliver(sub, ev)
+	}
+	check()
+}
+
+// mapEvents returns n map events with IDs "1" … "n"
+func mapEvents(n int) []Event {
+	var events []Event
+	for i := 1; i <= n; i++ {
+		events = append(events, Event{ID: fmt.Sprint(i), Type: EventMap, Op: "put", Path: automerge.Root().Get(fmt.Sprint(i))})
+	}
+	return events
+}
+
+// receive reads the next n events from sub
+func receive(t *testing.T, sub *Subscription, n int) []Event {
+	t.Helper()
+	var events []Event
+	for range n {
+		events = append(events, nextEvent(t, sub))
+	}
+	return events
+}
+
+func TestServer_SlowSubscriberCoalesced(t *testing.T) {
+	s := New(Config{Storage: NewMemoryStorage(), ResyncAfter: -1})
+	defer s.Close(context.Background())
+	sub := s.Subscribe(2)
+	defer sub.Close()
+
+	text := func(v string) Event { return Event{ID: v, Type: EventText, Op: "set", Path: contentPath, Text: &v} }
+	events := append(mapEvents(3), text("a"), text("b"), text("c"))
+	deliverLocked(s, sub, events, func() {
+		// 1 and 2 fill the channel; a and b are replaced by c
+		if len(sub.pending) != 2 || sub.pending[0].ID != "3" || sub.pending[1].ID != "c" {
+			t.Errorf("pending = %v, want 3 and c", sub.pending)
+		}
+	})
+
+	var got []string
+	for _, ev := range receive(t, sub, 4) {
+		got = append(got, ev.ID)
+	}
+	if fmt.Sprint(got) != "[1 2 3 c]" {
+		t.Errorf("received %v, want [1 2 3 c]", got)
+	}
+	if stats := s.EventStats(); stats.Coalesced != 2 || stats.Resyncs != 0 || stats.Dropped != 0 {
+		t.Errorf("EventStats() = %+v, want 2 coalesced and nothing dropped", stats)
+	}
+}
+
+func TestServer_SlowSubscriberResync(t *testing.T) {
+	s := New(Config{Storage: NewMemoryStorage(), ResyncAfter: -1})
+	defer s.Close(context.Background())
+	sub := s.Subscribe(1)
+	defer sub.Close()
+
+	events := mapEvents(3)
+	events[2].Heads = []automerge.ChangeHash{{3}}
+	deliverLocked(s, sub, events, func() {
+		// 1 fills the channel; 2 and 3 are more than a channel behind
+		if len(sub.pending) != 1 || sub.pending[0].Type != EventResync {
+			t.Fatalf("pending = %v, want a resync", sub.pending)
+		}
+	})
+	if stats := s.EventStats(); stats.Behind != 1 || stats.Resyncs != 1 || stats.Dropped != 2 {
+		t.Errorf("EventStats() = %+v, want 1 behind, 1 resync, 2 dropped", stats)
+	}
+
+	got := receive(t, sub, 2)
+	if resync := got[1]; got[0].ID != "1" || resync.Type != EventResync || resync.ID != "3" || resync.Heads[0] != (automerge.ChangeHash{3}) {
+		t.Errorf("received %v, want 1 then a resync standing for 3", got)
+	}
+
+	// Once caught up, the subscriber may be resynced again
+	for s.EventStats().Behind != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	deliverLocked(s, sub, mapEvents(3), func() {
+		if sub.closed || sub.pending[0].Type != EventResync {
+			t.Errorf("closed = %v, pending = %v; want a second resync", sub.closed, sub.pending)
+		}
+	})
+}
+
+func TestServer_SlowSubscriberResyncAfter(t *testing.T) {
+	s := New(Config{Storage: NewMemoryStorage(), ResyncAfter: time.Millisecond})
+	defer s.Close(context.Background())
+	sub := s.Subscribe(1)
+	defer sub.Close()
+
+	events := mapEvents(3)
+	deliverLocked(s, sub, events[:2], func() {})
+	time.Sleep(5 * time.Millisecond) // Behind for longer than ResyncAfter
+	deliverLocked(s, sub, events[2:], func() {
+		if len(sub.pending) != 1 || sub.pending[0].Type != EventResync || sub.pending[0].ID != "3" {
+			t.Errorf("pending = %v, want a resync for 3", sub.pending)
+		}
+	})
+}
+
+// TestServer_SlowSubscriberDisconnected checks a subscriber that can't
+// keep up even after a resync is closed, and can resume
+func TestServer_SlowSubscriberDisconnected(t *testing.T) {
+	s := New(Config{Storage: NewMemoryStorage(), ResyncAfter: -1})
+	defer s.Close(context.Background())
+	sub := s.Subscribe(1)
+
+	// Never read: the first resync never goes out, so the next one closes it
+	for _, ev := range mapEvents(10) {
+		s.publish(ev)
+	}
+	if !sub.Overflowed() {
+		t.Fatal("Overflowed() = false for a subscriber that never reads")
+	}
+	if stats := s.EventStats(); stats.Subscribers != 0 || stats.Disconnects != 1 || stats.Resyncs != 1 {
+		t.Errorf("EventStats() = %+v, want 1 resync and 1 disconnect", stats)
+	}
+
+	var last Event
+	for ev := range sub.C {
+		last = ev
+	}
+	if last.ID == "" || last.Type == EventResync {
+		t.Fatalf("last event = %+v, want an update", last)
+	}
+	resumed, missed, ok := s.Resume(0, last.ID)
+	defer resumed.Close()
+	if !ok || len(missed) == 0 || missed[len(missed)-1].Path.String() != "/10" {
+		t.Errorf("Resume(%q) = %v, %v; want the events up to 10", last.ID, missed, ok)
+	}
+}
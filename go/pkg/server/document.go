@@ -4,65 +4,86 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"os"
-	"path/filepath"
+	"time"
 
 	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
 )
 
 // Document lifecycle operations - maps to automerge/document.go
 
-// saveDocument saves the current document to disk (assumes lock is held)
+// saveDocument queues the changes made since the last save for the
+// persister (runs on the document goroutine). Only the in-memory part
+// happens here: the disk writes happen in Flush, off the document goroutine
+// (see persister.go).
 func (s *Server) saveDocument(ctx context.Context) error {
-	data, err := s.doc.Save(ctx)
-	if err != nil {
+	// Stamp pending local edits with the current time (used by blame)
+	if _, err := s.doc.Commit(ctx, ""); err != nil {
 		return err
 	}
 
-	snapshotPath := filepath.Join(s.storageDir, "doc.am")
-
-	if err := os.MkdirAll(filepath.Dir(snapshotPath), 0755); err != nil {
-		return fmt.Errorf("failed to create directory: %w", err)
+	chunk, err := s.doc.SaveIncremental(ctx)
+	if err != nil {
+		return err
 	}
-
-	if err := os.WriteFile(snapshotPath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write snapshot: %w", err)
+	if len(chunk) == 0 {
+		return nil
 	}
 
-	log.Printf("[%s] Saved document to %s (%d bytes)", s.userID, snapshotPath, len(data))
+	s.pending = append(s.pending, chunk)
+	if s.dirty == 0 {
+		s.dirtySince = time.Now()
+	}
+	s.dirty++
+	if s.dirty >= s.maxDirty {
+		s.requestFlush()
+	}
 	return nil
 }
 
 // GetSnapshot returns the current document as bytes (thread-safe)
 func (s *Server) GetSnapshot(ctx context.Context) ([]byte, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	// Save moves the document's incremental-save mark: hand any unsaved
+	// changes to the persister first, or the change chunks would miss them
+	return call(ctx, s, func() ([]byte, error) {
+		if err := s.saveDocument(ctx); err != nil {
+			return nil, err
+		}
+		return s.doc.Save(ctx)
+	})
+}
 
-	return s.doc.Save(ctx)
+// GetJSON returns the value at path as plain Go values, like ReadJSON, but
+// always from the document itself, never from a read replica (thread-safe)
+func (s *Server) GetJSON(ctx context.Context, path automerge.Path) (interface{}, error) {
+	return call(ctx, s, func() (interface{}, error) {
+		return s.doc.GetJSON(ctx, path)
+	})
 }
 
 // Merge merges another document into this one (thread-safe)
 func (s *Server) Merge(ctx context.Context, otherData []byte) error {
 	// Load the other document
-	other, err := automerge.Load(ctx, otherData)
+	other, err := automerge.LoadWithWASM(ctx, otherData, s.wasmPath)
 	if err != nil {
 		return fmt.Errorf("failed to load document to merge: %w", err)
 	}
 	defer other.Close(ctx)
 
 	// Merge it into our document
-	s.mu.Lock()
-	err = s.doc.Merge(ctx, other)
-	if err != nil {
-		s.mu.Unlock()
-		return fmt.Errorf("merge failed: %w", err)
-	}
+	return s.do(ctx, func() error {
+		before, err := s.doc.GetHeads(ctx)
+		if err != nil {
+			return err
+		}
+		if err := s.doc.Merge(ctx, other); err != nil {
+			return fmt.Errorf("merge failed: %w", err)
+		}
 
-	// Save the merged document
-	if err := s.saveDocument(ctx); err != nil {
-		log.Printf("Warning: failed to save after merge: %v", err)
-	}
-	s.mu.Unlock()
-
-	return nil
+		// Save the merged document
+		if err := s.saveDocument(ctx); err != nil {
+			log.Printf("Warning: failed to save after merge: %v", err)
+		}
+		s.emitIncoming(ctx, EventMerge, "merge", before)
+		return nil
+	})
 }
@@ -0,0 +1,553 @@
+// ==============================================================================
+// Layer 5: Go Server - Change Events
+// ==============================================================================
+// ARCHITECTURE: This is the stateful server layer (Layer 5/7).
+//
+// RESPONSIBILITIES:
+// - Publish a typed Event for every mutation, and for every sync message or
+//   merge that brought in changes
+// - Stamp each event with the actor, the new heads and the time
+// - Deliver events to subscribers (SSE streams) without blocking the
+//   document goroutine (slow subscribers: see delivery.go)
+// - Filter events by path and type before they reach a subscriber
+// - Number events and keep the latest in a log, so a subscriber that
+//   reconnects can resume where it left off (Resume)
+//
+// DEPENDENCIES:
+// - pkg/server/actor.go (events are published from the document goroutine)
+// - pkg/server/delivery.go (queues, coalesces and resyncs for subscribers
+//   that fall behind)
+// - pkg/automerge (GetHeads, GetActor, ChangedPaths)
+//
+// DEPENDENTS:
+// - Every mutating Server method (crdt_*.go, document.go)
+// - pkg/api/handlers.go (StreamHandler serializes events for SSE clients)
+//
+// NOTES:
+// - Subscribers have their own lock, so publishing never waits for a
+//   subscriber and subscribing never waits for the document
+// - No event is silently dropped: a subscriber that falls behind gets a
+//   "resync" event in place of the ones it missed, or is closed
+//   (Overflowed) and resumes from the log
+// - Event IDs are "<epoch>-<seq>". The epoch changes each time the document
+//   is opened, so an ID from before a restart or eviction never resumes.
+// - Events are recorded while someone is subscribed and for ResumeWindow
+//   after the last one leaves. Changes made while nothing is recorded empty
+//   the log: resuming from before them fails, and the client needs a
+//   snapshot.
+// - A filter path matches changes at, below or above it: a put that
+//   replaces /metrics touches /metrics/cpu too
+// - Sync and merge events list the paths their changes touched (Paths, from
+//   a diff of the heads before and after) and match a filter if any of them
+//   does; past maxEventPaths the paths are shortened to their parents
+// - Events are only built while they are recorded: a document nobody
+//   watches pays nothing for them
+// - Close ends every subscription (its channel is closed)
+// ==============================================================================
+
+package server
+
+import (
+	"context"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+)
+
+// Event defaults
+const (
+	DefaultEventBuffer  = 64          // How many events a subscriber's channel holds
+	DefaultEventLogSize = 1024        // How many events a subscriber may resume across
+	DefaultResumeWindow = time.Minute // How long after the last subscriber leaves events are recorded
+)
+
+// EventType says what kind of object a change touched
+type EventType string
+
+// Event types
+const (
+	EventText     EventType = "text"
+	EventMap      EventType = "map"
+	EventList     EventType = "list"
+	EventCounter  EventType = "counter"
+	EventRichText EventType = "richtext"
+	EventComment  EventType = "comment"
+	EventSync     EventType = "sync"  // A peer's sync message brought in changes
+	EventMerge    EventType = "merge" // A merged document brought in changes
+
+	// EventResync replaces the events a slow subscriber missed (see
+	// delivery.go). Its ID, Heads and Time are the last missed event's.
+	EventResync EventType = "resync"
+)
+
+// contentPath is the text the legacy single-text API edits
+var contentPath = automerge.Root().Get("content")
+
+// Event describes one change to the document
+type Event struct {
+	// ID identifies the event, for resuming after it (see Resume)
+	ID string
+
+	Type EventType
+	Op   string // "set", "put", "delete", "push", "insert", "increment", "mark", …
+
+	// Path is what changed: the entry for map and counter changes, the
+	// element for list inserts and deletes, the comment thread for
+	// comments, the list or text otherwise, and for sync and merge the
+	// deepest path all of Paths share
+	Path automerge.Path
+
+	// Paths are what a sync or merge changed, each as Path would be for a
+	// local change (nil for local changes, and for a sync or merge whose
+	// changes couldn't be diffed: Path is then the root)
+	Paths []automerge.Path
+
+	// Actor made the change: this server's actor for local changes (or
+	// the actor of the user they were made for, see WithUser), empty
+	// for sync and merge (their changes may come from many actors)
+	Actor string
+
+	Heads []automerge.ChangeHash // Heads after the change
+	Time  time.Time
+
+	// Text is the text at ROOT.content after changes that may have touched
+	// it (nil otherwise), for clients that show the whole text
+	Text *string
+
+	seq uint64 // Position in the document's events
+}
+
+// EventFilter selects events by path and type. The zero value matches
+// every event.
+type EventFilter struct {
+	// Path matches changes at, below or above it (the root matches all).
+	// A "*" key matches any one key or list index.
+	Path automerge.Path
+
+	// Types matches events of these types (empty: all)
+	Types []EventType
+}
+
+// Match reports whether ev passes the filter
+func (f EventFilter) Match(ev Event) bool {
+	return f.match(ev, eventSegments(ev), pathSegments(f.Path))
+}
+
+// match is Match with the paths already split
+func (f EventFilter) match(ev Event, evSegs [][]string, filterSegs []string) bool {
+	if len(f.Types) > 0 && !slices.Contains(f.Types, ev.Type) {
+		return false
+	}
+	for _, segs := range evSegs {
+		if segmentsOverlap(segs, filterSegs) {
+			return true
+		}
+	}
+	return false
+}
+
+// segmentsOverlap reports whether one split path is at, below or above the
+// other (a "*" filter segment matches any one segment)
+func segmentsOverlap(evSegs, filterSegs []string) bool {
+	for i := 0; i < len(evSegs) && i < len(filterSegs); i++ {
+		if filterSegs[i] != "*" && filterSegs[i] != evSegs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// eventSegments splits the paths ev touched: Paths, or Path without them
+func eventSegments(ev Event) [][]string {
+	if len(ev.Paths) == 0 {
+		return [][]string{pathSegments(ev.Path)}
+	}
+	segs := make([][]string, len(ev.Paths))
+	for i, p := range ev.Paths {
+		segs[i] = pathSegments(p)
+	}
+	return segs
+}
+
+// pathSegments splits a path into its keys and "[index]" segments
+func pathSegments(p automerge.Path) []string {
+	var segs []string
+	for _, part := range strings.Split(p.String(), "/")[1:] {
+		if part == "" {
+			continue // The root
+		}
+		// "items[2][0]" → "items", "[2]", "[0]"
+		if i := strings.IndexByte(part, '['); i >= 0 {
+			if i > 0 {
+				segs = append(segs, part[:i])
+			}
+			for _, idx := range strings.SplitAfter(part[i:], "]") {
+				if idx != "" {
+					segs = append(segs, idx)
+				}
+			}
+			continue
+		}
+		segs = append(segs, part)
+	}
+	return segs
+}
+
+// Subscription receives the document's change events on C until it is
+// closed
+type Subscription struct {
+	C <-chan Event
+
+	// LastID is the ID of the last event before the subscription started
+	// (empty if there was none), for a snapshot taken when subscribing
+	LastID string
+
+	ch      chan Event
+	s       *Server
+	filters []EventFilter
+	paths   [][]string    // Split filter paths
+	done    chan struct{} // Closed when the subscription ends
+
+	// Guarded by s.subsMu
+	closed      bool
+	overflowed  bool
+	pending     []Event   // Waiting for room in ch (see delivery.go)
+	pumping     bool      // A goroutine is moving pending into ch
+	behindSince time.Time // When events started waiting in pending
+	resynced    bool      // Sent a resync and hasn't caught up since
+}
+
+// wants reports whether any of the subscription's filters match ev (true
+// without filters)
+func (sub *Subscription) wants(ev Event, evSegs [][]string) bool {
+	if len(sub.filters) == 0 {
+		return true
+	}
+	for i, f := range sub.filters {
+		if f.match(ev, evSegs, sub.paths[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscribe returns a subscription to the document's change events that
+// match any of filters (all events without filters). C holds buffer events
+// (0: DefaultEventBuffer); a subscriber that falls further behind is
+// handled as delivery.go describes. Close the subscription when done with
+// it.
+//
+// Example:
+//
+//	metrics := automerge.Root().Get("metrics").Get("*")
+//	sub := srv.Subscribe(0, server.EventFilter{Path: metrics, Types: []server.EventType{server.EventMap}})
+//	defer sub.Close()
+//	for ev := range sub.C {
+//		fmt.Println(ev.Type, ev.Op, ev.Path)
+//	}
+func (s *Server) Subscribe(buffer int, filters ...EventFilter) *Subscription {
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+	return s.subscribe(buffer, filters)
+}
+
+// Resume subscribes like Subscribe and returns the events after lastID
+// that the subscriber missed (those matching its filters), so that with
+// what arrives on C it sees every event exactly once. ok is false if the
+// events since lastID are no longer known (too many of them, the document
+// was reopened, or lastID is not an event ID): the subscriber needs a fresh
+// snapshot instead.
+//
+// The event log is in memory only: it doesn't survive a restart or the
+// document being evicted, so an ID from before either never resumes.
+//
+// Example:
+//
+//	sub, missed, ok := srv.Resume(0, r.Header.Get("Last-Event-ID"))
+//	defer sub.Close()
+//	if !ok {
+//		sendSnapshot()
+//	}
+//	for _, ev := range missed {
+//		send(ev)
+//	}
+func (s *Server) Resume(buffer int, lastID string, filters ...EventFilter) (sub *Subscription, missed []Event, ok bool) {
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+	sub = s.subscribe(buffer, filters)
+	if sub.closed {
+		return sub, nil, false
+	}
+
+	epoch, seqStr, _ := strings.Cut(lastID, "-")
+	seq, err := strconv.ParseUint(seqStr, 10, 64)
+	if err != nil || epoch != s.eventEpoch {
+		return sub, nil, false
+	}
+	if seq < s.eventLogFrom || seq > s.eventSeq {
+		return sub, nil, false
+	}
+	for _, ev := range s.eventLog {
+		if ev.seq > seq && sub.wants(ev, eventSegments(ev)) {
+			missed = append(missed, ev)
+		}
+	}
+	return sub, missed, true
+}
+
+// subscribe adds a subscription (s.subsMu must be held)
+func (s *Server) subscribe(buffer int, filters []EventFilter) *Subscription {
+	if buffer <= 0 {
+		buffer = DefaultEventBuffer
+	}
+	ch := make(chan Event, buffer)
+	sub := &Subscription{C: ch, ch: ch, s: s, filters: filters, done: make(chan struct{})}
+	for _, f := range filters {
+		sub.paths = append(sub.paths, pathSegments(f.Path))
+	}
+
+	if s.subsClosed {
+		sub.closed = true
+		close(sub.done)
+		close(ch)
+		return sub
+	}
+	if s.eventSeq > 0 {
+		sub.LastID = s.eventID(s.eventSeq)
+	}
+	s.subs = append(s.subs, sub)
+	return sub
+}
+
+// Close ends the subscription and closes C (safe to call more than once)
+func (sub *Subscription) Close() {
+	s := sub.s
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+	s.unsubscribe(sub)
+}
+
+// Overflowed reports whether the subscription was closed because its
+// subscriber stayed hopelessly behind (see delivery.go). It can Resume
+// after the last event it got.
+func (sub *Subscription) Overflowed() bool {
+	sub.s.subsMu.Lock()
+	defer sub.s.subsMu.Unlock()
+	return sub.overflowed
+}
+
+// unsubscribe closes sub and removes it (s.subsMu must be held)
+func (s *Server) unsubscribe(sub *Subscription) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	sub.pending = nil
+	close(sub.done)
+	if !sub.pumping {
+		close(sub.ch) // Otherwise the pump closes it as it stops
+	}
+	for i, other := range s.subs {
+		if other == sub {
+			s.subs = append(s.subs[:i], s.subs[i+1:]...)
+			break
+		}
+	}
+	if len(s.subs) == 0 {
+		s.lastUnsubscribed = time.Now()
+	}
+}
+
+// CloseSubscriptions ends every subscription and refuses new ones. Close
+// does this too, but an HTTP server shutting down waits for its event
+// streams first: call it as the shutdown starts (http.Server.RegisterOnShutdown)
+// so the streams end and leave Close the time it needs to flush.
+func (s *Server) CloseSubscriptions() {
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+	s.subsClosed = true
+	s.unsubscribeAll()
+}
+
+// endSubscriptions ends every current subscription; unlike
+// CloseSubscriptions, later ones are still accepted
+func (s *Server) endSubscriptions() {
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+	s.unsubscribeAll()
+}
+
+// unsubscribeAll closes every subscription (s.subsMu must be held)
+func (s *Server) unsubscribeAll() {
+	for _, sub := range slices.Clone(s.subs) {
+		s.unsubscribe(sub)
+	}
+}
+
+// recordingEvents reports whether events are being recorded: while anyone
+// is subscribed, and for resumeWindow after the last one leaves. When they
+// are not, the change about to be made empties the log (resuming across it
+// would miss it).
+func (s *Server) recordingEvents() bool {
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+	if len(s.subs) > 0 {
+		return true
+	}
+	if len(s.eventLog) > 0 && time.Since(s.lastUnsubscribed) < s.resumeWindow {
+		return true
+	}
+	s.eventLog = nil
+	s.eventSeq++ // A change no event describes
+	s.eventLogFrom = s.eventSeq
+	return false
+}
+
+// eventID formats an event's ID
+func (s *Server) eventID(seq uint64) string {
+	return s.eventEpoch + "-" + strconv.FormatUint(seq, 10)
+}
+
+// emit publishes ev for a change just made (runs on the document
+// goroutine). It fills in the actor, heads, time and text; a change that
+// left the heads where the last event did (a sync message with nothing
+// new) is not published.
+func (s *Server) emit(ctx context.Context, ev Event) {
+	if !s.recordingEvents() {
+		return
+	}
+
+	heads, err := s.doc.GetHeads(ctx)
+	if err != nil {
+		log.Printf("Warning: not publishing %s %s event: %v", ev.Type, ev.Op, err)
+		return
+	}
+	if slices.Equal(heads, s.eventHeads) {
+		return
+	}
+	s.eventHeads = heads
+	ev.Heads = heads
+	ev.Time = time.Now()
+
+	if ev.Type != EventSync && ev.Type != EventMerge {
+		if ev.Actor, err = s.doc.GetActor(ctx); err != nil {
+			log.Printf("Warning: failed to get actor for event: %v", err)
+		}
+	}
+	if ev.Type == EventSync || ev.Type == EventMerge || ev.Path.String() == contentPath.String() {
+		if text, err := s.doc.GetText(ctx, contentPath); err == nil {
+			ev.Text = &text
+		}
+	}
+
+	s.publish(ev)
+}
+
+// maxEventPaths bounds the paths a sync or merge event lists
+const maxEventPaths = 64
+
+// emitIncoming publishes a sync or merge event for the changes made since
+// the before heads, with the paths they touched (runs on the document
+// goroutine)
+func (s *Server) emitIncoming(ctx context.Context, typ EventType, op string, before []automerge.ChangeHash) {
+	if !s.recordingEvents() {
+		return
+	}
+
+	ev := Event{Type: typ, Op: op, Path: automerge.Root()}
+	after, err := s.doc.GetHeads(ctx)
+	if err == nil && !slices.Equal(before, after) {
+		var paths []automerge.Path
+		if paths, err = s.doc.ChangedPaths(ctx, before, after); err == nil {
+			ev.Paths = coarsenPaths(paths, maxEventPaths)
+			ev.Path = commonPath(ev.Paths)
+		}
+	}
+	if err != nil {
+		log.Printf("Warning: %s event covers the whole document: %v", typ, err)
+	}
+	s.emit(ctx, ev)
+}
+
+// coarsenPaths replaces the deepest paths with their parents until at most
+// limit distinct paths remain
+func coarsenPaths(paths []automerge.Path, limit int) []automerge.Path {
+	for len(paths) > limit {
+		depth := 0
+		for _, p := range paths {
+			depth = max(depth, p.Len())
+		}
+		seen := make(map[string]bool)
+		var out []automerge.Path
+		for _, p := range paths {
+			if p.Len() == depth {
+				p = p.Parent()
+			}
+			if !seen[p.String()] {
+				seen[p.String()] = true
+				out = append(out, p)
+			}
+		}
+		paths = out
+	}
+	return paths
+}
+
+// commonPath returns the deepest path at or above every one of paths (the
+// root if there are none)
+func commonPath(paths []automerge.Path) automerge.Path {
+	if len(paths) == 0 {
+		return automerge.Root()
+	}
+	common := paths[0]
+	for _, p := range paths[1:] {
+		segs := pathSegments(p)
+		for {
+			prefix := pathSegments(common)
+			if len(prefix) <= len(segs) && slices.Equal(prefix, segs[:len(prefix)]) {
+				break
+			}
+			common = common.Parent()
+		}
+	}
+	return common
+}
+
+// publish numbers ev, logs it and delivers it to every subscriber that
+// wants it
+func (s *Server) publish(ev Event) {
+	evSegs := eventSegments(ev)
+
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+
+	s.eventSeq++
+	s.eventMetrics.published++
+	ev.seq = s.eventSeq
+	ev.ID = s.eventID(ev.seq)
+	if s.eventLogSize > 0 {
+		s.eventLog = append(s.eventLog, ev)
+		if n := len(s.eventLog); n > s.eventLogSize {
+			// Only the last eventLogSize events can be resumed from; the
+			// older ones are dropped in batches, not with a copy per event
+			s.eventLogFrom = s.eventLog[n-s.eventLogSize-1].seq
+			if n >= 2*s.eventLogSize {
+				kept := copy(s.eventLog, s.eventLog[n-s.eventLogSize:])
+				clear(s.eventLog[kept:])
+				s.eventLog = s.eventLog[:kept]
+			}
+		}
+	} else {
+		s.eventLogFrom = ev.seq
+	}
+
+	for _, sub := range slices.Clone(s.subs) { // deliver may close some
+		if sub.wants(ev, evSegs) {
+			s.deliver(sub, ev)
+		}
+	}
+}
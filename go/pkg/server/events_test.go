@@ -0,0 +1,451 @@
+package server
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+)
+
+// nextEvent waits for the subscription's next event
+func nextEvent(t *testing.T, sub *Subscription) Event {
+	t.Helper()
+	select {
+	case ev, ok := <-sub.C:
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+	}
+	return Event{}
+}
+
+// TestServer_SubscriptionsClosed checks Close ends subscriptions
+func TestServer_SubscriptionsClosed(t *testing.T) {
+	s := New(Config{Storage: NewMemoryStorage()})
+	sub := s.Subscribe(0)
+	if cap(sub.C) != DefaultEventBuffer {
+		t.Errorf("buffer = %d, want DefaultEventBuffer", cap(sub.C))
+	}
+
+	s.Close(context.Background())
+	if _, ok := <-sub.C; ok {
+		t.Error("subscription open after Close()")
+	}
+	sub.Close() // Harmless
+
+	late := s.Subscribe(0)
+	if _, ok := <-late.C; ok {
+		t.Error("Subscribe() after Close() returned an open subscription")
+	}
+}
+
+func TestServer_Events(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t, t.TempDir(), 0)
+	defer s.Close(ctx)
+
+	actor, _ := call(ctx, s, func() (string, error) { return s.doc.GetActor(ctx) })
+	sub := s.Subscribe(0)
+	defer sub.Close()
+
+	tests := []struct {
+		name     string
+		mutate   func() error
+		wantType EventType
+		wantOp   string
+		wantPath string
+	}{
+		{"text", func() error { return s.SetText(ctx, "hello") }, EventText, "set", "/content"},
+		{"map put", func() error { return s.PutMapValue(ctx, automerge.Root(), "theme", "dark") }, EventMap, "put", "/theme"},
+		{"map delete", func() error { return s.DeleteMapKey(ctx, automerge.Root(), "theme") }, EventMap, "delete", "/theme"},
+		{"counter", func() error { return s.IncrementCounter(ctx, automerge.Root(), "views", 1) }, EventCounter, "increment", "/views"},
+		{"richtext", func() error {
+			return s.RichTextMark(ctx, contentPath, automerge.Mark{Name: "bold", Value: automerge.NewBool(true), Start: 0, End: 5}, automerge.ExpandNone)
+		}, EventRichText, "mark", "/content"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.mutate(); err != nil {
+				t.Fatalf("mutation error = %v", err)
+			}
+			ev := nextEvent(t, sub)
+			if ev.Type != tt.wantType || ev.Op != tt.wantOp || ev.Path.String() != tt.wantPath {
+				t.Errorf("event = %s %s %s, want %s %s %s", ev.Type, ev.Op, ev.Path, tt.wantType, tt.wantOp, tt.wantPath)
+			}
+			if ev.Actor != actor {
+				t.Errorf("Actor = %q, want %q", ev.Actor, actor)
+			}
+			heads, _ := call(ctx, s, func() ([]automerge.ChangeHash, error) { return s.doc.GetHeads(ctx) })
+			if !reflect.DeepEqual(ev.Heads, heads) {
+				t.Errorf("Heads = %v, want %v", ev.Heads, heads)
+			}
+			if (ev.Text != nil) != (tt.wantPath == "/content") {
+				t.Errorf("Text = %v for a change to %s", ev.Text, tt.wantPath)
+			}
+		})
+	}
+}
+
+// TestServer_CloseSubscriptions checks subscriptions can be ended ahead of
+// Close (as an HTTP server shutting down does)
+func TestServer_CloseSubscriptions(t *testing.T) {
+	s := New(Config{Storage: NewMemoryStorage()})
+	defer s.Close(context.Background())
+	sub := s.Subscribe(0)
+
+	s.CloseSubscriptions()
+	if _, ok := <-sub.C; ok {
+		t.Error("subscription open after CloseSubscriptions()")
+	}
+	late := s.Subscribe(0)
+	if _, ok := <-late.C; ok {
+		t.Error("Subscribe() after CloseSubscriptions() returned an open subscription")
+	}
+}
+
+// TestServer_EventsFromMerge checks incoming changes are published once,
+// without an actor
+func TestServer_EventsFromMerge(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t, t.TempDir(), 0)
+	defer s.Close(ctx)
+
+	other, err := automerge.NewWithWASM(ctx, automerge.TestWASMPath)
+	if err != nil {
+		t.Fatalf("NewWithWASM() error = %v", err)
+	}
+	defer other.Close(ctx)
+	other.Put(ctx, automerge.Root(), "from", automerge.NewString("peer"))
+	data, err := other.Save(ctx)
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	sub := s.Subscribe(0)
+	defer sub.Close()
+	if err := s.Merge(ctx, data); err != nil {
+		t.Fatalf("Merge() error = %v", err)
+	}
+	ev := nextEvent(t, sub)
+	if ev.Type != EventMerge || ev.Actor != "" || ev.Text == nil {
+		t.Errorf("event = %+v, want a merge event with text and no actor", ev)
+	}
+
+	// Merging the same changes again changes nothing: no event
+	if err := s.Merge(ctx, data); err != nil {
+		t.Fatalf("second Merge() error = %v", err)
+	}
+	s.SetText(ctx, "after")
+	if ev := nextEvent(t, sub); ev.Type != EventText {
+		t.Errorf("event after a no-op merge = %s %s, want the text change", ev.Type, ev.Op)
+	}
+}
+
+// TestServer_EventFilters checks filtered subscriptions never see
+// unrelated events
+func TestServer_EventFilters(t *testing.T) {
+	s := New(Config{Storage: NewMemoryStorage()})
+	defer s.Close(context.Background())
+
+	root := automerge.Root()
+	metrics := root.Get("metrics")
+	cpu := metrics.Get("cpu")
+	items := root.Get("items")
+
+	dashboard := s.Subscribe(0, EventFilter{Path: metrics.Get("*"), Types: []EventType{EventMap}})
+	defer dashboard.Close()
+	multi := s.Subscribe(0,
+		EventFilter{Path: items.Index(2)},
+		EventFilter{Path: root, Types: []EventType{EventCounter}},
+	)
+	defer multi.Close()
+
+	tests := []struct {
+		name      string
+		ev        Event
+		dashboard bool
+		multi     bool
+	}{
+		{"put below the filter", Event{Type: EventMap, Path: cpu}, true, false},
+		{"put far below the filter", Event{Type: EventMap, Path: cpu.Get("load").Index(0)}, true, false},
+		{"put replacing an ancestor", Event{Type: EventMap, Path: metrics}, true, false},
+		{"other path", Event{Type: EventMap, Path: root.Get("theme")}, false, false},
+		{"other type", Event{Type: EventCounter, Path: cpu}, false, true},
+		{"text", Event{Type: EventText, Path: contentPath}, false, false},
+		{"sync at the root", Event{Type: EventSync, Path: root}, false, true},
+		{"merge at the root", Event{Type: EventMerge, Path: root}, false, true},
+		{"sync of a watched path, not type", Event{Type: EventSync, Path: root,
+			Paths: []automerge.Path{root.Get("theme"), cpu}}, false, false},
+		{"sync touching an element", Event{Type: EventSync, Path: items,
+			Paths: []automerge.Path{items.Index(1), items.Index(2)}}, false, true},
+		{"sync elsewhere", Event{Type: EventSync, Path: root.Get("theme"),
+			Paths: []automerge.Path{root.Get("theme")}}, false, false},
+		{"list element", Event{Type: EventList, Path: items.Index(2)}, false, true},
+		{"other list element", Event{Type: EventList, Path: items.Index(3)}, false, false},
+		{"whole list", Event{Type: EventList, Path: items}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.publish(tt.ev)
+			for _, c := range []struct {
+				name string
+				sub  *Subscription
+				want bool
+			}{{"dashboard", dashboard, tt.dashboard}, {"multi", multi, tt.multi}} {
+				select {
+				case <-c.sub.C:
+					if !c.want {
+						t.Errorf("%s received %s at %s", c.name, tt.ev.Type, tt.ev.Path)
+					}
+				default:
+					if c.want {
+						t.Errorf("%s missed %s at %s", c.name, tt.ev.Type, tt.ev.Path)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestCoarsenPaths checks sync and merge events list a bounded number of
+// paths, and the path they all share
+func TestCoarsenPaths(t *testing.T) {
+	root := automerge.Root()
+	items := root.Get("items")
+	paths := []automerge.Path{items.Index(0), items.Index(1), items.Index(2), root.Get("theme")}
+
+	got := coarsenPaths(paths, 2)
+	if len(got) != 2 || got[0].String() != "/items" || got[1].String() != "/theme" {
+		t.Errorf("coarsenPaths() = %v, want [/items /theme]", got)
+	}
+	if c := commonPath(paths[:3]); c.String() != "/items" {
+		t.Errorf("commonPath() = %s, want /items", c)
+	}
+	if c := commonPath(paths); !c.IsRoot() {
+		t.Errorf("commonPath() = %s, want the root", c)
+	}
+}
+
+// TestServer_FilteredMutations checks a filtered subscriber only sees the
+// mutations it asked for
+func TestServer_FilteredMutations(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t, t.TempDir(), 0)
+	defer s.Close(ctx)
+
+	metrics, err := call(ctx, s, func() (automerge.Path, error) {
+		return s.doc.PutObject(ctx, automerge.Root(), "metrics", automerge.ObjTypeMap)
+	})
+	if err != nil {
+		t.Fatalf("PutObject() error = %v", err)
+	}
+	sub := s.Subscribe(0, EventFilter{Path: metrics, Types: []EventType{EventMap}})
+	defer sub.Close()
+
+	s.SetText(ctx, "unrelated")
+	s.PutMapValue(ctx, automerge.Root(), "theme", "dark")
+	s.IncrementCounter(ctx, metrics, "hits", 1)
+	if err := s.PutMapValue(ctx, metrics, "cpu", "42"); err != nil {
+		t.Fatalf("PutMapValue() error = %v", err)
+	}
+
+	if ev := nextEvent(t, sub); ev.Type != EventMap || ev.Path.String() != "/metrics/cpu" {
+		t.Errorf("event = %s %s %s, want the put of /metrics/cpu", ev.Type, ev.Op, ev.Path)
+	}
+	select {
+	case ev := <-sub.C:
+		t.Errorf("unexpected event %s %s %s", ev.Type, ev.Op, ev.Path)
+	default:
+	}
+
+	t.Run("sync", func(t *testing.T) {
+		// Sync events match by the paths their changes touched
+		sub := s.Subscribe(0, EventFilter{Path: metrics})
+		defer sub.Close()
+
+		data, err := s.GetSnapshot(ctx)
+		if err != nil {
+			t.Fatalf("GetSnapshot() error = %v", err)
+		}
+		peer, err := automerge.LoadWithWASM(ctx, data, automerge.TestWASMPath)
+		if err != nil {
+			t.Fatalf("LoadWithWASM() error = %v", err)
+		}
+		defer peer.Close(ctx)
+
+		peer.Put(ctx, automerge.Root(), "theme", automerge.NewString("light"))
+		syncWith(t, s, peer)
+		peer.Put(ctx, metrics, "mem", automerge.NewString("7"))
+		syncWith(t, s, peer)
+
+		ev := nextEvent(t, sub)
+		if ev.Type != EventSync || ev.Path.String() != "/metrics/mem" ||
+			len(ev.Paths) != 1 || ev.Paths[0].String() != "/metrics/mem" {
+			t.Errorf("event = %s %s %s %v, want the sync of /metrics/mem", ev.Type, ev.Op, ev.Path, ev.Paths)
+		}
+		select {
+		case ev := <-sub.C:
+			t.Errorf("unexpected event %s %s %s %v", ev.Type, ev.Op, ev.Path, ev.Paths)
+		default:
+		}
+	})
+}
+
+// syncWith syncs s and peer until neither has anything to send
+func syncWith(t *testing.T, s *Server, peer *automerge.Document) {
+	t.Helper()
+	ctx := context.Background()
+
+	state, err := s.InitSyncState(ctx)
+	if err != nil {
+		t.Fatalf("InitSyncState() error = %v", err)
+	}
+	defer s.FreeSyncState(ctx, state)
+	syncState(t, s, state, peer)
+}
+
+// syncState syncs s, using its sync state for peer, and peer until neither
+// has anything to send
+func syncState(t *testing.T, s *Server, state *automerge.SyncState, peer *automerge.Document) {
+	t.Helper()
+	ctx := context.Background()
+
+	peerState, err := peer.InitSyncState(ctx)
+	if err != nil {
+		t.Fatalf("peer InitSyncState() error = %v", err)
+	}
+	defer peer.FreeSyncState(ctx, peerState)
+
+	for i := 0; i < 10; i++ {
+		msg, err := peer.GenerateSyncMessage(ctx, peerState)
+		if err != nil {
+			t.Fatalf("peer GenerateSyncMessage() error = %v", err)
+		}
+		if len(msg) > 0 {
+			if err := s.ReceiveSyncMessage(ctx, state, msg); err != nil {
+				t.Fatalf("ReceiveSyncMessage() error = %v", err)
+			}
+		}
+		reply, err := s.GenerateSyncMessage(ctx, state)
+		if err != nil {
+			t.Fatalf("GenerateSyncMessage() error = %v", err)
+		}
+		if len(reply) > 0 {
+			if err := peer.ReceiveSyncMessage(ctx, peerState, reply); err != nil {
+				t.Fatalf("peer ReceiveSyncMessage() error = %v", err)
+			}
+		}
+		if len(msg) == 0 && len(reply) == 0 {
+			return
+		}
+	}
+	t.Fatal("sync did not settle")
+}
+
+// TestServer_EventLogTrim checks the event log keeps the last EventLogSize
+// events resumable and doesn't grow past twice that
+func TestServer_EventLogTrim(t *testing.T) {
+	s := New(Config{Storage: NewMemoryStorage(), EventLogSize: 3})
+	defer s.Close(context.Background())
+
+	sub := s.Subscribe(100)
+	defer sub.Close()
+	var ids []string
+	for i := 0; i < 20; i++ {
+		s.publish(Event{Type: EventMap, Op: "put", Path: automerge.Root().Get("k")})
+		ids = append(ids, nextEvent(t, sub).ID)
+		if n := len(s.eventLog); n >= 6 {
+			t.Fatalf("event log holds %d events after %d, want fewer than 6", n, i+1)
+		}
+	}
+
+	if _, missed, ok := s.Resume(0, ids[16]); !ok || len(missed) != 3 || missed[2].ID != ids[19] {
+		t.Errorf("Resume() = %v, %v; want the last 3 events", missed, ok)
+	}
+	if _, _, ok := s.Resume(0, ids[15]); ok {
+		t.Error("Resume() from before the last 3 events succeeded")
+	}
+}
+
+// TestServer_Resume checks a subscriber resumes from the event log, and
+// can't across a gap
+func TestServer_Resume(t *testing.T) {
+	s := New(Config{Storage: NewMemoryStorage(), EventLogSize: 2})
+	defer s.Close(context.Background())
+
+	root := automerge.Root()
+	sub := s.Subscribe(0)
+	if sub.LastID != "" {
+		t.Errorf("LastID = %q before any event", sub.LastID)
+	}
+	var ids []string
+	for _, key := range []string{"a", "b", "c"} {
+		s.publish(Event{Type: EventMap, Op: "put", Path: root.Get(key)})
+		ids = append(ids, nextEvent(t, sub).ID)
+	}
+	sub.Close()
+	s.publish(Event{Type: EventCounter, Op: "increment", Path: root.Get("d")})
+
+	t.Run("missed events", func(t *testing.T) {
+		sub, missed, ok := s.Resume(0, ids[1])
+		defer sub.Close()
+		if !ok || len(missed) != 2 || missed[0].ID != ids[2] || missed[1].Path.String() != "/d" {
+			t.Errorf("Resume() = %v, %v; want c and d", missed, ok)
+		}
+		if sub.LastID != missed[1].ID {
+			t.Errorf("LastID = %q, want %q", sub.LastID, missed[1].ID)
+		}
+	})
+
+	t.Run("filtered", func(t *testing.T) {
+		sub, missed, ok := s.Resume(0, ids[1], EventFilter{Types: []EventType{EventCounter}})
+		defer sub.Close()
+		if !ok || len(missed) != 1 || missed[0].Type != EventCounter {
+			t.Errorf("Resume() = %v, %v; want d only", missed, ok)
+		}
+	})
+
+	t.Run("up to date", func(t *testing.T) {
+		latest := s.Subscribe(0)
+		latest.Close()
+		sub, missed, ok := s.Resume(0, latest.LastID)
+		defer sub.Close()
+		if !ok || len(missed) != 0 {
+			t.Errorf("Resume() = %v, %v; want nothing missed", missed, ok)
+		}
+	})
+
+	for name, id := range map[string]string{
+		"out of the log": ids[0],
+		"other epoch":    "x" + ids[2],
+		"future":         ids[2] + "0",
+		"not an ID":      "nope",
+	} {
+		t.Run(name, func(t *testing.T) {
+			sub, missed, ok := s.Resume(0, id)
+			defer sub.Close()
+			if ok || missed != nil {
+				t.Errorf("Resume(%q) = %v, %v; want a gap", id, missed, ok)
+			}
+		})
+	}
+
+	t.Run("unrecorded change", func(t *testing.T) {
+		s.resumeWindow = -1 // Nobody subscribed: the next change isn't recorded
+		if s.recordingEvents() {
+			t.Fatal("recordingEvents() = true with no subscribers past the window")
+		}
+		sub, _, ok := s.Resume(0, ids[2])
+		defer sub.Close()
+		if ok {
+			t.Error("Resume() across an unrecorded change succeeded")
+		}
+	})
+}
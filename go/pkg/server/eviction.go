@@ -0,0 +1,266 @@
+// ==============================================================================
+// Layer 5: Go Server - Document Eviction
+// ==============================================================================
+// ARCHITECTURE: This is the stateful server layer (Layer 5/7).
+//
+// RESPONSIBILITIES:
+// - Unload documents idle for longer than IdleTTL
+// - Unload least recently used documents while the loaded ones hold more
+//   WASM memory than MemoryBudget
+// - Flush each document before unloading it
+// - Report loaded/evicted counts and per-document memory
+//
+// DEPENDENCIES:
+// - pkg/server/registry.go (the documents and their leases)
+// - pkg/wazero (MemorySize: the WASM linear memory of each document)
+//
+// DEPENDENTS:
+// - pkg/api/documents.go (GET /api/docs/_stats)
+//
+// NOTES:
+// - Pinned documents and documents held by Acquire are never evicted, so a
+//   document with an open SSE stream stays loaded
+// - An evicted document is loaded again from storage on its next use
+// - WASM memory never shrinks, so a document's size is its high-water mark
+//   since it was loaded; evicting it is the only way to get it back
+// ==============================================================================
+
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"time"
+)
+
+// DefaultEvictInterval is how often idle documents are looked for
+const DefaultEvictInterval = 30 * time.Second
+
+// errEvicted fails the placeholder entry of an evicted document, so
+// requests waiting on it load the document again
+var errEvicted = errors.New("document evicted")
+
+// EvictionConfig says when a Registry unloads documents. The zero value
+// never does.
+type EvictionConfig struct {
+	// IdleTTL evicts documents unused for this long (0: never)
+	IdleTTL time.Duration
+
+	// MemoryBudget evicts least recently used documents while the loaded
+	// ones hold more WASM memory than this many bytes (0: no budget)
+	MemoryBudget int64
+
+	// Interval is how often to check (default: DefaultEvictInterval). Loads
+	// also trigger a check when there is a MemoryBudget.
+	Interval time.Duration
+}
+
+// RegistryStats describes the documents in a Registry
+type RegistryStats struct {
+	Loaded       int    // Documents in memory
+	Loads        uint64 // Documents loaded or created since the registry opened
+	Evictions    uint64 // Documents evicted since the registry opened
+	MemoryBytes  int64  // WASM memory of the loaded documents
+	MemoryBudget int64
+	IdleTTL      time.Duration
+	Documents    []DocumentStats // Loaded documents, by ID
+}
+
+// DocumentStats describes one loaded document
+type DocumentStats struct {
+	ID          string
+	MemoryBytes int64
+	Pinned      bool
+	InUse       int // Acquire calls not yet released
+	LastUsed    time.Time
+	Queue       QueueStats
+	Events      EventStats
+}
+
+// loadedDoc is a loaded document seen by an eviction pass
+type loadedDoc struct {
+	id  string
+	e   *docEntry
+	mem int64
+
+	// Copied under Registry.mu
+	pinned   bool
+	refs     int
+	lastUsed time.Time
+}
+
+// startEvictor starts the background eviction loop (called from
+// NewRegistry)
+func (r *Registry) startEvictor() {
+	stop, done := make(chan struct{}), make(chan struct{})
+	r.stopEvict, r.evictDone = stop, done
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(r.eviction.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			case <-r.evictCh:
+			}
+			r.Evict(context.Background())
+		}
+	}()
+}
+
+// stopEvictor stops the eviction loop and waits for it (safe to call more
+// than once, or without a loop)
+func (r *Registry) stopEvictor() {
+	r.mu.Lock()
+	stop := r.stopEvict
+	r.stopEvict = nil
+	r.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-r.evictDone
+	}
+}
+
+// requestEvict wakes the eviction loop if there is a memory budget to check
+func (r *Registry) requestEvict() {
+	if r.eviction.MemoryBudget <= 0 {
+		return
+	}
+	select {
+	case r.evictCh <- struct{}{}:
+	default:
+		// A check is already requested
+	}
+}
+
+// Evict unloads documents unused for longer than IdleTTL, then the least
+// recently used ones until the rest fit in MemoryBudget. It returns how
+// many were evicted. It runs in the background; call it to check now.
+func (r *Registry) Evict(ctx context.Context) int {
+	docs, total := r.loadedDocs()
+	now := time.Now()
+
+	// Least recently used first
+	sort.Slice(docs, func(i, j int) bool { return docs[i].lastUsed.Before(docs[j].lastUsed) })
+
+	evicted := 0
+	for _, d := range docs {
+		if d.pinned || d.refs > 0 {
+			continue
+		}
+		idle := r.eviction.IdleTTL > 0 && now.Sub(d.lastUsed) > r.eviction.IdleTTL
+		over := r.eviction.MemoryBudget > 0 && total > r.eviction.MemoryBudget
+		if !idle && !over {
+			continue
+		}
+		if r.evict(ctx, d.id, d.e) {
+			evicted++
+			total -= d.mem
+		}
+	}
+	return evicted
+}
+
+// loadedDocs returns the loaded documents and their total memory
+func (r *Registry) loadedDocs() ([]loadedDoc, int64) {
+	r.mu.Lock()
+	docs := make([]loadedDoc, 0, len(r.docs))
+	for id, e := range r.docs {
+		select {
+		case <-e.ready:
+			if e.err == nil {
+				docs = append(docs, loadedDoc{id: id, e: e, pinned: e.pinned, refs: e.refs, lastUsed: e.lastUsed})
+			}
+		default:
+		}
+	}
+	r.mu.Unlock()
+
+	// Outside r.mu: MemoryBytes waits for the document's lock
+	var total int64
+	for i := range docs {
+		docs[i].mem = docs[i].e.srv.MemoryBytes()
+		total += docs[i].mem
+	}
+	return docs, total
+}
+
+// evict flushes and closes one document, unless it was used meanwhile.
+// If the flush fails the document stays loaded, so no edits are lost.
+func (r *Registry) evict(ctx context.Context, id string, e *docEntry) bool {
+	// Swap in a placeholder entry: requests for the document wait for the
+	// eviction, then load it again
+	tomb := &docEntry{ready: make(chan struct{})}
+	r.mu.Lock()
+	if r.closed || r.docs[id] != e || e.pinned || e.refs > 0 {
+		r.mu.Unlock()
+		return false
+	}
+	r.docs[id] = tomb
+	r.mu.Unlock()
+
+	if err := e.srv.Flush(ctx); err != nil {
+		log.Printf("Warning: not evicting document %s: flush failed: %v", id, err)
+		r.mu.Lock()
+		closed := r.closed
+		if !closed {
+			r.docs[id] = e
+		}
+		r.mu.Unlock()
+		if closed {
+			// Close has already collected the entries: close it here
+			e.srv.Close(ctx)
+		}
+		r.finish(id, tomb, nil, errEvicted)
+		return false
+	}
+
+	if err := e.srv.Close(ctx); err != nil {
+		log.Printf("Warning: failed to close evicted document %s: %v", id, err)
+	}
+	r.mu.Lock()
+	r.evictions++
+	r.mu.Unlock()
+	r.finish(id, tomb, nil, errEvicted)
+	r.unloaded(id)
+	log.Printf("[%s] Evicted document %s", r.cfg.UserID, id)
+	return true
+}
+
+// Stats returns the loaded documents and the load and eviction counts
+func (r *Registry) Stats() RegistryStats {
+	docs, total := r.loadedDocs()
+	sort.Slice(docs, func(i, j int) bool { return docs[i].id < docs[j].id })
+
+	r.mu.Lock()
+	stats := RegistryStats{
+		Loaded:       len(docs),
+		Loads:        r.loads,
+		Evictions:    r.evictions,
+		MemoryBytes:  total,
+		MemoryBudget: r.eviction.MemoryBudget,
+		IdleTTL:      r.eviction.IdleTTL,
+		Documents:    make([]DocumentStats, 0, len(docs)),
+	}
+	r.mu.Unlock()
+
+	for _, d := range docs {
+		stats.Documents = append(stats.Documents, DocumentStats{
+			ID:          d.id,
+			MemoryBytes: d.mem,
+			Pinned:      d.pinned,
+			InUse:       d.refs,
+			LastUsed:    d.lastUsed,
+			Queue:       d.e.srv.QueueStats(),
+			Events:      d.e.srv.EventStats(),
+		})
+	}
+	return stats
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestRegistry_EvictEmpty covers an evictor with nothing to evict
+func TestRegistry_EvictEmpty(t *testing.T) {
+	ctx := context.Background()
+	reg, err := NewRegistry(Config{Storage: NewMemoryStorage()}, EvictionConfig{
+		IdleTTL:  time.Millisecond,
+		Interval: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+
+	if n := reg.Evict(ctx); n != 0 {
+		t.Errorf("Evict() = %d, want 0", n)
+	}
+	stats := reg.Stats()
+	if stats.Loaded != 0 || stats.Loads != 0 || stats.Evictions != 0 || len(stats.Documents) != 0 {
+		t.Errorf("Stats() = %+v, want nothing loaded", stats)
+	}
+
+	// Closing twice stops the evictor once
+	if err := reg.Close(ctx); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if err := reg.Close(ctx); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+}
+
+func TestRegistry_EvictIdle(t *testing.T) {
+	ctx := context.Background()
+	reg, _ := newTestRegistry(t)
+	reg.eviction.IdleTTL = time.Millisecond
+
+	var unloaded []string
+	reg.OnUnload(func(id string) { unloaded = append(unloaded, id) })
+
+	notes, err := reg.Create(ctx, "notes")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	notes.SetText(ctx, "kept")
+	reg.Pin(ctx, DefaultDocID)
+	held, release, err := reg.Acquire(ctx, "notes")
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if held != notes {
+		t.Error("Acquire() returned a different Server for a loaded document")
+	}
+
+	// Held and pinned documents stay
+	time.Sleep(5 * time.Millisecond)
+	if n := reg.Evict(ctx); n != 0 {
+		t.Errorf("Evict() with the document held = %d, want 0", n)
+	}
+
+	release()
+	release() // Idempotent
+	time.Sleep(5 * time.Millisecond)
+	if n := reg.Evict(ctx); n != 1 {
+		t.Fatalf("Evict() = %d, want 1", n)
+	}
+	if loaded := reg.Loaded(); !reflect.DeepEqual(loaded, []string{DefaultDocID}) {
+		t.Errorf("Loaded() = %v, want [default]", loaded)
+	}
+	if !reflect.DeepEqual(unloaded, []string{"notes"}) {
+		t.Errorf("OnUnload calls = %v, want [notes]", unloaded)
+	}
+
+	// Evicted documents are still listed, and load again with their edits
+	if ids, _ := reg.List(ctx); !reflect.DeepEqual(ids, []string{DefaultDocID, "notes"}) {
+		t.Errorf("List() = %v, want [default notes]", ids)
+	}
+	reloaded, err := reg.Get(ctx, "notes")
+	if err != nil {
+		t.Fatalf("Get() after eviction error = %v", err)
+	}
+	if reloaded == notes {
+		t.Error("Get() after eviction returned the evicted Server")
+	}
+	if text, _ := reloaded.GetText(ctx); text != "kept" {
+		t.Errorf("text after eviction = %q, want %q", text, "kept")
+	}
+
+	stats := reg.Stats()
+	if stats.Loaded != 2 || stats.Loads != 3 || stats.Evictions != 1 {
+		t.Errorf("Stats() = loaded %d, loads %d, evictions %d; want 2, 3, 1",
+			stats.Loaded, stats.Loads, stats.Evictions)
+	}
+	for _, doc := range stats.Documents {
+		if doc.MemoryBytes <= 0 {
+			t.Errorf("document %s MemoryBytes = %d, want > 0", doc.ID, doc.MemoryBytes)
+		}
+	}
+}
+
+func TestRegistry_MemoryBudget(t *testing.T) {
+	ctx := context.Background()
+	reg, _ := newTestRegistry(t)
+
+	for _, id := range []string{"a", "b", "c"} {
+		if _, err := reg.Create(ctx, id); err != nil {
+			t.Fatalf("Create(%s) error = %v", id, err)
+		}
+	}
+	reg.Get(ctx, "a") // Most recently used
+
+	// Room for the largest document only
+	var largest int64
+	for _, doc := range reg.Stats().Documents {
+		if doc.MemoryBytes > largest {
+			largest = doc.MemoryBytes
+		}
+	}
+	reg.eviction.MemoryBudget = largest
+
+	if n := reg.Evict(ctx); n != 2 {
+		t.Fatalf("Evict() = %d, want 2", n)
+	}
+	if loaded := reg.Loaded(); !reflect.DeepEqual(loaded, []string{"a"}) {
+		t.Errorf("Loaded() = %v, want [a] (most recently used)", loaded)
+	}
+	if stats := reg.Stats(); stats.MemoryBytes > largest {
+		t.Errorf("MemoryBytes = %d, want <= budget %d", stats.MemoryBytes, largest)
+	}
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Legacy single-document layout, used before Storage: doc.am, its backups
+// doc.am.1 …, the change chunks changes.<20 digits> and actors.json directly
+// in the storage directory. Chunks already have their key names.
+
+// migrateLegacyLayout moves a legacy layout in dir into the DefaultDocID
+// document of a FileStorage rooted at dir.
+//
+// The snapshot moves last, so an interrupted migration is simply redone on
+// the next start.
+func migrateLegacyLayout(dir string) error {
+	legacy, err := filepath.Glob(filepath.Join(dir, "doc.am*"))
+	if err != nil {
+		return err
+	}
+	chunks, err := filepath.Glob(filepath.Join(dir, chunkKeyPrefix+strings.Repeat("[0-9]", 20)))
+	if err != nil {
+		return err
+	}
+	legacy = append(legacy, chunks...)
+	if len(legacy) == 0 {
+		return nil
+	}
+
+	docDir := filepath.Join(dir, DefaultDocID)
+	if _, err := os.Stat(filepath.Join(docDir, snapshotKey)); err == nil {
+		log.Printf("Warning: not migrating %s: %s already has a snapshot", strings.Join(legacy, ", "), docDir)
+		return nil
+	}
+	log.Printf("Migrating %s into %s", strings.Join(legacy, ", "), docDir)
+	if err := os.MkdirAll(docDir, 0755); err != nil {
+		return err
+	}
+
+	// Chunks, backups (doc.am.N → snapshot.N) and the actor registry, then
+	// doc.am
+	for _, path := range chunks {
+		if err := rename(path, filepath.Join(docDir, filepath.Base(path))); err != nil {
+			return err
+		}
+	}
+	for _, path := range legacy {
+		name := filepath.Base(path)
+		if n := strings.TrimPrefix(name, "doc.am."); n != name {
+			if err := rename(path, filepath.Join(docDir, snapshotKey+"."+n)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := rename(filepath.Join(dir, "actors.json"), filepath.Join(docDir, actorsKey)); err != nil {
+		return err
+	}
+	if err := rename(filepath.Join(dir, "doc.am"), filepath.Join(docDir, snapshotKey)); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// rename moves from to to, ignoring a missing source
+func rename(from, to string) error {
+	if err := os.Rename(from, to); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to move %s: %w", from, err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMigrateLegacyLayout(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	for name, data := range map[string]string{
+		"doc.am":                 "snapshot",
+		"doc.am.1":               "backup",
+		"actors.json":            `{"a":"alice"}`,
+		chunkKey(0):              "first",
+		chunkKey(1):              "second",
+		chunkKey(2) + ".123.tmp": "torn",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	storage, err := NewFileStorage(dir)
+	if err != nil {
+		t.Fatalf("NewFileStorage() error = %v", err)
+	}
+
+	keys, _ := storage.List(ctx, DefaultDocID, "")
+	want := []string{actorsKey, chunkKey(0), chunkKey(1), snapshotKey, backupKey(1)}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys = %v, want %v", keys, want)
+	}
+	for key, value := range map[string]string{
+		snapshotKey:  "snapshot",
+		backupKey(1): "backup",
+		actorsKey:    `{"a":"alice"}`,
+		chunkKey(0):  "first",
+		chunkKey(1):  "second",
+	} {
+		if got, _ := storage.Get(ctx, DefaultDocID, key); string(got) != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+
+	for _, name := range []string{"doc.am", "doc.am.1", "actors.json", chunkKey(0), chunkKey(1)} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s still in the root directory (err = %v)", name, err)
+		}
+	}
+
+	// Opening the migrated directory again changes nothing
+	if _, err := NewFileStorage(dir); err != nil {
+		t.Fatalf("NewFileStorage() on a migrated directory error = %v", err)
+	}
+	if again, _ := storage.List(ctx, DefaultDocID, ""); !reflect.DeepEqual(again, want) {
+		t.Errorf("keys after reopening = %v, want %v", again, want)
+	}
+}
+
+func TestMigrateLegacyLayout_Interrupted(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// A chunk was moved, doc.am and the other chunk not yet
+	docDir := filepath.Join(dir, DefaultDocID)
+	os.MkdirAll(docDir, 0755)
+	os.WriteFile(filepath.Join(docDir, chunkKey(0)), []byte("first"), 0644)
+	os.WriteFile(filepath.Join(dir, chunkKey(1)), []byte("second"), 0644)
+	os.WriteFile(filepath.Join(dir, "doc.am"), []byte("snapshot"), 0644)
+
+	storage, err := NewFileStorage(dir)
+	if err != nil {
+		t.Fatalf("NewFileStorage() error = %v", err)
+	}
+	want := []string{chunkKey(0), chunkKey(1), snapshotKey}
+	if keys, _ := storage.List(ctx, DefaultDocID, ""); !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys = %v, want %v", keys, want)
+	}
+}
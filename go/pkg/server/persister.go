@@ -0,0 +1,290 @@
+// ==============================================================================
+// Layer 5: Go Server - Background Persister
+// ==============================================================================
+// ARCHITECTURE: This is the stateful server layer (Layer 5/7).
+//
+// RESPONSIBILITIES:
+// - Write queued change chunks to Storage outside the document lock
+// - Rewrite the keys stored whole (actor registry, sync-peer states) when
+//   they changed
+// - Compact the chunks into a fresh snapshot at the configured thresholds
+// - Flush on a timer, after MaxDirtyChanges saves, on Flush and on Close
+// - Report persistence lag for readiness probes
+//
+// DEPENDENCIES:
+// - pkg/server/storage.go (Storage backends)
+// - pkg/server/snapshot.go (snapshots and their backups)
+//
+// DEPENDENTS:
+// - pkg/server/document.go (saveDocument queues chunks)
+// - pkg/server/server.go (Initialize starts the persister, Close flushes)
+//
+// NOTES:
+// - persistMu serializes disk writers and guards the chunk counters; the
+//   document and the queue belong to the document goroutine (actor.go)
+// - On the document goroutine a flush only takes the queued chunks, or a
+//   full Save when compacting; the disk I/O runs on the caller's goroutine
+// - Edits made since the last flush are lost if the process crashes
+//   (bounded by FlushInterval and MaxDirtyChanges)
+// ==============================================================================
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Persister defaults
+const (
+	DefaultFlushInterval   = time.Second
+	DefaultMaxDirtyChanges = 100
+)
+
+// CloseFlushTimeout bounds the final flush in Close, which doesn't use up
+// the caller's context
+const CloseFlushTimeout = 30 * time.Second
+
+// requestFlush wakes the persister without waiting for it
+func (s *Server) requestFlush() {
+	select {
+	case s.flushCh <- struct{}{}:
+	default:
+		// A flush is already requested
+	}
+}
+
+// startPersister starts the background flush loop (called from Initialize)
+func (s *Server) startPersister() {
+	s.stopPersist = make(chan struct{})
+	s.persistDone = make(chan struct{})
+
+	go func() {
+		defer close(s.persistDone)
+
+		ticker := time.NewTicker(s.flushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-s.flushCh:
+			case <-s.stopPersist:
+				return
+			}
+			if err := s.Flush(context.Background()); err != nil {
+				log.Printf("Warning: failed to persist changes: %v", err)
+			}
+			s.expireSyncPeers(context.Background())
+		}
+	}()
+}
+
+// stopPersister stops the background flush loop and waits for it to exit
+func (s *Server) stopPersister() {
+	if s.stopPersist == nil {
+		return
+	}
+	close(s.stopPersist)
+	<-s.persistDone
+	s.stopPersist = nil
+}
+
+// Flush writes all queued changes to disk (thread-safe).
+//
+// The changes are stored as one change chunk, or folded into a fresh
+// snapshot when the chunks are due for compaction, and the actor registry
+// and sync-peer states that changed are rewritten. A failed flush is
+// retried by the next one.
+//
+// Example:
+//
+//	srv.SetText(ctx, "Hello")
+//	if err := srv.Flush(ctx); err != nil { ... } // "Hello" is on disk
+func (s *Server) Flush(ctx context.Context) error {
+	s.persistMu.Lock()
+	defer s.persistMu.Unlock()
+
+	// Take the queue (and the snapshot, if compacting) and the keys to
+	// rewrite on the document goroutine
+	var (
+		taken           bool
+		chunk, snapshot []byte
+		keys            map[string][]byte
+		dirty           int
+		dirtySince      time.Time
+	)
+	err := s.doWait(ctx, func() error {
+		if s.doc == nil {
+			return nil
+		}
+
+		if len(s.pending) > 0 || s.needsCompact {
+			chunk = bytes.Join(s.pending, nil)
+			if s.needsCompact ||
+				s.chunkBytes+int64(len(chunk)) >= s.compactBytes ||
+				s.chunkCount+1 >= s.compactChanges {
+				var err error
+				if snapshot, err = s.doc.Save(ctx); err != nil {
+					return err
+				}
+			}
+
+			taken = true
+			dirty, dirtySince = s.dirty, s.dirtySince
+			s.pending = nil
+			s.dirty = 0
+		}
+
+		for key := range s.dirtyKeys {
+			data, err := s.keyData(ctx, key)
+			if err != nil {
+				log.Printf("Warning: not writing %s: %v", key, err)
+				continue
+			}
+			if keys == nil {
+				keys = make(map[string][]byte)
+			}
+			keys[key] = data
+		}
+		clear(s.dirtyKeys)
+		return nil
+	})
+	if err != nil || (!taken && len(keys) == 0) {
+		return err
+	}
+
+	// Write without holding up readers and writers of the document
+	switch {
+	case snapshot != nil:
+		err = s.writeCompacted(ctx, snapshot)
+	case taken:
+		if err = s.writeChunk(ctx, chunk); err != nil {
+			// The chunk is marked as saved but was never stored: only a
+			// full snapshot can persist it now
+			log.Printf("Warning: %v (writing a full snapshot next)", err)
+		}
+	}
+	var (
+		keysErr error
+		failed  []string
+	)
+	for key, data := range keys {
+		if err := s.storage.Put(ctx, s.docID, key, data); err != nil {
+			keysErr = errors.Join(keysErr, fmt.Errorf("failed to write %s: %w", key, err))
+			failed = append(failed, key)
+		}
+	}
+
+	// Record the outcome even if ctx has ended: the queue was taken
+	s.doWait(context.WithoutCancel(ctx), func() error {
+		s.persistErr = errors.Join(err, keysErr)
+		for _, key := range failed {
+			s.dirtyKeys[key] = true
+		}
+		if err != nil {
+			s.needsCompact = true
+			if s.dirty == 0 || dirtySince.Before(s.dirtySince) {
+				s.dirtySince = dirtySince
+			}
+			s.dirty += dirty
+			return nil
+		}
+		if snapshot != nil {
+			s.needsCompact = false
+		}
+		if keysErr == nil {
+			s.lastFlush = time.Now()
+		}
+		return nil
+	})
+	return errors.Join(err, keysErr)
+}
+
+// keyData renders the current value of a key rewritten whole when it
+// changes (runs on the document goroutine)
+func (s *Server) keyData(ctx context.Context, key string) ([]byte, error) {
+	switch key {
+	case actorsKey:
+		return json.MarshalIndent(s.actors, "", "  ")
+	case userActorsKey:
+		return json.MarshalIndent(s.userActors, "", "  ")
+	}
+	peerID := strings.TrimPrefix(key, syncKeyPrefix)
+	state := s.syncPeers[peerID]
+	if state == nil {
+		return nil, fmt.Errorf("peer %s has no sync state", peerID)
+	}
+	return s.doc.EncodeSyncState(ctx, state)
+}
+
+// writeChunk stores the next change chunk (assumes persistMu is held)
+func (s *Server) writeChunk(ctx context.Context, chunk []byte) error {
+	if err := s.storage.Put(ctx, s.docID, chunkKey(s.chunkSeq), chunk); err != nil {
+		return fmt.Errorf("failed to store change chunk: %w", err)
+	}
+	s.chunkSeq++
+	s.chunkBytes += int64(len(chunk))
+	s.chunkCount++
+	return nil
+}
+
+// writeCompacted writes a full snapshot and deletes the change chunks it
+// covers (assumes persistMu is held)
+func (s *Server) writeCompacted(ctx context.Context, snapshot []byte) error {
+	if err := s.writeSnapshot(ctx, snapshot); err != nil {
+		return err
+	}
+
+	// Only after the snapshot is written: replaying a chunk again is harmless
+	if err := s.deleteChunks(ctx); err != nil {
+		return err
+	}
+
+	log.Printf("[%s] Saved document %s (%d bytes)", s.userID, s.docID, len(snapshot))
+	return nil
+}
+
+// deleteChunks deletes every stored change chunk (assumes persistMu is held)
+func (s *Server) deleteChunks(ctx context.Context) error {
+	keys, err := s.storage.List(ctx, s.docID, chunkKeyPrefix)
+	if err != nil {
+		return fmt.Errorf("failed to list change chunks: %w", err)
+	}
+	for _, key := range keys {
+		if err := s.storage.Delete(ctx, s.docID, key); err != nil {
+			return fmt.Errorf("failed to delete change chunk: %w", err)
+		}
+	}
+	s.chunkBytes = 0
+	s.chunkCount = 0
+	return nil
+}
+
+// persistenceStatus describes unflushed changes (runs on the document
+// goroutine)
+func (s *Server) persistenceStatus() map[string]interface{} {
+	status := map[string]interface{}{
+		"dirty_changes": s.dirty,
+		"lag_ms":        int64(0),
+	}
+	if s.dirty > 0 {
+		status["lag_ms"] = time.Since(s.dirtySince).Milliseconds()
+	}
+	if !s.lastFlush.IsZero() {
+		status["last_flush"] = s.lastFlush.UTC().Format(time.RFC3339Nano)
+	}
+	if s.persistErr != nil {
+		status["last_error"] = s.persistErr.Error()
+	}
+	if s.replayErr != nil {
+		status["replay_error"] = s.replayErr.Error()
+	}
+	return status
+}
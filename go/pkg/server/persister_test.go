@@ -0,0 +1,377 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+)
+
+// waitFlushed waits for the persister to write every queued change
+func waitFlushed(t *testing.T, s *Server) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		dirty, _ := call(context.Background(), s, func() (int, error) { return s.dirty, nil })
+		if dirty == 0 {
+			// Wait for the write in progress
+			s.persistMu.Lock()
+			s.persistMu.Unlock()
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("persister did not flush")
+}
+
+// TestServer_PersisterMaxDirty verifies saves are queued in memory until
+// MaxDirtyChanges of them wake the persister
+func TestServer_PersisterMaxDirty(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := New(Config{
+		StorageDir:      dir,
+		UserID:          "test-user",
+		WASMPath:        automerge.TestWASMPath,
+		FlushInterval:   time.Hour,
+		MaxDirtyChanges: 3,
+	})
+	if err := s.Initialize(ctx); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	if err := s.Flush(ctx); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	for _, text := range []string{"a", "b"} {
+		if err := s.SetText(ctx, text); err != nil {
+			t.Fatalf("SetText() error = %v", err)
+		}
+	}
+	_, details := s.IsReady()
+	status := details["persistence"].(map[string]interface{})
+	if status["dirty_changes"] != 2 {
+		t.Errorf("persistence = %v, want 2 dirty changes", status)
+	}
+	if n := storedChunks(t, s); n != 0 {
+		t.Errorf("%d change chunks stored before the threshold", n)
+	}
+
+	// The third save reaches the threshold: all three go out as one chunk
+	if err := s.SetText(ctx, "c"); err != nil {
+		t.Fatalf("SetText() error = %v", err)
+	}
+	waitFlushed(t, s)
+	if n := storedChunks(t, s); n != 1 {
+		t.Errorf("change chunks = %d, want 1", n)
+	}
+
+	// Close flushes what is still queued
+	if err := s.SetText(ctx, "d"); err != nil {
+		t.Fatalf("SetText() error = %v", err)
+	}
+	if err := s.Close(ctx); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	s2 := newTestServer(t, dir, 100)
+	defer s2.Close(ctx)
+	if text, _ := s2.GetText(ctx); text != "d" {
+		t.Errorf("GetText() after restart = %q, want %q", text, "d")
+	}
+}
+
+// TestServer_PersisterInterval verifies queued saves are written on the timer
+func TestServer_PersisterInterval(t *testing.T) {
+	ctx := context.Background()
+
+	s := New(Config{
+		StorageDir:    t.TempDir(),
+		UserID:        "test-user",
+		WASMPath:      automerge.TestWASMPath,
+		FlushInterval: 10 * time.Millisecond,
+	})
+	if err := s.Initialize(ctx); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	defer s.Close(ctx)
+
+	if err := s.SetText(ctx, "hello"); err != nil {
+		t.Fatalf("SetText() error = %v", err)
+	}
+	waitFlushed(t, s)
+
+	_, details := s.IsReady()
+	status := details["persistence"].(map[string]interface{})
+	if status["lag_ms"] != int64(0) || status["last_flush"] == nil || status["last_error"] != nil {
+		t.Errorf("persistence = %v", status)
+	}
+}
+
+// TestServer_CloseFlushesAfterDeadline verifies Close still flushes queued
+// changes when its context is already done
+func TestServer_CloseFlushesAfterDeadline(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := newTestServer(t, dir, 100)
+	if err := s.SetText(ctx, "queued"); err != nil {
+		t.Fatalf("SetText() error = %v", err)
+	}
+	done, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := s.Close(done); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	s2 := newTestServer(t, dir, 100)
+	defer s2.Close(ctx)
+	if text, _ := s2.GetText(ctx); text != "queued" {
+		t.Errorf("GetText() after restart = %q, want %q", text, "queued")
+	}
+}
+
+// TestServer_ChunkRecovery verifies edits stored only as change chunks
+// survive a restart, and a damaged chunk doesn't stop startup or get lost
+func TestServer_ChunkRecovery(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := newTestServer(t, dir, 100)
+	setText(t, s, "one")
+	snapshot, _ := s.storage.Get(ctx, s.docID, snapshotKey)
+
+	setText(t, s, "two")
+	setText(t, s, "three")
+
+	// Later edits went to chunks, not the snapshot
+	if after, _ := s.storage.Get(ctx, s.docID, snapshotKey); !bytes.Equal(after, snapshot) {
+		t.Error("snapshot rewritten before the compaction threshold")
+	}
+	if n := storedChunks(t, s); n != 2 {
+		t.Errorf("change chunks = %d, want 2", n)
+	}
+
+	// Crash: no Close, and the last chunk is damaged
+	s.stopPersister()
+	last := chunkKey(s.chunkSeq - 1)
+	data, _ := s.storage.Get(ctx, s.docID, last)
+	s.storage.Put(ctx, s.docID, last, data[:len(data)-1])
+	s.doc.Close(ctx)
+
+	s2 := newTestServer(t, dir, 100)
+	defer s2.Close(ctx)
+	if text, _ := s2.GetText(ctx); text != "two" {
+		t.Errorf("GetText() after recovery = %q, want %q", text, "two")
+	}
+
+	// The damaged chunk is set aside rather than compacted away, the good
+	// one stays, and the damage is reported
+	if n := storedChunks(t, s2); n != 1 {
+		t.Errorf("change chunks after recovery = %d, want 1", n)
+	}
+	if kept, err := s2.storage.Get(ctx, s2.docID, corruptChunkPrefix+last); err != nil || len(kept) != len(data)-1 {
+		t.Errorf("set-aside chunk = %d bytes, %v; want %d bytes", len(kept), err, len(data)-1)
+	}
+	if _, details := s2.IsReady(); details["persistence"].(map[string]interface{})["replay_error"] == nil {
+		t.Errorf("persistence = %v, want a replay_error", details["persistence"])
+	}
+}
+
+// TestServer_DamagedChunkKeepsLaterChunks verifies that chunks after a
+// damaged one are set aside with it, not replayed or compacted away
+func TestServer_DamagedChunkKeepsLaterChunks(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := newTestServer(t, dir, 100)
+	setText(t, s, "one")
+	setText(t, s, "two")
+	setText(t, s, "three")
+	s.stopPersister()
+	first := chunkKey(s.chunkSeq - 2)
+	s.storage.Put(ctx, s.docID, first, []byte("garbage"))
+	s.doc.Close(ctx)
+
+	s2 := newTestServer(t, dir, 100)
+	defer s2.Close(ctx)
+	if text, _ := s2.GetText(ctx); text != "one" {
+		t.Errorf("GetText() = %q, want %q", text, "one")
+	}
+	if n := storedChunks(t, s2); n != 0 {
+		t.Errorf("change chunks = %d, want 0", n)
+	}
+	aside, err := s2.storage.List(ctx, s2.docID, corruptChunkPrefix)
+	if err != nil || len(aside) != 2 {
+		t.Errorf("set-aside chunks = %v, %v; want 2", aside, err)
+	}
+
+	// New edits keep going to chunks after the set-aside ones
+	setText(t, s2, "four")
+	if n := storedChunks(t, s2); n != 1 {
+		t.Errorf("change chunks after an edit = %d, want 1", n)
+	}
+}
+
+// TestServer_Compaction verifies chunks are compacted at the threshold
+func TestServer_Compaction(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := newTestServer(t, dir, 3)
+	for i, text := range []string{"a", "b", "c", "d"} {
+		setText(t, s, text)
+		// The first flush writes the snapshot; the third chunk compacts
+		want := []int{0, 1, 2, 0}[i]
+		if n := storedChunks(t, s); n != want {
+			t.Errorf("after %q: change chunks = %d, want %d", text, n, want)
+		}
+	}
+	s.Close(ctx)
+
+	s2 := newTestServer(t, dir, 3)
+	defer s2.Close(ctx)
+	if text, _ := s2.GetText(ctx); text != "d" {
+		t.Errorf("GetText() after restart = %q, want %q", text, "d")
+	}
+}
+
+// TestServer_SyncPeerPersisted checks a sync peer's state is written after
+// a message is received from it, and restored after a restart
+func TestServer_SyncPeerPersisted(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := newTestServer(t, dir, 100)
+	setText(t, s, "hello")
+	data, err := s.GetSnapshot(ctx)
+	if err != nil {
+		t.Fatalf("GetSnapshot() error = %v", err)
+	}
+	peer, err := automerge.LoadWithWASM(ctx, data, automerge.TestWASMPath)
+	if err != nil {
+		t.Fatalf("LoadWithWASM() error = %v", err)
+	}
+	defer peer.Close(ctx)
+
+	state, err := s.SyncPeer(ctx, "peer-1")
+	if err != nil {
+		t.Fatalf("SyncPeer() error = %v", err)
+	}
+	if again, _ := s.SyncPeer(ctx, "peer-1"); again != state {
+		t.Error("SyncPeer() returned a new state for a known peer")
+	}
+	syncState(t, s, state, peer)
+	if err := s.Flush(ctx); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	stored, err := s.storage.Get(ctx, s.docID, syncKeyPrefix+"peer-1")
+	if err != nil {
+		t.Fatalf("Get(sync.peer-1) error = %v", err)
+	}
+	s.Close(ctx)
+
+	// The restored state knows the heads the peer has
+	s2 := newTestServer(t, dir, 100)
+	defer s2.Close(ctx)
+	restored, err := s2.SyncPeer(ctx, "peer-1")
+	if err != nil {
+		t.Fatalf("SyncPeer() after restart error = %v", err)
+	}
+	encoded, err := call(ctx, s2, func() ([]byte, error) {
+		return s2.doc.EncodeSyncState(ctx, restored)
+	})
+	if err != nil || !bytes.Equal(encoded, stored) {
+		t.Errorf("restored state encodes as %x, %v; want %x", encoded, err, stored)
+	}
+
+	if _, err := s2.SyncPeer(ctx, "../peer"); !errors.Is(err, ErrInvalidPeerID) {
+		t.Errorf("SyncPeer(../peer) error = %v, want ErrInvalidPeerID", err)
+	}
+}
+
+// TestServer_SyncPeerExpires checks an unused peer state leaves memory once
+// it is stored, and comes back from storage
+func TestServer_SyncPeerExpires(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t, t.TempDir(), 100)
+	defer s.Close(ctx)
+	setText(t, s, "hello")
+	data, err := s.GetSnapshot(ctx)
+	if err != nil {
+		t.Fatalf("GetSnapshot() error = %v", err)
+	}
+	peer, err := automerge.LoadWithWASM(ctx, data, automerge.TestWASMPath)
+	if err != nil {
+		t.Fatalf("LoadWithWASM() error = %v", err)
+	}
+	defer peer.Close(ctx)
+
+	state, err := s.SyncPeer(ctx, "peer-1")
+	if err != nil {
+		t.Fatalf("SyncPeer() error = %v", err)
+	}
+	syncState(t, s, state, peer)
+	peers := func() int {
+		n, _ := call(ctx, s, func() (int, error) { return len(s.syncPeers), nil })
+		return n
+	}
+
+	// Unused, but not stored yet
+	s.do(ctx, func() error { s.syncPeerIdle = time.Nanosecond; return nil })
+	s.expireSyncPeers(ctx)
+	if n := peers(); n != 1 {
+		t.Fatalf("%d peer states before the flush, want 1", n)
+	}
+
+	if err := s.Flush(ctx); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	s.expireSyncPeers(ctx)
+	if n := peers(); n != 0 {
+		t.Errorf("%d peer states after expiry, want 0", n)
+	}
+	if _, err := s.SyncPeer(ctx, "peer-1"); err != nil {
+		t.Fatalf("SyncPeer() after expiry error = %v", err)
+	}
+	if n := peers(); n != 1 {
+		t.Errorf("%d peer states after SyncPeer(), want 1", n)
+	}
+}
+
+// TestServer_UserActorPersisted checks a user edits with the same actor
+// after a restart, while a peer's registered actor is never reused
+func TestServer_UserActorPersisted(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := newTestServer(t, dir, 100)
+	if err := s.SetText(WithUser(ctx, "alice"), "hello"); err != nil {
+		t.Fatalf("SetText() error = %v", err)
+	}
+	alice, _ := call(ctx, s, func() (string, error) { return s.userActors["alice"], nil })
+	if err := s.RegisterActor(ctx, "0123456789abcdef", "bob"); err != nil {
+		t.Fatalf("RegisterActor() error = %v", err)
+	}
+	s.Close(ctx)
+
+	s2 := newTestServer(t, dir, 100)
+	defer s2.Close(ctx)
+	if err := s2.SetText(WithUser(ctx, "alice"), "hello!"); err != nil {
+		t.Fatalf("SetText() error = %v", err)
+	}
+	if err := s2.SetText(WithUser(ctx, "bob"), "hello!?"); err != nil {
+		t.Fatalf("SetText() error = %v", err)
+	}
+	actors, _ := call(ctx, s2, func() (map[string]string, error) { return s2.userActors, nil })
+	if actors["alice"] != alice {
+		t.Errorf("alice's actor after restart = %q, want %q", actors["alice"], alice)
+	}
+	if actors["bob"] == "0123456789abcdef" {
+		t.Error("bob edits with the actor a peer registered for him")
+	}
+}
@@ -0,0 +1,597 @@
+// ==============================================================================
+// Layer 5: Go Server - Document Registry
+// ==============================================================================
+// ARCHITECTURE: This is the stateful server layer (Layer 5/7).
+//
+// RESPONSIBILITIES:
+// - Create, load, list and delete documents by ID
+// - Hand out one Server per document; all of them share one Storage
+// - Load each document once, however many requests ask for it concurrently
+// - Evict idle documents (see eviction.go)
+//
+// DEPENDENCIES:
+// - pkg/server/server.go (one Server per document)
+// - pkg/server/storage.go (documents are stored under their ID)
+//
+// DEPENDENTS:
+// - pkg/httpserver (/api/docs/{id}/… routes; the legacy routes use
+//   DefaultDocID)
+//
+// NOTES:
+// - Each loaded document has its own WASM instance and background persister
+// - Documents are loaded on first use. Acquire holds one in memory until
+//   released; Get and Open don't, so their Server may be evicted (closed)
+//   once idle unless it is pinned
+// - r.mu only guards the map: loading, flushing and closing happen outside
+//   it, with later callers waiting on the entry's ready channel
+// ==============================================================================
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Registry errors
+var (
+	ErrDocumentNotFound = errors.New("document not found")
+	ErrDocumentExists   = errors.New("document already exists")
+	ErrInvalidDocID     = errors.New("invalid document ID")
+	ErrDocumentPinned   = errors.New("document is pinned")
+	ErrDocumentInUse    = errors.New("document is in use")
+	ErrRegistryClosed   = errors.New("registry closed")
+)
+
+// docIDPattern restricts document IDs to characters that are safe in URLs
+// and in every Storage backend
+var docIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+// ValidateDocID checks that id is a usable document ID: 1-128 letters,
+// digits, '.', '_' or '-', starting with a letter or digit
+func ValidateDocID(id string) error {
+	if !docIDPattern.MatchString(id) {
+		return fmt.Errorf("%w: %q", ErrInvalidDocID, id)
+	}
+	return nil
+}
+
+// openMode says whether open may load and/or create a document
+type openMode int
+
+const (
+	openAny    openMode = iota // Load, or create if missing
+	openLoad                   // Load; ErrDocumentNotFound if missing
+	openCreate                 // Create; ErrDocumentExists if present
+)
+
+// docEntry is a document in the registry. ready is closed once srv or err
+// is set; until then the document is loading (or being deleted or evicted).
+type docEntry struct {
+	ready chan struct{}
+	srv   *Server
+	err   error
+
+	// Guarded by Registry.mu
+	pinned   bool
+	refs     int           // Acquire calls not yet released
+	released chan struct{} // Closed when refs drops to 0, while Delete waits
+	lastUsed time.Time     // Last open or release
+}
+
+// deleteWait bounds how long Delete waits for Acquire calls to be released
+var deleteWait = 10 * time.Second
+
+// Registry manages the documents of a multi-document server
+type Registry struct {
+	cfg         Config // Template for each document's Server
+	eviction    EvictionConfig
+	storage     Storage
+	ownsStorage bool
+
+	evictCh   chan struct{}
+	stopEvict chan struct{}
+	evictDone chan struct{}
+
+	mu        sync.Mutex
+	docs      map[string]*docEntry
+	closed    bool
+	onUnload  []func(id string)
+	loads     uint64
+	evictions uint64
+}
+
+// NewRegistry creates a registry whose documents are configured like cfg
+// (cfg.DocID is ignored) and evicted according to eviction (the zero
+// value keeps every document loaded). Without cfg.Storage it opens a
+// FileStorage in cfg.StorageDir, which Close closes.
+//
+// Example:
+//
+//	reg, err := server.NewRegistry(
+//	    server.Config{Storage: storage, WASMPath: wasmPath},
+//	    server.EvictionConfig{IdleTTL: 10 * time.Minute},
+//	)
+//	if err != nil { ... }
+//	defer reg.Close(ctx)
+//	notes, err := reg.Create(ctx, "notes")
+//	notes.SetText(ctx, "Hello")
+func NewRegistry(cfg Config, eviction EvictionConfig) (*Registry, error) {
+	if eviction.Interval <= 0 {
+		eviction.Interval = DefaultEvictInterval
+	}
+	r := &Registry{
+		cfg:      cfg,
+		eviction: eviction,
+		storage:  cfg.Storage,
+		docs:     make(map[string]*docEntry),
+		evictCh:  make(chan struct{}, 1),
+	}
+	if r.storage == nil {
+		storage, err := NewFileStorage(cfg.StorageDir)
+		if err != nil {
+			return nil, err
+		}
+		r.storage = storage
+		r.ownsStorage = true
+	}
+	r.cfg.Storage = r.storage
+
+	if eviction.IdleTTL > 0 || eviction.MemoryBudget > 0 {
+		r.startEvictor()
+	}
+	return r, nil
+}
+
+// OnUnload registers fn to be called with the ID of each document that is
+// evicted or deleted, after its Server is closed
+func (r *Registry) OnUnload(fn func(id string)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onUnload = append(r.onUnload, fn)
+}
+
+// unloaded calls the OnUnload hooks
+func (r *Registry) unloaded(id string) {
+	r.mu.Lock()
+	hooks := r.onUnload
+	r.mu.Unlock()
+	for _, fn := range hooks {
+		fn(id)
+	}
+}
+
+// Open returns the document, loading it or creating it as needed
+func (r *Registry) Open(ctx context.Context, id string) (*Server, error) {
+	return r.open(ctx, id, openAny, false)
+}
+
+// Get returns an existing document, loading it on first use
+func (r *Registry) Get(ctx context.Context, id string) (*Server, error) {
+	return r.open(ctx, id, openLoad, false)
+}
+
+// Create creates a new, empty document and stores it
+func (r *Registry) Create(ctx context.Context, id string) (*Server, error) {
+	return r.open(ctx, id, openCreate, false)
+}
+
+// Acquire returns an existing document like Get, and keeps it from being
+// evicted until release is called. Hold it for as long as the Server is
+// used, e.g. for the length of a request or SSE stream.
+//
+// Example:
+//
+//	srv, release, err := reg.Acquire(ctx, "notes")
+//	if err != nil { ... }
+//	defer release()
+func (r *Registry) Acquire(ctx context.Context, id string) (srv *Server, release func(), err error) {
+	e, err := r.entry(ctx, id, openLoad, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	var once sync.Once
+	return e.srv, func() { once.Do(func() { r.release(e) }) }, nil
+}
+
+// release ends an Acquire of e (which may have left the registry meanwhile)
+func (r *Registry) release(e *docEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e.refs--
+	e.lastUsed = time.Now()
+	if e.refs == 0 && e.released != nil {
+		close(e.released)
+		e.released = nil
+	}
+}
+
+// Pin opens the document (creating it if missing) and pins it: it can't be
+// deleted while the registry is open. Pin documents whose Server is held on
+// to, like the default document behind the single-document routes.
+func (r *Registry) Pin(ctx context.Context, id string) (*Server, error) {
+	srv, err := r.open(ctx, id, openAny, false)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e := r.docs[id]; e != nil && e.srv == srv {
+		e.pinned = true
+	}
+	return srv, nil
+}
+
+// open returns the document's Server, loading it if this is the first
+// request for it. Concurrent requests wait for the same load.
+func (r *Registry) open(ctx context.Context, id string, mode openMode, lease bool) (*Server, error) {
+	e, err := r.entry(ctx, id, mode, lease)
+	if err != nil {
+		return nil, err
+	}
+	return e.srv, nil
+}
+
+// entry is open returning the document's entry. lease takes a reference
+// for Acquire.
+func (r *Registry) entry(ctx context.Context, id string, mode openMode, lease bool) (*docEntry, error) {
+	if err := ValidateDocID(id); err != nil {
+		return nil, err
+	}
+
+	for {
+		r.mu.Lock()
+		if r.closed {
+			r.mu.Unlock()
+			return nil, ErrRegistryClosed
+		}
+		e, ok := r.docs[id]
+		if !ok {
+			e = &docEntry{ready: make(chan struct{})}
+			r.docs[id] = e
+			r.mu.Unlock()
+
+			// Other requests wait for this load: don't let this request's
+			// cancellation fail theirs
+			srv, err := r.load(context.WithoutCancel(ctx), id, mode)
+			r.finish(id, e, srv, err)
+			if err != nil {
+				return nil, err
+			}
+			if !r.use(id, e, lease) {
+				// Evicted or deleted already: what we created is stored now
+				if mode == openCreate {
+					mode = openLoad
+				}
+				continue
+			}
+			r.requestEvict()
+			return e, nil
+		}
+		r.mu.Unlock()
+
+		select {
+		case <-e.ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if e.err != nil {
+			// That load (or delete, or eviction) is over and the entry is
+			// gone: try again in our own mode
+			continue
+		}
+		if mode == openCreate {
+			return nil, fmt.Errorf("%w: %s", ErrDocumentExists, id)
+		}
+		if !r.use(id, e, lease) {
+			continue
+		}
+		return e, nil
+	}
+}
+
+// use marks a loaded entry as used (and leased), unless it has left the
+// registry meanwhile
+func (r *Registry) use(id string, e *docEntry, lease bool) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.docs[id] != e {
+		return false
+	}
+	e.lastUsed = time.Now()
+	if lease {
+		e.refs++
+	}
+	return true
+}
+
+// finish publishes the outcome of loading (or deleting) an entry; failed
+// entries leave the map
+func (r *Registry) finish(id string, e *docEntry, srv *Server, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e.srv, e.err = srv, err
+	if err != nil && r.docs[id] == e {
+		delete(r.docs, id)
+	}
+	if srv != nil {
+		e.lastUsed = time.Now()
+		r.loads++
+	}
+	close(e.ready)
+}
+
+// load creates the document's Server from storage
+func (r *Registry) load(ctx context.Context, id string, mode openMode) (*Server, error) {
+	exists, err := r.stored(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case mode == openLoad && !exists:
+		return nil, fmt.Errorf("%w: %s", ErrDocumentNotFound, id)
+	case mode == openCreate && exists:
+		return nil, fmt.Errorf("%w: %s", ErrDocumentExists, id)
+	}
+
+	cfg := r.cfg
+	cfg.DocID = id
+	srv := New(cfg)
+	if err := srv.Initialize(ctx); err != nil {
+		srv.Close(ctx)
+		return nil, fmt.Errorf("failed to load document %s: %w", id, err)
+	}
+	if !exists {
+		// Store the snapshot now, so the document is listed straight away
+		if err := srv.Flush(ctx); err != nil {
+			srv.Close(ctx)
+			return nil, fmt.Errorf("failed to store document %s: %w", id, err)
+		}
+		log.Printf("[%s] Created document %s", r.cfg.UserID, id)
+	}
+	return srv, nil
+}
+
+// stored reports whether the document has anything in storage
+func (r *Registry) stored(ctx context.Context, id string) (bool, error) {
+	keys, err := r.storage.List(ctx, id, "")
+	if err != nil {
+		return false, fmt.Errorf("failed to look up document %s: %w", id, err)
+	}
+	return len(keys) > 0, nil
+}
+
+// List returns the IDs of all documents, stored or loaded, sorted
+func (r *Registry) List(ctx context.Context) ([]string, error) {
+	ids, err := r.storage.Documents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list documents: %w", err)
+	}
+
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		seen[id] = true
+	}
+	r.mu.Lock()
+	for id, e := range r.docs {
+		select {
+		case <-e.ready:
+			if e.err == nil && !seen[id] {
+				ids = append(ids, id)
+			}
+		default:
+			// Still loading or being deleted
+		}
+	}
+	r.mu.Unlock()
+
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Loaded returns the IDs of the documents in memory, sorted
+func (r *Registry) Loaded() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := []string{}
+	for id, e := range r.docs {
+		select {
+		case <-e.ready:
+			if e.err == nil {
+				ids = append(ids, id)
+			}
+		default:
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Delete closes the document and removes everything stored for it.
+// Requests for it wait until the delete is over.
+//
+// A document held by Acquire is closed only once every holder released it:
+// its event subscriptions are ended so streams let go, and other holders
+// get a few seconds (and ctx) to finish. If they don't, Delete fails with
+// ErrDocumentInUse and the document stays.
+func (r *Registry) Delete(ctx context.Context, id string) error {
+	if err := ValidateDocID(id); err != nil {
+		return err
+	}
+
+	// Swap in a placeholder entry so nobody loads the document meanwhile
+	tomb := &docEntry{ready: make(chan struct{})}
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return ErrRegistryClosed
+	}
+	old := r.docs[id]
+	if old != nil && old.pinned {
+		r.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrDocumentPinned, id)
+	}
+	r.docs[id] = tomb
+	r.mu.Unlock()
+
+	if err := r.waitReleased(ctx, id, old); err != nil {
+		// Put the document back before waiters retry
+		r.mu.Lock()
+		closed := r.closed
+		if !closed {
+			r.docs[id] = old
+		}
+		r.mu.Unlock()
+		r.finish(id, tomb, nil, err)
+		if closed {
+			// Close already went by the placeholder: close it here
+			old.srv.Close(context.WithoutCancel(ctx))
+		}
+		return err
+	}
+
+	err := r.delete(context.WithoutCancel(ctx), id, old)
+
+	// Waiters see a failed entry and start over
+	result := err
+	if result == nil {
+		result = fmt.Errorf("%w: %s", ErrDocumentNotFound, id)
+	}
+	r.finish(id, tomb, nil, result)
+	if err == nil {
+		r.unloaded(id)
+	}
+	return err
+}
+
+// waitReleased waits until no Acquire holds the loaded document old (nil if
+// it isn't loaded), ending its event subscriptions so streams let go
+func (r *Registry) waitReleased(ctx context.Context, id string, old *docEntry) error {
+	if old == nil {
+		return nil
+	}
+	select {
+	case <-old.ready:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if old.err != nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	if old.refs == 0 {
+		r.mu.Unlock()
+		return nil
+	}
+	released := make(chan struct{})
+	old.released = released
+	r.mu.Unlock()
+
+	old.srv.endSubscriptions()
+	timer := time.NewTimer(deleteWait)
+	defer timer.Stop()
+	select {
+	case <-released:
+		return nil
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if old.refs == 0 {
+		return nil // Released just now
+	}
+	old.released = nil
+	return fmt.Errorf("%w: %s", ErrDocumentInUse, id)
+}
+
+// delete closes a loaded document and deletes its keys
+func (r *Registry) delete(ctx context.Context, id string, old *docEntry) error {
+	loaded := false
+	if old != nil {
+		<-old.ready
+		if old.err == nil {
+			loaded = true
+			if err := old.srv.Close(ctx); err != nil {
+				log.Printf("Warning: failed to close document %s: %v", id, err)
+			}
+		}
+	}
+
+	keys, err := r.storage.List(ctx, id, "")
+	if err != nil {
+		return fmt.Errorf("failed to list document %s: %w", id, err)
+	}
+	if len(keys) == 0 && !loaded {
+		return fmt.Errorf("%w: %s", ErrDocumentNotFound, id)
+	}
+	for _, key := range keys {
+		if err := r.storage.Delete(ctx, id, key); err != nil {
+			return fmt.Errorf("failed to delete document %s: %w", id, err)
+		}
+	}
+	log.Printf("[%s] Deleted document %s", r.cfg.UserID, id)
+	return nil
+}
+
+// CloseSubscriptions ends the event subscriptions of every loaded document
+// (see Server.CloseSubscriptions)
+func (r *Registry) CloseSubscriptions() {
+	r.mu.Lock()
+	var servers []*Server
+	for _, e := range r.docs {
+		select {
+		case <-e.ready:
+			if e.err == nil {
+				servers = append(servers, e.srv)
+			}
+		default:
+		}
+	}
+	r.mu.Unlock()
+
+	for _, srv := range servers {
+		srv.CloseSubscriptions()
+	}
+}
+
+// Close flushes and closes every loaded document, then the storage if the
+// registry opened it
+func (r *Registry) Close(ctx context.Context) error {
+	r.stopEvictor()
+
+	r.mu.Lock()
+	r.closed = true
+	entries := make([]*docEntry, 0, len(r.docs))
+	for _, e := range r.docs {
+		entries = append(entries, e)
+	}
+	r.docs = make(map[string]*docEntry)
+	r.mu.Unlock()
+
+	var firstErr error
+	for _, e := range entries {
+		<-e.ready
+		if e.err != nil {
+			continue
+		}
+		if err := e.srv.Close(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if r.ownsStorage {
+		if err := r.storage.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+)
+
+// newTestRegistry returns a registry over a fresh MemoryStorage
+func newTestRegistry(t *testing.T) (*Registry, Storage) {
+	t.Helper()
+	storage := NewMemoryStorage()
+	reg, err := NewRegistry(Config{
+		Storage:       storage,
+		UserID:        "test-user",
+		WASMPath:      automerge.TestWASMPath,
+		FlushInterval: time.Hour,
+	}, EvictionConfig{})
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+	t.Cleanup(func() { reg.Close(context.Background()) })
+	return reg, storage
+}
+
+func TestValidateDocID(t *testing.T) {
+	for _, id := range []string{"default", "notes", "a", "Team-42_draft.v2"} {
+		if err := ValidateDocID(id); err != nil {
+			t.Errorf("ValidateDocID(%q) error = %v", id, err)
+		}
+	}
+	long := string(make([]byte, 129))
+	for _, id := range []string{"", ".hidden", "-x", "a/b", "a b", "ü", long} {
+		if err := ValidateDocID(id); !errors.Is(err, ErrInvalidDocID) {
+			t.Errorf("ValidateDocID(%q) error = %v, want ErrInvalidDocID", id, err)
+		}
+	}
+}
+
+// TestRegistry_Missing covers the paths that never load a document
+func TestRegistry_Missing(t *testing.T) {
+	ctx := context.Background()
+	reg, _ := newTestRegistry(t)
+
+	if _, err := reg.Get(ctx, "missing"); !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("Get() error = %v, want ErrDocumentNotFound", err)
+	}
+	if err := reg.Delete(ctx, "missing"); !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("Delete() error = %v, want ErrDocumentNotFound", err)
+	}
+	if _, err := reg.Create(ctx, "../x"); !errors.Is(err, ErrInvalidDocID) {
+		t.Errorf("Create() error = %v, want ErrInvalidDocID", err)
+	}
+	if ids, err := reg.List(ctx); err != nil || len(ids) != 0 {
+		t.Errorf("List() = %v, %v; want none", ids, err)
+	}
+	if loaded := reg.Loaded(); len(loaded) != 0 {
+		t.Errorf("Loaded() = %v, want none", loaded)
+	}
+
+	reg.Close(ctx)
+	if _, err := reg.Open(ctx, "notes"); !errors.Is(err, ErrRegistryClosed) {
+		t.Errorf("Open() after Close() error = %v, want ErrRegistryClosed", err)
+	}
+}
+
+func TestRegistry_Lifecycle(t *testing.T) {
+	ctx := context.Background()
+	reg, storage := newTestRegistry(t)
+
+	notes, err := reg.Create(ctx, "notes")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if _, err := reg.Create(ctx, "notes"); !errors.Is(err, ErrDocumentExists) {
+		t.Errorf("second Create() error = %v, want ErrDocumentExists", err)
+	}
+
+	// Created documents are stored straight away
+	if ids, _ := storage.Documents(ctx); !reflect.DeepEqual(ids, []string{"notes"}) {
+		t.Errorf("stored documents = %v, want [notes]", ids)
+	}
+
+	// Documents are independent
+	todo, _ := reg.Open(ctx, "todo")
+	notes.SetText(ctx, "notes text")
+	todo.SetText(ctx, "todo text")
+	if text, _ := notes.GetText(ctx); text != "notes text" {
+		t.Errorf("notes text = %q", text)
+	}
+
+	// Get returns the loaded Server
+	if again, _ := reg.Get(ctx, "notes"); again != notes {
+		t.Error("Get() returned a different Server for a loaded document")
+	}
+	if ids, _ := reg.List(ctx); !reflect.DeepEqual(ids, []string{"notes", "todo"}) {
+		t.Errorf("List() = %v, want [notes todo]", ids)
+	}
+
+	if err := reg.Delete(ctx, "notes"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := reg.Get(ctx, "notes"); !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("Get() after Delete() error = %v, want ErrDocumentNotFound", err)
+	}
+	if keys, _ := storage.List(ctx, "notes", ""); len(keys) != 0 {
+		t.Errorf("keys left after Delete() = %v", keys)
+	}
+
+	// A new registry loads what the old one stored
+	reg.Close(ctx)
+	reg2, err := NewRegistry(Config{Storage: storage, UserID: "test-user", WASMPath: automerge.TestWASMPath}, EvictionConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reg2.Close(ctx)
+	todo2, err := reg2.Get(ctx, "todo")
+	if err != nil {
+		t.Fatalf("Get() after restart error = %v", err)
+	}
+	if text, _ := todo2.GetText(ctx); text != "todo text" {
+		t.Errorf("todo text after restart = %q, want %q", text, "todo text")
+	}
+}
+
+func TestRegistry_Pin(t *testing.T) {
+	ctx := context.Background()
+	reg, _ := newTestRegistry(t)
+
+	if _, err := reg.Pin(ctx, DefaultDocID); err != nil {
+		t.Fatalf("Pin() error = %v", err)
+	}
+	if err := reg.Delete(ctx, DefaultDocID); !errors.Is(err, ErrDocumentPinned) {
+		t.Errorf("Delete() of a pinned document error = %v, want ErrDocumentPinned", err)
+	}
+}
+
+// TestRegistry_DeleteAcquired checks Delete waits for Acquire holders, and
+// leaves the document alone if they don't let go in time
+func TestRegistry_DeleteAcquired(t *testing.T) {
+	ctx := context.Background()
+	reg, _ := newTestRegistry(t)
+	defer func(wait time.Duration) { deleteWait = wait }(deleteWait)
+	deleteWait = 50 * time.Millisecond
+
+	if _, err := reg.Create(ctx, "notes"); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	// A holder that never lets go: the document stays usable
+	srv, release, err := reg.Acquire(ctx, "notes")
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	sub := srv.Subscribe(0)
+	if err := reg.Delete(ctx, "notes"); !errors.Is(err, ErrDocumentInUse) {
+		t.Fatalf("Delete() error = %v, want ErrDocumentInUse", err)
+	}
+	if _, ok := <-sub.C; ok {
+		t.Error("subscription open after Delete()")
+	}
+	if err := srv.SetText(ctx, "still here"); err != nil {
+		t.Errorf("SetText() after a failed Delete() error = %v", err)
+	}
+	if got, err := reg.Get(ctx, "notes"); err != nil || got != srv {
+		t.Errorf("Get() after a failed Delete() = %p, %v; want %p", got, err, srv)
+	}
+
+	// A holder that lets go while Delete waits
+	deleteWait = 5 * time.Second
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		release()
+	}()
+	if err := reg.Delete(ctx, "notes"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := reg.Get(ctx, "notes"); !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("Get() after Delete() error = %v, want ErrDocumentNotFound", err)
+	}
+}
+
+// TestRegistry_ConcurrentOpen checks concurrent requests share one load
+func TestRegistry_ConcurrentOpen(t *testing.T) {
+	ctx := context.Background()
+	reg, _ := newTestRegistry(t)
+
+	servers := make([]*Server, 8)
+	var wg sync.WaitGroup
+	for i := range servers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			srv, err := reg.Open(ctx, "shared")
+			if err != nil {
+				t.Errorf("Open() error = %v", err)
+			}
+			servers[i] = srv
+		}(i)
+	}
+	wg.Wait()
+
+	for _, srv := range servers[1:] {
+		if srv != servers[0] {
+			t.Fatal("concurrent Open() calls loaded the document more than once")
+		}
+	}
+}
@@ -0,0 +1,315 @@
+// ==============================================================================
+// Layer 5: Go Server - Read Replicas
+// ==============================================================================
+// ARCHITECTURE: This is the stateful server layer (Layer 5/7).
+//
+// RESPONSIBILITIES:
+// - Keep an optional pool of read-only copies of the document, each in its
+//   own WASM instance
+// - Fork a replica from a snapshot of the primary on first use
+// - Bring a replica up to date by applying the primary's changes since its
+//   heads, once it is older than ReplicaMaxLag
+// - Serve heavy reads (snapshot download, text, JSON and rich text export)
+//   and report the heads each read saw
+//
+// DEPENDENCIES:
+// - pkg/server/actor.go (the primary's snapshot and changes are taken on
+//   the document goroutine)
+// - pkg/automerge (Save, LoadWithWASM, GetChanges, LoadIncremental)
+//
+// DEPENDENTS:
+// - pkg/api/handlers.go (GET /api/doc, GET /api/text, GET /api/json)
+// - pkg/api/crdt_richtext.go (GET /api/richtext/export)
+//
+// NOTES:
+// - Reads on a replica run off the document goroutine, in parallel with
+//   writes and with reads on the other replicas; the primary only hands
+//   over the changes a replica is missing
+// - A read sees the primary as it was at most ReplicaMaxLag ago (negative:
+//   as it is now); the heads in ReadInfo say exactly which state it saw
+// - Without replicas (Config.Replicas 0) the Read* methods run on the
+//   primary, so callers don't need to care whether replicas are configured
+// - Replicas are never written to, and a replica that fails to apply the
+//   primary's changes is forked again
+// ==============================================================================
+
+package server
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+)
+
+// DefaultReplicaMaxLag is how stale a replica may be before a read brings
+// it up to date
+const DefaultReplicaMaxLag = time.Second
+
+// ReadInfo says which copy of the document served a read
+type ReadInfo struct {
+	Heads   []automerge.ChangeHash // Heads of the state the read saw
+	Replica bool                   // Served by a read replica, not the primary
+}
+
+// ReplicaStats describes a document's read replicas
+type ReplicaStats struct {
+	Replicas  int           // Configured replicas (Config.Replicas)
+	Loaded    int           // Replicas forked so far
+	MaxLag    time.Duration // Config.ReplicaMaxLag
+	Reads     uint64        // Reads served by replicas
+	Refreshes uint64        // Times a replica applied the primary's changes
+	Forks     uint64        // Times a replica was forked from the primary
+}
+
+// replica is a read-only copy of the document. Whoever took it from
+// Server.replicas owns it until putReplica.
+type replica struct {
+	doc      *automerge.Document // nil until first use
+	heads    []automerge.ChangeHash
+	syncedAt time.Time // The primary was at heads (or later) at this time
+	mem      int64     // WASM memory counted in Server.replicaBytes
+}
+
+// replicaMetrics are updated atomically by readers
+type replicaMetrics struct {
+	loaded    atomic.Int64
+	reads     atomic.Uint64
+	refreshes atomic.Uint64
+	forks     atomic.Uint64
+}
+
+// initReplicas creates the (not yet forked) replicas (called from New)
+func (s *Server) initReplicas(n int, maxLag time.Duration) {
+	s.replicaMaxLag = maxLag
+	if n <= 0 {
+		return
+	}
+	s.replicas = make(chan *replica, n)
+	s.replicasClosed = make(chan struct{})
+	for i := 0; i < n; i++ {
+		s.replicas <- &replica{}
+	}
+}
+
+// read runs fn on an up-to-date replica, or on the primary without
+// replicas, and returns its result with the heads it saw
+func read[T any](ctx context.Context, s *Server, fn func(doc *automerge.Document) (T, error)) (T, ReadInfo, error) {
+	var zero T
+	if s.replicas == nil {
+		var info ReadInfo
+		result, err := call(ctx, s, func() (T, error) {
+			result, err := fn(s.doc)
+			if err != nil {
+				return zero, err
+			}
+			info.Heads, err = s.doc.GetHeads(ctx)
+			return result, err
+		})
+		return result, info, err
+	}
+
+	r, err := s.takeReplica(ctx)
+	if err != nil {
+		return zero, ReadInfo{}, err
+	}
+	defer s.putReplica(r)
+
+	if err := s.syncReplica(ctx, r); err != nil {
+		return zero, ReadInfo{}, err
+	}
+	result, err := fn(r.doc)
+	if err != nil {
+		return zero, ReadInfo{}, err
+	}
+	s.replicaMetrics.reads.Add(1)
+	return result, ReadInfo{Heads: r.heads, Replica: true}, nil
+}
+
+// takeReplica waits for an idle replica
+func (s *Server) takeReplica(ctx context.Context) (*replica, error) {
+	select {
+	case <-s.replicasClosed:
+		return nil, ErrServerClosed
+	default:
+	}
+	select {
+	case r := <-s.replicas:
+		return r, nil
+	case <-s.replicasClosed:
+		return nil, ErrServerClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// putReplica returns a replica to the pool
+func (s *Server) putReplica(r *replica) {
+	var mem int64
+	if r.doc != nil {
+		mem = int64(r.doc.MemorySize())
+	}
+	s.replicaBytes.Add(mem - r.mem)
+	r.mem = mem
+	s.replicas <- r // Never blocks: the pool has room for every replica
+}
+
+// syncReplica forks the replica if it has no document yet, and applies the
+// primary's changes since its heads if it is older than ReplicaMaxLag
+func (s *Server) syncReplica(ctx context.Context, r *replica) error {
+	if r.doc == nil {
+		return s.forkReplica(ctx, r)
+	}
+	if time.Since(r.syncedAt) <= s.replicaMaxLag {
+		return nil
+	}
+
+	var at time.Time
+	changes, err := call(ctx, s, func() ([]byte, error) {
+		at = time.Now()
+		return s.doc.GetChanges(ctx, r.heads)
+	})
+	if err != nil {
+		return err
+	}
+	if len(changes) > 0 {
+		heads, err := applyToReplica(ctx, r.doc, changes)
+		if err != nil {
+			log.Printf("Warning: read replica of document %s failed to apply changes, forking it again: %v", s.docID, err)
+			s.dropReplica(ctx, r)
+			return s.forkReplica(ctx, r)
+		}
+		r.heads = heads
+		s.replicaMetrics.refreshes.Add(1)
+	}
+	r.syncedAt = at
+	return nil
+}
+
+// applyToReplica applies changes to a replica and returns its new heads
+func applyToReplica(ctx context.Context, doc *automerge.Document, changes []byte) ([]automerge.ChangeHash, error) {
+	if err := doc.LoadIncremental(ctx, changes); err != nil {
+		return nil, err
+	}
+	return doc.GetHeads(ctx)
+}
+
+// forkReplica loads a replica from a snapshot of the primary
+func (s *Server) forkReplica(ctx context.Context, r *replica) error {
+	var at time.Time
+	data, err := call(ctx, s, func() ([]byte, error) {
+		// Save moves the incremental-save mark: hand any unsaved changes
+		// to the persister first, as every mutation does
+		if err := s.saveDocument(ctx); err != nil {
+			return nil, err
+		}
+		at = time.Now()
+		return s.doc.Save(ctx)
+	})
+	if err != nil {
+		return err
+	}
+
+	doc, err := automerge.LoadWithWASM(ctx, data, s.wasmPath)
+	if err != nil {
+		return err
+	}
+	heads, err := doc.GetHeads(ctx)
+	if err != nil {
+		doc.Close(ctx)
+		return err
+	}
+	r.doc, r.heads, r.syncedAt = doc, heads, at
+	s.replicaMetrics.loaded.Add(1)
+	s.replicaMetrics.forks.Add(1)
+	return nil
+}
+
+// dropReplica closes a replica's document; it is forked again on next use
+func (s *Server) dropReplica(ctx context.Context, r *replica) {
+	if r.doc == nil {
+		return
+	}
+	if err := r.doc.Close(ctx); err != nil {
+		log.Printf("Warning: failed to close read replica of document %s: %v", s.docID, err)
+	}
+	r.doc, r.heads = nil, nil
+	s.replicaMetrics.loaded.Add(-1)
+}
+
+// closeReplicas waits for reads on the replicas to finish and closes them
+// (called from Close; safe to call more than once)
+func (s *Server) closeReplicas(ctx context.Context) {
+	if s.replicas == nil {
+		return
+	}
+	s.replicasCloseOnce.Do(func() {
+		close(s.replicasClosed)
+		for i := 0; i < cap(s.replicas); i++ {
+			r := <-s.replicas
+			s.dropReplica(ctx, r)
+			s.replicaBytes.Add(-r.mem)
+			r.mem = 0
+		}
+	})
+}
+
+// ReplicaStats returns the state of the document's read replicas
+func (s *Server) ReplicaStats() ReplicaStats {
+	return ReplicaStats{
+		Replicas:  cap(s.replicas),
+		Loaded:    int(s.replicaMetrics.loaded.Load()),
+		MaxLag:    s.replicaMaxLag,
+		Reads:     s.replicaMetrics.reads.Load(),
+		Refreshes: s.replicaMetrics.refreshes.Load(),
+		Forks:     s.replicaMetrics.forks.Load(),
+	}
+}
+
+// replicaStatus reports the replicas for readiness probes
+func (s *Server) replicaStatus() map[string]interface{} {
+	stats := s.ReplicaStats()
+	return map[string]interface{}{
+		"replicas":     stats.Replicas,
+		"loaded":       stats.Loaded,
+		"max_lag_ms":   stats.MaxLag.Milliseconds(),
+		"reads":        stats.Reads,
+		"refreshes":    stats.Refreshes,
+		"forks":        stats.Forks,
+		"memory_bytes": s.replicaBytes.Load(),
+	}
+}
+
+// ReadSnapshot returns the document as bytes, like GetSnapshot, from a read
+// replica if there are any
+func (s *Server) ReadSnapshot(ctx context.Context) ([]byte, ReadInfo, error) {
+	return read(ctx, s, func(doc *automerge.Document) ([]byte, error) {
+		return doc.Save(ctx)
+	})
+}
+
+// ReadText returns the text, like GetText, from a read replica if there
+// are any
+func (s *Server) ReadText(ctx context.Context) (string, ReadInfo, error) {
+	return read(ctx, s, func(doc *automerge.Document) (string, error) {
+		return doc.GetText(ctx, automerge.Root().Get("content"))
+	})
+}
+
+// ReadJSON returns the value at path as plain Go values (maps, slices,
+// strings, numbers…), from a read replica if there are any
+func (s *Server) ReadJSON(ctx context.Context, path automerge.Path) (interface{}, ReadInfo, error) {
+	return read(ctx, s, func(doc *automerge.Document) (interface{}, error) {
+		return doc.GetJSON(ctx, path)
+	})
+}
+
+// ReadRichTextSpans returns the rich text at path as spans, like
+// GetRichTextSpans, from a read replica if there are any
+func (s *Server) ReadRichTextSpans(ctx context.Context, path automerge.Path) ([]automerge.Span, ReadInfo, error) {
+	return read(ctx, s, func(doc *automerge.Document) ([]automerge.Span, error) {
+		return doc.Spans(ctx, path)
+	})
+}
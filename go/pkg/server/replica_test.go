@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+)
+
+// newReplicaServer starts a server with read replicas
+func newReplicaServer(t *testing.T, replicas int, maxLag time.Duration) *Server {
+	t.Helper()
+	s := New(Config{
+		StorageDir:    t.TempDir(),
+		UserID:        "test-user",
+		WASMPath:      automerge.TestWASMPath,
+		FlushInterval: time.Hour,
+		Replicas:      replicas,
+		ReplicaMaxLag: maxLag,
+	})
+	t.Cleanup(func() { s.Close(context.Background()) })
+	if err := s.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	return s
+}
+
+// readText reads the text through ReadText
+func readText(t *testing.T, s *Server) (string, ReadInfo) {
+	t.Helper()
+	text, info, err := s.ReadText(context.Background())
+	if err != nil {
+		t.Fatalf("ReadText() error = %v", err)
+	}
+	return text, info
+}
+
+// heads returns the primary's heads
+func heads(t *testing.T, s *Server) []automerge.ChangeHash {
+	t.Helper()
+	heads, err := call(context.Background(), s, func() ([]automerge.ChangeHash, error) {
+		return s.doc.GetHeads(context.Background())
+	})
+	if err != nil {
+		t.Fatalf("GetHeads() error = %v", err)
+	}
+	return heads
+}
+
+// TestServer_ReplicasClosed covers replicas that were never forked
+func TestServer_ReplicasClosed(t *testing.T) {
+	ctx := context.Background()
+	s := New(Config{Storage: NewMemoryStorage(), Replicas: 2})
+	if stats := s.ReplicaStats(); stats.Replicas != 2 || stats.Loaded != 0 || stats.MaxLag != DefaultReplicaMaxLag {
+		t.Errorf("ReplicaStats() = %+v, want 2 replicas, none loaded, default lag", stats)
+	}
+
+	if err := s.Close(ctx); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := s.Close(ctx); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+	if _, _, err := s.ReadText(ctx); !errors.Is(err, ErrServerClosed) {
+		t.Errorf("ReadText() after Close() error = %v, want ErrServerClosed", err)
+	}
+}
+
+func TestServer_ReadWithoutReplicas(t *testing.T) {
+	s := newReplicaServer(t, 0, 0)
+	if err := s.SetText(context.Background(), "primary"); err != nil {
+		t.Fatalf("SetText() error = %v", err)
+	}
+
+	text, info := readText(t, s)
+	if text != "primary" || info.Replica {
+		t.Errorf("ReadText() = %q, replica %v; want %q from the primary", text, info.Replica, "primary")
+	}
+	if !reflect.DeepEqual(info.Heads, heads(t, s)) {
+		t.Errorf("ReadText() heads = %v, want the primary's %v", info.Heads, heads(t, s))
+	}
+}
+
+// TestServer_ReplicaFollowsPrimary checks a replica with no allowed lag
+// sees every write
+func TestServer_ReplicaFollowsPrimary(t *testing.T) {
+	ctx := context.Background()
+	s := newReplicaServer(t, 1, -1)
+
+	for _, want := range []string{"one", "two", "three"} {
+		if err := s.SetText(ctx, want); err != nil {
+			t.Fatalf("SetText() error = %v", err)
+		}
+		text, info := readText(t, s)
+		if text != want || !info.Replica {
+			t.Errorf("ReadText() = %q, replica %v; want %q from a replica", text, info.Replica, want)
+		}
+		if !reflect.DeepEqual(info.Heads, heads(t, s)) {
+			t.Errorf("ReadText() heads = %v, want the primary's %v", info.Heads, heads(t, s))
+		}
+	}
+
+	value, _, err := s.ReadJSON(ctx, automerge.Root())
+	if err != nil {
+		t.Fatalf("ReadJSON() error = %v", err)
+	}
+	if got := value.(map[string]interface{})["content"]; got != "three" {
+		t.Errorf("ReadJSON() content = %v, want %q", got, "three")
+	}
+
+	stats := s.ReplicaStats()
+	if stats.Forks != 1 || stats.Refreshes != 2 || stats.Reads != 4 || stats.Loaded != 1 {
+		t.Errorf("ReplicaStats() = %+v, want 1 fork, 2 refreshes, 4 reads", stats)
+	}
+	if ready, details := s.IsReady(); !ready || details["replicas"] == nil {
+		t.Errorf("IsReady() = %v, %v; want ready with replica details", ready, details)
+	}
+}
+
+// TestServer_ReplicaStaleness checks a replica serves its state until it
+// is older than ReplicaMaxLag
+func TestServer_ReplicaStaleness(t *testing.T) {
+	ctx := context.Background()
+	s := newReplicaServer(t, 1, time.Hour)
+
+	s.SetText(ctx, "before")
+	before := heads(t, s)
+	readText(t, s) // Forks the replica
+
+	s.SetText(ctx, "after")
+	text, info := readText(t, s)
+	if text != "before" || !reflect.DeepEqual(info.Heads, before) {
+		t.Errorf("ReadText() within the lag = %q at %v, want %q at %v", text, info.Heads, "before", before)
+	}
+
+	s.replicaMaxLag = -1 // Now past the lag
+	text, info = readText(t, s)
+	if text != "after" || !reflect.DeepEqual(info.Heads, heads(t, s)) {
+		t.Errorf("ReadText() past the lag = %q, want %q at the primary's heads", text, "after")
+	}
+
+	// Snapshots from a replica load like the primary's
+	data, _, err := s.ReadSnapshot(ctx)
+	if err != nil {
+		t.Fatalf("ReadSnapshot() error = %v", err)
+	}
+	doc, err := automerge.LoadWithWASM(ctx, data, automerge.TestWASMPath)
+	if err != nil {
+		t.Fatalf("LoadWithWASM() error = %v", err)
+	}
+	defer doc.Close(ctx)
+	if got, _ := doc.GetText(ctx, automerge.Root().Get("content")); got != "after" {
+		t.Errorf("snapshot text = %q, want %q", got, "after")
+	}
+
+	// Replica memory counts towards the document's
+	primary, _ := call(ctx, s, func() (int64, error) { return int64(s.doc.MemorySize()), nil })
+	if mem := s.MemoryBytes(); mem <= primary {
+		t.Errorf("MemoryBytes() = %d, want more than the primary's %d", mem, primary)
+	}
+}
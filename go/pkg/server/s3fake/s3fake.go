@@ -0,0 +1,258 @@
+// Package s3fake is an in-process S3 server for tests, so S3Storage can be
+// tested without network access or credentials.
+//
+// It implements the subset of the API that server.S3Storage uses, with
+// path-style addressing: PutObject, GetObject, DeleteObject and
+// ListObjectsV2 (prefix, delimiter, pagination). It checks that requests are
+// signed with the expected access key and that the payload hash matches the
+// body, and it can inject failures to exercise retries.
+//
+// Example:
+//
+//	fake := s3fake.New()
+//	defer fake.Close()
+//	fake.CreateBucket("docs")
+//	storage, _ := server.NewS3Storage(server.S3Config{
+//	    Endpoint:        fake.URL,
+//	    Bucket:          "docs",
+//	    AccessKeyID:     fake.AccessKeyID,
+//	    SecretAccessKey: "secret",
+//	    PathStyle:       true,
+//	})
+package s3fake
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Server is a fake S3 endpoint
+type Server struct {
+	// URL is the endpoint to configure clients with
+	URL string
+
+	// AccessKeyID is the only access key the server accepts
+	AccessKeyID string
+
+	// MaxKeys caps the keys per ListObjectsV2 page (default: 1000), so
+	// tests can force pagination
+	MaxKeys int
+
+	http *httptest.Server
+
+	mu       sync.Mutex
+	buckets  map[string]map[string][]byte
+	failures []int // Status codes for the next requests
+	requests int
+}
+
+// New starts a fake S3 server with no buckets
+func New() *Server {
+	s := &Server{
+		AccessKeyID: "fake-access-key",
+		MaxKeys:     1000,
+		buckets:     make(map[string]map[string][]byte),
+	}
+	s.http = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.http.URL
+	return s
+}
+
+// Close shuts the server down
+func (s *Server) Close() {
+	s.http.Close()
+}
+
+// CreateBucket creates an empty bucket (no-op if it exists)
+func (s *Server) CreateBucket(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.buckets[name] == nil {
+		s.buckets[name] = make(map[string][]byte)
+	}
+}
+
+// Objects returns the object keys in bucket, sorted
+func (s *Server) Objects(bucket string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.buckets[bucket]))
+	for key := range s.buckets[bucket] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// FailNext makes the next n requests fail with status (503 answers
+// SlowDown, like S3 under load)
+func (s *Server) FailNext(n, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.failures = append(s.failures, status)
+	}
+}
+
+// Requests returns the number of requests received, failed ones included
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+
+	if len(s.failures) > 0 {
+		status := s.failures[0]
+		s.failures = s.failures[1:]
+		code := "InternalError"
+		if status == http.StatusServiceUnavailable {
+			code = "SlowDown"
+		}
+		writeError(w, status, code, "injected failure")
+		return
+	}
+
+	if !strings.Contains(r.Header.Get("Authorization"), "Credential="+s.AccessKeyID+"/") {
+		writeError(w, http.StatusForbidden, "InvalidAccessKeyId", "unknown access key")
+		return
+	}
+	sum := sha256.Sum256(body)
+	if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+		writeError(w, http.StatusBadRequest, "XAmzContentSHA256Mismatch", "payload hash mismatch")
+		return
+	}
+
+	// Path-style: /<bucket>/<key>
+	bucketName, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	bucket := s.buckets[bucketName]
+	if bucket == nil {
+		writeError(w, http.StatusNotFound, "NoSuchBucket", "bucket "+bucketName+" does not exist")
+		return
+	}
+
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		s.list(w, r, bucket)
+	case key == "":
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method+" on a bucket")
+	case r.Method == http.MethodPut:
+		bucket[key] = body
+	case r.Method == http.MethodGet:
+		data, ok := bucket[key]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey", "key "+key+" does not exist")
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Write(data)
+	case r.Method == http.MethodDelete:
+		delete(bucket, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method+" on an object")
+	}
+}
+
+// listResult is a ListObjectsV2 response
+type listResult struct {
+	XMLName               xml.Name       `xml:"ListBucketResult"`
+	Prefix                string         `xml:"Prefix"`
+	KeyCount              int            `xml:"KeyCount"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	Contents              []listObject   `xml:"Contents"`
+	CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+}
+
+type listObject struct {
+	Key  string `xml:"Key"`
+	Size int    `xml:"Size"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// list answers ListObjectsV2 (assumes s.mu is held). The continuation token
+// is the last key or common prefix of the previous page.
+func (s *Server) list(w http.ResponseWriter, r *http.Request, bucket map[string][]byte) {
+	query := r.URL.Query()
+	if query.Get("list-type") != "2" {
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "only ListObjectsV2 is supported")
+		return
+	}
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	after := query.Get("continuation-token")
+
+	keys := make([]string, 0, len(bucket))
+	for key := range bucket {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	result := listResult{Prefix: prefix}
+	last := ""
+	for _, key := range keys {
+		entry := key
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				entry = key[:len(prefix)+i+len(delimiter)]
+			}
+		}
+		if entry <= after || entry == last {
+			continue
+		}
+		if result.KeyCount == s.MaxKeys {
+			result.IsTruncated = true
+			result.NextContinuationToken = last
+			break
+		}
+
+		if entry == key {
+			result.Contents = append(result.Contents, listObject{Key: key, Size: len(bucket[key])})
+		} else {
+			result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{Prefix: entry})
+		}
+		result.KeyCount++
+		last = entry
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	fmt.Fprint(w, xml.Header)
+	xml.NewEncoder(w).Encode(result)
+}
+
+// writeError writes an S3 error response
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprint(w, xml.Header)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string   `xml:"Code"`
+		Message string   `xml:"Message"`
+	}{Code: code, Message: message})
+}
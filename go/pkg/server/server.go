@@ -2,23 +2,99 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"os"
-	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
 )
 
-// Server manages the Automerge document and SSE client connections
+// Server manages the Automerge document and its change subscribers.
+//
+// The document is owned by one goroutine that runs the Server's operations
+// in order (see actor.go); the fields marked "owned by the document
+// goroutine" are only touched from there.
 type Server struct {
-	doc        *automerge.Document
-	mu         sync.RWMutex
-	clients    []chan string
+	doc        *automerge.Document // Owned by the document goroutine
 	storageDir string
 	userID     string
 	wasmPath   string
+	actors     map[string]string // actor ID → user ID (see crdt_blame.go); owned by the document goroutine
+
+	// Actors (see crdt_blame.go); owned by the document goroutine
+	ownActor   string            // This server's own actor
+	actor      string            // The actor the document makes changes with now
+	userActors map[string]string // user ID → the actor made for them
+
+	// Sync peers (see crdt_sync.go); owned by the document goroutine
+	syncPeers    map[string]*automerge.SyncState // peer ID → its sync state
+	syncPeerIDs  map[*automerge.SyncState]string // and back
+	syncPeerUsed map[string]time.Time            // peer ID → when its state was last used
+	syncPeerIdle time.Duration
+
+	// Change event subscribers (see events.go)
+	subsMu     sync.Mutex
+	subs       []*Subscription
+	subsClosed bool
+	eventHeads []automerge.ChangeHash // Heads of the last event; owned by the document goroutine
+
+	// Event log for resuming subscribers (guarded by subsMu)
+	eventEpoch       string // Set by New
+	eventSeq         uint64 // Last event's sequence number
+	eventLog         []Event
+	eventLogFrom     uint64 // The log holds every event after this one
+	eventLogSize     int
+	resumeWindow     time.Duration
+	lastUnsubscribed time.Time
+	resyncAfter      time.Duration // See delivery.go
+	eventMetrics     eventMetrics
+
+	// Document goroutine (see actor.go)
+	ops         chan *op
+	opsStop     chan struct{}
+	opsStopOnce sync.Once
+	opsDone     chan struct{}
+	metrics     queueMetrics
+
+	// Read replicas (see replica.go)
+	replicas          chan *replica // Idle replicas; nil without replicas
+	replicasClosed    chan struct{}
+	replicasCloseOnce sync.Once
+	replicaMaxLag     time.Duration
+	replicaBytes      atomic.Int64
+	replicaMetrics    replicaMetrics
+
+	// Persistence (see persister.go, snapshot.go and storage.go)
+	storage        Storage
+	ownsStorage    bool // Created by Initialize, so closed by Close
+	docID          string
+	persistMu      sync.Mutex // Serializes disk writes
+	chunkSeq       uint64     // Next change chunk (guarded by persistMu)
+	chunkBytes     int64      // Stored change chunk bytes (guarded by persistMu)
+	chunkCount     int        // Stored change chunks (guarded by persistMu)
+	compactBytes   int64
+	compactChanges int
+	backups        int
+	flushInterval  time.Duration
+	maxDirty       int
+	flushCh        chan struct{}
+	stopPersist    chan struct{}
+	persistDone    chan struct{}
+
+	// Owned by the document goroutine
+	pending      [][]byte // Change chunks not yet written
+	dirty        int      // Saves not yet written
+	dirtySince   time.Time
+	lastFlush    time.Time
+	persistErr   error
+	replayErr    error           // Why change chunks were set aside at startup
+	needsCompact bool            // The stored chunks are missing changes: write a full snapshot next
+	dirtyKeys    map[string]bool // Keys rewritten whole when they change (actors.json, sync.<peer>) not yet written
 }
 
 // Config holds server configuration
@@ -26,41 +102,259 @@ type Config struct {
 	StorageDir string
 	UserID     string
 	WASMPath   string
+
+	// Storage persists the document (default: a FileStorage in StorageDir)
+	Storage Storage
+
+	// DocID is the document's ID in Storage (default: DefaultDocID)
+	DocID string
+
+	// CompactBytes and CompactChanges bound the change chunks: once there
+	// are this many bytes or chunks, the document is compacted into a fresh
+	// snapshot (defaults: DefaultCompactBytes, DefaultCompactChanges)
+	CompactBytes   int64
+	CompactChanges int
+
+	// Backups is how many previous snapshots to keep as snapshot.1 …
+	// snapshot.N, for startup to fall back to if the snapshot is damaged
+	// (0: DefaultBackups, negative: none)
+	Backups int
+
+	// FlushInterval is how often the persister writes queued changes
+	// (default: DefaultFlushInterval)
+	FlushInterval time.Duration
+
+	// MaxDirtyChanges flushes early once this many saves are queued
+	// (default: DefaultMaxDirtyChanges)
+	MaxDirtyChanges int
+
+	// QueueSize is how many operations may wait for the document before
+	// further ones fail with ErrQueueFull (default: DefaultQueueSize)
+	QueueSize int
+
+	// Replicas is how many read-only copies of the document serve the
+	// Read* methods, off the document goroutine (default: 0, reads run on
+	// the document)
+	Replicas int
+
+	// ReplicaMaxLag is how stale a replica may be before a read brings it
+	// up to date (default: DefaultReplicaMaxLag, negative: on every read)
+	ReplicaMaxLag time.Duration
+
+	// EventLogSize is how many recent events are kept for subscribers that
+	// resume (default: DefaultEventLogSize, negative: none)
+	EventLogSize int
+
+	// ResumeWindow is how long after the last subscriber leaves events are
+	// still recorded, for it to resume (default: DefaultResumeWindow,
+	// negative: only while subscribed)
+	ResumeWindow time.Duration
+
+	// ResyncAfter is how long a subscriber may stay behind before the
+	// events it is waiting for are replaced by a resync event (default:
+	// DefaultResyncAfter, negative: only once it is a full buffer behind)
+	ResyncAfter time.Duration
+
+	// SyncPeerIdleTTL is how long a sync peer's state stays in memory
+	// unused once it is persisted (default: DefaultSyncPeerIdleTTL)
+	SyncPeerIdleTTL time.Duration
 }
 
-// New creates a new Server instance
+// Compaction defaults
+const (
+	DefaultCompactBytes   = 1 << 20 // 1 MiB
+	DefaultCompactChanges = 1000
+	DefaultBackups        = 2
+)
+
+// New creates a new Server instance and starts its document goroutine
+// (stopped by Close)
 func New(cfg Config) *Server {
-	return &Server{
-		clients:    make([]chan string, 0),
-		storageDir: cfg.StorageDir,
-		userID:     cfg.UserID,
-		wasmPath:   cfg.WASMPath,
+	if cfg.CompactBytes <= 0 {
+		cfg.CompactBytes = DefaultCompactBytes
+	}
+	if cfg.CompactChanges <= 0 {
+		cfg.CompactChanges = DefaultCompactChanges
+	}
+	if cfg.DocID == "" {
+		cfg.DocID = DefaultDocID
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = DefaultFlushInterval
+	}
+	if cfg.MaxDirtyChanges <= 0 {
+		cfg.MaxDirtyChanges = DefaultMaxDirtyChanges
+	}
+	if cfg.Backups == 0 {
+		cfg.Backups = DefaultBackups
+	} else if cfg.Backups < 0 {
+		cfg.Backups = 0
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultQueueSize
+	}
+	if cfg.ReplicaMaxLag == 0 {
+		cfg.ReplicaMaxLag = DefaultReplicaMaxLag
+	}
+	if cfg.EventLogSize == 0 {
+		cfg.EventLogSize = DefaultEventLogSize
 	}
+	if cfg.ResumeWindow == 0 {
+		cfg.ResumeWindow = DefaultResumeWindow
+	}
+	if cfg.ResyncAfter == 0 {
+		cfg.ResyncAfter = DefaultResyncAfter
+	}
+	if cfg.SyncPeerIdleTTL <= 0 {
+		cfg.SyncPeerIdleTTL = DefaultSyncPeerIdleTTL
+	}
+
+	s := &Server{
+		storageDir:     cfg.StorageDir,
+		userID:         cfg.UserID,
+		wasmPath:       cfg.WASMPath,
+		actors:         make(map[string]string),
+		userActors:     make(map[string]string),
+		syncPeers:      make(map[string]*automerge.SyncState),
+		syncPeerIDs:    make(map[*automerge.SyncState]string),
+		syncPeerUsed:   make(map[string]time.Time),
+		syncPeerIdle:   cfg.SyncPeerIdleTTL,
+		dirtyKeys:      make(map[string]bool),
+		compactBytes:   cfg.CompactBytes,
+		compactChanges: cfg.CompactChanges,
+		backups:        cfg.Backups,
+		storage:        cfg.Storage,
+		docID:          cfg.DocID,
+		flushInterval:  cfg.FlushInterval,
+		maxDirty:       cfg.MaxDirtyChanges,
+		flushCh:        make(chan struct{}, 1),
+		ops:            make(chan *op, cfg.QueueSize),
+		opsStop:        make(chan struct{}),
+		opsDone:        make(chan struct{}),
+		eventEpoch:     strconv.FormatInt(time.Now().UnixNano(), 36),
+		eventLogSize:   cfg.EventLogSize,
+		resumeWindow:   cfg.ResumeWindow,
+		resyncAfter:    cfg.ResyncAfter,
+	}
+	s.initReplicas(cfg.Replicas, cfg.ReplicaMaxLag)
+	s.startOps()
+	return s
 }
 
-// Initialize loads or creates a new Automerge document
+// Initialize loads or creates a new Automerge document.
+//
+// An existing snapshot (or, if it is damaged, the newest backup that loads)
+// is loaded and the change chunks stored since it was written are replayed
+// on top, then compacted into a fresh snapshot. It then starts the
+// background persister. Call it before sharing the Server: it sets the
+// document up directly rather than on the document goroutine.
 func (s *Server) Initialize(ctx context.Context) error {
-	snapshotPath := filepath.Join(s.storageDir, "doc.am")
+	if s.storage == nil {
+		storage, err := NewFileStorage(s.storageDir)
+		if err != nil {
+			return err
+		}
+		s.storage = storage
+		s.ownsStorage = true
+	}
 
-	// Try to load existing snapshot
-	if data, err := os.ReadFile(snapshotPath); err == nil {
-		log.Printf("[%s] Loading existing snapshot from %s...", s.userID, snapshotPath)
-		doc, err := automerge.LoadWithWASM(ctx, data, s.wasmPath)
+	// Try to load existing snapshot (or its newest good backup)
+	doc, recovered, err := s.loadSnapshot(ctx)
+	if err != nil {
+		return err
+	}
+	fresh := doc == nil
+	if !fresh {
+		s.doc = doc
+	} else {
+		// Initialize new document
+		log.Printf("[%s] Initializing new document...", s.userID)
+		doc, err := automerge.NewWithWASM(ctx, s.wasmPath)
 		if err != nil {
-			return fmt.Errorf("failed to load document: %w", err)
+			return fmt.Errorf("failed to create document: %w", err)
 		}
 		s.doc = doc
-		return nil
+		// Peers adding their first comments concurrently would each create
+		// the comments map, and only one survives the merge
+		if err := doc.EnsureComments(ctx); err != nil {
+			return fmt.Errorf("failed to create comments map: %w", err)
+		}
+		// Same for the map marks are recorded in
+		if err := doc.EnsureMarks(ctx); err != nil {
+			return fmt.Errorf("failed to create marks map: %w", err)
+		}
+		s.needsCompact = true // The first flush writes the snapshot
 	}
 
-	// Initialize new document
-	log.Printf("[%s] Initializing new document...", s.userID)
-	doc, err := automerge.NewWithWASM(ctx, s.wasmPath)
+	if err := s.replayChunks(ctx, fresh, recovered); err != nil {
+		return err
+	}
+	if err := s.loadActors(ctx); err != nil {
+		return err
+	}
+
+	s.startPersister()
+	return nil
+}
+
+// replayChunks replays the stored change chunks into the loaded document
+// (called from Initialize, before the server is shared). fresh means there
+// was no snapshot; recovered means it was loaded from a backup.
+func (s *Server) replayChunks(ctx context.Context, fresh, recovered bool) error {
+	keys, err := s.storage.List(ctx, s.docID, chunkKeyPrefix)
 	if err != nil {
-		return fmt.Errorf("failed to create document: %w", err)
+		return fmt.Errorf("failed to list change chunks: %w", err)
+	}
+	if len(keys) > 0 {
+		last := strings.TrimPrefix(keys[len(keys)-1], chunkKeyPrefix)
+		if seq, err := strconv.ParseUint(last, 10, 64); err == nil {
+			s.chunkSeq = seq + 1
+		}
+	}
+
+	if fresh {
+		if len(keys) > 0 {
+			// Without their snapshot the chunks can't be replayed
+			log.Printf("Warning: discarding %d change chunks without a snapshot", len(keys))
+			return s.deleteChunks(ctx)
+		}
+		return nil
+	}
+
+	replayed := 0
+	for i, key := range keys {
+		chunk, err := s.storage.Get(ctx, s.docID, key)
+		if err != nil {
+			return fmt.Errorf("failed to read change chunk %s: %w", key, err)
+		}
+		if err := s.doc.LoadIncremental(ctx, chunk); err != nil {
+			// Later chunks may depend on it: stop, and keep them all out of
+			// the way of compaction, which would delete them
+			s.replayErr = fmt.Errorf("damaged change chunk %s: %w", key, err)
+			log.Printf("Warning: %v; setting it and %d later chunks aside", s.replayErr, len(keys)-i-1)
+			for _, bad := range keys[i:] {
+				if err := s.setAsideChunk(ctx, bad); err != nil {
+					log.Printf("Warning: failed to set aside %s: %v", bad, err)
+				}
+			}
+			break
+		}
+		s.chunkBytes += int64(len(chunk))
+		s.chunkCount++
+		replayed++
+	}
+	if len(keys) > 0 {
+		log.Printf("[%s] Replayed %d change chunks (%d bytes)", s.userID, replayed, s.chunkBytes)
+	}
+	if s.replayErr != nil || (len(keys) == 0 && !recovered) {
+		return nil
 	}
 
-	s.doc = doc
+	// Fold the chunks (and a recovered backup) into a fresh snapshot
+	s.needsCompact = true
+	if err := s.Flush(ctx); err != nil {
+		log.Printf("Warning: failed to compact change chunks: %v", err)
+	}
 	return nil
 }
 
@@ -69,15 +363,48 @@ func (s *Server) UserID() string {
 	return s.userID
 }
 
-// Close closes the document and cleans up resources
+// Close flushes queued changes, then closes the document and cleans up
+// resources. Later operations fail with ErrServerClosed.
 func (s *Server) Close(ctx context.Context) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	select {
+	case <-s.opsDone:
+		return nil // Already closed
+	default:
+	}
 
-	if s.doc != nil {
-		return s.doc.Close(ctx)
+	s.closeReplicas(ctx)
+	s.stopPersister()
+	// Flush even if ctx is already done (e.g. a shutdown deadline used up
+	// by the HTTP server): queued changes would be lost otherwise
+	flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), CloseFlushTimeout)
+	defer cancel()
+	if err := s.Flush(flushCtx); err != nil {
+		log.Printf("Warning: failed to flush on close: %v", err)
 	}
-	return nil
+
+	s.persistMu.Lock()
+	defer s.persistMu.Unlock()
+
+	err := s.doWait(context.WithoutCancel(ctx), func() error {
+		if s.ownsStorage && s.storage != nil {
+			if err := s.storage.Close(); err != nil {
+				log.Printf("Warning: failed to close storage: %v", err)
+			}
+			s.storage = nil
+		}
+		if s.doc != nil {
+			err := s.doc.Close(ctx)
+			s.doc = nil
+			return err
+		}
+		return nil
+	})
+	s.stopOps()
+	s.CloseSubscriptions()
+	if errors.Is(err, ErrServerClosed) {
+		return nil // Closed concurrently
+	}
+	return err
 }
 
 // IsReady checks if the server is ready to accept traffic.
@@ -88,25 +415,52 @@ func (s *Server) Close(ctx context.Context) error {
 //
 // This is used by readiness probes (Kubernetes, load balancers, etc.)
 func (s *Server) IsReady() (bool, map[string]interface{}) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
 	details := map[string]interface{}{
 		"check":   "readiness",
 		"user_id": s.userID,
+		"queue":   s.queueStatus(),
+		"events":  s.eventStatus(),
 	}
+	if s.replicas != nil {
+		details["replicas"] = s.replicaStatus()
+	}
+
+	ready := false
+	err := s.do(context.Background(), func() error {
+		// Check if document is initialized
+		if s.doc == nil {
+			details["document_initialized"] = false
+			details["wasm_runtime"] = "not_loaded"
+			return nil
+		}
 
-	// Check if document is initialized
-	if s.doc == nil {
+		// Document exists = WASM runtime is loaded
+		ready = true
+		details["document_initialized"] = true
+		details["wasm_runtime"] = "loaded"
+		details["storage_dir"] = s.storageDir
+		details["persistence"] = s.persistenceStatus()
+		details["memory_bytes"] = s.doc.MemorySize()
+		return nil
+	})
+	if err != nil {
+		// Closed, or too busy to take more traffic
 		details["document_initialized"] = false
-		details["wasm_runtime"] = "not_loaded"
+		details["error"] = err.Error()
 		return false, details
 	}
 
-	// Document exists = WASM runtime is loaded
-	details["document_initialized"] = true
-	details["wasm_runtime"] = "loaded"
-	details["storage_dir"] = s.storageDir
+	return ready, details
+}
 
-	return true, details
+// MemoryBytes returns the WASM memory held by the document and its read
+// replicas (0 once closed)
+func (s *Server) MemoryBytes() int64 {
+	mem, _ := call(context.Background(), s, func() (int64, error) {
+		if s.doc == nil {
+			return 0, nil
+		}
+		return int64(s.doc.MemorySize()), nil
+	})
+	return mem + s.replicaBytes.Load()
 }
@@ -0,0 +1,158 @@
+// ==============================================================================
+// Layer 5: Go Server - Crash-Safe Snapshots
+// ==============================================================================
+// ARCHITECTURE: This is the stateful server layer (Layer 5/7).
+//
+// RESPONSIBILITIES:
+// - Keep rotating backups of the snapshot (snapshot.1 is the newest)
+// - Load the newest snapshot that loads cleanly on startup
+//
+// DEPENDENCIES:
+// - Layer 4: pkg/automerge (loading candidate snapshots)
+// - pkg/server/storage.go (Storage.Put is atomic)
+//
+// DEPENDENTS:
+// - pkg/server/persister.go (compaction writes snapshots)
+// - pkg/server/server.go (Initialize loads them)
+//
+// NOTES:
+// - Rotation copies snapshot.N-1 → snapshot.N, …, snapshot → snapshot.1
+//   before the new snapshot is stored, so a crash at any point leaves a
+//   loadable snapshot
+// - Change chunks hold changes made after the snapshot. When startup falls
+//   back to a backup those changes may not apply, and edits since the backup
+//   are lost
+// ==============================================================================
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+)
+
+// backupKey is the key of the n-th newest backup snapshot (n >= 1)
+func backupKey(n int) string {
+	return fmt.Sprintf("%s.%d", snapshotKey, n)
+}
+
+// writeSnapshot stores data as the snapshot, first rotating the current
+// snapshot into the backups
+func (s *Server) writeSnapshot(ctx context.Context, data []byte) error {
+	if s.backups > 0 {
+		if err := s.rotateBackups(ctx); err != nil {
+			return fmt.Errorf("failed to rotate backups: %w", err)
+		}
+	}
+	if err := s.storage.Put(ctx, s.docID, snapshotKey, data); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return nil
+}
+
+// rotateBackups shifts snapshot.N-1 → snapshot.N, …, snapshot → snapshot.1
+func (s *Server) rotateBackups(ctx context.Context) error {
+	keys := []string{snapshotKey}
+	for n := 1; n <= s.backups; n++ {
+		keys = append(keys, backupKey(n))
+	}
+
+	for i := len(keys) - 2; i >= 0; i-- {
+		data, err := s.storage.Get(ctx, s.docID, keys[i])
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.storage.Put(ctx, s.docID, keys[i+1], data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadSnapshot loads the snapshot, or the newest backup that loads cleanly.
+//
+// It returns a nil document when there is no snapshot at all, and reports
+// whether it fell back to a backup. Snapshots that fail to load are moved to
+// <key>.corrupt so later rotations don't keep them as backups.
+func (s *Server) loadSnapshot(ctx context.Context) (*automerge.Document, bool, error) {
+	keys := []string{snapshotKey}
+	for n := 1; n <= s.backups; n++ {
+		keys = append(keys, backupKey(n))
+	}
+
+	var (
+		corrupt []string
+		lastErr error
+	)
+	for i, key := range keys {
+		data, err := s.storage.Get(ctx, s.docID, key)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read %s: %w", key, err)
+		}
+
+		if len(data) == 0 {
+			lastErr = fmt.Errorf("%s is empty", key)
+			log.Printf("Warning: snapshot %v", lastErr)
+			corrupt = append(corrupt, key)
+			continue
+		}
+		log.Printf("[%s] Loading existing snapshot %s/%s...", s.userID, s.docID, key)
+		doc, err := automerge.LoadWithWASM(ctx, data, s.wasmPath)
+		if err != nil {
+			lastErr = err
+			log.Printf("Warning: failed to load snapshot %s: %v", key, err)
+			corrupt = append(corrupt, key)
+			continue
+		}
+
+		if i > 0 {
+			log.Printf("Warning: recovered from backup %s", key)
+		}
+		for _, bad := range corrupt {
+			if err := s.setAside(ctx, bad); err != nil {
+				log.Printf("Warning: failed to set aside %s: %v", bad, err)
+			}
+		}
+		return doc, i > 0, nil
+	}
+
+	if lastErr != nil {
+		return nil, false, fmt.Errorf("failed to load document: no snapshot of %s loads cleanly: %w", s.docID, lastErr)
+	}
+	return nil, false, nil
+}
+
+// setAside moves a damaged snapshot to <key>.corrupt
+func (s *Server) setAside(ctx context.Context, key string) error {
+	data, err := s.storage.Get(ctx, s.docID, key)
+	if err != nil {
+		return err
+	}
+	if err := s.storage.Put(ctx, s.docID, key+".corrupt", data); err != nil {
+		return err
+	}
+	return s.storage.Delete(ctx, s.docID, key)
+}
+
+// setAsideChunk moves a change chunk that can't be replayed to
+// corrupt.<key>
+func (s *Server) setAsideChunk(ctx context.Context, key string) error {
+	data, err := s.storage.Get(ctx, s.docID, key)
+	if err != nil {
+		return err
+	}
+	if err := s.storage.Put(ctx, s.docID, corruptChunkPrefix+key, data); err != nil {
+		return err
+	}
+	return s.storage.Delete(ctx, s.docID, key)
+}
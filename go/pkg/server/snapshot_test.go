@@ -0,0 +1,213 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+)
+
+func TestServer_RotateBackups(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryStorage()
+	s := New(Config{Storage: storage, Backups: 2})
+
+	for _, data := range []string{"a", "b", "c", "d"} {
+		if err := s.writeSnapshot(ctx, []byte(data)); err != nil {
+			t.Fatalf("writeSnapshot() error = %v", err)
+		}
+	}
+
+	for key, want := range map[string]string{
+		snapshotKey:  "d",
+		backupKey(1): "c",
+		backupKey(2): "b",
+	} {
+		if got, _ := storage.Get(ctx, DefaultDocID, key); string(got) != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	if _, err := storage.Get(ctx, DefaultDocID, backupKey(3)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("snapshot.3 exists (err = %v)", err)
+	}
+
+	// Negative disables backups
+	storage = NewMemoryStorage()
+	s = New(Config{Storage: storage, Backups: -1})
+	s.writeSnapshot(ctx, []byte("a"))
+	s.writeSnapshot(ctx, []byte("b"))
+	if keys, _ := storage.List(ctx, DefaultDocID, ""); len(keys) != 1 {
+		t.Errorf("keys with backups disabled = %v", keys)
+	}
+}
+
+// copyDir copies the tree under src into a new temporary directory
+func copyDir(t *testing.T, src string) string {
+	t.Helper()
+	dst := t.TempDir()
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == src {
+			return err
+		}
+		rel, _ := filepath.Rel(src, path)
+		if info.IsDir() {
+			return os.MkdirAll(filepath.Join(dst, rel), 0755)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dst, rel), data, 0644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dst
+}
+
+// TestServer_SnapshotCorruption truncates the snapshot, its backups and the
+// change chunks at random offsets and checks the server still starts with
+// one of the states it saved
+func TestServer_SnapshotCorruption(t *testing.T) {
+	ctx := context.Background()
+	base := t.TempDir()
+
+	// snapshot = v5, snapshot.1 = v3, snapshot.2 = v1, one chunk holds v6
+	texts := []string{"v1", "v2", "v3", "v4", "v5", "v6"}
+	s := newTestServer(t, base, 2)
+	for _, text := range texts {
+		setText(t, s, text)
+	}
+	s.Close(ctx)
+
+	saved := make(map[string]bool)
+	for _, text := range texts {
+		saved[text] = true
+	}
+	docDir := filepath.Join(base, DefaultDocID)
+	files := []string{snapshotKey, backupKey(1), backupKey(2), chunkKey(2)}
+	for _, name := range files {
+		if _, err := os.Stat(filepath.Join(docDir, name)); err != nil {
+			t.Fatalf("unexpected layout: %v", err)
+		}
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	for trial := 0; trial < 20; trial++ {
+		dir := copyDir(t, base)
+
+		// Truncate one or two files
+		for i := 0; i <= trial%2; i++ {
+			path := filepath.Join(dir, DefaultDocID, files[rng.Intn(len(files))])
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			offset := rng.Int63n(info.Size() + 1)
+			if err := os.Truncate(path, offset); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		s := newTestServer(t, dir, 2)
+		text, err := s.GetText(ctx)
+		if err != nil || !saved[text] {
+			t.Errorf("trial %d: GetText() = %q, %v; want a saved state", trial, text, err)
+		}
+
+		// The recovered server keeps saving
+		if err := s.SetText(ctx, "after"); err != nil {
+			t.Errorf("trial %d: SetText() error = %v", trial, err)
+		}
+		s.Close(ctx)
+	}
+
+	t.Run("Missing snapshot", func(t *testing.T) {
+		dir := copyDir(t, base)
+		os.Remove(filepath.Join(dir, DefaultDocID, snapshotKey))
+
+		s := newTestServer(t, dir, 2)
+		defer s.Close(ctx)
+		if text, _ := s.GetText(ctx); !saved[text] {
+			t.Errorf("GetText() = %q, want a saved state", text)
+		}
+		if _, err := os.Stat(filepath.Join(dir, DefaultDocID, snapshotKey)); err != nil {
+			t.Errorf("snapshot not rewritten after recovery: %v", err)
+		}
+	})
+
+	t.Run("All snapshots damaged", func(t *testing.T) {
+		dir := copyDir(t, base)
+		for _, name := range files[:3] {
+			os.Truncate(filepath.Join(dir, DefaultDocID, name), 5)
+		}
+
+		s := New(Config{StorageDir: dir, UserID: "test-user", WASMPath: automerge.TestWASMPath})
+		if err := s.Initialize(ctx); err == nil {
+			s.Close(ctx)
+			t.Error("Initialize() succeeded with every snapshot damaged")
+		}
+	})
+}
+
+// TestServer_NewDocumentHasComments tests that a new document is created
+// with its comments map, so peers cloning it share that map
+func TestServer_NewDocumentHasComments(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := newTestServer(t, dir, 0)
+	if err := s.Flush(ctx); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	s.Close(ctx)
+
+	// Stored with the first snapshot
+	s = newTestServer(t, dir, 0)
+	defer s.Close(ctx)
+	got, _, err := s.ReadJSON(ctx, automerge.Root().Get(automerge.CommentsKey))
+	if err != nil {
+		t.Fatalf("ReadJSON() error = %v", err)
+	}
+	if m, ok := got.(map[string]interface{}); !ok || len(m) != 0 {
+		t.Errorf("%s = %#v, want an empty map", automerge.CommentsKey, got)
+	}
+}
+
+// TestServer_GetSnapshotKeepsChanges tests that taking a snapshot doesn't
+// keep changes not saved yet out of the change chunks
+func TestServer_GetSnapshotKeepsChanges(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := newTestServer(t, dir, 100)
+	if err := s.Flush(ctx); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	// An edit no operation has saved yet
+	if err := s.do(ctx, func() error {
+		return s.doc.SpliceText(ctx, automerge.Root().Get("content"), 0, 0, "unsaved")
+	}); err != nil {
+		t.Fatalf("SpliceText() error = %v", err)
+	}
+	if _, err := s.GetSnapshot(ctx); err != nil {
+		t.Fatalf("GetSnapshot() error = %v", err)
+	}
+	if err := s.Flush(ctx); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if n := storedChunks(t, s); n != 1 {
+		t.Errorf("change chunks = %d, want 1", n)
+	}
+	s.Close(ctx)
+
+	s = newTestServer(t, dir, 100)
+	defer s.Close(ctx)
+	if text, _ := s.GetText(ctx); text != "unsaved" {
+		t.Errorf("GetText() after restart = %q, want %q", text, "unsaved")
+	}
+}
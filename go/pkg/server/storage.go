@@ -0,0 +1,120 @@
+// ==============================================================================
+// Layer 5: Go Server - Storage Interface
+// ==============================================================================
+// ARCHITECTURE: This is the stateful server layer (Layer 5/7).
+//
+// RESPONSIBILITIES:
+// - Define where documents are persisted: a key-value store per document
+// - Name the keys a document is stored under
+//
+// DEPENDENCIES:
+// - Standard library only
+//
+// DEPENDENTS:
+// - pkg/server/snapshot.go, persister.go (snapshots and change chunks)
+// - pkg/server/crdt_blame.go (actor registry)
+// - pkg/server/crdt_sync.go (sync-peer states)
+// - pkg/httpserver (selects the backend from config.Config)
+//
+// RELATED FILES:
+// - pkg/server/storage_fs.go (FileStorage: one file per key)
+// - pkg/server/storage_mem.go (MemoryStorage: for tests and ephemeral servers)
+// - pkg/server/storage_sqlite.go (SQLiteStorage: one database, many documents)
+// - pkg/server/storage_s3.go (S3Storage: objects in an S3-compatible bucket)
+// - pkg/server/storagetest (conformance suite every backend must pass)
+//
+// NOTES:
+// - Keys of a document:
+//   snapshot             full Document.Save
+//   snapshot.1 … .N      previous snapshots (newest first)
+//   changes.<20 digits>  Document.SaveIncremental chunks written since the
+//                        snapshot, in sequence order
+//   actors.json          actor ID → user ID registry (see crdt_blame.go)
+//   user_actors.json     user ID → the actor this server made for them
+//   <snapshot key>.corrupt  a snapshot that failed to load, set aside
+//   corrupt.changes.<20 digits>  a chunk that failed to replay, or came
+//                        after one, set aside (outside the changes. prefix,
+//                        so compaction doesn't delete it)
+//   sync.<peer ID>       sync-peer state (see crdt_sync.go)
+// - Put must be atomic: a reader (or a restart after a crash) sees the old
+//   value or the new one, never a mix
+// ==============================================================================
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNotFound is returned by Storage.Get for a missing key
+var ErrNotFound = errors.New("storage: not found")
+
+// DefaultDocID is the document a single-document server persists
+const DefaultDocID = "default"
+
+// Storage persists documents as values stored under (document ID, key).
+//
+// Implementations must be safe for concurrent use.
+type Storage interface {
+	// Put stores data under key, replacing any previous value atomically
+	Put(ctx context.Context, docID, key string, data []byte) error
+
+	// Get returns the value stored under key, or ErrNotFound
+	Get(ctx context.Context, docID, key string) ([]byte, error)
+
+	// List returns the document's keys that start with prefix, sorted
+	List(ctx context.Context, docID, prefix string) ([]string, error)
+
+	// Delete removes key; deleting a missing key is not an error
+	Delete(ctx context.Context, docID, key string) error
+
+	// Documents returns the IDs of documents that have at least one key,
+	// sorted
+	Documents(ctx context.Context) ([]string, error)
+
+	// Close releases the backend's resources
+	Close() error
+}
+
+// Storage keys (see NOTES above)
+const (
+	snapshotKey    = "snapshot"
+	chunkKeyPrefix = "changes."
+	actorsKey      = "actors.json"
+	userActorsKey  = "user_actors.json"
+	syncKeyPrefix  = "sync."
+
+	corruptChunkPrefix = "corrupt."
+)
+
+// chunkKey is the key of the change chunk with sequence number seq; keys sort
+// in sequence order
+func chunkKey(seq uint64) string {
+	return fmt.Sprintf("%s%020d", chunkKeyPrefix, seq)
+}
+
+// validateName checks a document ID or key is usable by every backend: it
+// must be non-empty, at most 255 bytes, not start with a dot and not contain
+// path separators or NUL
+func validateName(kind, name string) error {
+	switch {
+	case name == "", strings.HasPrefix(name, "."):
+		return fmt.Errorf("storage: invalid %s %q", kind, name)
+	case len(name) > 255:
+		return fmt.Errorf("storage: %s too long (%d bytes)", kind, len(name))
+	case strings.ContainsAny(name, "/\\\x00"):
+		return fmt.Errorf("storage: invalid %s %q (contains a separator)", kind, name)
+	}
+	return nil
+}
+
+// validateKey checks a document ID and key
+func validateKey(docID, key string) error {
+	if err := validateName("document ID", docID); err != nil {
+		return err
+	}
+	return validateName("key", key)
+}
@@ -0,0 +1,215 @@
+// ==============================================================================
+// Layer 5: Go Server - Filesystem Storage
+// ==============================================================================
+// ARCHITECTURE: This is the stateful server layer (Layer 5/7).
+//
+// RESPONSIBILITIES:
+// - Store each (document ID, key) as a file: <dir>/<document ID>/<key>
+// - Replace files atomically (temp file + fsync + rename + directory fsync)
+//
+// DEPENDENCIES:
+// - pkg/server/storage.go (Storage interface, name validation)
+// - pkg/server/legacy.go (migrates the old single-document layout)
+//
+// NOTES:
+// - Temporary files start with a dot, which no valid key does, so List never
+//   returns a half-written value
+// ==============================================================================
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FileStorage stores each document in a directory, one file per key:
+// <dir>/<document ID>/<key>.
+//
+// Writes go to a temporary file that is fsynced and renamed into place, so a
+// crash leaves either the old or the new value.
+type FileStorage struct {
+	dir string
+}
+
+// NewFileStorage creates a store rooted at dir (created if missing).
+//
+// A directory in the old single-document layout (doc.am, doc.am.N, the
+// change chunks and actors.json directly in dir) is moved into the
+// DefaultDocID document.
+func NewFileStorage(dir string) (*FileStorage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := migrateLegacyLayout(dir); err != nil {
+		return nil, fmt.Errorf("failed to migrate %s: %w", dir, err)
+	}
+	return &FileStorage{dir: dir}, nil
+}
+
+// Dir returns the root directory
+func (f *FileStorage) Dir() string {
+	return f.dir
+}
+
+// path returns the file of key, after validating both names
+func (f *FileStorage) path(docID, key string) (string, error) {
+	if err := validateKey(docID, key); err != nil {
+		return "", err
+	}
+	return filepath.Join(f.dir, docID, key), nil
+}
+
+// Put atomically replaces the file of key
+func (f *FileStorage) Put(ctx context.Context, docID, key string, data []byte) error {
+	path, err := f.path(docID, key)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0644)
+}
+
+// Get reads the file of key
+func (f *FileStorage) Get(ctx context.Context, docID, key string) ([]byte, error) {
+	path, err := f.path(docID, key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// List returns the document's keys that start with prefix, sorted
+func (f *FileStorage) List(ctx context.Context, docID, prefix string) ([]string, error) {
+	if err := validateName("document ID", docID); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(filepath.Join(f.dir, docID))
+	if errors.Is(err, os.ErrNotExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	for _, e := range entries {
+		name := e.Name()
+		if e.Type().IsRegular() && strings.HasPrefix(name, prefix) && !isTempFile(name) {
+			keys = append(keys, name)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Delete removes the file of key, and the document's directory once empty
+func (f *FileStorage) Delete(ctx context.Context, docID, key string) error {
+	path, err := f.path(docID, key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	os.Remove(filepath.Dir(path)) // Fails while other keys remain
+	return nil
+}
+
+// Documents returns the names of the document directories, sorted
+func (f *FileStorage) Documents(ctx context.Context) ([]string, error) {
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, e := range entries {
+		if !e.IsDir() || validateName("document ID", e.Name()) != nil {
+			continue
+		}
+		keys, err := f.List(ctx, e.Name(), "")
+		if err != nil {
+			return nil, err
+		}
+		if len(keys) > 0 {
+			ids = append(ids, e.Name())
+		}
+	}
+	return ids, nil
+}
+
+// Close is a no-op
+func (f *FileStorage) Close() error {
+	return nil
+}
+
+// writeFileAtomic replaces path with data so that a crash leaves either the
+// old or the new contents, never a mix
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	pattern := "." + filepath.Base(path) + ".*.tmp"
+	tmp, err := os.CreateTemp(dir, pattern)
+	if errors.Is(err, os.ErrNotExist) {
+		// A concurrent Delete removed the emptied directory
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+		tmp, err = os.CreateTemp(dir, pattern)
+	}
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // No-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// isTempFile reports whether name is a writeFileAtomic temporary file (valid
+// keys never start with a dot)
+func isTempFile(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
+// syncDir makes renames in dir durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sub", "file")
+
+	for _, data := range []string{"first", "second"} {
+		if err := writeFileAtomic(path, []byte(data), 0644); err != nil {
+			t.Fatalf("writeFileAtomic() error = %v", err)
+		}
+		if got, _ := os.ReadFile(path); string(got) != data {
+			t.Errorf("contents = %q, want %q", got, data)
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0644 {
+		t.Errorf("mode = %v, want 0644", mode)
+	}
+
+	// No temporary files are left behind
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("directory holds %d entries, want 1", len(entries))
+	}
+}
+
+func TestFileStorage_IgnoresTempFiles(t *testing.T) {
+	ctx := context.Background()
+	storage, err := NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Put(ctx, "doc", snapshotKey, []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Left by a crash during Put
+	tmp := filepath.Join(storage.Dir(), "doc", ".snapshot.123.tmp")
+	if err := os.WriteFile(tmp, []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Mkdir(filepath.Join(storage.Dir(), "doc", "subdir"), 0755)
+
+	keys, err := storage.List(ctx, "doc", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{snapshotKey}) {
+		t.Errorf("List() = %v, want [snapshot]", keys)
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryStorage keeps documents in memory. Nothing survives a restart: use
+// it for tests and throwaway servers.
+type MemoryStorage struct {
+	mu   sync.RWMutex
+	docs map[string]map[string][]byte
+}
+
+// NewMemoryStorage creates an empty in-memory store
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{docs: make(map[string]map[string][]byte)}
+}
+
+// Put stores a copy of data under key
+func (m *MemoryStorage) Put(ctx context.Context, docID, key string, data []byte) error {
+	if err := validateKey(docID, key); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	doc := m.docs[docID]
+	if doc == nil {
+		doc = make(map[string][]byte)
+		m.docs[docID] = doc
+	}
+	doc[key] = append([]byte{}, data...)
+	return nil
+}
+
+// Get returns a copy of the value stored under key
+func (m *MemoryStorage) Get(ctx context.Context, docID, key string) ([]byte, error) {
+	if err := validateKey(docID, key); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	data, ok := m.docs[docID][key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte{}, data...), nil
+}
+
+// List returns the document's keys that start with prefix, sorted
+func (m *MemoryStorage) List(ctx context.Context, docID, prefix string) ([]string, error) {
+	if err := validateName("document ID", docID); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := []string{}
+	for key := range m.docs[docID] {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Delete removes key
+func (m *MemoryStorage) Delete(ctx context.Context, docID, key string) error {
+	if err := validateKey(docID, key); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.docs[docID], key)
+	if len(m.docs[docID]) == 0 {
+		delete(m.docs, docID)
+	}
+	return nil
+}
+
+// Documents returns the IDs of stored documents, sorted
+func (m *MemoryStorage) Documents(ctx context.Context) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ids := make([]string, 0, len(m.docs))
+	for id := range m.docs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Close is a no-op
+func (m *MemoryStorage) Close() error {
+	return nil
+}
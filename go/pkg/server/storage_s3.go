@@ -0,0 +1,456 @@
+// ==============================================================================
+// Layer 5: Go Server - S3 Storage
+// ==============================================================================
+// ARCHITECTURE: This is the stateful server layer (Layer 5/7).
+//
+// RESPONSIBILITIES:
+// - Store each (document ID, key) as an object: <prefix><document ID>/<key>
+// - Sign requests with AWS Signature Version 4
+// - Retry throttled, failed and dropped requests with exponential backoff
+//
+// DEPENDENCIES:
+// - Standard library only (net/http, encoding/xml)
+// - pkg/server/storage.go (Storage interface, name validation)
+//
+// RELATED FILES:
+// - pkg/server/s3fake (in-process S3 server for tests)
+//
+// NOTES:
+// - Works with any S3-compatible API (AWS, MinIO, R2, …). Set PathStyle for
+//   servers that don't resolve <bucket>.<host>
+// - Every operation is idempotent (a PUT replaces the whole object), so
+//   retrying after a dropped response is safe
+// ==============================================================================
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3 defaults
+const (
+	DefaultS3Region       = "us-east-1"
+	DefaultS3MaxRetries   = 3
+	DefaultS3RetryBackoff = 100 * time.Millisecond
+)
+
+// S3Config configures an S3Storage
+type S3Config struct {
+	// Endpoint is the API's base URL (default: https://s3.<Region>.amazonaws.com)
+	Endpoint string
+
+	// Region signs requests (default: DefaultS3Region)
+	Region string
+
+	// Bucket holds the documents (required)
+	Bucket string
+
+	// Prefix is prepended to every object key; a trailing "/" is added
+	Prefix string
+
+	// Credentials
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string // Optional, for temporary credentials
+
+	// PathStyle addresses the bucket as <Endpoint>/<Bucket>/… instead of
+	// <Bucket>.<Endpoint host>/…
+	PathStyle bool
+
+	// MaxRetries is how often a failed request is retried
+	// (default: DefaultS3MaxRetries, negative disables)
+	MaxRetries int
+
+	// RetryBackoff is the delay before the first retry; it doubles for each
+	// further retry (default: DefaultS3RetryBackoff)
+	RetryBackoff time.Duration
+
+	// HTTPClient sends the requests (default: http.DefaultClient)
+	HTTPClient *http.Client
+}
+
+// S3Storage stores documents in an S3-compatible bucket.
+//
+// Example:
+//
+//	storage, err := server.NewS3Storage(server.S3Config{
+//	    Bucket:          "my-docs",
+//	    Prefix:          "prod",
+//	    AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+//	    SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+//	})
+type S3Storage struct {
+	cfg      S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+// NewS3Storage creates a store in cfg.Bucket. It makes no requests: a
+// missing bucket or bad credentials show up on the first operation.
+func NewS3Storage(cfg S3Config) (*S3Storage, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("s3: bucket is required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = DefaultS3Region
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	if cfg.Prefix != "" && !strings.HasSuffix(cfg.Prefix, "/") {
+		cfg.Prefix += "/"
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = DefaultS3MaxRetries
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = DefaultS3RetryBackoff
+	}
+
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("s3: invalid endpoint %q", cfg.Endpoint)
+	}
+
+	client := cfg.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &S3Storage{cfg: cfg, endpoint: endpoint, client: client}, nil
+}
+
+// objectKey is the object that stores key
+func (s *S3Storage) objectKey(docID, key string) string {
+	return s.cfg.Prefix + docID + "/" + key
+}
+
+// Put uploads data as the object of key
+func (s *S3Storage) Put(ctx context.Context, docID, key string, data []byte) error {
+	if err := validateKey(docID, key); err != nil {
+		return err
+	}
+	_, err := s.do(ctx, http.MethodPut, s.objectKey(docID, key), nil, data)
+	return err
+}
+
+// Get downloads the object of key
+func (s *S3Storage) Get(ctx context.Context, docID, key string) ([]byte, error) {
+	if err := validateKey(docID, key); err != nil {
+		return nil, err
+	}
+	data, err := s.do(ctx, http.MethodGet, s.objectKey(docID, key), nil, nil)
+	var s3Err *S3Error
+	if errors.As(err, &s3Err) && s3Err.StatusCode == http.StatusNotFound && s3Err.Code != "NoSuchBucket" {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// List returns the document's keys that start with prefix, sorted
+func (s *S3Storage) List(ctx context.Context, docID, prefix string) ([]string, error) {
+	if err := validateName("document ID", docID); err != nil {
+		return nil, err
+	}
+
+	dir := s.objectKey(docID, "")
+	result, err := s.list(ctx, dir+prefix, "")
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	for _, object := range result.Contents {
+		key := strings.TrimPrefix(object.Key, dir)
+		// Objects in "subdirectories" aren't keys
+		if !strings.Contains(key, "/") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Delete removes the object of key (S3 doesn't fail for a missing object)
+func (s *S3Storage) Delete(ctx context.Context, docID, key string) error {
+	if err := validateKey(docID, key); err != nil {
+		return err
+	}
+	_, err := s.do(ctx, http.MethodDelete, s.objectKey(docID, key), nil, nil)
+	return err
+}
+
+// Documents returns the IDs of documents that have at least one key, sorted
+func (s *S3Storage) Documents(ctx context.Context) ([]string, error) {
+	result, err := s.list(ctx, s.cfg.Prefix, "/")
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, p := range result.CommonPrefixes {
+		id := strings.TrimSuffix(strings.TrimPrefix(p.Prefix, s.cfg.Prefix), "/")
+		if validateName("document ID", id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Close releases idle connections
+func (s *S3Storage) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// s3ListResult is a ListObjectsV2 response (all pages merged by list)
+type s3ListResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// list runs ListObjectsV2 over every page
+func (s *S3Storage) list(ctx context.Context, prefix, delimiter string) (*s3ListResult, error) {
+	all := &s3ListResult{}
+	token := ""
+	for {
+		query := map[string]string{"list-type": "2", "prefix": prefix}
+		if delimiter != "" {
+			query["delimiter"] = delimiter
+		}
+		if token != "" {
+			query["continuation-token"] = token
+		}
+
+		body, err := s.do(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		var page s3ListResult
+		if err := xml.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("s3: invalid list response: %w", err)
+		}
+		all.Contents = append(all.Contents, page.Contents...)
+		all.CommonPrefixes = append(all.CommonPrefixes, page.CommonPrefixes...)
+
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return all, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// S3Error is an error response from the S3 API
+type S3Error struct {
+	StatusCode int
+	Code       string // e.g. "NoSuchKey", "SlowDown"
+	Message    string
+}
+
+func (e *S3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3: HTTP %d", e.StatusCode)
+	}
+	return fmt.Sprintf("s3: %s: %s (HTTP %d)", e.Code, e.Message, e.StatusCode)
+}
+
+// retryable reports whether a request that failed with err may succeed if
+// sent again
+func retryable(err error) bool {
+	var s3Err *S3Error
+	if errors.As(err, &s3Err) {
+		switch s3Err.StatusCode {
+		case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return s3Err.Code == "RequestTimeout"
+	}
+	// Network errors; the caller checks for a cancelled context
+	return true
+}
+
+// do sends a request for the object (or, with an empty object, the bucket),
+// retrying failures, and returns the response body
+func (s *S3Storage) do(ctx context.Context, method, object string, query map[string]string, body []byte) ([]byte, error) {
+	var err error
+	for attempt := 0; ; attempt++ {
+		var data []byte
+		data, err = s.send(ctx, method, object, query, body)
+		if err == nil {
+			return data, nil
+		}
+		if ctx.Err() != nil || !retryable(err) || attempt >= s.cfg.MaxRetries {
+			return nil, err
+		}
+
+		// Exponential backoff with jitter
+		delay := s.cfg.RetryBackoff << attempt
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// send makes one signed request
+func (s *S3Storage) send(ctx context.Context, method, object string, query map[string]string, body []byte) ([]byte, error) {
+	u := *s.endpoint
+	path := strings.TrimSuffix(u.Path, "/")
+	if s.cfg.PathStyle {
+		path += "/" + s.cfg.Bucket
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+	}
+	u.Path = path + "/" + object
+	u.RawPath = s3Escape(path, false) + "/" + s3Escape(object, false)
+	u.RawQuery = s3Query(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if method == http.MethodPut {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	if s.cfg.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.cfg.SessionToken)
+	}
+	signV4(req, body, s.cfg.AccessKeyID, s.cfg.SecretAccessKey, s.cfg.Region, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		s3Err := &S3Error{StatusCode: resp.StatusCode}
+		xml.Unmarshal(data, &struct {
+			Code    *string `xml:"Code"`
+			Message *string `xml:"Message"`
+		}{&s3Err.Code, &s3Err.Message})
+		return nil, s3Err
+	}
+	return data, nil
+}
+
+// signV4 adds the AWS Signature Version 4 headers to req for service s3.
+// Every header already set on req is signed, plus Host.
+func signV4(req *http.Request, body []byte, accessKey, secretKey, region string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// Canonical headers: lowercase names, sorted, trimmed values
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery, // Built by s3Query, already canonical
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+// s3Escape percent-encodes s as SigV4 requires: everything but unreserved
+// characters (and "/" unless encodeSlash)
+func s3Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// s3Query encodes query in canonical form (sorted, SigV4 escaping)
+func s3Query(query map[string]string) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = s3Escape(name, true) + "=" + s3Escape(query[name], true)
+	}
+	return strings.Join(parts, "&")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,332 @@
+// ==============================================================================
+// Layer 5: Go Server - SQLite Storage
+// ==============================================================================
+// ARCHITECTURE: This is the stateful server layer (Layer 5/7).
+//
+// RESPONSIBILITIES:
+// - Store documents in one SQLite database (pure Go driver, no cgo)
+// - Keep snapshots, change chunks, sync-peer state and other metadata in
+//   their own tables, with a documents table updated in the same transaction
+// - Migrate the schema forward on open
+//
+// DEPENDENCIES:
+// - modernc.org/sqlite (database/sql driver "sqlite")
+// - pkg/server/storage.go (Storage interface, key names)
+//
+// NOTES:
+// - Tables by key:
+//   snapshot, snapshot.*   → snapshots
+//   changes.<20 digits>    → chunks (seq is the number)
+//   sync.<peer ID>         → sync_peers
+//   anything else          → metadata (actors.json, …)
+// - The pool holds one connection: SQLite serializes writers anyway, and
+//   ":memory:" databases exist per connection
+// ==============================================================================
+
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // Registers the "sqlite" driver
+)
+
+// sqliteMigrations are applied in order; PRAGMA user_version records how
+// many have run. Append only: never edit a released migration.
+var sqliteMigrations = []string{
+	// 1: initial schema
+	`CREATE TABLE documents (
+		id         TEXT PRIMARY KEY,
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+	CREATE TABLE snapshots (
+		doc_id TEXT NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+		name   TEXT NOT NULL,
+		data   BLOB NOT NULL,
+		PRIMARY KEY (doc_id, name)
+	);
+	CREATE TABLE chunks (
+		doc_id TEXT NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+		seq    INTEGER NOT NULL,
+		data   BLOB NOT NULL,
+		PRIMARY KEY (doc_id, seq)
+	);
+	CREATE TABLE sync_peers (
+		doc_id     TEXT NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+		peer_id    TEXT NOT NULL,
+		state      BLOB NOT NULL,
+		updated_at INTEGER NOT NULL,
+		PRIMARY KEY (doc_id, peer_id)
+	);
+	CREATE TABLE metadata (
+		doc_id TEXT NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+		key    TEXT NOT NULL,
+		value  BLOB NOT NULL,
+		PRIMARY KEY (doc_id, key)
+	);`,
+}
+
+// SQLiteStorage stores documents in a SQLite database.
+//
+// Example:
+//
+//	storage, err := server.NewSQLiteStorage("/data/automerge.db")
+//	if err != nil { ... }
+//	defer storage.Close()
+//	srv := server.New(server.Config{Storage: storage, ...})
+type SQLiteStorage struct {
+	db *sql.DB
+}
+
+// NewSQLiteStorage opens (or creates) the database at path and migrates its
+// schema. ":memory:" opens a private in-memory database.
+func NewSQLiteStorage(path string) (*SQLiteStorage, error) {
+	dsn := "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+	if path != ":memory:" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create directory: %w", err)
+		}
+		dsn += "&_pragma=journal_mode(WAL)&_pragma=synchronous(FULL)"
+	}
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	db.SetMaxOpenConns(1)
+
+	s := &SQLiteStorage{db: db}
+	if err := s.migrate(context.Background()); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// migrate applies the migrations the database hasn't run yet, each in its
+// own transaction
+func (s *SQLiteStorage) migrate(ctx context.Context) error {
+	var version int
+	if err := s.db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version > len(sqliteMigrations) {
+		return fmt.Errorf("schema version %d is newer than this server (%d)", version, len(sqliteMigrations))
+	}
+
+	for i := version; i < len(sqliteMigrations); i++ {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, sqliteMigrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		// PRAGMA doesn't take parameters
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqliteRow locates a key: its table, the key column and that column's value
+type sqliteRow struct {
+	table, column, value string
+	name                 interface{}
+}
+
+// sqliteRowOf maps key to its table (see NOTES above)
+func sqliteRowOf(key string) sqliteRow {
+	switch {
+	case key == snapshotKey || strings.HasPrefix(key, snapshotKey+"."):
+		return sqliteRow{"snapshots", "name", "data", key}
+	case strings.HasPrefix(key, syncKeyPrefix):
+		return sqliteRow{"sync_peers", "peer_id", "state", strings.TrimPrefix(key, syncKeyPrefix)}
+	case strings.HasPrefix(key, chunkKeyPrefix):
+		// Only canonical chunk keys: the key must round-trip through seq
+		digits := strings.TrimPrefix(key, chunkKeyPrefix)
+		if seq, err := strconv.ParseUint(digits, 10, 63); err == nil && chunkKey(seq) == key {
+			return sqliteRow{"chunks", "seq", "data", int64(seq)}
+		}
+	}
+	return sqliteRow{"metadata", "key", "value", key}
+}
+
+// Put stores data under key and marks the document updated, in one
+// transaction
+func (s *SQLiteStorage) Put(ctx context.Context, docID, key string, data []byte) error {
+	if err := validateKey(docID, key); err != nil {
+		return err
+	}
+	if data == nil {
+		data = []byte{} // NOT NULL
+	}
+	now := time.Now().UnixMilli()
+
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO documents (id, created_at, updated_at) VALUES (?, ?, ?)
+			 ON CONFLICT (id) DO UPDATE SET updated_at = excluded.updated_at`,
+			docID, now, now)
+		if err != nil {
+			return err
+		}
+
+		row := sqliteRowOf(key)
+		if row.table == "sync_peers" {
+			_, err = tx.ExecContext(ctx,
+				`INSERT OR REPLACE INTO sync_peers (doc_id, peer_id, state, updated_at) VALUES (?, ?, ?, ?)`,
+				docID, row.name, data, now)
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			fmt.Sprintf(`INSERT OR REPLACE INTO %s (doc_id, %s, %s) VALUES (?, ?, ?)`, row.table, row.column, row.value),
+			docID, row.name, data)
+		return err
+	})
+}
+
+// Get returns the value stored under key, or ErrNotFound
+func (s *SQLiteStorage) Get(ctx context.Context, docID, key string) ([]byte, error) {
+	if err := validateKey(docID, key); err != nil {
+		return nil, err
+	}
+
+	row := sqliteRowOf(key)
+	var data []byte
+	err := s.db.QueryRowContext(ctx,
+		fmt.Sprintf(`SELECT %s FROM %s WHERE doc_id = ? AND %s = ?`, row.value, row.table, row.column),
+		docID, row.name).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		data = []byte{}
+	}
+	return data, nil
+}
+
+// List returns the document's keys that start with prefix, sorted
+func (s *SQLiteStorage) List(ctx context.Context, docID, prefix string) ([]string, error) {
+	if err := validateName("document ID", docID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT 'snapshot', name, 0 FROM snapshots WHERE doc_id = ?1
+		 UNION ALL SELECT 'chunk', '', seq FROM chunks WHERE doc_id = ?1
+		 UNION ALL SELECT 'sync', peer_id, 0 FROM sync_peers WHERE doc_id = ?1
+		 UNION ALL SELECT 'metadata', key, 0 FROM metadata WHERE doc_id = ?1`,
+		docID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []string{}
+	for rows.Next() {
+		var (
+			table, name string
+			seq         int64
+		)
+		if err := rows.Scan(&table, &name, &seq); err != nil {
+			return nil, err
+		}
+		// Rebuild the key: chunks store their sequence, sync_peers the peer
+		key := name
+		switch table {
+		case "chunk":
+			key = chunkKey(uint64(seq))
+		case "sync":
+			key = syncKeyPrefix + name
+		}
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Delete removes key, and the document once it has no keys left
+func (s *SQLiteStorage) Delete(ctx context.Context, docID, key string) error {
+	if err := validateKey(docID, key); err != nil {
+		return err
+	}
+
+	row := sqliteRowOf(key)
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx,
+			fmt.Sprintf(`DELETE FROM %s WHERE doc_id = ? AND %s = ?`, row.table, row.column),
+			docID, row.name)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			`DELETE FROM documents WHERE id = ?1
+			 AND NOT EXISTS (SELECT 1 FROM snapshots WHERE doc_id = ?1)
+			 AND NOT EXISTS (SELECT 1 FROM chunks WHERE doc_id = ?1)
+			 AND NOT EXISTS (SELECT 1 FROM sync_peers WHERE doc_id = ?1)
+			 AND NOT EXISTS (SELECT 1 FROM metadata WHERE doc_id = ?1)`,
+			docID)
+		return err
+	})
+}
+
+// Documents returns the IDs of documents that have at least one key, sorted
+func (s *SQLiteStorage) Documents(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id FROM documents ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Close closes the database
+func (s *SQLiteStorage) Close() error {
+	return s.db.Close()
+}
+
+// inTx runs fn in a transaction, committing if it succeeds
+func (s *SQLiteStorage) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+)
+
+func TestSQLiteStorage_Tables(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	storage, err := NewSQLiteStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	puts := map[string]string{
+		snapshotKey:          "snapshots",
+		backupKey(1):         "snapshots",
+		chunkKey(7):          "chunks",
+		syncKeyPrefix + "p1": "sync_peers",
+		actorsKey:            "metadata",
+		"changes.7":          "metadata", // Not a canonical chunk key
+	}
+	for key := range puts {
+		if err := storage.Put(ctx, "doc", key, []byte(key)); err != nil {
+			t.Fatalf("Put(%q) error = %v", key, err)
+		}
+	}
+
+	for key, table := range puts {
+		if got := sqliteRowOf(key).table; got != table {
+			t.Errorf("%q is stored in %s, want %s", key, got, table)
+		}
+	}
+	var seq int64
+	storage.db.QueryRow(`SELECT seq FROM chunks WHERE doc_id = 'doc'`).Scan(&seq)
+	if seq != 7 {
+		t.Errorf("chunk seq = %d, want 7", seq)
+	}
+	storage.Close()
+
+	// Reopening doesn't rerun the migrations and keeps the data
+	storage, err = NewSQLiteStorage(path)
+	if err != nil {
+		t.Fatalf("reopen error = %v", err)
+	}
+	defer storage.Close()
+
+	var version int
+	storage.db.QueryRow("PRAGMA user_version").Scan(&version)
+	if version != len(sqliteMigrations) {
+		t.Errorf("user_version = %d, want %d", version, len(sqliteMigrations))
+	}
+	keys, _ := storage.List(ctx, "doc", "")
+	want := []string{actorsKey, chunkKey(7), "changes.7", snapshotKey, backupKey(1), "sync.p1"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("List() after reopen = %v, want %v", keys, want)
+	}
+}
+
+func TestSQLiteStorage_NewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	storage, err := NewSQLiteStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage.db.Exec("PRAGMA user_version = 99")
+	storage.Close()
+
+	if _, err := NewSQLiteStorage(path); err == nil {
+		t.Error("NewSQLiteStorage() opened a database from a newer server")
+	}
+}
+
+// TestServer_SQLiteStorage runs a server on SQLite across a restart
+func TestServer_SQLiteStorage(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	start := func() (*Server, Storage) {
+		storage, err := NewSQLiteStorage(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := New(Config{
+			Storage:        storage,
+			UserID:         "test-user",
+			WASMPath:       automerge.TestWASMPath,
+			CompactChanges: 3,
+		})
+		if err := s.Initialize(ctx); err != nil {
+			storage.Close()
+			t.Fatalf("Initialize() error = %v", err)
+		}
+		return s, storage
+	}
+
+	s, storage := start()
+	for _, text := range []string{"a", "b", "c", "d"} {
+		setText(t, s, text)
+	}
+	s.Close(ctx)
+	storage.Close()
+
+	s, storage = start()
+	defer storage.Close()
+	defer s.Close(ctx)
+	if text, _ := s.GetText(ctx); text != "d" {
+		t.Errorf("GetText() after restart = %q, want %q", text, "d")
+	}
+}
@@ -0,0 +1,68 @@
+package server_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/server"
+	"github.com/joeblew999/automerge-wazero-example/pkg/server/s3fake"
+	"github.com/joeblew999/automerge-wazero-example/pkg/server/storagetest"
+)
+
+func TestFileStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) server.Storage {
+		s, err := server.NewFileStorage(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewFileStorage() error = %v", err)
+		}
+		return s
+	})
+}
+
+func TestMemoryStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) server.Storage {
+		return server.NewMemoryStorage()
+	})
+}
+
+func TestSQLiteStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) server.Storage {
+		s, err := server.NewSQLiteStorage(filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatalf("NewSQLiteStorage() error = %v", err)
+		}
+		return s
+	})
+}
+
+func TestSQLiteStorage_Memory(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) server.Storage {
+		s, err := server.NewSQLiteStorage(":memory:")
+		if err != nil {
+			t.Fatalf("NewSQLiteStorage() error = %v", err)
+		}
+		return s
+	})
+}
+
+func TestS3Storage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) server.Storage {
+		fake := s3fake.New()
+		t.Cleanup(fake.Close)
+		fake.CreateBucket("docs")
+		fake.MaxKeys = 2 // Exercise pagination
+
+		s, err := server.NewS3Storage(server.S3Config{
+			Endpoint:        fake.URL,
+			Bucket:          "docs",
+			Prefix:          "test",
+			AccessKeyID:     fake.AccessKeyID,
+			SecretAccessKey: "secret",
+			PathStyle:       true,
+		})
+		if err != nil {
+			t.Fatalf("NewS3Storage() error = %v", err)
+		}
+		return s
+	})
+}
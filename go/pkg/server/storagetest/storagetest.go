@@ -0,0 +1,298 @@
+// Package storagetest is the conformance suite for server.Storage backends.
+//
+// Every backend's tests should call Run:
+//
+//	func TestFileStorage(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T) server.Storage {
+//			s, err := server.NewFileStorage(t.TempDir())
+//			if err != nil {
+//				t.Fatal(err)
+//			}
+//			return s
+//		})
+//	}
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/server"
+)
+
+// Run checks that the stores returned by newStorage behave as the
+// server.Storage contract requires. Each subtest gets a new, empty store and
+// closes it when done.
+func Run(t *testing.T, newStorage func(t *testing.T) server.Storage) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s server.Storage)
+	}{
+		{"PutGet", testPutGet},
+		{"NotFound", testNotFound},
+		{"Overwrite", testOverwrite},
+		{"EmptyValue", testEmptyValue},
+		{"NoAliasing", testNoAliasing},
+		{"List", testList},
+		{"Delete", testDelete},
+		{"Documents", testDocuments},
+		{"InvalidNames", testInvalidNames},
+		{"Concurrent", testConcurrent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStorage(t)
+			defer func() {
+				if err := s.Close(); err != nil {
+					t.Errorf("Close() error = %v", err)
+				}
+			}()
+			tt.fn(t, s)
+		})
+	}
+}
+
+func put(t *testing.T, s server.Storage, docID, key, value string) {
+	t.Helper()
+	if err := s.Put(context.Background(), docID, key, []byte(value)); err != nil {
+		t.Fatalf("Put(%q, %q) error = %v", docID, key, err)
+	}
+}
+
+func get(t *testing.T, s server.Storage, docID, key string) string {
+	t.Helper()
+	data, err := s.Get(context.Background(), docID, key)
+	if err != nil {
+		t.Fatalf("Get(%q, %q) error = %v", docID, key, err)
+	}
+	return string(data)
+}
+
+func list(t *testing.T, s server.Storage, docID, prefix string) []string {
+	t.Helper()
+	keys, err := s.List(context.Background(), docID, prefix)
+	if err != nil {
+		t.Fatalf("List(%q, %q) error = %v", docID, prefix, err)
+	}
+	return keys
+}
+
+func testPutGet(t *testing.T, s server.Storage) {
+	put(t, s, "doc", "snapshot", "hello")
+	put(t, s, "doc", "changes.00000000000000000000", "\x00\x01binary\xff")
+
+	if got := get(t, s, "doc", "snapshot"); got != "hello" {
+		t.Errorf("Get() = %q, want %q", got, "hello")
+	}
+	if got := get(t, s, "doc", "changes.00000000000000000000"); got != "\x00\x01binary\xff" {
+		t.Errorf("Get() = %q, want the binary value", got)
+	}
+}
+
+func testNotFound(t *testing.T, s server.Storage) {
+	ctx := context.Background()
+	if _, err := s.Get(ctx, "doc", "missing"); !errors.Is(err, server.ErrNotFound) {
+		t.Errorf("Get() on an empty store error = %v, want ErrNotFound", err)
+	}
+
+	put(t, s, "doc", "snapshot", "x")
+	if _, err := s.Get(ctx, "doc", "missing"); !errors.Is(err, server.ErrNotFound) {
+		t.Errorf("Get() of a missing key error = %v, want ErrNotFound", err)
+	}
+	if _, err := s.Get(ctx, "other", "snapshot"); !errors.Is(err, server.ErrNotFound) {
+		t.Errorf("Get() of another document's key error = %v, want ErrNotFound", err)
+	}
+}
+
+func testOverwrite(t *testing.T, s server.Storage) {
+	put(t, s, "doc", "snapshot", "a much longer first value")
+	put(t, s, "doc", "snapshot", "short")
+
+	if got := get(t, s, "doc", "snapshot"); got != "short" {
+		t.Errorf("Get() after overwrite = %q, want %q", got, "short")
+	}
+	if keys := list(t, s, "doc", ""); !reflect.DeepEqual(keys, []string{"snapshot"}) {
+		t.Errorf("List() after overwrite = %v", keys)
+	}
+}
+
+func testEmptyValue(t *testing.T, s server.Storage) {
+	put(t, s, "doc", "empty", "")
+
+	data, err := s.Get(context.Background(), "doc", "empty")
+	if err != nil || len(data) != 0 {
+		t.Errorf("Get() = %q, %v; want an empty value", data, err)
+	}
+	if keys := list(t, s, "doc", ""); !reflect.DeepEqual(keys, []string{"empty"}) {
+		t.Errorf("List() = %v, want [empty]", keys)
+	}
+}
+
+func testNoAliasing(t *testing.T, s server.Storage) {
+	ctx := context.Background()
+	data := []byte("original")
+	if err := s.Put(ctx, "doc", "key", data); err != nil {
+		t.Fatal(err)
+	}
+	copy(data, "modified")
+
+	got, err := s.Get(ctx, "doc", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "original" {
+		t.Errorf("Get() = %q: the store kept the caller's slice", got)
+	}
+
+	copy(got, "modified")
+	if again := get(t, s, "doc", "key"); again != "original" {
+		t.Errorf("Get() = %q: the store returned its own slice", again)
+	}
+}
+
+func testList(t *testing.T, s server.Storage) {
+	if keys := list(t, s, "doc", ""); keys == nil || len(keys) != 0 {
+		t.Errorf("List() of an unknown document = %#v, want an empty slice", keys)
+	}
+
+	for _, key := range []string{"changes.2", "snapshot", "changes.10", "changes.1", "actors.json"} {
+		put(t, s, "doc", key, key)
+	}
+	put(t, s, "other", "changes.99", "x")
+
+	want := []string{"actors.json", "changes.1", "changes.10", "changes.2", "snapshot"}
+	if keys := list(t, s, "doc", ""); !reflect.DeepEqual(keys, want) {
+		t.Errorf("List(\"\") = %v, want %v", keys, want)
+	}
+
+	want = []string{"changes.1", "changes.10", "changes.2"}
+	if keys := list(t, s, "doc", "changes."); !reflect.DeepEqual(keys, want) {
+		t.Errorf("List(\"changes.\") = %v, want %v", keys, want)
+	}
+
+	if keys := list(t, s, "doc", "nothing"); len(keys) != 0 {
+		t.Errorf("List(\"nothing\") = %v, want none", keys)
+	}
+}
+
+func testDelete(t *testing.T, s server.Storage) {
+	ctx := context.Background()
+	put(t, s, "doc", "a", "1")
+	put(t, s, "doc", "b", "2")
+
+	if err := s.Delete(ctx, "doc", "a"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := s.Get(ctx, "doc", "a"); !errors.Is(err, server.ErrNotFound) {
+		t.Errorf("Get() after Delete() error = %v, want ErrNotFound", err)
+	}
+	if got := get(t, s, "doc", "b"); got != "2" {
+		t.Errorf("Delete() removed another key: Get(b) = %q", got)
+	}
+
+	// Deleting again, or a key that never existed, is not an error
+	if err := s.Delete(ctx, "doc", "a"); err != nil {
+		t.Errorf("Delete() of a deleted key error = %v", err)
+	}
+	if err := s.Delete(ctx, "unknown", "a"); err != nil {
+		t.Errorf("Delete() in an unknown document error = %v", err)
+	}
+
+	// A deleted key can be stored again
+	put(t, s, "doc", "a", "3")
+	if got := get(t, s, "doc", "a"); got != "3" {
+		t.Errorf("Get() after re-Put = %q, want %q", got, "3")
+	}
+}
+
+func testDocuments(t *testing.T, s server.Storage) {
+	ctx := context.Background()
+	documents := func() []string {
+		t.Helper()
+		ids, err := s.Documents(ctx)
+		if err != nil {
+			t.Fatalf("Documents() error = %v", err)
+		}
+		return ids
+	}
+
+	if ids := documents(); len(ids) != 0 {
+		t.Errorf("Documents() of an empty store = %v", ids)
+	}
+
+	put(t, s, "notes", "snapshot", "x")
+	put(t, s, "default", "snapshot", "x")
+	put(t, s, "default", "actors.json", "{}")
+
+	if ids := documents(); !reflect.DeepEqual(ids, []string{"default", "notes"}) {
+		t.Errorf("Documents() = %v, want [default notes]", ids)
+	}
+
+	// A document whose keys are all deleted is gone
+	if err := s.Delete(ctx, "notes", "snapshot"); err != nil {
+		t.Fatal(err)
+	}
+	if ids := documents(); !reflect.DeepEqual(ids, []string{"default"}) {
+		t.Errorf("Documents() after deleting every key = %v, want [default]", ids)
+	}
+}
+
+func testInvalidNames(t *testing.T, s server.Storage) {
+	ctx := context.Background()
+	for _, name := range []string{"", ".", "..", "../x", "a/b", `a\b`, ".hidden", "a\x00b"} {
+		if err := s.Put(ctx, name, "key", []byte("x")); err == nil {
+			t.Errorf("Put() accepted document ID %q", name)
+		}
+		if err := s.Put(ctx, "doc", name, []byte("x")); err == nil {
+			t.Errorf("Put() accepted key %q", name)
+		}
+		if _, err := s.Get(ctx, "doc", name); err == nil || errors.Is(err, server.ErrNotFound) {
+			t.Errorf("Get() of key %q error = %v, want a validation error", name, err)
+		}
+		if _, err := s.List(ctx, name, ""); err == nil {
+			t.Errorf("List() accepted document ID %q", name)
+		}
+		if err := s.Delete(ctx, "doc", name); err == nil {
+			t.Errorf("Delete() accepted key %q", name)
+		}
+	}
+
+	if ids, err := s.Documents(ctx); err != nil || len(ids) != 0 {
+		t.Errorf("Documents() after rejected writes = %v, %v", ids, err)
+	}
+}
+
+func testConcurrent(t *testing.T, s server.Storage) {
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := string(rune('a' + i))
+			for j := 0; j < 20; j++ {
+				if err := s.Put(ctx, "doc", key, []byte(key)); err != nil {
+					t.Errorf("Put() error = %v", err)
+					return
+				}
+				if _, err := s.Get(ctx, "doc", key); err != nil {
+					t.Errorf("Get() error = %v", err)
+					return
+				}
+				if _, err := s.List(ctx, "doc", ""); err != nil {
+					t.Errorf("List() error = %v", err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if keys := list(t, s, "doc", ""); len(keys) != 8 {
+		t.Errorf("List() after concurrent writes = %v, want 8 keys", keys)
+	}
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/joeblew999/automerge-wazero-example/pkg/automerge"
+)
+
+// newTestServer starts a server persisting to a FileStorage in dir
+func newTestServer(t *testing.T, dir string, compactChanges int) *Server {
+	t.Helper()
+	s := New(Config{
+		StorageDir:     dir,
+		UserID:         "test-user",
+		WASMPath:       automerge.TestWASMPath,
+		CompactChanges: compactChanges,
+		FlushInterval:  time.Hour, // Tests flush explicitly
+	})
+	if err := s.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	return s
+}
+
+// setText sets the text and flushes it to storage
+func setText(t *testing.T, s *Server, text string) {
+	t.Helper()
+	ctx := context.Background()
+	if err := s.SetText(ctx, text); err != nil {
+		t.Fatalf("SetText() error = %v", err)
+	}
+	if err := s.Flush(ctx); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+}
+
+// storedChunks returns the number of change chunks in the server's storage
+func storedChunks(t *testing.T, s *Server) int {
+	t.Helper()
+	keys, err := s.storage.List(context.Background(), s.docID, chunkKeyPrefix)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	return len(keys)
+}
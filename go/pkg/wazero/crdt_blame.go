@@ -0,0 +1,110 @@
+// ==============================================================================
+// Layer 3: Go FFI Wrappers - Text Attribution (Blame)
+// ==============================================================================
+// ARCHITECTURE: This is the FFI wrapper layer (Layer 3/7).
+//
+// RESPONSIBILITIES:
+// - 1:1 wrapping of WASI exports
+// - Go → WASM memory marshaling
+// - Error code handling
+// - Memory allocation/deallocation via am_alloc/am_free
+//
+// DEPENDENCIES:
+// - Layer 2: rust/automerge_wasi/src/blame.rs (WASI exports)
+// - wazero runtime (WASM execution)
+//
+// DEPENDENTS:
+// - Layer 4: pkg/automerge/crdt_blame.go (high-level API)
+//
+// RELATED FILES (1:1 mapping):
+// - Layer 2: rust/automerge_wasi/src/blame.rs (WASI exports)
+// - Layer 4: pkg/automerge/crdt_blame.go (Go high-level API)
+//
+// NOTES:
+// - Results are JSON strings decoded by Layer 4
+// - Heads are passed as concatenated 32-byte change hashes
+// ==============================================================================
+
+package wazero
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+)
+
+// Blame Operations - maps to rust/automerge_wasi/src/blame.rs
+
+// AmTextBlame returns the attribution spans of the text at path as JSON
+func (r *Runtime) AmTextBlame(ctx context.Context, path string) (string, error) {
+	pathPtr, freePath, err := r.writeBytes(ctx, []byte(path))
+	if err != nil {
+		return "", fmt.Errorf("failed to write path: %w", err)
+	}
+	defer freePath()
+
+	results, err := r.callExport(ctx, "am_text_blame_len", uint64(pathPtr), uint64(len(path)))
+	if err != nil {
+		return "", err
+	}
+	return r.readBlameJSON(ctx, "am_text_blame_len", results)
+}
+
+// AmTextBlameDiff returns the inserted and deleted spans of the text at path
+// between the before and after heads as JSON
+func (r *Runtime) AmTextBlameDiff(ctx context.Context, path string, before, after [][]byte) (string, error) {
+	pathPtr, freePath, err := r.writeBytes(ctx, []byte(path))
+	if err != nil {
+		return "", fmt.Errorf("failed to write path: %w", err)
+	}
+	defer freePath()
+
+	beforePtr, freeBefore, err := r.writeBytes(ctx, bytes.Join(before, nil))
+	if err != nil {
+		return "", fmt.Errorf("failed to write before heads: %w", err)
+	}
+	defer freeBefore()
+
+	afterPtr, freeAfter, err := r.writeBytes(ctx, bytes.Join(after, nil))
+	if err != nil {
+		return "", fmt.Errorf("failed to write after heads: %w", err)
+	}
+	defer freeAfter()
+
+	results, err := r.callExport(ctx, "am_text_blame_diff_len",
+		uint64(pathPtr), uint64(len(path)),
+		uint64(beforePtr), uint64(len(before)),
+		uint64(afterPtr), uint64(len(after)))
+	if err != nil {
+		return "", err
+	}
+	return r.readBlameJSON(ctx, "am_text_blame_diff_len", results)
+}
+
+// readBlameJSON fetches the JSON cached by the last am_text_blame*_len call
+func (r *Runtime) readBlameJSON(ctx context.Context, op string, results []uint64) (string, error) {
+	jsonLen := int32(results[0])
+	if jsonLen < 0 {
+		return "", &WASMError{Operation: op, Code: jsonLen}
+	}
+
+	jsonPtr, err := r.AmAlloc(ctx, uint32(jsonLen))
+	if err != nil {
+		return "", fmt.Errorf("failed to allocate JSON buffer: %w", err)
+	}
+	defer r.AmFree(ctx, jsonPtr, uint32(jsonLen))
+
+	results, err = r.callExport(ctx, "am_blame_json", uint64(jsonPtr))
+	if err != nil {
+		return "", err
+	}
+	if err := checkErrorCode("am_blame_json", results); err != nil {
+		return "", err
+	}
+
+	data, ok := r.Memory().Read(jsonPtr, uint32(jsonLen))
+	if !ok {
+		return "", fmt.Errorf("failed to read JSON from WASM memory")
+	}
+	return string(data), nil
+}
@@ -27,6 +27,7 @@
 // - Each method corresponds exactly to one WASI export
 // - No business logic here - just FFI bridging
 // - Cursors maintain stable positions during concurrent edits
+// - Bias (am_cursor): 0 = stick to the element after, 1 = to the element before
 // - Uses r.Memory() to write/read WASM linear memory
 // ==============================================================================
 
@@ -34,7 +35,9 @@ package wazero
 
 import (
 	"context"
+	"encoding/binary"
 	"fmt"
+	"strings"
 )
 
 // GetCursor gets a cursor for a position in a text or list object.
@@ -170,3 +173,101 @@ func (r *Runtime) LookupCursor(ctx context.Context, path string, cursor string)
 
 	return int(index), nil
 }
+
+// AmCursor creates a cursor at index in the text or list object at path,
+// sticking to the element after (bias 0) or before (bias 1) the position.
+//
+// index may equal the object's length.
+func (r *Runtime) AmCursor(ctx context.Context, path string, index uint, bias uint32) (string, error) {
+	pathPtr, freePath, err := r.writeBytes(ctx, []byte(path))
+	if err != nil {
+		return "", fmt.Errorf("failed to write path: %w", err)
+	}
+	defer freePath()
+
+	results, err := r.callExport(ctx, "am_cursor", uint64(pathPtr), uint64(len(path)), uint64(index), uint64(bias))
+	if err != nil {
+		return "", err
+	}
+	cursorLen := int32(results[0])
+	if cursorLen < 0 {
+		return "", &WASMError{Operation: "am_cursor", Code: cursorLen}
+	}
+
+	cursorPtr, err := r.AmAlloc(ctx, uint32(cursorLen))
+	if err != nil {
+		return "", fmt.Errorf("failed to alloc cursor buffer: %w", err)
+	}
+	defer r.AmFree(ctx, cursorPtr, uint32(cursorLen))
+
+	results, err = r.callExport(ctx, "am_get_cursor_str", uint64(cursorPtr))
+	if err != nil {
+		return "", err
+	}
+	if err := checkErrorCode("am_get_cursor_str", results); err != nil {
+		return "", err
+	}
+
+	data, ok := r.Memory().Read(cursorPtr, uint32(cursorLen))
+	if !ok {
+		return "", fmt.Errorf("failed to read cursor from memory")
+	}
+	return string(data), nil
+}
+
+// CursorQuery is one cursor for AmLookupCursors
+type CursorQuery struct {
+	Path   string
+	Cursor string
+	Bias   uint32
+}
+
+// AmLookupCursors looks up many cursors in one call.
+//
+// Each result is the cursor's index, or a negative code: -1 path doesn't
+// resolve, -2 invalid cursor or bias, -3 cursor not in the object.
+func (r *Runtime) AmLookupCursors(ctx context.Context, queries []CursorQuery) ([]int32, error) {
+	if len(queries) == 0 {
+		return nil, nil
+	}
+
+	lines := make([]string, len(queries))
+	for i, q := range queries {
+		if strings.ContainsAny(q.Path+q.Cursor, "\t\n") {
+			return nil, fmt.Errorf("invalid cursor query %d", i)
+		}
+		lines[i] = fmt.Sprintf("%d\t%s\t%s", q.Bias, q.Path, q.Cursor)
+	}
+	req := strings.Join(lines, "\n")
+
+	reqPtr, freeReq, err := r.writeBytes(ctx, []byte(req))
+	if err != nil {
+		return nil, fmt.Errorf("failed to write cursors: %w", err)
+	}
+	defer freeReq()
+
+	outLen := uint32(4 * len(queries))
+	outPtr, err := r.AmAlloc(ctx, outLen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to alloc results buffer: %w", err)
+	}
+	defer r.AmFree(ctx, outPtr, outLen)
+
+	results, err := r.callExport(ctx, "am_lookup_cursors", uint64(reqPtr), uint64(len(req)), uint64(outPtr))
+	if err != nil {
+		return nil, err
+	}
+	if n := int32(results[0]); n != int32(len(queries)) {
+		return nil, &WASMError{Operation: "am_lookup_cursors", Code: n}
+	}
+
+	data, ok := r.Memory().Read(outPtr, outLen)
+	if !ok {
+		return nil, fmt.Errorf("failed to read cursor positions from memory")
+	}
+	indexes := make([]int32, len(queries))
+	for i := range indexes {
+		indexes[i] = int32(binary.LittleEndian.Uint32(data[4*i:]))
+	}
+	return indexes, nil
+}
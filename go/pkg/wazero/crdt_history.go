@@ -33,6 +33,7 @@
 package wazero
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 )
@@ -246,3 +247,51 @@ func (r *Runtime) AmApplyChanges(ctx context.Context, changes []byte) error {
 	}
 	return checkErrorCode("am_apply_changes", results)
 }
+
+// AmDiffPaths returns the paths the changes between the before and after
+// heads touched, as JSON (an array of key/index arrays)
+func (r *Runtime) AmDiffPaths(ctx context.Context, before, after [][]byte) (string, error) {
+	beforePtr, freeBefore, err := r.writeBytes(ctx, bytes.Join(before, nil))
+	if err != nil {
+		return "", fmt.Errorf("failed to write before heads: %w", err)
+	}
+	defer freeBefore()
+
+	afterPtr, freeAfter, err := r.writeBytes(ctx, bytes.Join(after, nil))
+	if err != nil {
+		return "", fmt.Errorf("failed to write after heads: %w", err)
+	}
+	defer freeAfter()
+
+	// Render JSON (cached on the Rust side) and get its length
+	results, err := r.callExport(ctx, "am_diff_paths_len",
+		uint64(beforePtr), uint64(len(before)),
+		uint64(afterPtr), uint64(len(after)))
+	if err != nil {
+		return "", err
+	}
+	jsonLen := int32(results[0])
+	if jsonLen < 0 {
+		return "", &WASMError{Operation: "am_diff_paths_len", Code: jsonLen}
+	}
+
+	jsonPtr, err := r.AmAlloc(ctx, uint32(jsonLen))
+	if err != nil {
+		return "", fmt.Errorf("failed to allocate paths buffer: %w", err)
+	}
+	defer r.AmFree(ctx, jsonPtr, uint32(jsonLen))
+
+	results, err = r.callExport(ctx, "am_diff_paths", uint64(jsonPtr))
+	if err != nil {
+		return "", err
+	}
+	if err := checkErrorCode("am_diff_paths", results); err != nil {
+		return "", err
+	}
+
+	data, ok := r.Memory().Read(jsonPtr, uint32(jsonLen))
+	if !ok {
+		return "", fmt.Errorf("failed to read paths from WASM memory")
+	}
+	return string(data), nil
+}
@@ -0,0 +1,246 @@
+// ==============================================================================
+// Layer 3: Go FFI Wrappers - Path-Based Object Operations
+// ==============================================================================
+// ARCHITECTURE: This is the FFI wrapper layer (Layer 3/7).
+//
+// RESPONSIBILITIES:
+// - 1:1 wrapping of WASI exports
+// - Go → WASM memory marshaling
+// - Error code handling
+// - Memory allocation/deallocation via am_alloc/am_free
+//
+// DEPENDENCIES:
+// - Layer 2: rust/automerge_wasi/src/object.rs (WASI exports)
+// - wazero runtime (WASM execution)
+//
+// DEPENDENTS:
+// - Layer 4: pkg/automerge/crdt_json.go (structural JSON updates)
+//
+// RELATED FILES (1:1 mapping):
+// - Layer 2: rust/automerge_wasi/src/object.rs (WASI exports)
+// - Layer 4: pkg/automerge/crdt_json.go (Go high-level API)
+//
+// NOTES:
+// - Each method corresponds exactly to one WASI export
+// - Paths are dotted strings ("ROOT.config.retries"), built by Layer 4
+// - Scalars travel as (kind, bytes); kinds are defined in pkg/automerge/types.go
+// ==============================================================================
+
+package wazero
+
+import (
+	"context"
+	"fmt"
+)
+
+// Path-Based Object Operations - maps to rust/automerge_wasi/src/object.rs
+
+// AmObjPut puts a scalar at prop (map key or list index) in the object at path
+func (r *Runtime) AmObjPut(ctx context.Context, path, prop string, kind uint8, value []byte) error {
+	pathPtr, freePath, err := r.writeBytes(ctx, []byte(path))
+	if err != nil {
+		return fmt.Errorf("failed to write path: %w", err)
+	}
+	defer freePath()
+
+	propPtr, freeProp, err := r.writeBytes(ctx, []byte(prop))
+	if err != nil {
+		return fmt.Errorf("failed to write prop: %w", err)
+	}
+	defer freeProp()
+
+	valuePtr, freeValue, err := r.writeBytes(ctx, value)
+	if err != nil {
+		return fmt.Errorf("failed to write value: %w", err)
+	}
+	defer freeValue()
+
+	results, err := r.callExport(ctx, "am_obj_put",
+		uint64(pathPtr), uint64(len(path)),
+		uint64(propPtr), uint64(len(prop)),
+		uint64(kind),
+		uint64(valuePtr), uint64(len(value)))
+	if err != nil {
+		return err
+	}
+	return checkErrorCode("am_obj_put", results)
+}
+
+// AmObjPutObject creates an empty map (0), list (1) or text (2) at prop in the object at path
+func (r *Runtime) AmObjPutObject(ctx context.Context, path, prop string, objType uint8) error {
+	pathPtr, freePath, err := r.writeBytes(ctx, []byte(path))
+	if err != nil {
+		return fmt.Errorf("failed to write path: %w", err)
+	}
+	defer freePath()
+
+	propPtr, freeProp, err := r.writeBytes(ctx, []byte(prop))
+	if err != nil {
+		return fmt.Errorf("failed to write prop: %w", err)
+	}
+	defer freeProp()
+
+	results, err := r.callExport(ctx, "am_obj_put_object",
+		uint64(pathPtr), uint64(len(path)),
+		uint64(propPtr), uint64(len(prop)),
+		uint64(objType))
+	if err != nil {
+		return err
+	}
+	return checkErrorCode("am_obj_put_object", results)
+}
+
+// AmObjDelete deletes prop (map key or list index) from the object at path
+func (r *Runtime) AmObjDelete(ctx context.Context, path, prop string) error {
+	pathPtr, freePath, err := r.writeBytes(ctx, []byte(path))
+	if err != nil {
+		return fmt.Errorf("failed to write path: %w", err)
+	}
+	defer freePath()
+
+	propPtr, freeProp, err := r.writeBytes(ctx, []byte(prop))
+	if err != nil {
+		return fmt.Errorf("failed to write prop: %w", err)
+	}
+	defer freeProp()
+
+	results, err := r.callExport(ctx, "am_obj_delete",
+		uint64(pathPtr), uint64(len(path)),
+		uint64(propPtr), uint64(len(prop)))
+	if err != nil {
+		return err
+	}
+	return checkErrorCode("am_obj_delete", results)
+}
+
+// AmObjIncrement increments the counter at prop in the object at path by delta
+func (r *Runtime) AmObjIncrement(ctx context.Context, path, prop string, delta int64) error {
+	pathPtr, freePath, err := r.writeBytes(ctx, []byte(path))
+	if err != nil {
+		return fmt.Errorf("failed to write path: %w", err)
+	}
+	defer freePath()
+
+	propPtr, freeProp, err := r.writeBytes(ctx, []byte(prop))
+	if err != nil {
+		return fmt.Errorf("failed to write prop: %w", err)
+	}
+	defer freeProp()
+
+	results, err := r.callExport(ctx, "am_obj_increment",
+		uint64(pathPtr), uint64(len(path)),
+		uint64(propPtr), uint64(len(prop)),
+		uint64(delta))
+	if err != nil {
+		return err
+	}
+	return checkErrorCode("am_obj_increment", results)
+}
+
+// AmObjInsert inserts a scalar at index in the list at path
+func (r *Runtime) AmObjInsert(ctx context.Context, path string, index uint, kind uint8, value []byte) error {
+	pathPtr, freePath, err := r.writeBytes(ctx, []byte(path))
+	if err != nil {
+		return fmt.Errorf("failed to write path: %w", err)
+	}
+	defer freePath()
+
+	valuePtr, freeValue, err := r.writeBytes(ctx, value)
+	if err != nil {
+		return fmt.Errorf("failed to write value: %w", err)
+	}
+	defer freeValue()
+
+	results, err := r.callExport(ctx, "am_obj_insert",
+		uint64(pathPtr), uint64(len(path)),
+		uint64(index),
+		uint64(kind),
+		uint64(valuePtr), uint64(len(value)))
+	if err != nil {
+		return err
+	}
+	return checkErrorCode("am_obj_insert", results)
+}
+
+// AmObjInsertObject inserts an empty map (0), list (1) or text (2) at index in the list at path
+func (r *Runtime) AmObjInsertObject(ctx context.Context, path string, index uint, objType uint8) error {
+	pathPtr, freePath, err := r.writeBytes(ctx, []byte(path))
+	if err != nil {
+		return fmt.Errorf("failed to write path: %w", err)
+	}
+	defer freePath()
+
+	results, err := r.callExport(ctx, "am_obj_insert_object",
+		uint64(pathPtr), uint64(len(path)),
+		uint64(index),
+		uint64(objType))
+	if err != nil {
+		return err
+	}
+	return checkErrorCode("am_obj_insert_object", results)
+}
+
+// AmObjSpliceText splices the text object at path
+func (r *Runtime) AmObjSpliceText(ctx context.Context, path string, pos uint, del int64, text string) error {
+	pathPtr, freePath, err := r.writeBytes(ctx, []byte(path))
+	if err != nil {
+		return fmt.Errorf("failed to write path: %w", err)
+	}
+	defer freePath()
+
+	textPtr, freeText, err := r.writeBytes(ctx, []byte(text))
+	if err != nil {
+		return fmt.Errorf("failed to write text: %w", err)
+	}
+	defer freeText()
+
+	results, err := r.callExport(ctx, "am_obj_splice_text",
+		uint64(pathPtr), uint64(len(path)),
+		uint64(pos),
+		uint64(del),
+		uint64(textPtr), uint64(len(text)))
+	if err != nil {
+		return err
+	}
+	return checkErrorCode("am_obj_splice_text", results)
+}
+
+// AmObjJSON returns the value at path rendered as typed JSON
+func (r *Runtime) AmObjJSON(ctx context.Context, path string) (string, error) {
+	pathPtr, freePath, err := r.writeBytes(ctx, []byte(path))
+	if err != nil {
+		return "", fmt.Errorf("failed to write path: %w", err)
+	}
+	defer freePath()
+
+	// Render JSON (cached on the Rust side) and get its length
+	results, err := r.callExport(ctx, "am_obj_json_len", uint64(pathPtr), uint64(len(path)))
+	if err != nil {
+		return "", err
+	}
+	jsonLen := int32(results[0])
+	if jsonLen < 0 {
+		return "", &WASMError{Operation: "am_obj_json_len", Code: jsonLen}
+	}
+
+	jsonPtr, err := r.AmAlloc(ctx, uint32(jsonLen))
+	if err != nil {
+		return "", fmt.Errorf("failed to allocate JSON buffer: %w", err)
+	}
+	defer r.AmFree(ctx, jsonPtr, uint32(jsonLen))
+
+	results, err = r.callExport(ctx, "am_obj_json", uint64(jsonPtr))
+	if err != nil {
+		return "", err
+	}
+	if err := checkErrorCode("am_obj_json", results); err != nil {
+		return "", err
+	}
+
+	data, ok := r.Memory().Read(jsonPtr, uint32(jsonLen))
+	if !ok {
+		return "", fmt.Errorf("failed to read JSON from WASM memory")
+	}
+
+	return string(data), nil
+}
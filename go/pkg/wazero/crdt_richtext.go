@@ -32,58 +32,68 @@
 package wazero
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 )
 
 // Rich Text (Marks) - maps to rust/automerge_wasi/src/richtext.rs
 
-// AmMark adds a mark (formatting) to a range of text
-func (r *Runtime) AmMark(ctx context.Context, name, value string, start, end uint, expand uint8) error {
-	nameBytes := []byte(name)
-	valueBytes := []byte(value)
+// AmMark adds a mark (formatting) to a range of text. The value is passed
+// as a scalar kind plus its encoding (see rust/automerge_wasi/src/value.rs).
+func (r *Runtime) AmMark(ctx context.Context, name string, kind uint8, value []byte, start, end uint, expand uint8) error {
+	namePtr, freeName, err := r.writeBytes(ctx, []byte(name))
+	if err != nil {
+		return fmt.Errorf("failed to write name: %w", err)
+	}
+	defer freeName()
 
-	namePtr := uint32(1)
-	valuePtr := uint32(1)
-	mem := r.Memory()
+	valuePtr, freeValue, err := r.writeBytes(ctx, value)
+	if err != nil {
+		return fmt.Errorf("failed to write value: %w", err)
+	}
+	defer freeValue()
 
-	// Allocate and write name
-	if len(nameBytes) > 0 {
-		var err error
-		namePtr, err = r.AmAlloc(ctx, uint32(len(nameBytes)))
-		if err != nil {
-			return fmt.Errorf("failed to allocate name: %w", err)
-		}
-		defer r.AmFree(ctx, namePtr, uint32(len(nameBytes)))
+	// Call am_mark
+	results, err := r.callExport(ctx, "am_mark",
+		uint64(namePtr), uint64(len(name)),
+		uint64(kind), uint64(valuePtr), uint64(len(value)),
+		uint64(start), uint64(end), uint64(expand))
+	if err != nil {
+		return err
+	}
+	return checkErrorCode("am_mark", results)
+}
 
-		if !mem.Write(namePtr, nameBytes) {
-			return fmt.Errorf("failed to write name to WASM memory")
-		}
+// AmObjMark adds a mark to a range of the text object at path
+func (r *Runtime) AmObjMark(ctx context.Context, path, name string, kind uint8, value []byte, start, end uint, expand uint8) error {
+	pathPtr, freePath, err := r.writeBytes(ctx, []byte(path))
+	if err != nil {
+		return fmt.Errorf("failed to write path: %w", err)
 	}
+	defer freePath()
 
-	// Allocate and write value
-	if len(valueBytes) > 0 {
-		var err error
-		valuePtr, err = r.AmAlloc(ctx, uint32(len(valueBytes)))
-		if err != nil {
-			return fmt.Errorf("failed to allocate value: %w", err)
-		}
-		defer r.AmFree(ctx, valuePtr, uint32(len(valueBytes)))
+	namePtr, freeName, err := r.writeBytes(ctx, []byte(name))
+	if err != nil {
+		return fmt.Errorf("failed to write name: %w", err)
+	}
+	defer freeName()
 
-		if !mem.Write(valuePtr, valueBytes) {
-			return fmt.Errorf("failed to write value to WASM memory")
-		}
+	valuePtr, freeValue, err := r.writeBytes(ctx, value)
+	if err != nil {
+		return fmt.Errorf("failed to write value: %w", err)
 	}
+	defer freeValue()
 
-	// Call am_mark
-	results, err := r.callExport(ctx, "am_mark",
-		uint64(namePtr), uint64(len(nameBytes)),
-		uint64(valuePtr), uint64(len(valueBytes)),
+	results, err := r.callExport(ctx, "am_obj_mark",
+		uint64(pathPtr), uint64(len(path)),
+		uint64(namePtr), uint64(len(name)),
+		uint64(kind), uint64(valuePtr), uint64(len(value)),
 		uint64(start), uint64(end), uint64(expand))
 	if err != nil {
 		return err
 	}
-	return checkErrorCode("am_mark", results)
+	return checkErrorCode("am_obj_mark", results)
 }
 
 // AmUnmark removes a mark (formatting) from a range of text
@@ -115,6 +125,30 @@ func (r *Runtime) AmUnmark(ctx context.Context, name string, start, end uint, ex
 	return checkErrorCode("am_unmark", results)
 }
 
+// AmObjUnmark removes a mark from a range of the text at path
+func (r *Runtime) AmObjUnmark(ctx context.Context, path, name string, start, end uint, expand uint8) error {
+	pathPtr, freePath, err := r.writeBytes(ctx, []byte(path))
+	if err != nil {
+		return fmt.Errorf("failed to write path: %w", err)
+	}
+	defer freePath()
+
+	namePtr, freeName, err := r.writeBytes(ctx, []byte(name))
+	if err != nil {
+		return fmt.Errorf("failed to write name: %w", err)
+	}
+	defer freeName()
+
+	results, err := r.callExport(ctx, "am_obj_unmark",
+		uint64(pathPtr), uint64(len(path)),
+		uint64(namePtr), uint64(len(name)),
+		uint64(start), uint64(end), uint64(expand))
+	if err != nil {
+		return err
+	}
+	return checkErrorCode("am_obj_unmark", results)
+}
+
 // AmGetMarksCount returns the number of marks at a specific index
 func (r *Runtime) AmGetMarksCount(ctx context.Context, index uint) (uint32, error) {
 	results, err := r.callExport(ctx, "am_get_marks_count", uint64(index))
@@ -124,7 +158,27 @@ func (r *Runtime) AmGetMarksCount(ctx context.Context, index uint) (uint32, erro
 	return uint32(results[0]), nil
 }
 
-// AmMarksLen returns the length of the marks JSON string
+// AmObjGetMarksCount gets the number of marks at index in the text at path
+func (r *Runtime) AmObjGetMarksCount(ctx context.Context, path string, index uint) (uint32, error) {
+	pathPtr, freePath, err := r.writeBytes(ctx, []byte(path))
+	if err != nil {
+		return 0, fmt.Errorf("failed to write path: %w", err)
+	}
+	defer freePath()
+
+	results, err := r.callExport(ctx, "am_obj_get_marks_count", uint64(pathPtr), uint64(len(path)), uint64(index))
+	if err != nil {
+		return 0, err
+	}
+	count := int32(results[0])
+	if count < 0 {
+		return 0, &WASMError{Operation: "am_obj_get_marks_count", Code: count}
+	}
+	return uint32(count), nil
+}
+
+// AmMarksLen renders all marks as JSON (cached on the Rust side) and
+// returns its length
 func (r *Runtime) AmMarksLen(ctx context.Context) (uint32, error) {
 	results, err := r.callExport(ctx, "am_marks_len")
 	if err != nil {
@@ -167,23 +221,169 @@ func (r *Runtime) AmMarks(ctx context.Context) (string, error) {
 		return "", fmt.Errorf("failed to read marks from WASM memory")
 	}
 
-	// Trim to actual JSON length
-	// The JSON is an array, so find the closing ] or null byte
-	jsonEnd := -1
-	for i, b := range marksBytes {
-		if b == ']' {
-			jsonEnd = i + 1
-			break
-		}
-		if b == 0 {
-			jsonEnd = i
-			break
-		}
+	return string(marksBytes), nil
+}
+
+// AmObjMarks retrieves all marks in the text at path as JSON
+func (r *Runtime) AmObjMarks(ctx context.Context, path string) (string, error) {
+	pathPtr, freePath, err := r.writeBytes(ctx, []byte(path))
+	if err != nil {
+		return "", fmt.Errorf("failed to write path: %w", err)
 	}
+	defer freePath()
 
-	if jsonEnd > 0 {
-		marksBytes = marksBytes[:jsonEnd]
+	// Render JSON (cached on the Rust side) and get its length
+	results, err := r.callExport(ctx, "am_obj_marks_len", uint64(pathPtr), uint64(len(path)))
+	if err != nil {
+		return "", err
+	}
+	jsonLen := int32(results[0])
+	if jsonLen < 0 {
+		return "", &WASMError{Operation: "am_obj_marks_len", Code: jsonLen}
 	}
 
-	return string(marksBytes), nil
+	jsonPtr, err := r.AmAlloc(ctx, uint32(jsonLen))
+	if err != nil {
+		return "", fmt.Errorf("failed to allocate marks buffer: %w", err)
+	}
+	defer r.AmFree(ctx, jsonPtr, uint32(jsonLen))
+
+	results, err = r.callExport(ctx, "am_marks", uint64(jsonPtr))
+	if err != nil {
+		return "", err
+	}
+	if err := checkErrorCode("am_marks", results); err != nil {
+		return "", err
+	}
+
+	data, ok := r.Memory().Read(jsonPtr, uint32(jsonLen))
+	if !ok {
+		return "", fmt.Errorf("failed to read marks from WASM memory")
+	}
+	return string(data), nil
+}
+
+// AmSpans renders the text at path as spans of text (with active marks)
+// and block markers, as JSON
+func (r *Runtime) AmSpans(ctx context.Context, path string) (string, error) {
+	pathPtr, freePath, err := r.writeBytes(ctx, []byte(path))
+	if err != nil {
+		return "", fmt.Errorf("failed to write path: %w", err)
+	}
+	defer freePath()
+
+	// Render JSON (cached on the Rust side) and get its length
+	results, err := r.callExport(ctx, "am_spans_len", uint64(pathPtr), uint64(len(path)))
+	if err != nil {
+		return "", err
+	}
+	jsonLen := int32(results[0])
+	if jsonLen < 0 {
+		return "", &WASMError{Operation: "am_spans_len", Code: jsonLen}
+	}
+
+	jsonPtr, err := r.AmAlloc(ctx, uint32(jsonLen))
+	if err != nil {
+		return "", fmt.Errorf("failed to allocate spans buffer: %w", err)
+	}
+	defer r.AmFree(ctx, jsonPtr, uint32(jsonLen))
+
+	results, err = r.callExport(ctx, "am_spans", uint64(jsonPtr))
+	if err != nil {
+		return "", err
+	}
+	if err := checkErrorCode("am_spans", results); err != nil {
+		return "", err
+	}
+
+	data, ok := r.Memory().Read(jsonPtr, uint32(jsonLen))
+	if !ok {
+		return "", fmt.Errorf("failed to read spans from WASM memory")
+	}
+	return string(data), nil
+}
+
+// AmTextPatches returns the edits to the text at path between the before
+// and after heads as JSON patches
+func (r *Runtime) AmTextPatches(ctx context.Context, path string, before, after [][]byte) (string, error) {
+	pathPtr, freePath, err := r.writeBytes(ctx, []byte(path))
+	if err != nil {
+		return "", fmt.Errorf("failed to write path: %w", err)
+	}
+	defer freePath()
+
+	beforePtr, freeBefore, err := r.writeBytes(ctx, bytes.Join(before, nil))
+	if err != nil {
+		return "", fmt.Errorf("failed to write before heads: %w", err)
+	}
+	defer freeBefore()
+
+	afterPtr, freeAfter, err := r.writeBytes(ctx, bytes.Join(after, nil))
+	if err != nil {
+		return "", fmt.Errorf("failed to write after heads: %w", err)
+	}
+	defer freeAfter()
+
+	// Render JSON (cached on the Rust side) and get its length
+	results, err := r.callExport(ctx, "am_text_patches_len",
+		uint64(pathPtr), uint64(len(path)),
+		uint64(beforePtr), uint64(len(before)),
+		uint64(afterPtr), uint64(len(after)))
+	if err != nil {
+		return "", err
+	}
+	jsonLen := int32(results[0])
+	if jsonLen < 0 {
+		return "", &WASMError{Operation: "am_text_patches_len", Code: jsonLen}
+	}
+
+	jsonPtr, err := r.AmAlloc(ctx, uint32(jsonLen))
+	if err != nil {
+		return "", fmt.Errorf("failed to allocate patches buffer: %w", err)
+	}
+	defer r.AmFree(ctx, jsonPtr, uint32(jsonLen))
+
+	results, err = r.callExport(ctx, "am_text_patches", uint64(jsonPtr))
+	if err != nil {
+		return "", err
+	}
+	if err := checkErrorCode("am_text_patches", results); err != nil {
+		return "", err
+	}
+
+	data, ok := r.Memory().Read(jsonPtr, uint32(jsonLen))
+	if !ok {
+		return "", fmt.Errorf("failed to read patches from WASM memory")
+	}
+	return string(data), nil
+}
+
+// AmSplitBlock inserts an empty block marker at index in the text at path
+func (r *Runtime) AmSplitBlock(ctx context.Context, path string, index uint) error {
+	pathPtr, freePath, err := r.writeBytes(ctx, []byte(path))
+	if err != nil {
+		return fmt.Errorf("failed to write path: %w", err)
+	}
+	defer freePath()
+
+	results, err := r.callExport(ctx, "am_split_block", uint64(pathPtr), uint64(len(path)), uint64(index))
+	if err != nil {
+		return err
+	}
+	return checkErrorCode("am_split_block", results)
+}
+
+// AmJoinBlock removes the block marker at index in the text at path
+func (r *Runtime) AmJoinBlock(ctx context.Context, path string, index uint) error {
+	pathPtr, freePath, err := r.writeBytes(ctx, []byte(path))
+	if err != nil {
+		return fmt.Errorf("failed to write path: %w", err)
+	}
+	defer freePath()
+
+	results, err := r.callExport(ctx, "am_join_block", uint64(pathPtr), uint64(len(path)), uint64(index))
+	if err != nil {
+		return err
+	}
+	return checkErrorCode("am_join_block", results)
 }
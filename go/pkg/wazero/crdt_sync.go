@@ -21,6 +21,7 @@
 package wazero
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 )
@@ -133,3 +134,59 @@ func (r *Runtime) AmSyncRecv(ctx context.Context, peerID uint32, msg []byte) err
 	}
 	return checkErrorCode("am_sync_recv", results)
 }
+
+// AmSyncStateEncode encodes a peer's sync state for storage
+func (r *Runtime) AmSyncStateEncode(ctx context.Context, peerID uint32) ([]byte, error) {
+	// Encode (cached on the Rust side) and get its length
+	results, err := r.callExport(ctx, "am_sync_state_encode_len", uint64(peerID))
+	if err != nil {
+		return nil, err
+	}
+	stateLen := int32(results[0])
+	if stateLen < 0 {
+		return nil, &WASMError{Operation: "am_sync_state_encode_len", Code: stateLen}
+	}
+	if stateLen == 0 {
+		return []byte{}, nil
+	}
+
+	statePtr, err := r.AmAlloc(ctx, uint32(stateLen))
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate sync state buffer: %w", err)
+	}
+	defer r.AmFree(ctx, statePtr, uint32(stateLen))
+
+	results, err = r.callExport(ctx, "am_sync_state_encode", uint64(statePtr))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkErrorCode("am_sync_state_encode", results); err != nil {
+		return nil, err
+	}
+
+	data, ok := r.Memory().Read(statePtr, uint32(stateLen))
+	if !ok {
+		return nil, fmt.Errorf("failed to read sync state from WASM memory")
+	}
+	return bytes.Clone(data), nil
+}
+
+// AmSyncStateLoad starts a peer connection from a state encoded by
+// AmSyncStateEncode. Returns peer_id (> 0) on success.
+func (r *Runtime) AmSyncStateLoad(ctx context.Context, state []byte) (uint32, error) {
+	statePtr, freeState, err := r.writeBytes(ctx, state)
+	if err != nil {
+		return 0, fmt.Errorf("failed to write sync state: %w", err)
+	}
+	defer freeState()
+
+	results, err := r.callExport(ctx, "am_sync_state_load", uint64(statePtr), uint64(len(state)))
+	if err != nil {
+		return 0, err
+	}
+	peerID := uint32(results[0])
+	if peerID == 0 {
+		return 0, fmt.Errorf("am_sync_state_load: invalid sync state")
+	}
+	return peerID, nil
+}
@@ -0,0 +1,103 @@
+// ==============================================================================
+// Layer 3: Go FFI Wrappers - Revert (Undo/Redo support)
+// ==============================================================================
+// ARCHITECTURE: This is the FFI wrapper layer (Layer 3/7).
+//
+// RESPONSIBILITIES:
+// - 1:1 wrapping of WASI exports
+// - Go → WASM memory marshaling
+// - Error code handling
+// - Memory allocation/deallocation via am_alloc/am_free
+//
+// DEPENDENCIES:
+// - Layer 2: rust/automerge_wasi/src/undo.rs (WASI exports)
+// - wazero runtime (WASM execution)
+//
+// DEPENDENTS:
+// - Layer 4: pkg/automerge/crdt_undo.go (UndoManager)
+//
+// RELATED FILES (1:1 mapping):
+// - Layer 2: rust/automerge_wasi/src/undo.rs (WASI exports)
+// - Layer 4: pkg/automerge/crdt_undo.go (Go high-level API)
+//
+// NOTES:
+// - Each method corresponds exactly to one WASI export
+// - Heads are passed as concatenated 32-byte change hashes
+// - Replaced IDs are passed as "old\tnew" lines, in and out
+// ==============================================================================
+
+package wazero
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+)
+
+// Revert Operations - maps to rust/automerge_wasi/src/undo.rs
+
+// AmRevert applies a new change that reverts the edits made between the
+// before and after heads.
+//
+// remap lists the op and element IDs replaced by earlier reverts ("old\tnew"
+// lines); the IDs this revert replaced are returned in the same form.
+func (r *Runtime) AmRevert(ctx context.Context, before, after [][]byte, remap string) (string, error) {
+	beforePtr, freeBefore, err := r.writeBytes(ctx, bytes.Join(before, nil))
+	if err != nil {
+		return "", fmt.Errorf("failed to write before heads: %w", err)
+	}
+	defer freeBefore()
+
+	afterPtr, freeAfter, err := r.writeBytes(ctx, bytes.Join(after, nil))
+	if err != nil {
+		return "", fmt.Errorf("failed to write after heads: %w", err)
+	}
+	defer freeAfter()
+
+	remapPtr, freeRemap, err := r.writeBytes(ctx, []byte(remap))
+	if err != nil {
+		return "", fmt.Errorf("failed to write remap: %w", err)
+	}
+	defer freeRemap()
+
+	results, err := r.callExport(ctx, "am_revert",
+		uint64(beforePtr), uint64(len(before)),
+		uint64(afterPtr), uint64(len(after)),
+		uint64(remapPtr), uint64(len(remap)))
+	if err != nil {
+		return "", err
+	}
+	if err := checkErrorCode("am_revert", results); err != nil {
+		return "", err
+	}
+
+	// IDs replaced by this revert (cached on the Rust side)
+	results, err = r.callExport(ctx, "am_revert_remap_len")
+	if err != nil {
+		return "", err
+	}
+	n := uint32(results[0])
+	if n == 0 {
+		return "", nil
+	}
+
+	ptr, err := r.AmAlloc(ctx, n)
+	if err != nil {
+		return "", fmt.Errorf("failed to allocate remap buffer: %w", err)
+	}
+	defer r.AmFree(ctx, ptr, n)
+
+	results, err = r.callExport(ctx, "am_revert_remap", uint64(ptr))
+	if err != nil {
+		return "", err
+	}
+	if err := checkErrorCode("am_revert_remap", results); err != nil {
+		return "", err
+	}
+
+	data, ok := r.Memory().Read(ptr, n)
+	if !ok {
+		return "", fmt.Errorf("failed to read remap from WASM memory")
+	}
+	return string(data), nil
+}
@@ -204,3 +204,36 @@ func (r *Runtime) AmFork(ctx context.Context) error {
 	}
 	return checkErrorCode("am_fork", results)
 }
+
+// AmCommit commits pending operations as one change with a message and a
+// Unix timestamp (seconds). Returns false if there was nothing to commit.
+func (r *Runtime) AmCommit(ctx context.Context, message string, timestamp int64) (bool, error) {
+	msgPtr, freeMsg, err := r.writeBytes(ctx, []byte(message))
+	if err != nil {
+		return false, fmt.Errorf("failed to write message: %w", err)
+	}
+	defer freeMsg()
+
+	results, err := r.callExport(ctx, "am_commit", uint64(msgPtr), uint64(len(message)), uint64(timestamp))
+	if err != nil {
+		return false, err
+	}
+	code := int32(results[0])
+	if code < 0 {
+		return false, &WASMError{Operation: "am_commit", Code: code}
+	}
+	return code == 1, nil
+}
+
+// AmRollback discards the pending operations and returns how many there were
+func (r *Runtime) AmRollback(ctx context.Context) (int, error) {
+	results, err := r.callExport(ctx, "am_rollback")
+	if err != nil {
+		return 0, err
+	}
+	code := int32(results[0])
+	if code < 0 {
+		return 0, &WASMError{Operation: "am_rollback", Code: code}
+	}
+	return int(code), nil
+}
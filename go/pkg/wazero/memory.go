@@ -27,3 +27,27 @@ func (r *Runtime) AmFree(ctx context.Context, ptr uint32, size uint32) error {
 	_, err := r.callExport(ctx, "am_free", uint64(ptr), uint64(size))
 	return err
 }
+
+// writeBytes copies data into freshly allocated WASM memory.
+//
+// Empty data is passed as pointer 1 with length 0 (never null), matching the
+// convention used by the exports. The returned free func must always be called.
+func (r *Runtime) writeBytes(ctx context.Context, data []byte) (uint32, func(), error) {
+	if len(data) == 0 {
+		return 1, func() {}, nil
+	}
+
+	size := uint32(len(data))
+	ptr, err := r.AmAlloc(ctx, size)
+	if err != nil {
+		return 0, func() {}, err
+	}
+	free := func() { r.AmFree(ctx, ptr, size) }
+
+	if !r.Memory().Write(ptr, data) {
+		free()
+		return 0, func() {}, fmt.Errorf("failed to write %d bytes to WASM memory", size)
+	}
+
+	return ptr, free, nil
+}
@@ -78,6 +78,12 @@ func (r *Runtime) Memory() api.Memory {
 	return r.modInst.Memory()
 }
 
+// MemorySize returns the size of the WASM linear memory in bytes. Linear
+// memory only grows, so this is the module's high-water mark.
+func (r *Runtime) MemorySize() uint64 {
+	return uint64(r.modInst.Memory().Size())
+}
+
 // callExport is a helper to call a WASM export and check for errors
 func (r *Runtime) callExport(ctx context.Context, name string, params ...uint64) ([]uint64, error) {
 	fn := r.modInst.ExportedFunction(name)
@@ -0,0 +1,354 @@
+// ==============================================================================
+// Layer 2: Rust WASI Exports - Text Attribution (Blame)
+// ==============================================================================
+// ARCHITECTURE: This is the WASI export layer (Layer 2/7).
+//
+// RESPONSIBILITIES:
+// - WASI-compatible function exports (C ABI)
+// - Attribute each character of a text object to the change that inserted it
+// - Report inserted/deleted spans (with author) between two sets of heads
+// - Error code translation (Rust Result → i32)
+//
+// DEPENDENCIES:
+// - Layer 1: automerge crate (CRDT core)
+// - crate::state (global document state)
+// - crate::path, crate::value (shared helpers)
+//
+// DEPENDENTS:
+// - Layer 3: pkg/wazero/crdt_blame.go (FFI wrappers)
+//
+// RELATED FILES (1:1 mapping):
+// - Layer 3: pkg/wazero/crdt_blame.go (Go FFI wrappers)
+// - Layer 4: pkg/automerge/crdt_blame.go (Go high-level API)
+// - Layer 5: pkg/server/crdt_blame.go (actor → user mapping)
+// - Layer 6: pkg/api/crdt_blame.go (HTTP handlers)
+//
+// NOTES:
+// - All exports use #[no_mangle] and extern "C"
+// - Results are JSON, cached and fetched with am_blame_json (len-then-fetch)
+// - Spans are [start, end) character (code point) ranges
+// - Times are the change timestamps (Unix seconds, 0 if never set)
+// - Return JSON length on success, negative error codes on failure:
+//     -1 invalid argument
+//     -2 path does not resolve to a text object
+//     -3 unknown change hash
+//     -4 document not initialized
+// ==============================================================================
+
+use crate::path::{read_heads, read_str, resolve_path, visible_at};
+use crate::state::with_doc_mut;
+use crate::value::push_json_str;
+use automerge::{AutoCommit, ChangeHash, ObjId, ObjType, PatchAction, ReadDoc, ScalarValue, Value};
+use std::cell::RefCell;
+use std::collections::HashMap;
+
+thread_local! {
+    static LAST_BLAME: RefCell<String> = RefCell::new(String::new());
+}
+
+/// The change that produced an operation.
+#[derive(Clone)]
+struct ChangeInfo {
+    hash: ChangeHash,
+    actor: String,
+    time: i64,
+    start_op: u64,
+    max_op: u64,
+    deps: Vec<ChangeHash>,
+}
+
+/// Lookup from operation ID (counter, actor) to the change containing it.
+struct ChangeIndex {
+    by_actor: HashMap<String, Vec<ChangeInfo>>,
+}
+
+impl ChangeIndex {
+    fn new(doc: &mut AutoCommit) -> Self {
+        let mut by_actor: HashMap<String, Vec<ChangeInfo>> = HashMap::new();
+        for change in doc.get_changes(&[]) {
+            let actor = change.actor_id().to_hex_string();
+            by_actor.entry(actor.clone()).or_default().push(ChangeInfo {
+                hash: change.hash(),
+                actor,
+                time: change.timestamp(),
+                start_op: change.start_op().get(),
+                max_op: change.max_op(),
+                deps: change.deps().to_vec(),
+            });
+        }
+        for changes in by_actor.values_mut() {
+            changes.sort_by_key(|c| c.start_op);
+        }
+        ChangeIndex { by_actor }
+    }
+
+    /// The change containing operation `id`.
+    fn lookup(&self, id: &ObjId) -> Option<&ChangeInfo> {
+        let (counter, actor) = match id {
+            ObjId::Id(counter, actor, _) => (*counter, actor.to_hex_string()),
+            _ => return None,
+        };
+        let changes = self.by_actor.get(&actor)?;
+        let i = changes.partition_point(|c| c.start_op <= counter);
+        changes[..i].last().filter(|c| counter <= c.max_op)
+    }
+}
+
+/// Resolve `path` to a text object.
+fn text_obj(doc: &AutoCommit, path: &str) -> Result<ObjId, i32> {
+    let obj = resolve_path(doc, path).map_err(|_| -2)?;
+    match doc.object_type(&obj) {
+        Ok(ObjType::Text) => Ok(obj),
+        _ => Err(-2),
+    }
+}
+
+/// Character at `index` (empty for non-character elements such as blocks).
+fn char_at(value: &Value) -> String {
+    match value {
+        Value::Scalar(s) => match s.as_ref() {
+            ScalarValue::Str(c) => c.to_string(),
+            _ => String::new(),
+        },
+        Value::Object(_) => String::new(),
+    }
+}
+
+/// A span of consecutive characters attributed to one change.
+struct Span {
+    kind: &'static str,
+    start: usize,
+    end: usize,
+    text: String,
+    change: ChangeInfo,
+}
+
+impl Span {
+    fn push_json(&self, out: &mut String, with_kind: bool) {
+        out.push('{');
+        if with_kind {
+            out.push_str(&format!(r#""kind":"{}","#, self.kind));
+        }
+        out.push_str(&format!(r#""start":{},"end":{},"text":"#, self.start, self.end));
+        push_json_str(out, &self.text);
+        out.push_str(r#","actor":"#);
+        push_json_str(out, &self.change.actor);
+        out.push_str(&format!(
+            r#","change":"{}","time":{}}}"#,
+            self.change.hash, self.change.time
+        ));
+    }
+}
+
+/// Append a character to the last span if it continues it, else start a new span.
+fn extend(spans: &mut Vec<Span>, kind: &'static str, index: usize, ch: String, change: &ChangeInfo) {
+    if let Some(last) = spans.last_mut() {
+        if last.kind == kind && last.end == index && last.change.hash == change.hash {
+            last.end += 1;
+            last.text.push_str(&ch);
+            return;
+        }
+    }
+    spans.push(Span {
+        kind,
+        start: index,
+        end: index + 1,
+        text: ch,
+        change: change.clone(),
+    });
+}
+
+fn finish(spans: &[Span], with_kind: bool) -> i32 {
+    let mut json = String::from("[");
+    for (i, span) in spans.iter().enumerate() {
+        if i > 0 {
+            json.push(',');
+        }
+        span.push_json(&mut json, with_kind);
+    }
+    json.push(']');
+
+    let len = json.len() as i32;
+    LAST_BLAME.with(|b| *b.borrow_mut() = json);
+    len
+}
+
+/// Attribute every character of the text at `path` to the change that inserted it.
+///
+/// JSON: `[{"start":0,"end":5,"text":"Hello","actor":"ab12..","change":"9f..","time":1700000000}]`
+///
+/// # Returns
+/// - `>= 0` length of the JSON (fetch with `am_blame_json`)
+/// - negative error code otherwise (see module notes)
+#[no_mangle]
+pub extern "C" fn am_text_blame_len(path_ptr: *const u8, path_len: usize) -> i32 {
+    let path = match read_str(path_ptr, path_len) {
+        Ok(p) => p,
+        Err(_) => return -1,
+    };
+
+    match with_doc_mut(|doc| {
+        let obj = text_obj(doc, path)?;
+        let index = ChangeIndex::new(doc);
+
+        let mut spans = Vec::new();
+        for i in 0..doc.length(&obj) {
+            if let Ok(Some((value, id))) = doc.get(&obj, i) {
+                if let Some(change) = index.lookup(&id) {
+                    extend(&mut spans, "insert", i, char_at(&value), change);
+                }
+            }
+        }
+        Ok(finish(&spans, false))
+    }) {
+        Some(Ok(len)) => len,
+        Some(Err(code)) => code,
+        None => -4,
+    }
+}
+
+/// Report the characters inserted and deleted in the text at `path` between
+/// two sets of heads, attributed to the change (and so the actor) responsible.
+///
+/// Inserted spans use positions in the `after` text, deleted spans positions
+/// in the `before` text.
+///
+/// JSON: `[{"kind":"insert"|"delete","start":..,"end":..,"text":..,"actor":..,"change":..,"time":..}]`
+#[no_mangle]
+pub extern "C" fn am_text_blame_diff_len(
+    path_ptr: *const u8,
+    path_len: usize,
+    before_ptr: *const u8,
+    before_count: usize,
+    after_ptr: *const u8,
+    after_count: usize,
+) -> i32 {
+    let path = match read_str(path_ptr, path_len) {
+        Ok(p) => p,
+        Err(_) => return -1,
+    };
+    let (before, after) = match (
+        read_heads(before_ptr, before_count),
+        read_heads(after_ptr, after_count),
+    ) {
+        (Ok(b), Ok(a)) => (b, a),
+        _ => return -1,
+    };
+
+    match with_doc_mut(|doc| {
+        for hash in before.iter().chain(after.iter()) {
+            if doc.get_change_by_hash(hash).is_none() {
+                return Err(-3);
+            }
+        }
+        let obj = text_obj(doc, path)?;
+        let index = ChangeIndex::new(doc);
+
+        // Changes in `after` but not in `before`, oldest first
+        let outside_after: Vec<ChangeHash> = doc.get_changes(&after).iter().map(|c| c.hash()).collect();
+        let between: Vec<ChangeInfo> = doc
+            .get_changes(&before)
+            .iter()
+            .map(|c| c.hash())
+            .filter(|h| !outside_after.contains(h))
+            .filter_map(|h| index.by_actor.values().flatten().find(|c| c.hash == h).cloned())
+            .collect();
+
+        let mut spans = Vec::new();
+        let (mut ins, mut del) = (0usize, 0usize);
+        for patch in doc.diff(&before, &after) {
+            if patch.obj != obj {
+                continue;
+            }
+            match patch.action {
+                PatchAction::SpliceText { index: at, value, .. } => {
+                    let len = value.make_string().chars().count();
+                    for i in at..at + len {
+                        if let Ok(Some((value, id))) = doc.get_at(&obj, i, &after) {
+                            if let Some(change) = index.lookup(&id) {
+                                extend(&mut spans, "insert", i, char_at(&value), change);
+                            }
+                        }
+                    }
+                    ins += len;
+                }
+                PatchAction::DeleteSeq { index: at, length } => {
+                    let start = (at + del).saturating_sub(ins);
+                    for i in start..start + length {
+                        let cursor = match doc.get_cursor(&obj, i, Some(&before)) {
+                            Ok(c) => c,
+                            Err(_) => continue,
+                        };
+                        let ch = match doc.get_at(&obj, i, &before) {
+                            Ok(Some((value, _))) => char_at(&value),
+                            _ => String::new(),
+                        };
+                        // The deleting change is the one whose parents still
+                        // show the character and which itself hides it
+                        let deleter = between.iter().find(|c| {
+                            visible_at(doc, &obj, &cursor, Some(&c.deps)).is_some()
+                                && visible_at(doc, &obj, &cursor, Some(&[c.hash])).is_none()
+                        });
+                        if let Some(change) = deleter {
+                            extend(&mut spans, "delete", i, ch, change);
+                        }
+                    }
+                    del += length;
+                }
+                _ => {}
+            }
+        }
+        Ok(finish(&spans, true))
+    }) {
+        Some(Ok(len)) => len,
+        Some(Err(code)) => code,
+        None => -4,
+    }
+}
+
+/// Copy the JSON produced by the last `am_text_blame*_len` call into `ptr_out`.
+#[no_mangle]
+pub extern "C" fn am_blame_json(ptr_out: *mut u8) -> i32 {
+    if ptr_out.is_null() {
+        return -1;
+    }
+    LAST_BLAME.with(|b| {
+        let json = b.borrow();
+        let bytes = json.as_bytes();
+        unsafe {
+            std::ptr::copy_nonoverlapping(bytes.as_ptr(), ptr_out, bytes.len());
+        }
+        0
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use automerge::{transaction::Transactable, ActorId, ROOT};
+
+    #[test]
+    fn test_change_index_lookup() {
+        let mut doc = AutoCommit::new().with_actor(ActorId::from(b"alice".to_vec()));
+        let text = doc.put_object(ROOT, "content", ObjType::Text).unwrap();
+        doc.splice_text(&text, 0, 0, "Hi").unwrap();
+        doc.commit();
+
+        let mut bob = doc.fork().with_actor(ActorId::from(b"bob".to_vec()));
+        bob.splice_text(&text, 2, 0, "!").unwrap();
+        bob.commit();
+        doc.merge(&mut bob).unwrap();
+
+        let index = ChangeIndex::new(&mut doc);
+        let authors: Vec<String> = (0..doc.length(&text))
+            .map(|i| {
+                let (_, id) = doc.get(&text, i).unwrap().unwrap();
+                index.lookup(&id).unwrap().actor.clone()
+            })
+            .collect();
+
+        let alice = ActorId::from(b"alice".to_vec()).to_hex_string();
+        let bob = ActorId::from(b"bob".to_vec()).to_hex_string();
+        assert_eq!(authors, vec![alice.clone(), alice, bob]);
+    }
+}
@@ -6,10 +6,19 @@
 // Unlike character offsets which change when text is inserted/deleted,
 // cursors track CRDT positions that survive concurrent modifications.
 
+use crate::path::{read_str, resolve_path, visible_at};
 use crate::state::with_doc;
-use automerge::{ObjId, ReadDoc};
+use automerge::{AutoCommit, Cursor, CursorPosition, ObjId, ObjType, ReadDoc};
+use std::collections::HashMap;
 use std::str;
 
+/// Cursor sticks to the element after its position (Automerge's default):
+/// an insert at the position goes before the cursor.
+pub(crate) const BIAS_AFTER: u32 = 0;
+/// Cursor sticks to the element before its position: an insert at the
+/// position goes after the cursor.
+pub(crate) const BIAS_BEFORE: u32 = 1;
+
 /// Get a cursor for a position in a text or list object
 ///
 /// # Arguments
@@ -32,7 +41,7 @@ pub extern "C" fn am_get_cursor(obj_ptr: *const u8, obj_len: usize, index: usize
 
     with_doc(|doc| {
         // Parse path to get object ID
-        let obj_id = match parse_path(doc, path_str) {
+        let obj_id = match resolve_path(doc, path_str) {
             Ok(id) => id,
             Err(_) => return -1,
         };
@@ -99,7 +108,7 @@ pub extern "C" fn am_lookup_cursor(
 
     with_doc(|doc| {
         // Parse path to get object ID
-        let obj_id = match parse_path(doc, path_str) {
+        let obj_id = match resolve_path(doc, path_str) {
             Ok(id) => id,
             Err(_) => return -1,
         };
@@ -120,35 +129,151 @@ pub extern "C" fn am_lookup_cursor(
     }).unwrap_or(-1)
 }
 
-// Thread-local storage for cursor string
-use std::cell::RefCell;
-thread_local! {
-    static LAST_CURSOR: RefCell<String> = RefCell::new(String::new());
+/// Create a cursor at `index` in a text or list object with the given bias.
+///
+/// An after-biased cursor is the element at `index` (the end of the sequence
+/// when `index` is its length); a before-biased cursor is the element at
+/// `index - 1` (the start of the sequence when `index` is 0).
+fn biased_cursor(doc: &AutoCommit, obj: &ObjId, index: usize, bias: u32) -> Result<Cursor, i32> {
+    match doc.object_type(obj) {
+        Ok(ObjType::Text) | Ok(ObjType::List) => {}
+        _ => return Err(-3),
+    }
+    if index > doc.length(obj) {
+        return Err(-2);
+    }
+    let found = match bias {
+        BIAS_AFTER if index == doc.length(obj) => doc.get_cursor(obj, CursorPosition::End, None),
+        BIAS_AFTER => doc.get_cursor(obj, index, None),
+        BIAS_BEFORE if index == 0 => doc.get_cursor(obj, CursorPosition::Start, None),
+        BIAS_BEFORE => doc.get_cursor(obj, index - 1, None),
+        _ => return Err(-1),
+    };
+    found.map_err(|_| -2)
 }
 
-// Helper to parse path string to ObjId
-fn parse_path(doc: &automerge::AutoCommit, path: &str) -> Result<ObjId, ()> {
-    if path == "ROOT" {
-        return Ok(automerge::ROOT);
+/// Current position of a cursor created by `biased_cursor`.
+///
+/// A before-biased cursor sits just after its element while the element is
+/// visible, and where the element was once it is deleted.
+fn biased_position(doc: &AutoCommit, obj: &ObjId, cursor: &Cursor, bias: u32) -> Result<usize, i32> {
+    if bias == BIAS_BEFORE {
+        if let Some(pos) = visible_at(doc, obj, cursor, None) {
+            return Ok(pos + 1);
+        }
     }
+    doc.get_cursor_position(obj, cursor, None).map_err(|_| -3)
+}
 
-    let parts: Vec<&str> = path.split('.').collect();
-    if parts.is_empty() || parts[0] != "ROOT" {
-        return Err(());
+/// Create a cursor with a bias in the text or list object at a path
+///
+/// # Arguments
+/// * `path_ptr`/`path_len` - Object path (e.g., "ROOT.content", "ROOT.items")
+/// * `index` - Position, 0..=length
+/// * `bias` - `BIAS_AFTER` (0) or `BIAS_BEFORE` (1)
+///
+/// # Returns
+/// * Positive: Length of cursor string (call am_get_cursor_str to retrieve)
+/// * -1: Invalid path or bias
+/// * -2: Index out of bounds
+/// * -3: Not a text or list object
+/// * -4: Document not initialized
+#[no_mangle]
+pub extern "C" fn am_cursor(path_ptr: *const u8, path_len: usize, index: usize, bias: u32) -> i32 {
+    let path = match read_str(path_ptr, path_len) {
+        Ok(p) => p,
+        Err(_) => return -1,
+    };
+
+    let cursor = match with_doc(|doc| {
+        let obj = resolve_path(doc, path).map_err(|_| -1)?;
+        biased_cursor(doc, &obj, index, bias)
+    }) {
+        Some(Ok(c)) => c.to_string(),
+        Some(Err(code)) => return code,
+        None => return -4,
+    };
+
+    let len = cursor.len() as i32;
+    LAST_CURSOR.with(|c| *c.borrow_mut() = cursor);
+    len
+}
+
+/// Look up many cursors in one call
+///
+/// # Arguments
+/// * `req_ptr`/`req_len` - One cursor per line: "<bias>\t<path>\t<cursor>"
+/// * `out_ptr` - Room for one little-endian i32 per line, receiving the
+///   cursor's index, or -1 (path doesn't resolve), -2 (invalid cursor or
+///   bias), -3 (cursor not in the object)
+///
+/// # Returns
+/// * >= 0: Number of cursors looked up
+/// * -1: Malformed request
+/// * -4: Document not initialized
+#[no_mangle]
+pub extern "C" fn am_lookup_cursors(req_ptr: *const u8, req_len: usize, out_ptr: *mut u8) -> i32 {
+    let req = match read_str(req_ptr, req_len) {
+        Ok(r) => r,
+        Err(_) => return -1,
+    };
+    if req.is_empty() {
+        return 0;
     }
 
-    let mut current = automerge::ROOT;
-    for part in &parts[1..] {
-        // Try to get object at this key
-        match doc.get(&current, *part) {
-            Ok(Some((automerge::Value::Object(_obj_type), obj_id))) => {
-                current = obj_id;
-            }
-            _ => return Err(()),
+    let mut lines = Vec::new();
+    for line in req.split('\n') {
+        let mut fields = line.splitn(3, '\t');
+        match (fields.next(), fields.next(), fields.next()) {
+            (Some(bias), Some(path), Some(cursor)) => match bias.parse::<u32>() {
+                Ok(bias) => lines.push((bias, path, cursor)),
+                Err(_) => return -1,
+            },
+            _ => return -1,
         }
     }
+    if out_ptr.is_null() {
+        return -1;
+    }
 
-    Ok(current)
+    let results = match with_doc(|doc| {
+        let mut objs: HashMap<&str, Option<ObjId>> = HashMap::new();
+        lines
+            .iter()
+            .map(|&(bias, path, cursor)| {
+                let obj = match objs.entry(path).or_insert_with(|| resolve_path(doc, path).ok()) {
+                    Some(obj) => obj.clone(),
+                    None => return -1,
+                };
+                if bias != BIAS_AFTER && bias != BIAS_BEFORE {
+                    return -2;
+                }
+                let cursor = match Cursor::try_from(cursor) {
+                    Ok(c) => c,
+                    Err(_) => return -2,
+                };
+                match biased_position(doc, &obj, &cursor, bias) {
+                    Ok(index) => index as i32,
+                    Err(code) => code,
+                }
+            })
+            .collect::<Vec<i32>>()
+    }) {
+        Some(r) => r,
+        None => return -4,
+    };
+
+    let out = unsafe { std::slice::from_raw_parts_mut(out_ptr, results.len() * 4) };
+    for (chunk, index) in out.chunks_mut(4).zip(results.iter()) {
+        chunk.copy_from_slice(&index.to_le_bytes());
+    }
+    results.len() as i32
+}
+
+// Thread-local storage for cursor string
+use std::cell::RefCell;
+thread_local! {
+    static LAST_CURSOR: RefCell<String> = RefCell::new(String::new());
 }
 
 #[cfg(test)]
@@ -224,6 +349,78 @@ mod tests {
         crate::memory::am_free(cursor_ptr, cursor_len as usize);
     }
 
+    /// Build a lookup request line for `am_lookup_cursors`
+    fn lookup_line(bias: u32, path: &str) -> String {
+        let len = LAST_CURSOR.with(|c| c.borrow().len());
+        assert!(len > 0);
+        format!("{}\t{}\t{}", bias, path, LAST_CURSOR.with(|c| c.borrow().clone()))
+    }
+
+    fn lookup_all(lines: &[String]) -> Vec<i32> {
+        let req = lines.join("\n");
+        let mut out = vec![0u8; lines.len() * 4];
+        let n = am_lookup_cursors(req.as_ptr(), req.len(), out.as_mut_ptr());
+        assert_eq!(n, lines.len() as i32);
+        out.chunks(4)
+            .map(|c| i32::from_le_bytes([c[0], c[1], c[2], c[3]]))
+            .collect()
+    }
+
+    #[test]
+    fn test_cursor_bias() {
+        crate::document::am_init();
+        let text = b"Hello World";
+        crate::text::am_text_splice(0, 0, text.as_ptr(), text.len());
+
+        let path = "ROOT.content";
+        let mut lines = Vec::new();
+        // Both at 5 (between "Hello" and " World"), at the start and at the end
+        for (index, bias) in [(5, BIAS_AFTER), (5, BIAS_BEFORE), (0, BIAS_BEFORE), (11, BIAS_AFTER)] {
+            assert!(am_cursor(path.as_ptr(), path.len(), index, bias) > 0);
+            lines.push(lookup_line(bias, path));
+        }
+        assert_eq!(lookup_all(&lines), vec![5, 5, 0, 11]);
+
+        // Text typed at 5 goes before the after-biased cursor only
+        let ins = b"!!";
+        crate::text::am_text_splice(5, 0, ins.as_ptr(), ins.len());
+        assert_eq!(lookup_all(&lines), vec![7, 5, 0, 13]);
+
+        // Deleting "lo!!" puts both where the text was
+        crate::text::am_text_splice(3, 4, std::ptr::null(), 0);
+        assert_eq!(lookup_all(&lines), vec![3, 3, 0, 9]);
+
+        // Out of range index and bad requests
+        assert_eq!(am_cursor(path.as_ptr(), path.len(), 99, BIAS_AFTER), -2);
+        assert_eq!(am_cursor(path.as_ptr(), path.len(), 0, 7), -1);
+        let bad = "0\tROOT.content";
+        let mut out = [0u8; 4];
+        assert_eq!(am_lookup_cursors(bad.as_ptr(), bad.len(), out.as_mut_ptr()), -1);
+        let missing = lookup_all(&["0\tROOT.missing\ts".to_string(), "0\tROOT.content\tnot-a-cursor".to_string()]);
+        assert_eq!(missing, vec![-1, -2]);
+    }
+
+    #[test]
+    fn test_cursor_list() {
+        use automerge::transaction::Transactable;
+        crate::document::am_init();
+        let items = crate::state::with_doc_mut(|doc| {
+            let items = doc.put_object(automerge::ROOT, "items", ObjType::List).unwrap();
+            for (i, v) in ["a", "b", "c"].iter().enumerate() {
+                doc.insert(&items, i, *v).unwrap();
+            }
+            items
+        })
+        .unwrap();
+
+        let path = "ROOT.items";
+        assert!(am_cursor(path.as_ptr(), path.len(), 2, BIAS_AFTER) > 0);
+        let lines = vec![lookup_line(BIAS_AFTER, path)];
+
+        crate::state::with_doc_mut(|doc| doc.insert(&items, 0, "z").unwrap()).unwrap();
+        assert_eq!(lookup_all(&lines), vec![3]);
+    }
+
     #[test]
     fn test_cursor_invalid_path() {
         crate::document::am_init();
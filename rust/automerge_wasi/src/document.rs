@@ -2,7 +2,7 @@
 //!
 //! Handles document creation, serialization, loading, and merging.
 
-use automerge::{AutoCommit, ObjType, ReadDoc, transaction::Transactable};
+use automerge::{AutoCommit, ObjType, ReadDoc, transaction::{CommitOptions, Transactable}};
 use crate::state::{init_doc, with_doc_mut, set_text_obj_id};
 
 /// Initialize a new Automerge document with a "content" Text CRDT object
@@ -274,6 +274,57 @@ pub extern "C" fn am_fork() -> i32 {
     }
 }
 
+/// Commit pending operations as one change with a message and timestamp
+///
+/// Operations are otherwise committed implicitly (on save, merge, get heads...)
+/// with a zero timestamp. The WASI sandbox has no wall clock, so the host passes
+/// the time in.
+///
+/// ## Parameters
+/// - `msg_ptr`/`msg_len`: commit message (UTF-8, may be empty)
+/// - `time`: Unix timestamp in seconds
+///
+/// ## Returns
+/// - `1` if a change was committed
+/// - `0` if there was nothing to commit
+/// - `-1` on UTF-8 validation error
+/// - `-2` if document not initialized
+#[no_mangle]
+pub extern "C" fn am_commit(msg_ptr: *const u8, msg_len: usize, time: i64) -> i32 {
+    let message = match crate::path::read_str(msg_ptr, msg_len) {
+        Ok(m) => m,
+        Err(_) => return -1,
+    };
+
+    match with_doc_mut(|doc| {
+        if doc.pending_ops() == 0 {
+            return None;
+        }
+        let mut options = CommitOptions::default().with_time(time);
+        if !message.is_empty() {
+            options = options.with_message(message.to_string());
+        }
+        doc.commit_with(options)
+    }) {
+        Some(Some(_)) => 1,
+        Some(None) => 0,
+        None => -2,
+    }
+}
+
+/// Discard the pending (uncommitted) operations.
+///
+/// # Returns
+/// - Number of operations discarded (>= 0)
+/// - `-2` if document not initialized
+#[no_mangle]
+pub extern "C" fn am_rollback() -> i32 {
+    match with_doc_mut(|doc| doc.rollback()) {
+        Some(n) => n as i32,
+        None => -2,
+    }
+}
+
 #[cfg(test)]
 mod tests {
     use super::*;
@@ -348,4 +399,22 @@ mod tests {
 
         assert_ne!(actor1, actor2, "Forked document should have different actor ID");
     }
+
+    #[test]
+    fn test_rollback() {
+        use crate::text::{am_get_text_len, am_set_text};
+
+        assert_eq!(am_init(), 0);
+        let text = "committed";
+        assert_eq!(am_set_text(text.as_ptr(), text.len()), 0);
+        assert_eq!(am_commit(std::ptr::null(), 0, 0), 1);
+
+        let more = "discarded";
+        assert_eq!(am_set_text(more.as_ptr(), more.len()), 0);
+        assert!(am_rollback() > 0);
+        assert_eq!(am_get_text_len(), text.len() as u32);
+
+        // Nothing pending any more
+        assert_eq!(am_rollback(), 0);
+    }
 }
@@ -0,0 +1,372 @@
+// ==============================================================================
+// Layer 2: Rust WASI Exports - Mark Expand Registry (shared helpers)
+// ==============================================================================
+// ARCHITECTURE: Internal helper module for the WASI export layer (Layer 2/7).
+//
+// RESPONSIBILITIES:
+// - Add marks and record the expand setting each one was made with
+// - Report the expand setting of the mark spans Automerge returns
+//
+// DEPENDENTS:
+// - crate::richtext (am_mark/am_obj_mark, marks JSON)
+// - crate::undo (marks restored by a revert keep their expand)
+//
+// NOTES:
+// - No exports here - helpers only
+// - Automerge keeps expand on the mark operations but does not report it, so
+//   every mark made through this crate is recorded in the document, where it
+//   syncs and merges like any other data
+// - Layout: ROOT._marks.<record key> = {obj, name, value, start, end, expand,
+//   seq}; obj is the text object id, start and end are cursors of the first
+//   and last marked character, expand is 0=none, 1=before, 2=after, 3=both,
+//   seq orders the records of one text object
+// - Each record has its own key (text object, name and range), so records
+//   made concurrently by different peers all survive a merge; ROOT._marks
+//   itself is created with the document (Layer 4 EnsureMarks), and only
+//   created here for documents that lack it
+// - A span reports the "before" bit of the recorded mark that starts first
+//   within it and the "after" bit of the one that ends last, so adjacent
+//   marks with the same name and value keep the expand of their own edge
+// - Whenever the marks of a text object change (mark, unmark), its records
+//   that no longer lie within a span, or that the new record covers, are
+//   deleted; records of text deleted since are pruned with its next change
+// - Marks made elsewhere (not recorded) report 0
+// ==============================================================================
+
+use automerge::{
+    marks::{ExpandMark, Mark},
+    transaction::Transactable,
+    AutoCommit, AutomergeError, ChangeHash, Cursor, ObjId, ObjType, Prop, ReadDoc, ScalarValue, Value, ROOT,
+};
+
+/// Reserved root key holding the recorded marks
+pub(crate) const MARKS_KEY: &str = "_marks";
+
+/// Expand mode for an expand code (0=none, 1=before, 2=after, 3=both).
+pub(crate) fn expand_mode(code: u8) -> Option<ExpandMark> {
+    match code {
+        0 => Some(ExpandMark::None),
+        1 => Some(ExpandMark::Before),
+        2 => Some(ExpandMark::After),
+        3 => Some(ExpandMark::Both),
+        _ => None,
+    }
+}
+
+/// Add `mark` to the text `obj` and record its expand code.
+///
+/// Null values (unmarking) and empty ranges are not recorded, but still
+/// prune the records they invalidate.
+pub(crate) fn mark(doc: &mut AutoCommit, obj: &ObjId, mark: Mark, expand: u8) -> Result<(), AutomergeError> {
+    let mode = expand_mode(expand).unwrap_or(ExpandMark::None);
+    let (start, end) = (mark.start, mark.end);
+    let name = mark.name().to_string();
+    let value = mark.value().clone();
+    doc.mark(obj, mark, mode)?;
+
+    if start >= end || matches!(value, ScalarValue::Null) {
+        return prune(doc, obj, None);
+    }
+    let first = doc.get_cursor(obj, start, None)?;
+    let last = doc.get_cursor(obj, end - 1, None)?;
+    prune(doc, obj, Some((name.as_str(), &value, start, end - 1)))?;
+
+    let seq = recorded(doc, obj, None).iter().map(|r| r.seq + 1).max().unwrap_or(0);
+    let marks = registry(doc)?;
+    let key = format!("{}{} {} {}", record_prefix(obj), first, last, name);
+    let entry = doc.put_object(&marks, key.as_str(), ObjType::Map)?;
+    doc.put(&entry, "obj", obj.to_string())?;
+    doc.put(&entry, "name", name)?;
+    doc.put(&entry, "value", value)?;
+    doc.put(&entry, "start", first.to_string())?;
+    doc.put(&entry, "end", last.to_string())?;
+    doc.put(&entry, "expand", expand as i64)?;
+    doc.put(&entry, "seq", seq)?;
+    Ok(())
+}
+
+/// Remove mark `name` from `start..end` of the text `obj` and prune the
+/// records it invalidates.
+pub(crate) fn unmark(
+    doc: &mut AutoCommit,
+    obj: &ObjId,
+    name: &str,
+    start: usize,
+    end: usize,
+    expand: ExpandMark,
+) -> Result<(), AutomergeError> {
+    doc.unmark(obj, name, start, end, expand)?;
+    prune(doc, obj, None)
+}
+
+/// The map holding the recorded marks, created if the document lacks it.
+fn registry(doc: &mut AutoCommit) -> Result<ObjId, AutomergeError> {
+    match doc.get(ROOT, MARKS_KEY)? {
+        Some((Value::Object(ObjType::Map), id)) => Ok(id),
+        _ => doc.put_object(ROOT, MARKS_KEY, ObjType::Map),
+    }
+}
+
+/// Delete the records of `obj` that no current mark span contains (or whose
+/// characters no longer resolve), and those with the name and value of
+/// `covering` (name, value, first, last) that lie within its range: a record
+/// made over them decides their edges now.
+fn prune(
+    doc: &mut AutoCommit,
+    obj: &ObjId,
+    covering: Option<(&str, &ScalarValue, usize, usize)>,
+) -> Result<(), AutomergeError> {
+    let marks = match doc.get(ROOT, MARKS_KEY)? {
+        Some((Value::Object(ObjType::Map), id)) => id,
+        _ => return Ok(()),
+    };
+    let prefix = record_prefix(obj);
+    let keys: Vec<String> = doc.keys(&marks).filter(|k| k.starts_with(&prefix)).collect();
+    if keys.is_empty() {
+        return Ok(());
+    }
+
+    let keep: Vec<String> = {
+        let spans = doc.marks(obj)?;
+        recorded(doc, obj, None)
+            .into_iter()
+            .filter(|r| {
+                let covered = covering.map_or(false, |(name, value, first, last)| {
+                    r.name == name && r.value == *value && first <= r.first && r.last <= last
+                });
+                !covered && spans.iter().any(|m| r.within(m.start, m.end, m.name(), m.value()))
+            })
+            .map(|r| r.key)
+            .collect()
+    };
+    for key in keys.iter().filter(|k| !keep.contains(k)) {
+        doc.delete(&marks, key.as_str())?;
+    }
+    Ok(())
+}
+
+/// Start of the keys of the records of `obj`.
+fn record_prefix(obj: &ObjId) -> String {
+    format!("{} ", obj)
+}
+
+/// A recorded mark, with its first and last character resolved to indices.
+struct Recorded {
+    key: String,
+    name: String,
+    value: ScalarValue,
+    first: usize,
+    last: usize,
+    expand: u8,
+    seq: i64,
+}
+
+impl Recorded {
+    /// Whether the record lies within the span (start, end, name, value).
+    fn within(&self, start: usize, end: usize, name: &str, value: &ScalarValue) -> bool {
+        self.name == name && self.value == *value && start <= self.first && self.last <= end && self.first < end
+    }
+}
+
+/// The marks of `obj` recorded at `heads` (None = now), oldest first.
+fn recorded(doc: &AutoCommit, obj: &ObjId, heads: Option<&[ChangeHash]>) -> Vec<Recorded> {
+    let get = |at: &ObjId, prop: Prop| match heads {
+        Some(h) => doc.get_at(at, prop, h),
+        None => doc.get(at, prop),
+    };
+    let marks = match get(&ROOT, Prop::Map(MARKS_KEY.to_string())) {
+        Ok(Some((Value::Object(ObjType::Map), id))) => id,
+        _ => return Vec::new(),
+    };
+    let keys: Vec<String> = match heads {
+        Some(h) => doc.keys_at(&marks, h).collect(),
+        None => doc.keys(&marks).collect(),
+    };
+
+    let scalar = |entry: &ObjId, key: &str| match get(entry, Prop::Map(key.to_string())) {
+        Ok(Some((Value::Scalar(s), _))) => Some(s.into_owned()),
+        _ => None,
+    };
+    let position = |s: ScalarValue| match s {
+        ScalarValue::Str(c) => {
+            let cursor = Cursor::try_from(c.as_str()).ok()?;
+            doc.get_cursor_position(obj, &cursor, heads).ok()
+        }
+        _ => None,
+    };
+
+    let id = obj.to_string();
+    let mut out = Vec::new();
+    for key in keys {
+        let entry = match get(&marks, Prop::Map(key.clone())) {
+            Ok(Some((Value::Object(ObjType::Map), id))) => id,
+            _ => continue,
+        };
+        match scalar(&entry, "obj") {
+            Some(ScalarValue::Str(o)) if o.as_str() == id => {}
+            _ => continue,
+        }
+        let (name, value, first, last, expand, seq) = match (
+            scalar(&entry, "name"),
+            scalar(&entry, "value"),
+            scalar(&entry, "start").and_then(position),
+            scalar(&entry, "end").and_then(position),
+            scalar(&entry, "expand"),
+            scalar(&entry, "seq"),
+        ) {
+            (
+                Some(ScalarValue::Str(n)),
+                Some(v),
+                Some(f),
+                Some(l),
+                Some(ScalarValue::Int(e)),
+                Some(ScalarValue::Int(q)),
+            ) => (n.to_string(), v, f, l, e as u8, q),
+            _ => continue,
+        };
+        out.push(Recorded {
+            key,
+            name,
+            value,
+            first,
+            last,
+            expand,
+            seq,
+        });
+    }
+    // Records made concurrently share a seq; the key orders them the same
+    // way on every peer
+    out.sort_by(|a, b| a.seq.cmp(&b.seq).then_with(|| a.key.cmp(&b.key)));
+    out
+}
+
+/// Expand code of each mark span (start, end, name, value) of `obj` at
+/// `heads` (None = now).
+pub(crate) fn span_expands<'a, I>(doc: &AutoCommit, obj: &ObjId, spans: I, heads: Option<&[ChangeHash]>) -> Vec<u8>
+where
+    I: IntoIterator<Item = (usize, usize, &'a str, &'a ScalarValue)>,
+{
+    let recorded = recorded(doc, obj, heads);
+    spans
+        .into_iter()
+        .map(|(start, end, name, value)| {
+            // Later records win ties: they were made over the earlier ones
+            let mut before: Option<&Recorded> = None;
+            let mut after: Option<&Recorded> = None;
+            for r in recorded.iter().filter(|r| r.within(start, end, name, value)) {
+                if before.map_or(true, |b| r.first <= b.first) {
+                    before = Some(r);
+                }
+                if after.map_or(true, |a| r.last >= a.last) {
+                    after = Some(r);
+                }
+            }
+            before.map_or(0, |r| r.expand & 1) | after.map_or(0, |r| r.expand & 2)
+        })
+        .collect()
+}
+
+/// Expand code of each of `marks` on `obj` at `heads` (None = now).
+pub(crate) fn mark_expands(doc: &AutoCommit, obj: &ObjId, marks: &[Mark], heads: Option<&[ChangeHash]>) -> Vec<u8> {
+    span_expands(
+        doc,
+        obj,
+        marks.iter().map(|m| (m.start, m.end, m.name(), m.value())),
+        heads,
+    )
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn bold(start: usize, end: usize) -> Mark {
+        Mark {
+            start,
+            end,
+            name: "bold".into(),
+            value: ScalarValue::Boolean(true),
+        }
+    }
+
+    #[test]
+    fn test_expand_recorded_per_edge() {
+        let mut doc = AutoCommit::new();
+        let text = doc.put_object(ROOT, "content", ObjType::Text).unwrap();
+        doc.splice_text(&text, 0, 0, "Hello World").unwrap();
+
+        // Adjacent marks with the same value come back as one span
+        mark(&mut doc, &text, bold(0, 5), 1).unwrap();
+        mark(&mut doc, &text, bold(5, 11), 2).unwrap();
+        let marks = doc.marks(&text).unwrap();
+        assert_eq!(mark_expands(&doc, &text, &marks, None), vec![3]);
+
+        // The expand survives edits that grow the span
+        doc.splice_text(&text, 11, 0, "!").unwrap();
+        let marks = doc.marks(&text).unwrap();
+        assert_eq!((marks[0].start, marks[0].end), (0, 12));
+        assert_eq!(mark_expands(&doc, &text, &marks, None), vec![3]);
+    }
+
+    #[test]
+    fn test_expand_unrecorded_mark() {
+        let mut doc = AutoCommit::new();
+        let text = doc.put_object(ROOT, "content", ObjType::Text).unwrap();
+        doc.splice_text(&text, 0, 0, "Hello").unwrap();
+        doc.mark(&text, bold(0, 5), ExpandMark::Both).unwrap();
+
+        let marks = doc.marks(&text).unwrap();
+        assert_eq!(mark_expands(&doc, &text, &marks, None), vec![0]);
+    }
+
+    fn record_count(doc: &AutoCommit) -> usize {
+        match doc.get(ROOT, MARKS_KEY).unwrap() {
+            Some((Value::Object(ObjType::Map), id)) => doc.keys(&id).count(),
+            _ => 0,
+        }
+    }
+
+    #[test]
+    fn test_expand_concurrent_first_marks() {
+        let mut doc = AutoCommit::new();
+        let text = doc.put_object(ROOT, "content", ObjType::Text).unwrap();
+        doc.splice_text(&text, 0, 0, "Hello World").unwrap();
+        doc.put_object(ROOT, MARKS_KEY, ObjType::Map).unwrap(); // As EnsureMarks does
+        let mut other = doc.fork();
+
+        // Neither peer has recorded a mark yet; both records survive
+        mark(&mut doc, &text, bold(0, 5), 1).unwrap();
+        mark(&mut other, &text, bold(6, 11), 2).unwrap();
+        doc.merge(&mut other).unwrap();
+
+        let marks = doc.marks(&text).unwrap();
+        assert_eq!(mark_expands(&doc, &text, &marks, None), vec![1, 2]);
+        assert_eq!(record_count(&doc), 2);
+    }
+
+    #[test]
+    fn test_expand_records_pruned() {
+        let mut doc = AutoCommit::new();
+        let text = doc.put_object(ROOT, "content", ObjType::Text).unwrap();
+        doc.splice_text(&text, 0, 0, "Hello World").unwrap();
+
+        // Marking over a recorded mark replaces its record
+        mark(&mut doc, &text, bold(0, 5), 1).unwrap();
+        mark(&mut doc, &text, bold(0, 11), 2).unwrap();
+        assert_eq!(record_count(&doc), 1);
+        let marks = doc.marks(&text).unwrap();
+        assert_eq!(mark_expands(&doc, &text, &marks, None), vec![2]);
+
+        // Unmarking drops the records of the spans it removes
+        unmark(&mut doc, &text, "bold", 0, 11, ExpandMark::None).unwrap();
+        assert_eq!(record_count(&doc), 0);
+
+        // Records of deleted text go with the next change to the marks
+        mark(&mut doc, &text, bold(0, 5), 1).unwrap();
+        doc.splice_text(&text, 0, 6, "").unwrap();
+        mark(&mut doc, &text, bold(0, 5), 2).unwrap();
+        assert_eq!(record_count(&doc), 1);
+        let marks = doc.marks(&text).unwrap();
+        assert_eq!(mark_expands(&doc, &text, &marks, None), vec![2]);
+    }
+}
@@ -26,6 +26,8 @@
 // NOTES:
 // - All exports use #[no_mangle] and extern "C"
 // - History allows querying changes, heads, and time-travel
+// - am_diff_paths_len/am_diff_paths report which paths the changes between
+//   two sets of heads touched (used to route sync and merge events)
 // - Return 0 on success, negative error codes on failure
 // ==============================================================================
 
@@ -34,7 +36,18 @@
 // History operations allow you to query the document's change history,
 // get heads (frontier), and fork documents at specific points in time.
 
+use std::cell::RefCell;
+
+use automerge::{AutoCommit, ChangeHash, ObjType, Patch, PatchAction, Prop, ReadDoc};
+
+use crate::path::read_heads;
 use crate::state::with_doc_mut;
+use crate::value::push_json_str;
+
+thread_local! {
+    /// JSON rendered by the last `am_diff_paths_len` call
+    static LAST_DIFF_PATHS: RefCell<String> = RefCell::new(String::new());
+}
 
 /// Get the number of heads (frontier) in the document.
 ///
@@ -308,6 +321,114 @@ pub extern "C" fn am_apply_changes(changes_ptr: *const u8, changes_len: usize) -
     }
 }
 
+/// The path a patch touched, as map keys and list indices from the root:
+/// the entry for map changes and counter increments, the element for list
+/// puts, inserts and deletes, and the object itself for text edits and marks.
+fn patch_path(doc: &AutoCommit, patch: &Patch) -> Vec<Prop> {
+    let mut path: Vec<Prop> = patch.path.iter().map(|(_, prop)| prop.clone()).collect();
+    let text = matches!(doc.object_type(&patch.obj), Ok(ObjType::Text));
+    match &patch.action {
+        PatchAction::PutMap { key, .. } | PatchAction::DeleteMap { key } => path.push(Prop::Map(key.clone())),
+        PatchAction::Increment { prop, .. } | PatchAction::Conflict { prop } => path.push(prop.clone()),
+        PatchAction::PutSeq { index, .. }
+        | PatchAction::Insert { index, .. }
+        | PatchAction::DeleteSeq { index, .. }
+            if !text =>
+        {
+            path.push(Prop::Seq(*index))
+        }
+        _ => {}
+    }
+    path
+}
+
+/// Render the paths the changes between `before` and `after` touched as a
+/// JSON array of paths, each an array of keys (strings) and indices
+/// (numbers), without duplicates: `[["config","theme"],["items",2]]`.
+fn diff_paths_json(doc: &mut AutoCommit, before: &[ChangeHash], after: &[ChangeHash]) -> String {
+    let patches = doc.diff(before, after);
+
+    let mut seen: Vec<String> = Vec::new();
+    for patch in &patches {
+        let mut part = String::from("[");
+        for (i, prop) in patch_path(doc, patch).iter().enumerate() {
+            if i > 0 {
+                part.push(',');
+            }
+            match prop {
+                Prop::Map(key) => push_json_str(&mut part, key),
+                Prop::Seq(index) => part.push_str(&index.to_string()),
+            }
+        }
+        part.push(']');
+        if !seen.contains(&part) {
+            seen.push(part);
+        }
+    }
+    format!("[{}]", seen.join(","))
+}
+
+/// Render the paths the changes between two sets of heads touched (see
+/// `diff_paths_json` for the format).
+///
+/// # Parameters
+/// - `before_ptr`/`before_count`: heads to diff from (32-byte hashes)
+/// - `after_ptr`/`after_count`: heads to diff to (32-byte hashes)
+///
+/// # Returns
+/// - `>= 0` length of the JSON (fetch with `am_diff_paths`)
+/// - `-1` invalid argument
+/// - `-2` unknown change hash
+/// - `-3` if document not initialized
+#[no_mangle]
+pub extern "C" fn am_diff_paths_len(
+    before_ptr: *const u8,
+    before_count: usize,
+    after_ptr: *const u8,
+    after_count: usize,
+) -> i32 {
+    let (before, after) = match (
+        read_heads(before_ptr, before_count),
+        read_heads(after_ptr, after_count),
+    ) {
+        (Ok(b), Ok(a)) => (b, a),
+        _ => return -1,
+    };
+
+    let json = match with_doc_mut(|doc| {
+        for hash in before.iter().chain(after.iter()) {
+            if doc.get_change_by_hash(hash).is_none() {
+                return Err(-2);
+            }
+        }
+        Ok(diff_paths_json(doc, &before, &after))
+    }) {
+        Some(Ok(json)) => json,
+        Some(Err(code)) => return code,
+        None => return -3,
+    };
+
+    let len = json.len() as i32;
+    LAST_DIFF_PATHS.with(|s| *s.borrow_mut() = json);
+    len
+}
+
+/// Copy the JSON rendered by the last `am_diff_paths_len` call into `ptr_out`.
+#[no_mangle]
+pub extern "C" fn am_diff_paths(ptr_out: *mut u8) -> i32 {
+    if ptr_out.is_null() {
+        return -1;
+    }
+    LAST_DIFF_PATHS.with(|s| {
+        let json = s.borrow();
+        let bytes = json.as_bytes();
+        unsafe {
+            std::ptr::copy_nonoverlapping(bytes.as_ptr(), ptr_out, bytes.len());
+        }
+        0
+    })
+}
+
 #[cfg(test)]
 mod tests {
     use super::*;
@@ -368,4 +489,31 @@ mod tests {
         let len = am_get_changes_len(heads_buf.as_ptr(), head_count as usize);
         assert!(len > 0);
     }
+
+    #[test]
+    fn test_diff_paths() {
+        use automerge::{transaction::Transactable, ROOT};
+
+        let mut doc = AutoCommit::new();
+        let text = doc.put_object(ROOT, "content", ObjType::Text).unwrap();
+        let items = doc.put_object(ROOT, "items", ObjType::List).unwrap();
+        doc.insert(&items, 0, "a").unwrap();
+        let before = doc.get_heads();
+
+        doc.splice_text(&text, 0, 0, "Hi").unwrap();
+        doc.splice_text(&text, 2, 0, "!").unwrap();
+        doc.insert(&items, 1, "b").unwrap();
+        let config = doc.put_object(ROOT, "config", ObjType::Map).unwrap();
+        doc.put(&config, "theme", "dark").unwrap();
+        let after = doc.get_heads();
+
+        let json = diff_paths_json(&mut doc, &before, &after);
+        assert!(json.starts_with('[') && json.ends_with(']'), "{}", json);
+        for want in [r#"["content"]"#, r#"["items",1]"#, r#"["config"]"#] {
+            assert!(json.contains(want), "{} missing {}", json, want);
+        }
+        // The text is reported once, however many splices touched it
+        assert_eq!(json.matches(r#"["content"]"#).count(), 1, "{}", json);
+        assert!(!json.contains(r#""items",0"#), "{}", json);
+    }
 }
@@ -18,6 +18,10 @@
 //! - `list` - List operations (M2)
 //! - `counter` - Counter CRDT (M2)
 //! - `sync` - Sync protocol (M1)
+//! - `object` - Path-based map/list/text operations and typed JSON reads
+//! - `undo` - Revert edits between two heads (undo/redo)
+//! - `path`, `value` - Shared helpers (path resolution, scalar/JSON encoding)
+//! - `expand` - Mark expand registry (expand settings Automerge doesn't report)
 //! - `state` - Global document state management
 //!
 //! ## Current Status
@@ -53,8 +57,14 @@ mod counter;
 mod history;
 mod sync;
 mod richtext;
+mod expand;
 mod cursor;
 mod generic;
+mod path;
+mod value;
+mod object;
+mod undo;
+mod blame;
 
 // Re-export all public FFI functions
 pub use memory::*;
@@ -68,3 +78,6 @@ pub use sync::*;
 pub use richtext::*;
 pub use cursor::*;
 pub use generic::*;
+pub use object::*;
+pub use undo::*;
+pub use blame::*;
@@ -0,0 +1,367 @@
+// ==============================================================================
+// Layer 2: Rust WASI Exports - Path-Based Object Operations
+// ==============================================================================
+// ARCHITECTURE: This is the WASI export layer (Layer 2/7).
+//
+// RESPONSIBILITIES:
+// - WASI-compatible function exports (C ABI)
+// - Put/delete/increment/insert/splice on any map, list or text addressed by path
+// - Typed JSON reads of any subtree
+// - Error code translation (Rust Result → i32)
+//
+// DEPENDENCIES:
+// - Layer 1: automerge crate (CRDT core)
+// - crate::state (global document state)
+// - crate::path, crate::value (shared helpers)
+//
+// DEPENDENTS:
+// - Layer 3: pkg/wazero/crdt_object.go (FFI wrappers)
+//
+// RELATED FILES (1:1 mapping):
+// - Layer 3: pkg/wazero/crdt_object.go (Go FFI wrappers)
+// - Layer 4: pkg/automerge/crdt_json.go (structural JSON updates)
+//
+// NOTES:
+// - All exports use #[no_mangle] and extern "C"
+// - Paths are dotted strings: "ROOT", "ROOT.config", "ROOT.items.0"
+// - Scalars are passed as (kind, bytes) - see crate::value
+// - Return 0 on success, negative error codes on failure:
+//     -1 invalid argument (UTF-8, null pointer, bad kind)
+//     -2 path does not resolve to an object of the right type
+//     -3 Automerge error
+//     -4 document not initialized
+// ==============================================================================
+
+use crate::path::{read_bytes, read_str, resolve_path, resolve_value};
+use crate::state::{with_doc, with_doc_mut};
+use crate::value::{parse_obj_type, parse_scalar, push_value_json};
+use automerge::{transaction::Transactable, AutoCommit, ObjId, ObjType, Prop, ReadDoc};
+use std::cell::RefCell;
+
+thread_local! {
+    static LAST_JSON: RefCell<String> = RefCell::new(String::new());
+}
+
+/// Resolve a prop string against an object: an index for lists/text, a key for maps.
+fn to_prop(doc: &AutoCommit, obj: &ObjId, prop: &str) -> Result<Prop, ()> {
+    match doc.object_type(obj) {
+        Ok(ObjType::List) | Ok(ObjType::Text) => prop.parse::<usize>().map(Prop::Seq).map_err(|_| ()),
+        Ok(_) => Ok(Prop::Map(prop.to_string())),
+        Err(_) => Err(()),
+    }
+}
+
+/// Put a scalar value at `prop` in the object at `path`.
+///
+/// `prop` is a key for maps and a decimal index (overwrite) for lists.
+///
+/// # Returns
+/// - `0` on success, negative error code otherwise (see module notes)
+#[no_mangle]
+pub extern "C" fn am_obj_put(
+    path_ptr: *const u8,
+    path_len: usize,
+    prop_ptr: *const u8,
+    prop_len: usize,
+    kind: u8,
+    value_ptr: *const u8,
+    value_len: usize,
+) -> i32 {
+    let (path, prop) = match (read_str(path_ptr, path_len), read_str(prop_ptr, prop_len)) {
+        (Ok(p), Ok(k)) => (p, k),
+        _ => return -1,
+    };
+    let scalar = match read_bytes(value_ptr, value_len).and_then(|b| parse_scalar(kind, b)) {
+        Ok(v) => v,
+        Err(_) => return -1,
+    };
+
+    match with_doc_mut(|doc| {
+        let obj = resolve_path(doc, path).map_err(|_| -2)?;
+        let prop = to_prop(doc, &obj, prop).map_err(|_| -2)?;
+        doc.put(&obj, prop, scalar).map_err(|_| -3)
+    }) {
+        Some(Ok(_)) => 0,
+        Some(Err(code)) => code,
+        None => -4,
+    }
+}
+
+/// Create a new empty object (0=map, 1=list, 2=text) at `prop` in the object at `path`.
+#[no_mangle]
+pub extern "C" fn am_obj_put_object(
+    path_ptr: *const u8,
+    path_len: usize,
+    prop_ptr: *const u8,
+    prop_len: usize,
+    obj_type: u8,
+) -> i32 {
+    let (path, prop) = match (read_str(path_ptr, path_len), read_str(prop_ptr, prop_len)) {
+        (Ok(p), Ok(k)) => (p, k),
+        _ => return -1,
+    };
+    let obj_type = match parse_obj_type(obj_type) {
+        Ok(t) => t,
+        Err(_) => return -1,
+    };
+
+    match with_doc_mut(|doc| {
+        let obj = resolve_path(doc, path).map_err(|_| -2)?;
+        let prop = to_prop(doc, &obj, prop).map_err(|_| -2)?;
+        doc.put_object(&obj, prop, obj_type).map_err(|_| -3)
+    }) {
+        Some(Ok(_)) => 0,
+        Some(Err(code)) => code,
+        None => -4,
+    }
+}
+
+/// Delete `prop` (map key or list index) from the object at `path`.
+#[no_mangle]
+pub extern "C" fn am_obj_delete(
+    path_ptr: *const u8,
+    path_len: usize,
+    prop_ptr: *const u8,
+    prop_len: usize,
+) -> i32 {
+    let (path, prop) = match (read_str(path_ptr, path_len), read_str(prop_ptr, prop_len)) {
+        (Ok(p), Ok(k)) => (p, k),
+        _ => return -1,
+    };
+
+    match with_doc_mut(|doc| {
+        let obj = resolve_path(doc, path).map_err(|_| -2)?;
+        let prop = to_prop(doc, &obj, prop).map_err(|_| -2)?;
+        doc.delete(&obj, prop).map_err(|_| -3)
+    }) {
+        Some(Ok(_)) => 0,
+        Some(Err(code)) => code,
+        None => -4,
+    }
+}
+
+/// Increment the counter at `prop` in the object at `path` by `delta`.
+#[no_mangle]
+pub extern "C" fn am_obj_increment(
+    path_ptr: *const u8,
+    path_len: usize,
+    prop_ptr: *const u8,
+    prop_len: usize,
+    delta: i64,
+) -> i32 {
+    let (path, prop) = match (read_str(path_ptr, path_len), read_str(prop_ptr, prop_len)) {
+        (Ok(p), Ok(k)) => (p, k),
+        _ => return -1,
+    };
+
+    match with_doc_mut(|doc| {
+        let obj = resolve_path(doc, path).map_err(|_| -2)?;
+        let prop = to_prop(doc, &obj, prop).map_err(|_| -2)?;
+        doc.increment(&obj, prop, delta).map_err(|_| -3)
+    }) {
+        Some(Ok(_)) => 0,
+        Some(Err(code)) => code,
+        None => -4,
+    }
+}
+
+/// Insert a scalar at `index` in the list at `path`.
+#[no_mangle]
+pub extern "C" fn am_obj_insert(
+    path_ptr: *const u8,
+    path_len: usize,
+    index: usize,
+    kind: u8,
+    value_ptr: *const u8,
+    value_len: usize,
+) -> i32 {
+    let path = match read_str(path_ptr, path_len) {
+        Ok(p) => p,
+        Err(_) => return -1,
+    };
+    let scalar = match read_bytes(value_ptr, value_len).and_then(|b| parse_scalar(kind, b)) {
+        Ok(v) => v,
+        Err(_) => return -1,
+    };
+
+    match with_doc_mut(|doc| {
+        let obj = resolve_path(doc, path).map_err(|_| -2)?;
+        doc.insert(&obj, index, scalar).map_err(|_| -3)
+    }) {
+        Some(Ok(_)) => 0,
+        Some(Err(code)) => code,
+        None => -4,
+    }
+}
+
+/// Insert a new empty object (0=map, 1=list, 2=text) at `index` in the list at `path`.
+#[no_mangle]
+pub extern "C" fn am_obj_insert_object(
+    path_ptr: *const u8,
+    path_len: usize,
+    index: usize,
+    obj_type: u8,
+) -> i32 {
+    let path = match read_str(path_ptr, path_len) {
+        Ok(p) => p,
+        Err(_) => return -1,
+    };
+    let obj_type = match parse_obj_type(obj_type) {
+        Ok(t) => t,
+        Err(_) => return -1,
+    };
+
+    match with_doc_mut(|doc| {
+        let obj = resolve_path(doc, path).map_err(|_| -2)?;
+        doc.insert_object(&obj, index, obj_type).map_err(|_| -3)
+    }) {
+        Some(Ok(_)) => 0,
+        Some(Err(code)) => code,
+        None => -4,
+    }
+}
+
+/// Splice the text object at `path` (character positions).
+#[no_mangle]
+pub extern "C" fn am_obj_splice_text(
+    path_ptr: *const u8,
+    path_len: usize,
+    pos: usize,
+    del_count: i64,
+    text_ptr: *const u8,
+    text_len: usize,
+) -> i32 {
+    let (path, text) = match (read_str(path_ptr, path_len), read_str(text_ptr, text_len)) {
+        (Ok(p), Ok(t)) => (p, t),
+        _ => return -1,
+    };
+    let del: isize = match del_count.try_into() {
+        Ok(n) => n,
+        Err(_) => return -1,
+    };
+
+    match with_doc_mut(|doc| {
+        let obj = resolve_path(doc, path).map_err(|_| -2)?;
+        doc.splice_text(&obj, pos, del, text).map_err(|_| -3)
+    }) {
+        Some(Ok(_)) => 0,
+        Some(Err(code)) => code,
+        None => -4,
+    }
+}
+
+/// Render the value at `path` as typed JSON and return its length.
+///
+/// The JSON is cached; call `am_obj_json` with a buffer of this size to read it.
+///
+/// # Returns
+/// - `>= 0` length of the JSON string in bytes
+/// - `-1` invalid path string
+/// - `-2` path does not resolve
+/// - `-4` document not initialized
+#[no_mangle]
+pub extern "C" fn am_obj_json_len(path_ptr: *const u8, path_len: usize) -> i32 {
+    let path = match read_str(path_ptr, path_len) {
+        Ok(p) => p,
+        Err(_) => return -1,
+    };
+
+    let json = match with_doc(|doc| {
+        let (value, id) = resolve_value(doc, path)?;
+        let mut out = String::new();
+        push_value_json(doc, &value, &id, &mut out);
+        Ok(out)
+    }) {
+        Some(Ok(json)) => json,
+        Some(Err(())) => return -2,
+        None => return -4,
+    };
+
+    let len = json.len() as i32;
+    LAST_JSON.with(|j| *j.borrow_mut() = json);
+    len
+}
+
+/// Copy the JSON rendered by the last `am_obj_json_len` call into `ptr_out`.
+#[no_mangle]
+pub extern "C" fn am_obj_json(ptr_out: *mut u8) -> i32 {
+    if ptr_out.is_null() {
+        return -1;
+    }
+    LAST_JSON.with(|j| {
+        let json = j.borrow();
+        let bytes = json.as_bytes();
+        unsafe {
+            std::ptr::copy_nonoverlapping(bytes.as_ptr(), ptr_out, bytes.len());
+        }
+        0
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::document::am_init;
+    use crate::value::{KIND_INT, KIND_STR};
+
+    fn json_at(path: &str) -> String {
+        let len = am_obj_json_len(path.as_ptr(), path.len());
+        assert!(len >= 0, "am_obj_json_len({}) = {}", path, len);
+        let mut buf = vec![0u8; len as usize];
+        assert_eq!(am_obj_json(buf.as_mut_ptr()), 0);
+        String::from_utf8(buf).unwrap()
+    }
+
+    #[test]
+    fn test_nested_put_and_json() {
+        assert_eq!(am_init(), 0);
+
+        let root = "ROOT";
+        let cfg = "config";
+        assert_eq!(am_obj_put_object(root.as_ptr(), root.len(), cfg.as_ptr(), cfg.len(), 0), 0);
+
+        let path = "ROOT.config";
+        let key = "retries";
+        let val = "3";
+        assert_eq!(
+            am_obj_put(path.as_ptr(), path.len(), key.as_ptr(), key.len(), KIND_INT, val.as_ptr(), val.len()),
+            0
+        );
+
+        assert_eq!(json_at("ROOT.config"), r#"{"t":"map","v":{"retries":{"t":"int","v":3}}}"#);
+    }
+
+    #[test]
+    fn test_list_ops() {
+        assert_eq!(am_init(), 0);
+
+        let root = "ROOT";
+        let key = "tags";
+        assert_eq!(am_obj_put_object(root.as_ptr(), root.len(), key.as_ptr(), key.len(), 1), 0);
+
+        let path = "ROOT.tags";
+        for (i, tag) in ["a", "b", "c"].iter().enumerate() {
+            assert_eq!(
+                am_obj_insert(path.as_ptr(), path.len(), i, KIND_STR, tag.as_ptr(), tag.len()),
+                0
+            );
+        }
+        let index = "1";
+        assert_eq!(am_obj_delete(path.as_ptr(), path.len(), index.as_ptr(), index.len()), 0);
+
+        assert_eq!(
+            json_at("ROOT.tags"),
+            r#"{"t":"list","v":[{"t":"str","v":"a"},{"t":"str","v":"c"}]}"#
+        );
+    }
+
+    #[test]
+    fn test_splice_text_at_path() {
+        assert_eq!(am_init(), 0);
+
+        let path = "ROOT.content";
+        let text = "Hello";
+        assert_eq!(am_obj_splice_text(path.as_ptr(), path.len(), 0, 0, text.as_ptr(), text.len()), 0);
+        assert_eq!(json_at("ROOT.content"), r#"{"t":"text","v":"Hello"}"#);
+    }
+}
@@ -0,0 +1,144 @@
+// ==============================================================================
+// Layer 2: Rust WASI Exports - Path Resolution (shared helpers)
+// ==============================================================================
+// ARCHITECTURE: Internal helper module for the WASI export layer (Layer 2/7).
+//
+// RESPONSIBILITIES:
+// - Resolve dotted object paths ("ROOT.users.0.name") to Automerge object IDs
+// - Read UTF-8 string and change hash arguments passed in from Go
+// - Check whether a sequence element (cursor) is visible at some heads
+//
+// DEPENDENTS:
+// - crate::object, crate::cursor, crate::undo, crate::blame
+//
+// NOTES:
+// - No exports here - helpers only
+// - Path segments are map keys, or list/text indices when the parent is a sequence
+// - Keys containing '.' cannot be addressed (Go side rejects them)
+// ==============================================================================
+
+use automerge::{AutoCommit, ChangeHash, Cursor, ObjId, ObjType, ReadDoc, Value, ROOT};
+
+/// Read a UTF-8 string argument from WASM linear memory.
+///
+/// A zero length is always valid (returns ""), even with a dangling pointer.
+pub(crate) fn read_str<'a>(ptr: *const u8, len: usize) -> Result<&'a str, ()> {
+    if len == 0 {
+        return Ok("");
+    }
+    if ptr.is_null() {
+        return Err(());
+    }
+    let slice = unsafe { std::slice::from_raw_parts(ptr, len) };
+    std::str::from_utf8(slice).map_err(|_| ())
+}
+
+/// Read a raw byte argument from WASM linear memory.
+pub(crate) fn read_bytes<'a>(ptr: *const u8, len: usize) -> Result<&'a [u8], ()> {
+    if len == 0 {
+        return Ok(&[]);
+    }
+    if ptr.is_null() {
+        return Err(());
+    }
+    Ok(unsafe { std::slice::from_raw_parts(ptr, len) })
+}
+
+/// Read `count` 32-byte change hashes from WASM linear memory.
+pub(crate) fn read_heads(ptr: *const u8, count: usize) -> Result<Vec<ChangeHash>, ()> {
+    if count == 0 {
+        return Ok(Vec::new());
+    }
+    if ptr.is_null() {
+        return Err(());
+    }
+    let bytes = unsafe { std::slice::from_raw_parts(ptr, count * 32) };
+    bytes
+        .chunks(32)
+        .map(|chunk| ChangeHash::try_from(chunk).map_err(|_| ()))
+        .collect()
+}
+
+/// Index of the element at `cursor`, if it is visible at `heads` (None = now).
+///
+/// Cursors to deleted elements still resolve (to where the element was), so
+/// the position is checked by mapping it back to a cursor.
+pub(crate) fn visible_at(
+    doc: &AutoCommit,
+    obj: &ObjId,
+    cursor: &Cursor,
+    heads: Option<&[ChangeHash]>,
+) -> Option<usize> {
+    let pos = doc.get_cursor_position(obj, cursor, heads).ok()?;
+    let found = doc.get_cursor(obj, pos, heads).ok()?;
+    if found.to_string() == cursor.to_string() {
+        Some(pos)
+    } else {
+        None
+    }
+}
+
+/// Resolve a dotted path to the value stored there.
+///
+/// "ROOT" resolves to the root map. Each following segment is looked up in
+/// the current object: as a key for maps, as an index for lists and text.
+pub(crate) fn resolve_value<'a>(doc: &'a AutoCommit, path: &str) -> Result<(Value<'a>, ObjId), ()> {
+    let mut parts = path.split('.');
+    if parts.next() != Some("ROOT") {
+        return Err(());
+    }
+
+    let mut current: (Value<'a>, ObjId) = (Value::Object(ObjType::Map), ROOT);
+    for part in parts {
+        let obj_id = match &current.0 {
+            Value::Object(_) => current.1.clone(),
+            Value::Scalar(_) => return Err(()), // Cannot descend into a scalar
+        };
+
+        let next = match doc.object_type(&obj_id) {
+            Ok(ObjType::List) | Ok(ObjType::Text) => {
+                let index: usize = part.parse().map_err(|_| ())?;
+                doc.get(&obj_id, index)
+            }
+            Ok(_) => doc.get(&obj_id, part),
+            Err(_) => return Err(()),
+        };
+
+        current = match next {
+            Ok(Some(v)) => v,
+            _ => return Err(()),
+        };
+    }
+
+    Ok(current)
+}
+
+/// Resolve a dotted path to an object ID (map, list or text).
+pub(crate) fn resolve_path(doc: &AutoCommit, path: &str) -> Result<ObjId, ()> {
+    match resolve_value(doc, path)? {
+        (Value::Object(_), id) => Ok(id),
+        (Value::Scalar(_), _) => Err(()),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use automerge::transaction::Transactable;
+
+    #[test]
+    fn test_resolve_nested() {
+        let mut doc = AutoCommit::new();
+        let users = doc.put_object(ROOT, "users", ObjType::List).unwrap();
+        let alice = doc.insert_object(&users, 0, ObjType::Map).unwrap();
+        doc.put(&alice, "name", "Alice").unwrap();
+
+        assert_eq!(resolve_path(&doc, "ROOT").unwrap(), ROOT);
+        assert_eq!(resolve_path(&doc, "ROOT.users").unwrap(), users);
+        assert_eq!(resolve_path(&doc, "ROOT.users.0").unwrap(), alice);
+        assert!(resolve_path(&doc, "ROOT.users.0.name").is_err());
+        assert!(resolve_value(&doc, "ROOT.users.0.name").is_ok());
+        assert!(resolve_path(&doc, "ROOT.users.1").is_err());
+        assert!(resolve_path(&doc, "users").is_err());
+    }
+}
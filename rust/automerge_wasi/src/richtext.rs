@@ -7,11 +7,13 @@
 // - WASI-compatible function exports (C ABI)
 // - Memory management (reading/writing linear memory)
 // - UTF-8 string marshaling
+// - Text patches between two sets of heads (incremental editor updates)
 // - Error code translation (Rust Result → i32)
 //
 // DEPENDENCIES:
 // - Layer 1: automerge crate (CRDT core)
 // - crate::state (global document state)
+// - crate::expand (records and reports each mark's expand setting)
 //
 // DEPENDENTS:
 // - Layer 3: pkg/wazero/crdt_richtext.go (FFI wrappers)
@@ -26,24 +28,42 @@
 // NOTES:
 // - All exports use #[no_mangle] and extern "C"
 // - Marks are CRDT-aware (concurrent formatting merges correctly)
+// - Marks added here are recorded under ROOT._marks with their expand
+//   setting, which the marks JSON reports (see crate::expand); unmarking
+//   prunes the records it invalidates
 // - Return 0 on success, negative error codes on failure
 // ==============================================================================
 
-// WASI exports for Automerge rich text operations (Marks and Spans)
+// WASI exports for Automerge rich text operations (Marks, Spans and Block markers)
 //
 // Marks allow you to add formatting (bold, italic, links, etc.) to text ranges.
 // Marks are CRDT-aware and merge correctly when users concurrently format
 // the same text.
 
+use crate::expand::{self, expand_mode};
+use crate::path::{read_bytes, read_heads, read_str, resolve_path};
 use crate::state::{with_doc, with_doc_mut, get_text_obj_id};
-use automerge::{marks::{ExpandMark, Mark}, transaction::Transactable, ReadDoc, ScalarValue};
+use crate::value::{parse_scalar, push_json_str, push_scalar_json, push_value_json};
+use automerge::{
+    marks::Mark,
+    transaction::Transactable,
+    AutoCommit, ChangeHash, ObjId, ObjType, PatchAction, Prop, ReadDoc, ScalarValue, Value,
+};
+use std::cell::RefCell;
+
+thread_local! {
+    static LAST_MARKS: RefCell<String> = RefCell::new(String::new());
+    static LAST_SPANS: RefCell<String> = RefCell::new(String::new());
+    static LAST_PATCHES: RefCell<String> = RefCell::new(String::new());
+}
 
 /// Add a mark (formatting) to a range of text.
 ///
 /// # Parameters
 /// - `name_ptr`: Pointer to mark name string (UTF-8) (e.g., "bold", "italic")
 /// - `name_len`: Length of name in bytes
-/// - `value_ptr`: Pointer to mark value string (UTF-8) (e.g., "true", "https://...")
+/// - `kind`: Scalar kind of the value (see `crate::value::KIND_*`)
+/// - `value_ptr`: Pointer to the encoded mark value (e.g., "true", "https://...")
 /// - `value_len`: Length of value in bytes
 /// - `start`: Start index of the range
 /// - `end`: End index of the range (exclusive)
@@ -51,13 +71,14 @@ use automerge::{marks::{ExpandMark, Mark}, transaction::Transactable, ReadDoc, S
 ///
 /// # Returns
 /// - `0` on success
-/// - `-1` on UTF-8 validation error
+/// - `-1` on UTF-8 validation error or invalid value
 /// - `-2` on Automerge error
 /// - `-3` if document not initialized
 #[no_mangle]
 pub extern "C" fn am_mark(
     name_ptr: *const u8,
     name_len: usize,
+    kind: u8,
     value_ptr: *const u8,
     value_len: usize,
     start: usize,
@@ -75,18 +96,14 @@ pub extern "C" fn am_mark(
     };
 
     let value_slice = unsafe { std::slice::from_raw_parts(value_ptr, value_len) };
-    let value = match std::str::from_utf8(value_slice) {
-        Ok(s) => s,
+    let value = match parse_scalar(kind, value_slice) {
+        Ok(v) => v,
         Err(_) => return -1,
     };
 
-    let expand_mode = match expand {
-        0 => ExpandMark::None,
-        1 => ExpandMark::Before,
-        2 => ExpandMark::After,
-        3 => ExpandMark::Both,
-        _ => return -1,
-    };
+    if expand_mode(expand).is_none() {
+        return -1;
+    }
 
     let text_obj_id = match get_text_obj_id() {
         Some(id) => id,
@@ -98,9 +115,9 @@ pub extern "C" fn am_mark(
             start,
             end,
             name: name.into(), // String implements Into<SmolStr>
-            value: ScalarValue::Str(value.into()),
+            value,
         };
-        doc.mark(&text_obj_id, mark, expand_mode)
+        expand::mark(doc, &text_obj_id, mark, expand)
     });
 
     match result {
@@ -110,6 +127,57 @@ pub extern "C" fn am_mark(
     }
 }
 
+/// Add a mark to a range of the text object at a path.
+///
+/// Same as `am_mark`, for any text object rather than ROOT.content.
+///
+/// # Returns
+/// - `0` on success
+/// - `-1` on UTF-8 validation error or invalid value/expand
+/// - `-2` path does not resolve to a text object
+/// - `-3` on Automerge error (e.g. range out of bounds)
+/// - `-4` if document not initialized
+#[no_mangle]
+pub extern "C" fn am_obj_mark(
+    path_ptr: *const u8,
+    path_len: usize,
+    name_ptr: *const u8,
+    name_len: usize,
+    kind: u8,
+    value_ptr: *const u8,
+    value_len: usize,
+    start: usize,
+    end: usize,
+    expand: u8,
+) -> i32 {
+    let (path, name) = match (read_str(path_ptr, path_len), read_str(name_ptr, name_len)) {
+        (Ok(p), Ok(n)) => (p, n),
+        _ => return -1,
+    };
+    let value = match read_bytes(value_ptr, value_len).map(|b| parse_scalar(kind, b)) {
+        Ok(Ok(v)) => v,
+        _ => return -1,
+    };
+    if expand_mode(expand).is_none() {
+        return -1;
+    }
+
+    match with_doc_mut(|doc| {
+        let obj = text_at(doc, path)?;
+        let mark = Mark {
+            start,
+            end,
+            name: name.into(),
+            value,
+        };
+        expand::mark(doc, &obj, mark, expand).map_err(|_| -3)
+    }) {
+        Some(Ok(_)) => 0,
+        Some(Err(code)) => code,
+        None => -4,
+    }
+}
+
 /// Remove a mark (formatting) from a range of text.
 ///
 /// # Parameters
@@ -142,12 +210,9 @@ pub extern "C" fn am_unmark(
         Err(_) => return -1,
     };
 
-    let expand_mode = match expand {
-        0 => ExpandMark::None,
-        1 => ExpandMark::Before,
-        2 => ExpandMark::After,
-        3 => ExpandMark::Both,
-        _ => return -1,
+    let mode = match expand_mode(expand) {
+        Some(mode) => mode,
+        None => return -1,
     };
 
     let text_obj_id = match get_text_obj_id() {
@@ -156,7 +221,7 @@ pub extern "C" fn am_unmark(
     };
 
     let result = with_doc_mut(|doc| {
-        doc.unmark(&text_obj_id, name, start, end, expand_mode)
+        expand::unmark(doc, &text_obj_id, name, start, end, mode)
     });
 
     match result {
@@ -166,6 +231,45 @@ pub extern "C" fn am_unmark(
     }
 }
 
+/// Remove a mark from a range of the text object at a path.
+///
+/// Same as `am_unmark`, for any text object rather than ROOT.content.
+///
+/// # Returns
+/// - `0` on success
+/// - `-1` on UTF-8 validation error or invalid expand
+/// - `-2` path does not resolve to a text object
+/// - `-3` on Automerge error (e.g. range out of bounds)
+/// - `-4` if document not initialized
+#[no_mangle]
+pub extern "C" fn am_obj_unmark(
+    path_ptr: *const u8,
+    path_len: usize,
+    name_ptr: *const u8,
+    name_len: usize,
+    start: usize,
+    end: usize,
+    expand: u8,
+) -> i32 {
+    let (path, name) = match (read_str(path_ptr, path_len), read_str(name_ptr, name_len)) {
+        (Ok(p), Ok(n)) => (p, n),
+        _ => return -1,
+    };
+    let mode = match expand_mode(expand) {
+        Some(mode) => mode,
+        None => return -1,
+    };
+
+    match with_doc_mut(|doc| {
+        let obj = text_at(doc, path)?;
+        expand::unmark(doc, &obj, name, start, end, mode).map_err(|_| -3)
+    }) {
+        Some(Ok(_)) => 0,
+        Some(Err(code)) => code,
+        None => -4,
+    }
+}
+
 /// Get the number of marks at a specific index.
 ///
 /// Call this before `am_get_marks()` to allocate buffer.
@@ -201,125 +305,531 @@ pub extern "C" fn am_get_marks_count(index: usize) -> u32 {
     result.unwrap_or(0) as u32
 }
 
-/// Get all marks in the text object.
+/// Get the number of marks at `index` in the text object at a path.
 ///
-/// Returns marks as JSON array string.
-/// Format: [{"name": "bold", "value": "true", "start": 0, "end": 5}, ...]
+/// Same as `am_get_marks_count`, for any text object rather than ROOT.content.
 ///
-/// Call `am_marks_len()` first to allocate buffer.
+/// # Returns
+/// - Number of marks at the index
+/// - `-1` invalid path string
+/// - `-2` path does not resolve to a text object
+/// - `-3` on Automerge error
+/// - `-4` if document not initialized
+#[no_mangle]
+pub extern "C" fn am_obj_get_marks_count(path_ptr: *const u8, path_len: usize, index: usize) -> i32 {
+    let path = match read_str(path_ptr, path_len) {
+        Ok(p) => p,
+        Err(_) => return -1,
+    };
+
+    match with_doc(|doc| {
+        let obj = text_at(doc, path)?;
+        let marks = doc.marks(&obj).map_err(|_| -3)?;
+        Ok(marks.iter().filter(|m| m.start <= index && index < m.end).count() as i32)
+    }) {
+        Some(Ok(count)) => count,
+        Some(Err(code)) => code,
+        None => -4,
+    }
+}
+
+/// Render the marks of the text object `obj` as JSON (see `am_marks_len`).
+fn marks_json(doc: &AutoCommit, obj: &ObjId) -> Result<String, ()> {
+    let marks = doc.marks(obj).map_err(|_| ())?;
+    let expands = expand::mark_expands(doc, obj, &marks, None);
+
+    let mut json = String::from("[");
+    for (i, mark) in marks.iter().enumerate() {
+        if i > 0 {
+            json.push(',');
+        }
+        json.push_str(r#"{"name":"#);
+        push_json_str(&mut json, mark.name());
+        json.push_str(r#","value":"#);
+        push_scalar_json(&mut json, mark.value());
+        json.push_str(&format!(
+            r#","start":{},"end":{},"expand":{}}}"#,
+            mark.start, mark.end, expands[i]
+        ));
+    }
+    json.push(']');
+    Ok(json)
+}
+
+/// Get the length of the marks JSON string.
 ///
-/// # Parameters
-/// - `marks_out`: Pointer to buffer to receive JSON string
+/// Renders all marks in the text object as a JSON array (cached for
+/// `am_marks`):
+/// `[{"name":"bold","value":{"t":"bool","v":true},"start":0,"end":5,"expand":3}, ...]`
+///
+/// Values are typed nodes (see `crate::value::push_scalar_json`), expand is
+/// 0=none, 1=before, 2=after, 3=both.
+///
+/// # Returns
+/// - Length in bytes of JSON string
+/// - `0` if document not initialized or on Automerge error
+#[no_mangle]
+pub extern "C" fn am_marks_len() -> u32 {
+    let text_obj_id = match get_text_obj_id() {
+        Some(id) => id,
+        None => return 0,
+    };
+
+    let result = with_doc(|doc| marks_json(doc, &text_obj_id).ok());
+
+    match result {
+        Some(Some(json)) => {
+            let len = json.len() as u32;
+            LAST_MARKS.with(|m| *m.borrow_mut() = json);
+            len
+        }
+        _ => 0,
+    }
+}
+
+/// Render the marks of the text object at a path as JSON (cached for
+/// `am_marks`, same format as `am_marks_len`).
+///
+/// # Returns
+/// - `>= 0` length of the JSON (fetch with `am_marks`)
+/// - `-1` invalid path string
+/// - `-2` path does not resolve to a text object
+/// - `-3` on Automerge error
+/// - `-4` if document not initialized
+#[no_mangle]
+pub extern "C" fn am_obj_marks_len(path_ptr: *const u8, path_len: usize) -> i32 {
+    let path = match read_str(path_ptr, path_len) {
+        Ok(p) => p,
+        Err(_) => return -1,
+    };
+
+    let json = match with_doc(|doc| {
+        let obj = text_at(doc, path)?;
+        marks_json(doc, &obj).map_err(|_| -3)
+    }) {
+        Some(Ok(json)) => json,
+        Some(Err(code)) => return code,
+        None => return -4,
+    };
+
+    let len = json.len() as i32;
+    LAST_MARKS.with(|m| *m.borrow_mut() = json);
+    len
+}
+
+/// Copy the marks JSON rendered by the last `am_marks_len` or
+/// `am_obj_marks_len` call into `marks_out`.
 ///
 /// # Returns
 /// - `0` on success
 /// - `-1` if marks_out is null
-/// - `-2` on Automerge error
-/// - `-3` if document not initialized
 #[no_mangle]
 pub extern "C" fn am_marks(marks_out: *mut u8) -> i32 {
     if marks_out.is_null() {
         return -1;
     }
+    LAST_MARKS.with(|m| {
+        let json = m.borrow();
+        let bytes = json.as_bytes();
+        unsafe {
+            std::ptr::copy_nonoverlapping(bytes.as_ptr(), marks_out, bytes.len());
+        }
+        0
+    })
+}
 
-    let text_obj_id = match get_text_obj_id() {
-        Some(id) => id,
-        None => return -3,
-    };
+/// One rendered span: text with its active marks (sorted by name), or a
+/// block marker (the index of the marker in the text object).
+enum SpanPart {
+    Text(String, Vec<(String, ScalarValue)>),
+    Block(usize),
+}
 
-    let result = with_doc(|doc| {
-        match doc.marks(&text_obj_id) {
-            Ok(marks) => {
-                // Build JSON array
-                let mut json = String::from("[");
-                let mut first = true;
+/// Render the text object `obj` as spans.
+///
+/// Consecutive characters with the same active marks form one text span;
+/// every block marker is a span of its own, holding the marker's map.
+///
+/// Format: `[{"text":"Hi","marks":{"bold":{"t":"bool","v":true}}},{"block":{"t":"map","v":{..}}}]`
+fn spans_json(doc: &AutoCommit, obj: &ObjId) -> Result<String, ()> {
+    let mut marks = doc.marks(obj).map_err(|_| ())?;
+    marks.sort_by_key(|m| m.start);
 
-                for mark in marks {
-                    if !first {
+    let mut parts: Vec<SpanPart> = Vec::new();
+    let mut next = 0; // next mark to activate
+    let mut active: Vec<&Mark> = Vec::new();
+
+    for i in 0..doc.length(obj) {
+        let ch = match doc.get(obj, i) {
+            Ok(Some((Value::Object(ObjType::Map), _))) => {
+                parts.push(SpanPart::Block(i));
+                continue;
+            }
+            Ok(Some((Value::Scalar(s), _))) => match s.as_ref() {
+                ScalarValue::Str(c) => c.to_string(),
+                _ => continue,
+            },
+            _ => continue,
+        };
+
+        active.retain(|m| m.end > i);
+        while next < marks.len() && marks[next].start <= i {
+            if marks[next].end > i {
+                active.push(&marks[next]);
+            }
+            next += 1;
+        }
+        let mut set: Vec<(String, ScalarValue)> = active
+            .iter()
+            .filter(|m| !matches!(m.value(), ScalarValue::Null))
+            .map(|m| (m.name().to_string(), m.value().clone()))
+            .collect();
+        set.sort_by(|a, b| a.0.cmp(&b.0));
+
+        match parts.last_mut() {
+            Some(SpanPart::Text(text, current)) if *current == set => text.push_str(&ch),
+            _ => parts.push(SpanPart::Text(ch, set)),
+        }
+    }
+
+    let mut json = String::from("[");
+    for (n, part) in parts.iter().enumerate() {
+        if n > 0 {
+            json.push(',');
+        }
+        match part {
+            SpanPart::Text(text, set) => {
+                json.push_str(r#"{"text":"#);
+                push_json_str(&mut json, text);
+                json.push_str(r#","marks":{"#);
+                for (i, (name, value)) in set.iter().enumerate() {
+                    if i > 0 {
                         json.push(',');
                     }
-                    first = false;
-
-                    let value_str = match mark.value() {
-                        ScalarValue::Str(s) => s.to_string(),
-                        ScalarValue::Boolean(b) => b.to_string(),
-                        ScalarValue::Int(i) => i.to_string(),
-                        ScalarValue::Uint(u) => u.to_string(),
-                        _ => "null".to_string(),
-                    };
-
-                    json.push_str(&format!(
-                        r#"{{"name":"{}","value":"{}","start":{},"end":{}}}"#,
-                        mark.name(),
-                        value_str,
-                        mark.start,
-                        mark.end
-                    ));
+                    push_json_str(&mut json, name);
+                    json.push(':');
+                    push_scalar_json(&mut json, value);
+                }
+                json.push_str("}}");
+            }
+            SpanPart::Block(index) => {
+                json.push_str(r#"{"block":"#);
+                match doc.get(obj, *index) {
+                    Ok(Some((value, id))) => push_value_json(doc, &value, &id, &mut json),
+                    _ => json.push_str(r#"{"t":"map","v":{}}"#),
                 }
+                json.push('}');
+            }
+        }
+    }
+    json.push(']');
+    Ok(json)
+}
+
+/// Render the text at a path as spans of text with their active marks, and
+/// block markers (see `spans_json` for the format).
+///
+/// # Parameters
+/// - `path_ptr`/`path_len`: dotted path of a text object (e.g. "ROOT.content")
+///
+/// # Returns
+/// - `>= 0` length of the JSON (fetch with `am_spans`)
+/// - `-1` invalid path string
+/// - `-2` path does not resolve to a text object
+/// - `-3` on Automerge error
+/// - `-4` if document not initialized
+#[no_mangle]
+pub extern "C" fn am_spans_len(path_ptr: *const u8, path_len: usize) -> i32 {
+    let path = match read_str(path_ptr, path_len) {
+        Ok(p) => p,
+        Err(_) => return -1,
+    };
 
-                json.push(']');
+    let json = match with_doc(|doc| {
+        let obj = text_at(doc, path)?;
+        spans_json(doc, &obj).map_err(|_| -3)
+    }) {
+        Some(Ok(json)) => json,
+        Some(Err(code)) => return code,
+        None => return -4,
+    };
 
-                let bytes = json.as_bytes();
-                unsafe {
-                    std::ptr::copy_nonoverlapping(bytes.as_ptr(), marks_out, bytes.len());
-                }
+    let len = json.len() as i32;
+    LAST_SPANS.with(|s| *s.borrow_mut() = json);
+    len
+}
 
-                Ok(0)
-            }
-            Err(_) => Err(-2),
+/// Copy the JSON rendered by the last `am_spans_len` call into `ptr_out`.
+#[no_mangle]
+pub extern "C" fn am_spans(ptr_out: *mut u8) -> i32 {
+    if ptr_out.is_null() {
+        return -1;
+    }
+    LAST_SPANS.with(|s| {
+        let json = s.borrow();
+        let bytes = json.as_bytes();
+        unsafe {
+            std::ptr::copy_nonoverlapping(bytes.as_ptr(), ptr_out, bytes.len());
         }
-    });
+        0
+    })
+}
 
-    match result {
-        Some(Ok(code)) => code,
-        Some(Err(code)) => code,
-        None => -3,
+/// Resolve `path` to a text object.
+fn text_at(doc: &AutoCommit, path: &str) -> Result<ObjId, i32> {
+    let obj = resolve_path(doc, path).map_err(|_| -2)?;
+    match doc.object_type(&obj) {
+        Ok(ObjType::Text) => Ok(obj),
+        _ => Err(-2),
     }
 }
 
-/// Get the length of the marks JSON string.
+/// Insert an empty block marker at `index` in the text at a path.
 ///
-/// Call this before `am_marks()` to allocate buffer.
+/// The marker is a map in the text sequence; the caller fills in its
+/// "type", "parents" and "attrs" (it is addressable as "<path>.<index>").
 ///
 /// # Returns
-/// - Length in bytes of JSON string
-/// - `0` if document not initialized or no marks
+/// - `0` on success
+/// - `-1` invalid path string
+/// - `-2` path does not resolve to a text object
+/// - `-3` on Automerge error (e.g. index out of bounds)
+/// - `-4` if document not initialized
 #[no_mangle]
-pub extern "C" fn am_marks_len() -> u32 {
-    let text_obj_id = match get_text_obj_id() {
-        Some(id) => id,
-        None => return 0,
+pub extern "C" fn am_split_block(path_ptr: *const u8, path_len: usize, index: usize) -> i32 {
+    let path = match read_str(path_ptr, path_len) {
+        Ok(p) => p,
+        Err(_) => return -1,
     };
 
-    let result = with_doc(|doc| {
-        match doc.marks(&text_obj_id) {
-            Ok(marks) => {
-                // Estimate JSON size
-                let mut len = 2; // "[]"
-                let mut first = true;
+    match with_doc_mut(|doc| {
+        let obj = text_at(doc, path)?;
+        doc.split_block(&obj, index).map_err(|_| -3)
+    }) {
+        Some(Ok(_)) => 0,
+        Some(Err(code)) => code,
+        None => -4,
+    }
+}
 
-                for mark in marks {
-                    if !first {
-                        len += 1; // ","
-                    }
-                    first = false;
+/// Remove the block marker at `index` in the text at a path, joining the
+/// block with the previous one.
+///
+/// # Returns
+/// - `0` on success
+/// - `-1` invalid path string
+/// - `-2` path does not resolve to a text object, or no block at `index`
+/// - `-3` on Automerge error
+/// - `-4` if document not initialized
+#[no_mangle]
+pub extern "C" fn am_join_block(path_ptr: *const u8, path_len: usize, index: usize) -> i32 {
+    let path = match read_str(path_ptr, path_len) {
+        Ok(p) => p,
+        Err(_) => return -1,
+    };
+
+    match with_doc_mut(|doc| {
+        let obj = text_at(doc, path)?;
+        match doc.get(&obj, index) {
+            Ok(Some((Value::Object(ObjType::Map), _))) => {}
+            _ => return Err(-2),
+        }
+        doc.join_block(&obj, index).map_err(|_| -3)
+    }) {
+        Some(Ok(_)) => 0,
+        Some(Err(code)) => code,
+        None => -4,
+    }
+}
+
+/// Render the block marker map `id` as a typed JSON node.
+fn block_json(doc: &AutoCommit, id: &ObjId) -> String {
+    let mut out = String::new();
+    push_value_json(doc, &Value::Object(ObjType::Map), id, &mut out);
+    out
+}
+
+/// Render the edits to the text object `obj` between two sets of heads as
+/// patches, in the order they apply: each index refers to the text with the
+/// previous patches already applied.
+///
+/// Block markers are reported with their content at the current heads;
+/// edits inside an existing marker are reported as a "block" patch for its
+/// index with `"replace":true`.
+///
+/// Format:
+/// `[{"action":"insert","index":0,"text":"Hi","marks":{"bold":{"t":"bool","v":true}}},`
+/// ` {"action":"delete","index":2,"length":1},`
+/// ` {"action":"block","index":0,"replace":false,"block":{"t":"map","v":{..}}},`
+/// ` {"action":"mark","name":"bold","value":{"t":"bool","v":true},"start":0,"end":2}]`
+fn text_patches_json(doc: &mut AutoCommit, obj: &ObjId, before: &[ChangeHash], after: &[ChangeHash]) -> String {
+    let patches = doc.diff(before, after);
+    let mut json = String::from("[");
+    let mut first = true;
+    let mut push = |json: &mut String, part: String| {
+        if !first {
+            json.push(',');
+        }
+        first = false;
+        json.push_str(&part);
+    };
+    let mut last_update: Option<(usize, ObjId)> = None;
+    let mut inserted: Vec<ObjId> = Vec::new(); // markers reported with their content already
 
-                    let value_str = match mark.value() {
-                        ScalarValue::Str(s) => s.len(),
-                        _ => 10, // Rough estimate for numbers/bools
-                    };
+    for patch in &patches {
+        if &patch.obj != obj {
+            // An edit inside a block marker of this text: the marker is the
+            // object right below the text in the patch path
+            let marker = patch.path.iter().position(|(parent, _)| parent == obj).and_then(|k| {
+                let index = match patch.path[k].1 {
+                    Prop::Seq(i) => i,
+                    _ => return None,
+                };
+                let id = patch.path.get(k + 1).map(|(id, _)| id.clone()).unwrap_or_else(|| patch.obj.clone());
+                Some((index, id))
+            });
+            if let Some((index, id)) = marker {
+                if !inserted.contains(&id) && last_update.as_ref() != Some(&(index, id.clone())) {
+                    let mut part = format!(r#"{{"action":"block","index":{},"replace":true,"block":"#, index);
+                    part.push_str(&block_json(doc, &id));
+                    part.push('}');
+                    push(&mut json, part);
+                    last_update = Some((index, id));
+                }
+            }
+            continue;
+        }
+        last_update = None;
 
-                    // Estimate: {"name":"X","value":"Y","start":Z,"end":W}
-                    len += 40 + mark.name().len() + value_str + 20; // Conservative estimate
+        match &patch.action {
+            PatchAction::SpliceText { index, value, marks } => {
+                let mut part = format!(r#"{{"action":"insert","index":{},"text":"#, index);
+                push_json_str(&mut part, &value.make_string());
+                part.push_str(r#","marks":{"#);
+                if let Some(marks) = marks {
+                    let mut set: Vec<(&str, &ScalarValue)> = marks
+                        .iter()
+                        .filter(|(_, v)| !matches!(v, ScalarValue::Null))
+                        .collect();
+                    set.sort_by(|a, b| a.0.cmp(b.0));
+                    for (i, (name, value)) in set.iter().enumerate() {
+                        if i > 0 {
+                            part.push(',');
+                        }
+                        push_json_str(&mut part, name);
+                        part.push(':');
+                        push_scalar_json(&mut part, value);
+                    }
                 }
+                part.push_str("}}");
+                push(&mut json, part);
+            }
+            PatchAction::Insert { index, values } => {
+                for (offset, (value, id, _)) in values.iter().enumerate() {
+                    let mut part = String::new();
+                    match value {
+                        Value::Object(ObjType::Map) => {
+                            part.push_str(&format!(r#"{{"action":"block","index":{},"replace":false,"block":"#, index + offset));
+                            part.push_str(&block_json(doc, id));
+                            part.push('}');
+                            inserted.push(id.clone());
+                        }
+                        _ => {
+                            // Any other element still occupies one position
+                            part.push_str(&format!(r#"{{"action":"insert","index":{},"text":"￼","marks":{{}}}}"#, index + offset));
+                        }
+                    }
+                    push(&mut json, part);
+                }
+            }
+            PatchAction::DeleteSeq { index, length } => {
+                push(&mut json, format!(r#"{{"action":"delete","index":{},"length":{}}}"#, index, length));
+            }
+            PatchAction::Mark { marks } => {
+                for mark in marks {
+                    let mut part = String::from(r#"{"action":"mark","name":"#);
+                    push_json_str(&mut part, mark.name());
+                    part.push_str(r#","value":"#);
+                    push_scalar_json(&mut part, mark.value());
+                    part.push_str(&format!(r#","start":{},"end":{}}}"#, mark.start, mark.end));
+                    push(&mut json, part);
+                }
+            }
+            _ => {}
+        }
+    }
+    json.push(']');
+    json
+}
 
-                len
+/// Render the edits to the text at a path between two sets of heads as
+/// patches (see `text_patches_json` for the format).
+///
+/// # Parameters
+/// - `path_ptr`/`path_len`: dotted path of a text object (e.g. "ROOT.content")
+/// - `before_ptr`/`before_count`: heads to diff from (32-byte hashes)
+/// - `after_ptr`/`after_count`: heads to diff to (32-byte hashes)
+///
+/// # Returns
+/// - `>= 0` length of the JSON (fetch with `am_text_patches`)
+/// - `-1` invalid argument
+/// - `-2` path does not resolve to a text object
+/// - `-3` unknown change hash
+/// - `-4` if document not initialized
+#[no_mangle]
+pub extern "C" fn am_text_patches_len(
+    path_ptr: *const u8,
+    path_len: usize,
+    before_ptr: *const u8,
+    before_count: usize,
+    after_ptr: *const u8,
+    after_count: usize,
+) -> i32 {
+    let path = match read_str(path_ptr, path_len) {
+        Ok(p) => p,
+        Err(_) => return -1,
+    };
+    let (before, after) = match (
+        read_heads(before_ptr, before_count),
+        read_heads(after_ptr, after_count),
+    ) {
+        (Ok(b), Ok(a)) => (b, a),
+        _ => return -1,
+    };
+
+    let json = match with_doc_mut(|doc| {
+        for hash in before.iter().chain(after.iter()) {
+            if doc.get_change_by_hash(hash).is_none() {
+                return Err(-3);
             }
-            Err(_) => 0,
         }
-    });
+        let obj = text_at(doc, path)?;
+        Ok(text_patches_json(doc, &obj, &before, &after))
+    }) {
+        Some(Ok(json)) => json,
+        Some(Err(code)) => return code,
+        None => return -4,
+    };
 
-    result.unwrap_or(0) as u32
+    let len = json.len() as i32;
+    LAST_PATCHES.with(|s| *s.borrow_mut() = json);
+    len
+}
+
+/// Copy the JSON rendered by the last `am_text_patches_len` call into `ptr_out`.
+#[no_mangle]
+pub extern "C" fn am_text_patches(ptr_out: *mut u8) -> i32 {
+    if ptr_out.is_null() {
+        return -1;
+    }
+    LAST_PATCHES.with(|s| {
+        let json = s.borrow();
+        let bytes = json.as_bytes();
+        unsafe {
+            std::ptr::copy_nonoverlapping(bytes.as_ptr(), ptr_out, bytes.len());
+        }
+        0
+    })
 }
 
 #[cfg(test)]
@@ -328,6 +838,8 @@ mod tests {
     use crate::document::am_init;
     use crate::memory::{am_alloc, am_free};
     use crate::text::am_text_splice;
+    use crate::value::{KIND_BOOL, KIND_STR};
+    use automerge::marks::ExpandMark;
 
     #[test]
     fn test_mark_basic() {
@@ -343,6 +855,7 @@ mod tests {
         let result = am_mark(
             name.as_ptr(),
             name.len(),
+            KIND_STR,
             value.as_ptr(),
             value.len(),
             0,
@@ -366,6 +879,7 @@ mod tests {
             am_mark(
                 name.as_ptr(),
                 name.len(),
+                KIND_STR,
                 value.as_ptr(),
                 value.len(),
                 0,
@@ -394,6 +908,7 @@ mod tests {
             am_mark(
                 name.as_ptr(),
                 name.len(),
+                KIND_STR,
                 value.as_ptr(),
                 value.len(),
                 0,
@@ -438,6 +953,7 @@ mod tests {
             am_mark(
                 name.as_ptr(),
                 name.len(),
+                KIND_STR,
                 value.as_ptr(),
                 value.len(),
                 0,
@@ -451,4 +967,158 @@ mod tests {
         let count = am_get_marks_count(0);
         assert!(count >= 1);
     }
+
+    #[test]
+    fn test_spans_json() {
+        assert_eq!(am_init(), 0);
+
+        let text = "Hello World";
+        assert_eq!(am_text_splice(0, 0, text.as_ptr(), text.len()), 0);
+
+        let name = "bold";
+        let value = "true";
+        assert_eq!(am_mark(name.as_ptr(), name.len(), KIND_STR, value.as_ptr(), value.len(), 0, 5, 0), 0);
+
+        let path = "ROOT.content";
+        let len = am_spans_len(path.as_ptr(), path.len());
+        assert!(len > 0);
+        let mut buf = vec![0u8; len as usize];
+        assert_eq!(am_spans(buf.as_mut_ptr()), 0);
+
+        assert_eq!(
+            String::from_utf8(buf).unwrap(),
+            r#"[{"text":"Hello","marks":{"bold":{"t":"str","v":"true"}}},{"text":" World","marks":{}}]"#
+        );
+    }
+
+    #[test]
+    fn test_split_and_join_block() {
+        assert_eq!(am_init(), 0);
+
+        let text = "TitleBody";
+        assert_eq!(am_text_splice(0, 0, text.as_ptr(), text.len()), 0);
+
+        let path = "ROOT.content";
+        assert_eq!(am_split_block(path.as_ptr(), path.len(), 5), 0);
+
+        let len = am_spans_len(path.as_ptr(), path.len());
+        let mut buf = vec![0u8; len as usize];
+        assert_eq!(am_spans(buf.as_mut_ptr()), 0);
+        let json = String::from_utf8(buf).unwrap();
+        assert!(json.contains(r#"{"block":{"t":"map""#), "{}", json);
+
+        // Only block markers can be joined
+        assert_eq!(am_join_block(path.as_ptr(), path.len(), 0), -2);
+        assert_eq!(am_join_block(path.as_ptr(), path.len(), 5), 0);
+
+        let len = am_spans_len(path.as_ptr(), path.len());
+        let mut buf = vec![0u8; len as usize];
+        assert_eq!(am_spans(buf.as_mut_ptr()), 0);
+        assert_eq!(String::from_utf8(buf).unwrap(), r#"[{"text":"TitleBody","marks":{}}]"#);
+    }
+
+    #[test]
+    fn test_obj_mark() {
+        assert_eq!(am_init(), 0);
+
+        let text = "Hello World";
+        assert_eq!(am_text_splice(0, 0, text.as_ptr(), text.len()), 0);
+
+        let (path, bold, yes) = ("ROOT.content", "bold", "true");
+        assert_eq!(
+            am_obj_mark(path.as_ptr(), path.len(), bold.as_ptr(), bold.len(), KIND_BOOL, yes.as_ptr(), yes.len(), 0, 5, 2),
+            0
+        );
+        assert_eq!(am_get_marks_count(2), 1);
+
+        let missing = "ROOT.missing";
+        assert_eq!(
+            am_obj_mark(missing.as_ptr(), missing.len(), bold.as_ptr(), bold.len(), KIND_BOOL, yes.as_ptr(), yes.len(), 0, 5, 2),
+            -2
+        );
+    }
+
+    #[test]
+    fn test_obj_marks_and_unmark() {
+        assert_eq!(am_init(), 0);
+        crate::state::with_doc_mut(|doc| {
+            let notes = doc.put_object(automerge::ROOT, "notes", ObjType::Text).unwrap();
+            doc.splice_text(&notes, 0, 0, "Hello World").unwrap();
+        })
+        .unwrap();
+
+        let (path, bold, yes) = ("ROOT.notes", "bold", "true");
+        assert_eq!(
+            am_obj_mark(path.as_ptr(), path.len(), bold.as_ptr(), bold.len(), KIND_BOOL, yes.as_ptr(), yes.len(), 0, 5, 3),
+            0
+        );
+        assert_eq!(am_obj_get_marks_count(path.as_ptr(), path.len(), 2), 1);
+        assert_eq!(am_get_marks_count(2), 0); // ROOT.content is untouched
+
+        let len = am_obj_marks_len(path.as_ptr(), path.len());
+        let mut buf = vec![0u8; len as usize];
+        assert_eq!(am_marks(buf.as_mut_ptr()), 0);
+        assert_eq!(
+            String::from_utf8(buf).unwrap(),
+            r#"[{"name":"bold","value":{"t":"bool","v":true},"start":0,"end":5,"expand":3}]"#
+        );
+
+        assert_eq!(am_obj_unmark(path.as_ptr(), path.len(), bold.as_ptr(), bold.len(), 0, 5, 0), 0);
+        assert_eq!(am_obj_get_marks_count(path.as_ptr(), path.len(), 2), 0);
+
+        let missing = "ROOT.missing";
+        assert_eq!(am_obj_marks_len(missing.as_ptr(), missing.len()), -2);
+        assert_eq!(am_obj_unmark(missing.as_ptr(), missing.len(), bold.as_ptr(), bold.len(), 0, 5, 0), -2);
+    }
+
+    #[test]
+    fn test_marks_typed_value_and_expand() {
+        assert_eq!(am_init(), 0);
+
+        let text = "Hello World";
+        assert_eq!(am_text_splice(0, 0, text.as_ptr(), text.len()), 0);
+
+        let (bold, yes) = ("bold", "true");
+        assert_eq!(am_mark(bold.as_ptr(), bold.len(), KIND_BOOL, yes.as_ptr(), yes.len(), 0, 5, 3), 0);
+        let (link, url) = ("link", "https://example.com");
+        assert_eq!(am_mark(link.as_ptr(), link.len(), KIND_STR, url.as_ptr(), url.len(), 6, 11, 0), 0);
+
+        let len = am_marks_len();
+        let mut buf = vec![0u8; len as usize];
+        assert_eq!(am_marks(buf.as_mut_ptr()), 0);
+
+        assert_eq!(
+            String::from_utf8(buf).unwrap(),
+            concat!(
+                r#"[{"name":"bold","value":{"t":"bool","v":true},"start":0,"end":5,"expand":3},"#,
+                r#"{"name":"link","value":{"t":"str","v":"https://example.com"},"start":6,"end":11,"expand":0}]"#
+            )
+        );
+    }
+
+    #[test]
+    fn test_text_patches_json() {
+        let mut doc = AutoCommit::new();
+        let text = doc.put_object(automerge::ROOT, "content", ObjType::Text).unwrap();
+        doc.splice_text(&text, 0, 0, "Hello").unwrap();
+        let before = doc.get_heads();
+
+        doc.splice_text(&text, 5, 0, " World").unwrap();
+        doc.splice_text(&text, 0, 1, "J").unwrap();
+        doc.mark(&text, Mark::new("bold".into(), true, 0, 5), ExpandMark::After).unwrap();
+        let after = doc.get_heads();
+
+        let json = text_patches_json(&mut doc, &text, &before, &after);
+        assert!(json.contains(r#"{"action":"delete","index":0,"length":1}"#), "{}", json);
+        assert!(json.contains(r#""text":"J""#), "{}", json);
+        assert!(json.contains(r#""text":" World""#), "{}", json);
+        assert!(
+            json.contains(r#"{"action":"mark","name":"bold","value":{"t":"bool","v":true},"start":0,"end":5}"#),
+            "{}",
+            json
+        );
+
+        // Nothing changed between equal heads
+        assert_eq!(text_patches_json(&mut doc, &text, &after, &after), "[]");
+    }
 }
@@ -5,6 +5,7 @@
 // - Export C-ABI functions callable from Go via wazero
 // - Implement Automerge sync protocol (delta-based peer synchronization)
 // - Manage per-peer sync state (HashMap<peer_id, sync::State>)
+// - Encode and restore a peer's sync state, for storing between sessions
 // - Return error codes as i32 (0 = success, <0 = error)
 //
 // Dependencies:
@@ -23,6 +24,7 @@
 
 use crate::state::with_doc_mut;
 use automerge::sync::{self, SyncDoc};
+use std::cell::RefCell;
 use std::sync::{Mutex, OnceLock};
 use std::collections::HashMap;
 
@@ -40,16 +42,13 @@ fn get_next_peer_id() -> &'static Mutex<u32> {
     NEXT_PEER_ID.get_or_init(|| Mutex::new(1))
 }
 
-/// Create a new sync state for a peer connection.
-///
-/// Call this once before starting a sync session with a peer.
-/// Returns a peer_id that must be used in all subsequent sync calls.
-///
-/// # Returns
-/// - peer_id (> 0) on success
-/// - `0` if failed to initialize
-#[no_mangle]
-pub extern "C" fn am_sync_state_init() -> u32 {
+thread_local! {
+    /// Bytes encoded by the last `am_sync_state_encode_len` call
+    static LAST_SYNC_STATE: RefCell<Vec<u8>> = RefCell::new(Vec::new());
+}
+
+/// Track `state` under a new peer_id (0 if the state table is unusable).
+fn add_state(state: sync::State) -> u32 {
     let peer_id = match get_next_peer_id().lock() {
         Ok(mut next_id) => {
             let id = *next_id;
@@ -61,13 +60,85 @@ pub extern "C" fn am_sync_state_init() -> u32 {
 
     match get_sync_states().lock() {
         Ok(mut states) => {
-            states.insert(peer_id, sync::State::new());
+            states.insert(peer_id, state);
             peer_id
         }
         Err(_) => 0,
     }
 }
 
+/// Create a new sync state for a peer connection.
+///
+/// Call this once before starting a sync session with a peer.
+/// Returns a peer_id that must be used in all subsequent sync calls.
+///
+/// # Returns
+/// - peer_id (> 0) on success
+/// - `0` if failed to initialize
+#[no_mangle]
+pub extern "C" fn am_sync_state_init() -> u32 {
+    add_state(sync::State::new())
+}
+
+/// Encode a peer's sync state for storage.
+///
+/// Only what outlives a connection is kept (the heads both sides share), so
+/// a peer that reconnects isn't sent every change again.
+///
+/// # Parameters
+/// - `peer_id`: The peer ID from am_sync_state_init or am_sync_state_load
+///
+/// # Returns
+/// - `>= 0` length of the encoded state (fetch with `am_sync_state_encode`)
+/// - `-2` if sync state not initialized
+#[no_mangle]
+pub extern "C" fn am_sync_state_encode_len(peer_id: u32) -> i32 {
+    let encoded = match get_sync_states().lock() {
+        Ok(states) => match states.get(&peer_id) {
+            Some(state) => state.encode(),
+            None => return -2, // Invalid peer_id
+        },
+        Err(_) => return -2,
+    };
+
+    let len = encoded.len() as i32;
+    LAST_SYNC_STATE.with(|s| *s.borrow_mut() = encoded);
+    len
+}
+
+/// Copy the state encoded by the last `am_sync_state_encode_len` call into
+/// `ptr_out`.
+#[no_mangle]
+pub extern "C" fn am_sync_state_encode(ptr_out: *mut u8) -> i32 {
+    if ptr_out.is_null() {
+        return -1;
+    }
+    LAST_SYNC_STATE.with(|s| {
+        let bytes = s.borrow();
+        unsafe {
+            std::ptr::copy_nonoverlapping(bytes.as_ptr(), ptr_out, bytes.len());
+        }
+        0
+    })
+}
+
+/// Start a peer connection from a state encoded by `am_sync_state_encode`.
+///
+/// # Returns
+/// - peer_id (> 0) on success
+/// - `0` if the state does not decode
+#[no_mangle]
+pub extern "C" fn am_sync_state_load(state_ptr: *const u8, state_len: usize) -> u32 {
+    if state_ptr.is_null() {
+        return 0;
+    }
+    let bytes = unsafe { std::slice::from_raw_parts(state_ptr, state_len) };
+    match sync::State::decode(bytes) {
+        Ok(state) => add_state(state),
+        Err(_) => 0,
+    }
+}
+
 /// Free a peer's sync state.
 ///
 /// Call this when done with a peer connection.
@@ -294,4 +365,25 @@ mod tests {
         // Clean up
         am_sync_state_free(peer_id);
     }
+
+    #[test]
+    fn test_sync_state_encode_load() {
+        let peer_id = am_sync_state_init();
+        assert!(peer_id > 0);
+
+        let len = am_sync_state_encode_len(peer_id);
+        assert!(len > 0, "Expected an encoded state, got {}", len);
+        let mut buf = vec![0u8; len as usize];
+        assert_eq!(am_sync_state_encode(buf.as_mut_ptr()), 0);
+
+        let restored = am_sync_state_load(buf.as_ptr(), buf.len());
+        assert!(restored > 0 && restored != peer_id);
+        assert_eq!(am_sync_state_encode_len(999_999), -2);
+
+        let garbage = [0xffu8, 0x00, 0x01];
+        assert_eq!(am_sync_state_load(garbage.as_ptr(), garbage.len()), 0);
+
+        am_sync_state_free(peer_id);
+        am_sync_state_free(restored);
+    }
 }
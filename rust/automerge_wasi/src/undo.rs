@@ -0,0 +1,854 @@
+// ==============================================================================
+// Layer 2: Rust WASI Exports - Revert (Undo/Redo support)
+// ==============================================================================
+// ARCHITECTURE: This is the WASI export layer (Layer 2/7).
+//
+// RESPONSIBILITIES:
+// - WASI-compatible function exports (C ABI)
+// - Invert the edits made between two sets of heads as a new forward change
+// - Error code translation (Rust Result → i32)
+//
+// DEPENDENCIES:
+// - Layer 1: automerge crate (CRDT core - diff, cursors, *_at reads)
+// - crate::state (global document state)
+// - crate::path (argument and cursor helpers)
+// - crate::expand (mark expand settings)
+//
+// DEPENDENTS:
+// - Layer 3: pkg/wazero/crdt_undo.go (FFI wrappers)
+//
+// RELATED FILES (1:1 mapping):
+// - Layer 3: pkg/wazero/crdt_undo.go (Go FFI wrappers)
+// - Layer 4: pkg/automerge/crdt_undo.go (UndoManager)
+//
+// NOTES:
+// - All exports use #[no_mangle] and extern "C"
+// - Sequence elements are tracked by cursor (element ID), not index, so
+//   concurrent edits by other actors never shift what gets reverted
+// - A value is only restored if it still holds what the reverted change
+//   wrote; anything overwritten since (by anyone) is left alone
+// - Restoring a value or reinserting an element creates a new op or element
+//   ID. Each revert reports these replacements ("old\tnew" lines, read with
+//   am_revert_remap), and the caller passes the ones made by earlier reverts
+//   back in, so a step still recognizes what it wrote after other steps were
+//   undone or redone on top of it
+// - Marks are restored with the expand setting they had (crate::expand)
+// - Return 0 on success, negative error codes on failure:
+//     -1 invalid argument (null pointer)
+//     -2 unknown change hash
+//     -3 Automerge error
+//     -4 document not initialized
+// ==============================================================================
+
+use crate::expand::{self, span_expands};
+use crate::path::{read_heads, read_str, visible_at};
+use crate::state::with_doc_mut;
+use automerge::{
+    marks::{ExpandMark, Mark},
+    transaction::Transactable,
+    AutoCommit, AutomergeError, ChangeHash, Cursor, ObjId, ObjType, PatchAction, Prop, ReadDoc,
+    ScalarValue, Value,
+};
+use std::borrow::Cow;
+use std::cell::RefCell;
+use std::collections::HashMap;
+
+thread_local! {
+    static LAST_REMAP: RefCell<String> = RefCell::new(String::new());
+}
+
+/// Revert everything that changed between `before` and `after`.
+///
+/// The inverse edits are applied on top of the current document (which may
+/// contain later or concurrent changes) and committed as one new change.
+/// Reverting the change produced by a revert reapplies the original edits.
+///
+/// # Parameters
+/// - `before_ptr`/`before_count`: heads before the edits (32 bytes each)
+/// - `after_ptr`/`after_count`: heads after the edits (32 bytes each)
+/// - `remap_ptr`/`remap_len`: IDs replaced by earlier reverts, as "old\tnew"
+///   lines (may be empty)
+///
+/// The IDs this revert replaced are cached for `am_revert_remap_len`.
+///
+/// # Returns
+/// - `0` on success, negative error code otherwise (see module notes)
+#[no_mangle]
+pub extern "C" fn am_revert(
+    before_ptr: *const u8,
+    before_count: usize,
+    after_ptr: *const u8,
+    after_count: usize,
+    remap_ptr: *const u8,
+    remap_len: usize,
+) -> i32 {
+    let (before, after, remap) = match (
+        read_heads(before_ptr, before_count),
+        read_heads(after_ptr, after_count),
+        read_str(remap_ptr, remap_len),
+    ) {
+        (Ok(b), Ok(a), Ok(r)) => (b, a, Remap::parse(r)),
+        _ => return -1,
+    };
+
+    match with_doc_mut(|doc| {
+        for hash in before.iter().chain(after.iter()) {
+            if doc.get_change_by_hash(hash).is_none() {
+                return Err(-2);
+            }
+        }
+        let mut remap = remap;
+        revert(doc, &before, &after, &mut remap).map_err(|_| -3)?;
+        Ok(remap.render())
+    }) {
+        Some(Ok(made)) => {
+            LAST_REMAP.with(|s| *s.borrow_mut() = made);
+            0
+        }
+        Some(Err(code)) => code,
+        None => -4,
+    }
+}
+
+/// Length of the IDs replaced by the last `am_revert` ("old\tnew" lines).
+#[no_mangle]
+pub extern "C" fn am_revert_remap_len() -> u32 {
+    LAST_REMAP.with(|s| s.borrow().len() as u32)
+}
+
+/// Copy the IDs replaced by the last `am_revert` into `ptr_out`.
+#[no_mangle]
+pub extern "C" fn am_revert_remap(ptr_out: *mut u8) -> i32 {
+    if ptr_out.is_null() {
+        return -1;
+    }
+    LAST_REMAP.with(|s| {
+        let text = s.borrow();
+        let bytes = text.as_bytes();
+        unsafe {
+            std::ptr::copy_nonoverlapping(bytes.as_ptr(), ptr_out, bytes.len());
+        }
+        0
+    })
+}
+
+/// Op and element IDs replaced by reverts: a restored value is a new op and
+/// a reinserted element a new element, standing in for the one recorded in
+/// an earlier step.
+#[derive(Default)]
+struct Remap {
+    /// Replacements made by earlier reverts (old → new)
+    earlier: HashMap<String, String>,
+    /// Replacements made by this revert, in order
+    made: Vec<(String, String)>,
+}
+
+impl Remap {
+    fn parse(text: &str) -> Remap {
+        let earlier = text
+            .lines()
+            .filter_map(|line| line.split_once('\t'))
+            .map(|(old, new)| (old.to_string(), new.to_string()))
+            .collect();
+        Remap { earlier, made: Vec::new() }
+    }
+
+    /// The ID that stands in for `id` now
+    fn resolve(&self, mut id: String) -> String {
+        for _ in 0..=self.earlier.len() {
+            match self.earlier.get(&id) {
+                Some(next) => id = next.clone(),
+                None => break,
+            }
+        }
+        id
+    }
+
+    /// The element that stands in for `cursor` now
+    fn cursor(&self, cursor: &Cursor) -> Cursor {
+        Cursor::try_from(self.resolve(cursor.to_string()).as_str()).unwrap_or_else(|_| cursor.clone())
+    }
+
+    fn record(&mut self, old: String, new: String) {
+        if old != new {
+            self.made.push((old, new));
+        }
+    }
+
+    fn render(&self) -> String {
+        let mut out = String::new();
+        for (old, new) in &self.made {
+            out.push_str(old);
+            out.push('\t');
+            out.push_str(new);
+            out.push('\n');
+        }
+        out
+    }
+}
+
+/// Edits to one sequence object, identified by element cursor.
+#[derive(Default)]
+struct SeqEdits {
+    /// Elements inserted by the change
+    inserted: Vec<Cursor>,
+    /// Elements deleted by the change, with their index at `before`
+    deleted: Vec<(Cursor, usize)>,
+    /// Elements overwritten or incremented, with their index at `before` and `after`
+    updated: Vec<(Cursor, usize, usize)>,
+    /// Elements whose marks changed
+    marked: Vec<Cursor>,
+}
+
+/// Edits grouped per object, in the order the diff reported them.
+enum ObjEdits {
+    Map(Vec<String>),
+    Seq(SeqEdits),
+}
+
+fn revert(
+    doc: &mut AutoCommit,
+    before: &[ChangeHash],
+    after: &[ChangeHash],
+    remap: &mut Remap,
+) -> Result<(), AutomergeError> {
+    let patches = doc.diff(before, after);
+
+    // Objects created by the change vanish with it - nothing inside needs reverting
+    let mut created: Vec<ObjId> = Vec::new();
+    for patch in &patches {
+        match &patch.action {
+            PatchAction::PutMap { value: (Value::Object(_), id), .. }
+            | PatchAction::PutSeq { value: (Value::Object(_), id), .. } => created.push(id.clone()),
+            PatchAction::Insert { values, .. } => {
+                for (value, id, _) in values.iter() {
+                    if let Value::Object(_) = value {
+                        created.push(id.clone());
+                    }
+                }
+            }
+            _ => {}
+        }
+    }
+
+    // Group the patches per object; sequence indices in a diff refer to the
+    // partially patched sequence, so track insertions/deletions to map them
+    // back to `before`
+    let mut edits: Vec<(ObjId, ObjEdits, usize, usize)> = Vec::new();
+    for patch in &patches {
+        if created.contains(&patch.obj) {
+            continue;
+        }
+        let pos = match edits.iter().position(|(obj, ..)| *obj == patch.obj) {
+            Some(pos) => pos,
+            None => {
+                let group = match doc.object_type(&patch.obj)? {
+                    ObjType::List | ObjType::Text => ObjEdits::Seq(SeqEdits::default()),
+                    _ => ObjEdits::Map(Vec::new()),
+                };
+                edits.push((patch.obj.clone(), group, 0, 0));
+                edits.len() - 1
+            }
+        };
+        let (obj, group, ins, del) = &mut edits[pos];
+
+        match (group, &patch.action) {
+            (ObjEdits::Map(keys), PatchAction::PutMap { key, .. })
+            | (ObjEdits::Map(keys), PatchAction::DeleteMap { key })
+            | (ObjEdits::Map(keys), PatchAction::Increment { prop: Prop::Map(key), .. })
+            | (ObjEdits::Map(keys), PatchAction::Conflict { prop: Prop::Map(key) }) => {
+                if !keys.contains(key) {
+                    keys.push(key.clone());
+                }
+            }
+            (ObjEdits::Seq(seq), PatchAction::Insert { index, values, .. }) => {
+                for i in *index..*index + values.len() {
+                    seq.inserted.push(doc.get_cursor(&*obj, i, Some(after))?);
+                }
+                *ins += values.len();
+            }
+            (ObjEdits::Seq(seq), PatchAction::SpliceText { index, value, .. }) => {
+                let len = value.make_string().chars().count();
+                for i in *index..*index + len {
+                    seq.inserted.push(doc.get_cursor(&*obj, i, Some(after))?);
+                }
+                *ins += len;
+            }
+            (ObjEdits::Seq(seq), PatchAction::DeleteSeq { index, length }) => {
+                let start = (*index + *del).saturating_sub(*ins);
+                for i in start..start + *length {
+                    seq.deleted.push((doc.get_cursor(&*obj, i, Some(before))?, i));
+                }
+                *del += *length;
+            }
+            (ObjEdits::Seq(seq), PatchAction::PutSeq { index, .. })
+            | (ObjEdits::Seq(seq), PatchAction::Increment { prop: Prop::Seq(index), .. }) => {
+                let old_index = (*index + *del).saturating_sub(*ins);
+                seq.updated.push((doc.get_cursor(&*obj, *index, Some(after))?, old_index, *index));
+            }
+            (ObjEdits::Seq(seq), PatchAction::Mark { marks }) => {
+                for mark in marks {
+                    for i in mark.start..mark.end {
+                        seq.marked.push(doc.get_cursor(&*obj, i, Some(after))?);
+                    }
+                }
+            }
+            _ => {}
+        }
+    }
+
+    for (obj, group, _, _) in edits {
+        match group {
+            ObjEdits::Map(keys) => {
+                for key in keys {
+                    let old = doc.get_at(&obj, key.as_str(), before)?.map(owned);
+                    let new = doc.get_at(&obj, key.as_str(), after)?.map(owned);
+                    let cur = doc.get(&obj, key.as_str())?.map(owned);
+                    restore(doc, &obj, Prop::Map(key), old, new, cur, before, remap)?;
+                }
+            }
+            ObjEdits::Seq(seq) => {
+                let is_text = doc.object_type(&obj)? == ObjType::Text;
+                revert_seq(doc, &obj, is_text, seq, before, after, remap)?;
+            }
+        }
+    }
+
+    doc.commit();
+    Ok(())
+}
+
+/// Detach a value from the document borrow.
+fn owned((value, id): (Value<'_>, ObjId)) -> (Value<'static>, ObjId) {
+    match value {
+        Value::Object(t) => (Value::Object(t), id),
+        Value::Scalar(s) => (Value::Scalar(Cow::Owned(s.into_owned())), id),
+    }
+}
+
+/// Whether two slots hold the same operation (or are both empty).
+fn same_op(a: &Option<(Value<'static>, ObjId)>, b: &Option<(Value<'static>, ObjId)>) -> bool {
+    match (a, b) {
+        (None, None) => true,
+        (Some((_, x)), Some((_, y))) => x == y,
+        _ => false,
+    }
+}
+
+/// Whether the slot `cur` still holds `new`, or what a revert replaced it with.
+fn holds(cur: &Option<(Value<'static>, ObjId)>, new: &Option<(Value<'static>, ObjId)>, remap: &Remap) -> bool {
+    match (cur, new) {
+        (None, None) => true,
+        (Some((_, c)), Some((_, n))) => c == n || c.to_string() == remap.resolve(n.to_string()),
+        _ => false,
+    }
+}
+
+/// Put the `old` value back at `prop`, unless the slot no longer holds `new`.
+#[allow(clippy::too_many_arguments)]
+fn restore(
+    doc: &mut AutoCommit,
+    obj: &ObjId,
+    prop: Prop,
+    old: Option<(Value<'static>, ObjId)>,
+    new: Option<(Value<'static>, ObjId)>,
+    cur: Option<(Value<'static>, ObjId)>,
+    before: &[ChangeHash],
+    remap: &mut Remap,
+) -> Result<(), AutomergeError> {
+    if same_op(&old, &new) {
+        // Same put operation - only counter increments can differ
+        if let (Some((Value::Scalar(o), _)), Some((Value::Scalar(n), _))) = (&old, &new) {
+            if let (ScalarValue::Counter(o), ScalarValue::Counter(n)) = (o.as_ref(), n.as_ref()) {
+                let delta = i64::from(o) - i64::from(n);
+                if delta != 0 && holds(&cur, &new, remap) {
+                    doc.increment(obj, prop, delta)?;
+                }
+            }
+        }
+        return Ok(());
+    }
+
+    if !holds(&cur, &new, remap) {
+        return Ok(()); // Changed again since - leave the newer value alone
+    }
+
+    match old {
+        None => doc.delete(obj, prop)?,
+        Some((Value::Scalar(s), id)) => {
+            doc.put(obj, prop.clone(), s.into_owned())?;
+            if let Some((_, put)) = doc.get(obj, prop)? {
+                remap.record(id.to_string(), put.to_string());
+            }
+        }
+        Some((Value::Object(t), id)) => {
+            let copy = doc.put_object(obj, prop, t)?;
+            copy_at(doc, &id, &copy, t, before)?;
+            remap.record(id.to_string(), copy.to_string());
+        }
+    }
+    Ok(())
+}
+
+fn revert_seq(
+    doc: &mut AutoCommit,
+    obj: &ObjId,
+    is_text: bool,
+    seq: SeqEdits,
+    before: &[ChangeHash],
+    after: &[ChangeHash],
+    remap: &mut Remap,
+) -> Result<(), AutomergeError> {
+    // 1. Remove inserted elements that are still there (or what stands in
+    //    for them), back to front in runs
+    let mut doomed: Vec<usize> = seq
+        .inserted
+        .iter()
+        .filter_map(|c| visible_at(doc, obj, &remap.cursor(c), None))
+        .collect();
+    doomed.sort_unstable();
+    doomed.dedup();
+    let mut runs: Vec<(usize, usize)> = Vec::new();
+    for idx in doomed.into_iter().rev() {
+        match runs.last_mut() {
+            Some((start, len)) if *start == idx + 1 => {
+                *start = idx;
+                *len += 1;
+            }
+            _ => runs.push((idx, 1)),
+        }
+    }
+    for (start, len) in runs {
+        if is_text {
+            doc.splice_text(obj, start, len as isize, "")?;
+        } else {
+            for _ in 0..len {
+                doc.delete(obj, start)?;
+            }
+        }
+    }
+
+    // 2. Restore overwritten/incremented elements
+    for (cursor, old_index, new_index) in &seq.updated {
+        let cur_index = match visible_at(doc, obj, &remap.cursor(cursor), None) {
+            Some(i) => i,
+            None => continue,
+        };
+        let old = doc.get_at(obj, *old_index, before)?.map(owned);
+        let new = doc.get_at(obj, *new_index, after)?.map(owned);
+        let cur = doc.get(obj, cur_index)?.map(owned);
+        restore(doc, obj, Prop::Seq(cur_index), old, new, cur, before, remap)?;
+    }
+
+    // 3. Reinsert deleted elements where they used to be. Consecutive
+    //    elements follow the previous reinsertion so their order is kept.
+    let mut reinserted: Vec<(Cursor, usize)> = Vec::new();
+    let mut prev: Option<(usize, usize)> = None; // (old index, current index)
+    let mut pending = Pending::default(); // text run waiting to be spliced
+    for (cursor, old_index) in &seq.deleted {
+        let current = remap.cursor(cursor);
+        if visible_at(doc, obj, &current, None).is_some() {
+            continue;
+        }
+        let at = match prev {
+            Some((p_old, p_cur)) if p_old + 1 == *old_index => p_cur + 1,
+            _ => {
+                pending.flush(doc, obj, &mut reinserted, remap)?;
+                doc.get_cursor_position(obj, &current, None).unwrap_or(0)
+            }
+        };
+
+        match doc.get_at(obj, *old_index, before)?.map(owned) {
+            Some((Value::Scalar(s), _)) if is_text => {
+                if pending.text.is_empty() {
+                    pending.at = at;
+                }
+                if let ScalarValue::Str(ch) = s.as_ref() {
+                    pending.text.push_str(ch);
+                }
+                pending.old.push((cursor.clone(), *old_index));
+            }
+            Some((Value::Scalar(s), id)) => {
+                doc.insert(obj, at, s.into_owned())?;
+                remap.record(cursor.to_string(), doc.get_cursor(obj, at, None)?.to_string());
+                if let Some((_, put)) = doc.get(obj, at)? {
+                    remap.record(id.to_string(), put.to_string());
+                }
+            }
+            Some((Value::Object(t), id)) => {
+                pending.flush(doc, obj, &mut reinserted, remap)?;
+                let copy = doc.insert_object(obj, at, t)?;
+                copy_at(doc, &id, &copy, t, before)?;
+                remap.record(cursor.to_string(), doc.get_cursor(obj, at, None)?.to_string());
+                remap.record(id.to_string(), copy.to_string());
+            }
+            None => continue,
+        }
+        prev = Some((*old_index, at));
+    }
+    pending.flush(doc, obj, &mut reinserted, remap)?;
+
+    // 4. Restore marks on surviving and reinserted characters
+    if is_text && (!seq.marked.is_empty() || !reinserted.is_empty()) {
+        revert_marks(doc, obj, &seq.marked, &reinserted, before, after, remap)?;
+    }
+    Ok(())
+}
+
+/// A run of deleted characters waiting to be reinserted with one splice.
+#[derive(Default)]
+struct Pending {
+    text: String,
+    at: usize,
+    /// Cursor and index at `before` of each character
+    old: Vec<(Cursor, usize)>,
+}
+
+impl Pending {
+    /// Splice the run, remember the new characters' cursors and record them
+    /// as standing in for the deleted ones.
+    fn flush(
+        &mut self,
+        doc: &mut AutoCommit,
+        obj: &ObjId,
+        reinserted: &mut Vec<(Cursor, usize)>,
+        remap: &mut Remap,
+    ) -> Result<(), AutomergeError> {
+        if self.text.is_empty() {
+            return Ok(());
+        }
+        doc.splice_text(obj, self.at, 0, &self.text)?;
+        for (offset, (cursor, old_index)) in self.old.iter().enumerate() {
+            let new = doc.get_cursor(obj, self.at + offset, None)?;
+            remap.record(cursor.to_string(), new.to_string());
+            reinserted.push((new, *old_index));
+        }
+        self.text.clear();
+        self.old.clear();
+        Ok(())
+    }
+}
+
+/// Mark spans as (start, end, name, value), detached from the document.
+type MarkSpans = Vec<(usize, usize, String, ScalarValue)>;
+
+fn mark_spans(doc: &AutoCommit, obj: &ObjId, heads: Option<&[ChangeHash]>) -> Result<MarkSpans, AutomergeError> {
+    let marks = match heads {
+        Some(h) => doc.marks_at(obj, h)?,
+        None => doc.marks(obj)?,
+    };
+    Ok(marks
+        .iter()
+        .map(|m| (m.start, m.end, m.name().to_string(), m.value().clone()))
+        .collect())
+}
+
+/// Expand code of each span of `obj` at `heads` (None = now).
+fn spans_expands(doc: &AutoCommit, obj: &ObjId, spans: &MarkSpans, heads: Option<&[ChangeHash]>) -> Vec<u8> {
+    span_expands(
+        doc,
+        obj,
+        spans.iter().map(|(start, end, name, value)| (*start, *end, name.as_str(), value)),
+        heads,
+    )
+}
+
+/// Index of the span setting mark `name` at index `i` (None if unset).
+fn mark_span(spans: &MarkSpans, name: &str, i: usize) -> Option<usize> {
+    spans
+        .iter()
+        .rposition(|(start, end, n, _)| n == name && *start <= i && i < *end)
+        .filter(|&k| !matches!(spans[k].3, ScalarValue::Null))
+}
+
+/// Value of mark `name` at index `i` (None if unset).
+fn mark_value<'a>(spans: &'a MarkSpans, name: &str, i: usize) -> Option<&'a ScalarValue> {
+    mark_span(spans, name, i).map(|k| &spans[k].3)
+}
+
+#[allow(clippy::too_many_arguments)]
+fn revert_marks(
+    doc: &mut AutoCommit,
+    obj: &ObjId,
+    marked: &[Cursor],
+    reinserted: &[(Cursor, usize)],
+    before: &[ChangeHash],
+    after: &[ChangeHash],
+    remap: &Remap,
+) -> Result<(), AutomergeError> {
+    let old_spans = mark_spans(doc, obj, Some(before))?;
+    let old_expands = spans_expands(doc, obj, &old_spans, Some(before));
+    let new_spans = mark_spans(doc, obj, Some(after))?;
+    let cur_spans = mark_spans(doc, obj, None)?;
+
+    let mut names: Vec<&str> = Vec::new();
+    for (_, _, name, _) in old_spans.iter().chain(new_spans.iter()).chain(cur_spans.iter()) {
+        if !names.contains(&name.as_str()) {
+            names.push(name);
+        }
+    }
+
+    // The old mark (value and expand) wanted back, None to unmark
+    let old_mark = |name: &str, i: usize| {
+        mark_span(&old_spans, name, i).map(|k| (old_spans[k].3.clone(), old_expands[k]))
+    };
+
+    // (current index, name, wanted mark)
+    let mut wanted: Vec<(usize, String, Option<(ScalarValue, u8)>)> = Vec::new();
+    for cursor in marked {
+        let (old_i, new_i, cur_i) = match (
+            visible_at(doc, obj, cursor, Some(before)),
+            visible_at(doc, obj, cursor, Some(after)),
+            visible_at(doc, obj, &remap.cursor(cursor), None),
+        ) {
+            (Some(o), Some(n), Some(c)) => (o, n, c),
+            _ => continue,
+        };
+        for name in &names {
+            let old = mark_value(&old_spans, name, old_i);
+            let new = mark_value(&new_spans, name, new_i);
+            if old != new && mark_value(&cur_spans, name, cur_i) == new {
+                wanted.push((cur_i, name.to_string(), old_mark(name, old_i)));
+            }
+        }
+    }
+    for (cursor, old_i) in reinserted {
+        let cur_i = match visible_at(doc, obj, cursor, None) {
+            Some(c) => c,
+            None => continue,
+        };
+        for name in &names {
+            let old = mark_value(&old_spans, name, *old_i);
+            if mark_value(&cur_spans, name, cur_i) != old {
+                wanted.push((cur_i, name.to_string(), old_mark(name, *old_i)));
+            }
+        }
+    }
+
+    // Apply as contiguous ranges per name, value and expand
+    wanted.sort_by(|a, b| a.1.cmp(&b.1).then(a.0.cmp(&b.0)));
+    let mut i = 0;
+    while i < wanted.len() {
+        let (start, name, value) = wanted[i].clone();
+        let mut end = start + 1;
+        let mut j = i + 1;
+        while j < wanted.len() && wanted[j].1 == name && wanted[j].0 == end && wanted[j].2 == value {
+            end += 1;
+            j += 1;
+        }
+        match value {
+            Some((value, expand)) => expand::mark(
+                doc,
+                obj,
+                Mark {
+                    start,
+                    end,
+                    name: name.into(),
+                    value,
+                },
+                expand,
+            )?,
+            None => expand::unmark(doc, obj, &name, start, end, ExpandMark::None)?,
+        }
+        i = j;
+    }
+    Ok(())
+}
+
+/// Recreate the object `src` as it was at `heads` into the empty object `dst`.
+fn copy_at(
+    doc: &mut AutoCommit,
+    src: &ObjId,
+    dst: &ObjId,
+    obj_type: ObjType,
+    heads: &[ChangeHash],
+) -> Result<(), AutomergeError> {
+    match obj_type {
+        ObjType::Text => {
+            let text = doc.text_at(src, heads)?;
+            doc.splice_text(dst, 0, 0, &text)?;
+            let spans = mark_spans(doc, src, Some(heads))?;
+            let expands = spans_expands(doc, src, &spans, Some(heads));
+            for ((start, end, name, value), expand) in spans.into_iter().zip(expands) {
+                expand::mark(
+                    doc,
+                    dst,
+                    Mark {
+                        start,
+                        end,
+                        name: name.into(),
+                        value,
+                    },
+                    expand,
+                )?;
+            }
+        }
+        ObjType::List => {
+            let mut at = 0;
+            for i in 0..doc.length_at(src, heads) {
+                match doc.get_at(src, i, heads)?.map(owned) {
+                    Some((Value::Scalar(s), _)) => doc.insert(dst, at, s.into_owned())?,
+                    Some((Value::Object(t), id)) => {
+                        let child = doc.insert_object(dst, at, t)?;
+                        copy_at(doc, &id, &child, t, heads)?;
+                    }
+                    None => continue,
+                }
+                at += 1;
+            }
+        }
+        _ => {
+            let keys: Vec<String> = doc.keys_at(src, heads).collect();
+            for key in keys {
+                match doc.get_at(src, key.as_str(), heads)?.map(owned) {
+                    Some((Value::Scalar(s), _)) => doc.put(dst, key.as_str(), s.into_owned())?,
+                    Some((Value::Object(t), id)) => {
+                        let child = doc.put_object(dst, key.as_str(), t)?;
+                        copy_at(doc, &id, &child, t, heads)?;
+                    }
+                    None => {}
+                }
+            }
+        }
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use automerge::ROOT;
+
+    #[test]
+    fn test_revert_map_and_text() {
+        let mut doc = AutoCommit::new();
+        doc.put(ROOT, "title", "Draft").unwrap();
+        let text = doc.put_object(ROOT, "content", ObjType::Text).unwrap();
+        doc.splice_text(&text, 0, 0, "Hello world").unwrap();
+        let before = doc.get_heads();
+
+        doc.put(ROOT, "title", "Final").unwrap();
+        doc.splice_text(&text, 5, 6, " there").unwrap();
+        let after = doc.get_heads();
+
+        revert(&mut doc, &before, &after, &mut Remap::default()).unwrap();
+        assert_eq!(doc.text(&text).unwrap(), "Hello world");
+        match doc.get(ROOT, "title").unwrap() {
+            Some((Value::Scalar(s), _)) => assert_eq!(s.as_ref(), &ScalarValue::Str("Draft".into())),
+            other => panic!("unexpected title {:?}", other),
+        }
+
+        // Reverting the revert reapplies the edit
+        let undone = doc.get_heads();
+        revert(&mut doc, &after, &undone, &mut Remap::default()).unwrap();
+        assert_eq!(doc.text(&text).unwrap(), "Hello there");
+    }
+
+    #[test]
+    fn test_revert_keeps_concurrent_edits() {
+        let mut doc = AutoCommit::new();
+        let list = doc.put_object(ROOT, "items", ObjType::List).unwrap();
+        doc.insert(&list, 0, "a").unwrap();
+        doc.insert(&list, 1, "b").unwrap();
+        let mut peer = doc.fork();
+
+        let before = doc.get_heads();
+        doc.insert(&list, 2, "c").unwrap();
+        let after = doc.get_heads();
+
+        peer.insert(&list, 0, "z").unwrap();
+        doc.merge(&mut peer).unwrap();
+
+        revert(&mut doc, &before, &after, &mut Remap::default()).unwrap();
+        let items: Vec<String> = (0..doc.length(&list))
+            .map(|i| match doc.get(&list, i).unwrap() {
+                Some((Value::Scalar(s), _)) => match s.as_ref() {
+                    ScalarValue::Str(s) => s.to_string(),
+                    _ => String::new(),
+                },
+                _ => String::new(),
+            })
+            .collect();
+        assert_eq!(items, vec!["z", "a", "b"]);
+    }
+
+    /// Revert `step` and return its inverse, carrying the replaced IDs over
+    /// like UndoManager does.
+    fn apply(
+        doc: &mut AutoCommit,
+        step: &(Vec<ChangeHash>, Vec<ChangeHash>),
+        remap: &mut Remap,
+    ) -> (Vec<ChangeHash>, Vec<ChangeHash>) {
+        let before = doc.get_heads();
+        revert(doc, &step.0, &step.1, remap).unwrap();
+        let made: Vec<(String, String)> = remap.made.drain(..).collect();
+        remap.earlier.extend(made);
+        (before, doc.get_heads())
+    }
+
+    fn title(doc: &AutoCommit) -> Option<String> {
+        match doc.get(ROOT, "title").unwrap() {
+            Some((Value::Scalar(s), _)) => match s.as_ref() {
+                ScalarValue::Str(s) => Some(s.to_string()),
+                _ => None,
+            },
+            _ => None,
+        }
+    }
+
+    #[test]
+    fn test_revert_consecutive_edits() {
+        let mut doc = AutoCommit::new();
+        let text = doc.put_object(ROOT, "content", ObjType::Text).unwrap();
+        let h0 = doc.get_heads();
+        doc.put(ROOT, "title", "one").unwrap();
+        doc.splice_text(&text, 0, 0, "abc").unwrap();
+        let h1 = doc.get_heads();
+        doc.put(ROOT, "title", "two").unwrap();
+        doc.splice_text(&text, 1, 1, "").unwrap();
+        let h2 = doc.get_heads();
+
+        let mut remap = Remap::default();
+        let mut steps = vec![(h0, h1), (h1, h2)];
+        for _ in 0..2 {
+            // Undo both steps, newest first
+            let redo2 = apply(&mut doc, &steps[1], &mut remap);
+            assert_eq!(title(&doc).as_deref(), Some("one"));
+            assert_eq!(doc.text(&text).unwrap(), "abc");
+            let redo1 = apply(&mut doc, &steps[0], &mut remap);
+            assert_eq!(title(&doc), None);
+            assert_eq!(doc.text(&text).unwrap(), "");
+
+            // Redo them, oldest first
+            let undo1 = apply(&mut doc, &redo1, &mut remap);
+            assert_eq!(title(&doc).as_deref(), Some("one"));
+            assert_eq!(doc.text(&text).unwrap(), "abc");
+            let undo2 = apply(&mut doc, &redo2, &mut remap);
+            assert_eq!(title(&doc).as_deref(), Some("two"));
+            assert_eq!(doc.text(&text).unwrap(), "ac");
+            steps = vec![undo1, undo2];
+        }
+    }
+
+    #[test]
+    fn test_revert_keeps_mark_expand() {
+        let mut doc = AutoCommit::new();
+        let text = doc.put_object(ROOT, "content", ObjType::Text).unwrap();
+        doc.splice_text(&text, 0, 0, "Hello").unwrap();
+        let bold = Mark {
+            start: 0,
+            end: 5,
+            name: "bold".into(),
+            value: ScalarValue::Boolean(true),
+        };
+        expand::mark(&mut doc, &text, bold, 3).unwrap();
+        let before = doc.get_heads();
+        doc.splice_text(&text, 0, 5, "").unwrap();
+        let after = doc.get_heads();
+
+        revert(&mut doc, &before, &after, &mut Remap::default()).unwrap();
+        let marks = doc.marks(&text).unwrap();
+        assert_eq!((marks.len(), marks[0].start, marks[0].end), (1, 0, 5));
+        assert_eq!(expand::mark_expands(&doc, &text, &marks, None), vec![3]);
+    }
+}
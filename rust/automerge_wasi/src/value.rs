@@ -0,0 +1,171 @@
+// ==============================================================================
+// Layer 2: Rust WASI Exports - Value Encoding (shared helpers)
+// ==============================================================================
+// ARCHITECTURE: Internal helper module for the WASI export layer (Layer 2/7).
+//
+// RESPONSIBILITIES:
+// - Decode typed scalars passed from Go as (kind, bytes)
+// - Encode document values as typed JSON for Go to read back
+//
+// DEPENDENTS:
+// - crate::object (path-based reads and writes)
+//
+// NOTES:
+// - Scalar kinds must match pkg/automerge/types.go (scalarKind*)
+// - Typed JSON nodes look like {"t":"<kind>","v":<value>} so Go can tell a
+//   Text object apart from a plain string
+// ==============================================================================
+
+use automerge::{AutoCommit, ObjId, ObjType, ReadDoc, ScalarValue, Value};
+
+// Scalar kinds (must match pkg/automerge/types.go)
+pub(crate) const KIND_NULL: u8 = 0;
+pub(crate) const KIND_BOOL: u8 = 1;
+pub(crate) const KIND_INT: u8 = 2;
+pub(crate) const KIND_UINT: u8 = 3;
+pub(crate) const KIND_F64: u8 = 4;
+pub(crate) const KIND_STR: u8 = 5;
+pub(crate) const KIND_COUNTER: u8 = 6;
+pub(crate) const KIND_TIMESTAMP: u8 = 7;
+pub(crate) const KIND_BYTES: u8 = 8;
+
+/// Decode a scalar from its kind tag and byte payload.
+///
+/// Numbers and booleans are sent as their decimal/"true"/"false" text,
+/// strings as UTF-8 and bytes as-is.
+pub(crate) fn parse_scalar(kind: u8, data: &[u8]) -> Result<ScalarValue, ()> {
+    if kind == KIND_BYTES {
+        return Ok(ScalarValue::Bytes(data.to_vec()));
+    }
+
+    let text = std::str::from_utf8(data).map_err(|_| ())?;
+    match kind {
+        KIND_NULL => Ok(ScalarValue::Null),
+        KIND_BOOL => match text {
+            "true" => Ok(ScalarValue::Boolean(true)),
+            "false" => Ok(ScalarValue::Boolean(false)),
+            _ => Err(()),
+        },
+        KIND_INT => text.parse::<i64>().map(ScalarValue::Int).map_err(|_| ()),
+        KIND_UINT => text.parse::<u64>().map(ScalarValue::Uint).map_err(|_| ()),
+        KIND_F64 => text.parse::<f64>().map(ScalarValue::F64).map_err(|_| ()),
+        KIND_STR => Ok(ScalarValue::Str(text.into())),
+        KIND_COUNTER => text.parse::<i64>().map(ScalarValue::counter).map_err(|_| ()),
+        KIND_TIMESTAMP => text.parse::<i64>().map(ScalarValue::Timestamp).map_err(|_| ()),
+        _ => Err(()),
+    }
+}
+
+/// Decode an object type tag (0=map, 1=list, 2=text).
+pub(crate) fn parse_obj_type(tag: u8) -> Result<ObjType, ()> {
+    match tag {
+        0 => Ok(ObjType::Map),
+        1 => Ok(ObjType::List),
+        2 => Ok(ObjType::Text),
+        _ => Err(()),
+    }
+}
+
+/// Append `s` to `out` as a quoted, escaped JSON string.
+pub(crate) fn push_json_str(out: &mut String, s: &str) {
+    out.push('"');
+    for c in s.chars() {
+        match c {
+            '"' => out.push_str("\\\""),
+            '\\' => out.push_str("\\\\"),
+            '\n' => out.push_str("\\n"),
+            '\r' => out.push_str("\\r"),
+            '\t' => out.push_str("\\t"),
+            c if (c as u32) < 0x20 => out.push_str(&format!("\\u{:04x}", c as u32)),
+            c => out.push(c),
+        }
+    }
+    out.push('"');
+}
+
+/// Append a scalar as a typed JSON node.
+pub(crate) fn push_scalar_json(out: &mut String, value: &ScalarValue) {
+    match value {
+        ScalarValue::Str(s) => {
+            out.push_str(r#"{"t":"str","v":"#);
+            push_json_str(out, s);
+        }
+        ScalarValue::Int(i) => out.push_str(&format!(r#"{{"t":"int","v":{}"#, i)),
+        ScalarValue::Uint(u) => out.push_str(&format!(r#"{{"t":"uint","v":{}"#, u)),
+        ScalarValue::F64(f) if f.is_finite() => out.push_str(&format!(r#"{{"t":"f64","v":{}"#, f)),
+        ScalarValue::Boolean(b) => out.push_str(&format!(r#"{{"t":"bool","v":{}"#, b)),
+        ScalarValue::Counter(c) => out.push_str(&format!(r#"{{"t":"counter","v":{}"#, i64::from(c))),
+        ScalarValue::Timestamp(t) => out.push_str(&format!(r#"{{"t":"timestamp","v":{}"#, t)),
+        ScalarValue::Bytes(b) => {
+            out.push_str(r#"{"t":"bytes","v":""#);
+            for byte in b {
+                out.push_str(&format!("{:02x}", byte));
+            }
+            out.push('"');
+        }
+        _ => out.push_str(r#"{"t":"null","v":null"#),
+    }
+    out.push('}');
+}
+
+/// Append a document value (and everything below it) as a typed JSON node.
+pub(crate) fn push_value_json(doc: &AutoCommit, value: &Value, id: &ObjId, out: &mut String) {
+    match value {
+        Value::Scalar(s) => push_scalar_json(out, s.as_ref()),
+        Value::Object(ObjType::Text) => {
+            out.push_str(r#"{"t":"text","v":"#);
+            push_json_str(out, &doc.text(id).unwrap_or_default());
+            out.push('}');
+        }
+        Value::Object(ObjType::List) => {
+            out.push_str(r#"{"t":"list","v":["#);
+            for i in 0..doc.length(id) {
+                if i > 0 {
+                    out.push(',');
+                }
+                match doc.get(id, i) {
+                    Ok(Some((v, child))) => push_value_json(doc, &v, &child, out),
+                    _ => out.push_str(r#"{"t":"null","v":null}"#),
+                }
+            }
+            out.push_str("]}");
+        }
+        Value::Object(_) => {
+            out.push_str(r#"{"t":"map","v":{"#);
+            let mut first = true;
+            for key in doc.keys(id) {
+                if let Ok(Some((v, child))) = doc.get(id, key.as_str()) {
+                    if !first {
+                        out.push(',');
+                    }
+                    first = false;
+                    push_json_str(out, &key);
+                    out.push(':');
+                    push_value_json(doc, &v, &child, out);
+                }
+            }
+            out.push_str("}}");
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_parse_scalar() {
+        assert_eq!(parse_scalar(KIND_INT, b"-42"), Ok(ScalarValue::Int(-42)));
+        assert_eq!(parse_scalar(KIND_BOOL, b"true"), Ok(ScalarValue::Boolean(true)));
+        assert_eq!(parse_scalar(KIND_STR, "héllo".as_bytes()), Ok(ScalarValue::Str("héllo".into())));
+        assert!(parse_scalar(KIND_INT, b"abc").is_err());
+        assert!(parse_scalar(99, b"").is_err());
+    }
+
+    #[test]
+    fn test_push_json_str_escapes() {
+        let mut out = String::new();
+        push_json_str(&mut out, "a\"b\\c\nd");
+        assert_eq!(out, r#""a\"b\\c\nd""#);
+    }
+}
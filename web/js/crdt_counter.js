@@ -189,6 +189,12 @@ export class CounterComponent {
             this.getValue();
         });
 
+        // This tab fell behind and missed changes: reload
+        this.eventSource.addEventListener('resync', (event) => {
+            console.log('SSE resync:', event.data);
+            this.getValue();
+        });
+
         this.eventSource.onopen = () => {
             console.log('SSE connection opened');
         };
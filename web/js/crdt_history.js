@@ -162,6 +162,12 @@ export class HistoryComponent {
             this.refresh();
         });
 
+        // This tab fell behind and missed changes: reload
+        this.eventSource.addEventListener('resync', (event) => {
+            console.log('SSE resync:', event.data);
+            this.refresh();
+        });
+
         this.eventSource.onopen = () => {
             console.log('SSE connection opened');
         };
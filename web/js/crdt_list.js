@@ -241,6 +241,12 @@ export class ListComponent {
             this.loadList();
         });
 
+        // This tab fell behind and missed changes: reload
+        this.eventSource.addEventListener('resync', (event) => {
+            console.log('SSE resync:', event.data);
+            this.loadList();
+        });
+
         this.eventSource.onopen = () => {
             console.log('SSE connection opened');
         };
@@ -213,6 +213,12 @@ export class MapComponent {
             this.listKeys();
         });
 
+        // This tab fell behind and missed changes: reload
+        this.eventSource.addEventListener('resync', (event) => {
+            console.log('SSE resync:', event.data);
+            this.listKeys();
+        });
+
         this.eventSource.onopen = () => {
             console.log('SSE connection opened');
         };
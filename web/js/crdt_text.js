@@ -125,10 +125,22 @@ export class TextComponent {
             }
         });
 
+        // This tab fell behind and missed changes: the resync carries the
+        // current text, like a snapshot
+        this.eventSource.addEventListener('resync', (event) => {
+            console.log('SSE resync:', event.data);
+            const data = JSON.parse(event.data);
+            if (!this.isLocalChange) {
+                this.editor.value = data.text;
+                this.updateCharCount();
+            }
+        });
+
         this.eventSource.addEventListener('update', (event) => {
             console.log('SSE update:', event.data);
-            if (!this.isLocalChange) {
-                const data = JSON.parse(event.data);
+            const data = JSON.parse(event.data);
+            // Only changes that may have touched the text carry it
+            if (!this.isLocalChange && data.text !== undefined) {
                 this.editor.value = data.text;
                 this.updateCharCount();
             }